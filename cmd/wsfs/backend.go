@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/databricks"
+	"wsfs/internal/faultinject"
+)
+
+// backendSpec selects a registered backend as "name" or "name:arg".
+type backendSpec struct {
+	name string
+	arg  string
+}
+
+func (s backendSpec) String() string {
+	if s.arg == "" {
+		return s.name
+	}
+	return s.name + ":" + s.arg
+}
+
+// backendRoute mounts a backend at a path prefix ("PREFIX=name[:arg]").
+type backendRoute struct {
+	prefix string
+	spec   backendSpec
+}
+
+func parseBackendSpec(value string) (backendSpec, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(value), ":")
+	if name == "" {
+		return backendSpec{}, fmt.Errorf("empty backend name")
+	}
+	if !backend.Registered(name) {
+		return backendSpec{}, fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(backend.Names(), ", "))
+	}
+	return backendSpec{name: name, arg: arg}, nil
+}
+
+func parseBackendRoute(value string) (backendRoute, error) {
+	prefix, specValue, ok := strings.Cut(value, "=")
+	if !ok || !strings.HasPrefix(prefix, "/") {
+		return backendRoute{}, fmt.Errorf("expected /PREFIX=BACKEND[:ARG], got %q", value)
+	}
+	spec, err := parseBackendSpec(specValue)
+	if err != nil {
+		return backendRoute{}, err
+	}
+	return backendRoute{prefix: path.Clean(prefix), spec: spec}, nil
+}
+
+// needsWorkspace reports whether any configured backend talks to Databricks
+// through the default workspace client. --workspace members log in to
+// their own profiles instead.
+func (cfg cliConfig) needsWorkspace() bool {
+	if len(cfg.workspaces) > 0 {
+		return false
+	}
+	if cfg.backend.name == backend.WorkspaceName {
+		return true
+	}
+	for _, route := range cfg.backendRoutes {
+		if route.spec.name == backend.WorkspaceName {
+			return true
+		}
+	}
+	return false
+}
+
+// buildBackend creates the configured backend, wrapping it in a Router when
+// path-prefix routes are configured and in a Snapshot with --snapshot. Non-workspace backends get faults
+// injected directly; the workspace client gets them through its transport.
+func buildBackend(cfg cliConfig, w *databrickssdk.WorkspaceClient, faults *faultinject.Injector, deps runDeps) (databricks.WorkspaceFilesAPI, error) {
+	open := func(spec backendSpec) (databricks.WorkspaceFilesAPI, error) {
+		if spec.name == backend.WorkspaceName {
+			return openWorkspaceFiles(cfg, w, deps)
+		}
+		b, err := backend.New(spec.name, backend.Options{Workspace: w, Arg: spec.arg})
+		if err != nil {
+			return nil, err
+		}
+		return backend.WithFaults(b, faults), nil
+	}
+
+	api, err := open(cfg.backend)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.backendRoutes) > 0 {
+		routes := make([]backend.Route, 0, len(cfg.backendRoutes))
+		for _, route := range cfg.backendRoutes {
+			b, err := open(route.spec)
+			if err != nil {
+				return nil, fmt.Errorf("backend for %s: %w", route.prefix, err)
+			}
+			routes = append(routes, backend.Route{Prefix: route.prefix, Backend: b})
+		}
+		api = backend.NewRouter(api, routes...)
+	}
+	if cfg.snapshot {
+		api = backend.WithSnapshot(api)
+	}
+	return api, nil
+}
+
+// openWorkspaceFiles creates the workspace files client of w with the
+// configured cache and transfer settings.
+func openWorkspaceFiles(cfg cliConfig, w *databrickssdk.WorkspaceClient, deps runDeps) (databricks.WorkspaceFilesAPI, error) {
+	api, err := deps.newWorkspaceFilesClient(w)
+	if err != nil {
+		return nil, err
+	}
+	if client, ok := api.(*databricks.WorkspaceFilesClient); ok {
+		client.SetCacheConfig(cfg.cacheConfig())
+		client.SetTransferConfig(cfg.transfer)
+		client.SetNotebookAliases(cfg.notebookAliases)
+	}
+	return api, nil
+}
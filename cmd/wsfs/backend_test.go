@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	iofs "io/fs"
+	"net/http"
+	"os/user"
+	"strings"
+	"testing"
+	"time"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/databricks"
+	"wsfs/internal/faultinject"
+	"wsfs/internal/filecache"
+	wsfsfuse "wsfs/internal/fuse"
+	"wsfs/internal/record"
+)
+
+const testLocalBackend = "test-cli-local"
+
+var testLocalBackendArgs []string
+
+func init() {
+	backend.Register(testLocalBackend, func(opts backend.Options) (backend.Backend, error) {
+		testLocalBackendArgs = append(testLocalBackendArgs, opts.Arg)
+		return &fakeWorkspaceFilesClient{}, nil
+	})
+}
+
+func TestParseBackendSpec(t *testing.T) {
+	spec, err := parseBackendSpec(testLocalBackend + ":/srv/demo")
+	if err != nil {
+		t.Fatalf("parseBackendSpec failed: %v", err)
+	}
+	if spec.name != testLocalBackend || spec.arg != "/srv/demo" {
+		t.Fatalf("unexpected spec: %+v", spec)
+	}
+	if spec.String() != testLocalBackend+":/srv/demo" {
+		t.Fatalf("unexpected String: %q", spec.String())
+	}
+
+	for _, value := range []string{"", "nope", ":arg"} {
+		if _, err := parseBackendSpec(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
+
+func TestParseBackendRoute(t *testing.T) {
+	route, err := parseBackendRoute("/Volumes/demo/=" + testLocalBackend + ":/tmp/x")
+	if err != nil {
+		t.Fatalf("parseBackendRoute failed: %v", err)
+	}
+	if route.prefix != "/Volumes/demo" || route.spec.name != testLocalBackend || route.spec.arg != "/tmp/x" {
+		t.Fatalf("unexpected route: %+v", route)
+	}
+
+	for _, value := range []string{"Volumes=" + testLocalBackend, "/Volumes", "/Volumes=unknown"} {
+		if _, err := parseBackendRoute(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
+
+func TestParseArgsBackendDefaultsToWorkspace(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.backend.name != backend.WorkspaceName || len(cfg.backendRoutes) != 0 || !cfg.needsWorkspace() {
+		t.Fatalf("unexpected backend config: %+v", cfg)
+	}
+}
+
+func TestParseArgsBackendRoutes(t *testing.T) {
+	cfg, err := parseArgs([]string{
+		"wsfs",
+		"--backend=" + testLocalBackend + ":/srv",
+		"--backend-route=/Users=workspace",
+		"--backend-route=/Volumes=" + testLocalBackend,
+		"/mnt/wsfs",
+	})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.backend.name != testLocalBackend || len(cfg.backendRoutes) != 2 {
+		t.Fatalf("unexpected backend config: %+v", cfg)
+	}
+	if !cfg.needsWorkspace() {
+		t.Fatal("expected workspace route to require Databricks")
+	}
+}
+
+func TestParseArgsInvalidBackend(t *testing.T) {
+	for _, args := range [][]string{
+		{"wsfs", "--backend=nope", "/mnt/wsfs"},
+		{"wsfs", "--backend-route=/x", "/mnt/wsfs"},
+	} {
+		_, err := parseArgs(args)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("expected exit code 2 for %v, got %v", args, err)
+		}
+	}
+}
+
+func TestBuildBackendWrapsRoutesInRouter(t *testing.T) {
+	testLocalBackendArgs = nil
+	cfg := cliConfig{
+		backend:       backendSpec{name: backend.WorkspaceName},
+		backendRoutes: []backendRoute{{prefix: "/Volumes", spec: backendSpec{name: testLocalBackend, arg: "/srv"}}},
+	}
+	deps := testDeps()
+	deps.newWorkspaceFilesClient = func(*databrickssdk.WorkspaceClient) (databricks.WorkspaceFilesAPI, error) {
+		return &fakeWorkspaceFilesClient{}, nil
+	}
+
+	api, err := buildBackend(cfg, nil, nil, deps)
+	if err != nil {
+		t.Fatalf("buildBackend failed: %v", err)
+	}
+	if _, ok := api.(*backend.Router); !ok {
+		t.Fatalf("expected router, got %T", api)
+	}
+	if len(testLocalBackendArgs) != 1 || testLocalBackendArgs[0] != "/srv" {
+		t.Fatalf("expected routed backend built with arg, got %v", testLocalBackendArgs)
+	}
+
+	cfg.backendRoutes = nil
+	api, err = buildBackend(cfg, nil, nil, deps)
+	if err != nil {
+		t.Fatalf("buildBackend failed: %v", err)
+	}
+	if _, ok := api.(*fakeWorkspaceFilesClient); !ok {
+		t.Fatalf("expected plain workspace client without routes, got %T", api)
+	}
+}
+
+func TestBuildBackendWrapsSnapshot(t *testing.T) {
+	cfg := cliConfig{
+		backend:       backendSpec{name: backend.WorkspaceName},
+		backendRoutes: []backendRoute{{prefix: "/Volumes", spec: backendSpec{name: testLocalBackend, arg: "/srv"}}},
+		snapshot:      true,
+	}
+	deps := testDeps()
+	deps.newWorkspaceFilesClient = func(*databrickssdk.WorkspaceClient) (databricks.WorkspaceFilesAPI, error) {
+		return &fakeWorkspaceFilesClient{}, nil
+	}
+
+	api, err := buildBackend(cfg, nil, nil, deps)
+	if err != nil {
+		t.Fatalf("buildBackend failed: %v", err)
+	}
+	if _, ok := api.(*backend.Snapshot); !ok {
+		t.Fatalf("expected snapshot over the router, got %T", api)
+	}
+}
+
+func TestRunLocalBackendSkipsDatabricksLogin(t *testing.T) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
+		t.Fatal("initWorkspace must not be called without a workspace backend")
+		return nil, nil
+	}
+	deps.currentUser = func() (*user.User, error) {
+		return &user.User{Uid: "123", Gid: "456"}, nil
+	}
+	deps.newDiskCache = func() (*filecache.DiskCache, error) {
+		return filecache.NewDisabledCache(), nil
+	}
+	deps.newRootNode = func(api databricks.WorkspaceFilesAPI, cache *filecache.DiskCache, rootPath string, registry *wsfsfuse.DirtyNodeRegistry, config *wsfsfuse.NodeConfig) (*wsfsfuse.WSNode, error) {
+		if _, ok := api.(*fakeWorkspaceFilesClient); !ok {
+			t.Fatalf("expected local test backend, got %T", api)
+		}
+		return &wsfsfuse.WSNode{}, nil
+	}
+	server := &fakeServer{waitCh: make(chan struct{})}
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
+		return server, nil
+	}
+	deps.signalContext = func() (context.Context, context.CancelFunc) {
+		return context.WithCancel(context.Background())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- run([]string{"wsfs", "--backend=" + testLocalBackend, "/mnt/wsfs"}, deps)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := server.Unmount(); err != nil {
+		t.Fatalf("unmount failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run did not return")
+	}
+}
+
+func TestBuildBackendInjectsFaultsIntoNonWorkspaceBackends(t *testing.T) {
+	cfg := cliConfig{backend: backendSpec{name: testLocalBackend, arg: "/srv"}}
+	faults := faultinject.New(faultinject.Config{})
+
+	api, err := buildBackend(cfg, nil, faults, defaultDeps())
+	if err != nil {
+		t.Fatalf("buildBackend failed: %v", err)
+	}
+	if _, ok := api.(*backend.Faulty); !ok {
+		t.Fatalf("expected fault-injecting backend, got %T", api)
+	}
+}
+
+func TestRunPassesFaultTransportToWorkspace(t *testing.T) {
+	t.Setenv(faultinject.EnvVar, "latency=1ms")
+	deps := testDeps()
+	var gotTransport http.RoundTripper
+	deps.initWorkspace = func(transport http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
+		gotTransport = transport
+		return nil, errors.New("stop")
+	}
+
+	if err := run([]string{"wsfs", "/mnt/wsfs"}, deps); err == nil {
+		t.Fatal("expected initWorkspace error")
+	}
+	if _, ok := gotTransport.(*faultinject.Transport); !ok {
+		t.Fatalf("expected fault-injecting transport, got %T", gotTransport)
+	}
+}
+
+func TestRunRejectsInvalidFaultSpec(t *testing.T) {
+	t.Setenv(faultinject.EnvVar, "500=lots")
+	err := run([]string{"wsfs", "/mnt/wsfs"}, defaultDeps())
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for invalid %s, got %v", faultinject.EnvVar, err)
+	}
+}
+
+func TestBuildBackendAppliesTransferConfig(t *testing.T) {
+	var paths []string
+	api := &databricks.MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			if strings.Contains(path, "object-info") {
+				return iofs.ErrNotExist
+			}
+			paths = append(paths, path)
+			return nil
+		},
+	}
+	deps := testDeps()
+	deps.newWorkspaceFilesClient = func(*databrickssdk.WorkspaceClient) (databricks.WorkspaceFilesAPI, error) {
+		return databricks.NewWorkspaceFilesClientWithDeps(&databricks.MockWorkspaceClient{}, api, nil), nil
+	}
+	cfg := cliConfig{
+		backend:  backendSpec{name: backend.WorkspaceName},
+		transfer: databricks.TransferConfig{SignedURLThreshold: 1},
+	}
+
+	client, err := buildBackend(cfg, nil, nil, deps)
+	if err != nil {
+		t.Fatalf("buildBackend failed: %v", err)
+	}
+	if err := client.Write(context.Background(), "/small.txt", []byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	// With a 1-byte threshold even a tiny file tries the signed URL path
+	// first; the mock returns no URL, so it falls back to import-file.
+	if len(paths) != 2 || !strings.Contains(paths[0], "new-files") || !strings.Contains(paths[1], "import-file") {
+		t.Fatalf("expected new-files then import-file, got %v", paths)
+	}
+}
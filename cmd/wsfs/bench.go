@@ -0,0 +1,406 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// benchWorkloads are the workloads of `wsfs bench`, in the order they run.
+var benchWorkloads = []string{"seq-write", "seq-read", "small-files", "stat", "readdir"}
+
+// benchSmallFileSize is the size of each file of the small-files workload.
+const benchSmallFileSize = 4 << 10
+
+// benchConfig sizes the workloads of a `wsfs bench` run.
+type benchConfig struct {
+	size        int64 // of the seq-write and seq-read file
+	blockSize   int
+	files       int // written by small-files, stated and listed
+	rounds      int // of stat and readdir
+	concurrency int // of small-files and stat
+}
+
+// benchResult is a workload's line of the `wsfs bench` report.
+type benchResult struct {
+	Workload  string  `json:"workload"`
+	Ops       int     `json:"ops"`
+	Bytes     int64   `json:"bytes,omitempty"`
+	Seconds   float64 `json:"seconds"`
+	OpsPerSec float64 `json:"ops_per_sec"`
+	MBPerSec  float64 `json:"mb_per_sec,omitempty"`
+	P50Us     int64   `json:"p50_us"`
+	P90Us     int64   `json:"p90_us"`
+	P99Us     int64   `json:"p99_us"`
+	MaxUs     int64   `json:"max_us"`
+}
+
+// benchRun is the scratch directory of a `wsfs bench` run and what its
+// workloads left there for later ones.
+type benchRun struct {
+	cfg          benchConfig
+	bigFile      string // written by seq-write
+	smallDir     string // holds the small-files files
+	smallWritten bool
+}
+
+// runBench implements `wsfs bench`: it runs standard workloads in a scratch
+// directory below DIR, normally inside a mount, and reports operations per
+// second and latency percentiles, so a slow mount can be told apart from a
+// slow machine or network and regressions show up as numbers.
+func runBench(program string, args []string, stdout io.Writer) error {
+	usage := fmt.Sprintf("Usage: %s bench [--workloads=LIST] [--size=SIZE] [--block-size=SIZE] [--files=N] [--rounds=N] [--concurrency=N] [--keep] [--json] DIR", program)
+	fs := flag.NewFlagSet(program+" bench", flag.ContinueOnError)
+	workloads := fs.String("workloads", strings.Join(benchWorkloads, ","), "comma-separated workloads to run: "+strings.Join(benchWorkloads, ", "))
+	size := fs.String("size", "64M", "size of the file seq-write writes and seq-read reads")
+	blockSize := fs.String("block-size", "1M", "size of each read and write of seq-write and seq-read")
+	files := fs.Int("files", 100, "files small-files writes, stat stats and readdir lists")
+	rounds := fs.Int("rounds", 10, "times stat stats every file and readdir lists the directory")
+	concurrency := fs.Int("concurrency", 8, "parallel workers of small-files and stat")
+	keep := fs.Bool("keep", false, "keep the scratch directory instead of removing it")
+	jsonOutput := fs.Bool("json", false, "print the results as JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return &cliError{exitCode: 0, printed: true}
+		}
+		return &cliError{exitCode: 2, msg: err.Error(), printed: true}
+	}
+	if fs.NArg() != 1 {
+		return &cliError{exitCode: 2, msg: usage}
+	}
+	selected, err := parseBenchWorkloads(*workloads)
+	if err != nil {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --workloads: %v", err)}
+	}
+	cfg := benchConfig{files: *files, rounds: *rounds, concurrency: *concurrency}
+	sizeBytes, err := parseByteSize(*size)
+	if err != nil || sizeBytes == 0 {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --size: %q", *size)}
+	}
+	cfg.size = int64(sizeBytes)
+	blockBytes, err := parseByteSize(*blockSize)
+	if err != nil || blockBytes == 0 || blockBytes > 64<<20 {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --block-size: %q (want 1 byte to 64M)", *blockSize)}
+	}
+	cfg.blockSize = int(blockBytes)
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{{"files", cfg.files}, {"rounds", cfg.rounds}, {"concurrency", cfg.concurrency}} {
+		if limit.value < 1 {
+			return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --%s: %d", limit.name, limit.value)}
+		}
+	}
+	dir := fs.Arg(0)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("%s is not a directory", dir)}
+	}
+
+	scratch, err := os.MkdirTemp(dir, "wsfs-bench-")
+	if err != nil {
+		return fmt.Errorf("create scratch directory: %w", err)
+	}
+	if *keep {
+		fmt.Fprintf(os.Stderr, "Keeping scratch directory %s\n", scratch)
+	} else {
+		defer os.RemoveAll(scratch)
+	}
+	run := &benchRun{cfg: cfg, bigFile: filepath.Join(scratch, "seq.bin"), smallDir: filepath.Join(scratch, "small")}
+
+	var results []benchResult
+	for _, workload := range selected {
+		result, err := run.run(workload)
+		if err != nil {
+			return fmt.Errorf("%s: %w", workload, err)
+		}
+		results = append(results, result)
+	}
+
+	if *jsonOutput {
+		return printJSON(stdout, results)
+	}
+	printBenchResults(stdout, results)
+	return nil
+}
+
+func parseBenchWorkloads(value string) ([]string, error) {
+	var selected []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if !slices.Contains(benchWorkloads, name) {
+			return nil, fmt.Errorf("unknown workload %q (available: %s)", name, strings.Join(benchWorkloads, ", "))
+		}
+		seen[name] = true
+	}
+	// Run in the standard order, so seq-read reads what seq-write wrote.
+	for _, name := range benchWorkloads {
+		if seen[name] {
+			selected = append(selected, name)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("no workload selected")
+	}
+	return selected, nil
+}
+
+// run times one workload. Files a workload needs but an earlier one did not
+// leave are prepared first, untimed.
+func (b *benchRun) run(workload string) (benchResult, error) {
+	var (
+		latencies []time.Duration
+		bytes     int64
+		err       error
+	)
+	switch workload {
+	case "seq-read", "stat", "readdir":
+		if err := b.prepare(workload); err != nil {
+			return benchResult{}, fmt.Errorf("prepare: %w", err)
+		}
+	}
+	start := time.Now()
+	switch workload {
+	case "seq-write":
+		latencies, bytes, err = b.seqWrite()
+	case "seq-read":
+		latencies, bytes, err = b.seqRead()
+	case "small-files":
+		latencies, err = b.smallFiles()
+		bytes = int64(len(latencies)) * benchSmallFileSize
+	case "stat":
+		latencies, err = b.statStorm()
+	case "readdir":
+		latencies, err = b.readDirs()
+	}
+	if err != nil {
+		return benchResult{}, err
+	}
+	return summarizeBench(workload, latencies, bytes, time.Since(start)), nil
+}
+
+func (b *benchRun) prepare(workload string) error {
+	if workload == "seq-read" {
+		if _, err := os.Stat(b.bigFile); err == nil {
+			return nil
+		}
+		_, _, err := b.seqWrite()
+		return err
+	}
+	if b.smallWritten {
+		return nil
+	}
+	_, err := b.smallFiles()
+	return err
+}
+
+// seqWrite writes the big file a block at a time. The final close, which
+// uploads the file, counts as one more operation.
+func (b *benchRun) seqWrite() ([]time.Duration, int64, error) {
+	f, err := os.OpenFile(b.bigFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, 0, err
+	}
+	block := benchBlock(b.cfg.blockSize)
+	var latencies []time.Duration
+	var written int64
+	for written < b.cfg.size {
+		chunk := block[:min(int64(len(block)), b.cfg.size-written)]
+		start := time.Now()
+		n, err := f.Write(chunk)
+		latencies = append(latencies, time.Since(start))
+		written += int64(n)
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+	}
+	start := time.Now()
+	if err := f.Close(); err != nil {
+		return nil, 0, err
+	}
+	latencies = append(latencies, time.Since(start))
+	return latencies, written, nil
+}
+
+// seqRead reads the big file back a block at a time.
+func (b *benchRun) seqRead() ([]time.Duration, int64, error) {
+	f, err := os.Open(b.bigFile)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	buf := make([]byte, b.cfg.blockSize)
+	var latencies []time.Duration
+	var read int64
+	for {
+		start := time.Now()
+		n, err := f.Read(buf)
+		latencies = append(latencies, time.Since(start))
+		read += int64(n)
+		if err == io.EOF {
+			return latencies, read, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// smallFiles creates, writes and closes the small files, one operation per
+// file.
+func (b *benchRun) smallFiles() ([]time.Duration, error) {
+	if err := os.MkdirAll(b.smallDir, 0o755); err != nil {
+		return nil, err
+	}
+	data := benchBlock(benchSmallFileSize)
+	latencies, err := b.parallel(b.cfg.files, func(i int) error {
+		return os.WriteFile(b.smallFile(i), data, 0o644)
+	})
+	if err == nil {
+		b.smallWritten = true
+	}
+	return latencies, err
+}
+
+// statStorm stats every small file, rounds times over.
+func (b *benchRun) statStorm() ([]time.Duration, error) {
+	return b.parallel(b.cfg.files*b.cfg.rounds, func(i int) error {
+		_, err := os.Lstat(b.smallFile(i % b.cfg.files))
+		return err
+	})
+}
+
+// readDirs lists the directory of small files, rounds times over.
+func (b *benchRun) readDirs() ([]time.Duration, error) {
+	latencies := make([]time.Duration, 0, b.cfg.rounds)
+	for i := 0; i < b.cfg.rounds; i++ {
+		start := time.Now()
+		entries, err := os.ReadDir(b.smallDir)
+		latencies = append(latencies, time.Since(start))
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) != b.cfg.files {
+			return nil, fmt.Errorf("listed %d entries, want %d", len(entries), b.cfg.files)
+		}
+	}
+	return latencies, nil
+}
+
+func (b *benchRun) smallFile(i int) string {
+	return filepath.Join(b.smallDir, fmt.Sprintf("file-%05d.txt", i))
+}
+
+// parallel runs op for 0 through n-1 on the configured number of workers
+// and returns the latency of each call. The first error is returned after
+// all workers stop.
+func (b *benchRun) parallel(n int, op func(i int) error) ([]time.Duration, error) {
+	latencies := make([]time.Duration, n)
+	next := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for w := 0; w < min(b.cfg.concurrency, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				start := time.Now()
+				err := op(i)
+				latencies[i] = time.Since(start)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return latencies, firstErr
+}
+
+// benchBlock returns size bytes of text to write.
+func benchBlock(size int) []byte {
+	line := "wsfs bench " + strings.Repeat("0123456789", 6) + "\n"
+	return []byte(strings.Repeat(line, size/len(line)+1)[:size])
+}
+
+func summarizeBench(workload string, latencies []time.Duration, bytes int64, elapsed time.Duration) benchResult {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	result := benchResult{
+		Workload: workload,
+		Ops:      len(sorted),
+		Bytes:    bytes,
+		Seconds:  elapsed.Seconds(),
+		P50Us:    percentile(sorted, 0.50).Microseconds(),
+		P90Us:    percentile(sorted, 0.90).Microseconds(),
+		P99Us:    percentile(sorted, 0.99).Microseconds(),
+		MaxUs:    percentile(sorted, 1).Microseconds(),
+	}
+	if elapsed > 0 {
+		result.OpsPerSec = float64(len(sorted)) / elapsed.Seconds()
+		result.MBPerSec = float64(bytes) / (1 << 20) / elapsed.Seconds()
+	}
+	return result
+}
+
+// percentile returns the nearest-rank percentile p (0 to 1) of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func printBenchResults(w io.Writer, results []benchResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "workload\tops\tops/s\tMB/s\tp50\tp90\tp99\tmax\t")
+	for _, r := range results {
+		mbps := "-"
+		if r.Bytes > 0 {
+			mbps = fmt.Sprintf("%.1f", r.MBPerSec)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\t\n", r.Workload, r.Ops, r.OpsPerSec, mbps,
+			benchLatency(r.P50Us), benchLatency(r.P90Us), benchLatency(r.P99Us), benchLatency(r.MaxUs))
+	}
+	tw.Flush()
+}
+
+// benchLatency formats microseconds with a precision that suits both cache
+// hits and network round trips.
+func benchLatency(us int64) string {
+	d := time.Duration(us) * time.Microsecond
+	switch {
+	case d < time.Millisecond:
+		return fmt.Sprintf("%dµs", us)
+	case d < time.Second:
+		return fmt.Sprintf("%.1fms", float64(us)/1000)
+	default:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	}
+}
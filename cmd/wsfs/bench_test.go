@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunBenchReportsEveryWorkload(t *testing.T) {
+	dir := t.TempDir()
+	deps := defaultDeps()
+	var out bytes.Buffer
+	deps.stdout = &out
+	args := []string{"wsfs", "bench", "--size=10K", "--block-size=4K", "--files=5", "--rounds=2", "--concurrency=2", "--json", dir}
+	if err := run(args, deps); err != nil {
+		t.Fatalf("bench = %v", err)
+	}
+	var results []benchResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("decode %q: %v", out.String(), err)
+	}
+	want := map[string]struct {
+		ops   int
+		bytes int64
+	}{
+		"seq-write":   {ops: 4, bytes: 10 << 10}, // three writes and the close
+		"seq-read":    {ops: 4, bytes: 10 << 10}, // three reads and EOF
+		"small-files": {ops: 5, bytes: 5 * benchSmallFileSize},
+		"stat":        {ops: 10},
+		"readdir":     {ops: 2},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v, want %d workloads", results, len(want))
+	}
+	for i, r := range results {
+		if r.Workload != benchWorkloads[i] {
+			t.Fatalf("workload %d = %s, want %s", i, r.Workload, benchWorkloads[i])
+		}
+		if w := want[r.Workload]; r.Ops != w.ops || r.Bytes != w.bytes {
+			t.Errorf("%s: ops %d, bytes %d; want %d, %d", r.Workload, r.Ops, r.Bytes, w.ops, w.bytes)
+		}
+		if r.P50Us > r.P90Us || r.P90Us > r.P99Us || r.P99Us > r.MaxUs {
+			t.Errorf("%s: percentiles out of order: %+v", r.Workload, r)
+		}
+	}
+	if names, _ := os.ReadDir(dir); len(names) != 0 {
+		t.Fatalf("scratch directory left behind: %v", names)
+	}
+}
+
+func TestRunBenchPreparesSkippedWorkloads(t *testing.T) {
+	deps := defaultDeps()
+	var out bytes.Buffer
+	deps.stdout = &out
+	args := []string{"wsfs", "bench", "--workloads=readdir,seq-read", "--size=1K", "--files=3", "--rounds=1", t.TempDir()}
+	if err := run(args, deps); err != nil {
+		t.Fatalf("bench = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "p99") || !strings.Contains(lines[1], "seq-read") || !strings.Contains(lines[2], "readdir") {
+		t.Fatalf("output:\n%s\nwant a header, seq-read and readdir", out.String())
+	}
+}
+
+func TestRunBenchUsageErrors(t *testing.T) {
+	dir := t.TempDir()
+	deps := defaultDeps()
+	deps.stdout = &bytes.Buffer{}
+	for _, args := range [][]string{
+		{"wsfs", "bench"},
+		{"wsfs", "bench", "--workloads=fsync", dir},
+		{"wsfs", "bench", "--size=0", dir},
+		{"wsfs", "bench", "--files=0", dir},
+		{"wsfs", "bench", filepath.Join(dir, "missing")},
+	} {
+		err := run(args, deps)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("run %v = %v, want exit code 2", args[2:], err)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	for _, tt := range []struct {
+		p    float64
+		want time.Duration
+	}{{0.5, 50 * time.Millisecond}, {0.99, 99 * time.Millisecond}, {1, 100 * time.Millisecond}, {0, time.Millisecond}} {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("percentile of nothing = %v", got)
+	}
+}
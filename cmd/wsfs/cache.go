@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"wsfs/internal/controlapi"
+)
+
+// pinTimeout bounds a pin request, which downloads the files it pins.
+const pinTimeout = 30 * time.Minute
+
+// runCache implements `wsfs cache`: `pin` keeps the files below a path in
+// the disk cache of a running mount, exempt from LRU and TTL eviction, and
+// `unpin` lets them go again.
+func runCache(program string, args []string, stdout io.Writer) error {
+	usage := fmt.Sprintf("Usage: %s cache pin|unpin --control-socket SOCKET [--json] PATH", program)
+	if len(args) == 0 || (args[0] != "pin" && args[0] != "unpin") {
+		return &cliError{exitCode: 2, msg: usage}
+	}
+	action := args[0]
+	fs := flag.NewFlagSet(program+" cache "+action, flag.ContinueOnError)
+	controlSocket := fs.String("control-socket", "", "control API socket of the mount (the mount's --control-socket)")
+	jsonOutput := fs.Bool("json", false, "print the result as JSON")
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return &cliError{exitCode: 0, printed: true}
+		}
+		return &cliError{exitCode: 2, msg: err.Error(), printed: true}
+	}
+	if fs.NArg() != 1 {
+		return &cliError{exitCode: 2, msg: usage}
+	}
+	if *controlSocket == "" {
+		return &cliError{exitCode: 2, msg: "cache " + action + " needs --control-socket of a running mount"}
+	}
+	mountPath := fs.Arg(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), pinTimeout)
+	defer cancel()
+	client := controlapi.NewClient(*controlSocket)
+	if action == "unpin" {
+		result, err := client.Unpin(ctx, mountPath)
+		if err != nil {
+			return cacheRequestError(action, mountPath, err)
+		}
+		if *jsonOutput {
+			return printJSON(stdout, result)
+		}
+		for _, p := range result.Unpinned {
+			fmt.Fprintln(stdout, p)
+		}
+		fmt.Fprintf(stdout, "%d path(s) unpinned\n", len(result.Unpinned))
+		return nil
+	}
+
+	result, err := client.Pin(ctx, mountPath)
+	if err != nil {
+		return cacheRequestError(action, mountPath, err)
+	}
+	if *jsonOutput {
+		return printJSON(stdout, result)
+	}
+	fmt.Fprintf(stdout, "%d file(s) pinned: %d downloaded (%d bytes), %d already cached, %d skipped, %d excluded\n",
+		result.Pinned, result.Files, result.Bytes, result.Cached, result.Skipped, result.Excluded)
+	if result.Skipped > 0 {
+		return &cliError{exitCode: 1, msg: fmt.Sprintf("%d file(s) could not be pinned; see the mount's log", result.Skipped)}
+	}
+	return nil
+}
+
+func cacheRequestError(action, mountPath string, err error) error {
+	// A missing socket is also ErrNotExist, so check for the API's 404.
+	var apiErr *controlapi.APIError
+	if errors.As(err, &apiErr) && errors.Is(apiErr, os.ErrNotExist) {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("%s: no such file or directory below the mount root", mountPath)}
+	}
+	return fmt.Errorf("%s %s: %w", action, mountPath, err)
+}
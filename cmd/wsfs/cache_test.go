@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"wsfs/internal/controlapi"
+	wsfsfuse "wsfs/internal/fuse"
+)
+
+// servePins answers pin and unpin requests on a unix socket. It records
+// the routes and paths it gets.
+func servePins(t *testing.T) (string, *[]string) {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var requests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/pin", func(w http.ResponseWriter, r *http.Request) {
+		var req controlapi.PathRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, "pin "+req.Path)
+		if req.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(wsfsfuse.PrefetchResult{Files: 1, Bytes: 10, Cached: 1, Pinned: 2})
+	})
+	mux.HandleFunc("POST /v1/unpin", func(w http.ResponseWriter, r *http.Request) {
+		var req controlapi.PathRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, "unpin "+req.Path)
+		_ = json.NewEncoder(w).Encode(wsfsfuse.UnpinResult{Unpinned: []string{"/Users/me/libs/a.so"}})
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socketPath, &requests
+}
+
+func TestRunCachePinAndUnpin(t *testing.T) {
+	socketPath, requests := servePins(t)
+	deps := defaultDeps()
+	var out bytes.Buffer
+	deps.stdout = &out
+
+	if err := run([]string{"wsfs", "cache", "pin", "--control-socket", socketPath, "/libs"}, deps); err != nil {
+		t.Fatalf("run cache pin: %v", err)
+	}
+	if want := "2 file(s) pinned: 1 downloaded (10 bytes), 1 already cached, 0 skipped, 0 excluded\n"; out.String() != want {
+		t.Fatalf("output = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := run([]string{"wsfs", "cache", "unpin", "--control-socket", socketPath, "/libs"}, deps); err != nil {
+		t.Fatalf("run cache unpin: %v", err)
+	}
+	if want := "/Users/me/libs/a.so\n1 path(s) unpinned\n"; out.String() != want {
+		t.Fatalf("output = %q, want %q", out.String(), want)
+	}
+	if want := []string{"pin /libs", "unpin /libs"}; !reflect.DeepEqual(*requests, want) {
+		t.Fatalf("requests = %q, want %q", *requests, want)
+	}
+}
+
+func TestRunCacheUsageErrors(t *testing.T) {
+	socketPath, _ := servePins(t)
+	deps := defaultDeps()
+	deps.stdout = &bytes.Buffer{}
+
+	for _, args := range [][]string{
+		{"wsfs", "cache"},
+		{"wsfs", "cache", "evict", "/libs"},
+		{"wsfs", "cache", "pin", "/libs"},
+		{"wsfs", "cache", "pin", "--control-socket", socketPath},
+		{"wsfs", "cache", "pin", "--control-socket", socketPath, "/missing"},
+	} {
+		err := run(args, deps)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("run %v = %v, want exit code 2", args[1:], err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"net/http"
+	"strings"
+	"syscall"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+	"github.com/databricks/databricks-sdk-go/apierr"
+)
+
+// workspaceTarget names the workspace a mount talks to, for error messages.
+type workspaceTarget struct {
+	host    string
+	profile string
+}
+
+func targetOf(w *databrickssdk.WorkspaceClient) workspaceTarget {
+	if w == nil || w.Config == nil {
+		return workspaceTarget{}
+	}
+	return workspaceTarget{host: w.Config.Host, profile: w.Config.Profile}
+}
+
+func (t workspaceTarget) String() string {
+	host := t.host
+	if host == "" {
+		host = "the configured workspace"
+	}
+	if t.profile == "" {
+		return host
+	}
+	return fmt.Sprintf("%s (profile %s)", host, t.profile)
+}
+
+func (t workspaceTarget) loginCommand() string {
+	switch {
+	case t.profile != "":
+		return "databricks auth login --profile " + t.profile
+	case t.host != "":
+		return "databricks auth login --host " + t.host
+	}
+	return "databricks auth login"
+}
+
+// mountFailureHint explains what a user can do about an error reaching the
+// workspace or the mount root. It returns "" when there is nothing to add.
+func mountFailureHint(err error, target workspaceTarget, rootPath string) string {
+	var apiErr *apierr.APIError
+	isAPIErr := errors.As(err, &apiErr)
+	switch {
+	case errors.Is(err, apierr.ErrUnauthenticated),
+		isAPIErr && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.ErrorCode == "UNAUTHENTICATED"):
+		return fmt.Sprintf("the credentials for %s were rejected; the token may have expired. Run `%s` or update DATABRICKS_TOKEN", target, target.loginCommand())
+	case errors.Is(err, apierr.ErrPermissionDenied), errors.Is(err, syscall.EACCES),
+		isAPIErr && (apiErr.StatusCode == http.StatusForbidden || apiErr.ErrorCode == "PERMISSION_DENIED"):
+		return fmt.Sprintf("the user for %s has no permission to read %s; ask a workspace admin for access or choose another --remote-path", target, rootPath)
+	case errors.Is(err, iofs.ErrNotExist), errors.Is(err, syscall.ENOENT):
+		return fmt.Sprintf("%s does not exist on %s; check --remote-path", rootPath, target)
+	case errors.Is(err, syscall.ENOTDIR):
+		return fmt.Sprintf("%s on %s is not a directory; --remote-path must name a folder", rootPath, target)
+	case strings.Contains(err.Error(), "cannot configure default credentials"):
+		return fmt.Sprintf("no Databricks credentials were found; set DATABRICKS_HOST and DATABRICKS_TOKEN or run `%s`", target.loginCommand())
+	}
+	return ""
+}
+
+// withMountHint wraps err with msg and, when available, a hint from
+// mountFailureHint.
+func withMountHint(msg string, err error, target workspaceTarget, rootPath string) error {
+	if hint := mountFailureHint(err, target, rootPath); hint != "" {
+		return fmt.Errorf("%s: %w (%s)", msg, err, hint)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+	"github.com/databricks/databricks-sdk-go/apierr"
+	"github.com/databricks/databricks-sdk-go/config"
+)
+
+func TestMountFailureHint(t *testing.T) {
+	target := workspaceTarget{host: "https://example.cloud.databricks.com", profile: "dev"}
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{
+			name: "expired token",
+			err:  &apierr.APIError{StatusCode: 401, ErrorCode: "UNAUTHENTICATED", Message: "Invalid access token"},
+			want: []string{"may have expired", "https://example.cloud.databricks.com (profile dev)", "databricks auth login --profile dev"},
+		},
+		{
+			name: "wrapped sentinel",
+			err:  fmt.Errorf("stat: %w", apierr.ErrUnauthenticated),
+			want: []string{"may have expired"},
+		},
+		{
+			name: "no permission",
+			err:  &apierr.APIError{StatusCode: 403, ErrorCode: "PERMISSION_DENIED", Message: "denied"},
+			want: []string{"no permission to read /Users/me", "--remote-path"},
+		},
+		{
+			name: "EACCES from the fuse layer",
+			err:  fmt.Errorf("stat mount root: %w", syscall.EACCES),
+			want: []string{"no permission"},
+		},
+		{
+			name: "missing root",
+			err:  fmt.Errorf("stat: %w", os.ErrNotExist),
+			want: []string{"/Users/me does not exist", "check --remote-path"},
+		},
+		{
+			name: "root is a file",
+			err:  syscall.ENOTDIR,
+			want: []string{"is not a directory"},
+		},
+		{
+			name: "no credentials",
+			err:  errors.New("default auth: cannot configure default credentials, please check https://docs.databricks.com/dev-tools/auth.html"),
+			want: []string{"DATABRICKS_HOST", "databricks auth login"},
+		},
+	}
+
+	for _, tt := range tests {
+		hint := mountFailureHint(tt.err, target, "/Users/me")
+		for _, want := range tt.want {
+			if !strings.Contains(hint, want) {
+				t.Fatalf("%s: hint %q does not mention %q", tt.name, hint, want)
+			}
+		}
+	}
+
+	if hint := mountFailureHint(errors.New("connection reset"), target, "/"); hint != "" {
+		t.Fatalf("expected no hint for an unrelated error, got %q", hint)
+	}
+}
+
+func TestWorkspaceTarget(t *testing.T) {
+	if got := targetOf(nil).String(); got != "the configured workspace" {
+		t.Fatalf("target of nil client = %q", got)
+	}
+	if got := targetOf(&databrickssdk.WorkspaceClient{}).String(); got != "the configured workspace" {
+		t.Fatalf("target of client without config = %q", got)
+	}
+	w := &databrickssdk.WorkspaceClient{Config: &config.Config{Host: "https://h"}}
+	target := targetOf(w)
+	if target.String() != "https://h" || target.loginCommand() != "databricks auth login --host https://h" {
+		t.Fatalf("unexpected target %q / %q", target, target.loginCommand())
+	}
+}
+
+func TestWithMountHint(t *testing.T) {
+	err := withMountHint("Failed to create root node", syscall.ENOENT, workspaceTarget{host: "https://h"}, "/missing")
+	if !errors.Is(err, syscall.ENOENT) {
+		t.Fatalf("hint wrapping lost the cause: %v", err)
+	}
+	if !strings.Contains(err.Error(), "/missing does not exist on https://h") {
+		t.Fatalf("unexpected message %q", err)
+	}
+	if err := withMountHint("Mount fail", errors.New("boom"), workspaceTarget{}, "/"); err.Error() != "Mount fail: boom" {
+		t.Fatalf("unexpected message %q", err)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/databricks"
+	"wsfs/internal/pathutil"
+)
+
+// diffTimeout bounds `wsfs diff`, which may download every file of the
+// remote tree with --compare=checksum.
+const diffTimeout = 30 * time.Minute
+
+// diffWorkers bounds the remote files `wsfs diff` downloads at once.
+const diffWorkers = 8
+
+// diffSide is a file or directory on one side of a tree comparison.
+type diffSide struct {
+	path     string // workspace path or local path
+	isDir    bool
+	notebook bool
+	size     int64
+	modTime  time.Time
+}
+
+// treeChange is a line of `wsfs diff` output: '+' only in the local tree,
+// '-' only in the remote tree, 'M' in both but different.
+type treeChange struct {
+	op   byte
+	path string // relative to both roots, with a trailing slash for directories
+	why  string
+
+	remote, local diffSide
+	pending       bool // waits for a content comparison
+}
+
+// runDiff implements `wsfs diff`: it compares a workspace tree with a local
+// directory through the workspace client, without a mount, and prints what
+// differs. Like diff it exits with status 0 when the trees match and 1 when
+// they differ.
+func runDiff(program string, args []string, deps runDeps) error {
+	usage := fmt.Sprintf("Usage: %s diff [--compare=checksum|size|mtime] REMOTE_PATH LOCAL_DIR", program)
+	fs := flag.NewFlagSet(program+" diff", flag.ContinueOnError)
+	compare := fs.String("compare", "checksum", "how files present on both sides are compared: checksum (size, then SHA-256 of the content), size, or mtime (size, and whether the local file is newer)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return &cliError{exitCode: 0, printed: true}
+		}
+		return &cliError{exitCode: 2, msg: err.Error(), printed: true}
+	}
+	if fs.NArg() != 2 {
+		return &cliError{exitCode: 2, msg: usage}
+	}
+	switch *compare {
+	case "checksum", "size", "mtime":
+	default:
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --compare: %q (want checksum, size or mtime)", *compare)}
+	}
+	remoteRoot := path.Clean("/" + fs.Arg(0))
+	localRoot := fs.Arg(1)
+	if info, err := os.Stat(localRoot); err != nil || !info.IsDir() {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("%s is not a local directory", localRoot)}
+	}
+
+	w, err := deps.initWorkspace(nil)
+	if err != nil {
+		return fmt.Errorf("Failed to create Databricks client: %w", err)
+	}
+	api, err := deps.newWorkspaceFilesClient(w)
+	if err != nil {
+		return fmt.Errorf("Failed to create Databricks Workspace Files Client: %w", err)
+	}
+	defer backend.Close(api)
+
+	ctx, cancel := context.WithTimeout(context.Background(), diffTimeout)
+	defer cancel()
+	info, err := api.Stat(ctx, remoteRoot)
+	if errors.Is(err, iofs.ErrNotExist) || err == nil && !info.IsDir() {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("%s is not a workspace directory", remoteRoot)}
+	}
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", remoteRoot, err)
+	}
+
+	// List the whole remote tree up front with concurrent list calls rather
+	// than one directory at a time as the comparison descends.
+	listing, err := databricks.WalkTree(ctx, api, remoteRoot, databricks.TreeOptions{})
+	if err != nil {
+		return err
+	}
+	d := &treeDiff{api: api, compare: *compare, remote: make(map[string][]iofs.DirEntry, len(listing.Dirs))}
+	for _, dir := range listing.Dirs {
+		d.remote[dir.Path] = dir.Entries
+	}
+	if err := d.compareDirs("", remoteRoot, localRoot); err != nil {
+		return err
+	}
+	if err := d.compareContents(ctx); err != nil {
+		return err
+	}
+
+	differ := false
+	for _, change := range d.changes {
+		if change.op == 0 {
+			continue
+		}
+		if !differ {
+			fmt.Fprintf(deps.stdout, "--- %s (workspace)\n+++ %s (local)\n", remoteRoot, localRoot)
+			differ = true
+		}
+		if change.why != "" {
+			fmt.Fprintf(deps.stdout, "%c %s (%s)\n", change.op, change.path, change.why)
+		} else {
+			fmt.Fprintf(deps.stdout, "%c %s\n", change.op, change.path)
+		}
+	}
+	if differ {
+		return &cliError{exitCode: 1}
+	}
+	return nil
+}
+
+// treeDiff collects the changes between a workspace tree and a local tree
+// in path order.
+type treeDiff struct {
+	api     databricks.WorkspaceFilesAPI
+	compare string
+	remote  map[string][]iofs.DirEntry // listings of the remote tree by directory path
+	changes []*treeChange
+}
+
+// compareDirs compares the entries of one directory on both sides and
+// descends into directories present on both.
+func (d *treeDiff) compareDirs(rel, remoteDir, localDir string) error {
+	entries, ok := d.remote[remoteDir]
+	if !ok {
+		return fmt.Errorf("list %s: not in the remote listing", remoteDir)
+	}
+	remote := remoteSides(remoteDir, entries)
+	local, err := listLocalDir(localDir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(remote)+len(local))
+	for name := range remote {
+		names = append(names, name)
+	}
+	for name := range local {
+		if _, ok := remote[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		childRel := path.Join(rel, name)
+		r, inRemote := remote[name]
+		l, inLocal := local[name]
+		switch {
+		case !inLocal:
+			d.changes = append(d.changes, &treeChange{op: '-', path: displayPath(childRel, r.isDir)})
+		case !inRemote:
+			d.changes = append(d.changes, &treeChange{op: '+', path: displayPath(childRel, l.isDir)})
+		case r.isDir && l.isDir:
+			if err := d.compareDirs(childRel, r.path, l.path); err != nil {
+				return err
+			}
+		case r.isDir != l.isDir:
+			d.changes = append(d.changes, &treeChange{op: 'M', path: childRel, why: "file on one side, directory on the other"})
+		default:
+			d.changes = append(d.changes, d.compareFiles(childRel, r, l))
+		}
+	}
+	return nil
+}
+
+// compareFiles compares the metadata of a file present on both sides. A
+// change whose answer needs the content is left pending. Notebooks are
+// always compared by content: their listed size is not the size of their
+// exported source.
+func (d *treeDiff) compareFiles(rel string, remote, local diffSide) *treeChange {
+	change := &treeChange{path: rel, remote: remote, local: local}
+	if !remote.notebook && remote.size != local.size {
+		change.op, change.why = 'M', fmt.Sprintf("size %d -> %d", remote.size, local.size)
+		return change
+	}
+	switch {
+	case remote.notebook || d.compare == "checksum":
+		change.pending = true
+	case d.compare == "mtime" && local.modTime.After(remote.modTime):
+		change.op, change.why = 'M', "local file is newer"
+	}
+	return change
+}
+
+// compareContents resolves the pending changes by comparing SHA-256 sums,
+// downloading up to diffWorkers remote files at once.
+func (d *treeDiff) compareContents(ctx context.Context) error {
+	var pending []*treeChange
+	for _, change := range d.changes {
+		if change.pending {
+			pending = append(pending, change)
+		}
+	}
+
+	errs := make([]error, len(pending))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < diffWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = d.compareContent(ctx, pending[i])
+			}
+		}()
+	}
+	for i := range pending {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (d *treeDiff) compareContent(ctx context.Context, change *treeChange) error {
+	data, err := d.api.ReadAll(ctx, change.remote.path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", change.remote.path, err)
+	}
+	localSum, err := fileSHA256(change.local.path)
+	if err != nil {
+		return err
+	}
+	if sha256.Sum256(data) != localSum {
+		change.op, change.why = 'M', "content differs"
+	}
+	return nil
+}
+
+func fileSHA256(localPath string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(localPath)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, fmt.Errorf("read %s: %w", localPath, err)
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// remoteSides maps the entries of a workspace directory to the names a
+// mount shows: notebooks appear under their source file name, or under
+// their .ipynb name when a file already has the source name.
+func remoteSides(dir string, entries []iofs.DirEntry) map[string]diffSide {
+	sides := make(map[string]diffSide, len(entries))
+	var notebooks []databricks.WSFileInfo
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if wsInfo, ok := info.(databricks.WSFileInfo); ok && wsInfo.IsNotebook() {
+			notebooks = append(notebooks, wsInfo)
+			continue
+		}
+		sides[entry.Name()] = diffSide{path: path.Join(dir, entry.Name()), isDir: info.IsDir(), size: info.Size(), modTime: info.ModTime()}
+	}
+	for _, info := range notebooks {
+		name := pathutil.NotebookVisibleName(info.Name(), info.Language)
+		if _, taken := sides[name]; taken {
+			name = pathutil.NotebookFallbackName(info.Name())
+		}
+		if _, taken := sides[name]; taken {
+			continue
+		}
+		sides[name] = diffSide{path: path.Join(dir, info.Name()), notebook: true, modTime: info.ModTime()}
+	}
+	return sides
+}
+
+// listLocalDir lists the regular files and directories of a local
+// directory. Symbolic links and special files are skipped, as the workspace
+// has nothing to compare them with.
+func listLocalDir(dir string) (map[string]diffSide, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sides := make(map[string]diffSide, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		sides[entry.Name()] = diffSide{path: filepath.Join(dir, entry.Name()), isDir: info.IsDir(), size: info.Size(), modTime: info.ModTime()}
+	}
+	return sides, nil
+}
+
+func displayPath(rel string, isDir bool) string {
+	if isDir {
+		return rel + "/"
+	}
+	return rel
+}
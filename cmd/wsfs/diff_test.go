@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	iofs "io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/databricks"
+)
+
+func writeTree(t *testing.T, dir string, files map[string]string, modTime time.Time) {
+	t.Helper()
+	for name, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := os.Chtimes(full, modTime, modTime); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+}
+
+func diffDeps(api databricks.WorkspaceFilesAPI, out *bytes.Buffer) runDeps {
+	deps := defaultDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
+		return nil, nil
+	}
+	deps.newWorkspaceFilesClient = func(*databrickssdk.WorkspaceClient) (databricks.WorkspaceFilesAPI, error) {
+		return api, nil
+	}
+	deps.stdout = out
+	return deps
+}
+
+func TestRunDiffReportsChanges(t *testing.T) {
+	remoteDir, localDir := t.TempDir(), t.TempDir()
+	old := time.Unix(1700000000, 0)
+	writeTree(t, remoteDir, map[string]string{
+		"same.txt":         "a",
+		"changed.txt":      "abc",
+		"sized.txt":        "a",
+		"gone.txt":         "x",
+		"olddir/x.txt":     "x",
+		"shared/inner.txt": "x",
+	}, old)
+	writeTree(t, localDir, map[string]string{
+		"same.txt":         "a",
+		"sized.txt":        "ab",
+		"new.txt":          "x",
+		"newdir/y.txt":     "y",
+		"shared/inner.txt": "x",
+	}, old)
+	writeTree(t, localDir, map[string]string{"changed.txt": "abd"}, old.Add(time.Hour))
+	remote, err := backend.NewLocalBackend(remoteDir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+
+	for _, tt := range []struct {
+		compare string
+		want    string
+	}{
+		{"checksum", "M changed.txt (content differs)\n- gone.txt\n+ new.txt\n+ newdir/\n- olddir/\nM sized.txt (size 1 -> 2)\n"},
+		{"size", "- gone.txt\n+ new.txt\n+ newdir/\n- olddir/\nM sized.txt (size 1 -> 2)\n"},
+		{"mtime", "M changed.txt (local file is newer)\n- gone.txt\n+ new.txt\n+ newdir/\n- olddir/\nM sized.txt (size 1 -> 2)\n"},
+	} {
+		var out bytes.Buffer
+		err := run([]string{"wsfs", "diff", "--compare=" + tt.compare, "/", localDir}, diffDeps(remote, &out))
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 1 {
+			t.Fatalf("diff --compare=%s = %v, want exit code 1", tt.compare, err)
+		}
+		want := "--- / (workspace)\n+++ " + localDir + " (local)\n" + tt.want
+		if out.String() != want {
+			t.Fatalf("diff --compare=%s output:\n%s\nwant:\n%s", tt.compare, out.String(), want)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := run([]string{"wsfs", "diff", "/shared", filepath.Join(localDir, "shared")}, diffDeps(remote, &out)); err != nil || out.Len() != 0 {
+		t.Fatalf("diff of equal trees = %v, output %q", err, out.String())
+	}
+}
+
+func TestRunDiffComparesNotebooksByContent(t *testing.T) {
+	localDir := t.TempDir()
+	writeTree(t, localDir, map[string]string{"etl.py": "# Databricks notebook source\nprint(1)\n"}, time.Now())
+	notebook := databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+		Path:       "/Repos/app/etl",
+		ObjectType: workspace.ObjectTypeNotebook,
+		Language:   workspace.LanguagePython,
+	}}
+	exported := "# Databricks notebook source\nprint(1)\n"
+	api := &databricks.FakeWorkspaceAPI{
+		StatFunc: func(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+			return databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{Path: filePath, ObjectType: workspace.ObjectTypeDirectory}}, nil
+		},
+		ReadDirFunc: func(ctx context.Context, dirPath string) ([]iofs.DirEntry, error) {
+			return []iofs.DirEntry{databricks.WSDirEntry{WSFileInfo: notebook}}, nil
+		},
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			if filePath != "/Repos/app/etl" {
+				return nil, iofs.ErrNotExist
+			}
+			return []byte(exported), nil
+		},
+	}
+
+	var out bytes.Buffer
+	if err := run([]string{"wsfs", "diff", "/Repos/app", localDir}, diffDeps(api, &out)); err != nil {
+		t.Fatalf("diff of a deployed notebook = %v, output %q", err, out.String())
+	}
+
+	exported = "# Databricks notebook source\nprint(2)\n"
+	out.Reset()
+	err := run([]string{"wsfs", "diff", "/Repos/app", localDir}, diffDeps(api, &out))
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 1 || !bytes.Contains(out.Bytes(), []byte("M etl.py (content differs)\n")) {
+		t.Fatalf("diff of a changed notebook = %v, output %q", err, out.String())
+	}
+}
+
+func TestRunDiffUsageErrors(t *testing.T) {
+	localDir := t.TempDir()
+	remote, err := backend.NewLocalBackend(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	deps := diffDeps(remote, &bytes.Buffer{})
+	for _, args := range [][]string{
+		{"wsfs", "diff", "/"},
+		{"wsfs", "diff", "--compare=hash", "/", localDir},
+		{"wsfs", "diff", "/", filepath.Join(localDir, "missing")},
+		{"wsfs", "diff", "/missing", localDir},
+	} {
+		err := run(args, deps)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("run %v = %v, want exit code 2", args[2:], err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"wsfs/internal/controlapi"
+)
+
+// grepTimeout bounds a search request, which may download a large part of
+// the workspace into the disk cache.
+const grepTimeout = 30 * time.Minute
+
+// defaultGrepMaxMatches bounds the matches a search returns unless
+// --max-matches says otherwise.
+const defaultGrepMaxMatches = 10000
+
+// runGrep implements `wsfs grep`: a running mount searches its own tree,
+// reading warm files from the disk cache and downloading cold ones in
+// parallel, which is far faster than grep -r through FUSE. Like grep it
+// exits with status 0 when a line matched and 1 when none did.
+func runGrep(program string, args []string, stdout io.Writer) error {
+	usage := fmt.Sprintf("Usage: %s grep --control-socket SOCKET [-i] [-l] [--json] PATTERN [PATH]", program)
+	fs := flag.NewFlagSet(program+" grep", flag.ContinueOnError)
+	controlSocket := fs.String("control-socket", "", "control API socket of the mount to search (the mount's --control-socket)")
+	ignoreCase := fs.Bool("i", false, "match case-insensitively")
+	filesOnly := fs.Bool("l", false, "print only the paths of files with a match")
+	maxMatches := fs.Int("max-matches", defaultGrepMaxMatches, "stop after this many matching lines (0 is unlimited)")
+	jsonOutput := fs.Bool("json", false, "print the result as JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return &cliError{exitCode: 0, printed: true}
+		}
+		return &cliError{exitCode: 2, msg: err.Error(), printed: true}
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return &cliError{exitCode: 2, msg: usage}
+	}
+	if *controlSocket == "" {
+		return &cliError{exitCode: 2, msg: "grep needs --control-socket of a running mount"}
+	}
+	if *maxMatches < 0 {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --max-matches: %d", *maxMatches)}
+	}
+	req := controlapi.SearchRequest{
+		Path:       "/",
+		Pattern:    fs.Arg(0),
+		IgnoreCase: *ignoreCase,
+		MaxMatches: *maxMatches,
+	}
+	if fs.NArg() == 2 {
+		req.Path = fs.Arg(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), grepTimeout)
+	defer cancel()
+	result, err := controlapi.NewClient(*controlSocket).Search(ctx, req)
+	var apiErr *controlapi.APIError
+	if errors.As(err, &apiErr) && errors.Is(apiErr, os.ErrNotExist) {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("%s: no such file or directory below the mount root", req.Path)}
+	}
+	if errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+		return &cliError{exitCode: 2, msg: apiErr.Message}
+	}
+	if err != nil {
+		return fmt.Errorf("search %s: %w", req.Path, err)
+	}
+
+	if *jsonOutput {
+		if err := printJSON(stdout, result); err != nil {
+			return err
+		}
+	} else {
+		printed := make(map[string]bool)
+		for _, match := range result.Matches {
+			if !*filesOnly {
+				fmt.Fprintf(stdout, "%s:%d:%s\n", match.Path, match.Line, match.Text)
+			} else if !printed[match.Path] {
+				printed[match.Path] = true
+				fmt.Fprintln(stdout, match.Path)
+			}
+		}
+	}
+	if result.Skipped > 0 {
+		log.Printf("%d file(s) could not be read and were not searched; see the mount's log", result.Skipped)
+	}
+	if result.Truncated {
+		log.Printf("Stopped after %d matches; raise --max-matches to see more", len(result.Matches))
+	}
+	if len(result.Matches) == 0 {
+		return &cliError{exitCode: 1}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wsfs/internal/controlapi"
+	wsfsfuse "wsfs/internal/fuse"
+)
+
+// serveSearch answers search requests on a unix socket like a mount where
+// "TODO" occurs twice in /src/a.py and once in /src/b.py. It records the
+// requests it gets.
+func serveSearch(t *testing.T) (string, *[]controlapi.SearchRequest) {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var requests []controlapi.SearchRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/search", func(w http.ResponseWriter, r *http.Request) {
+		var req controlapi.SearchRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		switch {
+		case req.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+			return
+		case req.Pattern == "(":
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid pattern"})
+			return
+		case req.Pattern != "TODO":
+			_ = json.NewEncoder(w).Encode(wsfsfuse.SearchResult{Files: 2})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(wsfsfuse.SearchResult{
+			Files: 2,
+			Matches: []wsfsfuse.SearchMatch{
+				{Path: "/src/a.py", Line: 1, Text: "# TODO: one"},
+				{Path: "/src/a.py", Line: 4, Text: "# TODO: two"},
+				{Path: "/src/b.py", Line: 2, Text: "x = 1  # TODO"},
+			},
+		})
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socketPath, &requests
+}
+
+func TestRunGrepPrintsMatches(t *testing.T) {
+	socketPath, requests := serveSearch(t)
+	deps := defaultDeps()
+	var out bytes.Buffer
+	deps.stdout = &out
+
+	if err := run([]string{"wsfs", "grep", "--control-socket", socketPath, "-i", "TODO", "/src"}, deps); err != nil {
+		t.Fatalf("run grep: %v", err)
+	}
+	want := "/src/a.py:1:# TODO: one\n/src/a.py:4:# TODO: two\n/src/b.py:2:x = 1  # TODO\n"
+	if out.String() != want {
+		t.Fatalf("output = %q, want %q", out.String(), want)
+	}
+	if got := (*requests)[0]; got != (controlapi.SearchRequest{Path: "/src", Pattern: "TODO", IgnoreCase: true, MaxMatches: defaultGrepMaxMatches}) {
+		t.Fatalf("unexpected request %+v", got)
+	}
+
+	out.Reset()
+	if err := run([]string{"wsfs", "grep", "--control-socket", socketPath, "-l", "--max-matches=0", "TODO"}, deps); err != nil {
+		t.Fatalf("run grep -l: %v", err)
+	}
+	if out.String() != "/src/a.py\n/src/b.py\n" {
+		t.Fatalf("-l output = %q", out.String())
+	}
+	if got := (*requests)[1]; got.Path != "/" || got.MaxMatches != 0 {
+		t.Fatalf("unexpected request without a path %+v", got)
+	}
+
+	out.Reset()
+	if err := run([]string{"wsfs", "grep", "--json", "--control-socket", socketPath, "TODO"}, deps); err != nil {
+		t.Fatalf("run grep --json: %v", err)
+	}
+	var result wsfsfuse.SearchResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil || len(result.Matches) != 3 {
+		t.Fatalf("--json output = %q, %v", out.String(), err)
+	}
+}
+
+func TestRunGrepExitCodes(t *testing.T) {
+	socketPath, _ := serveSearch(t)
+	deps := defaultDeps()
+	deps.stdout = &bytes.Buffer{}
+
+	for _, tt := range []struct {
+		args     []string
+		exitCode int
+	}{
+		{[]string{"wsfs", "grep", "--control-socket", socketPath, "nothing"}, 1},
+		{[]string{"wsfs", "grep", "--control-socket", socketPath}, 2},
+		{[]string{"wsfs", "grep", "--control-socket", socketPath, "a", "b", "c"}, 2},
+		{[]string{"wsfs", "grep", "TODO"}, 2},
+		{[]string{"wsfs", "grep", "--control-socket", socketPath, "--max-matches=-1", "TODO"}, 2},
+		{[]string{"wsfs", "grep", "--control-socket", socketPath, "TODO", "/missing"}, 2},
+		{[]string{"wsfs", "grep", "--control-socket", socketPath, "("}, 2},
+	} {
+		err := run(tt.args, deps)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != tt.exitCode {
+			t.Fatalf("run %v = %v, want exit code %d", tt.args[2:], err, tt.exitCode)
+		}
+	}
+
+	err := run([]string{"wsfs", "grep", "--control-socket", filepath.Join(t.TempDir(), "none.sock"), "TODO"}, deps)
+	if err == nil || !strings.Contains(err.Error(), "search /") {
+		t.Fatalf("run without a mount = %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"wsfs/internal/logging"
+)
+
+const (
+	fuseDevicePath = "/dev/fuse"
+	mountInfoPath  = "/proc/self/mountinfo"
+
+	accessWrite = 0x2 // W_OK of access(2), which package syscall does not export
+)
+
+// preflightMount checks the mount point and the FUSE device before wsfs
+// talks to the workspace, so a mount that cannot succeed fails at once and
+// says how to fix it.
+func preflightMount(mountPoint string, autoCreate bool) error {
+	if err := checkMountPoint(mountPoint, autoCreate, mountInfoPath); err != nil {
+		return err
+	}
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	return checkFuseDevice(fuseDevicePath)
+}
+
+// checkMountPoint verifies that mountPoint is a directory the user may mount
+// on and that nothing is mounted there yet. With autoCreate a missing mount
+// point is created. A non-empty directory only draws a warning: the mount
+// hides its content until unmounted. A mount point left disconnected by a
+// crashed wsfs is left to recoverStaleMount.
+func checkMountPoint(mountPoint string, autoCreate bool, mountInfo string) error {
+	info, err := os.Stat(mountPoint)
+	if errors.Is(err, os.ErrNotExist) && autoCreate {
+		if err := os.MkdirAll(mountPoint, 0o755); err != nil {
+			return fmt.Errorf("create mount point %s: %w", mountPoint, err)
+		}
+		logging.Infof("Created mount point %s", mountPoint)
+		info, err = os.Stat(mountPoint)
+	}
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("mount point %s does not exist (create it with `mkdir -p %s` or pass --auto-create-mountpoint)", mountPoint, mountPoint)
+	case connectionLost(err):
+		return nil
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("mount point %s: %w (you need search permission on every parent directory)", mountPoint, err)
+	case err != nil:
+		return fmt.Errorf("mount point %s: %w", mountPoint, err)
+	case !info.IsDir():
+		return fmt.Errorf("mount point %s is not a directory (choose a directory, or remove the file and pass --auto-create-mountpoint)", mountPoint)
+	}
+
+	if os.Geteuid() != 0 && syscall.Access(mountPoint, accessWrite) != nil {
+		return fmt.Errorf("mount point %s is not writable by you (fusermount only mounts on directories you can write to; `sudo chown %d %s` fixes that)", mountPoint, os.Getuid(), mountPoint)
+	}
+
+	if fstype, ok := mountedFilesystem(mountPoint, mountInfo); ok && isFuseType(fstype) {
+		return fmt.Errorf("%s is already a FUSE mount (%s), probably another wsfs; unmount it with `wsfs umount %s` or `fusermount -u %s` first", mountPoint, fstype, mountPoint, mountPoint)
+	}
+
+	entries, err := os.ReadDir(mountPoint)
+	if err == nil && len(entries) > 0 {
+		logging.Warnf("Mount point %s is not empty; its %d entries are hidden while the workspace is mounted", mountPoint, len(entries))
+	}
+	return nil
+}
+
+// checkFuseDevice verifies that the FUSE device can be opened, which the
+// mount needs and containers often lack.
+func checkFuseDevice(device string) error {
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("%s does not exist (load the kernel module with `sudo modprobe fuse`; in a container, pass `--device /dev/fuse --cap-add SYS_ADMIN`)", device)
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("%s is not accessible: %w (make it readable and writable for you, e.g. `sudo chmod 0666 %s`, or add yourself to the group that owns it)", device, err, device)
+	case err != nil:
+		return fmt.Errorf("open %s: %w", device, err)
+	}
+	return f.Close()
+}
+
+// mountedFilesystem returns the filesystem type mounted on mountPoint
+// according to a mountinfo file, as in /proc/self/mountinfo. It reports
+// false when nothing is mounted there or the file cannot be read.
+func mountedFilesystem(mountPoint, mountInfo string) (string, bool) {
+	target, err := filepath.Abs(mountPoint)
+	if err != nil {
+		return "", false
+	}
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+	f, err := os.Open(mountInfo)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	// Fields: ID, parent ID, major:minor, root, mount point, options,
+	// optional fields, "-", filesystem type, source, super options. The
+	// last mount on a path is the visible one.
+	fstype, found := "", false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 || unescapeMountPath(fields[4]) != target {
+			continue
+		}
+		for i := 6; i < len(fields)-1; i++ {
+			if fields[i] == "-" {
+				fstype, found = fields[i+1], true
+				break
+			}
+		}
+	}
+	return fstype, found
+}
+
+// unescapeMountPath decodes the octal escapes mountinfo uses for spaces,
+// tabs, newlines and backslashes in paths.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isFuseType(fstype string) bool {
+	return fstype == "fuse" || fstype == "fuseblk" || strings.HasPrefix(fstype, "fuse.")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+)
+
+func TestCheckMountPoint(t *testing.T) {
+	base := t.TempDir()
+	noMounts := filepath.Join(base, "mountinfo")
+	if err := os.WriteFile(noMounts, []byte("22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	empty := filepath.Join(base, "empty")
+	if err := os.Mkdir(empty, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := checkMountPoint(empty, false, noMounts); err != nil {
+		t.Fatalf("empty directory: %v", err)
+	}
+
+	missing := filepath.Join(base, "a", "b")
+	if err := checkMountPoint(missing, false, noMounts); err == nil || !strings.Contains(err.Error(), "--auto-create-mountpoint") {
+		t.Fatalf("missing mount point = %v, want a hint about --auto-create-mountpoint", err)
+	}
+	if err := checkMountPoint(missing, true, noMounts); err != nil {
+		t.Fatalf("auto-created mount point: %v", err)
+	}
+	if info, err := os.Stat(missing); err != nil || !info.IsDir() {
+		t.Fatalf("auto-created mount point = %v, %v", info, err)
+	}
+
+	file := filepath.Join(base, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := checkMountPoint(file, true, noMounts); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("file mount point = %v", err)
+	}
+
+	// A non-empty directory is mounted over with a warning.
+	if err := os.WriteFile(filepath.Join(empty, "x"), nil, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := checkMountPoint(empty, false, noMounts); err != nil {
+		t.Fatalf("non-empty directory: %v", err)
+	}
+
+	mounted := filepath.Join(base, "my mnt")
+	if err := os.Mkdir(mounted, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	resolved, err := filepath.EvalSymlinks(mounted)
+	if err != nil {
+		t.Fatalf("EvalSymlinks: %v", err)
+	}
+	escaped := strings.ReplaceAll(resolved, " ", `\040`)
+	withFuse := filepath.Join(base, "mountinfo-fuse")
+	if err := os.WriteFile(withFuse, []byte("22 1 8:1 / / rw shared:1 - ext4 /dev/sda1 rw\n"+
+		"90 22 0:50 / "+escaped+" rw,nosuid,nodev shared:60 - fuse.wsfs wsfs rw,user_id=1000\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := checkMountPoint(mounted, false, withFuse); err == nil || !strings.Contains(err.Error(), "already a FUSE mount (fuse.wsfs)") {
+		t.Fatalf("mounted mount point = %v", err)
+	}
+	if err := checkMountPoint(empty, false, withFuse); err != nil {
+		t.Fatalf("another directory beside a FUSE mount: %v", err)
+	}
+}
+
+func TestCheckFuseDevice(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkFuseDevice(filepath.Join(dir, "fuse")); err == nil || !strings.Contains(err.Error(), "modprobe fuse") {
+		t.Fatalf("missing device = %v, want a modprobe hint", err)
+	}
+	device := filepath.Join(dir, "device")
+	if err := os.WriteFile(device, nil, 0o666); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := checkFuseDevice(device); err != nil {
+		t.Fatalf("accessible device: %v", err)
+	}
+}
+
+func TestRunFailsPreflightBeforeContactingTheWorkspace(t *testing.T) {
+	deps := defaultDeps()
+	deps.preflight = func(mountPoint string, autoCreate bool) error {
+		return checkMountPoint(mountPoint, autoCreate, filepath.Join(t.TempDir(), "mountinfo"))
+	}
+	contacted := false
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
+		contacted = true
+		return nil, errors.New("unexpected")
+	}
+	err := run([]string{"wsfs", filepath.Join(t.TempDir(), "missing")}, deps)
+	if err == nil || !strings.Contains(err.Error(), "does not exist") || contacted {
+		t.Fatalf("run = %v (workspace contacted: %v), want a missing mount point error first", err, contacted)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+	"github.com/databricks/databricks-sdk-go/config"
+	"github.com/databricks/databricks-sdk-go/config/credentials"
+
+	"wsfs/internal/controlapi"
+	"wsfs/internal/logging"
+)
+
+// reauthTimeout bounds `wsfs reauth`, which may wait for a CLI to refresh
+// a login.
+const reauthTimeout = 2 * time.Minute
+
+// tokenCheckInterval is how often --token-expiry-warning re-reads the
+// workspace token.
+const tokenCheckInterval = time.Minute
+
+// workspaceAuth is the credentials strategy of the mount's workspace
+// client. It authenticates like the strategy it replaces, the SDK's
+// default chain unless the client was given another, and Reauth swaps in
+// the credentials of a freshly configured client, so a new login reaches a
+// running mount without remounting.
+type workspaceAuth struct {
+	inner     config.CredentialsStrategy
+	host      string
+	newClient func() (*databrickssdk.WorkspaceClient, error)
+	me        func(context.Context, *databrickssdk.WorkspaceClient) (string, error)
+
+	mu         sync.Mutex
+	setHeaders func(*http.Request) error
+	authType   string
+}
+
+var _ controlapi.Reauthenticator = (*workspaceAuth)(nil)
+
+// newWorkspaceAuth makes w authenticate through a workspaceAuth. It must
+// be called before w sends its first request. newClient configures a
+// client the way w was configured; me names the user of a client.
+func newWorkspaceAuth(w *databrickssdk.WorkspaceClient, newClient func() (*databrickssdk.WorkspaceClient, error), me func(context.Context, *databrickssdk.WorkspaceClient) (string, error)) *workspaceAuth {
+	inner := w.Config.Credentials
+	if inner == nil {
+		inner = config.DefaultCredentialStrategyProvider()
+	}
+	a := &workspaceAuth{inner: inner, host: w.Config.Host, newClient: newClient, me: me}
+	w.Config.Credentials = a
+	return a
+}
+
+// Name reports the strategy that authenticates the requests.
+func (a *workspaceAuth) Name() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.authType != "" {
+		return a.authType
+	}
+	return a.inner.Name()
+}
+
+// Configure resolves the initial credentials through the wrapped strategy.
+func (a *workspaceAuth) Configure(ctx context.Context, cfg *config.Config) (credentials.CredentialsProvider, error) {
+	provider, err := a.inner.Configure(ctx, cfg)
+	if err != nil || provider == nil {
+		return provider, err
+	}
+	a.mu.Lock()
+	a.setHeaders = provider.SetHeaders
+	a.authType = a.inner.Name()
+	a.mu.Unlock()
+	return credentials.CredentialsProviderFn(a.SetHeaders), nil
+}
+
+// SetHeaders authenticates r with the current credentials.
+func (a *workspaceAuth) SetHeaders(r *http.Request) error {
+	a.mu.Lock()
+	setHeaders := a.setHeaders
+	a.mu.Unlock()
+	if setHeaders == nil {
+		return errors.New("workspace credentials are not configured yet")
+	}
+	return setHeaders(r)
+}
+
+// Reauth configures a new client, checks its credentials with a
+// current-user call and, when they work, authenticates the mount's
+// requests with them. The old credentials stay in use when that fails.
+func (a *workspaceAuth) Reauth(ctx context.Context) (controlapi.ReauthResponse, error) {
+	w, err := a.newClient()
+	if err != nil {
+		return controlapi.ReauthResponse{}, fmt.Errorf("configure workspace client: %w", err)
+	}
+	user, err := a.me(ctx, w)
+	if err != nil {
+		return controlapi.ReauthResponse{}, withMountHint("check new credentials", err, targetOf(w), "/")
+	}
+
+	a.mu.Lock()
+	a.setHeaders = w.Config.Authenticate
+	a.authType = w.Config.AuthType
+	a.mu.Unlock()
+	logging.Infof("Reloaded workspace credentials for %s (%s auth)", user, w.Config.AuthType)
+
+	resp := controlapi.ReauthResponse{User: user, AuthType: w.Config.AuthType}
+	if expiresAt, ok, err := a.expiry(); err == nil && ok {
+		resp.ExpiresAt = &expiresAt
+	}
+	return resp, nil
+}
+
+// expiry returns when the current token expires. It reports false for
+// tokens that do not carry their expiry, such as personal access tokens.
+func (a *workspaceAuth) expiry() (time.Time, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, a.host, nil)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if err := a.SetHeaders(req); err != nil {
+		return time.Time{}, false, err
+	}
+	expiresAt, ok := tokenExpiry(req.Header.Get("Authorization"))
+	return expiresAt, ok, nil
+}
+
+// tokenExpiry reads the exp claim of a bearer token that is a JWT, as
+// OAuth and Azure AD tokens are.
+func tokenExpiry(authorization string) (time.Time, bool) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return time.Time{}, false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(claims.Exp), 0), true
+}
+
+// expiryNotice remembers which token expiry has been reported, so each
+// token draws at most one warning and one error.
+type expiryNotice struct {
+	warnBefore time.Duration
+	warned     time.Time // expiry of the token last warned about
+	expired    time.Time // expiry of the token last reported expired
+}
+
+// next reports whether a token expiring at expiresAt is due a warning, or
+// has expired and is due an error.
+func (e *expiryNotice) next(expiresAt, now time.Time) (warn, expired bool) {
+	switch {
+	case !now.Before(expiresAt):
+		if expiresAt.Equal(e.expired) {
+			return false, false
+		}
+		e.expired = expiresAt
+		return false, true
+	case expiresAt.Sub(now) <= e.warnBefore:
+		if expiresAt.Equal(e.warned) {
+			return false, false
+		}
+		e.warned = expiresAt
+		return true, false
+	}
+	return false, false
+}
+
+// watchTokenExpiry re-reads the workspace token every interval until ctx
+// is done and logs a warning warnBefore it expires, so an expired login
+// shows up before the first failed save. Reading the token also lets the
+// SDK refresh an OAuth token ahead of time, in which case nothing is
+// logged. hint says how to renew the credentials.
+func watchTokenExpiry(ctx context.Context, auth *workspaceAuth, interval, warnBefore time.Duration, hint string) {
+	if warnBefore <= 0 {
+		return
+	}
+	notice := &expiryNotice{warnBefore: warnBefore}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		expiresAt, ok, err := auth.expiry()
+		if err != nil {
+			logging.Debugf("Token expiry check failed: %v", err)
+		}
+		if ok {
+			now := time.Now()
+			switch warn, expired := notice.next(expiresAt, now); {
+			case warn:
+				logging.Warnf("Workspace token expires in %s (at %s); if it is not renewed, saves will fail. To renew it, %s", expiresAt.Sub(now).Round(time.Second), expiresAt.Format(time.RFC3339), hint)
+			case expired:
+				logging.Errorf("Workspace token expired at %s; saves fail until it is renewed. To renew it, %s", expiresAt.Format(time.RFC3339), hint)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reauthHint says how to renew the credentials of a mount of target.
+func reauthHint(target workspaceTarget, controlSocket string) string {
+	if controlSocket == "" {
+		return fmt.Sprintf("run `%s` and remount, or start wsfs with --control-socket to reload credentials with `wsfs reauth`", target.loginCommand())
+	}
+	return fmt.Sprintf("run `%s`, then `wsfs reauth --control-socket=%s`", target.loginCommand(), controlSocket)
+}
+
+// runReauth implements `wsfs reauth`: it makes a running mount reload its
+// workspace credentials through its control API, for example after
+// `databricks auth login` renewed an expired login.
+func runReauth(program string, args []string, stdout io.Writer) error {
+	usage := fmt.Sprintf("Usage: %s reauth --control-socket SOCKET", program)
+	fs := flag.NewFlagSet(program+" reauth", flag.ContinueOnError)
+	controlSocket := fs.String("control-socket", "", "control API socket of the mount (the mount's --control-socket)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return &cliError{exitCode: 0, printed: true}
+		}
+		return &cliError{exitCode: 2, msg: err.Error(), printed: true}
+	}
+	if fs.NArg() != 0 {
+		return &cliError{exitCode: 2, msg: usage}
+	}
+	if *controlSocket == "" {
+		return &cliError{exitCode: 2, msg: "reauth needs --control-socket of a running mount"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reauthTimeout)
+	defer cancel()
+	resp, err := controlapi.NewClient(*controlSocket).Reauth(ctx)
+	var apiErr *controlapi.APIError
+	if errors.As(err, &apiErr) {
+		return &cliError{exitCode: 1, msg: "reauth failed: " + apiErr.Message}
+	}
+	if err != nil {
+		return fmt.Errorf("reauth: %w", err)
+	}
+
+	fmt.Fprintf(stdout, "Reauthenticated as %s", resp.User)
+	if resp.AuthType != "" {
+		fmt.Fprintf(stdout, " (%s auth)", resp.AuthType)
+	}
+	fmt.Fprintln(stdout)
+	if resp.ExpiresAt != nil {
+		fmt.Fprintf(stdout, "Token expires at %s\n", resp.ExpiresAt.Local().Format(time.RFC3339))
+	}
+	return nil
+}
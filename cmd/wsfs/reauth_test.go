@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+	"github.com/databricks/databricks-sdk-go/config"
+
+	"wsfs/internal/controlapi"
+)
+
+// noLoader keeps test configs from reading the environment and
+// ~/.databrickscfg.
+type noLoader struct{}
+
+func (noLoader) Name() string                   { return "none" }
+func (noLoader) Configure(*config.Config) error { return nil }
+
+// jwtExpiring returns a bearer token in JWT form that expires at exp.
+func jwtExpiring(exp time.Time) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return enc([]byte(`{"alg":"none"}`)) + "." + enc([]byte(fmt.Sprintf(`{"sub":"me","exp":%d}`, exp.Unix()))) + ".sig"
+}
+
+// tokenClient returns a workspace client that authenticates with token.
+func tokenClient(token string) *databrickssdk.WorkspaceClient {
+	return &databrickssdk.WorkspaceClient{Config: &config.Config{
+		Host:        "https://ws.example.com",
+		Token:       token,
+		Credentials: config.PatCredentials{},
+		Loaders:     []config.Loader{noLoader{}},
+	}}
+}
+
+// authenticatedAs calls the current-user API the way the SDK would: it
+// authenticates a request and checks the token against valid.
+func authenticatedAs(valid map[string]bool) func(context.Context, *databrickssdk.WorkspaceClient) (string, error) {
+	return func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
+		req, _ := http.NewRequest(http.MethodGet, w.Config.Host, nil)
+		if err := w.Config.Authenticate(req); err != nil {
+			return "", err
+		}
+		if !valid[strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")] {
+			return "", errors.New("invalid access token")
+		}
+		return "Me", nil
+	}
+}
+
+func bearerOf(t *testing.T, auth *workspaceAuth) string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, "https://ws.example.com", nil)
+	if err := auth.SetHeaders(req); err != nil {
+		t.Fatalf("SetHeaders: %v", err)
+	}
+	return strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Unix(1900000000, 0)
+	if got, ok := tokenExpiry("Bearer " + jwtExpiring(exp)); !ok || !got.Equal(exp) {
+		t.Fatalf("tokenExpiry of a JWT = %v, %v", got, ok)
+	}
+	for _, header := range []string{
+		"",
+		"Bearer dapi0123456789abcdef",
+		"Basic dXNlcjpwYXNz",
+		"Bearer a.!!!.c",
+		"Bearer " + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"me"}`)) + ".sig",
+	} {
+		if got, ok := tokenExpiry(header); ok {
+			t.Fatalf("tokenExpiry(%q) = %v, want no expiry", header, got)
+		}
+	}
+}
+
+func TestExpiryNoticeReportsEachTokenOnce(t *testing.T) {
+	now := time.Unix(1900000000, 0)
+	notice := &expiryNotice{warnBefore: 10 * time.Minute}
+	first := now.Add(30 * time.Minute)
+
+	for _, tt := range []struct {
+		expiresAt, now time.Time
+		warn, expired  bool
+	}{
+		{first, now, false, false},
+		{first, now.Add(25 * time.Minute), true, false},
+		{first, now.Add(26 * time.Minute), false, false},
+		{first, now.Add(30 * time.Minute), false, true},
+		{first, now.Add(31 * time.Minute), false, false},
+		// A renewed token is tracked afresh.
+		{now.Add(90 * time.Minute), now.Add(85 * time.Minute), true, false},
+	} {
+		warn, expired := notice.next(tt.expiresAt, tt.now)
+		if warn != tt.warn || expired != tt.expired {
+			t.Fatalf("next(%s before expiry) = %v, %v, want %v, %v", tt.expiresAt.Sub(tt.now), warn, expired, tt.warn, tt.expired)
+		}
+	}
+}
+
+func TestWorkspaceAuthReauth(t *testing.T) {
+	oldToken := jwtExpiring(time.Now().Add(5 * time.Minute))
+	newExpiry := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	newToken := jwtExpiring(newExpiry)
+	valid := map[string]bool{oldToken: true}
+	next := tokenClient(newToken)
+
+	w := tokenClient(oldToken)
+	me := authenticatedAs(valid)
+	auth := newWorkspaceAuth(w, func() (*databrickssdk.WorkspaceClient, error) { return next, nil }, me)
+	if _, err := me(context.Background(), w); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if got := bearerOf(t, auth); got != oldToken {
+		t.Fatalf("token before reauth = %q", got)
+	}
+	if auth.Name() != "pat" || w.Config.AuthType != "pat" {
+		t.Fatalf("auth type = %q, config %q", auth.Name(), w.Config.AuthType)
+	}
+
+	// New credentials that the workspace rejects are not taken.
+	if _, err := auth.Reauth(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid access token") {
+		t.Fatalf("Reauth with rejected credentials = %v", err)
+	}
+	if got := bearerOf(t, auth); got != oldToken {
+		t.Fatalf("token after a failed reauth = %q, want the old one", got)
+	}
+
+	valid[newToken] = true
+	next = tokenClient(newToken)
+	resp, err := auth.Reauth(context.Background())
+	if err != nil {
+		t.Fatalf("Reauth: %v", err)
+	}
+	if resp.User != "Me" || resp.AuthType != "pat" || resp.ExpiresAt == nil || !resp.ExpiresAt.Equal(newExpiry) {
+		t.Fatalf("Reauth = %+v", resp)
+	}
+	if got := bearerOf(t, auth); got != newToken {
+		t.Fatalf("token after reauth = %q, want the new one", got)
+	}
+	// Requests of the mount's own client carry the new token too.
+	req, _ := http.NewRequest(http.MethodGet, w.Config.Host, nil)
+	if err := w.Config.Authenticate(req); err != nil || req.Header.Get("Authorization") != "Bearer "+newToken {
+		t.Fatalf("mount client Authorization = %q, %v", req.Header.Get("Authorization"), err)
+	}
+}
+
+func TestRunReauth(t *testing.T) {
+	token := jwtExpiring(time.Now().Add(time.Hour))
+	w := tokenClient(token)
+	me := authenticatedAs(map[string]bool{token: true})
+	auth := newWorkspaceAuth(w, func() (*databrickssdk.WorkspaceClient, error) { return tokenClient(token), nil }, me)
+
+	for _, tt := range []struct {
+		mount    *currentMount
+		wantCode int
+		want     string
+	}{
+		{mount: &currentMount{auth: auth}, want: "Reauthenticated as Me (pat auth)\nToken expires at "},
+		{mount: &currentMount{}, wantCode: 1, want: "reauth failed: the mount does not use workspace credentials"},
+	} {
+		socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+		server, err := controlapi.Listen(socketPath, tt.mount, func(bool) {})
+		if err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		var out bytes.Buffer
+		err = run([]string{"wsfs", "reauth", "--control-socket", socketPath}, runDeps{stdout: &out})
+		server.Close()
+
+		if tt.wantCode == 0 {
+			if err != nil || !strings.HasPrefix(out.String(), tt.want) {
+				t.Fatalf("reauth = %v, output %q", err, out.String())
+			}
+			continue
+		}
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != tt.wantCode || !strings.HasPrefix(cliErr.msg, tt.want) {
+			t.Fatalf("reauth without credentials = %v, want exit code %d", err, tt.wantCode)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"wsfs", "reauth"},
+		{"wsfs", "reauth", "--control-socket", "/tmp/x.sock", "extra"},
+	} {
+		err := run(args, runDeps{stdout: &bytes.Buffer{}})
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("run %v = %v, want exit code 2", args[1:], err)
+		}
+	}
+}
+
+func TestParseArgsTokenExpiryWarning(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil || cfg.tokenExpiryWarning != defaultTokenExpiryWarning {
+		t.Fatalf("default tokenExpiryWarning = %v, %v", cfg.tokenExpiryWarning, err)
+	}
+	cfg, err = parseArgs([]string{"wsfs", "--token-expiry-warning=0", "/mnt/wsfs"})
+	if err != nil || cfg.tokenExpiryWarning != 0 {
+		t.Fatalf("--token-expiry-warning=0 = %v, %v", cfg.tokenExpiryWarning, err)
+	}
+	_, err = parseArgs([]string{"wsfs", "--token-expiry-warning=-1m", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("negative --token-expiry-warning = %v, want exit code 2", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/logging"
+	"wsfs/internal/record"
+)
+
+// openRecording starts the --record trace, or returns nil without one.
+func openRecording(file string) (*record.Recorder, error) {
+	if file == "" {
+		return nil, nil
+	}
+	rec, err := record.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	logging.Infof("Recording FUSE requests and backend calls to %s", file)
+	return rec, nil
+}
+
+func closeRecording(rec *record.Recorder, file string) {
+	if err := rec.Close(); err != nil {
+		logging.Warnf("Recording to %s failed: %v", file, err)
+	}
+}
+
+// runReplay implements `wsfs replay`: it re-executes the backend calls of
+// a --record trace against a local backend, seeded with what the trace
+// saw, and reports calls whose outcome differs from the recording. Like
+// diff it exits with status 1 when there are differences.
+func runReplay(program string, args []string, stdout io.Writer) error {
+	usage := fmt.Sprintf("Usage: %s replay [--dir DIR] [--realtime] [--json] TRACE", program)
+	fs := flag.NewFlagSet(program+" replay", flag.ContinueOnError)
+	dir := fs.String("dir", "", "empty directory the local backend replays into, kept afterwards for inspection (default: a temporary directory, removed)")
+	realtime := fs.Bool("realtime", false, "issue each call at its recorded time instead of back to back, to reproduce timing-dependent hangs")
+	jsonOutput := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return &cliError{exitCode: 0, printed: true}
+		}
+		return &cliError{exitCode: 2, msg: err.Error(), printed: true}
+	}
+	if fs.NArg() != 1 {
+		return &cliError{exitCode: 2, msg: usage}
+	}
+	entries, err := record.Load(fs.Arg(0))
+	if err != nil {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid trace: %v", err)}
+	}
+
+	root := *dir
+	if root == "" {
+		if root, err = os.MkdirTemp("", "wsfs-replay-"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(root)
+	} else if names, err := os.ReadDir(root); err != nil {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --dir: %v", err)}
+	} else if len(names) > 0 {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --dir: %s is not empty", root)}
+	}
+	local, err := backend.NewLocalBackend(root, 0)
+	if err != nil {
+		return err
+	}
+
+	report, err := record.Replay(context.Background(), local, entries, record.ReplayOptions{Realtime: *realtime})
+	if err != nil {
+		return fmt.Errorf("replay %s: %w", fs.Arg(0), err)
+	}
+	if *jsonOutput {
+		if err := printJSON(stdout, report); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range report.Divergences {
+			fmt.Fprintln(stdout, d)
+		}
+		fmt.Fprintf(stdout, "%d call(s) replayed (%d unfinished in the trace), %d object(s) seeded, %d divergence(s)\n",
+			report.Calls, report.Unfinished, report.Seeded, len(report.Divergences))
+	}
+	if len(report.Divergences) > 0 {
+		return &cliError{exitCode: 1}
+	}
+	return nil
+}
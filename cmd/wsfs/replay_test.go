@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeTrace writes a trace of a stat, a read and an upload of notes.txt.
+func writeTrace(t *testing.T, readSize int) string {
+	t.Helper()
+	trace := strings.Join([]string{
+		`{"seq":1,"at_us":0,"dur_us":120,"kind":"fuse","op":"lookup","node":1,"path":"notes.txt"}`,
+		`{"seq":2,"at_us":10,"dur_us":100,"kind":"api","op":"stat","path":"/notes.txt","size":6}`,
+		`{"seq":3,"at_us":200,"dur_us":90,"kind":"api","op":"read_all","path":"/notes.txt","size":` + strconv.Itoa(readSize) + `}`,
+		`{"seq":4,"at_us":400,"dur_us":300,"kind":"api","op":"write","path":"/notes.txt","size":9}`,
+		`{"seq":5,"at_us":800,"dur_us":50,"kind":"api","op":"stat_fresh","path":"/notes.txt","size":9}`,
+		`{"seq":6,"at_us":900,"dur_us":70,"kind":"api","op":"stat","path":"/gone.txt","error":"not found","error_kind":"not_exist"}`,
+	}, "\n") + "\n"
+	file := filepath.Join(t.TempDir(), "trace.jsonl")
+	if err := os.WriteFile(file, []byte(trace), 0o600); err != nil {
+		t.Fatalf("write trace: %v", err)
+	}
+	return file
+}
+
+func TestRunReplayMatchingTrace(t *testing.T) {
+	deps := defaultDeps()
+	var out bytes.Buffer
+	deps.stdout = &out
+	dir := t.TempDir()
+	if err := run([]string{"wsfs", "replay", "--dir", dir, writeTrace(t, 6)}, deps); err != nil {
+		t.Fatalf("replay = %v, output %q", err, out.String())
+	}
+	if want := "5 call(s) replayed (0 unfinished in the trace), 1 object(s) seeded, 0 divergence(s)\n"; out.String() != want {
+		t.Fatalf("output = %q, want %q", out.String(), want)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "notes.txt")); err != nil || len(data) != 9 {
+		t.Fatalf("replayed notes.txt = %q, %v, want the 9 byte upload", data, err)
+	}
+}
+
+func TestRunReplayReportsDivergence(t *testing.T) {
+	deps := defaultDeps()
+	var out bytes.Buffer
+	deps.stdout = &out
+	err := run([]string{"wsfs", "replay", writeTrace(t, 3)}, deps)
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 1 {
+		t.Fatalf("replay = %v, want exit code 1", err)
+	}
+	if !strings.HasPrefix(out.String(), "#3 read_all /notes.txt: recorded 3 bytes, replayed 6 bytes\n") {
+		t.Fatalf("output = %q", out.String())
+	}
+}
+
+func TestRunReplayUsageErrors(t *testing.T) {
+	notEmpty := t.TempDir()
+	if err := os.WriteFile(filepath.Join(notEmpty, "x"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	trace := writeTrace(t, 6)
+	deps := defaultDeps()
+	deps.stdout = &bytes.Buffer{}
+	for _, args := range [][]string{
+		{"wsfs", "replay"},
+		{"wsfs", "replay", filepath.Join(t.TempDir(), "missing.jsonl")},
+		{"wsfs", "replay", "--dir", notEmpty, trace},
+	} {
+		err := run(args, deps)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("run %v = %v, want exit code 2", args[2:], err)
+		}
+	}
+}
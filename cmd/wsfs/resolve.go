@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"wsfs/internal/controlapi"
+	wsfsfuse "wsfs/internal/fuse"
+)
+
+// resolveTimeout bounds a resolve request. The mount may have to list a
+// large part of the workspace to find an ID.
+const resolveTimeout = 5 * time.Minute
+
+// runResolve implements `wsfs resolve`: it asks a running mount which path,
+// inode and cache state belong to a workspace object ID, as found in audit
+// logs and API error messages.
+func runResolve(program string, args []string, stdout io.Writer) error {
+	usage := fmt.Sprintf("Usage: %s resolve --control-socket SOCKET OBJECT_ID", program)
+	fs := flag.NewFlagSet(program+" resolve", flag.ContinueOnError)
+	controlSocket := fs.String("control-socket", "", "control API socket of the mount to ask (the mount's --control-socket)")
+	jsonOutput := fs.Bool("json", false, "print the result as JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return &cliError{exitCode: 0, printed: true}
+		}
+		return &cliError{exitCode: 2, msg: err.Error(), printed: true}
+	}
+	if fs.NArg() != 1 {
+		return &cliError{exitCode: 1, msg: usage}
+	}
+	if *controlSocket == "" {
+		return &cliError{exitCode: 2, msg: "resolve needs --control-socket of a running mount"}
+	}
+	objectID, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil || objectID <= 0 {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid object ID %q: want a positive integer", fs.Arg(0))}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	resolved, err := controlapi.NewClient(*controlSocket).Resolve(ctx, objectID)
+	// A missing socket is also ErrNotExist, so check for the API's 404.
+	var apiErr *controlapi.APIError
+	if errors.As(err, &apiErr) && errors.Is(apiErr, os.ErrNotExist) {
+		return &cliError{exitCode: 1, msg: fmt.Sprintf("object %d is not below the mount root", objectID)}
+	}
+	if err != nil {
+		return fmt.Errorf("resolve object %d: %w", objectID, err)
+	}
+
+	if *jsonOutput {
+		return printJSON(stdout, resolved)
+	}
+	writeResolved(stdout, resolved)
+	return nil
+}
+
+func writeResolved(w io.Writer, resolved wsfsfuse.ResolvedObject) {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	inode := "not loaded"
+	if resolved.Loaded {
+		inode = strconv.FormatUint(resolved.Inode, 10)
+	}
+	fmt.Fprintf(w, "object_id:   %d\n", resolved.ObjectID)
+	fmt.Fprintf(w, "object_type: %s\n", resolved.ObjectType)
+	fmt.Fprintf(w, "remote_path: %s\n", resolved.RemotePath)
+	fmt.Fprintf(w, "mount_path:  %s\n", resolved.MountPath)
+	fmt.Fprintf(w, "inode:       %s\n", inode)
+	fmt.Fprintf(w, "dirty:       %s\n", yesNo(resolved.Dirty))
+	fmt.Fprintf(w, "disk_cached: %s\n", yesNo(resolved.DiskCached))
+	if resolved.LastError != "" {
+		fmt.Fprintf(w, "last_error:  %s\n", resolved.LastError)
+	}
+}
+
+func printJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
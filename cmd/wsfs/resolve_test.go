@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	wsfsfuse "wsfs/internal/fuse"
+)
+
+// serveResolve answers resolve requests on a unix socket like a mount whose
+// tree holds a single notebook with object ID 42.
+func serveResolve(t *testing.T) string {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/resolve", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ObjectID int64 `json:"object_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.ObjectID != 42 {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(wsfsfuse.ResolvedObject{
+			ObjectID:   42,
+			ObjectType: "NOTEBOOK",
+			RemotePath: "/Users/me/etl",
+			MountPath:  "/etl.py",
+			Loaded:     true,
+			Inode:      7,
+			Dirty:      true,
+			LastError:  "upload: permission denied",
+		})
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socketPath
+}
+
+func TestRunResolvePrintsPathAndState(t *testing.T) {
+	socketPath := serveResolve(t)
+	deps := defaultDeps()
+	var out bytes.Buffer
+	deps.stdout = &out
+
+	if err := run([]string{"wsfs", "resolve", "--control-socket", socketPath, "42"}, deps); err != nil {
+		t.Fatalf("run resolve: %v", err)
+	}
+	for _, want := range []string{
+		"object_type: NOTEBOOK\n",
+		"remote_path: /Users/me/etl\n",
+		"mount_path:  /etl.py\n",
+		"inode:       7\n",
+		"dirty:       yes\n",
+		"disk_cached: no\n",
+		"last_error:  upload: permission denied\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := run([]string{"wsfs", "resolve", "--json", "--control-socket", socketPath, "42"}, deps); err != nil {
+		t.Fatalf("run resolve --json: %v", err)
+	}
+	var resolved wsfsfuse.ResolvedObject
+	if err := json.Unmarshal(out.Bytes(), &resolved); err != nil || resolved.MountPath != "/etl.py" {
+		t.Fatalf("--json output = %q, %v", out.String(), err)
+	}
+}
+
+func TestRunResolveErrors(t *testing.T) {
+	socketPath := serveResolve(t)
+	deps := defaultDeps()
+	deps.stdout = &bytes.Buffer{}
+
+	for _, tt := range []struct {
+		args     []string
+		exitCode int
+	}{
+		{[]string{"wsfs", "resolve", "--control-socket", socketPath}, 1},
+		{[]string{"wsfs", "resolve", "42"}, 2},
+		{[]string{"wsfs", "resolve", "--control-socket", socketPath, "abc"}, 2},
+		{[]string{"wsfs", "resolve", "--control-socket", socketPath, "0"}, 2},
+		{[]string{"wsfs", "resolve", "--control-socket", socketPath, "43"}, 1},
+	} {
+		err := run(tt.args, deps)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != tt.exitCode {
+			t.Fatalf("run %v = %v, want exit code %d", tt.args[2:], err, tt.exitCode)
+		}
+	}
+
+	err := run([]string{"wsfs", "resolve", "--control-socket", filepath.Join(t.TempDir(), "none.sock"), "42"}, deps)
+	if err == nil || !strings.Contains(err.Error(), "resolve object 42") {
+		t.Fatalf("run without a mount = %v", err)
+	}
+}
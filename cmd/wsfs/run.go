@@ -2,26 +2,42 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"net/http"
+	"os"
 	"os/signal"
 	"os/user"
+	"path/filepath"
+	"runtime"
 	"strconv"
-	"sync"
+	"strings"
 	"syscall"
 	"time"
+	"unicode"
 
 	databrickssdk "github.com/databricks/databricks-sdk-go"
 
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
 
+	"wsfs/internal/backend"
+	"wsfs/internal/controlapi"
 	"wsfs/internal/databricks"
+	"wsfs/internal/events"
+	"wsfs/internal/faultinject"
 	"wsfs/internal/filecache"
 	wsfsfuse "wsfs/internal/fuse"
 	"wsfs/internal/logging"
+	"wsfs/internal/pathutil"
+	"wsfs/internal/record"
+	"wsfs/internal/transform"
 )
 
 // Shutdown timeout for flushing dirty buffers
@@ -32,16 +48,138 @@ const (
 	defaultAttrTTL     = 10 * time.Second
 	defaultEntryTTL    = 10 * time.Second
 	defaultNegativeTTL = 3 * time.Second
+
+	// --ide-mode trades how soon out-of-band remote changes show up for
+	// fewer round-trips: without inotify, IDEs and language servers stat
+	// and list the same paths over and over.
+	ideMetadataTTL = 30 * time.Second
+	ideNegativeTTL = 10 * time.Second
+
+	defaultRootRevalidateInterval = time.Minute
+
+	// defaultTokenExpiryWarning is below the SDK's early refresh of OAuth
+	// tokens, so only tokens that fail to refresh draw a warning.
+	defaultTokenExpiryWarning = 10 * time.Minute
+
+	// defaultCacheAuditSample is how many disk cache entries each
+	// --cache-audit-interval round re-stats.
+	defaultCacheAuditSample = 32
+
+	// defaultCacheGCInterval is how often the disk cache is reconciled
+	// with its index and the index saved while mounted.
+	defaultCacheGCInterval = time.Hour
+
+	// defaultBulkImportWorkers bounds concurrent uploads while an archive
+	// is extracted into the mount.
+	defaultBulkImportWorkers = 8
+
+	// minMaxWrite and maxMaxWrite bound --max-write: one page, and the
+	// largest request Linux sends (256 pages).
+	minMaxWrite = 4 << 10
+	maxMaxWrite = 1 << 20
 )
 
+// defaultIDEHidePatterns are the names --ide-mode hides unless --hide is
+// given: desktop metadata files and tool caches that only matter locally
+// and whose writes the tools tolerate failing.
+var defaultIDEHidePatterns = []string{".DS_Store", "._*", "Thumbs.db", "desktop.ini", "__pycache__", ".pytest_cache"}
+
+// defaultLocalTempPatterns are the lock and probe files --local-temp keeps
+// out of the workspace by default: Office owner files, LibreOffice and
+// Emacs locks, and the file vim creates to test a directory is writable.
+var defaultLocalTempPatterns = []string{"~$*", ".~lock.*#", ".#*", "4913"}
+
 // cliConfig captures parsed command-line flags.
 type cliConfig struct {
 	showVersion bool
 	debug       bool
 	logLevel    string
 	allowOther  bool
+	snapshot    bool
 	remotePath  string
 	mountPoint  string
+
+	// fsName is the mount's source in mount and df; volName is the macOS
+	// volume label, the fsName when empty.
+	fsName  string
+	volName string
+
+	// autoCreateMountPoint creates a missing mount point.
+	autoCreateMountPoint bool
+	// recoverStaleMount detaches a mount point left disconnected by a
+	// crashed wsfs at startup.
+	recoverStaleMount bool
+
+	// allowUids and allowGids limit an --allow-other mount to these users
+	// and groups besides the owner.
+	allowUids []uint32
+	allowGids []uint32
+
+	// baseLevel and moduleLevels are parsed from logLevel.
+	baseLevel    logging.LogLevel
+	moduleLevels map[string]logging.LogLevel
+
+	statfsTotalBytes uint64
+	statfsTotalFiles uint64
+	caseInsensitive  bool
+	// fileMode and dirMode are the reported permission bits with --umask
+	// already applied.
+	fileMode         uint32
+	dirMode          uint32
+	execMode         wsfsfuse.ExecMode
+	cachedBlocks     bool // --du-mode=cached
+	normalizeUnicode bool
+	notebookAliases  pathutil.NotebookAliases
+
+	ideMode              bool
+	staleWhileRevalidate time.Duration
+	metaTTL              time.Duration // 0 keeps the default, or the --ide-mode TTL
+	metaMaxEntries       int           // 0 keeps the default
+	validateListings     bool
+	hidePatterns         []string
+	localTempPatterns    []string
+	noCachePatterns      []string
+	optimisticMkdir      bool
+	cacheWritableOpens   bool
+	objectInfoFiles      bool
+	transforms           *transform.Set // from --attributes-file
+	warmRepos            bool
+	bulkImportWorkers    int
+	flushRetries         int
+	flushThreshold       int64 // --flush-threshold in bytes; 0 waits for a flush
+	maxWrite             int   // --max-write in bytes; 0 keeps go-fuse's 128 KiB
+	maxReadahead         int   // --max-readahead in bytes; 0 keeps the kernel's
+	maxBackground        int
+
+	backend       backendSpec
+	backendRoutes []backendRoute
+	// workspaces federates one workspace per profile under the root.
+	workspaces []workspaceMember
+
+	transfer  databricks.TransferConfig
+	transport databricks.TransportConfig
+
+	controlSocket string
+	recordFile    string // --record
+
+	diskCacheExclude []string
+	diskCacheQuotas  []filecache.Quota
+	pinBudget        int64 // 0 uses filecache.DefaultPinMaxBytes
+	diskCacheTTL     filecache.TTLPolicy
+
+	eventsWebhook string
+	eventsSocket  string
+
+	rootRevalidateInterval time.Duration
+	tokenExpiryWarning     time.Duration
+
+	cacheAuditInterval time.Duration
+	cacheAuditSample   int
+	cacheAuditHeal     bool
+	cacheGCInterval    time.Duration
+
+	supervise   bool
+	maxRemounts int
 }
 
 type cliError struct {
@@ -60,21 +198,36 @@ type mountServer interface {
 }
 
 type runDeps struct {
-	initWorkspace           func() (*databrickssdk.WorkspaceClient, error)
+	faultInjector           func() (*faultinject.Injector, error)
+	initWorkspace           func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error)
+	initProfileWorkspace    func(transport http.RoundTripper, profile string, rateLimit int) (*databrickssdk.WorkspaceClient, error)
 	workspaceMe             func(context.Context, *databrickssdk.WorkspaceClient) (string, error)
 	currentUser             func() (*user.User, error)
 	newDiskCache            func() (*filecache.DiskCache, error)
 	newWorkspaceFilesClient func(*databrickssdk.WorkspaceClient) (databricks.WorkspaceFilesAPI, error)
 	newRootNode             func(databricks.WorkspaceFilesAPI, *filecache.DiskCache, string, *wsfsfuse.DirtyNodeRegistry, *wsfsfuse.NodeConfig) (*wsfsfuse.WSNode, error)
-	mount                   func(string, fs.InodeEmbedder, *fs.Options) (mountServer, error)
+	mount                   func(string, fs.InodeEmbedder, *fs.Options, *record.Recorder) (mountServer, error)
 	signalContext           func() (context.Context, context.CancelFunc)
+	preflight               func(mountPoint string, autoCreate bool) error
+	statMountPoint          func(string) error
+	mountedFsType           func(string) (string, bool)
+	lazyUnmount             func(string) error
+	remountBackoff          time.Duration
 	versionOut              func(string)
+	stdout                  io.Writer
 }
 
 func defaultDeps() runDeps {
 	return runDeps{
-		initWorkspace: func() (*databrickssdk.WorkspaceClient, error) {
-			return databrickssdk.NewWorkspaceClient()
+		faultInjector: faultinject.FromEnv,
+		initWorkspace: func(transport http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
+			if transport == nil {
+				return databrickssdk.NewWorkspaceClient()
+			}
+			return databrickssdk.NewWorkspaceClient(&databrickssdk.Config{HTTPTransport: transport})
+		},
+		initProfileWorkspace: func(transport http.RoundTripper, profile string, rateLimit int) (*databrickssdk.WorkspaceClient, error) {
+			return databrickssdk.NewWorkspaceClient(&databrickssdk.Config{Profile: profile, HTTPTransport: transport, RateLimitPerSecond: rateLimit})
 		},
 		workspaceMe: func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
 			me, err := w.CurrentUser.Me(ctx)
@@ -89,18 +242,44 @@ func defaultDeps() runDeps {
 			return databricks.NewWorkspaceFilesClient(w)
 		},
 		newRootNode: wsfsfuse.NewRootNode,
-		mount: func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options) (mountServer, error) {
-			return fs.Mount(mountPoint, root, opts)
-		},
+		mount:       mountWithRequestMetrics,
 		signalContext: func() (context.Context, context.CancelFunc) {
 			return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 		},
+		preflight: preflightMount,
+		statMountPoint: func(mountPoint string) error {
+			_, err := os.Stat(mountPoint)
+			return err
+		},
+		mountedFsType: func(mountPoint string) (string, bool) {
+			return mountedFilesystem(mountPoint, mountInfoPath)
+		},
+		lazyUnmount:    lazyUnmount,
+		remountBackoff: defaultRemountBackoff,
 		versionOut: func(s string) {
 			fmt.Print(s)
 		},
+		stdout: os.Stdout,
 	}
 }
 
+// mountWithRequestMetrics mounts root like fs.Mount, with the raw file
+// system wrapped to record the fuse_requests_* metrics, and the requests
+// themselves in rec when set.
+func mountWithRequestMetrics(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
+	raw := wsfsfuse.RecordRequests(fs.NewNodeFS(root, opts), rec)
+	raw = wsfsfuse.CountRequests(raw, wsfsfuse.CongestionThreshold(opts.MaxBackground))
+	server, err := fuse.NewServer(raw, mountPoint, &opts.MountOptions)
+	if err != nil {
+		return nil, err
+	}
+	go server.Serve()
+	if err := server.WaitMount(); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
 func parseArgs(args []string) (cliConfig, error) {
 	var cfg cliConfig
 	if len(args) == 0 {
@@ -111,9 +290,78 @@ func parseArgs(args []string) (cliConfig, error) {
 
 	showVersion := fs.Bool("version", false, "print version and exit")
 	debug := fs.Bool("debug", false, "print debug data (equivalent to --log-level=debug)")
-	logLevel := fs.String("log-level", "info", "log level: debug, info, warn, error")
+	recordFile := fs.String("record", "", "write a trace of every FUSE request and backend call, with timings but no file content or credentials, to this file for a bug report; wsfs replay re-runs its backend calls (default: off)")
+	logLevel := fs.String("log-level", "info", "log level: debug, info, warn, error, optionally with per-module overrides, e.g. warn,fuse=debug,databricks=info")
 	allowOther := fs.Bool("allow-other", false, "allow other users to access the mount")
+	fsName := fs.String("fsname", defaultFsName, "name shown as the mount's source in mount and df, to tell several mounts apart")
+	volName := fs.String("volname", "", "volume label of the mount on macOS (default: the --fsname value)")
+	snapshot := fs.Bool("snapshot", false, "mount read-only and pin every file and directory to how it looked when first accessed, for reproducible builds; later remote changes stay hidden")
+	allowUids := fs.String("allow-uids", "", "with --allow-other, comma-separated users (names or UIDs) allowed besides the owner; everyone else is denied (default: all users)")
+	allowGids := fs.String("allow-gids", "", "with --allow-other, comma-separated groups (names or GIDs) whose members are allowed besides the owner; everyone else is denied (default: all users)")
 	remotePath := fs.String("remote-path", "", "Databricks workspace path to mount (default: /)")
+	statfsSize := fs.String("statfs-size", "", "total capacity reported by df, e.g. 500G or 2T (default: 4T)")
+	fileMode := fs.String("file-mode", "0644", "permission bits reported for files, in octal")
+	dirMode := fs.String("dir-mode", "0755", "permission bits reported for directories, in octal")
+	execMode := fs.String("exec-mode", "none", "execute bits reported for files: none (nothing on the mount can be run), all, or by-extension (.sh and similar, and files without an extension that start with #! once their content is local)")
+	duMode := fs.String("du-mode", "logical", "what st_blocks, and so du, counts: logical (the file size) or cached (only content held locally in memory or the disk cache)")
+	umask := fs.String("umask", "0", "octal mask cleared from --file-mode and --dir-mode, e.g. 077 reports files as 0600 and directories as 0700")
+	statfsInodes := fs.Uint64("statfs-inodes", 0, "total inode count reported by df (default: 16777216)")
+	unicodeNormalization := fs.String("unicode-normalization", "nfc", "normalization of new file names: nfc (match macOS NFD names to NFC on lookup) or none")
+	notebookAliases := fs.String("notebook-aliases", "suffix-only", "names notebooks are shown under: suffix-only (foo.py, or foo.ipynb), both (foo.py and foo) or none (foo only; foo.py is then a regular file)")
+	caseInsensitive := fs.Bool("case-insensitive", false, "rename siblings that differ only in case and match lookups regardless of case, for macOS clients")
+	signedURLThreshold := fs.String("signed-url-threshold", "", "file size from which transfers use signed URLs, e.g. 16M, or auto to pick per request from measured throughput (default: 5M)")
+	maxNotebookSize := fs.String("max-notebook-size", "", "refuse notebook saves larger than this size, e.g. 10M, with EFBIG before uploading (default: off, the workspace enforces its own limit)")
+	caBundle := fs.String("ca-bundle", "", "PEM file of extra CA certificates to trust for Databricks and signed URL traffic")
+	insecureSkipTLSVerify := fs.Bool("insecure-skip-tls-verify", false, "disable TLS certificate verification (debugging only, insecure)")
+	maxIdleConnsPerHost := fs.Int("max-idle-conns-per-host", 0, "idle keep-alive connections kept per host (default: 16)")
+	disableHTTP2 := fs.Bool("disable-http2", false, "use HTTP/1.1 only, for proxies that mishandle HTTP/2")
+	controlSocket := fs.String("control-socket", "", "serve the JSON control API on this unix socket (default: off)")
+	diskCacheQuota := fs.String("disk-cache-quota", "", "comma-separated PATH=SIZE budgets, e.g. /Users/me/big-data=2G, capping the disk cache bytes of a workspace tree so it cannot evict everything else (default: none)")
+	diskCacheTTLPolicy := fs.String("disk-cache-ttl-policy", "idle", "what the disk cache TTL counts from: idle (the last read, so files in use stay cached) or absolute (when the content was fetched, so every file is fetched again after one TTL)")
+	pinBudget := fs.String("disk-cache-pin-budget", "", "bytes the disk cache keeps for pinned files (wsfs cache pin, or pin in --attributes-file), which LRU and TTL eviction leave alone, e.g. 4G (default: 1G)")
+	diskCacheExclude := fs.String("disk-cache-exclude", strings.Join(filecache.DefaultExcludePatterns, ","), "comma-separated file name patterns kept in memory only, never in the disk cache (empty disables)")
+	rootRevalidateInterval := fs.Duration("root-revalidate-interval", defaultRootRevalidateInterval, "how often to re-check that the mount root is reachable (0 disables)")
+	tokenExpiryWarning := fs.Duration("token-expiry-warning", defaultTokenExpiryWarning, "log a warning this long before the workspace token expires, when the token carries its expiry (0 disables)")
+	cacheAuditInterval := fs.Duration("cache-audit-interval", 0, "how often to re-stat a random sample of disk cache entries and report those that disagree with the workspace (0 disables)")
+	cacheAuditSample := fs.Int("cache-audit-sample", defaultCacheAuditSample, "disk cache entries checked per --cache-audit-interval round")
+	cacheAuditHeal := fs.Bool("cache-audit-heal", false, "invalidate the disk cache entries --cache-audit-interval finds divergent")
+	cacheGCInterval := fs.Duration("cache-gc-interval", defaultCacheGCInterval, "how often to remove disk cache files without an index entry and entries without a file, and save the index (0 disables; startup always does it)")
+	eventsWebhook := fs.String("events-webhook", "", "POST each local change (create, write, delete, rename) as JSON to this http(s) URL (default: off)")
+	autoCreateMountPoint := fs.Bool("auto-create-mountpoint", false, "create the mount point directory, with its parents, when it does not exist")
+	recoverStaleMount := fs.Bool("recover-stale-mount", false, "at startup, detach a mount point left disconnected (\"Transport endpoint is not connected\") by a crashed wsfs, like fusermount -u -z, instead of refusing to start; only fuse.wsfs mounts are detached")
+	supervise := fs.Bool("supervise", false, "remount automatically when the FUSE connection breaks (\"Transport endpoint is not connected\")")
+	ideMode := fs.Bool("ide-mode", false, "tune the mount for IDEs and language servers: 30s metadata and kernel cache TTLs, 10s negative caching, and --hide defaults to desktop and tool clutter")
+	metaTTL := fs.Duration("meta-ttl", 0, "how long stat results and listings stay in the metadata cache (default: 10s, 30s with --ide-mode)")
+	metaMaxEntries := fs.Int("meta-max-entries", 0, "most stat results and listings the metadata cache holds together (default: 10000)")
+	validateListings := fs.Bool("validate-listings", false, "when a cached directory listing expires, stat the directory and reuse the listing if its modification time is unchanged, instead of listing it again; relies on the workspace updating a directory's modification time whenever its entries change")
+	staleWhileRevalidate := fs.Duration("stale-while-revalidate", 0, "answer from expired metadata for up to this long past its TTL while a background request refreshes it, for low latency on slow links (0 disables)")
+	hide := fs.String("hide", "", "comma-separated file name patterns the mount hides from listings and lookups and refuses to create (default: none, or "+strings.Join(defaultIDEHidePatterns, ",")+" with --ide-mode)")
+	noCachePaths := fs.String("no-cache-paths", "", "comma-separated patterns of files read fresh from the workspace every time, bypassing every cache: absolute workspace path globs (a directory covers its tree) or file name globs")
+	localTemp := fs.String("local-temp", strings.Join(defaultLocalTempPatterns, ","), "comma-separated file name patterns of editor lock and temp files kept in memory only: never uploaded and dropped when closed (empty disables)")
+	warmRepos := fs.Bool("warm-repos", false, "list a Databricks Repo's whole tree into the metadata cache in the background when it is first opened, so IDEs do not stat every file")
+	cacheWritableOpens := fs.Bool("cache-writable-opens", false, "let the kernel page cache serve files opened for writing, so editors that read back what they write do not go to wsfs for every read (notebooks excluded)")
+	objectInfoFiles := fs.Bool("objectinfo-files", false, "add a hidden, read-only .wsfs-objectinfo.json to every directory listing the workspace object info (IDs, languages, timestamps) of its children")
+	attributesFile := fs.String("attributes-file", "", "a .wsfsattributes file of PATTERN TRANSFORM... lines, like .gitattributes, whose transforms rewrite matching files before upload, e.g. *.ipynb strip-outputs or *.sh eol=lf, and whose pin attribute keeps matching files in the disk cache (default: off)")
+	optimisticMkdir := fs.Bool("optimistic-mkdir", false, "answer mkdir from the request instead of stating each new directory, halving the round-trips of mkdir -p")
+	flushThreshold := fs.String("flush-threshold", "", "upload a file while it is being written each time this much more was written since its last upload, e.g. 256M, so close has less to send (default: off, upload on flush)")
+	maxWrite := fs.String("max-write", "", "largest read or write request the kernel sends, e.g. 1M, so many small writes reach wsfs as fewer large ones (default: 128K; Linux caps it at 1M)")
+	maxReadahead := fs.String("max-readahead", "", "cap on how far ahead the kernel reads on buffered reads, e.g. 64K; larger than the kernel offers has no effect (default: the kernel's)")
+	maxBackground := fs.Int("max-background", wsfsfuse.DefaultMaxBackground, "background requests (read-ahead, writes) the kernel keeps in flight before it queues more; the kernel throttles at 3/4 of it. Raise it for heavy parallel workloads")
+	flushRetries := fs.Int("flush-retries", wsfsfuse.DefaultFlushRetryAttempts, "background retries, with exponential backoff, of an upload that failed on flush before the file waits for the next flush (0 disables)")
+	bulkImportWorkers := fs.Int("bulk-import-workers", defaultBulkImportWorkers, "concurrent background uploads of small new files while many files are created at once, e.g. by tar or unzip (0 uploads each file on close)")
+	maxRemounts := fs.Int("max-remounts", defaultMaxRemounts, "how often --supervise may remount before wsfs gives up")
+	eventsSocket := fs.String("events-socket", "", "stream local changes as JSON lines to readers of this unix socket (default: off)")
+	backendName := fs.String("backend", backend.WorkspaceName, "storage backend as NAME[:ARG] (available: "+strings.Join(backend.Names(), ", ")+")")
+	var routeValues []string
+	fs.Func("backend-route", "serve a path prefix from another backend as /PREFIX=NAME[:ARG] (repeatable)", func(value string) error {
+		routeValues = append(routeValues, value)
+		return nil
+	})
+	var workspaceValues []string
+	fs.Func("workspace", "serve the workspace of a configuration profile as the top-level directory NAME, as NAME=PROFILE[,rate-limit=N] (repeatable; replaces the single workspace)", func(value string) error {
+		workspaceValues = append(workspaceValues, value)
+		return nil
+	})
 
 	if err := fs.Parse(args[1:]); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
@@ -127,7 +375,268 @@ func parseArgs(args []string) (cliConfig, error) {
 		debug:       *debug,
 		logLevel:    *logLevel,
 		allowOther:  *allowOther,
+		snapshot:    *snapshot,
 		remotePath:  *remotePath,
+		fsName:      *fsName,
+		volName:     *volName,
+
+		statfsTotalFiles: *statfsInodes,
+		caseInsensitive:  *caseInsensitive,
+
+		ideMode:              *ideMode,
+		staleWhileRevalidate: *staleWhileRevalidate,
+		metaTTL:              *metaTTL,
+		metaMaxEntries:       *metaMaxEntries,
+		validateListings:     *validateListings,
+		optimisticMkdir:      *optimisticMkdir,
+		cacheWritableOpens:   *cacheWritableOpens,
+		objectInfoFiles:      *objectInfoFiles,
+		warmRepos:            *warmRepos,
+		bulkImportWorkers:    *bulkImportWorkers,
+		maxBackground:        *maxBackground,
+		flushRetries:         *flushRetries,
+
+		transport: databricks.TransportConfig{
+			CABundle:            *caBundle,
+			InsecureSkipVerify:  *insecureSkipTLSVerify,
+			MaxIdleConnsPerHost: *maxIdleConnsPerHost,
+			DisableHTTP2:        *disableHTTP2,
+		},
+
+		controlSocket: *controlSocket,
+		recordFile:    *recordFile,
+
+		eventsWebhook: *eventsWebhook,
+		eventsSocket:  *eventsSocket,
+
+		rootRevalidateInterval: *rootRevalidateInterval,
+		tokenExpiryWarning:     *tokenExpiryWarning,
+
+		cacheAuditInterval: *cacheAuditInterval,
+		cacheAuditSample:   *cacheAuditSample,
+		cacheAuditHeal:     *cacheAuditHeal,
+		cacheGCInterval:    *cacheGCInterval,
+
+		autoCreateMountPoint: *autoCreateMountPoint,
+		recoverStaleMount:    *recoverStaleMount,
+
+		supervise:   *supervise,
+		maxRemounts: *maxRemounts,
+	}
+
+	if err := validateMountName(cfg.fsName); err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --fsname: %v", err)}
+	}
+	if cfg.volName != "" {
+		if err := validateMountName(cfg.volName); err != nil {
+			return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --volname: %v", err)}
+		}
+	}
+
+	statfsTotalBytes, err := parseByteSize(*statfsSize)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --statfs-size: %v", err)}
+	}
+	cfg.statfsTotalBytes = statfsTotalBytes
+
+	mask, err := parseMode(*umask)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --umask: %v", err)}
+	}
+	if cfg.fileMode, err = parseMode(*fileMode); err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --file-mode: %v", err)}
+	}
+	if cfg.dirMode, err = parseMode(*dirMode); err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --dir-mode: %v", err)}
+	}
+	cfg.fileMode &^= mask
+	cfg.dirMode &^= mask
+	if cfg.execMode, err = wsfsfuse.ParseExecMode(*execMode); err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --exec-mode: %v", err)}
+	}
+
+	cfg.baseLevel, cfg.moduleLevels, err = logging.ParseLevelSpec(*logLevel)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --log-level: %v", err)}
+	}
+
+	cfg.diskCacheExclude, err = filecache.ParseExcludePatterns(*diskCacheExclude)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --disk-cache-exclude: %v", err)}
+	}
+	if cfg.diskCacheQuotas, err = parseDiskCacheQuotas(*diskCacheQuota); err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --disk-cache-quota: %v", err)}
+	}
+	if cfg.diskCacheTTL, err = filecache.ParseTTLPolicy(*diskCacheTTLPolicy); err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --disk-cache-ttl-policy: %v", err)}
+	}
+	pinBytes, err := parseByteSize(*pinBudget)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --disk-cache-pin-budget: %v", err)}
+	}
+	cfg.pinBudget = int64(pinBytes)
+
+	switch strings.ToLower(*duMode) {
+	case "logical":
+	case "cached":
+		cfg.cachedBlocks = true
+	default:
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --du-mode: %q (want logical or cached)", *duMode)}
+	}
+
+	switch strings.ToLower(*unicodeNormalization) {
+	case "nfc":
+		cfg.normalizeUnicode = true
+	case "none":
+	default:
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --unicode-normalization: %q (want nfc or none)", *unicodeNormalization)}
+	}
+
+	cfg.notebookAliases, err = pathutil.ParseNotebookAliases(*notebookAliases)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --notebook-aliases: %v", err)}
+	}
+
+	cfg.transfer, err = parseSignedURLThreshold(*signedURLThreshold)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --signed-url-threshold: %v", err)}
+	}
+	notebookLimit, err := parseByteSize(*maxNotebookSize)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --max-notebook-size: %v", err)}
+	}
+	cfg.transfer.MaxNotebookSize = int64(notebookLimit)
+	threshold, err := parseByteSize(*flushThreshold)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --flush-threshold: %v", err)}
+	}
+	cfg.flushThreshold = int64(threshold)
+	writeSize, err := parseByteSize(*maxWrite)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --max-write: %v", err)}
+	}
+	if writeSize != 0 && (writeSize < minMaxWrite || writeSize > maxMaxWrite) {
+		return cfg, &cliError{exitCode: 2, msg: "invalid --max-write: must be between 4K and 1M"}
+	}
+	cfg.maxWrite = int(writeSize)
+	readahead, err := parseByteSize(*maxReadahead)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --max-readahead: %v", err)}
+	}
+	cfg.maxReadahead = int(readahead)
+
+	if *cacheAuditInterval < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --cache-audit-interval: %s is negative", *cacheAuditInterval)}
+	}
+	if *cacheGCInterval < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --cache-gc-interval: %s is negative", *cacheGCInterval)}
+	}
+	if *cacheAuditSample <= 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --cache-audit-sample: %d (want at least 1)", *cacheAuditSample)}
+	}
+	if *rootRevalidateInterval < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --root-revalidate-interval: %s is negative", *rootRevalidateInterval)}
+	}
+
+	if *metaTTL < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --meta-ttl: %s is negative", *metaTTL)}
+	}
+	if *metaMaxEntries < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --meta-max-entries: %d is negative", *metaMaxEntries)}
+	}
+	if *staleWhileRevalidate < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --stale-while-revalidate: %s is negative", *staleWhileRevalidate)}
+	}
+
+	if *maxRemounts < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --max-remounts: %d is negative", *maxRemounts)}
+	}
+
+	if *eventsWebhook != "" {
+		if err := events.CheckWebhookURL(*eventsWebhook); err != nil {
+			return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --events-webhook: %v", err)}
+		}
+	}
+
+	hideSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "hide" {
+			hideSet = true
+		}
+	})
+	if *ideMode && !hideSet {
+		cfg.hidePatterns = defaultIDEHidePatterns
+	} else if cfg.hidePatterns, err = filecache.ParseExcludePatterns(*hide); err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --hide: %v", err)}
+	}
+
+	if cfg.noCachePatterns, err = wsfsfuse.ParseNoCachePatterns(*noCachePaths); err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --no-cache-paths: %v", err)}
+	}
+	if cfg.localTempPatterns, err = filecache.ParseExcludePatterns(*localTemp); err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --local-temp: %v", err)}
+	}
+	if *attributesFile != "" {
+		if cfg.transforms, err = transform.Load(*attributesFile); err != nil {
+			return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --attributes-file: %v", err)}
+		}
+	}
+
+	cfg.allowUids, err = parseIDList(*allowUids, lookupUserID)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --allow-uids: %v", err)}
+	}
+	cfg.allowGids, err = parseIDList(*allowGids, lookupGroupID)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --allow-gids: %v", err)}
+	}
+	if (len(cfg.allowUids) > 0 || len(cfg.allowGids) > 0) && !cfg.allowOther {
+		return cfg, &cliError{exitCode: 2, msg: "--allow-uids and --allow-gids require --allow-other"}
+	}
+
+	if *tokenExpiryWarning < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --token-expiry-warning: %s is negative", *tokenExpiryWarning)}
+	}
+
+	if *flushRetries < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --flush-retries: %d is negative", *flushRetries)}
+	}
+	if *maxBackground < 1 || *maxBackground > math.MaxUint16 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --max-background: %d is not between 1 and %d", *maxBackground, math.MaxUint16)}
+	}
+	if *bulkImportWorkers < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --bulk-import-workers: %d is negative", *bulkImportWorkers)}
+	}
+
+	if *maxIdleConnsPerHost < 0 {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --max-idle-conns-per-host: %d is negative", *maxIdleConnsPerHost)}
+	}
+
+	cfg.backend, err = parseBackendSpec(*backendName)
+	if err != nil {
+		return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --backend: %v", err)}
+	}
+	for _, value := range routeValues {
+		route, err := parseBackendRoute(value)
+		if err != nil {
+			return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --backend-route: %v", err)}
+		}
+		cfg.backendRoutes = append(cfg.backendRoutes, route)
+	}
+	seen := make(map[string]bool, len(workspaceValues))
+	for _, value := range workspaceValues {
+		member, err := parseWorkspaceMember(value)
+		if err != nil {
+			return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --workspace: %v", err)}
+		}
+		if seen[member.name] {
+			return cfg, &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --workspace: /%s is given twice", member.name)}
+		}
+		seen[member.name] = true
+		cfg.workspaces = append(cfg.workspaces, member)
+	}
+	if len(cfg.workspaces) > 0 && (cfg.backend.name != backend.WorkspaceName || len(cfg.backendRoutes) > 0 || cfg.remotePath != "") {
+		return cfg, &cliError{exitCode: 2, msg: "--workspace cannot be combined with --backend, --backend-route or --remote-path"}
 	}
 
 	if fs.NArg() > 0 {
@@ -141,44 +650,339 @@ func parseArgs(args []string) (cliConfig, error) {
 	return cfg, nil
 }
 
+// parseSignedURLThreshold parses a size or "auto". "auto" keeps the default
+// threshold for the first transfers and then adapts.
+func parseSignedURLThreshold(value string) (databricks.TransferConfig, error) {
+	if strings.EqualFold(strings.TrimSpace(value), "auto") {
+		return databricks.TransferConfig{Adaptive: true}, nil
+	}
+	threshold, err := parseByteSize(value)
+	if err != nil {
+		return databricks.TransferConfig{}, err
+	}
+	if value != "" && threshold == 0 {
+		return databricks.TransferConfig{}, fmt.Errorf("threshold must be positive")
+	}
+	return databricks.TransferConfig{SignedURLThreshold: int64(threshold)}, nil
+}
+
+// parseMode parses octal permission bits such as 0644.
+func parseMode(value string) (uint32, error) {
+	mode, err := strconv.ParseUint(strings.TrimSpace(value), 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an octal mode", value)
+	}
+	if mode > 0777 {
+		return 0, fmt.Errorf("%q has bits outside 0777", value)
+	}
+	return uint32(mode), nil
+}
+
+// parseIDList parses a comma-separated list of numeric IDs and names,
+// resolving names with lookup.
+func parseIDList(value string, lookup func(name string) (string, error)) ([]uint32, error) {
+	var ids []uint32
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			resolved, lookupErr := lookup(field)
+			if lookupErr != nil {
+				return nil, lookupErr
+			}
+			if id, err = strconv.ParseUint(resolved, 10, 32); err != nil {
+				return nil, fmt.Errorf("%s has ID %q: %w", field, resolved, err)
+			}
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, nil
+}
+
+func lookupUserID(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+func lookupGroupID(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
+
 func validateConfig(cfg cliConfig) error {
 	return nil
 }
 
-func buildNodeConfig(ownerUid uint32, ownerGid uint32, allowOther bool) *wsfsfuse.NodeConfig {
+// kernelTTLs returns the attribute, entry and negative entry timeouts
+// handed to the kernel. In IDE mode they follow the metadata cache TTLs, so
+// stat and a directory listing pick up a remote change at the same time.
+func (cfg cliConfig) kernelTTLs() (attr, entry, negative time.Duration) {
+	if cfg.ideMode {
+		return ideMetadataTTL, ideMetadataTTL, ideNegativeTTL
+	}
+	return defaultAttrTTL, defaultEntryTTL, defaultNegativeTTL
+}
+
+// cacheConfig returns the TTLs and size of the workspace client's metadata
+// cache. A --meta-ttl shorter than the negative TTL shortens that too, so
+// a missing path is never cached longer than an existing one.
+func (cfg cliConfig) cacheConfig() databricks.CacheConfig {
+	cacheCfg := databricks.CacheConfig{MetadataTTL: defaultMetadataTTL, NegativeTTL: defaultNegativeTTL}
+	if cfg.ideMode {
+		cacheCfg = databricks.CacheConfig{MetadataTTL: ideMetadataTTL, NegativeTTL: ideNegativeTTL}
+	}
+	if cfg.metaTTL > 0 {
+		cacheCfg.MetadataTTL = cfg.metaTTL
+		cacheCfg.NegativeTTL = min(cacheCfg.NegativeTTL, cfg.metaTTL)
+	}
+	cacheCfg.MaxEntries = cfg.metaMaxEntries
+	cacheCfg.ValidateListings = cfg.validateListings
+	cacheCfg.StaleWhileRevalidate = cfg.staleWhileRevalidate
+	return cacheCfg
+}
+
+func buildNodeConfig(ownerUid uint32, ownerGid uint32, cfg cliConfig) *wsfsfuse.NodeConfig {
+	attrTTL, entryTTL, _ := cfg.kernelTTLs()
 	return &wsfsfuse.NodeConfig{
-		OwnerUid:       ownerUid,
-		OwnerGid:       ownerGid,
-		RestrictAccess: !allowOther,
-		AttrTTL:        defaultAttrTTL,
-		EntryTTL:       defaultEntryTTL,
+		OwnerUid:         ownerUid,
+		OwnerGid:         ownerGid,
+		RestrictAccess:   !cfg.allowOther,
+		AllowedUids:      cfg.allowUids,
+		AllowedGids:      cfg.allowGids,
+		AttrTTL:          attrTTL,
+		EntryTTL:         entryTTL,
+		StatfsTotalBytes: cfg.statfsTotalBytes,
+		StatfsTotalFiles: cfg.statfsTotalFiles,
+		FileMode:         cfg.fileMode,
+		DirMode:          cfg.dirMode,
+		ExecMode:         cfg.execMode,
+		CachedBlocks:     cfg.cachedBlocks,
+		CaseInsensitive:  cfg.caseInsensitive,
+		NormalizeUnicode: cfg.normalizeUnicode,
+		NotebookAliases:  cfg.notebookAliases,
+
+		OptimisticMkdir:    cfg.optimisticMkdir,
+		CacheWritableOpens: cfg.cacheWritableOpens,
+		ObjectInfoFiles:    cfg.objectInfoFiles,
+		WarmRepos:          cfg.warmRepos,
+		HidePatterns:       cfg.hidePatterns,
+		LocalTempPatterns:  cfg.localTempPatterns,
+		NoCachePatterns:    cfg.noCachePatterns,
+		BulkImportWorkers:  cfg.bulkImportWorkers,
+		FlushThreshold:     cfg.flushThreshold,
+		Transforms:         cfg.transforms,
+	}
+}
+
+// openInodeIndex loads the inode numbers kept from earlier mounts of the
+// same workspace path. They live in the cache directory, one file per
+// workspace, backend and remote path, or set of --workspace members. A
+// disabled disk cache keeps them for this mount only.
+func openInodeIndex(cacheDir string, target workspaceTarget, cfg cliConfig, rootPath string) *wsfsfuse.InodeIndex {
+	if cacheDir == "" {
+		return nil
+	}
+	key := target.host + "\x00" + cfg.backend.String() + "\x00" + rootPath
+	for _, member := range cfg.workspaces {
+		key += "\x00" + member.name + "=" + member.profile
+	}
+	sum := sha256.Sum256([]byte(key))
+	indexPath := filepath.Join(cacheDir, "inodes", hex.EncodeToString(sum[:8])+".json")
+	inodes, err := wsfsfuse.OpenInodeIndex(indexPath)
+	if err != nil {
+		logging.Warnf("Failed to load inode numbers from %s, starting fresh: %v", indexPath, err)
 	}
+	return inodes
 }
 
-func buildMountOptions(allowOther bool, debug bool) *fs.Options {
-	attrTimeout := defaultAttrTTL
-	entryTimeout := defaultEntryTTL
-	negativeTimeout := defaultNegativeTTL
+// saveInodeIndex keeps the inode numbers of this mount for the next one.
+func saveInodeIndex(inodes *wsfsfuse.InodeIndex) {
+	if inodes == nil {
+		return
+	}
+	if err := inodes.Save(); err != nil {
+		logging.Warnf("Failed to save inode numbers: %v", err)
+	}
+}
+
+// attributePinRule pins the workspace paths below rootPath that a pin
+// directive of the attributes file matches. Its patterns are relative to
+// the mount root.
+func attributePinRule(set *transform.Set, rootPath string) func(string) bool {
+	return func(remotePath string) bool {
+		mountPath := remotePath
+		if rootPath != "/" {
+			if remotePath != rootPath && !strings.HasPrefix(remotePath, rootPath+"/") {
+				return false
+			}
+			mountPath = "/" + strings.TrimPrefix(strings.TrimPrefix(remotePath, rootPath), "/")
+		}
+		return set.Pinned(mountPath)
+	}
+}
+
+// saveDiskCacheIndex keeps the disk cache entries for the next mount.
+func saveDiskCacheIndex(cache *filecache.DiskCache) {
+	if err := cache.SaveIndex(); err != nil {
+		logging.Warnf("Failed to save the disk cache index: %v", err)
+	}
+}
+
+// watchDiskCache reconciles the disk cache with its index every interval
+// until ctx is done, so files left by failed writes do not pile up and a
+// crash loses at most one interval of cached content.
+func watchDiskCache(ctx context.Context, cache *filecache.DiskCache, interval time.Duration) {
+	if interval <= 0 || cache.IsDisabled() {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		result, err := cache.Reconcile()
+		if err != nil {
+			logging.Warnf("Disk cache reconciliation failed: %v", err)
+		}
+		if !result.Empty() {
+			logging.Infof("Disk cache reconciliation %s", result)
+		}
+	}
+}
+
+// buildEventBus starts publishing local changes to the configured webhook
+// and socket. It returns nil when neither is set.
+func buildEventBus(cfg cliConfig) (*events.Bus, error) {
+	var sinks []events.Sink
+	if cfg.eventsWebhook != "" {
+		sink, err := events.NewWebhookSink(cfg.eventsWebhook)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.eventsSocket != "" {
+		sink, err := events.ListenSocket(cfg.eventsSocket)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+		logging.Infof("Streaming change events on %s", cfg.eventsSocket)
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return events.NewBus(sinks...), nil
+}
+
+func buildMountOptions(cfg cliConfig) *fs.Options {
+	attrTimeout, entryTimeout, negativeTimeout := cfg.kernelTTLs()
 
 	opts := &fs.Options{
 		AttrTimeout:     &attrTimeout,
 		EntryTimeout:    &entryTimeout,
 		NegativeTimeout: &negativeTimeout,
 		MountOptions: fuse.MountOptions{
-			AllowOther: allowOther,
-			Name:       "wsfs",
-			FsName:     "wsfs",
+			AllowOther:    cfg.allowOther,
+			Name:          wsfsMountType,
+			FsName:        cfg.mountFsName(),
+			MaxWrite:      cfg.maxWrite,
+			MaxReadAhead:  cfg.maxReadahead,
+			MaxBackground: cfg.maxBackground,
 		},
 	}
-	opts.Debug = debug
+	if cfg.snapshot {
+		opts.MountOptions.Options = append(opts.MountOptions.Options, "ro")
+	}
+	if runtime.GOOS == "darwin" {
+		// macFUSE labels the volume in Finder with volname, not fsname.
+		opts.MountOptions.Options = append(opts.MountOptions.Options, "volname="+cfg.volumeName())
+	}
+	opts.Debug = cfg.debug
 	return opts
 }
 
+// defaultFsName is the source of a mount without --fsname. The type stays
+// fuse.wsfs whatever the name.
+const defaultFsName = "wsfs"
+
+// wsfsMountType is the FUSE subtype of every wsfs mount, which mountinfo
+// lists as the filesystem type fuse.wsfs.
+const wsfsMountType = "wsfs"
+
+// validateMountName checks a --fsname or --volname value. The kernel and
+// mount tools escape spaces and commas, but not control characters.
+func validateMountName(name string) error {
+	if name == "" {
+		return errors.New("must not be empty")
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%q contains a control character", name)
+		}
+	}
+	return nil
+}
+
+func (cfg cliConfig) mountFsName() string {
+	if cfg.fsName == "" {
+		return defaultFsName
+	}
+	return cfg.fsName
+}
+
+func (cfg cliConfig) volumeName() string {
+	if cfg.volName == "" {
+		return cfg.mountFsName()
+	}
+	return cfg.volName
+}
+
 func versionString() string {
 	return fmt.Sprintf("wsfs %s (commit: %s, built: %s)\n", version, commit, date)
 }
 
 func run(args []string, deps runDeps) error {
+	if len(args) > 1 && args[1] == "resolve" {
+		return runResolve(args[0], args[2:], deps.stdout)
+	}
+	if len(args) > 1 && args[1] == "umount" {
+		return runUmount(args[0], args[2:], deps.stdout)
+	}
+	if len(args) > 1 && args[1] == "reauth" {
+		return runReauth(args[0], args[2:], deps.stdout)
+	}
+	if len(args) > 1 && args[1] == "grep" {
+		return runGrep(args[0], args[2:], deps.stdout)
+	}
+	if len(args) > 1 && args[1] == "cache" {
+		return runCache(args[0], args[2:], deps.stdout)
+	}
+	if len(args) > 1 && args[1] == "tree" {
+		return runTree(args[0], args[2:], deps.stdout)
+	}
+	if len(args) > 1 && args[1] == "diff" {
+		return runDiff(args[0], args[2:], deps)
+	}
+	if len(args) > 1 && args[1] == "replay" {
+		return runReplay(args[0], args[2:], deps.stdout)
+	}
+	if len(args) > 1 && args[1] == "bench" {
+		return runBench(args[0], args[2:], deps.stdout)
+	}
+
 	cfg, err := parseArgs(args)
 	if err != nil {
 		return err
@@ -192,38 +996,119 @@ func run(args []string, deps runDeps) error {
 	// Set log level (--debug takes precedence for backward compatibility)
 	if cfg.debug {
 		logging.SetLevel(logging.LevelDebug)
+		logging.SetModuleLevels(nil)
 	} else {
-		logging.SetLevel(logging.ParseLevel(cfg.logLevel))
+		logging.SetLevel(cfg.baseLevel)
+		logging.SetModuleLevels(cfg.moduleLevels)
 	}
 
 	if err := validateConfig(cfg); err != nil {
 		return err
 	}
 
-	// Set up Databricks client
-	w, err := deps.initWorkspace()
+	faults, err := deps.faultInjector()
 	if err != nil {
-		return fmt.Errorf("Failed to create Databricks client: %w", err)
+		return &cliError{exitCode: 2, msg: err.Error()}
 	}
-
-	displayName, err := deps.workspaceMe(context.Background(), w)
+	// One pooled transport carries both SDK calls and signed URL transfers.
+	if cfg.transport.InsecureSkipVerify {
+		logging.Warnf("TLS certificate verification is DISABLED (--insecure-skip-tls-verify); traffic to Databricks and cloud storage can be intercepted")
+	}
+	var transport http.RoundTripper
+	transport, err = databricks.NewHTTPTransport(cfg.transport)
 	if err != nil {
-		return fmt.Errorf("Failed to get current user: %w", err)
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --ca-bundle: %v", err)}
+	}
+	if faults != nil {
+		logging.Warnf("Fault injection enabled (%s)", faults.Config())
+		transport = faultinject.NewTransport(transport, faults)
+	}
+
+	// Fail before talking to the workspace when the mount cannot succeed.
+	if err := deps.preflight(cfg.mountPoint, cfg.autoCreateMountPoint); err != nil {
+		return err
+	}
+	if err := recoverStaleMount(cfg, deps); err != nil {
+		return err
+	}
+
+	rootPath := cfg.remotePath
+	if rootPath == "" {
+		rootPath = "/"
+	}
+
+	// Set up Databricks client unless every backend is local
+	var w *databrickssdk.WorkspaceClient
+	var auth *workspaceAuth
+	var members []memberWorkspace
+	if len(cfg.workspaces) > 0 {
+		members, err = connectWorkspaces(cfg, transport, deps)
+		if err != nil {
+			return err
+		}
+	} else if cfg.needsWorkspace() {
+		w, err = deps.initWorkspace(transport)
+		if err != nil {
+			return withMountHint("Failed to create Databricks client", err, workspaceTarget{}, rootPath)
+		}
+		if w != nil && w.Config != nil {
+			// Authenticate through workspaceAuth so `wsfs reauth` can
+			// swap in new credentials.
+			auth = newWorkspaceAuth(w, func() (*databrickssdk.WorkspaceClient, error) {
+				return deps.initWorkspace(transport)
+			}, deps.workspaceMe)
+		}
+
+		displayName, err := deps.workspaceMe(context.Background(), w)
+		if err != nil {
+			return withMountHint("Failed to get current user", err, targetOf(w), rootPath)
+		}
+		logging.Infof("Hello, %s! Mounting your Databricks workspace...", displayName)
+	} else {
+		logging.Infof("Mounting %s backend...", cfg.backend)
 	}
-	logging.Infof("Hello, %s! Mounting your Databricks workspace...", displayName)
 
 	// Set up disk cache
 	diskCache, err := deps.newDiskCache()
 	if err != nil {
 		return fmt.Errorf("Failed to create disk cache: %w", err)
 	}
+	if err := diskCache.SetExcludePatterns(cfg.diskCacheExclude); err != nil {
+		return fmt.Errorf("Failed to configure disk cache: %w", err)
+	}
+	if err := diskCache.SetQuotas(cfg.diskCacheQuotas); err != nil {
+		return fmt.Errorf("Failed to configure disk cache: %w", err)
+	}
+	diskCache.SetTTLPolicy(cfg.diskCacheTTL)
+	if err := diskCache.SetPinBudget(cfg.pinBudget); err != nil {
+		return fmt.Errorf("Failed to configure disk cache: %w", err)
+	}
+	if cfg.transforms.HasPins() {
+		diskCache.SetPinRule(attributePinRule(cfg.transforms, rootPath))
+	}
 	logging.Debugf("Disk cache enabled: dir=%s", diskCache.CacheDir())
+	// Saved last, after the final flushes have cached what they uploaded.
+	defer saveDiskCacheIndex(diskCache)
 
-	// Set up Databricks FS client
-	wfclient, err := deps.newWorkspaceFilesClient(w)
+	// Set up the storage backend (Databricks workspace files by default)
+	var wfclient databricks.WorkspaceFilesAPI
+	if members != nil {
+		wfclient, err = buildFederation(cfg, members, deps)
+	} else {
+		wfclient, err = buildBackend(cfg, w, faults, deps)
+	}
 	if err != nil {
 		return fmt.Errorf("Failed to create Databricks Workspace Files Client: %w", err)
 	}
+	// Drop cached metadata once unmounted.
+	defer backend.Close(wfclient)
+	rec, err := openRecording(cfg.recordFile)
+	if err != nil {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --record: %v", err)}
+	}
+	// Closed after unmount, so calls still unfinished then are in the trace.
+	defer closeRecording(rec, cfg.recordFile)
+	wfclient = backend.WithRecorder(wfclient, rec)
 
 	// Create dirty node registry for graceful shutdown
 	registry := wsfsfuse.NewDirtyNodeRegistry()
@@ -244,68 +1129,140 @@ func run(args []string, deps runDeps) error {
 
 	// Create node config for access control.
 	// Without --allow-other only the mount owner can access the filesystem.
-	nodeConfig := buildNodeConfig(uint32(ownerUid), uint32(ownerGid), cfg.allowOther)
-	if cfg.allowOther {
+	nodeConfig := buildNodeConfig(uint32(ownerUid), uint32(ownerGid), cfg)
+	bus, err := buildEventBus(cfg)
+	if err != nil {
+		return fmt.Errorf("Failed to set up change events: %w", err)
+	}
+	// Deliver what is still queued after the last flush at unmount.
+	defer bus.Close()
+	nodeConfig.Events = bus
+	if !diskCache.IsDisabled() {
+		nodeConfig.Inodes = openInodeIndex(diskCache.CacheDir(), targetOf(w), cfg, rootPath)
+		defer saveInodeIndex(nodeConfig.Inodes)
+	}
+	if cfg.allowOther && (len(cfg.allowUids) > 0 || len(cfg.allowGids) > 0) {
+		logging.Infof("allow-other enabled: only UID %d, UIDs %v and members of GIDs %v can access the mount", ownerUid, cfg.allowUids, cfg.allowGids)
+	} else if cfg.allowOther {
 		logging.Infof("allow-other enabled: all local users can access the mount")
 	} else {
 		logging.Debugf("Access control enabled: only UID %d can access the mount", ownerUid)
 	}
+	if cfg.snapshot {
+		logging.Infof("Snapshot mode: read-only, each path is pinned to its first access")
+	}
 
 	// Set up Root node
-	rootPath := cfg.remotePath
-	if rootPath == "" {
-		rootPath = "/"
-	}
+	target := targetOf(w)
 	root, err := deps.newRootNode(wfclient, diskCache, rootPath, registry, nodeConfig)
 	if err != nil {
-		return fmt.Errorf("Failed to create root node: %w", err)
+		return withMountHint("Failed to create root node", err, target, rootPath)
 	}
 
 	// Mount filesystem
-	opts := buildMountOptions(cfg.allowOther, cfg.debug)
-	server, err := deps.mount(cfg.mountPoint, root, opts)
+	opts := buildMountOptions(cfg)
+	server, err := deps.mount(cfg.mountPoint, root, opts, rec)
 	if err != nil {
 		return fmt.Errorf("Mount fail: %w", err)
 	}
 	logging.Infof("Mounted Databricks workspace on %s", cfg.mountPoint)
 	logging.Infof("Press Ctrl+C to unmount")
+	supervisor := newMountSupervisor(server)
 
-	// Signal handling for graceful shutdown
-	ctx, stop := deps.signalContext()
-	defer stop()
+	// Signal handling for graceful shutdown. The control API's unmount
+	// endpoint goes through the same flush-then-unmount path.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Retry failed uploads in the background until wsfs exits.
+	retryConfig := wsfsfuse.DefaultFlushRetryConfig()
+	retryConfig.Attempts = cfg.flushRetries
+	registry.StartFlushRetries(ctx, retryConfig)
+	go watchDiskCache(ctx, diskCache, cfg.cacheGCInterval)
+	unmountRequests := make(chan bool)
+	requestUnmount := func(force bool) {
+		select {
+		case unmountRequests <- force:
+		case <-ctx.Done():
+		}
+	}
 
-	var unmountOnce sync.Once
-	unmount := func() {
-		unmountOnce.Do(func() {
-			if err := server.Unmount(); err != nil {
-				log.Printf("Unmount error: %v", err)
+	current := &currentMount{root: root, auth: auth}
+	if cfg.controlSocket != "" {
+		control, err := controlapi.Listen(cfg.controlSocket, current, requestUnmount)
+		if err != nil {
+			unmountErr := server.Unmount()
+			if unmountErr != nil {
+				log.Printf("Unmount error: %v", unmountErr)
 			}
-		})
+			return fmt.Errorf("Failed to start control API: %w", err)
+		}
+		defer control.Close()
+		logging.Infof("Control API listening on %s", cfg.controlSocket)
 	}
 
-	// Wait for signal in goroutine
-	go func() {
-		<-ctx.Done()
-		log.Println("Shutdown signal received, flushing dirty buffers...")
+	// Re-check the root in the background so an expired token or revoked
+	// access shows up in the log, not only as EACCES in some later command.
+	reportRoot := func(err error) {
+		if err == nil {
+			logging.Infof("Mount root %s is reachable again", rootPath)
+			return
+		}
+		if hint := mountFailureHint(err, target, rootPath); hint != "" {
+			logging.Errorf("Mount root %s is unreachable: %v (%s)", rootPath, err, hint)
+			return
+		}
+		logging.Errorf("Mount root %s is unreachable: %v", rootPath, err)
+	}
 
-		// Flush all dirty buffers with timeout
-		flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-		defer cancel()
+	if auth != nil {
+		go watchTokenExpiry(ctx, auth, tokenCheckInterval, cfg.tokenExpiryWarning, reauthHint(target, cfg.controlSocket))
+	}
+	for _, member := range members {
+		if member.auth != nil {
+			go watchTokenExpiry(ctx, member.auth, tokenCheckInterval, cfg.tokenExpiryWarning, fmt.Sprintf("run `%s` and remount", targetOf(member.client).loginCommand()))
+		}
+	}
 
-		flushed, errors := registry.FlushAll(flushCtx)
-		if len(errors) > 0 {
-			for _, err := range errors {
-				log.Printf("Flush error: %v", err)
-			}
+	// Wait for a signal or an unmount request in goroutine
+	go watchShutdown(ctx, deps.signalContext, unmountRequests, registry, supervisor.unmount)
+
+	newRoot := func() (*wsfsfuse.WSNode, error) {
+		return deps.newRootNode(wfclient, diskCache, rootPath, registry, nodeConfig)
+	}
+	remounts := 0
+	for {
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		go root.WatchRoot(watchCtx, cfg.rootRevalidateInterval, reportRoot)
+		go root.WatchCache(watchCtx, cfg.cacheAuditInterval, cfg.cacheAuditSample, cfg.cacheAuditHeal)
+		stopped := supervisor.wait()
+		stopWatch()
+		if stopped || !cfg.supervise {
+			return nil
 		}
-		if flushed > 0 {
-			log.Printf("Flushed %d dirty buffer(s)", flushed)
+		if !connectionLost(deps.statMountPoint(cfg.mountPoint)) {
+			logging.Infof("%s was unmounted outside wsfs", cfg.mountPoint)
+			return nil
 		}
 
-		// Unmount filesystem
-		unmount()
-	}()
-
-	server.Wait()
-	return nil
+		for {
+			if remounts >= cfg.maxRemounts {
+				return fmt.Errorf("FUSE connection to %s lost; gave up after %d remount(s)", cfg.mountPoint, remounts)
+			}
+			remounts++
+			logging.Errorf("FUSE connection to %s lost; remounting (attempt %d of %d)", cfg.mountPoint, remounts, cfg.maxRemounts)
+			select {
+			case <-time.After(remountBackoff(deps.remountBackoff, remounts)):
+			case <-supervisor.stopped:
+				return nil
+			}
+			root, server, err = remount(cfg.mountPoint, deps, registry, newRoot, opts, rec)
+			if err == nil {
+				break
+			}
+			logging.Errorf("Remount of %s failed: %v", cfg.mountPoint, err)
+		}
+		current.set(root)
+		supervisor.replace(server)
+		logging.Infof("Remounted Databricks workspace on %s", cfg.mountPoint)
+	}
 }
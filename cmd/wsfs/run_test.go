@@ -7,7 +7,12 @@ import (
 	"fmt"
 	"io"
 	iofs "io/fs"
+	"net"
+	"net/http"
+	"os"
 	"os/user"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -19,8 +24,13 @@ import (
 	"github.com/hanwen/go-fuse/v2/fs"
 
 	"wsfs/internal/databricks"
+	"wsfs/internal/faultinject"
 	"wsfs/internal/filecache"
 	wsfsfuse "wsfs/internal/fuse"
+	"wsfs/internal/logging"
+	"wsfs/internal/pathutil"
+	"wsfs/internal/record"
+	"wsfs/internal/transform"
 )
 
 type fakeServer struct {
@@ -92,6 +102,14 @@ func (f *fakeWorkspaceFilesClient) CacheInvalidate(filePath string) {}
 
 func (f *fakeWorkspaceFilesClient) MetadataTTL() time.Duration { return time.Second }
 
+// testDeps returns the default dependencies without the mount point and
+// FUSE device checks, which the fake mount points of these tests fail.
+func testDeps() runDeps {
+	deps := defaultDeps()
+	deps.preflight = func(string, bool) error { return nil }
+	return deps
+}
+
 func TestParseArgsDefaultsAndMountpoint(t *testing.T) {
 	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
 	if err != nil {
@@ -121,6 +139,119 @@ func TestParseArgsOverrides(t *testing.T) {
 	}
 }
 
+func TestParseArgsModuleLogLevels(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "--log-level=warn,fuse=debug,databricks=info", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	want := map[string]logging.LogLevel{"fuse": logging.LevelDebug, "databricks": logging.LevelInfo}
+	if cfg.baseLevel != logging.LevelWarn || !reflect.DeepEqual(cfg.moduleLevels, want) {
+		t.Fatalf("levels = %v %v", cfg.baseLevel, cfg.moduleLevels)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--log-level=fuse=loud", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 || !strings.Contains(cliErr.msg, "--log-level") {
+		t.Fatalf("expected exit code 2 for an unknown level, got %v", err)
+	}
+}
+
+func TestParseArgsDiskCacheExclude(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.diskCacheExclude, filecache.DefaultExcludePatterns) {
+		t.Fatalf("default diskCacheExclude = %q", cfg.diskCacheExclude)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--disk-cache-exclude=*.secret, vault*", "/mnt/wsfs"})
+	if err != nil || !reflect.DeepEqual(cfg.diskCacheExclude, []string{"*.secret", "vault*"}) {
+		t.Fatalf("diskCacheExclude = %q, %v", cfg.diskCacheExclude, err)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--disk-cache-exclude=", "/mnt/wsfs"})
+	if err != nil || len(cfg.diskCacheExclude) != 0 {
+		t.Fatalf("empty --disk-cache-exclude = %q, %v; want no patterns", cfg.diskCacheExclude, err)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--disk-cache-exclude=[a-", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 || !strings.Contains(cliErr.msg, "--disk-cache-exclude") {
+		t.Fatalf("expected exit code 2 for a bad pattern, got %v", err)
+	}
+}
+
+func TestParseArgsDiskCacheQuota(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "--disk-cache-quota=/Users/me/big-data/=2G, /Shared/raw=512M", "/mnt/wsfs"})
+	want := []filecache.Quota{{Prefix: "/Users/me/big-data", MaxBytes: 2 << 30}, {Prefix: "/Shared/raw", MaxBytes: 512 << 20}}
+	if err != nil || !reflect.DeepEqual(cfg.diskCacheQuotas, want) {
+		t.Fatalf("diskCacheQuotas = %+v, %v", cfg.diskCacheQuotas, err)
+	}
+
+	for _, value := range []string{"/data", "data=1G", "/data=0", "/data=lots"} {
+		_, err = parseArgs([]string{"wsfs", "--disk-cache-quota=" + value, "/mnt/wsfs"})
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 || !strings.Contains(cliErr.msg, "--disk-cache-quota") {
+			t.Errorf("%q: expected exit code 2, got %v", value, err)
+		}
+	}
+}
+
+func TestParseArgsPinBudget(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil || cfg.pinBudget != 0 {
+		t.Fatalf("default pinBudget = %d, %v", cfg.pinBudget, err)
+	}
+	cfg, err = parseArgs([]string{"wsfs", "--disk-cache-pin-budget=4G", "/mnt/wsfs"})
+	if err != nil || cfg.pinBudget != 4<<30 {
+		t.Fatalf("pinBudget = %d, %v", cfg.pinBudget, err)
+	}
+	_, err = parseArgs([]string{"wsfs", "--disk-cache-pin-budget=lots", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for a bad size, got %v", err)
+	}
+}
+
+func TestParseArgsDiskCacheTTLPolicy(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil || cfg.diskCacheTTL != filecache.TTLIdle {
+		t.Fatalf("default = %v, %v", cfg.diskCacheTTL, err)
+	}
+	cfg, err = parseArgs([]string{"wsfs", "--disk-cache-ttl-policy=absolute", "/mnt/wsfs"})
+	if err != nil || cfg.diskCacheTTL != filecache.TTLAbsolute {
+		t.Fatalf("diskCacheTTL = %v, %v", cfg.diskCacheTTL, err)
+	}
+	_, err = parseArgs([]string{"wsfs", "--disk-cache-ttl-policy=sliding", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for an unknown policy, got %v", err)
+	}
+}
+
+func TestAttributePinRule(t *testing.T) {
+	set, err := transform.Parse(strings.NewReader("/libs pin\n*.whl pin\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	rule := attributePinRule(set, "/Users/me")
+	for remotePath, want := range map[string]bool{
+		"/Users/me/libs/big.so":  true,
+		"/Users/me/dist/pkg.whl": true,
+		"/Users/me/src/main.py":  false,
+		"/Users/meta/libs/a.so":  false,
+		"/Shared/pkg.whl":        false,
+	} {
+		if got := rule(remotePath); got != want {
+			t.Errorf("rule(%q) = %v, want %v", remotePath, got, want)
+		}
+	}
+	if !attributePinRule(set, "/")("/libs/big.so") {
+		t.Error("rule at the workspace root missed /libs/big.so")
+	}
+}
+
 func TestParseArgsMissingMountpoint(t *testing.T) {
 	_, err := parseArgs([]string{"wsfs"})
 	if err == nil {
@@ -152,14 +283,707 @@ func TestVersionString(t *testing.T) {
 }
 
 func TestBuildNodeConfig(t *testing.T) {
-	cfg := buildNodeConfig(42, 24, true)
+	cfg := buildNodeConfig(42, 24, cliConfig{allowOther: true})
 	if cfg.OwnerUid != 42 || cfg.OwnerGid != 24 || cfg.RestrictAccess || cfg.AttrTTL != defaultAttrTTL || cfg.EntryTTL != defaultEntryTTL {
 		t.Fatalf("unexpected node config: %+v", cfg)
 	}
 }
 
+func TestParseArgsStatfsTotals(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "--statfs-size=500G", "--statfs-inodes=1000", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.statfsTotalBytes != 500<<30 || cfg.statfsTotalFiles != 1000 {
+		t.Fatalf("unexpected statfs totals: %+v", cfg)
+	}
+
+	nodeCfg := buildNodeConfig(1, 1, cfg)
+	if nodeCfg.StatfsTotalBytes != 500<<30 || nodeCfg.StatfsTotalFiles != 1000 {
+		t.Fatalf("statfs totals not propagated: %+v", nodeCfg)
+	}
+}
+
+func TestParseArgsCaseInsensitive(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if buildNodeConfig(1, 1, cfg).CaseInsensitive {
+		t.Fatal("expected a case-sensitive view by default")
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--case-insensitive", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if !buildNodeConfig(1, 1, cfg).CaseInsensitive {
+		t.Fatal("--case-insensitive not propagated to the node config")
+	}
+}
+
+func TestParseArgsOptimisticMkdir(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if buildNodeConfig(1, 1, cfg).OptimisticMkdir {
+		t.Fatal("expected mkdir to stat new directories by default")
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--optimistic-mkdir", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if !buildNodeConfig(1, 1, cfg).OptimisticMkdir {
+		t.Fatal("--optimistic-mkdir not propagated to the node config")
+	}
+}
+
+func TestParseArgsIDEMode(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if len(cfg.hidePatterns) != 0 || cfg.cacheConfig().MetadataTTL != defaultMetadataTTL {
+		t.Fatalf("defaults = %v %v", cfg.hidePatterns, cfg.cacheConfig())
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--ide-mode", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	nodeCfg := buildNodeConfig(1, 1, cfg)
+	if !reflect.DeepEqual(nodeCfg.HidePatterns, defaultIDEHidePatterns) {
+		t.Fatalf("hide patterns = %v, want the IDE defaults", nodeCfg.HidePatterns)
+	}
+	if nodeCfg.AttrTTL != ideMetadataTTL || nodeCfg.EntryTTL != ideMetadataTTL {
+		t.Fatalf("node TTLs = %s %s", nodeCfg.AttrTTL, nodeCfg.EntryTTL)
+	}
+	opts := buildMountOptions(cfg)
+	if *opts.AttrTimeout != ideMetadataTTL || *opts.EntryTimeout != ideMetadataTTL || *opts.NegativeTimeout != ideNegativeTTL {
+		t.Fatalf("kernel TTLs = %s %s %s", *opts.AttrTimeout, *opts.EntryTimeout, *opts.NegativeTimeout)
+	}
+	if got := cfg.cacheConfig(); got.MetadataTTL != ideMetadataTTL || got.NegativeTTL != ideNegativeTTL {
+		t.Fatalf("metadata cache TTLs = %+v", got)
+	}
+
+	// An explicit --hide replaces the IDE defaults, even when empty.
+	cfg, err = parseArgs([]string{"wsfs", "--ide-mode", "--hide=", "/mnt/wsfs"})
+	if err != nil || len(cfg.hidePatterns) != 0 {
+		t.Fatalf("--ide-mode --hide= = %v, %v", cfg.hidePatterns, err)
+	}
+	cfg, err = parseArgs([]string{"wsfs", "--hide=*.tmp, .idea", "/mnt/wsfs"})
+	if err != nil || !reflect.DeepEqual(cfg.hidePatterns, []string{"*.tmp", ".idea"}) {
+		t.Fatalf("--hide = %v, %v", cfg.hidePatterns, err)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--hide=build/*", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for a --hide pattern with a slash, got %v", err)
+	}
+}
+
+func TestParseArgsLocalTemp(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if got := buildNodeConfig(1, 1, cfg).LocalTempPatterns; !reflect.DeepEqual(got, defaultLocalTempPatterns) {
+		t.Fatalf("local temp patterns = %v, want the defaults", got)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--local-temp=", "/mnt/wsfs"})
+	if err != nil || len(cfg.localTempPatterns) != 0 {
+		t.Fatalf("--local-temp= = %v, %v", cfg.localTempPatterns, err)
+	}
+	cfg, err = parseArgs([]string{"wsfs", "--local-temp=*.swx, ~*.tmp", "/mnt/wsfs"})
+	if err != nil || !reflect.DeepEqual(cfg.localTempPatterns, []string{"*.swx", "~*.tmp"}) {
+		t.Fatalf("--local-temp = %v, %v", cfg.localTempPatterns, err)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--local-temp=[", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for a malformed --local-temp pattern, got %v", err)
+	}
+}
+
+func TestParseArgsNoCachePaths(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "--no-cache-paths=/Shared/Live, *.status", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if got := buildNodeConfig(1, 1, cfg).NoCachePatterns; !reflect.DeepEqual(got, []string{"/Shared/Live", "*.status"}) {
+		t.Fatalf("no-cache patterns = %v", got)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--no-cache-paths=Shared/live", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for a relative --no-cache-paths path, got %v", err)
+	}
+}
+
+func TestParseArgsAttributesFile(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if buildNodeConfig(1, 1, cfg).Transforms != nil {
+		t.Fatal("expected no transforms by default")
+	}
+
+	file := filepath.Join(t.TempDir(), ".wsfsattributes")
+	if err := os.WriteFile(file, []byte("*.ipynb strip-outputs\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg, err = parseArgs([]string{"wsfs", "--attributes-file", file, "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if buildNodeConfig(1, 1, cfg).Transforms == nil {
+		t.Fatal("--attributes-file not propagated to the node config")
+	}
+
+	if err := os.WriteFile(file, []byte("*.ipynb nbstripout\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for _, arg := range []string{file, file + ".missing"} {
+		_, err = parseArgs([]string{"wsfs", "--attributes-file", arg, "/mnt/wsfs"})
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("expected exit code 2 for --attributes-file %s, got %v", arg, err)
+		}
+	}
+}
+
+func TestParseArgsWarmRepos(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if buildNodeConfig(1, 1, cfg).WarmRepos {
+		t.Fatal("expected repo warm-up to be off by default")
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--warm-repos", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if !buildNodeConfig(1, 1, cfg).WarmRepos {
+		t.Fatal("--warm-repos not propagated to the node config")
+	}
+}
+
+func TestParseArgsSnapshot(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil || cfg.snapshot {
+		t.Fatalf("snapshot should be off by default: %+v, %v", cfg, err)
+	}
+	cfg, err = parseArgs([]string{"wsfs", "--snapshot", "/mnt/wsfs"})
+	if err != nil || !cfg.snapshot {
+		t.Fatalf("expected snapshot mode: %+v, %v", cfg, err)
+	}
+	opts := buildMountOptions(cfg)
+	if len(opts.MountOptions.Options) != 1 || opts.MountOptions.Options[0] != "ro" {
+		t.Fatalf("snapshot mount options = %v, want ro", opts.MountOptions.Options)
+	}
+}
+
+func TestParseArgsMountNames(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil || cfg.volumeName() != "wsfs" {
+		t.Fatalf("default volume name = %q, %v", cfg.volumeName(), err)
+	}
+	cfg, err = parseArgs([]string{"wsfs", "--fsname=wsfs:prod", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	opts := buildMountOptions(cfg)
+	if opts.MountOptions.FsName != "wsfs:prod" || opts.MountOptions.Name != "wsfs" {
+		t.Fatalf("mount options = %+v, want fsname wsfs:prod with type fuse.wsfs", opts.MountOptions)
+	}
+	if cfg.volumeName() != "wsfs:prod" {
+		t.Fatalf("volume name = %q, want the fsname", cfg.volumeName())
+	}
+	cfg, err = parseArgs([]string{"wsfs", "--fsname=wsfs:prod", "--volname=Prod workspace", "/mnt/wsfs"})
+	if err != nil || cfg.volumeName() != "Prod workspace" {
+		t.Fatalf("volume name = %q, %v", cfg.volumeName(), err)
+	}
+
+	for _, value := range []string{"--fsname=", "--fsname=a\nb", "--volname=tab\there"} {
+		_, err := parseArgs([]string{"wsfs", value, "/mnt/wsfs"})
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("parseArgs(%q) error = %v, want exit code 2", value, err)
+		}
+	}
+}
+
+func TestParseArgsMetaCache(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if got := cfg.cacheConfig(); got.MetadataTTL != defaultMetadataTTL || got.MaxEntries != 0 {
+		t.Fatalf("default cache config = %+v", got)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--meta-ttl=2m", "--meta-max-entries=50000", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	got := cfg.cacheConfig()
+	if got.MetadataTTL != 2*time.Minute || got.NegativeTTL != defaultNegativeTTL || got.MaxEntries != 50000 {
+		t.Fatalf("cache config = %+v, want a 2m TTL and 50000 entries", got)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--ide-mode", "--meta-ttl=1s", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if got := cfg.cacheConfig(); got.MetadataTTL != time.Second || got.NegativeTTL != time.Second {
+		t.Fatalf("cache config = %+v, want the negative TTL capped at 1s", got)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--validate-listings", "/mnt/wsfs"})
+	if err != nil || !cfg.cacheConfig().ValidateListings {
+		t.Fatalf("--validate-listings not passed to the cache config: %v", err)
+	}
+
+	for _, value := range []string{"--meta-ttl=-1s", "--meta-max-entries=-1"} {
+		_, err := parseArgs([]string{"wsfs", value, "/mnt/wsfs"})
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("parseArgs(%q) error = %v, want exit code 2", value, err)
+		}
+	}
+}
+
+func TestParseArgsModes(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if nodeCfg := buildNodeConfig(1, 1, cfg); nodeCfg.FileMode != 0644 || nodeCfg.DirMode != 0755 {
+		t.Fatalf("default modes = %o/%o, want 644/755", nodeCfg.FileMode, nodeCfg.DirMode)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--umask=077", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if nodeCfg := buildNodeConfig(1, 1, cfg); nodeCfg.FileMode != 0600 || nodeCfg.DirMode != 0700 {
+		t.Fatalf("--umask=077 modes = %o/%o, want 600/700", nodeCfg.FileMode, nodeCfg.DirMode)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--file-mode=0666", "--dir-mode=0777", "--umask=002", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.fileMode != 0664 || cfg.dirMode != 0775 {
+		t.Fatalf("modes = %o/%o, want 664/775", cfg.fileMode, cfg.dirMode)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--exec-mode=by-extension", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if got := buildNodeConfig(1, 1, cfg).ExecMode; got != wsfsfuse.ExecByExtension {
+		t.Fatalf("ExecMode = %v, want by-extension", got)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--du-mode=cached", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if !buildNodeConfig(1, 1, cfg).CachedBlocks {
+		t.Fatal("--du-mode=cached not propagated to the node config")
+	}
+
+	for _, value := range []string{"--file-mode=rw", "--dir-mode=2775", "--umask=8", "--exec-mode=yes", "--du-mode=local"} {
+		_, err := parseArgs([]string{"wsfs", value, "/mnt/wsfs"})
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("parseArgs(%s) error = %v, want exit code 2", value, err)
+		}
+	}
+}
+
+func TestParseArgsAllowIDs(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "--allow-other", "--allow-uids=1001, 1002", "--allow-gids=2000", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	nodeCfg := buildNodeConfig(1, 1, cfg)
+	if !reflect.DeepEqual(nodeCfg.AllowedUids, []uint32{1001, 1002}) || !reflect.DeepEqual(nodeCfg.AllowedGids, []uint32{2000}) {
+		t.Fatalf("allowed IDs not propagated: uids=%v gids=%v", nodeCfg.AllowedUids, nodeCfg.AllowedGids)
+	}
+
+	for _, args := range [][]string{
+		{"wsfs", "--allow-gids=2000", "/mnt/wsfs"},
+		{"wsfs", "--allow-other", "--allow-uids=no-such-user-wsfs", "/mnt/wsfs"},
+		{"wsfs", "--allow-other", "--allow-gids=-1", "/mnt/wsfs"},
+	} {
+		_, err := parseArgs(args)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("parseArgs(%v) error = %v, want exit code 2", args, err)
+		}
+	}
+}
+
+func TestParseArgsBulkImportWorkers(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if got := buildNodeConfig(1, 1, cfg).BulkImportWorkers; got != defaultBulkImportWorkers {
+		t.Fatalf("default BulkImportWorkers = %d, want %d", got, defaultBulkImportWorkers)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--bulk-import-workers=0", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if got := buildNodeConfig(1, 1, cfg).BulkImportWorkers; got != 0 {
+		t.Fatalf("BulkImportWorkers = %d, want bulk import disabled", got)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--bulk-import-workers=-1", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for a negative --bulk-import-workers, got %v", err)
+	}
+}
+
+func TestParseArgsUnicodeNormalization(t *testing.T) {
+	cases := []struct {
+		args []string
+		want bool
+	}{
+		{args: []string{"wsfs", "/mnt/wsfs"}, want: true},
+		{args: []string{"wsfs", "--unicode-normalization=NFC", "/mnt/wsfs"}, want: true},
+		{args: []string{"wsfs", "--unicode-normalization=none", "/mnt/wsfs"}, want: false},
+	}
+	for _, tc := range cases {
+		cfg, err := parseArgs(tc.args)
+		if err != nil {
+			t.Fatalf("parseArgs(%v) failed: %v", tc.args, err)
+		}
+		if got := buildNodeConfig(1, 1, cfg).NormalizeUnicode; got != tc.want {
+			t.Fatalf("parseArgs(%v): NormalizeUnicode = %v, want %v", tc.args, got, tc.want)
+		}
+	}
+
+	_, err := parseArgs([]string{"wsfs", "--unicode-normalization=nfd", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 cli error, got %v", err)
+	}
+}
+
+func TestParseArgsNotebookAliases(t *testing.T) {
+	cases := []struct {
+		args []string
+		want pathutil.NotebookAliases
+	}{
+		{args: []string{"wsfs", "/mnt/wsfs"}, want: pathutil.NotebookAliasesSuffixOnly},
+		{args: []string{"wsfs", "--notebook-aliases=both", "/mnt/wsfs"}, want: pathutil.NotebookAliasesBoth},
+		{args: []string{"wsfs", "--notebook-aliases=none", "/mnt/wsfs"}, want: pathutil.NotebookAliasesNone},
+	}
+	for _, tc := range cases {
+		cfg, err := parseArgs(tc.args)
+		if err != nil {
+			t.Fatalf("parseArgs(%v) failed: %v", tc.args, err)
+		}
+		if got := buildNodeConfig(1, 1, cfg).NotebookAliases; got != tc.want {
+			t.Fatalf("parseArgs(%v): NotebookAliases = %v, want %v", tc.args, got, tc.want)
+		}
+	}
+
+	_, err := parseArgs([]string{"wsfs", "--notebook-aliases=bare", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 cli error, got %v", err)
+	}
+}
+
+func TestParseArgsInvalidStatfsSize(t *testing.T) {
+	_, err := parseArgs([]string{"wsfs", "--statfs-size=lots", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 cli error, got %v", err)
+	}
+}
+
+func TestParseArgsSignedURLThreshold(t *testing.T) {
+	cases := []struct {
+		value string
+		want  databricks.TransferConfig
+	}{
+		{value: "", want: databricks.TransferConfig{}},
+		{value: "16M", want: databricks.TransferConfig{SignedURLThreshold: 16 << 20}},
+		{value: "auto", want: databricks.TransferConfig{Adaptive: true}},
+		{value: "AUTO", want: databricks.TransferConfig{Adaptive: true}},
+	}
+	for _, tc := range cases {
+		cfg, err := parseArgs([]string{"wsfs", "--signed-url-threshold=" + tc.value, "/mnt/wsfs"})
+		if err != nil {
+			t.Fatalf("parseArgs(%q) failed: %v", tc.value, err)
+		}
+		if cfg.transfer != tc.want {
+			t.Fatalf("parseArgs(%q) transfer = %+v, want %+v", tc.value, cfg.transfer, tc.want)
+		}
+	}
+
+	for _, value := range []string{"fast", "0"} {
+		_, err := parseArgs([]string{"wsfs", "--signed-url-threshold=" + value, "/mnt/wsfs"})
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("expected exit code 2 for %q, got %v", value, err)
+		}
+	}
+}
+
+func TestParseArgsMaxNotebookSize(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "--max-notebook-size=10M", "--signed-url-threshold=auto", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if want := (databricks.TransferConfig{Adaptive: true, MaxNotebookSize: 10 << 20}); cfg.transfer != want {
+		t.Fatalf("transfer = %+v, want %+v", cfg.transfer, want)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--max-notebook-size=big", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for an invalid --max-notebook-size, got %v", err)
+	}
+}
+
+func TestParseArgsFlushThreshold(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "--flush-threshold=256M", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.flushThreshold != 256<<20 || buildNodeConfig(0, 0, cfg).FlushThreshold != 256<<20 {
+		t.Fatalf("flushThreshold = %d", cfg.flushThreshold)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--flush-threshold=lots", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for an invalid --flush-threshold, got %v", err)
+	}
+}
+
+func TestParseArgsKernelRequestSizes(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "--max-write=1M", "--max-readahead=64K", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	opts := buildMountOptions(cfg)
+	if opts.MaxWrite != 1<<20 || opts.MaxReadAhead != 64<<10 {
+		t.Fatalf("MaxWrite = %d, MaxReadAhead = %d", opts.MaxWrite, opts.MaxReadAhead)
+	}
+
+	if opts.MaxBackground != wsfsfuse.DefaultMaxBackground {
+		t.Fatalf("MaxBackground = %d, want the default", opts.MaxBackground)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--max-background=64", "/mnt/wsfs"})
+	if err != nil || buildMountOptions(cfg).MaxBackground != 64 {
+		t.Fatalf("--max-background=64: %v", err)
+	}
+
+	for _, arg := range []string{"--max-write=1K", "--max-write=2M", "--max-readahead=some", "--max-background=0"} {
+		_, err = parseArgs([]string{"wsfs", arg, "/mnt/wsfs"})
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("expected exit code 2 for %s, got %v", arg, err)
+		}
+	}
+}
+
+func TestParseArgsTransportFlags(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.transport != (databricks.TransportConfig{}) {
+		t.Fatalf("expected default transport config, got %+v", cfg.transport)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--ca-bundle=/etc/ssl/corp.pem", "--insecure-skip-tls-verify",
+		"--max-idle-conns-per-host=64", "--disable-http2", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	want := databricks.TransportConfig{
+		CABundle:            "/etc/ssl/corp.pem",
+		InsecureSkipVerify:  true,
+		MaxIdleConnsPerHost: 64,
+		DisableHTTP2:        true,
+	}
+	if cfg.transport != want {
+		t.Fatalf("transport = %+v, want %+v", cfg.transport, want)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--max-idle-conns-per-host=-1", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for negative --max-idle-conns-per-host, got %v", err)
+	}
+}
+
+func TestParseArgsControlSocket(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.controlSocket != "" {
+		t.Fatalf("control API should be off by default, got %q", cfg.controlSocket)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--control-socket=/run/user/1000/wsfs.sock", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.controlSocket != "/run/user/1000/wsfs.sock" {
+		t.Fatalf("controlSocket = %q", cfg.controlSocket)
+	}
+}
+
+func TestParseArgsRootRevalidateInterval(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.rootRevalidateInterval != defaultRootRevalidateInterval {
+		t.Fatalf("rootRevalidateInterval = %s, want default", cfg.rootRevalidateInterval)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--root-revalidate-interval=0", "/mnt/wsfs"})
+	if err != nil || cfg.rootRevalidateInterval != 0 {
+		t.Fatalf("parseArgs(0) = %s, %v", cfg.rootRevalidateInterval, err)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--root-revalidate-interval=-1s", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for a negative interval, got %v", err)
+	}
+}
+
+func TestParseArgsCacheAudit(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil || cfg.cacheAuditInterval != 0 || cfg.cacheAuditSample != defaultCacheAuditSample || cfg.cacheAuditHeal {
+		t.Fatalf("defaults = %s %d %v, %v", cfg.cacheAuditInterval, cfg.cacheAuditSample, cfg.cacheAuditHeal, err)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--cache-audit-interval=10m", "--cache-audit-sample=100", "--cache-audit-heal", "/mnt/wsfs"})
+	if err != nil || cfg.cacheAuditInterval != 10*time.Minute || cfg.cacheAuditSample != 100 || !cfg.cacheAuditHeal {
+		t.Fatalf("parseArgs = %s %d %v, %v", cfg.cacheAuditInterval, cfg.cacheAuditSample, cfg.cacheAuditHeal, err)
+	}
+
+	for _, arg := range []string{"--cache-audit-interval=-1m", "--cache-audit-sample=0"} {
+		_, err = parseArgs([]string{"wsfs", arg, "/mnt/wsfs"})
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("expected exit code 2 for %s, got %v", arg, err)
+		}
+	}
+}
+
+func TestParseArgsCacheGCInterval(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil || cfg.cacheGCInterval != defaultCacheGCInterval {
+		t.Fatalf("default = %s, %v", cfg.cacheGCInterval, err)
+	}
+	cfg, err = parseArgs([]string{"wsfs", "--cache-gc-interval=0", "/mnt/wsfs"})
+	if err != nil || cfg.cacheGCInterval != 0 {
+		t.Fatalf("parseArgs = %s, %v", cfg.cacheGCInterval, err)
+	}
+	_, err = parseArgs([]string{"wsfs", "--cache-gc-interval=-1m", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for a negative interval, got %v", err)
+	}
+}
+
+func TestParseArgsStaleWhileRevalidate(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil || cfg.cacheConfig().StaleWhileRevalidate != 0 {
+		t.Fatalf("default = %+v, %v", cfg.cacheConfig(), err)
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--ide-mode", "--stale-while-revalidate=5m", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if got := cfg.cacheConfig(); got.StaleWhileRevalidate != 5*time.Minute || got.MetadataTTL != ideMetadataTTL {
+		t.Fatalf("cacheConfig = %+v", got)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--stale-while-revalidate=-1s", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for a negative window, got %v", err)
+	}
+}
+
+func TestRunPassesCustomTransportToWorkspace(t *testing.T) {
+	deps := testDeps()
+	deps.faultInjector = func() (*faultinject.Injector, error) { return nil, nil }
+	var gotTransport http.RoundTripper
+	deps.initWorkspace = func(transport http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
+		gotTransport = transport
+		return nil, errors.New("stop")
+	}
+
+	if err := run([]string{"wsfs", "/mnt/wsfs"}, deps); err == nil {
+		t.Fatal("expected initWorkspace error")
+	}
+	pooled, ok := gotTransport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected shared *http.Transport, got %T", gotTransport)
+	}
+	if pooled.TLSClientConfig != nil && pooled.TLSClientConfig.InsecureSkipVerify {
+		t.Fatal("certificate verification should stay on by default")
+	}
+
+	if err := run([]string{"wsfs", "--insecure-skip-tls-verify", "/mnt/wsfs"}, deps); err == nil {
+		t.Fatal("expected initWorkspace error")
+	}
+	transport, ok := gotTransport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected *http.Transport, got %T", gotTransport)
+	}
+	if transport.TLSClientConfig == nil || !transport.TLSClientConfig.InsecureSkipVerify {
+		t.Fatal("expected InsecureSkipVerify on the workspace transport")
+	}
+}
+
+func TestRunRejectsInvalidCABundle(t *testing.T) {
+	deps := testDeps()
+	deps.faultInjector = func() (*faultinject.Injector, error) { return nil, nil }
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
+		t.Fatal("initWorkspace should not be called")
+		return nil, nil
+	}
+
+	err := run([]string{"wsfs", "--ca-bundle=" + t.TempDir() + "/missing.pem", "/mnt/wsfs"}, deps)
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for missing CA bundle, got %v", err)
+	}
+}
+
 func TestBuildMountOptions(t *testing.T) {
-	opts := buildMountOptions(true, true)
+	opts := buildMountOptions(cliConfig{allowOther: true, debug: true})
 	if !opts.MountOptions.AllowOther {
 		t.Fatal("AllowOther should be true")
 	}
@@ -169,6 +993,9 @@ func TestBuildMountOptions(t *testing.T) {
 	if opts.MountOptions.Name != "wsfs" || opts.MountOptions.FsName != "wsfs" {
 		t.Fatalf("unexpected mount options: %+v", opts.MountOptions)
 	}
+	if len(opts.MountOptions.Options) != 0 {
+		t.Fatalf("unexpected extra mount options: %v", opts.MountOptions.Options)
+	}
 	if opts.AttrTimeout == nil || *opts.AttrTimeout != defaultAttrTTL {
 		t.Fatalf("unexpected attr timeout: %v", opts.AttrTimeout)
 	}
@@ -182,7 +1009,7 @@ func TestBuildMountOptions(t *testing.T) {
 
 func TestRunShowVersion(t *testing.T) {
 	var out bytes.Buffer
-	deps := defaultDeps()
+	deps := testDeps()
 	deps.versionOut = func(s string) { _, _ = io.Copy(&out, strings.NewReader(s)) }
 
 	if err := run([]string{"wsfs", "--version"}, deps); err != nil {
@@ -194,8 +1021,8 @@ func TestRunShowVersion(t *testing.T) {
 }
 
 func TestRunInitWorkspaceError(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return nil, errors.New("boom")
 	}
 
@@ -208,8 +1035,8 @@ func TestRunInitWorkspaceError(t *testing.T) {
 }
 
 func TestRunSuccess(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -234,7 +1061,7 @@ func TestRunSuccess(t *testing.T) {
 		return &wsfsfuse.WSNode{}, nil
 	}
 	server := &fakeServer{waitCh: make(chan struct{})}
-	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options) (mountServer, error) {
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
 		return server, nil
 	}
 	deps.signalContext = func() (context.Context, context.CancelFunc) {
@@ -263,9 +1090,81 @@ func TestRunSuccess(t *testing.T) {
 	}
 }
 
+func TestRunControlSocketUnmount(t *testing.T) {
+	deps := testDeps()
+	deps.faultInjector = func() (*faultinject.Injector, error) { return nil, nil }
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
+		return &databrickssdk.WorkspaceClient{}, nil
+	}
+	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
+		return "Tester", nil
+	}
+	deps.currentUser = func() (*user.User, error) {
+		return &user.User{Uid: "123", Gid: "456"}, nil
+	}
+	deps.newDiskCache = func() (*filecache.DiskCache, error) {
+		return filecache.NewDisabledCache(), nil
+	}
+	deps.newWorkspaceFilesClient = func(*databrickssdk.WorkspaceClient) (databricks.WorkspaceFilesAPI, error) {
+		return &fakeWorkspaceFilesClient{}, nil
+	}
+	deps.newRootNode = func(api databricks.WorkspaceFilesAPI, cache *filecache.DiskCache, rootPath string, registry *wsfsfuse.DirtyNodeRegistry, config *wsfsfuse.NodeConfig) (*wsfsfuse.WSNode, error) {
+		return &wsfsfuse.WSNode{}, nil
+	}
+	server := &fakeServer{waitCh: make(chan struct{})}
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
+		return server, nil
+	}
+	deps.signalContext = func() (context.Context, context.CancelFunc) {
+		return context.WithCancel(context.Background())
+	}
+
+	socketPath := t.TempDir() + "/control.sock"
+	done := make(chan error, 1)
+	go func() {
+		done <- run([]string{"wsfs", "--control-socket=" + socketPath, "/mnt/wsfs"}, deps)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	var resp *http.Response
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var err error
+		resp, err = client.Post("http://wsfs/v1/unmount", "application/json", nil)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("control API did not come up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("unmount status = %d", resp.StatusCode)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run did not return after control API unmount")
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Fatalf("expected control socket to be removed, got %v", err)
+	}
+}
+
 func TestRunParseUIDError(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -286,8 +1185,8 @@ func TestRunParseUIDError(t *testing.T) {
 }
 
 func TestRunParseGIDError(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -308,8 +1207,8 @@ func TestRunParseGIDError(t *testing.T) {
 }
 
 func TestRunMountOptionsUsesAllowOther(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -332,7 +1231,7 @@ func TestRunMountOptionsUsesAllowOther(t *testing.T) {
 		}
 		return &wsfsfuse.WSNode{}, nil
 	}
-	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options) (mountServer, error) {
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
 		gotAllowOther = opts.MountOptions.AllowOther
 		return &fakeServer{waitCh: make(chan struct{})}, nil
 	}
@@ -352,8 +1251,8 @@ func TestRunMountOptionsUsesAllowOther(t *testing.T) {
 }
 
 func TestRunUsesCacheEnabledError(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -375,8 +1274,8 @@ func TestRunUsesCacheEnabledError(t *testing.T) {
 }
 
 func TestRunNewRootNodeError(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -397,9 +1296,33 @@ func TestRunNewRootNodeError(t *testing.T) {
 	}
 }
 
+func TestRunNewRootNodeErrorExplainsMissingRoot(t *testing.T) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
+		return &databrickssdk.WorkspaceClient{}, nil
+	}
+	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
+		return "Tester", nil
+	}
+	deps.currentUser = func() (*user.User, error) {
+		return &user.User{Uid: "123", Gid: "456"}, nil
+	}
+	deps.newWorkspaceFilesClient = func(*databrickssdk.WorkspaceClient) (databricks.WorkspaceFilesAPI, error) {
+		return &fakeWorkspaceFilesClient{}, nil
+	}
+	deps.newRootNode = func(api databricks.WorkspaceFilesAPI, cache *filecache.DiskCache, rootPath string, registry *wsfsfuse.DirtyNodeRegistry, config *wsfsfuse.NodeConfig) (*wsfsfuse.WSNode, error) {
+		return nil, fmt.Errorf("stat %s: %w", rootPath, iofs.ErrNotExist)
+	}
+
+	err := run([]string{"wsfs", "--remote-path=/Users/gone", "/mnt/wsfs"}, deps)
+	if err == nil || !strings.Contains(err.Error(), "/Users/gone does not exist") {
+		t.Fatalf("expected a hint about the missing root, got %v", err)
+	}
+}
+
 func TestRunMountError(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -411,7 +1334,7 @@ func TestRunMountError(t *testing.T) {
 	deps.newWorkspaceFilesClient = func(*databrickssdk.WorkspaceClient) (databricks.WorkspaceFilesAPI, error) {
 		return &fakeWorkspaceFilesClient{}, nil
 	}
-	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options) (mountServer, error) {
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
 		return nil, errors.New("mount error")
 	}
 
@@ -442,8 +1365,8 @@ func TestParseArgsEmptyArgs(t *testing.T) {
 }
 
 func TestRunWorkspaceMeError(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -456,8 +1379,8 @@ func TestRunWorkspaceMeError(t *testing.T) {
 }
 
 func TestRunCurrentUserError(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -476,8 +1399,8 @@ func TestRunCurrentUserError(t *testing.T) {
 }
 
 func TestRunNewWorkspaceFilesClientError(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -496,8 +1419,8 @@ func TestRunNewWorkspaceFilesClientError(t *testing.T) {
 }
 
 func TestRunSignalFlushErrors(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -513,7 +1436,7 @@ func TestRunSignalFlushErrors(t *testing.T) {
 		return &wsfsfuse.WSNode{}, nil
 	}
 	server := &fakeServer{waitCh: make(chan struct{})}
-	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options) (mountServer, error) {
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
 		return server, nil
 	}
 
@@ -562,8 +1485,8 @@ func TestValidateConfigNoop(t *testing.T) {
 }
 
 func TestRunUsesDefaultDiskCacheFactory(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -581,7 +1504,7 @@ func TestRunUsesDefaultDiskCacheFactory(t *testing.T) {
 		called = true
 		return filecache.NewDisabledCache(), nil
 	}
-	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options) (mountServer, error) {
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
 		return &fakeServer{waitCh: make(chan struct{})}, nil
 	}
 	deps.signalContext = func() (context.Context, context.CancelFunc) {
@@ -609,7 +1532,7 @@ func TestParseArgsShowVersionNoMountPoint(t *testing.T) {
 }
 
 func TestRunParseArgsErrorExitCode(t *testing.T) {
-	deps := defaultDeps()
+	deps := testDeps()
 	_, err := parseArgs([]string{})
 	if err == nil {
 		t.Fatal("expected error")
@@ -628,8 +1551,8 @@ func TestRunParseArgsErrorExitCode(t *testing.T) {
 }
 
 func TestRunInvalidUIDType(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -659,14 +1582,14 @@ func TestParseArgsMountPointIgnoredForVersion(t *testing.T) {
 }
 
 func TestRunMountPointRequired(t *testing.T) {
-	deps := defaultDeps()
+	deps := testDeps()
 	if err := run([]string{"wsfs"}, deps); err == nil {
 		t.Fatal("expected error")
 	}
 }
 
 func TestRunShowVersionIgnoresMountPointValidation(t *testing.T) {
-	deps := defaultDeps()
+	deps := testDeps()
 	var out bytes.Buffer
 	deps.versionOut = func(s string) { out.WriteString(s) }
 
@@ -709,8 +1632,8 @@ func TestParseArgsRemotePathDefault(t *testing.T) {
 }
 
 func TestRunPassesRemotePathToRootNode(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -731,7 +1654,7 @@ func TestRunPassesRemotePathToRootNode(t *testing.T) {
 		gotRootPath = rootPath
 		return &wsfsfuse.WSNode{}, nil
 	}
-	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options) (mountServer, error) {
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
 		return &fakeServer{waitCh: make(chan struct{})}, nil
 	}
 	deps.signalContext = func() (context.Context, context.CancelFunc) {
@@ -749,8 +1672,8 @@ func TestRunPassesRemotePathToRootNode(t *testing.T) {
 }
 
 func TestRunDefaultsRemotePathToSlash(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -771,7 +1694,7 @@ func TestRunDefaultsRemotePathToSlash(t *testing.T) {
 		gotRootPath = rootPath
 		return &wsfsfuse.WSNode{}, nil
 	}
-	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options) (mountServer, error) {
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
 		return &fakeServer{waitCh: make(chan struct{})}, nil
 	}
 	deps.signalContext = func() (context.Context, context.CancelFunc) {
@@ -789,8 +1712,8 @@ func TestRunDefaultsRemotePathToSlash(t *testing.T) {
 }
 
 func TestRunSignalContextCancel(t *testing.T) {
-	deps := defaultDeps()
-	deps.initWorkspace = func() (*databrickssdk.WorkspaceClient, error) {
+	deps := testDeps()
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
 		return &databrickssdk.WorkspaceClient{}, nil
 	}
 	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
@@ -803,7 +1726,7 @@ func TestRunSignalContextCancel(t *testing.T) {
 		return &fakeWorkspaceFilesClient{}, nil
 	}
 	server := &fakeServer{waitCh: make(chan struct{})}
-	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options) (mountServer, error) {
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
 		return server, nil
 	}
 	deps.signalContext = func() (context.Context, context.CancelFunc) {
@@ -824,3 +1747,56 @@ func TestRunSignalContextCancel(t *testing.T) {
 		t.Fatal("run did not return")
 	}
 }
+
+func TestParseArgsEvents(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "--events-webhook=http://127.0.0.1:9000/hook", "--events-socket=/run/wsfs-events.sock", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.eventsWebhook != "http://127.0.0.1:9000/hook" || cfg.eventsSocket != "/run/wsfs-events.sock" {
+		t.Fatalf("events config = %q %q", cfg.eventsWebhook, cfg.eventsSocket)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--events-webhook=127.0.0.1:9000", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 || !strings.Contains(cliErr.msg, "--events-webhook") {
+		t.Fatalf("expected exit code 2 for a webhook without scheme, got %v", err)
+	}
+}
+
+func TestBuildEventBus(t *testing.T) {
+	bus, err := buildEventBus(cliConfig{})
+	if err != nil || bus != nil {
+		t.Fatalf("buildEventBus without sinks = %v, %v; want nil", bus, err)
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "events.sock")
+	bus, err = buildEventBus(cliConfig{eventsSocket: socketPath, eventsWebhook: "http://127.0.0.1:1/hook"})
+	if err != nil || bus == nil {
+		t.Fatalf("buildEventBus = %v, %v", bus, err)
+	}
+	if _, err := os.Stat(socketPath); err != nil {
+		t.Fatalf("event socket not created: %v", err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Fatalf("event socket not removed: %v", err)
+	}
+}
+
+func TestOpenInodeIndex(t *testing.T) {
+	if openInodeIndex("", workspaceTarget{}, cliConfig{}, "/") != nil {
+		t.Fatal("expected no inode index without a cache directory")
+	}
+	cacheDir := t.TempDir()
+	inodes := openInodeIndex(cacheDir, workspaceTarget{host: "https://example.cloud.databricks.com"}, cliConfig{}, "/Users/me")
+	if inodes == nil {
+		t.Fatal("expected an inode index")
+	}
+	saveInodeIndex(inodes)
+	if _, err := os.Stat(filepath.Join(cacheDir, "inodes")); err == nil {
+		t.Fatal("an unchanged index should not be written")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"wsfs/internal/filecache"
+)
+
+var byteSizeUnits = []struct {
+	suffix string
+	factor uint64
+}{
+	{suffix: "T", factor: 1 << 40},
+	{suffix: "G", factor: 1 << 30},
+	{suffix: "M", factor: 1 << 20},
+	{suffix: "K", factor: 1 << 10},
+}
+
+// parseByteSize parses sizes such as "4096", "512M", "1.5G", or "2TiB".
+// Units are binary (K = 1024) and may be followed by "B" or "iB". An empty
+// string parses as zero.
+func parseByteSize(s string) (uint64, error) {
+	value := strings.TrimSpace(s)
+	if value == "" {
+		return 0, nil
+	}
+
+	upper := strings.ToUpper(value)
+	upper, hasB := strings.CutSuffix(upper, "B")
+	// "iB" only follows a unit; a bare "I" is not a suffix.
+	upper, hasI := strings.CutSuffix(upper, "I")
+	if hasI && !hasB {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	factor := uint64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSuffix(upper, unit.suffix)
+			factor = unit.factor
+			break
+		}
+	}
+	if hasI && factor == 1 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	if err != nil || number < 0 || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	size := number * float64(factor)
+	if size >= 1<<64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return uint64(size), nil
+}
+
+// parseDiskCacheQuotas parses a comma-separated list of PATH=SIZE budgets,
+// such as "/Users/me/big-data=2G,/Shared/raw=500M".
+func parseDiskCacheQuotas(value string) ([]filecache.Quota, error) {
+	var quotas []filecache.Quota
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		prefix, size, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: want PATH=SIZE", item)
+		}
+		prefix = strings.TrimSpace(prefix)
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("%q: path must be an absolute workspace path", item)
+		}
+		maxBytes, err := parseByteSize(size)
+		if err != nil {
+			return nil, err
+		}
+		if maxBytes == 0 {
+			return nil, fmt.Errorf("%q: size must be positive", item)
+		}
+		quotas = append(quotas, filecache.Quota{Prefix: path.Clean(prefix), MaxBytes: int64(maxBytes)})
+	}
+	return quotas, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{in: "", want: 0},
+		{in: "4096", want: 4096},
+		{in: "4096B", want: 4096},
+		{in: "1K", want: 1 << 10},
+		{in: "1kb", want: 1 << 10},
+		{in: "512M", want: 512 << 20},
+		{in: "1.5G", want: 3 << 29},
+		{in: "2TiB", want: 2 << 40},
+		{in: " 10g ", want: 10 << 30},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if err != nil {
+			t.Fatalf("parseByteSize(%q) error: %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Fatalf("parseByteSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseByteSizeInvalid(t *testing.T) {
+	for _, in := range []string{"abc", "-1G", "G", "1X", "inf", "NaN", "infT", "5I", "5iB", "5IK", "16777216T", "1e300"} {
+		if _, err := parseByteSize(in); err == nil {
+			t.Fatalf("parseByteSize(%q) expected error", in)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+
+	"wsfs/internal/controlapi"
+	wsfsfuse "wsfs/internal/fuse"
+	"wsfs/internal/logging"
+	"wsfs/internal/record"
+)
+
+const (
+	// defaultMaxRemounts caps how often --supervise remounts during the
+	// life of the process.
+	defaultMaxRemounts = 5
+
+	defaultRemountBackoff = time.Second
+	maxRemountBackoff     = 30 * time.Second
+)
+
+// mountSupervisor tracks the current FUSE server, which --supervise
+// replaces when the kernel connection breaks.
+type mountSupervisor struct {
+	mu       sync.Mutex
+	server   mountServer
+	stopping bool
+	stopped  chan struct{}
+}
+
+func newMountSupervisor(server mountServer) *mountSupervisor {
+	return &mountSupervisor{server: server, stopped: make(chan struct{})}
+}
+
+// unmount unmounts the current server and stops further remounts.
+func (s *mountSupervisor) unmount() {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return
+	}
+	s.stopping = true
+	close(s.stopped)
+	server := s.server
+	s.mu.Unlock()
+
+	if err := server.Unmount(); err != nil {
+		log.Printf("Unmount error: %v", err)
+	}
+}
+
+// wait blocks until the current server exits and reports whether the exit
+// was requested through unmount.
+func (s *mountSupervisor) wait() bool {
+	s.mu.Lock()
+	server := s.server
+	s.mu.Unlock()
+	server.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
+
+// replace makes server current. An unmount requested while the remount was
+// in progress applies to the new server.
+func (s *mountSupervisor) replace(server mountServer) {
+	s.mu.Lock()
+	s.server = server
+	stopping := s.stopping
+	s.mu.Unlock()
+
+	if stopping {
+		if err := server.Unmount(); err != nil {
+			log.Printf("Unmount error: %v", err)
+		}
+	}
+}
+
+// remountBackoff returns the wait before remount attempt n (1-based).
+func remountBackoff(base time.Duration, n int) time.Duration {
+	delay := base
+	for i := 1; i < n && delay < maxRemountBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRemountBackoff)
+}
+
+// connectionLost reports whether stat of the mount point failed because
+// the FUSE connection behind it is gone. A mount point removed with
+// fusermount -u stats normally.
+func connectionLost(statErr error) bool {
+	return errors.Is(statErr, syscall.ENOTCONN)
+}
+
+// lazyUnmount detaches a mount point whose FUSE connection is gone.
+// umount2 needs CAP_SYS_ADMIN, so the setuid fusermount helper does it.
+func lazyUnmount(mountPoint string) error {
+	for _, helper := range []string{"fusermount3", "fusermount"} {
+		path, err := exec.LookPath(helper)
+		if err != nil {
+			continue
+		}
+		out, err := exec.Command(path, "-u", "-z", mountPoint).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s -u -z: %w: %s", helper, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return errors.New("neither fusermount3 nor fusermount was found")
+}
+
+// recoverStaleMount handles a mount point left disconnected by a crashed
+// wsfs, which answers "Transport endpoint is not connected" and cannot be
+// mounted on again. With --recover-stale-mount it is detached lazily, like
+// fusermount -u -z, so a service manager can restart wsfs in place;
+// otherwise wsfs refuses to start and says how to detach it. Only a
+// fuse.wsfs mount is detached: a disconnected sshfs or rclone mount on the
+// same path belongs to someone else.
+func recoverStaleMount(cfg cliConfig, deps runDeps) error {
+	mountPoint := cfg.mountPoint
+	if !connectionLost(deps.statMountPoint(mountPoint)) {
+		return nil
+	}
+	if !cfg.recoverStaleMount {
+		return fmt.Errorf("%s is a disconnected FUSE mount, probably from a crashed wsfs (detach it with `fusermount -u -z %s`, or pass --recover-stale-mount)", mountPoint, mountPoint)
+	}
+	if fstype, ok := deps.mountedFsType(mountPoint); !ok || fstype != "fuse."+wsfsMountType {
+		if !ok {
+			fstype = "type unknown"
+		}
+		return fmt.Errorf("%s is a disconnected FUSE mount, but not a wsfs one (%s); wsfs leaves it alone (detach it with `fusermount -u -z %s` if it is yours)", mountPoint, fstype, mountPoint)
+	}
+	logging.Warnf("%s is a disconnected FUSE mount, probably from a crashed wsfs; detaching it", mountPoint)
+	if err := deps.lazyUnmount(mountPoint); err != nil {
+		return fmt.Errorf("detach stale mount %s: %w (run `fusermount -u -z %s` as the user who mounted it)", mountPoint, err, mountPoint)
+	}
+	if connectionLost(deps.statMountPoint(mountPoint)) {
+		return fmt.Errorf("%s is still a disconnected FUSE mount after detaching it (another stale mount may be stacked on it; run `fusermount -u -z %s` until it is gone)", mountPoint, mountPoint)
+	}
+	logging.Infof("Detached stale mount %s", mountPoint)
+	return nil
+}
+
+// remount replaces a server whose kernel connection broke: it detaches the
+// dead mount, uploads the dirty buffers the old tree still holds and mounts
+// a fresh root node. Buffers that fail to upload stay in the registry, so
+// .wsfs/dirty lists them and the unmount flush retries them.
+func remount(mountPoint string, deps runDeps, registry *wsfsfuse.DirtyNodeRegistry, newRoot func() (*wsfsfuse.WSNode, error), opts *fs.Options, rec *record.Recorder) (*wsfsfuse.WSNode, mountServer, error) {
+	if err := deps.lazyUnmount(mountPoint); err != nil {
+		logging.Warnf("Failed to detach %s: %v", mountPoint, err)
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	flushed, errs := registry.FlushAll(flushCtx)
+	cancel()
+	if flushed > 0 {
+		logging.Infof("Uploaded %d dirty buffer(s) kept from the lost mount", flushed)
+	}
+	for _, err := range errs {
+		logging.Errorf("Dirty buffer kept from the lost mount was not uploaded, retrying at unmount: %v", err)
+	}
+
+	root, err := newRoot()
+	if err != nil {
+		return nil, nil, fmt.Errorf("create root node: %w", err)
+	}
+	server, err := deps.mount(mountPoint, root, opts, rec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mount: %w", err)
+	}
+	return root, server, nil
+}
+
+// currentMount serves the control API from whichever root node is mounted,
+// so the socket survives remounts. auth is nil without a workspace backend.
+type currentMount struct {
+	mu   sync.RWMutex
+	root *wsfsfuse.WSNode
+	auth *workspaceAuth
+}
+
+var (
+	_ controlapi.Mount           = (*currentMount)(nil)
+	_ controlapi.Reauthenticator = (*currentMount)(nil)
+)
+
+func (m *currentMount) get() *wsfsfuse.WSNode {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.root
+}
+
+func (m *currentMount) set(root *wsfsfuse.WSNode) {
+	m.mu.Lock()
+	m.root = root
+	m.mu.Unlock()
+}
+
+func (m *currentMount) FlushPaths(ctx context.Context, paths []string) (int, []error) {
+	return m.get().FlushPaths(ctx, paths)
+}
+
+func (m *currentMount) InvalidatePaths(paths []string) int {
+	return m.get().InvalidatePaths(paths)
+}
+
+func (m *currentMount) Prefetch(ctx context.Context, path string) (wsfsfuse.PrefetchResult, error) {
+	return m.get().Prefetch(ctx, path)
+}
+
+func (m *currentMount) Pin(ctx context.Context, path string) (wsfsfuse.PrefetchResult, error) {
+	return m.get().Pin(ctx, path)
+}
+
+func (m *currentMount) Unpin(path string) (wsfsfuse.UnpinResult, error) {
+	return m.get().Unpin(path)
+}
+
+func (m *currentMount) RemoveAll(ctx context.Context, path string) (wsfsfuse.RemoveResult, error) {
+	return m.get().RemoveAll(ctx, path)
+}
+
+func (m *currentMount) ResolveObjectID(ctx context.Context, objectID int64) (wsfsfuse.ResolvedObject, error) {
+	return m.get().ResolveObjectID(ctx, objectID)
+}
+
+func (m *currentMount) Search(ctx context.Context, path string, pattern *regexp.Regexp, maxMatches int) (wsfsfuse.SearchResult, error) {
+	return m.get().Search(ctx, path, pattern, maxMatches)
+}
+
+func (m *currentMount) ListTree(ctx context.Context, path string, depth int) (wsfsfuse.TreeResult, error) {
+	return m.get().ListTree(ctx, path, depth)
+}
+
+func (m *currentMount) Stats() wsfsfuse.MountStats {
+	return m.get().Stats()
+}
+
+func (m *currentMount) Reauth(ctx context.Context) (controlapi.ReauthResponse, error) {
+	if m.auth == nil {
+		return controlapi.ReauthResponse{}, fmt.Errorf("the mount does not use workspace credentials: %w", errors.ErrUnsupported)
+	}
+	return m.auth.Reauth(ctx)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/user"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+	"github.com/hanwen/go-fuse/v2/fs"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/faultinject"
+	"wsfs/internal/filecache"
+	wsfsfuse "wsfs/internal/fuse"
+	"wsfs/internal/record"
+)
+
+// superviseHarness runs wsfs against fake mounts whose FUSE connection the
+// test can break.
+type superviseHarness struct {
+	deps runDeps
+
+	mu       sync.Mutex
+	servers  []*fakeServer
+	mountErr error
+
+	lost      atomic.Bool // the mount point stats as ENOTCONN
+	detached  atomic.Int32
+	newServer chan *fakeServer
+	shutdown  context.CancelFunc
+}
+
+func newSuperviseHarness(t *testing.T) *superviseHarness {
+	t.Helper()
+	h := &superviseHarness{newServer: make(chan *fakeServer, 8)}
+	deps := testDeps()
+	deps.faultInjector = func() (*faultinject.Injector, error) { return nil, nil }
+	deps.initWorkspace = func(http.RoundTripper) (*databrickssdk.WorkspaceClient, error) {
+		return &databrickssdk.WorkspaceClient{}, nil
+	}
+	deps.workspaceMe = func(ctx context.Context, w *databrickssdk.WorkspaceClient) (string, error) {
+		return "Tester", nil
+	}
+	deps.currentUser = func() (*user.User, error) {
+		return &user.User{Uid: "123", Gid: "456"}, nil
+	}
+	deps.newDiskCache = func() (*filecache.DiskCache, error) {
+		return filecache.NewDisabledCache(), nil
+	}
+	deps.newWorkspaceFilesClient = func(*databrickssdk.WorkspaceClient) (databricks.WorkspaceFilesAPI, error) {
+		return &fakeWorkspaceFilesClient{}, nil
+	}
+	deps.newRootNode = func(api databricks.WorkspaceFilesAPI, cache *filecache.DiskCache, rootPath string, registry *wsfsfuse.DirtyNodeRegistry, config *wsfsfuse.NodeConfig) (*wsfsfuse.WSNode, error) {
+		return &wsfsfuse.WSNode{}, nil
+	}
+	deps.mount = func(mountPoint string, root fs.InodeEmbedder, opts *fs.Options, rec *record.Recorder) (mountServer, error) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if len(h.servers) > 0 && h.mountErr != nil {
+			return nil, h.mountErr
+		}
+		server := &fakeServer{waitCh: make(chan struct{})}
+		h.servers = append(h.servers, server)
+		h.newServer <- server
+		return server, nil
+	}
+	signalCtx, shutdown := context.WithCancel(context.Background())
+	h.shutdown = shutdown
+	deps.signalContext = func() (context.Context, context.CancelFunc) {
+		return signalCtx, func() {}
+	}
+	deps.statMountPoint = func(string) error {
+		if h.lost.Load() {
+			return syscall.ENOTCONN
+		}
+		return nil
+	}
+	deps.mountedFsType = func(string) (string, bool) {
+		return "fuse.wsfs", true
+	}
+	deps.lazyUnmount = func(string) error {
+		h.detached.Add(1)
+		h.lost.Store(false)
+		return nil
+	}
+	deps.remountBackoff = 0
+	h.deps = deps
+	return h
+}
+
+func (h *superviseHarness) run(args ...string) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- run(append(append([]string{"wsfs"}, args...), "/mnt/wsfs"), h.deps)
+	}()
+	return done
+}
+
+func (h *superviseHarness) nextServer(t *testing.T) *fakeServer {
+	t.Helper()
+	select {
+	case server := <-h.newServer:
+		return server
+	case <-time.After(2 * time.Second):
+		t.Fatal("no mount happened")
+		return nil
+	}
+}
+
+// breakConnection makes server exit as if the kernel dropped the FUSE
+// connection.
+func (h *superviseHarness) breakConnection(server *fakeServer) {
+	h.lost.Store(true)
+	server.Unmount()
+}
+
+func waitRun(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("run did not return")
+		return nil
+	}
+}
+
+func TestRunSuperviseRemountsAfterConnectionLoss(t *testing.T) {
+	h := newSuperviseHarness(t)
+	done := h.run("--supervise")
+
+	h.breakConnection(h.nextServer(t))
+	second := h.nextServer(t)
+	if h.detached.Load() != 1 {
+		t.Fatalf("lazy unmounts = %d, want 1", h.detached.Load())
+	}
+
+	h.shutdown()
+	if err := waitRun(t, done); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	second.unmountMu.Lock()
+	defer second.unmountMu.Unlock()
+	if !second.unmounted {
+		t.Fatal("shutdown did not unmount the remounted server")
+	}
+}
+
+func TestRunSuperviseGivesUp(t *testing.T) {
+	h := newSuperviseHarness(t)
+	h.mountErr = errors.New("fuse: device not found")
+	done := h.run("--supervise", "--max-remounts=2")
+
+	h.breakConnection(h.nextServer(t))
+	err := waitRun(t, done)
+	if err == nil || !strings.Contains(err.Error(), "gave up after 2 remount(s)") {
+		t.Fatalf("run = %v, want it to give up", err)
+	}
+	if h.detached.Load() != 2 {
+		t.Fatalf("lazy unmounts = %d, want one per attempt", h.detached.Load())
+	}
+}
+
+func TestRunExitsOnConnectionLossWithoutSupervise(t *testing.T) {
+	h := newSuperviseHarness(t)
+	done := h.run()
+
+	h.breakConnection(h.nextServer(t))
+	if err := waitRun(t, done); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if h.detached.Load() != 0 {
+		t.Fatal("unsupervised mount was detached")
+	}
+}
+
+func TestRunSuperviseStopsAfterExternalUnmount(t *testing.T) {
+	h := newSuperviseHarness(t)
+	done := h.run("--supervise")
+
+	// fusermount -u leaves a plain directory behind.
+	h.nextServer(t).Unmount()
+	if err := waitRun(t, done); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	select {
+	case <-h.newServer:
+		t.Fatal("remounted after an external unmount")
+	default:
+	}
+}
+
+func TestRunClearsStaleMount(t *testing.T) {
+	h := newSuperviseHarness(t)
+	h.lost.Store(true)
+	done := h.run("--recover-stale-mount")
+
+	h.nextServer(t)
+	if h.detached.Load() != 1 {
+		t.Fatalf("lazy unmounts = %d, want the stale mount detached", h.detached.Load())
+	}
+	h.shutdown()
+	if err := waitRun(t, done); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
+
+func TestRunRefusesStaleMountWithoutRecovery(t *testing.T) {
+	h := newSuperviseHarness(t)
+	h.lost.Store(true)
+	err := waitRun(t, h.run())
+	if err == nil || !strings.Contains(err.Error(), "fusermount -u -z /mnt/wsfs") {
+		t.Fatalf("run = %v, want a hint to detach the stale mount", err)
+	}
+	if h.detached.Load() != 0 || len(h.servers) != 0 {
+		t.Fatalf("lazy unmounts = %d, mounts = %d, want neither", h.detached.Load(), len(h.servers))
+	}
+}
+
+func TestRunLeavesForeignStaleMountAlone(t *testing.T) {
+	h := newSuperviseHarness(t)
+	h.lost.Store(true)
+	h.deps.mountedFsType = func(string) (string, bool) { return "fuse.sshfs", true }
+	err := waitRun(t, h.run("--recover-stale-mount"))
+	if err == nil || !strings.Contains(err.Error(), "not a wsfs one (fuse.sshfs)") {
+		t.Fatalf("run = %v, want the sshfs mount refused", err)
+	}
+	if h.detached.Load() != 0 || len(h.servers) != 0 {
+		t.Fatalf("lazy unmounts = %d, mounts = %d, want neither", h.detached.Load(), len(h.servers))
+	}
+}
+
+func TestRunReportsFailedStaleMountRecovery(t *testing.T) {
+	h := newSuperviseHarness(t)
+	h.lost.Store(true)
+	h.deps.lazyUnmount = func(string) error { return errors.New("fusermount: permission denied") }
+	err := waitRun(t, h.run("--recover-stale-mount"))
+	if err == nil || !strings.Contains(err.Error(), "detach stale mount /mnt/wsfs") || len(h.servers) != 0 {
+		t.Fatalf("run = %v after %d mounts, want the failed detach reported before mounting", err, len(h.servers))
+	}
+}
+
+func TestParseArgsSupervise(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.supervise || cfg.maxRemounts != defaultMaxRemounts {
+		t.Fatalf("defaults = %v %d", cfg.supervise, cfg.maxRemounts)
+	}
+
+	if cfg.recoverStaleMount {
+		t.Fatal("--recover-stale-mount is on by default")
+	}
+
+	cfg, err = parseArgs([]string{"wsfs", "--supervise", "--max-remounts=3", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if !cfg.supervise || cfg.maxRemounts != 3 {
+		t.Fatalf("supervise config = %v %d", cfg.supervise, cfg.maxRemounts)
+	}
+
+	_, err = parseArgs([]string{"wsfs", "--max-remounts=-1", "/mnt/wsfs"})
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+		t.Fatalf("expected exit code 2 for a negative --max-remounts, got %v", err)
+	}
+}
+
+func TestRemountBackoff(t *testing.T) {
+	for n, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		6: 30 * time.Second,
+		9: 30 * time.Second,
+	} {
+		if got := remountBackoff(time.Second, n); got != want {
+			t.Fatalf("remountBackoff(%d) = %s, want %s", n, got, want)
+		}
+	}
+	if got := remountBackoff(0, 3); got != 0 {
+		t.Fatalf("remountBackoff with zero base = %s", got)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"wsfs/internal/controlapi"
+)
+
+// treeTimeout bounds a tree request, which may list a large part of the
+// workspace.
+const treeTimeout = 10 * time.Minute
+
+// runTree implements `wsfs tree`: a running mount lists a tree breadth
+// first with concurrent list calls through its metadata cache, and prints
+// one path per line, directories with a trailing slash.
+func runTree(program string, args []string, stdout io.Writer) error {
+	usage := fmt.Sprintf("Usage: %s tree --control-socket SOCKET [--depth N] [--json] [PATH]", program)
+	fs := flag.NewFlagSet(program+" tree", flag.ContinueOnError)
+	controlSocket := fs.String("control-socket", "", "control API socket of the mount to list (the mount's --control-socket)")
+	depth := fs.Int("depth", 0, "levels to list; 1 lists only the children of PATH (0 is unlimited)")
+	jsonOutput := fs.Bool("json", false, "print the result as JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return &cliError{exitCode: 0, printed: true}
+		}
+		return &cliError{exitCode: 2, msg: err.Error(), printed: true}
+	}
+	if fs.NArg() > 1 {
+		return &cliError{exitCode: 2, msg: usage}
+	}
+	if *controlSocket == "" {
+		return &cliError{exitCode: 2, msg: "tree needs --control-socket of a running mount"}
+	}
+	if *depth < 0 {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("invalid --depth: %d", *depth)}
+	}
+	req := controlapi.TreeRequest{Path: "/", Depth: *depth}
+	if fs.NArg() == 1 {
+		req.Path = fs.Arg(0)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), treeTimeout)
+	defer cancel()
+	result, err := controlapi.NewClient(*controlSocket).Tree(ctx, req)
+	var apiErr *controlapi.APIError
+	if errors.As(err, &apiErr) && errors.Is(apiErr, os.ErrNotExist) {
+		return &cliError{exitCode: 2, msg: fmt.Sprintf("%s: no such file or directory below the mount root", req.Path)}
+	}
+	if errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+		return &cliError{exitCode: 2, msg: apiErr.Message}
+	}
+	if err != nil {
+		return fmt.Errorf("list %s: %w", req.Path, err)
+	}
+
+	if *jsonOutput {
+		return printJSON(stdout, result)
+	}
+	for _, entry := range result.Entries {
+		if entry.IsDir {
+			fmt.Fprintf(stdout, "%s/\n", entry.Path)
+		} else {
+			fmt.Fprintln(stdout, entry.Path)
+		}
+	}
+	return nil
+}
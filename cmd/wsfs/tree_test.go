@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"wsfs/internal/controlapi"
+	wsfsfuse "wsfs/internal/fuse"
+)
+
+// serveTree answers tree requests on a unix socket like a mount with
+// /src/lib/util.py and /src/main.py. It records the requests it gets.
+func serveTree(t *testing.T) (string, *[]controlapi.TreeRequest) {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var requests []controlapi.TreeRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/tree", func(w http.ResponseWriter, r *http.Request) {
+		var req controlapi.TreeRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		if req.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(wsfsfuse.TreeResult{
+			Dirs: 2,
+			Entries: []wsfsfuse.TreeEntry{
+				{Path: "/src/lib", Depth: 1, IsDir: true, ObjectType: "DIRECTORY"},
+				{Path: "/src/main.py", Depth: 1, ObjectType: "FILE"},
+				{Path: "/src/lib/util.py", Depth: 2, ObjectType: "FILE"},
+			},
+		})
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socketPath, &requests
+}
+
+func TestRunTreePrintsPaths(t *testing.T) {
+	socketPath, requests := serveTree(t)
+	deps := defaultDeps()
+	var out bytes.Buffer
+	deps.stdout = &out
+
+	if err := run([]string{"wsfs", "tree", "--control-socket", socketPath, "--depth", "2", "/src"}, deps); err != nil {
+		t.Fatalf("run tree: %v", err)
+	}
+	if want := "/src/lib/\n/src/main.py\n/src/lib/util.py\n"; out.String() != want {
+		t.Fatalf("output = %q, want %q", out.String(), want)
+	}
+	if got := (*requests)[0]; got != (controlapi.TreeRequest{Path: "/src", Depth: 2}) {
+		t.Fatalf("unexpected request %+v", got)
+	}
+
+	out.Reset()
+	if err := run([]string{"wsfs", "tree", "--json", "--control-socket", socketPath}, deps); err != nil {
+		t.Fatalf("run tree --json: %v", err)
+	}
+	var result wsfsfuse.TreeResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil || len(result.Entries) != 3 {
+		t.Fatalf("--json output = %q, %v", out.String(), err)
+	}
+	if got := (*requests)[1]; got != (controlapi.TreeRequest{Path: "/"}) {
+		t.Fatalf("unexpected request without a path %+v", got)
+	}
+}
+
+func TestRunTreeUsageErrors(t *testing.T) {
+	socketPath, _ := serveTree(t)
+	deps := defaultDeps()
+	deps.stdout = &bytes.Buffer{}
+
+	for _, args := range [][]string{
+		{"wsfs", "tree", "/src"},
+		{"wsfs", "tree", "--control-socket", socketPath, "a", "b"},
+		{"wsfs", "tree", "--control-socket", socketPath, "--depth=-1"},
+		{"wsfs", "tree", "--control-socket", socketPath, "/missing"},
+	} {
+		err := run(args, deps)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("run %v = %v, want exit code 2", args[2:], err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"wsfs/internal/controlapi"
+	wsfsfuse "wsfs/internal/fuse"
+)
+
+// umountTimeout bounds `wsfs umount`, including the mount's own flush of
+// up to shutdownTimeout.
+const umountTimeout = shutdownTimeout + 30*time.Second
+
+// umountPollInterval is how often `wsfs umount` checks whether the mount is
+// gone.
+const umountPollInterval = 100 * time.Millisecond
+
+// runUmount implements `wsfs umount`: it unmounts a running mount through
+// its control API, but refuses while files have unsaved changes unless
+// --flush-first uploads them or --force accepts losing them.
+func runUmount(program string, args []string, stdout io.Writer) error {
+	usage := fmt.Sprintf("Usage: %s umount --control-socket SOCKET [--flush-first] [--force]", program)
+	fs := flag.NewFlagSet(program+" umount", flag.ContinueOnError)
+	controlSocket := fs.String("control-socket", "", "control API socket of the mount to unmount (the mount's --control-socket)")
+	flushFirst := fs.Bool("flush-first", false, "upload unsaved changes first and refuse to unmount if an upload fails")
+	force := fs.Bool("force", false, "unmount even if files still have unsaved changes; those changes are lost")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return &cliError{exitCode: 0, printed: true}
+		}
+		return &cliError{exitCode: 2, msg: err.Error(), printed: true}
+	}
+	if fs.NArg() != 0 {
+		return &cliError{exitCode: 1, msg: usage}
+	}
+	if *controlSocket == "" {
+		return &cliError{exitCode: 2, msg: "umount needs --control-socket of a running mount"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), umountTimeout)
+	defer cancel()
+	client := controlapi.NewClient(*controlSocket)
+
+	if *flushFirst {
+		err := client.Flush(ctx, nil)
+		var apiErr *controlapi.APIError
+		if err != nil && !errors.As(err, &apiErr) {
+			return fmt.Errorf("flush: %w", err)
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "Flush failed: %s\n", apiErr.Message)
+		}
+	}
+
+	stats, err := client.Stats(ctx)
+	if err != nil {
+		return fmt.Errorf("read mount state: %w", err)
+	}
+	if len(stats.Dirty) > 0 {
+		writeDirtyEntries(stdout, stats.Dirty)
+		if !*force {
+			hint := "use --flush-first to upload them or --force to unmount anyway"
+			if *flushFirst {
+				hint = "they could not be uploaded; fix the errors above or use --force to unmount anyway"
+			}
+			return &cliError{exitCode: 1, msg: fmt.Sprintf("refusing to unmount: %d file(s) have unsaved changes; %s", len(stats.Dirty), hint)}
+		}
+		fmt.Fprintf(stdout, "Unmounting anyway; changes that fail the final flush are lost\n")
+	}
+
+	if err := client.Unmount(ctx, *force); err != nil {
+		return fmt.Errorf("unmount: %w", err)
+	}
+	if err := waitUnmounted(ctx, client); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "Unmounted")
+	return nil
+}
+
+// waitUnmounted polls the control API until the mount stops answering. The
+// socket is removed when the mount exits.
+func waitUnmounted(ctx context.Context, client *controlapi.Client) error {
+	ticker := time.NewTicker(umountPollInterval)
+	defer ticker.Stop()
+	for {
+		_, err := client.Stats(ctx)
+		var apiErr *controlapi.APIError
+		if err != nil && !errors.As(err, &apiErr) && ctx.Err() == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return &cliError{exitCode: 1, msg: "the mount is still up; files may have failed to flush, see its log"}
+		case <-ticker.C:
+		}
+	}
+}
+
+func writeDirtyEntries(w io.Writer, entries []wsfsfuse.DirtyEntry) {
+	now := time.Now()
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\tunsaved for %s\t%d bytes\n", entry.Path, now.Sub(entry.Since).Round(time.Second), entry.Size)
+	}
+}
+
+// flushBeforeUnmount flushes every dirty buffer and reports whether the
+// mount may go away: always when forced, otherwise only when no file is
+// left with unsaved changes. Files left dirty are listed on report.
+func flushBeforeUnmount(registry *wsfsfuse.DirtyNodeRegistry, force bool, report io.Writer) bool {
+	log.Println("Shutdown requested, flushing dirty buffers...")
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	flushed, errs := registry.FlushAll(flushCtx)
+	for _, err := range errs {
+		log.Printf("Flush error: %v", err)
+	}
+	if flushed > 0 {
+		log.Printf("Flushed %d dirty buffer(s)", flushed)
+	}
+
+	remaining := registry.Entries()
+	if len(remaining) == 0 {
+		return true
+	}
+	reportUnflushed(report, remaining, force)
+	return force
+}
+
+// reportUnflushed tells the user which workspace files still have changes
+// that were not uploaded, and why, so they know what to save again.
+func reportUnflushed(w io.Writer, entries []wsfsfuse.DirtyEntry, force bool) {
+	fmt.Fprintf(w, "wsfs: %d file(s) have changes that were not uploaded to the workspace:\n", len(entries))
+	for _, entry := range entries {
+		reason := entry.Error
+		if reason == "" {
+			reason = "not flushed before the deadline"
+		}
+		fmt.Fprintf(w, "  %s\t%d bytes, unsaved since %s: %s\n", entry.Path, entry.Size, entry.Since.Format(time.RFC3339), reason)
+	}
+	if force {
+		fmt.Fprintln(w, "wsfs: unmounting anyway; these changes are lost. Save the files again after remounting.")
+		return
+	}
+	fmt.Fprintln(w, "wsfs: not unmounting. Fix the errors and retry, or press Ctrl+C again or run `wsfs umount --force` to unmount anyway.")
+}
+
+// watchShutdown waits for a signal or an unmount request and calls unmount
+// once flushBeforeUnmount allows it. After a refused attempt, the next
+// signal forces the unmount. It returns when done is cancelled.
+func watchShutdown(done context.Context, signalContext func() (context.Context, context.CancelFunc), requests <-chan bool, registry *wsfsfuse.DirtyNodeRegistry, unmount func()) {
+	signalCtx, stop := signalContext()
+	defer func() { stop() }()
+
+	signaled := false
+	for {
+		force := false
+		select {
+		case <-done.Done():
+			return
+		case <-signalCtx.Done():
+			// Re-arm before releasing the old context so another Ctrl+C
+			// is caught instead of killing the process with dirty buffers.
+			next, nextStop := signalContext()
+			stop()
+			signalCtx, stop = next, nextStop
+			force = signaled
+			signaled = true
+		case force = <-requests:
+		}
+		if flushBeforeUnmount(registry, force, os.Stderr) {
+			unmount()
+			return
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/controlapi"
+	"wsfs/internal/databricks"
+	"wsfs/internal/filecache"
+	wsfsfuse "wsfs/internal/fuse"
+)
+
+// umountMount is a mount with one dirty file. Flushing clears it unless
+// flushFails is set.
+type umountMount struct {
+	mu         sync.Mutex
+	dirty      []wsfsfuse.DirtyEntry
+	flushFails bool
+}
+
+func (m *umountMount) FlushPaths(ctx context.Context, paths []string) (int, []error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.flushFails {
+		return 0, []error{errors.New("flush /nb.py: errno 5")}
+	}
+	flushed := len(m.dirty)
+	m.dirty = nil
+	return flushed, nil
+}
+
+func (m *umountMount) InvalidatePaths(paths []string) int { return 0 }
+
+func (m *umountMount) Prefetch(ctx context.Context, path string) (wsfsfuse.PrefetchResult, error) {
+	return wsfsfuse.PrefetchResult{}, nil
+}
+
+func (m *umountMount) Pin(ctx context.Context, path string) (wsfsfuse.PrefetchResult, error) {
+	return wsfsfuse.PrefetchResult{}, nil
+}
+
+func (m *umountMount) Unpin(path string) (wsfsfuse.UnpinResult, error) {
+	return wsfsfuse.UnpinResult{}, nil
+}
+
+func (m *umountMount) RemoveAll(ctx context.Context, path string) (wsfsfuse.RemoveResult, error) {
+	return wsfsfuse.RemoveResult{}, nil
+}
+
+func (m *umountMount) ResolveObjectID(ctx context.Context, objectID int64) (wsfsfuse.ResolvedObject, error) {
+	return wsfsfuse.ResolvedObject{}, os.ErrNotExist
+}
+
+func (m *umountMount) Search(ctx context.Context, path string, pattern *regexp.Regexp, maxMatches int) (wsfsfuse.SearchResult, error) {
+	return wsfsfuse.SearchResult{}, nil
+}
+
+func (m *umountMount) ListTree(ctx context.Context, path string, depth int) (wsfsfuse.TreeResult, error) {
+	return wsfsfuse.TreeResult{}, nil
+}
+
+func (m *umountMount) Stats() wsfsfuse.MountStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return wsfsfuse.MountStats{DirtyFiles: len(m.dirty), Dirty: m.dirty}
+}
+
+// serveUmount serves the control API for mount and returns its socket and a
+// channel receiving the force flag of unmount requests. An unmount request
+// stops the server, like a mount that exits.
+func serveUmount(t *testing.T, mount *umountMount) (string, <-chan bool) {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	unmounted := make(chan bool, 1)
+	var server *controlapi.Server
+	server, err := controlapi.Listen(socketPath, mount, func(force bool) {
+		unmounted <- force
+		server.Close()
+	})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return socketPath, unmounted
+}
+
+func TestRunUmount(t *testing.T) {
+	dirty := []wsfsfuse.DirtyEntry{{Path: "/Users/me/nb.py", Since: time.Now().Add(-time.Minute), Size: 12}}
+	for _, tt := range []struct {
+		name       string
+		dirty      []wsfsfuse.DirtyEntry
+		flushFails bool
+		flags      []string
+		exitCode   int // 0 when the mount is unmounted
+		force      bool
+	}{
+		{name: "clean", flags: nil},
+		{name: "dirty refuses", dirty: dirty, exitCode: 1},
+		{name: "flush first", dirty: dirty, flags: []string{"--flush-first"}},
+		{name: "flush first fails", dirty: dirty, flushFails: true, flags: []string{"--flush-first"}, exitCode: 1},
+		{name: "force", dirty: dirty, flags: []string{"--force"}, force: true},
+		{name: "flush first fails with force", dirty: dirty, flushFails: true, flags: []string{"--flush-first", "--force"}, force: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			socketPath, unmounted := serveUmount(t, &umountMount{dirty: tt.dirty, flushFails: tt.flushFails})
+			deps := defaultDeps()
+			var out bytes.Buffer
+			deps.stdout = &out
+
+			args := append([]string{"wsfs", "umount", "--control-socket", socketPath}, tt.flags...)
+			err := run(args, deps)
+			if tt.exitCode != 0 {
+				var cliErr *cliError
+				if !errors.As(err, &cliErr) || cliErr.exitCode != tt.exitCode {
+					t.Fatalf("run = %v, want exit code %d", err, tt.exitCode)
+				}
+				if !strings.Contains(out.String(), "/Users/me/nb.py\tunsaved for") {
+					t.Fatalf("output does not list the dirty file:\n%s", out.String())
+				}
+				select {
+				case <-unmounted:
+					t.Fatal("unmount was requested despite unsaved changes")
+				default:
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if !strings.HasSuffix(out.String(), "Unmounted\n") {
+				t.Fatalf("unexpected output:\n%s", out.String())
+			}
+			if force := <-unmounted; force != tt.force {
+				t.Fatalf("unmount force = %v, want %v", force, tt.force)
+			}
+		})
+	}
+}
+
+func TestRunUmountUsageErrors(t *testing.T) {
+	deps := defaultDeps()
+	deps.stdout = &bytes.Buffer{}
+	for _, tt := range []struct {
+		args     []string
+		exitCode int
+	}{
+		{[]string{"wsfs", "umount"}, 2},
+		{[]string{"wsfs", "umount", "--control-socket", "x.sock", "/mnt/wsfs"}, 1},
+		{[]string{"wsfs", "umount", "--bogus"}, 2},
+	} {
+		err := run(tt.args, deps)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != tt.exitCode {
+			t.Fatalf("run %v = %v, want exit code %d", tt.args[2:], err, tt.exitCode)
+		}
+	}
+
+	err := run([]string{"wsfs", "umount", "--control-socket", filepath.Join(t.TempDir(), "none.sock")}, deps)
+	if err == nil || !strings.Contains(err.Error(), "read mount state") {
+		t.Fatalf("run without a mount = %v", err)
+	}
+}
+
+// failingWrites makes uploads fail while fail is set.
+type failingWrites struct {
+	databricks.WorkspaceFilesAPI
+	fail atomic.Bool
+}
+
+func (b *failingWrites) Write(ctx context.Context, filePath string, data []byte) error {
+	if b.fail.Load() {
+		return errors.New("upload refused")
+	}
+	return b.WorkspaceFilesAPI.Write(ctx, filePath, data)
+}
+
+// dirtyRegistry returns a registry holding one file with unsaved changes
+// whose uploads fail until the returned backend's fail flag is cleared.
+func dirtyRegistry(t *testing.T) (*wsfsfuse.DirtyNodeRegistry, *failingWrites) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("old\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	local, err := backend.NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	api := &failingWrites{WorkspaceFilesAPI: local}
+	api.fail.Store(true)
+	registry := wsfsfuse.NewDirtyNodeRegistry()
+	root, err := wsfsfuse.NewRootNode(api, filecache.NewDisabledCache(), "/", registry, nil)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+
+	ctx := context.Background()
+	child, errno := root.Lookup(ctx, "notes.txt", &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Lookup errno %d", errno)
+	}
+	node := child.Operations().(*wsfsfuse.WSNode)
+	if _, _, errno := node.Open(ctx, uint32(os.O_RDWR)); errno != 0 {
+		t.Fatalf("Open errno %d", errno)
+	}
+	if _, errno := node.Write(ctx, nil, []byte("new\n"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	return registry, api
+}
+
+func TestFlushBeforeUnmount(t *testing.T) {
+	registry, api := dirtyRegistry(t)
+
+	var report bytes.Buffer
+	if flushBeforeUnmount(registry, false, &report) {
+		t.Fatal("unmount allowed while a flush failed")
+	}
+	if len(registry.Entries()) != 1 {
+		t.Fatalf("dirty entries = %v, want the unsaved file", registry.Entries())
+	}
+	for _, want := range []string{"1 file(s) have changes that were not uploaded", "/notes.txt\t4 bytes", "upload refused", "not unmounting"} {
+		if !strings.Contains(report.String(), want) {
+			t.Fatalf("report = %q, want %q", report.String(), want)
+		}
+	}
+	report.Reset()
+	if !flushBeforeUnmount(registry, true, &report) {
+		t.Fatal("forced unmount refused")
+	}
+	if !strings.Contains(report.String(), "/notes.txt") || !strings.Contains(report.String(), "these changes are lost") {
+		t.Fatalf("forced report = %q", report.String())
+	}
+
+	api.fail.Store(false)
+	report.Reset()
+	if !flushBeforeUnmount(registry, false, &report) {
+		t.Fatal("unmount refused after a successful flush")
+	}
+	if report.Len() != 0 {
+		t.Fatalf("report after a successful flush = %q", report.String())
+	}
+	if len(registry.Entries()) != 0 {
+		t.Fatalf("dirty entries after flush = %v", registry.Entries())
+	}
+}
+
+func TestWatchShutdownSecondSignalForces(t *testing.T) {
+	registry, _ := dirtyRegistry(t)
+
+	var mu sync.Mutex
+	var cancels []context.CancelFunc
+	signalContext := func() (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		mu.Lock()
+		cancels = append(cancels, cancel)
+		mu.Unlock()
+		return ctx, cancel
+	}
+	signal := func(i int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			mu.Lock()
+			armed := len(cancels) > i
+			if armed {
+				cancels[i]()
+			}
+			mu.Unlock()
+			if armed {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("signal %d was never armed", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	done, stop := context.WithCancel(context.Background())
+	defer stop()
+	requests := make(chan bool)
+	unmounted := make(chan struct{})
+	go watchShutdown(done, signalContext, requests, registry, func() { close(unmounted) })
+
+	// A request without force is refused; the watcher keeps running and
+	// takes the next request.
+	requests <- false
+	select {
+	case requests <- false:
+	case <-time.After(2 * time.Second):
+		t.Fatal("watcher stopped after a refused unmount")
+	}
+
+	signal(0)
+	signal(1)
+	select {
+	case <-unmounted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second signal did not force the unmount")
+	}
+	if len(registry.Entries()) != 1 {
+		t.Fatal("expected the unsaved file to stay dirty")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/databricks"
+	"wsfs/internal/logging"
+)
+
+// workspaceMember serves the workspace of a configuration profile as a
+// top-level directory of the mount ("NAME=PROFILE[,rate-limit=N]").
+type workspaceMember struct {
+	name      string
+	profile   string
+	rateLimit int // requests per second; 0 keeps the SDK default
+}
+
+func (m workspaceMember) String() string {
+	s := m.name + "=" + m.profile
+	if m.rateLimit > 0 {
+		s += ",rate-limit=" + strconv.Itoa(m.rateLimit)
+	}
+	return s
+}
+
+func parseWorkspaceMember(value string) (workspaceMember, error) {
+	name, rest, ok := strings.Cut(strings.TrimSpace(value), "=")
+	profile, options, _ := strings.Cut(rest, ",")
+	if !ok || profile == "" {
+		return workspaceMember{}, fmt.Errorf("expected NAME=PROFILE[,rate-limit=N], got %q", value)
+	}
+	if err := backend.ValidateMemberName(name); err != nil {
+		return workspaceMember{}, err
+	}
+	member := workspaceMember{name: name, profile: profile}
+	if options == "" {
+		return member, nil
+	}
+	for _, option := range strings.Split(options, ",") {
+		key, val, _ := strings.Cut(option, "=")
+		if key != "rate-limit" {
+			return workspaceMember{}, fmt.Errorf("unknown option %q (want rate-limit=N)", option)
+		}
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit <= 0 {
+			return workspaceMember{}, fmt.Errorf("rate-limit %q is not a positive number of requests per second", val)
+		}
+		member.rateLimit = limit
+	}
+	return member, nil
+}
+
+// memberWorkspace is a logged-in --workspace member.
+type memberWorkspace struct {
+	workspaceMember
+	client *databrickssdk.WorkspaceClient
+	auth   *workspaceAuth
+}
+
+// connectWorkspaces logs in to the profile of every --workspace member.
+// Each member gets its own client, so it keeps its own credentials and
+// rate limit.
+func connectWorkspaces(cfg cliConfig, transport http.RoundTripper, deps runDeps) ([]memberWorkspace, error) {
+	members := make([]memberWorkspace, 0, len(cfg.workspaces))
+	for _, member := range cfg.workspaces {
+		w, err := deps.initProfileWorkspace(transport, member.profile, member.rateLimit)
+		if err != nil {
+			return nil, withMountHint("Failed to create Databricks client for /"+member.name, err, workspaceTarget{profile: member.profile}, "/")
+		}
+		var auth *workspaceAuth
+		if w != nil && w.Config != nil {
+			auth = newWorkspaceAuth(w, func() (*databrickssdk.WorkspaceClient, error) {
+				return deps.initProfileWorkspace(transport, member.profile, member.rateLimit)
+			}, deps.workspaceMe)
+		}
+		displayName, err := deps.workspaceMe(context.Background(), w)
+		if err != nil {
+			return nil, withMountHint("Failed to get current user for /"+member.name, err, targetOf(w), "/")
+		}
+		logging.Infof("Hello, %s! Mounting %s on /%s...", displayName, targetOf(w), member.name)
+		members = append(members, memberWorkspace{workspaceMember: member, client: w, auth: auth})
+	}
+	return members, nil
+}
+
+// buildFederation serves the workspace files of every member under its
+// name, wrapped in a Snapshot with --snapshot.
+func buildFederation(cfg cliConfig, members []memberWorkspace, deps runDeps) (databricks.WorkspaceFilesAPI, error) {
+	federated := make([]backend.Member, 0, len(members))
+	for _, member := range members {
+		api, err := openWorkspaceFiles(cfg, member.client, deps)
+		if err != nil {
+			return nil, fmt.Errorf("workspace /%s: %w", member.name, err)
+		}
+		federated = append(federated, backend.Member{Name: member.name, Backend: api})
+	}
+	api, err := backend.NewFederation(federated...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.snapshot {
+		return backend.WithSnapshot(api), nil
+	}
+	return api, nil
+}
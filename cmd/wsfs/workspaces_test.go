@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/databricks"
+)
+
+func TestParseWorkspaceMember(t *testing.T) {
+	member, err := parseWorkspaceMember("prod=PROD,rate-limit=5")
+	if err != nil {
+		t.Fatalf("parseWorkspaceMember failed: %v", err)
+	}
+	if member.name != "prod" || member.profile != "PROD" || member.rateLimit != 5 {
+		t.Fatalf("unexpected member: %+v", member)
+	}
+	if member.String() != "prod=PROD,rate-limit=5" {
+		t.Fatalf("String() = %q", member.String())
+	}
+
+	for _, value := range []string{"prod", "prod=", "=PROD", "a/b=PROD", "prod=PROD,rate-limit=0", "prod=PROD,burst=3"} {
+		if _, err := parseWorkspaceMember(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
+
+func TestParseArgsWorkspaces(t *testing.T) {
+	cfg, err := parseArgs([]string{"wsfs", "--workspace=prod=PROD", "--workspace=staging=STAGING,rate-limit=2", "/mnt/wsfs"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if len(cfg.workspaces) != 2 || cfg.workspaces[1].rateLimit != 2 {
+		t.Fatalf("unexpected workspaces: %+v", cfg.workspaces)
+	}
+	if cfg.needsWorkspace() {
+		t.Fatal("members must not log in to the default workspace")
+	}
+
+	for _, args := range [][]string{
+		{"wsfs", "--workspace=prod=PROD", "--workspace=prod=OTHER", "/mnt/wsfs"},
+		{"wsfs", "--workspace=prod=PROD", "--remote-path=/Users", "/mnt/wsfs"},
+		{"wsfs", "--workspace=prod=PROD", "--backend=" + testLocalBackend, "/mnt/wsfs"},
+	} {
+		_, err := parseArgs(args)
+		var cliErr *cliError
+		if !errors.As(err, &cliErr) || cliErr.exitCode != 2 {
+			t.Fatalf("expected exit code 2 for %v, got %v", args, err)
+		}
+	}
+}
+
+func TestBuildFederationOpensOneClientPerMember(t *testing.T) {
+	prod, staging := &databrickssdk.WorkspaceClient{}, &databrickssdk.WorkspaceClient{}
+	opened := map[*databrickssdk.WorkspaceClient]int{}
+	deps := testDeps()
+	deps.newWorkspaceFilesClient = func(w *databrickssdk.WorkspaceClient) (databricks.WorkspaceFilesAPI, error) {
+		opened[w]++
+		return &fakeWorkspaceFilesClient{}, nil
+	}
+	members := []memberWorkspace{
+		{workspaceMember: workspaceMember{name: "prod", profile: "PROD"}, client: prod},
+		{workspaceMember: workspaceMember{name: "staging", profile: "STAGING"}, client: staging},
+	}
+
+	api, err := buildFederation(cliConfig{}, members, deps)
+	if err != nil {
+		t.Fatalf("buildFederation failed: %v", err)
+	}
+	if _, ok := api.(*backend.Federation); !ok {
+		t.Fatalf("expected federation, got %T", api)
+	}
+	if opened[prod] != 1 || opened[staging] != 1 {
+		t.Fatalf("expected one files client per member, got %v", opened)
+	}
+
+	api, err = buildFederation(cliConfig{snapshot: true}, members, deps)
+	if err != nil {
+		t.Fatalf("buildFederation failed: %v", err)
+	}
+	if _, ok := api.(*backend.Snapshot); !ok {
+		t.Fatalf("expected snapshot over the federation, got %T", api)
+	}
+}
@@ -5,6 +5,7 @@ go 1.22.2
 require (
 	github.com/databricks/databricks-sdk-go v0.118.0
 	github.com/hanwen/go-fuse/v2 v2.9.0
+	golang.org/x/text v0.21.0
 )
 
 require (
@@ -32,7 +33,6 @@ require (
 	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/oauth2 v0.20.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
-	golang.org/x/text v0.21.0 // indirect
 	golang.org/x/time v0.5.0 // indirect
 	google.golang.org/api v0.182.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240521202816-d264139d666e // indirect
@@ -0,0 +1,102 @@
+// Package backend names the storage backends a mount can use and routes
+// paths to them. Every backend implements databricks.WorkspaceFilesAPI, so
+// WSNode works unchanged on top of any of them or of a Router.
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	databrickssdk "github.com/databricks/databricks-sdk-go"
+
+	"wsfs/internal/databricks"
+)
+
+// Backend is the storage contract documented on databricks.WorkspaceFilesAPI.
+type Backend = databricks.WorkspaceFilesAPI
+
+// WorkspaceName is the built-in backend for Databricks workspace files.
+const WorkspaceName = "workspace"
+
+// Options carries what a factory may need to build a backend.
+type Options struct {
+	// Workspace is the authenticated Databricks client. It is nil when no
+	// configured backend needs Databricks.
+	Workspace *databrickssdk.WorkspaceClient
+	// Arg is the backend-specific argument from "name:arg", e.g. a directory.
+	Arg string
+}
+
+// Factory builds a backend from Options.
+type Factory func(opts Options) (Backend, error)
+
+var (
+	registryMu sync.RWMutex
+	factories  = map[string]Factory{}
+)
+
+// Register makes a backend available by name. It panics if the name is
+// empty, the factory is nil, or the name is already registered.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if name == "" || factory == nil {
+		panic("backend: Register requires a name and factory")
+	}
+	if _, dup := factories[name]; dup {
+		panic("backend: Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// Names returns the registered backend names in sorted order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Registered reports whether a backend with the given name exists.
+func Registered(name string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// New builds the named backend.
+func New(name string, opts Options) (Backend, error) {
+	registryMu.RLock()
+	factory, ok := factories[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %v)", name, Names())
+	}
+	return factory(opts)
+}
+
+// Close releases what b holds, such as its metadata cache, when b
+// implements io.Closer. It is called at unmount.
+func Close(b Backend) error {
+	if closer, ok := b.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func init() {
+	Register(WorkspaceName, func(opts Options) (Backend, error) {
+		if opts.Workspace == nil {
+			return nil, errors.New("workspace backend requires a Databricks client")
+		}
+		return databricks.NewWorkspaceFilesClient(opts.Workspace)
+	})
+}
@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"wsfs/internal/databricks"
+)
+
+func TestWorkspaceBackendIsRegistered(t *testing.T) {
+	if !Registered(WorkspaceName) {
+		t.Fatalf("expected %q to be registered, got %v", WorkspaceName, Names())
+	}
+	if _, err := New(WorkspaceName, Options{}); err == nil {
+		t.Fatal("expected workspace backend to require a Databricks client")
+	}
+}
+
+func TestRegisterAndNew(t *testing.T) {
+	fake := &databricks.FakeWorkspaceAPI{}
+	Register("test-register", func(opts Options) (Backend, error) {
+		if opts.Arg != "arg" {
+			t.Fatalf("unexpected arg %q", opts.Arg)
+		}
+		return fake, nil
+	})
+
+	got, err := New("test-register", Options{Arg: "arg"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if got != fake {
+		t.Fatal("expected factory result")
+	}
+
+	names := Names()
+	for i := 1; i < len(names); i++ {
+		if names[i-1] > names[i] {
+			t.Fatalf("expected sorted names, got %v", names)
+		}
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected duplicate Register to panic")
+		}
+	}()
+	Register(WorkspaceName, func(Options) (Backend, error) { return nil, nil })
+}
+
+func TestNewUnknownBackend(t *testing.T) {
+	_, err := New("does-not-exist", Options{})
+	if err == nil || !strings.Contains(err.Error(), "unknown backend") {
+		t.Fatalf("expected unknown backend error, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"time"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/faultinject"
+)
+
+// Faulty wraps a backend and injects latency, 429s, 500s and partial reads
+// from an Injector before each call reaches it. Signed URL faults only apply
+// to the workspace client's HTTP transport.
+type Faulty struct {
+	backend  Backend
+	injector *faultinject.Injector
+}
+
+var (
+	_ Backend                   = (*Faulty)(nil)
+	_ databricks.RepoWarmer     = (*Faulty)(nil)
+	_ databricks.BatchStater    = (*Faulty)(nil)
+	_ databricks.ChunkWriter    = (*Faulty)(nil)
+	_ databricks.ChunkSupporter = (*Faulty)(nil)
+)
+
+// WithFaults returns b wrapped by injector, or b itself when injector is nil.
+func WithFaults(b Backend, injector *faultinject.Injector) Backend {
+	if injector == nil {
+		return b
+	}
+	return &Faulty{backend: b, injector: injector}
+}
+
+// before applies latency and a possible call error.
+func (f *Faulty) before(ctx context.Context) error {
+	if err := f.injector.Delay(ctx); err != nil {
+		return err
+	}
+	return f.injector.CallError()
+}
+
+func (f *Faulty) Stat(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	if err := f.before(ctx); err != nil {
+		return nil, err
+	}
+	return f.backend.Stat(ctx, filePath)
+}
+
+func (f *Faulty) StatFresh(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	if err := f.before(ctx); err != nil {
+		return nil, err
+	}
+	return f.backend.StatFresh(ctx, filePath)
+}
+
+func (f *Faulty) ReadDir(ctx context.Context, dirPath string) ([]iofs.DirEntry, error) {
+	if err := f.before(ctx); err != nil {
+		return nil, err
+	}
+	return f.backend.ReadDir(ctx, dirPath)
+}
+
+func (f *Faulty) ReadAll(ctx context.Context, filePath string) ([]byte, error) {
+	if err := f.before(ctx); err != nil {
+		return nil, err
+	}
+	data, err := f.backend.ReadAll(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if f.injector.Should(faultinject.PartialRead) {
+		return nil, fmt.Errorf("read %s: got %d of %d bytes: %w", filePath, len(data)/2, len(data), io.ErrUnexpectedEOF)
+	}
+	return data, nil
+}
+
+func (f *Faulty) Write(ctx context.Context, filePath string, data []byte) error {
+	if err := f.before(ctx); err != nil {
+		return err
+	}
+	return f.backend.Write(ctx, filePath, data)
+}
+
+func (f *Faulty) Delete(ctx context.Context, filePath string, recursive bool) error {
+	if err := f.before(ctx); err != nil {
+		return err
+	}
+	return f.backend.Delete(ctx, filePath, recursive)
+}
+
+func (f *Faulty) Mkdir(ctx context.Context, dirPath string) error {
+	if err := f.before(ctx); err != nil {
+		return err
+	}
+	return f.backend.Mkdir(ctx, dirPath)
+}
+
+func (f *Faulty) Rename(ctx context.Context, sourcePath string, destinationPath string) error {
+	if err := f.before(ctx); err != nil {
+		return err
+	}
+	return f.backend.Rename(ctx, sourcePath, destinationPath)
+}
+
+// WarmRepo injects faults before a warm-up of the wrapped backend. It fails
+// with errors.ErrUnsupported when that backend cannot warm repos.
+func (f *Faulty) WarmRepo(ctx context.Context, repoPath string) (databricks.RepoWarmResult, error) {
+	warmer, ok := f.backend.(databricks.RepoWarmer)
+	if !ok {
+		return databricks.RepoWarmResult{}, fmt.Errorf("warm repo %s: %w", repoPath, errors.ErrUnsupported)
+	}
+	if err := f.before(ctx); err != nil {
+		return databricks.RepoWarmResult{}, err
+	}
+	return warmer.WarmRepo(ctx, repoPath)
+}
+
+// BatchStat injects faults once before the batch call of the wrapped
+// backend, or before each stat when it has none.
+func (f *Faulty) BatchStat(ctx context.Context, paths []string) []databricks.StatResult {
+	stater, ok := f.backend.(databricks.BatchStater)
+	if !ok {
+		return databricks.StatFanOut(ctx, f.Stat, paths)
+	}
+	if err := f.before(ctx); err != nil {
+		results := make([]databricks.StatResult, len(paths))
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+	return stater.BatchStat(ctx, paths)
+}
+
+// SupportsChunks reports whether the wrapped backend can patch filePath.
+func (f *Faulty) SupportsChunks(filePath string) bool {
+	_, ok := databricks.ChunkWriterFor(f.backend, filePath)
+	return ok
+}
+
+// WriteChunks injects faults before a delta upload to the wrapped backend.
+// It fails with errors.ErrUnsupported when that backend cannot patch files.
+func (f *Faulty) WriteChunks(ctx context.Context, filePath string, size int64, chunks []databricks.Chunk) error {
+	writer, ok := databricks.ChunkWriterFor(f.backend, filePath)
+	if !ok {
+		return fmt.Errorf("write chunks %s: %w", filePath, errors.ErrUnsupported)
+	}
+	if err := f.before(ctx); err != nil {
+		return err
+	}
+	return writer.WriteChunks(ctx, filePath, size, chunks)
+}
+
+func (f *Faulty) CacheSet(path string, info iofs.FileInfo) {
+	f.backend.CacheSet(path, info)
+}
+
+func (f *Faulty) CacheInvalidate(filePath string) {
+	f.backend.CacheInvalidate(filePath)
+}
+
+func (f *Faulty) MetadataTTL() time.Duration {
+	return f.backend.MetadataTTL()
+}
+
+// Close closes the wrapped backend.
+func (f *Faulty) Close() error {
+	return Close(f.backend)
+}
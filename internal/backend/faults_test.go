@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/apierr"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/faultinject"
+)
+
+func TestWithFaultsNilInjectorReturnsBackend(t *testing.T) {
+	api := &databricks.FakeWorkspaceAPI{}
+	if got := WithFaults(api, nil); got != Backend(api) {
+		t.Fatalf("expected the backend itself, got %T", got)
+	}
+}
+
+func TestWithFaultsInjectsCallErrors(t *testing.T) {
+	writes := 0
+	api := &databricks.FakeWorkspaceAPI{
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			writes++
+			return nil
+		},
+	}
+	injector := faultinject.New(faultinject.Config{})
+	injector.Set(faultinject.Config{Rates: map[faultinject.Kind]float64{faultinject.ServerError: 1}})
+	b := WithFaults(api, injector)
+
+	var apiErr *apierr.APIError
+	if err := b.Write(context.Background(), "/a", []byte("x")); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected injected 500, got %v", err)
+	}
+	if writes != 0 {
+		t.Fatal("failed call must not reach the backend")
+	}
+
+	injector.Set(faultinject.Config{})
+	if err := b.Write(context.Background(), "/a", []byte("x")); err != nil || writes != 1 {
+		t.Fatalf("expected write to pass through, got %v (writes=%d)", err, writes)
+	}
+}
+
+func TestWithFaultsPartialRead(t *testing.T) {
+	api := &databricks.FakeWorkspaceAPI{
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			return []byte("content"), nil
+		},
+	}
+	b := WithFaults(api, faultinject.New(faultinject.Config{Rates: map[faultinject.Kind]float64{faultinject.PartialRead: 1}}))
+
+	data, err := b.ReadAll(context.Background(), "/a")
+	if !errors.Is(err, io.ErrUnexpectedEOF) || data != nil {
+		t.Fatalf("expected partial read error without data, got %q, %v", data, err)
+	}
+}
+
+func TestWithFaultsForwardsOptionalExtensions(t *testing.T) {
+	var calls []string
+	injector := faultinject.New(faultinject.Config{Rates: map[faultinject.Kind]float64{faultinject.ServerError: 1}})
+	b := WithFaults(&extensionFake{FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{}, name: "ext", calls: &calls}, injector)
+	ctx := context.Background()
+
+	if _, ok := databricks.ChunkWriterFor(b, "/a"); !ok {
+		t.Fatal("expected delta uploads to stay available")
+	}
+	warmer := b.(databricks.RepoWarmer)
+	stater := b.(databricks.BatchStater)
+	writer := b.(databricks.ChunkWriter)
+	if _, err := warmer.WarmRepo(ctx, "/Repos/a"); err == nil {
+		t.Fatal("expected an injected WarmRepo error")
+	}
+	if results := stater.BatchStat(ctx, []string{"/a", "/b"}); results[0].Err == nil || results[1].Err == nil {
+		t.Fatalf("expected injected BatchStat errors, got %+v", results)
+	}
+	if err := writer.WriteChunks(ctx, "/a", 1, nil); err == nil {
+		t.Fatal("expected an injected WriteChunks error")
+	}
+	if len(calls) != 0 {
+		t.Fatalf("failed calls reached the backend: %v", calls)
+	}
+
+	injector.Set(faultinject.Config{})
+	if _, err := warmer.WarmRepo(ctx, "/Repos/a"); err != nil {
+		t.Fatalf("WarmRepo: %v", err)
+	}
+	if results := stater.BatchStat(ctx, []string{"/a"}); results[0].Err != nil {
+		t.Fatalf("BatchStat: %v", results[0].Err)
+	}
+	if err := writer.WriteChunks(ctx, "/a", 1, nil); err != nil {
+		t.Fatalf("WriteChunks: %v", err)
+	}
+	if len(calls) != 3 {
+		t.Fatalf("calls = %v, want the three extensions", calls)
+	}
+
+	plain := WithFaults(&databricks.FakeWorkspaceAPI{}, injector)
+	if _, ok := databricks.ChunkWriterFor(plain, "/a"); ok {
+		t.Fatal("expected no delta uploads over a backend without them")
+	}
+	if _, err := plain.(databricks.RepoWarmer).WarmRepo(ctx, "/Repos/a"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("WarmRepo over a plain backend = %v, want ErrUnsupported", err)
+	}
+}
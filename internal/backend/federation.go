@@ -0,0 +1,335 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/databricks"
+)
+
+// ErrFederationRoot is returned for changes to the root of a Federation or
+// to its member directories. It wraps EPERM.
+var ErrFederationRoot = fmt.Errorf("the federation root only lists its workspaces: %w", syscall.EPERM)
+
+// Member is a backend a Federation serves as the top-level directory Name.
+type Member struct {
+	Name    string
+	Backend Backend
+}
+
+// Federation serves several backends, such as one workspace per profile,
+// as the top-level directories of one tree: /NAME/rest is /rest of the
+// member named NAME. The root lists the members and cannot be changed.
+// Returned metadata carries paths of the federated tree, so nodes can pass
+// them back unchanged, and each member keeps its own metadata cache.
+type Federation struct {
+	members map[string]Backend
+	names   []string // sorted
+}
+
+var (
+	_ Backend                   = (*Federation)(nil)
+	_ databricks.RepoWarmer     = (*Federation)(nil)
+	_ databricks.BatchStater    = (*Federation)(nil)
+	_ databricks.ChunkWriter    = (*Federation)(nil)
+	_ databricks.ChunkSupporter = (*Federation)(nil)
+)
+
+// NewFederation returns a Federation of members. Names must be unique,
+// non-empty directory names.
+func NewFederation(members ...Member) (*Federation, error) {
+	if len(members) == 0 {
+		return nil, errors.New("a federation needs at least one member")
+	}
+	f := &Federation{members: make(map[string]Backend, len(members))}
+	for _, member := range members {
+		if err := ValidateMemberName(member.Name); err != nil {
+			return nil, err
+		}
+		if _, dup := f.members[member.Name]; dup {
+			return nil, fmt.Errorf("duplicate federation member %q", member.Name)
+		}
+		f.members[member.Name] = member.Backend
+		f.names = append(f.names, member.Name)
+	}
+	sort.Strings(f.names)
+	return f, nil
+}
+
+// ValidateMemberName checks that name can be a top-level directory of a
+// Federation.
+func ValidateMemberName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return fmt.Errorf("invalid federation member name %q", name)
+	}
+	return nil
+}
+
+// split returns the member that owns p, its name, and p within the member.
+// It returns a nil backend for the root and for unknown top-level names.
+func (f *Federation) split(p string) (Backend, string, string) {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return nil, "", "/"
+	}
+	name, rest, _ := strings.Cut(p[1:], "/")
+	return f.members[name], name, "/" + rest
+}
+
+// member returns the member that owns p for a read, or ErrNotExist.
+func (f *Federation) member(p string) (Backend, string, string, error) {
+	b, name, inner := f.split(p)
+	if b == nil {
+		return nil, "", "", fmt.Errorf("%s: %w", p, iofs.ErrNotExist)
+	}
+	return b, name, inner, nil
+}
+
+// writable returns the member that owns p for a change below a member
+// directory, or ErrFederationRoot.
+func (f *Federation) writable(p string) (Backend, string, error) {
+	b, _, inner := f.split(p)
+	if b == nil || inner == "/" {
+		return nil, "", fmt.Errorf("%s: %w", p, ErrFederationRoot)
+	}
+	return b, inner, nil
+}
+
+// rebase moves metadata from a member into the federated tree.
+func rebase(name string, info iofs.FileInfo) iofs.FileInfo {
+	wsInfo, ok := info.(databricks.WSFileInfo)
+	if !ok {
+		return info
+	}
+	wsInfo.Path = path.Join("/"+name, wsInfo.Path)
+	return wsInfo
+}
+
+// memberInfo is the synthesized metadata of the root or a member directory.
+func memberInfo(p string) databricks.WSFileInfo {
+	return databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+		ObjectType: workspace.ObjectTypeDirectory,
+		Path:       p,
+	}}
+}
+
+func (f *Federation) Stat(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	return f.stat(ctx, filePath, Backend.Stat)
+}
+
+func (f *Federation) StatFresh(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	return f.stat(ctx, filePath, Backend.StatFresh)
+}
+
+func (f *Federation) stat(ctx context.Context, filePath string, stat func(Backend, context.Context, string) (iofs.FileInfo, error)) (iofs.FileInfo, error) {
+	if path.Clean("/"+filePath) == "/" {
+		return memberInfo("/"), nil
+	}
+	b, name, inner, err := f.member(filePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := stat(b, ctx, inner)
+	if err != nil {
+		return nil, err
+	}
+	return rebase(name, info), nil
+}
+
+// ReadDir lists the members at the root and a member's directory below it.
+func (f *Federation) ReadDir(ctx context.Context, dirPath string) ([]iofs.DirEntry, error) {
+	if path.Clean("/"+dirPath) == "/" {
+		entries := make([]iofs.DirEntry, 0, len(f.names))
+		for _, name := range f.names {
+			entries = append(entries, databricks.WSDirEntry{WSFileInfo: memberInfo("/" + name)})
+		}
+		return entries, nil
+	}
+	b, name, inner, err := f.member(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := b.ReadDir(ctx, inner)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if wsEntry, ok := entry.(databricks.WSDirEntry); ok {
+			wsEntry.WSFileInfo = rebase(name, wsEntry.WSFileInfo).(databricks.WSFileInfo)
+			entries[i] = wsEntry
+		}
+	}
+	return entries, nil
+}
+
+func (f *Federation) ReadAll(ctx context.Context, filePath string) ([]byte, error) {
+	b, _, inner, err := f.member(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return b.ReadAll(ctx, inner)
+}
+
+func (f *Federation) Write(ctx context.Context, filepath string, data []byte) error {
+	b, inner, err := f.writable(filepath)
+	if err != nil {
+		return err
+	}
+	return b.Write(ctx, inner, data)
+}
+
+func (f *Federation) Delete(ctx context.Context, filePath string, recursive bool) error {
+	b, inner, err := f.writable(filePath)
+	if err != nil {
+		return err
+	}
+	return b.Delete(ctx, inner, recursive)
+}
+
+func (f *Federation) Mkdir(ctx context.Context, dirPath string) error {
+	b, inner, err := f.writable(dirPath)
+	if err != nil {
+		return err
+	}
+	return b.Mkdir(ctx, inner)
+}
+
+// Rename moves a path within one member. Moves between members fail with
+// ErrCrossBackend, so mv copies instead.
+func (f *Federation) Rename(ctx context.Context, sourcePath string, destinationPath string) error {
+	source, sourceInner, err := f.writable(sourcePath)
+	if err != nil {
+		return err
+	}
+	destination, destinationInner, err := f.writable(destinationPath)
+	if err != nil {
+		return err
+	}
+	if source != destination {
+		return ErrCrossBackend
+	}
+	return source.Rename(ctx, sourceInner, destinationInner)
+}
+
+// WarmRepo warms a repo of the member that owns repoPath. It fails with
+// errors.ErrUnsupported when that member cannot warm repos.
+func (f *Federation) WarmRepo(ctx context.Context, repoPath string) (databricks.RepoWarmResult, error) {
+	b, name, inner, err := f.member(repoPath)
+	if err != nil {
+		return databricks.RepoWarmResult{}, err
+	}
+	warmer, ok := b.(databricks.RepoWarmer)
+	if !ok {
+		return databricks.RepoWarmResult{}, fmt.Errorf("warm repo %s: %w", repoPath, errors.ErrUnsupported)
+	}
+	result, err := warmer.WarmRepo(ctx, inner)
+	if result.Repo.Path != "" {
+		result.Repo.Path = path.Join("/"+name, result.Repo.Path)
+	}
+	return result, err
+}
+
+// BatchStat groups paths by member and stats each group through the
+// member's BatchStat, or one Stat per path when it has none. The root and
+// unknown top-level names are answered like Stat.
+func (f *Federation) BatchStat(ctx context.Context, paths []string) []databricks.StatResult {
+	results := make([]databricks.StatResult, len(paths))
+	groups := make(map[string][]int)
+	var order []string
+	for i, p := range paths {
+		b, name, _ := f.split(p)
+		if b == nil {
+			results[i].Info, results[i].Err = f.Stat(ctx, p)
+			continue
+		}
+		if _, ok := groups[name]; !ok {
+			order = append(order, name)
+		}
+		groups[name] = append(groups[name], i)
+	}
+	for _, name := range order {
+		indexes := groups[name]
+		inner := make([]string, len(indexes))
+		for j, i := range indexes {
+			_, _, inner[j] = f.split(paths[i])
+		}
+		for j, result := range databricks.BatchStat(ctx, f.members[name], inner) {
+			if result.Err == nil {
+				result.Info = rebase(name, result.Info)
+			}
+			results[indexes[j]] = result
+		}
+	}
+	return results
+}
+
+// SupportsChunks reports whether the member that owns filePath can patch it.
+func (f *Federation) SupportsChunks(filePath string) bool {
+	b, inner, err := f.writable(filePath)
+	if err != nil {
+		return false
+	}
+	_, ok := databricks.ChunkWriterFor(b, inner)
+	return ok
+}
+
+// WriteChunks patches a file of the member that owns filePath. It fails
+// with errors.ErrUnsupported when that member cannot patch files.
+func (f *Federation) WriteChunks(ctx context.Context, filePath string, size int64, chunks []databricks.Chunk) error {
+	b, inner, err := f.writable(filePath)
+	if err != nil {
+		return err
+	}
+	writer, ok := databricks.ChunkWriterFor(b, inner)
+	if !ok {
+		return fmt.Errorf("write chunks %s: %w", filePath, errors.ErrUnsupported)
+	}
+	return writer.WriteChunks(ctx, inner, size, chunks)
+}
+
+func (f *Federation) CacheSet(filePath string, info iofs.FileInfo) {
+	b, _, inner := f.split(filePath)
+	if b == nil {
+		return
+	}
+	if wsInfo, ok := info.(databricks.WSFileInfo); ok {
+		wsInfo.Path = inner
+		info = wsInfo
+	}
+	b.CacheSet(inner, info)
+}
+
+func (f *Federation) CacheInvalidate(filePath string) {
+	if b, _, inner := f.split(filePath); b != nil {
+		b.CacheInvalidate(inner)
+	}
+}
+
+// MetadataTTL returns the shortest TTL of the members.
+func (f *Federation) MetadataTTL() time.Duration {
+	ttl := f.members[f.names[0]].MetadataTTL()
+	for _, name := range f.names[1:] {
+		if memberTTL := f.members[name].MetadataTTL(); memberTTL < ttl {
+			ttl = memberTTL
+		}
+	}
+	return ttl
+}
+
+// Close closes every member.
+func (f *Federation) Close() error {
+	var errs []error
+	for _, name := range f.names {
+		errs = append(errs, Close(f.members[name]))
+	}
+	return errors.Join(errs...)
+}
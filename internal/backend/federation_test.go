@@ -0,0 +1,233 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"wsfs/internal/databricks"
+)
+
+// newLocalFederation federates a local directory per name, each holding a
+// file named after it.
+func newLocalFederation(t *testing.T, names ...string) (*Federation, map[string]string) {
+	t.Helper()
+	dirs := make(map[string]string, len(names))
+	var members []Member
+	for _, name := range names {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, name+".txt"), []byte(name), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		local, err := NewLocalBackend(dir, 0)
+		if err != nil {
+			t.Fatalf("NewLocalBackend: %v", err)
+		}
+		dirs[name] = dir
+		members = append(members, Member{Name: name, Backend: local})
+	}
+	f, err := NewFederation(members...)
+	if err != nil {
+		t.Fatalf("NewFederation: %v", err)
+	}
+	return f, dirs
+}
+
+func TestFederationServesMembersAsTopLevelDirectories(t *testing.T) {
+	f, _ := newLocalFederation(t, "staging", "prod")
+	ctx := context.Background()
+
+	entries, err := f.ReadDir(ctx, "/")
+	if err != nil {
+		t.Fatalf("ReadDir /: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			t.Fatalf("member %s is not a directory", entry.Name())
+		}
+		names = append(names, entry.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"prod", "staging"}) {
+		t.Fatalf("root listing = %v", names)
+	}
+
+	for _, p := range []string{"/", "/prod"} {
+		if info, err := f.Stat(ctx, p); err != nil || !info.IsDir() {
+			t.Fatalf("Stat %s = %v, %v", p, info, err)
+		}
+	}
+	info, err := f.StatFresh(ctx, "/prod/prod.txt")
+	if err != nil {
+		t.Fatalf("StatFresh: %v", err)
+	}
+	if wsInfo := info.(databricks.WSFileInfo); wsInfo.Path != "/prod/prod.txt" || info.Size() != 4 {
+		t.Fatalf("member file info = %+v", wsInfo)
+	}
+
+	entries, err = f.ReadDir(ctx, "/staging")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir /staging = %v, %v", entries, err)
+	}
+	listed := entries[0].(databricks.WSDirEntry).Path
+	if listed != "/staging/staging.txt" {
+		t.Fatalf("listed path = %q, want it in the federated tree", listed)
+	}
+	if data, err := f.ReadAll(ctx, listed); err != nil || string(data) != "staging" {
+		t.Fatalf("ReadAll of a listed path = %q, %v", data, err)
+	}
+
+	for _, p := range []string{"/dev", "/dev/x.txt", "/prod/missing.txt"} {
+		if _, err := f.Stat(ctx, p); !errors.Is(err, iofs.ErrNotExist) {
+			t.Fatalf("Stat %s = %v, want ErrNotExist", p, err)
+		}
+	}
+}
+
+func TestFederationChangesStayInsideMembers(t *testing.T) {
+	f, dirs := newLocalFederation(t, "prod", "staging")
+	ctx := context.Background()
+
+	if err := f.Mkdir(ctx, "/prod/src"); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := f.Write(ctx, "/prod/src/a.py", []byte("print(1)")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := f.Rename(ctx, "/prod/src/a.py", "/prod/b.py"); err != nil {
+		t.Fatalf("Rename within a member: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dirs["prod"], "b.py")); err != nil || string(got) != "print(1)" {
+		t.Fatalf("prod/b.py = %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dirs["staging"], "b.py")); !os.IsNotExist(err) {
+		t.Fatalf("write leaked into another member: %v", err)
+	}
+	if err := f.Delete(ctx, "/prod/src", true); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if err := f.Rename(ctx, "/prod/b.py", "/staging/b.py"); !errors.Is(err, ErrCrossBackend) || !errors.Is(err, syscall.EXDEV) {
+		t.Fatalf("Rename across members = %v, want EXDEV", err)
+	}
+	for name, change := range map[string]func() error{
+		"mkdir at the root":     func() error { return f.Mkdir(ctx, "/dev") },
+		"write at the root":     func() error { return f.Write(ctx, "/notes.txt", nil) },
+		"delete a member":       func() error { return f.Delete(ctx, "/staging", true) },
+		"rename a member":       func() error { return f.Rename(ctx, "/staging", "/qa") },
+		"rename into the root":  func() error { return f.Rename(ctx, "/prod/b.py", "/b.py") },
+		"write to an unknown":   func() error { return f.Write(ctx, "/dev/x.txt", nil) },
+		"delete the root":       func() error { return f.Delete(ctx, "/", true) },
+		"mkdir a member itself": func() error { return f.Mkdir(ctx, "/prod") },
+	} {
+		if err := change(); !errors.Is(err, ErrFederationRoot) || !errors.Is(err, syscall.EPERM) {
+			t.Fatalf("%s = %v, want EPERM", name, err)
+		}
+	}
+}
+
+func TestFederationTranslatesCacheCalls(t *testing.T) {
+	var calls []string
+	prod := recordingBackend("prod", &calls)
+	prod.CacheSetFunc = func(p string, info iofs.FileInfo) {
+		calls = append(calls, "set:"+p+":"+info.(databricks.WSFileInfo).Path)
+	}
+	prod.CacheInvalidateFunc = func(p string) { calls = append(calls, "invalidate:"+p) }
+	f, err := NewFederation(
+		Member{Name: "prod", Backend: &ttlFake{FakeWorkspaceAPI: prod, ttl: 10 * time.Second}},
+		Member{Name: "dev", Backend: &ttlFake{FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{}, ttl: 2 * time.Second}},
+	)
+	if err != nil {
+		t.Fatalf("NewFederation: %v", err)
+	}
+
+	f.CacheSet("/prod/a.py", databricks.NewTestFileInfo("/prod/a.py", 1, false))
+	f.CacheInvalidate("/prod/a.py")
+	f.CacheInvalidate("/")
+	f.CacheInvalidate("/qa/a.py")
+	if want := []string{"set:/a.py:/a.py", "invalidate:/a.py"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("cache calls = %v, want %v", calls, want)
+	}
+	if got := f.MetadataTTL(); got != 2*time.Second {
+		t.Fatalf("MetadataTTL = %v, want the shortest", got)
+	}
+}
+
+func TestNewFederationRejectsBadMembers(t *testing.T) {
+	local := &databricks.FakeWorkspaceAPI{}
+	for _, members := range [][]Member{
+		nil,
+		{{Name: "", Backend: local}},
+		{{Name: "a/b", Backend: local}},
+		{{Name: "..", Backend: local}},
+		{{Name: "prod", Backend: local}, {Name: "prod", Backend: local}},
+	} {
+		if _, err := NewFederation(members...); err == nil {
+			t.Fatalf("NewFederation(%v) succeeded", members)
+		}
+	}
+}
+
+func TestFederationForwardsOptionalExtensions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "big.bin"), []byte("aaaa"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	local, err := NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	var calls []string
+	f, err := NewFederation(
+		Member{Name: "local", Backend: local},
+		Member{Name: "ext", Backend: &extensionFake{FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{}, name: "ext", calls: &calls}},
+	)
+	if err != nil {
+		t.Fatalf("NewFederation: %v", err)
+	}
+	ctx := context.Background()
+
+	writer, ok := databricks.ChunkWriterFor(f, "/local/big.bin")
+	if !ok {
+		t.Fatal("expected delta uploads on the local member")
+	}
+	if err := writer.WriteChunks(ctx, "/local/big.bin", 4, []databricks.Chunk{{Offset: 1, Data: []byte("b")}}); err != nil {
+		t.Fatalf("WriteChunks: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "big.bin")); err != nil || string(got) != "abaa" {
+		t.Fatalf("patched file = %q, %v", got, err)
+	}
+	for _, p := range []string{"/", "/local", "/missing/big.bin"} {
+		if _, ok := databricks.ChunkWriterFor(f, p); ok {
+			t.Fatalf("expected no delta uploads for %s", p)
+		}
+	}
+
+	if _, err := f.WarmRepo(ctx, "/ext/Repos/proj"); err != nil {
+		t.Fatalf("WarmRepo: %v", err)
+	}
+	if _, err := f.WarmRepo(ctx, "/local/Repos/proj"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("WarmRepo on the local member = %v, want ErrUnsupported", err)
+	}
+
+	paths := []string{"/", "/local/big.bin", "/ext/x.py", "/missing/y", "/ext/z.py"}
+	results := f.BatchStat(ctx, paths)
+	for i, p := range []string{"/", "/local/big.bin", "/ext/x.py"} {
+		if results[i].Err != nil || results[i].Info.(databricks.WSFileInfo).Path != p {
+			t.Fatalf("result %d = %+v, want info for %s", i, results[i], p)
+		}
+	}
+	if !errors.Is(results[3].Err, iofs.ErrNotExist) {
+		t.Fatalf("stat of an unknown member = %v, want ErrNotExist", results[3].Err)
+	}
+	want := []string{"ext:warm:/Repos/proj", "ext:batch:/x.py,/z.py"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,290 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/databricks"
+)
+
+// LocalName is the backend that serves a local directory.
+const LocalName = "local"
+
+// localMetadataTTL is short because local changes are cheap to observe.
+const localMetadataTTL = time.Second
+
+// localUploadPrefix names in-flight upload files, which ReadDir hides.
+const localUploadPrefix = ".wsfs-upload-"
+
+// LocalBackend serves a local directory through the workspace backend
+// contract. It lets contributors run the FUSE stack, caches and CLI without
+// Databricks credentials, and gives fault-injection tests a real store.
+// Every call sleeps for Latency first to mimic a remote round trip.
+type LocalBackend struct {
+	root    string
+	Latency time.Duration
+}
+
+var (
+	_ Backend                = (*LocalBackend)(nil)
+	_ databricks.ChunkWriter = (*LocalBackend)(nil)
+)
+
+// NewLocalBackend returns a backend rooted at dir, which must exist.
+func NewLocalBackend(dir string, latency time.Duration) (*LocalBackend, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	return &LocalBackend{root: root, Latency: latency}, nil
+}
+
+// parseLocalArg parses "DIR[,latency=DURATION]".
+func parseLocalArg(arg string) (string, time.Duration, error) {
+	dir, options, _ := strings.Cut(arg, ",")
+	if dir == "" {
+		return "", 0, errors.New("local backend requires a directory, e.g. local:/tmp/wsfs-demo")
+	}
+
+	var latency time.Duration
+	for _, option := range strings.Split(options, ",") {
+		if option == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "latency":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return "", 0, fmt.Errorf("invalid latency %q", value)
+			}
+			latency = d
+		default:
+			return "", 0, fmt.Errorf("unknown local backend option %q", key)
+		}
+	}
+	return dir, latency, nil
+}
+
+func init() {
+	Register(LocalName, func(opts Options) (Backend, error) {
+		dir, latency, err := parseLocalArg(opts.Arg)
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalBackend(dir, latency)
+	})
+}
+
+// localPath maps a workspace path to a path under root. Cleaning an
+// absolute path removes "..", so the result cannot escape root.
+func (b *LocalBackend) localPath(p string) string {
+	return filepath.Join(b.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+func (b *LocalBackend) wait(ctx context.Context) error {
+	if b.Latency <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(b.Latency)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func localFileInfo(p string, info iofs.FileInfo) databricks.WSFileInfo {
+	objectType := workspace.ObjectTypeFile
+	size := info.Size()
+	if info.IsDir() {
+		objectType = workspace.ObjectTypeDirectory
+		size = 0
+	}
+	var objectID int64
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		objectID = int64(st.Ino)
+	}
+	return databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+		Path:       path.Clean("/" + p),
+		ObjectType: objectType,
+		ObjectId:   objectID,
+		Size:       size,
+		ModifiedAt: info.ModTime().UnixMilli(),
+	}}
+}
+
+func (b *LocalBackend) Stat(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(b.localPath(filePath))
+	if err != nil {
+		return nil, err
+	}
+	return localFileInfo(filePath, info), nil
+}
+
+func (b *LocalBackend) StatFresh(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	return b.Stat(ctx, filePath)
+}
+
+func (b *LocalBackend) ReadDir(ctx context.Context, dirPath string) ([]iofs.DirEntry, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(b.localPath(dirPath))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]iofs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && !entry.Type().IsRegular() {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), localUploadPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, databricks.WSDirEntry{WSFileInfo: localFileInfo(path.Join(dirPath, entry.Name()), info)})
+	}
+	return out, nil
+}
+
+func (b *LocalBackend) ReadAll(ctx context.Context, filePath string) ([]byte, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(b.localPath(filePath))
+}
+
+// Write replaces the file atomically through a temporary sibling, like a
+// workspace import with overwrite. The parent directory must exist.
+func (b *LocalBackend) Write(ctx context.Context, filePath string, data []byte) error {
+	if err := b.wait(ctx); err != nil {
+		return err
+	}
+	target := b.localPath(filePath)
+	tmp, err := os.CreateTemp(filepath.Dir(target), localUploadPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// WriteChunks patches an existing file with the given chunks and truncates
+// it to size. The patch is applied to a copy that replaces the file, so
+// readers see either the old or the new content, as with Write.
+func (b *LocalBackend) WriteChunks(ctx context.Context, filePath string, size int64, chunks []databricks.Chunk) error {
+	if err := b.wait(ctx); err != nil {
+		return err
+	}
+	target := b.localPath(filePath)
+	src, err := os.Open(target)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(target), localUploadPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	for _, chunk := range chunks {
+		if _, err := tmp.WriteAt(chunk.Data, chunk.Offset); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Truncate(size); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (b *LocalBackend) Delete(ctx context.Context, filePath string, recursive bool) error {
+	if err := b.wait(ctx); err != nil {
+		return err
+	}
+	target := b.localPath(filePath)
+	if target == b.root {
+		return &os.PathError{Op: "delete", Path: filePath, Err: syscall.EPERM}
+	}
+	if recursive {
+		if _, err := os.Stat(target); err != nil {
+			return err
+		}
+		return os.RemoveAll(target)
+	}
+	return os.Remove(target)
+}
+
+func (b *LocalBackend) Mkdir(ctx context.Context, dirPath string) error {
+	if err := b.wait(ctx); err != nil {
+		return err
+	}
+	return os.MkdirAll(b.localPath(dirPath), 0755)
+}
+
+func (b *LocalBackend) Rename(ctx context.Context, sourcePath string, destinationPath string) error {
+	if err := b.wait(ctx); err != nil {
+		return err
+	}
+	return os.Rename(b.localPath(sourcePath), b.localPath(destinationPath))
+}
+
+func (b *LocalBackend) CacheSet(path string, info iofs.FileInfo) {}
+
+func (b *LocalBackend) CacheInvalidate(filePath string) {}
+
+func (b *LocalBackend) MetadataTTL() time.Duration {
+	return localMetadataTTL
+}
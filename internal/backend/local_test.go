@@ -0,0 +1,206 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"wsfs/internal/databricks"
+)
+
+func newTestLocalBackend(t *testing.T) (*LocalBackend, string) {
+	t.Helper()
+	dir := t.TempDir()
+	b, err := NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	return b, dir
+}
+
+func TestLocalBackendRoundTrip(t *testing.T) {
+	b, dir := newTestLocalBackend(t)
+	ctx := context.Background()
+
+	if err := b.Mkdir(ctx, "/project/src"); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := b.Write(ctx, "/project/src/main.py", []byte("print(1)\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "project", "src", "main.py")); err != nil || string(got) != "print(1)\n" {
+		t.Fatalf("unexpected file on disk: %q, %v", got, err)
+	}
+
+	info, err := b.Stat(ctx, "/project/src/main.py")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	wsInfo, ok := info.(databricks.WSFileInfo)
+	if !ok || wsInfo.Path != "/project/src/main.py" || wsInfo.Size() != 9 || wsInfo.IsDir() || wsInfo.ObjectId == 0 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+
+	data, err := b.ReadAll(ctx, "/project/src/main.py")
+	if err != nil || string(data) != "print(1)\n" {
+		t.Fatalf("ReadAll: %q, %v", data, err)
+	}
+
+	if err := b.Rename(ctx, "/project/src/main.py", "/project/src/app.py"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	entries, err := b.ReadDir(ctx, "/project/src")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "app.py" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	if _, ok := entries[0].(databricks.WSDirEntry); !ok {
+		t.Fatalf("expected WSDirEntry, got %T", entries[0])
+	}
+
+	if err := b.Delete(ctx, "/project", false); err == nil {
+		t.Fatal("expected non-recursive delete of non-empty dir to fail")
+	}
+	if err := b.Delete(ctx, "/project", true); err != nil {
+		t.Fatalf("recursive Delete: %v", err)
+	}
+	if _, err := b.Stat(ctx, "/project"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist after delete, got %v", err)
+	}
+}
+
+func TestLocalBackendErrorsFollowContract(t *testing.T) {
+	b, _ := newTestLocalBackend(t)
+	ctx := context.Background()
+
+	if _, err := b.ReadAll(ctx, "/missing"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+	if err := b.Write(ctx, "/no-parent/file", []byte("x")); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist for missing parent, got %v", err)
+	}
+	if err := b.Delete(ctx, "/", true); err == nil {
+		t.Fatal("expected deleting the backend root to fail")
+	}
+	if err := b.Delete(ctx, "/missing", true); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist for recursive delete of missing path, got %v", err)
+	}
+}
+
+func TestLocalBackendPathsStayUnderRoot(t *testing.T) {
+	b, dir := newTestLocalBackend(t)
+
+	for _, p := range []string{"/../../etc/passwd", "../x", "/a/../../b"} {
+		got := b.localPath(p)
+		rel, err := filepath.Rel(dir, got)
+		if err != nil || rel == ".." || filepath.IsAbs(rel) || len(rel) >= 2 && rel[:2] == ".." {
+			t.Fatalf("path %q escaped root: %s", p, got)
+		}
+	}
+}
+
+func TestLocalBackendReadDirHidesUploadsAndSpecialFiles(t *testing.T) {
+	b, dir := newTestLocalBackend(t)
+	if err := os.WriteFile(filepath.Join(dir, localUploadPrefix+"123"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "keep.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("keep.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := b.ReadDir(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	if len(names) != 1 || names[0] != "keep.txt" {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+}
+
+func TestLocalBackendWriteChunks(t *testing.T) {
+	b, dir := newTestLocalBackend(t)
+	ctx := context.Background()
+	if err := b.Write(ctx, "/data.bin", []byte("aaaaaaaa")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	chunks := []databricks.Chunk{{Offset: 2, Data: []byte("bb")}, {Offset: 6, Data: []byte("cccc")}}
+	if err := b.WriteChunks(ctx, "/data.bin", 10, chunks); err != nil {
+		t.Fatalf("WriteChunks: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "data.bin")); err != nil || string(got) != "aabbaacccc" {
+		t.Fatalf("patched file = %q, %v", got, err)
+	}
+
+	if err := b.WriteChunks(ctx, "/data.bin", 4, nil); err != nil {
+		t.Fatalf("WriteChunks truncate: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "data.bin")); err != nil || string(got) != "aabb" {
+		t.Fatalf("truncated file = %q, %v", got, err)
+	}
+	if err := b.WriteChunks(ctx, "/missing.bin", 1, nil); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("WriteChunks on a missing file = %v, want ErrNotExist", err)
+	}
+}
+
+func TestLocalBackendLatencyHonorsContext(t *testing.T) {
+	b, _ := newTestLocalBackend(t)
+	b.Latency = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.Stat(ctx, "/"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	b.Latency = 20 * time.Millisecond
+	start := time.Now()
+	if _, err := b.Stat(context.Background(), "/"); err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("expected injected latency, took %v", elapsed)
+	}
+}
+
+func TestParseLocalArg(t *testing.T) {
+	dir, latency, err := parseLocalArg("/tmp/demo,latency=50ms")
+	if err != nil || dir != "/tmp/demo" || latency != 50*time.Millisecond {
+		t.Fatalf("unexpected parse: %q %v %v", dir, latency, err)
+	}
+	for _, arg := range []string{"", ",latency=1s", "/tmp,latency=soon", "/tmp,color=red"} {
+		if _, _, err := parseLocalArg(arg); err == nil {
+			t.Fatalf("expected error for %q", arg)
+		}
+	}
+}
+
+func TestLocalBackendRegistered(t *testing.T) {
+	dir := t.TempDir()
+	b, err := New(LocalName, Options{Arg: dir + ",latency=1ms"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	local, ok := b.(*LocalBackend)
+	if !ok || local.Latency != time.Millisecond {
+		t.Fatalf("unexpected backend %#v", b)
+	}
+	if _, err := New(LocalName, Options{Arg: filepath.Join(dir, "missing")}); err == nil {
+		t.Fatal("expected missing directory to fail")
+	}
+}
@@ -0,0 +1,181 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"time"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/record"
+)
+
+// Recorded wraps a backend and appends every call to a session trace, with
+// its timing and outcome but without file content. Cache calls are local
+// and not recorded.
+type Recorded struct {
+	backend Backend
+	rec     *record.Recorder
+}
+
+var (
+	_ Backend                   = (*Recorded)(nil)
+	_ databricks.RepoWarmer     = (*Recorded)(nil)
+	_ databricks.BatchStater    = (*Recorded)(nil)
+	_ databricks.ChunkWriter    = (*Recorded)(nil)
+	_ databricks.ChunkSupporter = (*Recorded)(nil)
+)
+
+// WithRecorder returns b wrapped to record its calls in rec, or b itself
+// when rec is nil.
+func WithRecorder(b Backend, rec *record.Recorder) Backend {
+	if rec == nil {
+		return b
+	}
+	return &Recorded{backend: b, rec: rec}
+}
+
+func (r *Recorded) begin(op, filePath string) *record.Call {
+	return r.rec.Begin(record.Entry{Kind: record.KindAPI, Op: op, Path: filePath})
+}
+
+// endStat records a stat call.
+func endStat(call *record.Call, info iofs.FileInfo, err error) (iofs.FileInfo, error) {
+	e := call.Entry()
+	e.SetError(err)
+	if err == nil {
+		e.SetInfo(info)
+	}
+	call.End(e)
+	return info, err
+}
+
+// endCall records a call that returns only an error.
+func endCall(call *record.Call, err error) error {
+	e := call.Entry()
+	e.SetError(err)
+	call.End(e)
+	return err
+}
+
+func (r *Recorded) Stat(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	call := r.begin(record.OpStat, filePath)
+	info, err := r.backend.Stat(ctx, filePath)
+	return endStat(call, info, err)
+}
+
+func (r *Recorded) StatFresh(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	call := r.begin(record.OpStatFresh, filePath)
+	info, err := r.backend.StatFresh(ctx, filePath)
+	return endStat(call, info, err)
+}
+
+func (r *Recorded) ReadDir(ctx context.Context, dirPath string) ([]iofs.DirEntry, error) {
+	call := r.begin(record.OpReadDir, dirPath)
+	entries, err := r.backend.ReadDir(ctx, dirPath)
+	e := call.Entry()
+	e.SetError(err)
+	e.Entries = record.DirEntries(entries)
+	call.End(e)
+	return entries, err
+}
+
+func (r *Recorded) ReadAll(ctx context.Context, filePath string) ([]byte, error) {
+	call := r.begin(record.OpReadAll, filePath)
+	data, err := r.backend.ReadAll(ctx, filePath)
+	e := call.Entry()
+	e.SetError(err)
+	if err == nil {
+		e.Size = int64(len(data))
+		e.Digest = record.Digest(data)
+	}
+	call.End(e)
+	return data, err
+}
+
+func (r *Recorded) Write(ctx context.Context, filePath string, data []byte) error {
+	entry := record.Entry{Kind: record.KindAPI, Op: record.OpWrite, Path: filePath, Size: int64(len(data)), Digest: record.Digest(data)}
+	call := r.rec.Begin(entry)
+	return endCall(call, r.backend.Write(ctx, filePath, data))
+}
+
+func (r *Recorded) Delete(ctx context.Context, filePath string, recursive bool) error {
+	call := r.rec.Begin(record.Entry{Kind: record.KindAPI, Op: record.OpDelete, Path: filePath, Recursive: recursive})
+	return endCall(call, r.backend.Delete(ctx, filePath, recursive))
+}
+
+func (r *Recorded) Mkdir(ctx context.Context, dirPath string) error {
+	call := r.begin(record.OpMkdir, dirPath)
+	return endCall(call, r.backend.Mkdir(ctx, dirPath))
+}
+
+func (r *Recorded) Rename(ctx context.Context, sourcePath string, destinationPath string) error {
+	call := r.rec.Begin(record.Entry{Kind: record.KindAPI, Op: record.OpRename, Path: sourcePath, Target: destinationPath})
+	return endCall(call, r.backend.Rename(ctx, sourcePath, destinationPath))
+}
+
+func (r *Recorded) CacheSet(path string, info iofs.FileInfo) {
+	r.backend.CacheSet(path, info)
+}
+
+func (r *Recorded) CacheInvalidate(filePath string) {
+	r.backend.CacheInvalidate(filePath)
+}
+
+func (r *Recorded) MetadataTTL() time.Duration {
+	return r.backend.MetadataTTL()
+}
+
+// Close closes the wrapped backend.
+func (r *Recorded) Close() error {
+	return Close(r.backend)
+}
+
+// WarmRepo records a warm-up of the wrapped backend. The listings it makes
+// happen inside that backend and are not recorded. It fails with
+// errors.ErrUnsupported when the backend cannot warm repos.
+func (r *Recorded) WarmRepo(ctx context.Context, repoPath string) (databricks.RepoWarmResult, error) {
+	warmer, ok := r.backend.(databricks.RepoWarmer)
+	if !ok {
+		return databricks.RepoWarmResult{}, fmt.Errorf("warm repo %s: %w", repoPath, errors.ErrUnsupported)
+	}
+	call := r.begin(record.OpWarmRepo, repoPath)
+	result, err := warmer.WarmRepo(ctx, repoPath)
+	return result, endCall(call, err)
+}
+
+// BatchStat records one stat per path, so a trace replays the same way
+// whether the stats were batched or not.
+func (r *Recorded) BatchStat(ctx context.Context, paths []string) []databricks.StatResult {
+	stater, ok := r.backend.(databricks.BatchStater)
+	if !ok {
+		return databricks.StatFanOut(ctx, r.Stat, paths)
+	}
+	calls := make([]*record.Call, len(paths))
+	for i, p := range paths {
+		calls[i] = r.begin(record.OpStat, p)
+	}
+	results := stater.BatchStat(ctx, paths)
+	for i, result := range results {
+		endStat(calls[i], result.Info, result.Err)
+	}
+	return results
+}
+
+// SupportsChunks reports whether the wrapped backend can patch filePath.
+func (r *Recorded) SupportsChunks(filePath string) bool {
+	_, ok := databricks.ChunkWriterFor(r.backend, filePath)
+	return ok
+}
+
+// WriteChunks records a delta upload with the final size of the file. It
+// fails with errors.ErrUnsupported when the backend cannot patch files.
+func (r *Recorded) WriteChunks(ctx context.Context, filePath string, size int64, chunks []databricks.Chunk) error {
+	writer, ok := databricks.ChunkWriterFor(r.backend, filePath)
+	if !ok {
+		return fmt.Errorf("write chunks %s: %w", filePath, errors.ErrUnsupported)
+	}
+	call := r.rec.Begin(record.Entry{Kind: record.KindAPI, Op: record.OpWriteChunks, Path: filePath, Size: size})
+	return endCall(call, writer.WriteChunks(ctx, filePath, size, chunks))
+}
@@ -0,0 +1,173 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/record"
+)
+
+func TestWithRecorderNilReturnsBackend(t *testing.T) {
+	api := &databricks.FakeWorkspaceAPI{}
+	if got := WithRecorder(api, nil); got != Backend(api) {
+		t.Fatalf("expected the backend itself, got %T", got)
+	}
+}
+
+// recordSession runs a short editing session on a local backend holding
+// notes.txt and returns its trace.
+func recordSession(t *testing.T) []record.Entry {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	local, err := NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace bytes.Buffer
+	rec := record.New(&trace)
+	b := WithRecorder(local, rec)
+
+	ctx := context.Background()
+	if _, err := b.ReadDir(ctx, "/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ReadAll(ctx, "/notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Stat(ctx, "/missing.txt"); err == nil {
+		t.Fatal("expected missing.txt to be missing")
+	}
+	if err := b.Mkdir(ctx, "/src"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(ctx, "/src/main.py", []byte("print('hi')\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Rename(ctx, "/notes.txt", "/src/notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Stat(ctx, "/src/notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := record.Read(&trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestWithRecorderRecordsCallsWithoutContent(t *testing.T) {
+	entries := recordSession(t)
+	if len(entries) != 7 {
+		t.Fatalf("entries = %+v, want 7 calls", entries)
+	}
+	read := entries[1]
+	if read.Op != record.OpReadAll || read.Size != 6 || read.Digest != record.Digest([]byte("hello\n")) {
+		t.Fatalf("read = %+v, want its size and digest", read)
+	}
+	if missing := entries[2]; missing.ErrorKind != record.ErrorNotExist {
+		t.Fatalf("stat of a missing file = %+v, want not_exist", missing)
+	}
+	if rename := entries[5]; rename.Path != "/notes.txt" || rename.Target != "/src/notes.txt" {
+		t.Fatalf("rename = %+v", rename)
+	}
+}
+
+func TestReplayReproducesRecordedSession(t *testing.T) {
+	entries := recordSession(t)
+	local, err := NewLocalBackend(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := record.Replay(context.Background(), local, entries, record.ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Calls != 7 || report.Seeded != 1 || len(report.Divergences) != 0 {
+		t.Fatalf("report = %+v, want 7 calls from a seeded notes.txt and no divergences", report)
+	}
+}
+
+func TestReplayReportsDivergence(t *testing.T) {
+	entries := recordSession(t)
+	// A trace where the renamed file came back smaller than it was read,
+	// as a corruption would look.
+	entries[6].Size = 3
+	local, err := NewLocalBackend(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := record.Replay(context.Background(), local, entries, record.ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Divergences) != 1 || report.Divergences[0].Seq != entries[6].Seq {
+		t.Fatalf("divergences = %+v, want the final stat", report.Divergences)
+	}
+}
+
+func TestWithRecorderKeepsOptionalExtensions(t *testing.T) {
+	var calls []string
+	var trace bytes.Buffer
+	rec := record.New(&trace)
+	b := WithRecorder(&extensionFake{FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{}, name: "ext", calls: &calls}, rec)
+	ctx := context.Background()
+
+	warmer, ok := b.(databricks.RepoWarmer)
+	if !ok {
+		t.Fatal("recorded backend lost RepoWarmer")
+	}
+	stater, ok := b.(databricks.BatchStater)
+	if !ok {
+		t.Fatal("recorded backend lost BatchStater")
+	}
+	writer, ok := databricks.ChunkWriterFor(b, "/big.bin")
+	if !ok {
+		t.Fatal("recorded backend lost ChunkWriter")
+	}
+	if _, err := warmer.WarmRepo(ctx, "/Repos/a"); err != nil {
+		t.Fatalf("WarmRepo: %v", err)
+	}
+	if results := stater.BatchStat(ctx, []string{"/a", "/b"}); results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("BatchStat: %+v", results)
+	}
+	if err := writer.WriteChunks(ctx, "/big.bin", 8, nil); err != nil {
+		t.Fatalf("WriteChunks: %v", err)
+	}
+	if len(calls) != 3 {
+		t.Fatalf("calls = %v, want one per extension", calls)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := record.Read(&trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, e := range entries {
+		ops = append(ops, e.Op+" "+e.Path)
+	}
+	want := []string{"warm_repo /Repos/a", "stat /a", "stat /b", "write_chunks /big.bin"}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("recorded %v, want %v", ops, want)
+	}
+
+	plain := WithRecorder(&databricks.FakeWorkspaceAPI{}, rec)
+	if _, ok := databricks.ChunkWriterFor(plain, "/big.bin"); ok {
+		t.Fatal("expected no delta uploads over a backend without them")
+	}
+}
@@ -0,0 +1,225 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/databricks"
+)
+
+// ErrCrossBackend is returned when a rename spans two backends. It wraps
+// EXDEV so tools such as mv fall back to copy and delete.
+var ErrCrossBackend = fmt.Errorf("rename across backends: %w", syscall.EXDEV)
+
+// Route sends every path at or below Prefix to Backend.
+type Route struct {
+	Prefix  string
+	Backend Backend
+}
+
+// Router dispatches each call to the backend of the longest matching route
+// prefix, or to the fallback. Paths are passed through unchanged, so a routed
+// backend sees the same absolute paths as the mount. The optional RepoWarmer,
+// BatchStater and ChunkWriter extensions are forwarded to the routed backend.
+type Router struct {
+	fallback Backend
+	routes   []Route // sorted by descending prefix length
+}
+
+var (
+	_ Backend                   = (*Router)(nil)
+	_ databricks.RepoWarmer     = (*Router)(nil)
+	_ databricks.BatchStater    = (*Router)(nil)
+	_ databricks.ChunkWriter    = (*Router)(nil)
+	_ databricks.ChunkSupporter = (*Router)(nil)
+)
+
+// NewRouter returns a Router over fallback and routes. Prefixes are cleaned;
+// a later route for the same prefix replaces an earlier one.
+func NewRouter(fallback Backend, routes ...Route) *Router {
+	byPrefix := make(map[string]Backend, len(routes))
+	for _, route := range routes {
+		byPrefix[path.Clean("/"+route.Prefix)] = route.Backend
+	}
+	r := &Router{fallback: fallback}
+	for prefix, backend := range byPrefix {
+		r.routes = append(r.routes, Route{Prefix: prefix, Backend: backend})
+	}
+	sort.Slice(r.routes, func(i, j int) bool {
+		if len(r.routes[i].Prefix) != len(r.routes[j].Prefix) {
+			return len(r.routes[i].Prefix) > len(r.routes[j].Prefix)
+		}
+		return r.routes[i].Prefix < r.routes[j].Prefix
+	})
+	return r
+}
+
+func hasPathPrefix(p, prefix string) bool {
+	if prefix == "/" {
+		return strings.HasPrefix(p, "/")
+	}
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// backendFor returns the backend that owns p.
+func (r *Router) backendFor(p string) Backend {
+	for _, route := range r.routes {
+		if hasPathPrefix(p, route.Prefix) {
+			return route.Backend
+		}
+	}
+	return r.fallback
+}
+
+func (r *Router) Stat(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	return r.backendFor(filePath).Stat(ctx, filePath)
+}
+
+func (r *Router) StatFresh(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	return r.backendFor(filePath).StatFresh(ctx, filePath)
+}
+
+// ReadDir lists dirPath from its backend and adds route prefixes that are
+// direct children of dirPath, so mounted backends stay discoverable.
+func (r *Router) ReadDir(ctx context.Context, dirPath string) ([]iofs.DirEntry, error) {
+	entries, err := r.backendFor(dirPath).ReadDir(ctx, dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		seen[entry.Name()] = struct{}{}
+	}
+	for _, route := range r.routes {
+		if route.Prefix == "/" || path.Dir(route.Prefix) != path.Clean(dirPath) {
+			continue
+		}
+		name := path.Base(route.Prefix)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		entries = append(entries, databricks.WSDirEntry{WSFileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeDirectory,
+			Path:       route.Prefix,
+		}}})
+	}
+	return entries, nil
+}
+
+func (r *Router) ReadAll(ctx context.Context, filePath string) ([]byte, error) {
+	return r.backendFor(filePath).ReadAll(ctx, filePath)
+}
+
+func (r *Router) Write(ctx context.Context, filepath string, data []byte) error {
+	return r.backendFor(filepath).Write(ctx, filepath, data)
+}
+
+func (r *Router) Delete(ctx context.Context, filePath string, recursive bool) error {
+	return r.backendFor(filePath).Delete(ctx, filePath, recursive)
+}
+
+func (r *Router) Mkdir(ctx context.Context, dirPath string) error {
+	return r.backendFor(dirPath).Mkdir(ctx, dirPath)
+}
+
+func (r *Router) Rename(ctx context.Context, sourcePath string, destinationPath string) error {
+	source := r.backendFor(sourcePath)
+	if source != r.backendFor(destinationPath) {
+		return ErrCrossBackend
+	}
+	return source.Rename(ctx, sourcePath, destinationPath)
+}
+
+// WarmRepo forwards to the backend that owns repoPath. It fails with
+// errors.ErrUnsupported when that backend cannot warm repos.
+func (r *Router) WarmRepo(ctx context.Context, repoPath string) (databricks.RepoWarmResult, error) {
+	warmer, ok := r.backendFor(repoPath).(databricks.RepoWarmer)
+	if !ok {
+		return databricks.RepoWarmResult{}, fmt.Errorf("warm repo %s: %w", repoPath, errors.ErrUnsupported)
+	}
+	return warmer.WarmRepo(ctx, repoPath)
+}
+
+// BatchStat groups paths by backend and stats each group through that
+// backend's BatchStat, or one Stat per path when it has none.
+func (r *Router) BatchStat(ctx context.Context, paths []string) []databricks.StatResult {
+	results := make([]databricks.StatResult, len(paths))
+	groups := make(map[Backend][]int)
+	var order []Backend
+	for i, p := range paths {
+		b := r.backendFor(p)
+		if _, ok := groups[b]; !ok {
+			order = append(order, b)
+		}
+		groups[b] = append(groups[b], i)
+	}
+	for _, b := range order {
+		indexes := groups[b]
+		group := make([]string, len(indexes))
+		for j, i := range indexes {
+			group[j] = paths[i]
+		}
+		for j, result := range databricks.BatchStat(ctx, b, group) {
+			results[indexes[j]] = result
+		}
+	}
+	return results
+}
+
+// SupportsChunks reports whether the backend that owns filePath can patch
+// it, so delta uploads are only prepared for such paths.
+func (r *Router) SupportsChunks(filePath string) bool {
+	_, ok := databricks.ChunkWriterFor(r.backendFor(filePath), filePath)
+	return ok
+}
+
+// WriteChunks forwards to the backend that owns filePath. It fails with
+// errors.ErrUnsupported when that backend cannot patch files, and the
+// caller falls back to a whole-file upload.
+func (r *Router) WriteChunks(ctx context.Context, filePath string, size int64, chunks []databricks.Chunk) error {
+	writer, ok := databricks.ChunkWriterFor(r.backendFor(filePath), filePath)
+	if !ok {
+		return fmt.Errorf("write chunks %s: %w", filePath, errors.ErrUnsupported)
+	}
+	return writer.WriteChunks(ctx, filePath, size, chunks)
+}
+
+func (r *Router) CacheSet(path string, info iofs.FileInfo) {
+	r.backendFor(path).CacheSet(path, info)
+}
+
+func (r *Router) CacheInvalidate(filePath string) {
+	r.backendFor(filePath).CacheInvalidate(filePath)
+}
+
+// Close closes the fallback and every routed backend.
+func (r *Router) Close() error {
+	errs := []error{Close(r.fallback)}
+	for _, route := range r.routes {
+		errs = append(errs, Close(route.Backend))
+	}
+	return errors.Join(errs...)
+}
+
+// MetadataTTL returns the shortest TTL of all backends so no node outlives
+// the freshness window of the backend it lives on.
+func (r *Router) MetadataTTL() time.Duration {
+	ttl := r.fallback.MetadataTTL()
+	for _, route := range r.routes {
+		if routeTTL := route.Backend.MetadataTTL(); routeTTL < ttl {
+			ttl = routeTTL
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,223 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	iofs "io/fs"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/faultinject"
+)
+
+type ttlFake struct {
+	*databricks.FakeWorkspaceAPI
+	ttl time.Duration
+}
+
+func (f *ttlFake) MetadataTTL() time.Duration { return f.ttl }
+
+func recordingBackend(name string, calls *[]string) *databricks.FakeWorkspaceAPI {
+	return &databricks.FakeWorkspaceAPI{
+		StatFunc: func(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+			*calls = append(*calls, name+":"+filePath)
+			return databricks.NewTestFileInfo(filePath, 0, false), nil
+		},
+		ReadDirFunc: func(ctx context.Context, dirPath string) ([]iofs.DirEntry, error) {
+			*calls = append(*calls, name+":"+dirPath)
+			return []iofs.DirEntry{
+				databricks.WSDirEntry{WSFileInfo: databricks.NewTestFileInfo(dirPath+"/Users", 0, true)},
+			}, nil
+		},
+		RenameFunc: func(ctx context.Context, sourcePath string, destinationPath string) error {
+			*calls = append(*calls, name+":"+sourcePath+"->"+destinationPath)
+			return nil
+		},
+	}
+}
+
+func TestRouterLongestPrefixWins(t *testing.T) {
+	var calls []string
+	router := NewRouter(
+		recordingBackend("ws", &calls),
+		Route{Prefix: "/Volumes", Backend: recordingBackend("vol", &calls)},
+		Route{Prefix: "/Volumes/local/", Backend: recordingBackend("local", &calls)},
+	)
+	ctx := context.Background()
+
+	for _, p := range []string{"/Users/a.py", "/Volumes/x", "/Volumes/local/y", "/Volumes/localother"} {
+		if _, err := router.Stat(ctx, p); err != nil {
+			t.Fatalf("Stat %s: %v", p, err)
+		}
+	}
+
+	want := []string{"ws:/Users/a.py", "vol:/Volumes/x", "local:/Volumes/local/y", "vol:/Volumes/localother"}
+	if len(calls) != len(want) {
+		t.Fatalf("expected %v, got %v", want, calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, calls)
+		}
+	}
+}
+
+func TestRouterReadDirAddsRoutePrefixes(t *testing.T) {
+	var calls []string
+	router := NewRouter(
+		recordingBackend("ws", &calls),
+		Route{Prefix: "/Volumes", Backend: recordingBackend("vol", &calls)},
+		Route{Prefix: "/Users", Backend: recordingBackend("users", &calls)},
+		Route{Prefix: "/deep/nested", Backend: recordingBackend("deep", &calls)},
+	)
+
+	entries, err := router.ReadDir(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+
+	names := map[string]bool{}
+	for _, entry := range entries {
+		if names[entry.Name()] {
+			t.Fatalf("duplicate entry %q", entry.Name())
+		}
+		names[entry.Name()] = true
+	}
+	if !names["Volumes"] || !names["Users"] || names["nested"] || len(names) != 2 {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+}
+
+func TestRouterRejectsCrossBackendRename(t *testing.T) {
+	var calls []string
+	router := NewRouter(
+		recordingBackend("ws", &calls),
+		Route{Prefix: "/Volumes", Backend: recordingBackend("vol", &calls)},
+	)
+	ctx := context.Background()
+
+	err := router.Rename(ctx, "/Users/a", "/Volumes/a")
+	if !errors.Is(err, ErrCrossBackend) || !errors.Is(err, syscall.EXDEV) {
+		t.Fatalf("expected EXDEV cross-backend error, got %v", err)
+	}
+	if err := router.Rename(ctx, "/Volumes/a", "/Volumes/b"); err != nil {
+		t.Fatalf("same-backend rename failed: %v", err)
+	}
+	if len(calls) != 1 || calls[0] != "vol:/Volumes/a->/Volumes/b" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+}
+
+func TestRouterMetadataTTLUsesShortest(t *testing.T) {
+	router := NewRouter(
+		&ttlFake{FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{}, ttl: 10 * time.Second},
+		Route{Prefix: "/fast", Backend: &ttlFake{FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{}, ttl: 2 * time.Second}},
+	)
+	if got := router.MetadataTTL(); got != 2*time.Second {
+		t.Fatalf("expected 2s, got %v", got)
+	}
+}
+
+type closeFake struct {
+	*databricks.FakeWorkspaceAPI
+	closed int
+	err    error
+}
+
+func (f *closeFake) Close() error {
+	f.closed++
+	return f.err
+}
+
+func TestRouterCloseClosesEveryBackend(t *testing.T) {
+	fallback := &closeFake{FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{}}
+	routed := &closeFake{FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{}, err: errors.New("boom")}
+	router := NewRouter(fallback,
+		Route{Prefix: "/local", Backend: routed},
+		Route{Prefix: "/plain", Backend: &databricks.FakeWorkspaceAPI{}},
+	)
+
+	if err := Close(router); err == nil || err.Error() != "boom" {
+		t.Fatalf("Close = %v, want the routed backend's error", err)
+	}
+	if fallback.closed != 1 || routed.closed != 1 {
+		t.Fatalf("closed fallback %d times, routed %d times", fallback.closed, routed.closed)
+	}
+	if err := Close(WithFaults(fallback, faultinject.New(faultinject.Config{}))); err != nil || fallback.closed != 2 {
+		t.Fatalf("Close through Faulty = %v, closed %d times", err, fallback.closed)
+	}
+}
+
+type extensionFake struct {
+	*databricks.FakeWorkspaceAPI
+	name  string
+	calls *[]string
+}
+
+func (f *extensionFake) WarmRepo(ctx context.Context, repoPath string) (databricks.RepoWarmResult, error) {
+	*f.calls = append(*f.calls, f.name+":warm:"+repoPath)
+	return databricks.RepoWarmResult{Dirs: 1}, nil
+}
+
+func (f *extensionFake) BatchStat(ctx context.Context, paths []string) []databricks.StatResult {
+	*f.calls = append(*f.calls, f.name+":batch:"+strings.Join(paths, ","))
+	results := make([]databricks.StatResult, len(paths))
+	for i, p := range paths {
+		results[i].Info = databricks.NewTestFileInfo(p, int64(i), false)
+	}
+	return results
+}
+
+func (f *extensionFake) WriteChunks(ctx context.Context, filePath string, size int64, chunks []databricks.Chunk) error {
+	*f.calls = append(*f.calls, f.name+":chunks:"+filePath)
+	return nil
+}
+
+func TestRouterForwardsOptionalExtensions(t *testing.T) {
+	var calls []string
+	router := NewRouter(
+		recordingBackend("ws", &calls),
+		Route{Prefix: "/Repos", Backend: &extensionFake{FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{}, name: "ext", calls: &calls}},
+	)
+	ctx := context.Background()
+
+	if result, err := router.WarmRepo(ctx, "/Repos/a/project"); err != nil || result.Dirs != 1 {
+		t.Fatalf("WarmRepo = %+v, %v", result, err)
+	}
+	if _, err := router.WarmRepo(ctx, "/Users/a/project"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("WarmRepo on a plain backend = %v, want ErrUnsupported", err)
+	}
+	if err := router.WriteChunks(ctx, "/Repos/a/big.bin", 1, nil); err != nil {
+		t.Fatalf("WriteChunks: %v", err)
+	}
+	if err := router.WriteChunks(ctx, "/Users/a/big.bin", 1, nil); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("WriteChunks on a plain backend = %v, want ErrUnsupported", err)
+	}
+	if _, ok := databricks.ChunkWriterFor(router, "/Repos/a/big.bin"); !ok {
+		t.Fatal("expected chunk support below the routed ChunkWriter")
+	}
+	if _, ok := databricks.ChunkWriterFor(router, "/Users/a/big.bin"); ok {
+		t.Fatal("expected no chunk support on the plain fallback")
+	}
+
+	paths := []string{"/Repos/a/x.py", "/Users/a.py", "/Repos/a/y.py"}
+	results := router.BatchStat(ctx, paths)
+	for i, result := range results {
+		if result.Err != nil || result.Info == nil || result.Info.(databricks.WSFileInfo).Path != paths[i] {
+			t.Fatalf("result %d = %+v, want info for %s", i, result, paths[i])
+		}
+	}
+
+	want := []string{
+		"ext:warm:/Repos/a/project",
+		"ext:chunks:/Repos/a/big.bin",
+		"ext:batch:/Repos/a/x.py,/Repos/a/y.py",
+		"ws:/Users/a.py",
+	}
+	if strings.Join(calls, "|") != strings.Join(want, "|") {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,193 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"wsfs/internal/databricks"
+)
+
+// Snapshot wraps a backend in a read-only view pinned to the first time
+// each path is seen. The metadata of an object and the listing of a
+// directory are recorded at their first Stat or ReadDir and returned
+// unchanged for the lifetime of the Snapshot, so objects changed, created
+// or deleted remotely afterwards keep looking as they did. Content must
+// come from a cache: ReadAll fails with ESTALE once the remote content
+// differs from the pinned version. Every mutation fails with EROFS.
+type Snapshot struct {
+	backend Backend
+
+	mu       sync.Mutex
+	infos    map[string]iofs.FileInfo // nil: missing when first looked up
+	listings map[string][]iofs.DirEntry
+}
+
+var _ Backend = (*Snapshot)(nil)
+
+// WithSnapshot returns b wrapped in a Snapshot.
+func WithSnapshot(b Backend) *Snapshot {
+	return &Snapshot{
+		backend:  b,
+		infos:    make(map[string]iofs.FileInfo),
+		listings: make(map[string][]iofs.DirEntry),
+	}
+}
+
+// pinnedLocked returns the recorded metadata of filePath, from its own Stat or
+// from the listing of its parent. The caller holds s.mu.
+func (s *Snapshot) pinnedLocked(filePath string) (iofs.FileInfo, bool) {
+	if info, ok := s.infos[filePath]; ok {
+		return info, true
+	}
+	entries, ok := s.listings[path.Dir(filePath)]
+	if !ok || filePath == "/" {
+		return nil, false
+	}
+	name := path.Base(filePath)
+	for _, entry := range entries {
+		if entry.Name() == name {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, false
+			}
+			s.infos[filePath] = info
+			return info, true
+		}
+	}
+	// Created after the parent was listed.
+	s.infos[filePath] = nil
+	return nil, true
+}
+
+func (s *Snapshot) Stat(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	s.mu.Lock()
+	info, ok := s.pinnedLocked(filePath)
+	s.mu.Unlock()
+	if ok {
+		return pinnedResult(filePath, info)
+	}
+
+	info, err := s.backend.Stat(ctx, filePath)
+	if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pinned, ok := s.pinnedLocked(filePath); ok {
+		return pinnedResult(filePath, pinned)
+	}
+	s.infos[filePath] = info
+	return pinnedResult(filePath, info)
+}
+
+func pinnedResult(filePath string, info iofs.FileInfo) (iofs.FileInfo, error) {
+	if info == nil {
+		return nil, fmt.Errorf("%s: not in the snapshot: %w", filePath, iofs.ErrNotExist)
+	}
+	return info, nil
+}
+
+// StatFresh returns the pinned metadata like Stat: a snapshot never
+// revalidates.
+func (s *Snapshot) StatFresh(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+	return s.Stat(ctx, filePath)
+}
+
+func (s *Snapshot) ReadDir(ctx context.Context, dirPath string) ([]iofs.DirEntry, error) {
+	s.mu.Lock()
+	entries, ok := s.listings[dirPath]
+	s.mu.Unlock()
+	if ok {
+		return entries, nil
+	}
+
+	listed, err := s.backend.ReadDir(ctx, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entries, ok := s.listings[dirPath]; ok {
+		return entries, nil
+	}
+	entries = make([]iofs.DirEntry, 0, len(listed))
+	for _, entry := range listed {
+		childPath := path.Join(dirPath, entry.Name())
+		info, pinned := s.infos[childPath]
+		switch {
+		case !pinned:
+			if childInfo, err := entry.Info(); err == nil {
+				s.infos[childPath] = childInfo
+			}
+		case info == nil:
+			// Missing when it was first looked up.
+			continue
+		default:
+			if wsInfo, ok := info.(databricks.WSFileInfo); ok {
+				entry = databricks.WSDirEntry{WSFileInfo: wsInfo}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	s.listings[dirPath] = entries
+	return entries, nil
+}
+
+// ReadAll reads the current remote content and returns it only while it is
+// still the pinned version. The version is checked after the read, so
+// content that changed during the read is refused as well.
+func (s *Snapshot) ReadAll(ctx context.Context, filePath string) ([]byte, error) {
+	pinned, err := s.Stat(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.backend.ReadAll(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.backend.StatFresh(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !current.ModTime().Equal(pinned.ModTime()) {
+		return nil, fmt.Errorf("%s changed after the snapshot was taken and its pinned content is not cached: %w", filePath, syscall.ESTALE)
+	}
+	return data, nil
+}
+
+func (s *Snapshot) Write(ctx context.Context, filePath string, data []byte) error {
+	return syscall.EROFS
+}
+
+func (s *Snapshot) Delete(ctx context.Context, filePath string, recursive bool) error {
+	return syscall.EROFS
+}
+
+func (s *Snapshot) Mkdir(ctx context.Context, dirPath string) error {
+	return syscall.EROFS
+}
+
+func (s *Snapshot) Rename(ctx context.Context, sourcePath string, destinationPath string) error {
+	return syscall.EROFS
+}
+
+// CacheSet is ignored: nothing is changed through a snapshot.
+func (s *Snapshot) CacheSet(path string, info iofs.FileInfo) {}
+
+// CacheInvalidate is ignored: pinned metadata never expires.
+func (s *Snapshot) CacheInvalidate(filePath string) {}
+
+func (s *Snapshot) MetadataTTL() time.Duration {
+	return s.backend.MetadataTTL()
+}
+
+// Close closes the wrapped backend.
+func (s *Snapshot) Close() error {
+	return Close(s.backend)
+}
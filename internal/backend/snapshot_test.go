@@ -0,0 +1,120 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writeLocal(t *testing.T, dir, name, content string, modTime time.Time) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	if err := os.Chtimes(p, modTime, modTime); err != nil {
+		t.Fatalf("chtimes %s: %v", name, err)
+	}
+}
+
+func TestSnapshotHidesLaterChanges(t *testing.T) {
+	local, dir := newTestLocalBackend(t)
+	ctx := context.Background()
+	base := time.Unix(1700000000, 0)
+	writeLocal(t, dir, "a.txt", "one", base)
+	writeLocal(t, dir, "gone.txt", "bye", base)
+	s := WithSnapshot(local)
+
+	entries, err := s.ReadDir(ctx, "/")
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("ReadDir = %d entries, %v", len(entries), err)
+	}
+	pinned, err := s.Stat(ctx, "/a.txt")
+	if err != nil || !pinned.ModTime().Equal(base) {
+		t.Fatalf("Stat = %v, %v", pinned, err)
+	}
+
+	writeLocal(t, dir, "a.txt", "two!", base.Add(time.Hour))
+	writeLocal(t, dir, "new.txt", "new", base)
+	if err := os.Remove(filepath.Join(dir, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := s.StatFresh(ctx, "/a.txt"); err != nil || !info.ModTime().Equal(base) || info.Size() != 3 {
+		t.Fatalf("changed file = %v, %v, want the pinned metadata", info, err)
+	}
+	if _, err := s.Stat(ctx, "/new.txt"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("file created after the listing: %v, want not exist", err)
+	}
+	if _, err := s.Stat(ctx, "/gone.txt"); err != nil {
+		t.Fatalf("deleted file must stay visible: %v", err)
+	}
+	if again, _ := s.ReadDir(ctx, "/"); len(again) != 2 {
+		t.Fatalf("listing changed to %d entries", len(again))
+	}
+	if _, err := s.ReadAll(ctx, "/a.txt"); !errors.Is(err, syscall.ESTALE) {
+		t.Fatalf("ReadAll of changed content: %v, want ESTALE", err)
+	}
+}
+
+func TestSnapshotPinsMissingAndListsPinnedInfo(t *testing.T) {
+	local, dir := newTestLocalBackend(t)
+	ctx := context.Background()
+	base := time.Unix(1700000000, 0)
+	s := WithSnapshot(local)
+
+	if _, err := s.Stat(ctx, "/late.txt"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("Stat of missing file: %v", err)
+	}
+	writeLocal(t, dir, "late.txt", "late", base)
+	writeLocal(t, dir, "b.txt", "one", base)
+	if _, err := s.Stat(ctx, "/b.txt"); err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	writeLocal(t, dir, "b.txt", "longer", base.Add(time.Hour))
+
+	entries, err := s.ReadDir(ctx, "/")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "b.txt" {
+		t.Fatalf("entries = %v, want only b.txt", entries)
+	}
+	if info, _ := entries[0].Info(); info.Size() != 3 || !info.ModTime().Equal(base) {
+		t.Fatalf("listed %v, want the metadata pinned by Stat", info)
+	}
+	if data, err := s.ReadAll(ctx, "/late.txt"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("ReadAll of file missing from the snapshot = %q, %v", data, err)
+	}
+}
+
+func TestSnapshotReadsUnchangedContentAndRefusesWrites(t *testing.T) {
+	local, dir := newTestLocalBackend(t)
+	ctx := context.Background()
+	writeLocal(t, dir, "a.txt", "one", time.Unix(1700000000, 0))
+	s := WithSnapshot(local)
+
+	if data, err := s.ReadAll(ctx, "/a.txt"); err != nil || string(data) != "one" {
+		t.Fatalf("ReadAll = %q, %v", data, err)
+	}
+	if err := s.Write(ctx, "/a.txt", []byte("x")); !errors.Is(err, syscall.EROFS) {
+		t.Fatalf("Write: %v, want EROFS", err)
+	}
+	if err := s.Delete(ctx, "/a.txt", false); !errors.Is(err, syscall.EROFS) {
+		t.Fatalf("Delete: %v, want EROFS", err)
+	}
+	if err := s.Mkdir(ctx, "/d"); !errors.Is(err, syscall.EROFS) {
+		t.Fatalf("Mkdir: %v, want EROFS", err)
+	}
+	if err := s.Rename(ctx, "/a.txt", "/b.txt"); !errors.Is(err, syscall.EROFS) {
+		t.Fatalf("Rename: %v, want EROFS", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(got) != "one" {
+		t.Fatalf("file changed through the snapshot: %q", got)
+	}
+}
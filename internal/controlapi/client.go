@@ -0,0 +1,163 @@
+package controlapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	wsfsfuse "wsfs/internal/fuse"
+)
+
+// Client calls the control API of a running mount over its unix socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client for the API served on socketPath.
+func NewClient(socketPath string) *Client {
+	return &Client{http: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}}}
+}
+
+// APIError is an error response from the API. It unwraps to
+// os.ErrNotExist or os.ErrPermission for 404 and 403 responses.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("control API: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return os.ErrNotExist
+	case http.StatusForbidden:
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// Resolve asks the mount which path and cache state belong to a workspace
+// object ID.
+func (c *Client) Resolve(ctx context.Context, objectID int64) (wsfsfuse.ResolvedObject, error) {
+	var resolved wsfsfuse.ResolvedObject
+	err := c.do(ctx, http.MethodPost, "/v1/resolve", ResolveRequest{ObjectID: objectID}, &resolved)
+	return resolved, err
+}
+
+// Search returns the lines matching req.Pattern in the files at or below
+// req.Path.
+func (c *Client) Search(ctx context.Context, req SearchRequest) (wsfsfuse.SearchResult, error) {
+	var result wsfsfuse.SearchResult
+	err := c.do(ctx, http.MethodPost, "/v1/search", req, &result)
+	return result, err
+}
+
+// Tree lists the objects below req.Path, down to req.Depth levels.
+func (c *Client) Tree(ctx context.Context, req TreeRequest) (wsfsfuse.TreeResult, error) {
+	var result wsfsfuse.TreeResult
+	err := c.do(ctx, http.MethodPost, "/v1/tree", req, &result)
+	return result, err
+}
+
+// Pin pins the files at or below path in the disk cache and downloads the
+// ones not cached yet.
+func (c *Client) Pin(ctx context.Context, path string) (wsfsfuse.PrefetchResult, error) {
+	var result wsfsfuse.PrefetchResult
+	err := c.do(ctx, http.MethodPost, "/v1/pin", PathRequest{Path: path}, &result)
+	return result, err
+}
+
+// Unpin removes the pins at or below path.
+func (c *Client) Unpin(ctx context.Context, path string) (wsfsfuse.UnpinResult, error) {
+	var result wsfsfuse.UnpinResult
+	err := c.do(ctx, http.MethodPost, "/v1/unpin", PathRequest{Path: path}, &result)
+	return result, err
+}
+
+// Stats returns the mount's dirty files, error count and counters.
+func (c *Client) Stats(ctx context.Context) (wsfsfuse.MountStats, error) {
+	var stats wsfsfuse.MountStats
+	err := c.do(ctx, http.MethodGet, "/v1/stats", nil, &stats)
+	return stats, err
+}
+
+// Flush uploads dirty files at or below paths, or every dirty file when
+// paths is empty.
+func (c *Client) Flush(ctx context.Context, paths []string) error {
+	return c.do(ctx, http.MethodPost, "/v1/flush", PathsRequest{Paths: paths}, nil)
+}
+
+// Reauth asks the mount to reload its workspace credentials, as after
+// `databricks auth login`, and returns who they belong to.
+func (c *Client) Reauth(ctx context.Context) (ReauthResponse, error) {
+	var resp ReauthResponse
+	err := c.do(ctx, http.MethodPost, "/v1/reauth", nil, &resp)
+	return resp, err
+}
+
+// Unmount asks the mount to flush and unmount. The request returns before
+// the mount is gone.
+func (c *Client) Unmount(ctx context.Context, force bool) error {
+	return c.do(ctx, http.MethodPost, "/v1/unmount", UnmountRequest{Force: force}, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, route string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	// The host is ignored; requests always go to the socket.
+	req, err := http.NewRequestWithContext(ctx, method, "http://wsfs"+route, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		// Failed flushes answer with a FlushResponse listing the errors.
+		var errResp struct {
+			errorResponse
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		if errResp.Error == "" {
+			errResp.Error = strings.Join(errResp.Errors, "; ")
+		}
+		if errResp.Error == "" {
+			errResp.Error = http.StatusText(resp.StatusCode)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: errResp.Error}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s response: %w", route, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package controlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClientResolve(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	mount := &fakeMount{}
+	server, err := Listen(socketPath, mount, func(bool) {})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer server.Close()
+	client := NewClient(socketPath)
+
+	resolved, err := client.Resolve(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if resolved.ObjectID != 42 || resolved.MountPath != "/nb.py" || resolved.Inode != 9 {
+		t.Fatalf("unexpected result %+v", resolved)
+	}
+
+	mount.resolveErr = fmt.Errorf("object 43 not found: %w", os.ErrNotExist)
+	_, err = client.Resolve(context.Background(), 43)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Resolve of unknown ID = %v, want a 404 APIError", err)
+	}
+	if apiErr.Message != "object 43 not found: file does not exist" {
+		t.Fatalf("unexpected message %q", apiErr.Message)
+	}
+}
+
+func TestClientSearch(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	mount := &fakeMount{}
+	server, err := Listen(socketPath, mount, func(bool) {})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer server.Close()
+
+	result, err := NewClient(socketPath).Search(context.Background(), SearchRequest{Path: "/src", Pattern: "TODO"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(result.Matches) != 1 || result.Matches[0].Line != 3 || result.Matches[0].Path != "/src/a.py" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestClientReportsUnreachableSocket(t *testing.T) {
+	client := NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := client.Resolve(context.Background(), 1); err == nil {
+		t.Fatal("expected an error without a listening mount")
+	}
+}
+
+func TestClientUnmountFlow(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	mount := &fakeMount{flushErrs: []error{errors.New("flush /a: errno 5")}}
+	forced := make(chan bool, 1)
+	server, err := Listen(socketPath, mount, func(force bool) { forced <- force })
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer server.Close()
+	client := NewClient(socketPath)
+	ctx := context.Background()
+
+	stats, err := client.Stats(ctx)
+	if err != nil || stats.DirtyFiles != 3 {
+		t.Fatalf("Stats = %+v, %v", stats, err)
+	}
+
+	err = client.Flush(ctx, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || apiErr.Message != "flush /a: errno 5" {
+		t.Fatalf("Flush = %v, want the flush errors", err)
+	}
+
+	if err := client.Unmount(ctx, true); err != nil {
+		t.Fatalf("Unmount: %v", err)
+	}
+	if force := <-forced; !force {
+		t.Fatal("Unmount(force) was not passed to the mount")
+	}
+}
+
+// reauthMount is a fakeMount whose credentials can be reloaded.
+type reauthMount struct {
+	fakeMount
+	resp ReauthResponse
+	err  error
+}
+
+func (m *reauthMount) Reauth(ctx context.Context) (ReauthResponse, error) {
+	return m.resp, m.err
+}
+
+func TestClientReauth(t *testing.T) {
+	expires := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	mount := &reauthMount{resp: ReauthResponse{User: "Me", AuthType: "databricks-cli", ExpiresAt: &expires}}
+	for _, tt := range []struct {
+		mount      Mount
+		err        error
+		wantStatus int
+	}{
+		{mount: &fakeMount{}, wantStatus: http.StatusNotImplemented},
+		{mount: mount},
+		{mount: mount, err: fmt.Errorf("no workspace backend: %w", errors.ErrUnsupported), wantStatus: http.StatusNotImplemented},
+		{mount: mount, err: errors.New("databricks-cli auth: token expired"), wantStatus: http.StatusBadGateway},
+	} {
+		mount.err = tt.err
+		socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+		server, err := Listen(socketPath, tt.mount, func(bool) {})
+		if err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		resp, err := NewClient(socketPath).Reauth(context.Background())
+		server.Close()
+
+		if tt.wantStatus != 0 {
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus {
+				t.Fatalf("Reauth failing with %v = %v, want HTTP %d", tt.err, err, tt.wantStatus)
+			}
+			continue
+		}
+		if err != nil || resp.User != "Me" || resp.AuthType != "databricks-cli" || resp.ExpiresAt == nil || !resp.ExpiresAt.Equal(expires) {
+			t.Fatalf("Reauth = %+v, %v", resp, err)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+// Package controlapi serves a small JSON API on a unix socket so editor
+// plugins and scripts can flush, invalidate, prefetch, pin, remove, inspect
+// and unmount a running wsfs mount, resolve workspace object IDs to paths,
+// search file contents, list trees, and refresh the mount's workspace
+// credentials.
+package controlapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	wsfsfuse "wsfs/internal/fuse"
+	"wsfs/internal/logging"
+	"wsfs/internal/unixsock"
+)
+
+// maxRequestBytes bounds request bodies; requests only carry path lists.
+const maxRequestBytes = 1 << 20
+
+// Mount is the part of a mounted filesystem the API manages. Paths are
+// relative to the mount root. *fuse.WSNode implements it for the root node.
+type Mount interface {
+	FlushPaths(ctx context.Context, paths []string) (int, []error)
+	InvalidatePaths(paths []string) int
+	ListTree(ctx context.Context, path string, depth int) (wsfsfuse.TreeResult, error)
+	Prefetch(ctx context.Context, path string) (wsfsfuse.PrefetchResult, error)
+	Pin(ctx context.Context, path string) (wsfsfuse.PrefetchResult, error)
+	Unpin(path string) (wsfsfuse.UnpinResult, error)
+	RemoveAll(ctx context.Context, path string) (wsfsfuse.RemoveResult, error)
+	ResolveObjectID(ctx context.Context, objectID int64) (wsfsfuse.ResolvedObject, error)
+	Search(ctx context.Context, path string, pattern *regexp.Regexp, maxMatches int) (wsfsfuse.SearchResult, error)
+	Stats() wsfsfuse.MountStats
+}
+
+var _ Mount = (*wsfsfuse.WSNode)(nil)
+
+// Reauthenticator is an optional extension for mounts whose workspace
+// credentials can be reloaded while mounted. Reauth returns an error
+// wrapping errors.ErrUnsupported when the mount has no credentials to
+// reload.
+type Reauthenticator interface {
+	Reauth(ctx context.Context) (ReauthResponse, error)
+}
+
+// Server is a control API listening on a unix socket.
+type Server struct {
+	server *http.Server
+}
+
+// PathsRequest is the body of flush and invalidate requests.
+type PathsRequest struct {
+	Paths []string `json:"paths"`
+}
+
+// PathRequest is the body of prefetch, pin, unpin and remove requests.
+type PathRequest struct {
+	Path string `json:"path"`
+}
+
+// PrefetchRequest is the body of a prefetch request.
+type PrefetchRequest = PathRequest
+
+// ResolveRequest is the body of a resolve request.
+type ResolveRequest struct {
+	ObjectID int64 `json:"object_id"`
+}
+
+// SearchRequest is the body of a search request. Pattern is an RE2 regular
+// expression matched against each line; MaxMatches 0 is unlimited.
+type SearchRequest struct {
+	Path       string `json:"path"`
+	Pattern    string `json:"pattern"`
+	IgnoreCase bool   `json:"ignore_case,omitempty"`
+	MaxMatches int    `json:"max_matches,omitempty"`
+}
+
+// TreeRequest is the body of a tree request. Depth 1 lists only the
+// children of Path; 0 is unlimited.
+type TreeRequest struct {
+	Path  string `json:"path"`
+	Depth int    `json:"depth,omitempty"`
+}
+
+// UnmountRequest is the body of an unmount request. Without Force the
+// mount stays up when dirty files fail to flush.
+type UnmountRequest struct {
+	Force bool `json:"force"`
+}
+
+// FlushResponse reports a flush. Errors lists files that failed to upload.
+type FlushResponse struct {
+	Flushed int      `json:"flushed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// InvalidateResponse reports how many loaded files and directories were reset.
+type InvalidateResponse struct {
+	Invalidated int `json:"invalidated"`
+}
+
+// ReauthResponse reports reloaded credentials. ExpiresAt is set when the
+// new token carries its expiry.
+type ReauthResponse struct {
+	User      string     `json:"user"`
+	AuthType  string     `json:"auth_type,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Listen creates the socket at socketPath, readable only by the mount owner,
+// and serves the API in the background until Close. unmount is called
+// asynchronously by the unmount endpoint.
+func Listen(socketPath string, mount Mount, unmount func(force bool)) (*Server, error) {
+	listener, err := unixsock.Listen(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{server: &http.Server{
+		Handler:           NewHandler(mount, unmount),
+		ReadHeaderTimeout: 10 * time.Second,
+	}}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Warnf("Control API stopped: %v", err)
+		}
+	}()
+	return s, nil
+}
+
+// Close stops the server and removes the socket.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// NewHandler returns the API routes:
+//
+//	GET  /v1/stats
+//	POST /v1/flush       {"paths": [...]}  (no paths flushes everything)
+//	POST /v1/invalidate  {"paths": [...]}
+//	POST /v1/prefetch    {"path": "..."}
+//	POST /v1/pin         {"path": "..."}  (pins and prefetches the files below)
+//	POST /v1/unpin       {"path": "..."}
+//	POST /v1/remove      {"path": "..."}  (recursive, like rm -rf)
+//	POST /v1/resolve     {"object_id": N}
+//	POST /v1/search      {"path": "...", "pattern": "...", "ignore_case": true, "max_matches": N}
+//	POST /v1/tree        {"path": "...", "depth": N}  (no depth lists the whole tree)
+//	POST /v1/reauth      (reloads the workspace credentials)
+//	POST /v1/unmount     {"force": true}  (force unmounts even if files fail to flush)
+func NewHandler(mount Mount, unmount func(force bool)) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, mount.Stats())
+	})
+	mux.HandleFunc("POST /v1/flush", func(w http.ResponseWriter, r *http.Request) {
+		var req PathsRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		flushed, errs := mount.FlushPaths(r.Context(), req.Paths)
+		resp := FlushResponse{Flushed: flushed}
+		for _, err := range errs {
+			resp.Errors = append(resp.Errors, err.Error())
+		}
+		status := http.StatusOK
+		if len(errs) > 0 {
+			status = http.StatusInternalServerError
+		}
+		writeJSON(w, status, resp)
+	})
+	mux.HandleFunc("POST /v1/invalidate", func(w http.ResponseWriter, r *http.Request) {
+		var req PathsRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if len(req.Paths) == 0 {
+			writeError(w, http.StatusBadRequest, errors.New("paths is required"))
+			return
+		}
+		writeJSON(w, http.StatusOK, InvalidateResponse{Invalidated: mount.InvalidatePaths(req.Paths)})
+	})
+	mux.HandleFunc("POST /v1/prefetch", func(w http.ResponseWriter, r *http.Request) {
+		var req PrefetchRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.Path == "" {
+			writeError(w, http.StatusBadRequest, errors.New("path is required"))
+			return
+		}
+		result, err := mount.Prefetch(r.Context(), req.Path)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, os.ErrNotExist) {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("POST /v1/pin", func(w http.ResponseWriter, r *http.Request) {
+		var req PathRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.Path == "" {
+			writeError(w, http.StatusBadRequest, errors.New("path is required"))
+			return
+		}
+		result, err := mount.Pin(r.Context(), req.Path)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, os.ErrNotExist) {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("POST /v1/unpin", func(w http.ResponseWriter, r *http.Request) {
+		var req PathRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.Path == "" {
+			writeError(w, http.StatusBadRequest, errors.New("path is required"))
+			return
+		}
+		result, err := mount.Unpin(req.Path)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("POST /v1/remove", func(w http.ResponseWriter, r *http.Request) {
+		var req PathRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.Path == "" {
+			writeError(w, http.StatusBadRequest, errors.New("path is required"))
+			return
+		}
+		result, err := mount.RemoveAll(r.Context(), req.Path)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				status = http.StatusNotFound
+			case errors.Is(err, os.ErrPermission):
+				status = http.StatusForbidden
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("POST /v1/resolve", func(w http.ResponseWriter, r *http.Request) {
+		var req ResolveRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.ObjectID <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("object_id is required"))
+			return
+		}
+		resolved, err := mount.ResolveObjectID(r.Context(), req.ObjectID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, os.ErrNotExist) {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resolved)
+	})
+	mux.HandleFunc("POST /v1/search", func(w http.ResponseWriter, r *http.Request) {
+		var req SearchRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.Pattern == "" {
+			writeError(w, http.StatusBadRequest, errors.New("pattern is required"))
+			return
+		}
+		expr := req.Pattern
+		if req.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid pattern: %w", err))
+			return
+		}
+		if req.Path == "" {
+			req.Path = "/"
+		}
+		result, err := mount.Search(r.Context(), req.Path, pattern, req.MaxMatches)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, os.ErrNotExist) {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("POST /v1/tree", func(w http.ResponseWriter, r *http.Request) {
+		var req TreeRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.Depth < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("depth must not be negative"))
+			return
+		}
+		if req.Path == "" {
+			req.Path = "/"
+		}
+		result, err := mount.ListTree(r.Context(), req.Path, req.Depth)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, os.ErrNotExist) {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("POST /v1/reauth", func(w http.ResponseWriter, r *http.Request) {
+		reauth, ok := mount.(Reauthenticator)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, errors.New("the mount cannot reload its credentials"))
+			return
+		}
+		resp, err := reauth.Reauth(r.Context())
+		if err != nil {
+			status := http.StatusBadGateway
+			if errors.Is(err, errors.ErrUnsupported) {
+				status = http.StatusNotImplemented
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+	mux.HandleFunc("POST /v1/unmount", func(w http.ResponseWriter, r *http.Request) {
+		var req UnmountRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		writeJSON(w, http.StatusAccepted, struct{}{})
+		// Unmounting flushes and waits for the kernel, so answer first.
+		go unmount(req.Force)
+	})
+	return mux
+}
+
+// readJSON decodes an optional JSON body into v. It writes a 400 response
+// and returns false when the body is malformed.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Debugf("Control API: failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,385 @@
+package controlapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	wsfsfuse "wsfs/internal/fuse"
+)
+
+type fakeMount struct {
+	mu          sync.Mutex
+	flushed     [][]string
+	invalidated [][]string
+	prefetched  []string
+	pinned      []string
+	unpinned    []string
+	removed     []string
+	resolved    []int64
+	searched    []string // path and pattern
+	listed      []string // path and depth
+	flushErrs   []error
+	prefetchErr error
+	removeErr   error
+	resolveErr  error
+}
+
+func (m *fakeMount) FlushPaths(ctx context.Context, paths []string) (int, []error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushed = append(m.flushed, paths)
+	return len(paths), m.flushErrs
+}
+
+func (m *fakeMount) InvalidatePaths(paths []string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.invalidated = append(m.invalidated, paths)
+	return len(paths)
+}
+
+func (m *fakeMount) Prefetch(ctx context.Context, path string) (wsfsfuse.PrefetchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prefetched = append(m.prefetched, path)
+	return wsfsfuse.PrefetchResult{Files: 2, Bytes: 42}, m.prefetchErr
+}
+
+func (m *fakeMount) Pin(ctx context.Context, path string) (wsfsfuse.PrefetchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pinned = append(m.pinned, path)
+	return wsfsfuse.PrefetchResult{Files: 1, Cached: 1, Pinned: 2}, nil
+}
+
+func (m *fakeMount) Unpin(path string) (wsfsfuse.UnpinResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unpinned = append(m.unpinned, path)
+	return wsfsfuse.UnpinResult{Unpinned: []string{"/Users/me/libs/a.so"}}, nil
+}
+
+func (m *fakeMount) RemoveAll(ctx context.Context, path string) (wsfsfuse.RemoveResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removed = append(m.removed, path)
+	return wsfsfuse.RemoveResult{Deletes: 1}, m.removeErr
+}
+
+func (m *fakeMount) ResolveObjectID(ctx context.Context, objectID int64) (wsfsfuse.ResolvedObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resolved = append(m.resolved, objectID)
+	if m.resolveErr != nil {
+		return wsfsfuse.ResolvedObject{}, m.resolveErr
+	}
+	return wsfsfuse.ResolvedObject{ObjectID: objectID, RemotePath: "/Users/me/nb", MountPath: "/nb.py", Loaded: true, Inode: 9}, nil
+}
+
+func (m *fakeMount) Search(ctx context.Context, path string, pattern *regexp.Regexp, maxMatches int) (wsfsfuse.SearchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.searched = append(m.searched, path, pattern.String())
+	if path == "/missing" {
+		return wsfsfuse.SearchResult{}, fmt.Errorf("stat %s: %w", path, os.ErrNotExist)
+	}
+	return wsfsfuse.SearchResult{Files: 1, Matches: []wsfsfuse.SearchMatch{{Path: "/src/a.py", Line: 3, Text: "TODO"}}}, nil
+}
+
+func (m *fakeMount) ListTree(ctx context.Context, path string, depth int) (wsfsfuse.TreeResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listed = append(m.listed, path, fmt.Sprint(depth))
+	if path == "/missing" {
+		return wsfsfuse.TreeResult{}, fmt.Errorf("stat %s: %w", path, os.ErrNotExist)
+	}
+	return wsfsfuse.TreeResult{Dirs: 1, Entries: []wsfsfuse.TreeEntry{{Path: "/src/a.py", Depth: 1, ObjectType: "FILE"}}}, nil
+}
+
+func (m *fakeMount) Stats() wsfsfuse.MountStats {
+	return wsfsfuse.MountStats{DirtyFiles: 3, Counters: map[string]int64{"upload_bytes": 7}}
+}
+
+func post(t *testing.T, client *http.Client, url, body string) (int, map[string]any) {
+	t.Helper()
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	var out map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode %s response: %v", url, err)
+	}
+	return resp.StatusCode, out
+}
+
+func TestHandlerRoutes(t *testing.T) {
+	mount := &fakeMount{}
+	unmounted := make(chan bool, 1)
+	server := httptest.NewServer(NewHandler(mount, func(force bool) { unmounted <- force }))
+	defer server.Close()
+	client := server.Client()
+
+	resp, err := client.Get(server.URL + "/v1/stats")
+	if err != nil {
+		t.Fatalf("GET stats: %v", err)
+	}
+	var stats wsfsfuse.MountStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	resp.Body.Close()
+	if stats.DirtyFiles != 3 || stats.Counters["upload_bytes"] != 7 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if status, out := post(t, client, server.URL+"/v1/flush", `{"paths":["/src"]}`); status != http.StatusOK || out["flushed"] != 1.0 {
+		t.Fatalf("flush = %d %v", status, out)
+	}
+	if status, _ := post(t, client, server.URL+"/v1/flush", ``); status != http.StatusOK {
+		t.Fatalf("flush without body = %d", status)
+	}
+	if !reflect.DeepEqual(mount.flushed, [][]string{{"/src"}, nil}) {
+		t.Fatalf("unexpected flush calls %v", mount.flushed)
+	}
+
+	if status, out := post(t, client, server.URL+"/v1/invalidate", `{"paths":["/a","/b"]}`); status != http.StatusOK || out["invalidated"] != 2.0 {
+		t.Fatalf("invalidate = %d %v", status, out)
+	}
+	if status, _ := post(t, client, server.URL+"/v1/invalidate", `{}`); status != http.StatusBadRequest {
+		t.Fatalf("invalidate without paths = %d, want 400", status)
+	}
+
+	if status, out := post(t, client, server.URL+"/v1/prefetch", `{"path":"/data"}`); status != http.StatusOK || out["files"] != 2.0 || out["bytes"] != 42.0 {
+		t.Fatalf("prefetch = %d %v", status, out)
+	}
+	if status, _ := post(t, client, server.URL+"/v1/prefetch", `{}`); status != http.StatusBadRequest {
+		t.Fatalf("prefetch without path = %d, want 400", status)
+	}
+
+	if status, out := post(t, client, server.URL+"/v1/pin", `{"path":"/libs"}`); status != http.StatusOK || out["pinned"] != 2.0 {
+		t.Fatalf("pin = %d %v", status, out)
+	}
+	if status, out := post(t, client, server.URL+"/v1/unpin", `{"path":"/libs"}`); status != http.StatusOK || len(out["unpinned"].([]any)) != 1 {
+		t.Fatalf("unpin = %d %v", status, out)
+	}
+	for _, route := range []string{"/v1/pin", "/v1/unpin"} {
+		if status, _ := post(t, client, server.URL+route, `{}`); status != http.StatusBadRequest {
+			t.Fatalf("%s without path = %d, want 400", route, status)
+		}
+	}
+	if !reflect.DeepEqual(mount.pinned, []string{"/libs"}) || !reflect.DeepEqual(mount.unpinned, []string{"/libs"}) {
+		t.Fatalf("unexpected pin calls %v, unpin calls %v", mount.pinned, mount.unpinned)
+	}
+
+	if status, out := post(t, client, server.URL+"/v1/remove", `{"path":"/build"}`); status != http.StatusOK || out["deletes"] != 1.0 || out["fallback"] != false {
+		t.Fatalf("remove = %d %v", status, out)
+	}
+	if status, _ := post(t, client, server.URL+"/v1/remove", `{}`); status != http.StatusBadRequest {
+		t.Fatalf("remove without path = %d, want 400", status)
+	}
+	if !reflect.DeepEqual(mount.removed, []string{"/build"}) {
+		t.Fatalf("unexpected remove calls %v", mount.removed)
+	}
+
+	if status, out := post(t, client, server.URL+"/v1/resolve", `{"object_id":123}`); status != http.StatusOK || out["mount_path"] != "/nb.py" || out["inode"] != 9.0 {
+		t.Fatalf("resolve = %d %v", status, out)
+	}
+	if status, _ := post(t, client, server.URL+"/v1/resolve", `{}`); status != http.StatusBadRequest {
+		t.Fatalf("resolve without object_id = %d, want 400", status)
+	}
+	if !reflect.DeepEqual(mount.resolved, []int64{123}) {
+		t.Fatalf("unexpected resolve calls %v", mount.resolved)
+	}
+
+	if status, out := post(t, client, server.URL+"/v1/search", `{"path":"/src","pattern":"todo","ignore_case":true}`); status != http.StatusOK || out["files"] != 1.0 {
+		t.Fatalf("search = %d %v", status, out)
+	}
+	if status, _ := post(t, client, server.URL+"/v1/search", `{"pattern":"x"}`); status != http.StatusOK {
+		t.Fatalf("search without path = %d", status)
+	}
+	if status, _ := post(t, client, server.URL+"/v1/search", `{"path":"/src"}`); status != http.StatusBadRequest {
+		t.Fatalf("search without pattern = %d, want 400", status)
+	}
+	if status, out := post(t, client, server.URL+"/v1/search", `{"pattern":"("}`); status != http.StatusBadRequest || out["error"] == nil {
+		t.Fatalf("search with invalid pattern = %d %v, want 400", status, out)
+	}
+	if !reflect.DeepEqual(mount.searched, []string{"/src", "(?i)todo", "/", "x"}) {
+		t.Fatalf("unexpected search calls %v", mount.searched)
+	}
+
+	if status, out := post(t, client, server.URL+"/v1/tree", `{"path":"/src","depth":2}`); status != http.StatusOK || out["dirs"] != 1.0 {
+		t.Fatalf("tree = %d %v", status, out)
+	}
+	if status, _ := post(t, client, server.URL+"/v1/tree", `{}`); status != http.StatusOK {
+		t.Fatalf("tree without path = %d", status)
+	}
+	if status, _ := post(t, client, server.URL+"/v1/tree", `{"depth":-1}`); status != http.StatusBadRequest {
+		t.Fatalf("tree with negative depth = %d, want 400", status)
+	}
+	if !reflect.DeepEqual(mount.listed, []string{"/src", "2", "/", "0"}) {
+		t.Fatalf("unexpected tree calls %v", mount.listed)
+	}
+
+	if status, _ := post(t, client, server.URL+"/v1/flush", `{"paths":`); status != http.StatusBadRequest {
+		t.Fatalf("malformed body = %d, want 400", status)
+	}
+	resp, err = client.Get(server.URL + "/v1/flush")
+	if err != nil {
+		t.Fatalf("GET flush: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET flush = %d, want 405", resp.StatusCode)
+	}
+
+	for body, wantForce := range map[string]bool{``: false, `{"force":true}`: true} {
+		if status, _ := post(t, client, server.URL+"/v1/unmount", body); status != http.StatusAccepted {
+			t.Fatalf("unmount %q = %d, want 202", body, status)
+		}
+		select {
+		case force := <-unmounted:
+			if force != wantForce {
+				t.Fatalf("unmount %q force = %v, want %v", body, force, wantForce)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("unmount was not requested")
+		}
+	}
+}
+
+func TestHandlerReportsFailures(t *testing.T) {
+	mount := &fakeMount{
+		flushErrs:   []error{errors.New("flush /a: errno 5")},
+		prefetchErr: fmt.Errorf("stat: %w", os.ErrNotExist),
+	}
+	server := httptest.NewServer(NewHandler(mount, func(bool) {}))
+	defer server.Close()
+
+	status, out := post(t, server.Client(), server.URL+"/v1/flush", `{"paths":["/a"]}`)
+	if status != http.StatusInternalServerError || !reflect.DeepEqual(out["errors"], []any{"flush /a: errno 5"}) {
+		t.Fatalf("flush failure = %d %v", status, out)
+	}
+	status, out = post(t, server.Client(), server.URL+"/v1/prefetch", `{"path":"/missing"}`)
+	if status != http.StatusNotFound || out["error"] == nil {
+		t.Fatalf("prefetch of missing path = %d %v", status, out)
+	}
+
+	for _, tt := range []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("stat: %w", os.ErrNotExist), http.StatusNotFound},
+		{fmt.Errorf("refusing to remove the mount root: %w", syscall.EPERM), http.StatusForbidden},
+		{errors.New("backend exploded"), http.StatusInternalServerError},
+	} {
+		mount.removeErr = tt.err
+		if status, out := post(t, server.Client(), server.URL+"/v1/remove", `{"path":"/x"}`); status != tt.want || out["error"] == nil {
+			t.Fatalf("remove failing with %v = %d %v, want %d", tt.err, status, out, tt.want)
+		}
+	}
+
+	mount.resolveErr = fmt.Errorf("object 7 not found: %w", os.ErrNotExist)
+	if status, out := post(t, server.Client(), server.URL+"/v1/resolve", `{"object_id":7}`); status != http.StatusNotFound || out["error"] == nil {
+		t.Fatalf("resolve of unknown ID = %d %v", status, out)
+	}
+	if status, out := post(t, server.Client(), server.URL+"/v1/search", `{"path":"/missing","pattern":"x"}`); status != http.StatusNotFound || out["error"] == nil {
+		t.Fatalf("search of missing path = %d %v", status, out)
+	}
+	if status, out := post(t, server.Client(), server.URL+"/v1/tree", `{"path":"/missing"}`); status != http.StatusNotFound || out["error"] == nil {
+		t.Fatalf("tree of missing path = %d %v", status, out)
+	}
+}
+
+func unixClient(socketPath string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}}
+}
+
+func TestListenServesOnOwnerOnlySocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	server, err := Listen(socketPath, &fakeMount{}, func(bool) {})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("socket mode = %o, want 600", perm)
+	}
+
+	resp, err := unixClient(socketPath).Get("http://wsfs/v1/stats")
+	if err != nil {
+		t.Fatalf("GET over socket: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Contains(body, []byte(`"dirty_files":3`)) {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, body)
+	}
+
+	if _, err := Listen(socketPath, &fakeMount{}, func(bool) {}); err == nil {
+		t.Fatal("expected a live socket to be refused")
+	}
+
+	if err := server.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Fatalf("expected socket to be removed, got %v", err)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	// A socket file nobody listens on, as left behind by a crash.
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	server, err := Listen(socketPath, &fakeMount{}, func(bool) {})
+	if err != nil {
+		t.Fatalf("Listen over stale socket: %v", err)
+	}
+	server.Close()
+}
+
+func TestListenRefusesNonSocketPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "important.txt")
+	if err := os.WriteFile(path, []byte("keep me"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Listen(path, &fakeMount{}, func(bool) {}); err == nil {
+		t.Fatal("expected a regular file to be refused")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "keep me" {
+		t.Fatalf("regular file was modified: %q", data)
+	}
+}
@@ -0,0 +1,160 @@
+package databricks
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/pathutil"
+)
+
+const (
+	savedNotebookBefore = "# Databricks notebook source\nprint('before')\n"
+	savedNotebookAfter  = "# Databricks notebook source\nprint('after')\n"
+)
+
+func newNotebookWorkspace(t *testing.T) (*fakeWorkspace, *WorkspaceFilesClient, int64) {
+	t.Helper()
+	ws := newFakeWorkspace()
+	ws.put("/foo", workspace.ObjectTypeNotebook, workspace.LanguagePython, []byte(savedNotebookBefore))
+	obj, _ := ws.object("/foo")
+	return ws, ws.client(), obj.info.ObjectId
+}
+
+func assertSavedNotebook(t *testing.T, ws *fakeWorkspace, client *WorkspaceFilesClient, objectID int64, wantPaths ...string) {
+	t.Helper()
+	obj, ok := ws.object("/foo")
+	if !ok || obj.info.ObjectType != workspace.ObjectTypeNotebook {
+		t.Fatalf("notebook /foo is gone: %+v", obj.info)
+	}
+	if obj.info.ObjectId != objectID {
+		t.Fatalf("ObjectId changed from %d to %d", objectID, obj.info.ObjectId)
+	}
+	if string(obj.content) != savedNotebookAfter {
+		t.Fatalf("unexpected notebook content %q", obj.content)
+	}
+	data, err := client.ReadAll(context.Background(), "/foo.py")
+	if err != nil || string(data) != savedNotebookAfter {
+		t.Fatalf("ReadAll(/foo.py) = %q, %v", data, err)
+	}
+	if got := ws.paths(); strings.Join(got, ",") != strings.Join(wantPaths, ",") {
+		t.Fatalf("workspace objects = %v, want %v", got, wantPaths)
+	}
+}
+
+func TestAtomicSaveRenameOverNotebook(t *testing.T) {
+	ws, client, objectID := newNotebookWorkspace(t)
+	ctx := context.Background()
+
+	// VS Code and most "safe write" implementations: write temp, rename over.
+	if err := client.Write(ctx, "/.foo.py.tmp1234", []byte(savedNotebookAfter)); err != nil {
+		t.Fatalf("Write temp: %v", err)
+	}
+	if err := client.Rename(ctx, "/.foo.py.tmp1234", "/foo.py"); err != nil {
+		t.Fatalf("Rename over notebook: %v", err)
+	}
+	assertSavedNotebook(t, ws, client, objectID, "/foo")
+}
+
+func TestAtomicSaveNotebookTempRenameOverNotebook(t *testing.T) {
+	ws, client, objectID := newNotebookWorkspace(t)
+	ctx := context.Background()
+
+	// A temp name that keeps the source suffix is itself created as a notebook.
+	if err := client.Write(ctx, "/foo.tmp.py", []byte(savedNotebookAfter)); err != nil {
+		t.Fatalf("Write temp: %v", err)
+	}
+	if obj, ok := ws.object("/foo.tmp"); !ok || obj.info.ObjectType != workspace.ObjectTypeNotebook {
+		t.Fatalf("expected temp notebook, got %+v", obj.info)
+	}
+	if err := client.Rename(ctx, "/foo.tmp.py", "/foo.py"); err != nil {
+		t.Fatalf("Rename over notebook: %v", err)
+	}
+	assertSavedNotebook(t, ws, client, objectID, "/foo")
+}
+
+func TestAtomicSaveConvertsLanguageOfNotebookTemp(t *testing.T) {
+	ws, client, objectID := newNotebookWorkspace(t)
+	ctx := context.Background()
+
+	if err := client.Write(ctx, "/foo.tmp.sql", []byte("-- Databricks notebook source\nprint('after')\n")); err != nil {
+		t.Fatalf("Write temp: %v", err)
+	}
+	if err := client.Rename(ctx, "/foo.tmp.sql", "/foo.py"); err != nil {
+		t.Fatalf("Rename over notebook: %v", err)
+	}
+	assertSavedNotebook(t, ws, client, objectID, "/foo")
+}
+
+func TestAtomicSaveJetBrainsSafeWrite(t *testing.T) {
+	ws, client, objectID := newNotebookWorkspace(t)
+	ctx := context.Background()
+
+	if err := client.Write(ctx, "/foo.py___jb_tmp___", []byte(savedNotebookAfter)); err != nil {
+		t.Fatalf("Write temp: %v", err)
+	}
+	if err := client.Rename(ctx, "/foo.py", "/foo.py___jb_old___"); err != nil {
+		t.Fatalf("Rename original away: %v", err)
+	}
+	backup, ok := ws.object("/foo.py___jb_old___")
+	if !ok || backup.info.ObjectType != workspace.ObjectTypeNotebook || backup.info.ObjectId != objectID {
+		t.Fatalf("notebook not moved to the backup name: %+v", backup.info)
+	}
+	if _, err := client.Stat(ctx, "/foo.py"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat(/foo.py) after the rename = %v, want ErrNotExist", err)
+	}
+	if err := client.Rename(ctx, "/foo.py___jb_tmp___", "/foo.py"); err != nil {
+		t.Fatalf("Rename temp over original: %v", err)
+	}
+	backup, ok = ws.object("/foo.py___jb_old___")
+	if !ok || backup.info.ObjectType != workspace.ObjectTypeFile || string(backup.content) != savedNotebookBefore {
+		t.Fatalf("unexpected backup %+v %q", backup.info, backup.content)
+	}
+	if err := client.Delete(ctx, "/foo.py___jb_old___", false); err != nil {
+		t.Fatalf("Delete backup: %v", err)
+	}
+	assertSavedNotebook(t, ws, client, objectID, "/foo")
+}
+
+func TestRenameNotebookToBackupNameMovesIt(t *testing.T) {
+	ws, client, objectID := newNotebookWorkspace(t)
+	ctx := context.Background()
+
+	if err := client.Rename(ctx, "/foo.py", "/foo.py~"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if got := ws.paths(); strings.Join(got, ",") != "/foo.py~" {
+		t.Fatalf("workspace objects = %v, want the notebook moved", got)
+	}
+	if obj, _ := ws.object("/foo.py~"); obj.info.ObjectId != objectID {
+		t.Fatalf("ObjectId changed from %d to %d", objectID, obj.info.ObjectId)
+	}
+	entries, err := client.ReadDir(ctx, "/")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir = %v, %v", entries, err)
+	}
+	if name := pathutil.NotebookVisibleName(entries[0].Name(), workspace.LanguagePython); name != "foo.py~" {
+		t.Fatalf("backup shown as %q, want foo.py~", name)
+	}
+	data, err := client.ReadAll(ctx, "/foo.py~")
+	if err != nil || string(data) != savedNotebookBefore {
+		t.Fatalf("ReadAll(/foo.py~) = %q, %v", data, err)
+	}
+}
+
+func TestAtomicSaveBackupRenameOfRegularFileMoves(t *testing.T) {
+	ws := newFakeWorkspace()
+	ws.put("/notes.txt", workspace.ObjectTypeFile, "", []byte("old"))
+	client := ws.client()
+
+	if err := client.Rename(context.Background(), "/notes.txt", "/notes.txt~"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if got := ws.paths(); strings.Join(got, ",") != "/notes.txt~" {
+		t.Fatalf("workspace objects = %v, want a plain move", got)
+	}
+}
@@ -0,0 +1,72 @@
+package databricks
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+)
+
+// batchStatWorkers bounds the concurrent stats of a BatchStat fan-out.
+const batchStatWorkers = 8
+
+// StatResult is the outcome of one path of a BatchStat call.
+type StatResult struct {
+	Info fs.FileInfo
+	Err  error
+}
+
+// BatchStater is an optional extension for backends that can stat many
+// paths in one call. Only readdir uses it, to recheck the loaded children of
+// a directory a readdirplus listing is about to look up; prefetch and the
+// repo warm-up take metadata from listings and stat nothing per file.
+type BatchStater interface {
+	// BatchStat returns one result per path, in the order of paths.
+	BatchStat(ctx context.Context, paths []string) []StatResult
+}
+
+var _ BatchStater = (*WorkspaceFilesClient)(nil)
+
+// BatchStat stats paths through api's BatchStat when it has one, and
+// otherwise through Stat, up to batchStatWorkers at a time.
+func BatchStat(ctx context.Context, api WorkspaceFilesAPI, paths []string) []StatResult {
+	if stater, ok := api.(BatchStater); ok {
+		return stater.BatchStat(ctx, paths)
+	}
+	return StatFanOut(ctx, api.Stat, paths)
+}
+
+// BatchStat stats paths like Stat. The workspace-files API has no batch
+// object-info request, so paths in the metadata cache are answered from it
+// and the rest are fetched one object-info request each, up to
+// batchStatWorkers at a time.
+func (c *WorkspaceFilesClient) BatchStat(ctx context.Context, paths []string) []StatResult {
+	return StatFanOut(ctx, c.Stat, paths)
+}
+
+// StatFanOut calls stat for every path, up to batchStatWorkers at a time,
+// for backends that wrap one without a BatchStat of its own. Paths not
+// started when ctx ends get ctx's error.
+func StatFanOut(ctx context.Context, stat func(context.Context, string) (fs.FileInfo, error), paths []string) []StatResult {
+	results := make([]StatResult, len(paths))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(batchStatWorkers, len(paths)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				results[i].Info, results[i].Err = stat(ctx, paths[i])
+			}
+		}()
+	}
+	for i := range paths {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
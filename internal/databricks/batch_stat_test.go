@@ -0,0 +1,82 @@
+package databricks
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type batchStatAPI struct {
+	FakeWorkspaceAPI
+	paths []string
+}
+
+func (a *batchStatAPI) BatchStat(ctx context.Context, paths []string) []StatResult {
+	a.paths = append(a.paths, paths...)
+	return make([]StatResult, len(paths))
+}
+
+func TestBatchStatFansOutWithBoundedConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	api := &FakeWorkspaceAPI{
+		StatFunc: func(ctx context.Context, filePath string) (fs.FileInfo, error) {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			if strings.HasSuffix(filePath, "missing") {
+				return nil, fs.ErrNotExist
+			}
+			return NewTestFileInfo(filePath, 1, false), nil
+		},
+	}
+	paths := make([]string, 3*batchStatWorkers)
+	for i := range paths {
+		paths[i] = "/dir/file" + string(rune('a'+i))
+	}
+	paths[5] = "/dir/missing"
+
+	results := BatchStat(context.Background(), api, paths)
+	if len(results) != len(paths) {
+		t.Fatalf("got %d results for %d paths", len(results), len(paths))
+	}
+	for i, result := range results {
+		if i == 5 {
+			if !errors.Is(result.Err, fs.ErrNotExist) {
+				t.Fatalf("result for a missing path = %+v", result)
+			}
+			continue
+		}
+		if result.Err != nil || result.Info.(WSFileInfo).Path != paths[i] {
+			t.Fatalf("result %d = %+v, want %s", i, result, paths[i])
+		}
+	}
+	if peak > batchStatWorkers || peak < 2 {
+		t.Fatalf("peak concurrency %d, want 2..%d", peak, batchStatWorkers)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range BatchStat(ctx, api, paths[:2]) {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Fatalf("result with a canceled context = %+v", result)
+		}
+	}
+}
+
+func TestBatchStatUsesBackendBatchStat(t *testing.T) {
+	api := &batchStatAPI{}
+	results := BatchStat(context.Background(), api, []string{"/a", "/b"})
+	if len(results) != 2 || len(api.paths) != 2 {
+		t.Fatalf("BatchStat did not use the backend's: %d results, %v", len(results), api.paths)
+	}
+}
@@ -11,9 +11,11 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/databricks/databricks-sdk-go"
@@ -21,8 +23,10 @@ import (
 	"github.com/databricks/databricks-sdk-go/client"
 	"github.com/databricks/databricks-sdk-go/service/workspace"
 
+	"wsfs/internal/faultinject"
 	"wsfs/internal/logging"
 	"wsfs/internal/metacache"
+	"wsfs/internal/metrics"
 	"wsfs/internal/pathutil"
 	"wsfs/internal/retry"
 )
@@ -33,19 +37,43 @@ const httpTimeout = 2 * time.Minute
 // Maximum length for response body in error messages
 const maxErrorBodyLen = 200
 
-// Size threshold for API selection (5MB)
+// Default size threshold for API selection (5MB), see TransferConfig.
 // Files smaller than this use import-file directly (1 round trip)
 // Files larger than this use new-files + signed URL (direct cloud storage)
 const sizeThresholdForSignedURL = 5 * 1024 * 1024 // 5MB
 
+// revalidateTimeout bounds a background refresh of stale metadata.
+const revalidateTimeout = time.Minute
+
+// uploadProgressLogInterval is how often signed URL uploads log progress.
+const uploadProgressLogInterval = 5 * time.Second
+
 const (
-	defaultMetadataTTL = 10 * time.Second
-	defaultNegativeTTL = 3 * time.Second
+	defaultMetadataTTL  = 10 * time.Second
+	defaultNegativeTTL  = 3 * time.Second
+	defaultSignedURLTTL = 5 * time.Second
 )
 
 type CacheConfig struct {
 	MetadataTTL time.Duration
 	NegativeTTL time.Duration
+	// SignedURLTTL is how long a signed URL from a listing or Stat is
+	// reused for reads. Signed URLs are kept apart from the attributes, so
+	// attributes stay cached for MetadataTTL however soon URLs expire.
+	SignedURLTTL time.Duration
+	// StaleWhileRevalidate, when positive, answers Stat and ReadDir from
+	// metadata up to this long past its TTL while a background request
+	// refreshes it. It caps how stale an answer may be.
+	StaleWhileRevalidate time.Duration
+	// MaxEntries bounds the stat results and listings the metadata cache
+	// holds together. Zero uses the cache's default.
+	MaxEntries int
+	// ValidateListings keeps expired listings of directories that report a
+	// modification time and, before listing one again, stats the directory
+	// instead: if its modification time is unchanged the old listing is
+	// renewed. It relies on the workspace bumping a directory's
+	// modification time whenever its entries change.
+	ValidateListings bool
 }
 
 func (c CacheConfig) withDefaults() CacheConfig {
@@ -55,6 +83,9 @@ func (c CacheConfig) withDefaults() CacheConfig {
 	if c.NegativeTTL <= 0 {
 		c.NegativeTTL = defaultNegativeTTL
 	}
+	if c.SignedURLTTL <= 0 {
+		c.SignedURLTTL = defaultSignedURLTTL
+	}
 	return c
 }
 
@@ -118,6 +149,14 @@ type WSFileInfo struct {
 	NotebookSizeComputed bool
 }
 
+// withoutSignedURL returns info without its signed URL, as the metadata
+// cache stores it.
+func (info WSFileInfo) withoutSignedURL() WSFileInfo {
+	info.SignedURL = ""
+	info.SignedURLHeaders = nil
+	return info
+}
+
 func (info WSFileInfo) Name() string {
 	return path.Base(info.Path)
 }
@@ -218,9 +257,25 @@ type WorkspaceFilesClient struct {
 	workspaceClient workspaceClient
 	apiClient       apiDoer
 	cache           *metacache.Cache
-	flights         singleflightGroup
-	exactMu         sync.RWMutex
-	exactNotebooks  map[string]WSFileInfo
+	staleWindow     time.Duration // CacheConfig.StaleWhileRevalidate
+	validateLists   bool          // CacheConfig.ValidateListings
+	revalidating    sync.Map      // flight keys of running background refreshes
+	// signedURLs holds the signed URLs of cached files, by path, under
+	// their own short TTL.
+	signedURLs     *metacache.Cache
+	flights        singleflightGroup
+	exactMu        sync.RWMutex
+	exactNotebooks map[string]WSFileInfo
+	// signedURLTransport carries signed URL transfers. Nil uses the shared
+	// defaultSignedURLTransport.
+	signedURLTransport http.RoundTripper
+	signedURLOnce      sync.Once
+	signedURLHTTP      *retry.HTTPClient
+	transfers          *transferPolicy
+	maxNotebookSize    int64
+	notebookAliases    pathutil.NotebookAliases
+	reposMu            sync.Mutex
+	warmedRepos        map[string]repoWarm // by repo path
 }
 
 func NewWorkspaceFilesClient(w *databricks.WorkspaceClient) (*WorkspaceFilesClient, error) {
@@ -233,7 +288,11 @@ func NewWorkspaceFilesClientWithConfig(w *databricks.WorkspaceClient, cfg CacheC
 		return nil, err
 	}
 
-	return NewWorkspaceFilesClientWithDepsAndConfig(w.Workspace, databricksClient, nil, cfg), nil
+	c := NewWorkspaceFilesClientWithDepsAndConfig(w.Workspace, databricksClient, nil, cfg)
+	// Signed URL transfers share the SDK's transport override, so test and
+	// fault-injection transports see them too.
+	c.signedURLTransport = w.Config.HTTPTransport
+	return c, nil
 }
 
 func NewWorkspaceFilesClientWithDeps(workspaceClient workspaceClient, apiClient apiDoer, c *metacache.Cache) *WorkspaceFilesClient {
@@ -241,22 +300,55 @@ func NewWorkspaceFilesClientWithDeps(workspaceClient workspaceClient, apiClient
 }
 
 func NewWorkspaceFilesClientWithDepsAndConfig(workspaceClient workspaceClient, apiClient apiDoer, c *metacache.Cache, cfg CacheConfig) *WorkspaceFilesClient {
+	cfg = cfg.withDefaults()
 	if c == nil {
-		cfg = cfg.withDefaults()
-		c = metacache.NewCacheWithTTLs(cfg.MetadataTTL, cfg.NegativeTTL)
+		c = metacache.NewCacheWithConfig(cfg.MetadataTTL, cfg.NegativeTTL, cfg.MaxEntries)
+	}
+	if cfg.StaleWhileRevalidate > 0 {
+		c.SetStaleWindow(cfg.StaleWhileRevalidate)
 	}
 	return &WorkspaceFilesClient{
 		workspaceClient: workspaceClient,
 		apiClient:       apiClient,
 		cache:           c,
+		signedURLs:      metacache.NewCacheWithTTLs(cfg.SignedURLTTL, cfg.SignedURLTTL),
+		staleWindow:     cfg.StaleWhileRevalidate,
+		validateLists:   cfg.ValidateListings,
 		exactNotebooks:  make(map[string]WSFileInfo),
+		transfers:       newTransferPolicy(TransferConfig{}),
 	}
 }
 
+// SetCacheConfig replaces the metadata and signed URL caches with ones
+// using cfg's TTLs and limits. Call it before the client is used.
+func (c *WorkspaceFilesClient) SetCacheConfig(cfg CacheConfig) {
+	cfg = cfg.withDefaults()
+	c.cache = metacache.NewCacheWithConfig(cfg.MetadataTTL, cfg.NegativeTTL, cfg.MaxEntries)
+	c.cache.SetStaleWindow(cfg.StaleWhileRevalidate)
+	c.signedURLs = metacache.NewCacheWithTTLs(cfg.SignedURLTTL, cfg.SignedURLTTL)
+	c.staleWindow = cfg.StaleWhileRevalidate
+	c.validateLists = cfg.ValidateListings
+}
+
+// SetTransferConfig changes how file contents are transferred. Call it
+// before the client is used.
+func (c *WorkspaceFilesClient) SetTransferConfig(cfg TransferConfig) {
+	c.transfers = newTransferPolicy(cfg)
+	c.maxNotebookSize = cfg.MaxNotebookSize
+}
+
+// SetNotebookAliases changes the names notebooks are shown under. With
+// NotebookAliasesNone, suffixed paths no longer resolve to notebooks and new
+// files with a source suffix are regular files. Call it before the client
+// is used.
+func (c *WorkspaceFilesClient) SetNotebookAliases(aliases pathutil.NotebookAliases) {
+	c.notebookAliases = aliases
+}
+
 func (c *WorkspaceFilesClient) Stat(ctx context.Context, filePath string) (fs.FileInfo, error) {
 	info, err := c.statInternal(ctx, filePath)
-	if err == nil {
-		return info, nil
+	if err == nil || !c.notebookAliases.SuffixNames() {
+		return info, err
 	}
 	if !errors.Is(err, fs.ErrNotExist) {
 		return nil, err
@@ -283,8 +375,8 @@ func (c *WorkspaceFilesClient) Stat(ctx context.Context, filePath string) (fs.Fi
 
 func (c *WorkspaceFilesClient) StatFresh(ctx context.Context, filePath string) (fs.FileInfo, error) {
 	info, err := c.statFreshInternal(ctx, filePath)
-	if err == nil {
-		return info, nil
+	if err == nil || !c.notebookAliases.SuffixNames() {
+		return info, err
 	}
 	if !errors.Is(err, fs.ErrNotExist) {
 		return nil, err
@@ -365,7 +457,7 @@ func (c *WorkspaceFilesClient) statFreshInternal(ctx context.Context, filePath s
 	if cachedInfo, ok := c.exactNotebookInfoForKey(filePath); ok {
 		previousExact = cachedInfo
 	}
-	c.cache.Invalidate(filePath)
+	c.cache.Invalidate(metacache.ReasonRefresh, filePath)
 	info, err := c.statFromBackend(ctx, filePath)
 	if err != nil {
 		return nil, err
@@ -390,7 +482,7 @@ func (c *WorkspaceFilesClient) statNotebookBySourceAliasFresh(ctx context.Contex
 		return nil, fs.ErrNotExist
 	}
 
-	c.cache.Invalidate(filePath)
+	c.cache.Invalidate(metacache.ReasonRefresh, filePath)
 	info, err := c.statFreshInternal(ctx, actualPath)
 	if err != nil {
 		return nil, err
@@ -410,7 +502,7 @@ func (c *WorkspaceFilesClient) statNotebookByFallbackAliasFresh(ctx context.Cont
 		return nil, fs.ErrNotExist
 	}
 
-	c.cache.Invalidate(filePath)
+	c.cache.Invalidate(metacache.ReasonRefresh, filePath)
 	info, err := c.statFreshInternal(ctx, actualPath)
 	if err != nil {
 		return nil, err
@@ -544,14 +636,10 @@ func notebookExactInfoKeys(cacheKey string, info WSFileInfo) []string {
 }
 
 func notebookInvalidateTargets(filePath string) map[string]struct{} {
-	targets := map[string]struct{}{
-		filePath: {},
-	}
-	if actualPath, _, ok := pathutil.NotebookRemotePathFromSourcePath(filePath); ok {
-		targets[actualPath] = struct{}{}
-	}
-	if actualPath, ok := pathutil.NotebookRemotePathFromFallbackPath(filePath); ok {
-		targets[actualPath] = struct{}{}
+	aliases := pathutil.NotebookAliasPaths(filePath)
+	targets := make(map[string]struct{}, len(aliases))
+	for _, alias := range aliases {
+		targets[alias] = struct{}{}
 	}
 	return targets
 }
@@ -694,15 +782,21 @@ func (c *WorkspaceFilesClient) rememberNotebookExactSize(cacheKey string, info W
 
 func (c *WorkspaceFilesClient) statFromBackend(ctx context.Context, filePath string) (fs.FileInfo, error) {
 	value, err := c.flights.Do("stat:"+filePath, func() (any, error) {
+		// A delete or rename finishing while the request is out must not
+		// be undone by storing its result.
+		generation := c.cache.Generation()
 		var resp objectInfoResponse
 		urlPath := fmt.Sprintf(
 			"/api/2.0/workspace-files/object-info?path=%s",
 			url.QueryEscape(filePath),
 		)
 
-		if err := c.apiClient.Do(ctx, http.MethodGet, urlPath, nil, nil, nil, &resp); err != nil {
-			c.cache.Set(filePath, nil)
-			return nil, normalizeNotExistError(err)
+		if err := c.do(ctx, http.MethodGet, urlPath, nil, &resp); err != nil {
+			err = normalizeNotExistError(err)
+			if errors.Is(err, fs.ErrNotExist) {
+				c.cache.SetIfUnchanged(generation, filePath, nil)
+			}
+			return nil, err
 		}
 
 		apiInfo := WSFileInfo{ObjectInfo: resp.WsfsObjectInfo.ObjectInfo}
@@ -713,7 +807,8 @@ func (c *WorkspaceFilesClient) statFromBackend(ctx context.Context, filePath str
 		if merged, changed := c.cachedExactNotebookInfo(filePath, apiInfo); changed {
 			apiInfo = merged
 		}
-		c.cache.Set(filePath, apiInfo)
+		c.cache.SetIfUnchanged(generation, filePath, apiInfo.withoutSignedURL())
+		c.rememberSignedURL(apiInfo)
 		return apiInfo, nil
 	})
 	if err != nil {
@@ -745,49 +840,144 @@ func (c *WorkspaceFilesClient) statInternal(ctx context.Context, filePath string
 		return nil, fs.ErrNotExist
 	}
 
+	if c.staleWindow > 0 {
+		if info, found := c.cache.GetStale(filePath); found {
+			c.revalidate("stat:"+filePath, func(ctx context.Context) error {
+				_, err := c.statFromBackend(ctx, filePath)
+				return err
+			})
+			if info == nil {
+				return nil, fs.ErrNotExist
+			}
+			return c.preserveNotebookExactSize(filePath, info), nil
+		}
+	}
+
 	return c.statFromBackend(ctx, filePath)
 }
 
 func (c *WorkspaceFilesClient) ReadDir(ctx context.Context, dirPath string) ([]fs.DirEntry, error) {
 	if entries, found := c.cache.GetDirEntries(dirPath); found {
-		return entries, nil
+		return c.withExactNotebookSizes(entries), nil
+	}
+	if c.staleWindow > 0 {
+		if entries, found := c.cache.GetStaleDirEntries(dirPath); found {
+			c.revalidate("readdir:"+dirPath, func(ctx context.Context) error {
+				_, err := c.readDirFromBackend(ctx, dirPath)
+				return err
+			})
+			return c.withExactNotebookSizes(entries), nil
+		}
 	}
+	return c.readDirFromBackend(ctx, dirPath)
+}
+
+// withExactNotebookSizes returns a cached listing with the exported sizes
+// learned since it was listed, so tree listings and diff report the size
+// reads return rather than the workspace's own notebook size. A notebook
+// modified since it was exported keeps the listed size.
+func (c *WorkspaceFilesClient) withExactNotebookSizes(entries []fs.DirEntry) []fs.DirEntry {
+	var out []fs.DirEntry
+	for i, entry := range entries {
+		wsEntry, ok := entry.(WSDirEntry)
+		if !ok || !wsEntry.IsNotebook() || wsEntry.NotebookSizeComputed {
+			continue
+		}
+		c.exactMu.RLock()
+		exact, ok := c.exactNotebooks[wsEntry.Path]
+		c.exactMu.RUnlock()
+		if !ok {
+			continue
+		}
+		merged, changed := mergeNotebookExactSize(wsEntry.WSFileInfo, exact)
+		if !changed {
+			continue
+		}
+		if out == nil {
+			out = slices.Clone(entries)
+		}
+		out[i] = WSDirEntry{merged}
+	}
+	if out == nil {
+		return entries
+	}
+	return out
+}
+
+// revalidate runs refresh for stale metadata in the background, unless a
+// refresh for the same flight key is already running. A failed refresh
+// keeps the stale item until the stale window ends.
+func (c *WorkspaceFilesClient) revalidate(key string, refresh func(context.Context) error) {
+	if _, running := c.revalidating.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	go func() {
+		defer c.revalidating.Delete(key)
+		ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+		defer cancel()
+		if err := refresh(ctx); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logging.Debugf("Background refresh %s failed: %s", key, sanitizeError(err))
+		}
+	}()
+}
 
+func (c *WorkspaceFilesClient) readDirFromBackend(ctx context.Context, dirPath string) ([]fs.DirEntry, error) {
 	value, err := c.flights.Do("readdir:"+dirPath, func() (any, error) {
 		if entries, found := c.cache.GetDirEntries(dirPath); found {
 			return entries, nil
 		}
 
+		generation := c.cache.Generation()
+		var version string
+		if c.validateLists {
+			var entries []fs.DirEntry
+			var renewed bool
+			var err error
+			version, entries, renewed, err = c.validateDirEntries(ctx, generation, dirPath)
+			if err != nil {
+				return nil, err
+			}
+			if renewed {
+				return entries, nil
+			}
+		}
+
 		var resp listFilesResponse
 		urlPath := fmt.Sprintf(
 			"/api/2.0/workspace-files/list-files?path=%s",
 			url.QueryEscape(dirPath),
 		)
 
-		if err := c.apiClient.Do(ctx, http.MethodGet, urlPath, nil, nil, nil, &resp); err != nil {
+		if err := c.do(ctx, http.MethodGet, urlPath, nil, &resp); err != nil {
 			return nil, normalizeNotExistError(err)
 		}
 
-		entries := make([]fs.DirEntry, len(resp.Objects))
+		entries := make([]fs.DirEntry, 0, len(resp.Objects))
 		lookup := make([]metacache.DirLookupEntry, 0, len(resp.Objects))
 		usedNames := make(map[string]struct{}, len(resp.Objects))
 		notebooks := make([]WSFileInfo, 0, len(resp.Objects))
 
-		for i, obj := range resp.Objects {
+		for _, obj := range resp.Objects {
 			info := WSFileInfo{
 				ObjectInfo: obj.ObjectInfo,
 			}
+			if c.cache.Tombstoned(info.Path) {
+				// Deleted here; the listing has not caught up yet.
+				continue
+			}
 			if obj.SignedURL != nil {
 				info.SignedURL = obj.SignedURL.URL
 				info.SignedURLHeaders = obj.SignedURL.Headers
+				c.rememberSignedURL(info)
+				info = info.withoutSignedURL()
 			}
 			if merged, changed := c.cachedExactNotebookInfo(info.Path, info); changed {
 				info = merged
 			}
 
 			entry := WSDirEntry{info}
-			entries[i] = entry
-			c.cache.Set(info.Path, info)
+			entries = append(entries, entry)
+			c.cache.SetIfUnchanged(generation, info.Path, info)
 
 			if info.IsNotebook() {
 				notebooks = append(notebooks, info)
@@ -799,6 +989,12 @@ func (c *WorkspaceFilesClient) ReadDir(ctx context.Context, dirPath string) ([]f
 		}
 
 		for _, info := range notebooks {
+			if c.notebookAliases.BareNames() {
+				lookup = append(lookup, metacache.DirLookupEntry{Name: info.Name(), Info: info})
+			}
+			if !c.notebookAliases.SuffixNames() {
+				continue
+			}
 			name, visible := notebookVisibleName(info, usedNames)
 			if !visible {
 				continue
@@ -810,7 +1006,7 @@ func (c *WorkspaceFilesClient) ReadDir(ctx context.Context, dirPath string) ([]f
 			return entries[i].Name() < entries[j].Name()
 		})
 
-		c.cache.SetDirEntries(dirPath, entries, lookup)
+		c.cache.SetVersionedDirEntriesIfUnchanged(generation, dirPath, version, entries, lookup)
 		return entries, nil
 	})
 	if err != nil {
@@ -824,8 +1020,91 @@ func (c *WorkspaceFilesClient) ReadDir(ctx context.Context, dirPath string) ([]f
 	return entries, nil
 }
 
+// validateDirEntries returns the expired listing of dirPath renewed, when
+// a stat finds the directory at the version it was listed at. Otherwise it
+// returns the version to store with a new listing: the one that stat found,
+// or the last the cache knew of. Either was seen before the listing, so a
+// change racing with it leaves the stored version behind and is caught at
+// the next check.
+func (c *WorkspaceFilesClient) validateDirEntries(ctx context.Context, generation uint64, dirPath string) (version string, entries []fs.DirEntry, renewed bool, err error) {
+	kept := c.cache.ExpiredDirVersion(dirPath)
+	if kept == "" {
+		known, _ := c.cache.Peek(dirPath)
+		return dirVersion(known), nil, false, nil
+	}
+	info, err := c.statFromBackend(ctx, dirPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil, false, err
+		}
+		// The listing reports the failure, or succeeds without a version.
+		return "", nil, false, nil
+	}
+	version = dirVersion(info)
+	if version == kept {
+		entries, renewed = c.cache.RenewDirEntries(generation, dirPath, version)
+	}
+	return version, entries, renewed, nil
+}
+
+// dirVersion returns the version of a directory for metadata cache
+// listings, or "" when info is not a directory with a modification time.
+func dirVersion(info fs.FileInfo) string {
+	wsInfo, ok := toWSFileInfo(info)
+	if !ok || !wsInfo.IsDir() || wsInfo.ModifiedAt == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d@%d", wsInfo.ObjectId, wsInfo.ModifiedAt)
+}
+
+// rememberSignedURL keeps info's signed URL for reads of info.Path within
+// the signed URL TTL.
+func (c *WorkspaceFilesClient) rememberSignedURL(info WSFileInfo) {
+	if info.SignedURL != "" && info.Path != "" {
+		c.signedURLs.Set(info.Path, info)
+	}
+}
+
+// signedURLFor returns info with a signed URL for reading it: its own when
+// it came straight from the workspace, a remembered one for the same
+// version of the file, or one from a fresh Stat. The fresh Stat may show a
+// newer version of the file; its info is returned then.
+func (c *WorkspaceFilesClient) signedURLFor(ctx context.Context, actualPath string, info WSFileInfo) (WSFileInfo, bool) {
+	if info.SignedURL != "" {
+		return info, true
+	}
+	if cached, found := c.signedURLs.Get(actualPath); found && cached != nil {
+		if signed, ok := toWSFileInfo(cached); ok && signed.ModifiedAt == info.ModifiedAt && signed.Size() == info.Size() {
+			return signed, true
+		}
+	}
+	fresh, err := c.statFromBackend(ctx, actualPath)
+	if err != nil {
+		logging.Debugf("Stat for a signed URL failed for path: %s: %s", actualPath, sanitizeError(err))
+		return info, false
+	}
+	signed, ok := toWSFileInfo(fresh)
+	if !ok || signed.SignedURL == "" || signed.IsNotebook() {
+		return info, false
+	}
+	return signed, true
+}
+
+// signedURLClient returns the retrying HTTP client for signed URL transfers.
+// It is built once so repeated transfers reuse keep-alive connections.
+func (c *WorkspaceFilesClient) signedURLClient() *retry.HTTPClient {
+	c.signedURLOnce.Do(func() {
+		transport := c.signedURLTransport
+		if transport == nil {
+			transport = defaultSignedURLTransport()
+		}
+		c.signedURLHTTP = retry.NewHTTPClientWithTransport(httpTimeout, transport, retry.DefaultConfig())
+	})
+	return c.signedURLHTTP
+}
+
 func (c *WorkspaceFilesClient) readViaSignedURL(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(faultinject.WithSignedURL(ctx), http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -836,7 +1115,7 @@ func (c *WorkspaceFilesClient) readViaSignedURL(ctx context.Context, url string,
 	}
 
 	// Use retryable HTTP client for transient errors (429, 5xx)
-	httpClient := retry.NewHTTPClient(httpTimeout, retry.DefaultConfig())
+	httpClient := c.signedURLClient()
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -844,19 +1123,31 @@ func (c *WorkspaceFilesClient) readViaSignedURL(ctx context.Context, url string,
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("signed URL GET failed with status: %d", resp.StatusCode)
+		err := fmt.Errorf("signed URL GET failed with status: %d", resp.StatusCode)
+		return nil, requestFailed("GET "+sanitizeURL(url), responseRequestID(resp), err)
 	}
 
-	return io.ReadAll(resp.Body)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContentMD5(resp.Header, data); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 func (c *WorkspaceFilesClient) exportNotebookSource(ctx context.Context, filepath string) ([]byte, error) {
+	return c.export(ctx, filepath, workspace.ExportFormatSource)
+}
+
+func (c *WorkspaceFilesClient) export(ctx context.Context, filepath string, format workspace.ExportFormat) ([]byte, error) {
 	resp, err := c.workspaceClient.Export(ctx, workspace.ExportRequest{
 		Path:   filepath,
-		Format: workspace.ExportFormatSource,
+		Format: format,
 	})
 	if err != nil {
-		return nil, err
+		return nil, withRequestID("export "+filepath, err)
 	}
 	return base64.StdEncoding.DecodeString(resp.Content)
 }
@@ -885,26 +1176,12 @@ func (c *WorkspaceFilesClient) ReadAll(ctx context.Context, filePath string) ([]
 			if err != nil {
 				return nil, err
 			}
+			metrics.NotebookExports.Add(1)
 			c.rememberNotebookExactSize(filePath, wsInfo, int64(len(data)))
 			return data, nil
 		}
 
-		fileSize := wsInfo.Size()
-		if fileSize < sizeThresholdForSignedURL {
-			logging.Debugf("Read via Export (size %d < %d threshold) for path: %s", fileSize, sizeThresholdForSignedURL, actualPath)
-			return c.exportNotebookSource(ctx, actualPath)
-		}
-
-		if wsInfo.SignedURL != "" {
-			logging.Debugf("Read via signed URL (size %d >= %d threshold) for path: %s", fileSize, sizeThresholdForSignedURL, actualPath)
-			data, err := c.readViaSignedURL(ctx, wsInfo.SignedURL, wsInfo.SignedURLHeaders)
-			if err == nil {
-				return data, nil
-			}
-			logging.Debugf("Read via signed URL failed for path: %s, falling back to Export: %s", actualPath, sanitizeError(err))
-		}
-
-		return c.exportNotebookSource(ctx, actualPath)
+		return c.readRegularFile(ctx, actualPath, wsInfo)
 	})
 	if err != nil {
 		return nil, err
@@ -918,6 +1195,9 @@ func (c *WorkspaceFilesClient) ReadAll(ctx context.Context, filePath string) ([]
 }
 
 func (c *WorkspaceFilesClient) writeViaNewFiles(ctx context.Context, filepath string, data []byte) error {
+	transfer := metrics.StartTransfer(filepath, int64(len(data)))
+	defer transfer.Finish()
+
 	// 1. Call new-files API to get signed URL
 	contentB64 := base64.StdEncoding.EncodeToString(data)
 	reqBody := map[string]any{
@@ -932,7 +1212,7 @@ func (c *WorkspaceFilesClient) writeViaNewFiles(ctx context.Context, filepath st
 		} `json:"signed_urls"`
 	}
 
-	err := c.apiClient.Do(ctx, http.MethodPost, "/api/2.0/workspace-files/new-files", nil, nil, reqBody, &resp)
+	err := c.do(ctx, http.MethodPost, "/api/2.0/workspace-files/new-files", reqBody, &resp)
 	if err != nil {
 		return err
 	}
@@ -943,7 +1223,7 @@ func (c *WorkspaceFilesClient) writeViaNewFiles(ctx context.Context, filepath st
 
 	// 2. Upload to signed URL with PUT (with retry for transient errors)
 	signedURL := resp.SignedURLs[0]
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, signedURL.URL, bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(faultinject.WithSignedURL(ctx), http.MethodPut, signedURL.URL, bytes.NewReader(data))
 	if err != nil {
 		return err
 	}
@@ -953,8 +1233,8 @@ func (c *WorkspaceFilesClient) writeViaNewFiles(ctx context.Context, filepath st
 	}
 
 	// Use retryable HTTP client for transient errors (429, 5xx)
-	httpClient := retry.NewHTTPClient(httpTimeout, retry.DefaultConfig())
-	putResp, err := httpClient.Do(req)
+	httpClient := c.signedURLClient()
+	putResp, err := httpClient.DoWithProgress(req, uploadProgress(transfer, time.Now))
 	if err != nil {
 		return err
 	}
@@ -962,18 +1242,40 @@ func (c *WorkspaceFilesClient) writeViaNewFiles(ctx context.Context, filepath st
 
 	if putResp.StatusCode != http.StatusOK && putResp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(putResp.Body)
-		return fmt.Errorf("signed URL PUT failed with status %d: %s", putResp.StatusCode, truncateBody(string(body), maxErrorBodyLen))
+		err := fmt.Errorf("signed URL PUT failed with status %d: %s", putResp.StatusCode, truncateBody(string(body), maxErrorBodyLen))
+		return requestFailed("PUT "+sanitizeURL(signedURL.URL), responseRequestID(putResp), err)
 	}
 
 	return nil
 }
 
+// uploadProgress returns a callback that records bytes sent on transfer and
+// logs progress at most every uploadProgressLogInterval, so a large save does
+// not look hung.
+func uploadProgress(transfer *metrics.Transfer, now func() time.Time) retry.ProgressFunc {
+	// The transport may still be draining a previous attempt's body when a
+	// retry starts, so calls can overlap.
+	var mu sync.Mutex
+	lastLog := now()
+	return func(sent int64) {
+		transfer.SetSent(sent)
+		mu.Lock()
+		defer mu.Unlock()
+		if t := now(); t.Sub(lastLog) >= uploadProgressLogInterval {
+			lastLog = t
+			status := transfer.Status()
+			logging.Infof("Uploading %s: %.0f%% (%d of %d bytes, %.1f MiB/s)",
+				status.Path, status.Percent(), status.Sent, status.Total, status.Rate()/(1<<20))
+		}
+	}
+}
+
 func (c *WorkspaceFilesClient) writeViaImportFile(ctx context.Context, filepath string, data []byte) error {
 	urlPath := fmt.Sprintf(
 		"/api/2.0/workspace-files/import-file/%s?overwrite=true",
 		url.PathEscape(strings.TrimLeft(filepath, "/")),
 	)
-	return c.apiClient.Do(ctx, http.MethodPost, urlPath, nil, nil, data, nil)
+	return c.do(ctx, http.MethodPost, urlPath, data, nil)
 }
 
 func detectNotebookLanguageFromSource(data []byte) workspace.Language {
@@ -1007,44 +1309,66 @@ func normalizeNotebookLanguage(language workspace.Language, data []byte) workspa
 }
 
 func (c *WorkspaceFilesClient) writeRegularFile(ctx context.Context, actualPath string, data []byte) error {
-	c.cache.Invalidate(actualPath)
-
-	if len(data) < sizeThresholdForSignedURL {
-		logging.Debugf("Write via import-file (size %d < %d threshold) for path: %s", len(data), sizeThresholdForSignedURL, actualPath)
-		return c.writeViaImportFile(ctx, actualPath, data)
-	}
-
-	logging.Debugf("Write via new-files (size %d >= %d threshold) for path: %s", len(data), sizeThresholdForSignedURL, actualPath)
-	err := c.writeViaNewFiles(ctx, actualPath, data)
-	if err == nil {
-		return nil
+	c.cache.Invalidate(metacache.ReasonWrite, actualPath)
+
+	size := int64(len(data))
+	if c.transfers.choose(transferWrite, size) == transferSignedURL {
+		logging.Debugf("Write via new-files (size %d) for path: %s", size, actualPath)
+		start := time.Now()
+		err := c.writeViaNewFiles(ctx, actualPath, data)
+		c.transfers.observe(transferWrite, transferSignedURL, size, time.Since(start), err)
+		if err == nil {
+			return nil
+		}
+		logging.Debugf("Write via new-files failed for path: %s, falling back to import-file: %s", actualPath, sanitizeError(err))
+	} else {
+		logging.Debugf("Write via import-file (size %d) for path: %s", size, actualPath)
 	}
-	logging.Debugf("Write via new-files failed for path: %s, falling back to import-file: %s", actualPath, sanitizeError(err))
 
-	return c.writeViaImportFile(ctx, actualPath, data)
+	start := time.Now()
+	err := c.writeViaImportFile(ctx, actualPath, data)
+	c.transfers.observe(transferWrite, transferWorkspaceAPI, size, time.Since(start), err)
+	return err
 }
 
 func (c *WorkspaceFilesClient) writeNotebookSource(ctx context.Context, actualPath string, language workspace.Language, data []byte) error {
-	c.cache.Invalidate(actualPath)
-	return c.workspaceClient.Upload(
-		ctx,
-		actualPath,
-		bytes.NewReader(data),
+	if err := c.checkNotebookSize(actualPath, int64(len(data))); err != nil {
+		return err
+	}
+	c.cache.Invalidate(metacache.ReasonWrite, actualPath)
+	options := []workspace.UploadOption{
 		workspace.UploadFormat(workspace.ImportFormatSource),
 		workspace.UploadLanguage(normalizeNotebookLanguage(language, data)),
 		workspace.UploadOverwrite(),
-	)
+	}
+	if pathutil.IsJupyterNotebook(data) {
+		// A notebook exported as .ipynb is imported as one, so the
+		// workspace keeps its cells and its Databricks metadata, such as
+		// the language and widgets, instead of taking the JSON for source
+		// code. Its exported source is not what was written.
+		logging.Debugf("Importing Jupyter JSON into notebook %s", actualPath)
+		options = []workspace.UploadOption{
+			workspace.UploadFormat(workspace.ImportFormatJupyter),
+			workspace.UploadOverwrite(),
+		}
+		c.invalidateExactNotebookInfo(actualPath)
+	}
+	err := c.workspaceClient.Upload(ctx, actualPath, bytes.NewReader(data), options...)
+	return notebookSizeError(actualPath, int64(len(data)), withRequestID("import "+actualPath, err))
 }
 
 func (c *WorkspaceFilesClient) Write(ctx context.Context, filepath string, data []byte) error {
+	if err := pathutil.ValidateNewPath(filepath); err != nil {
+		return err
+	}
 	info, err := c.Stat(ctx, filepath)
 	if err == nil {
 		wsInfo, ok := toWSFileInfo(info)
 		if !ok {
 			return fmt.Errorf("unexpected file info type for %s", filepath)
 		}
-		c.cache.Invalidate(filepath)
-		c.cache.Invalidate(wsInfo.Path)
+		c.cache.Invalidate(metacache.ReasonWrite, filepath)
+		c.cache.Invalidate(metacache.ReasonWrite, wsInfo.Path)
 
 		var writeErr error
 		if wsInfo.IsNotebook() {
@@ -1054,8 +1378,8 @@ func (c *WorkspaceFilesClient) Write(ctx context.Context, filepath string, data
 			writeErr = c.writeRegularFile(ctx, wsInfo.Path, data)
 		}
 		if writeErr == nil {
-			c.cache.Invalidate(filepath)
-			c.cache.Invalidate(wsInfo.Path)
+			c.cache.Invalidate(metacache.ReasonWrite, filepath)
+			c.cache.Invalidate(metacache.ReasonWrite, wsInfo.Path)
 		}
 		return writeErr
 	}
@@ -1063,22 +1387,21 @@ func (c *WorkspaceFilesClient) Write(ctx context.Context, filepath string, data
 		return err
 	}
 
-	if actualPath, language, ok := pathutil.NotebookRemotePathFromSourcePath(filepath); ok {
-		c.cache.Invalidate(filepath)
-		c.cache.Invalidate(actualPath)
+	if actualPath, language, ok := pathutil.NotebookRemotePathFromSourcePath(filepath); ok && c.notebookAliases.SuffixNames() {
+		// Invalidate also drops actualPath, the notebook's remote alias.
+		c.cache.Invalidate(metacache.ReasonWrite, filepath)
 		logging.Debugf("Creating new notebook: %s", filepath)
 		writeErr := c.writeNotebookSource(ctx, actualPath, language, data)
 		if writeErr == nil {
-			c.cache.Invalidate(filepath)
-			c.cache.Invalidate(actualPath)
+			c.cache.Invalidate(metacache.ReasonWrite, filepath)
 		}
 		return writeErr
 	}
 
-	c.cache.Invalidate(filepath)
+	c.cache.Invalidate(metacache.ReasonWrite, filepath)
 	writeErr := c.writeRegularFile(ctx, filepath, data)
 	if writeErr == nil {
-		c.cache.Invalidate(filepath)
+		c.cache.Invalidate(metacache.ReasonWrite, filepath)
 	}
 	return writeErr
 }
@@ -1093,21 +1416,78 @@ func (c *WorkspaceFilesClient) Delete(ctx context.Context, filePath string, recu
 	} else if !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
-	c.cache.Invalidate(filePath)
-	c.cache.Invalidate(actualPath)
+	c.cache.Invalidate(metacache.ReasonDelete, filePath)
+	c.cache.Invalidate(metacache.ReasonDelete, actualPath)
 
-	return c.workspaceClient.Delete(ctx, workspace.Delete{
+	err = c.workspaceClient.Delete(ctx, workspace.Delete{
 		Path:      actualPath,
 		Recursive: recursive,
 	})
+	err = withRequestID("delete "+actualPath, err)
+	// Lookups made while the delete was running may have cached the tree
+	// again; drop it and the parent listing now that it is gone.
+	c.invalidateTree(metacache.ReasonDelete, filePath, actualPath)
+	if err == nil {
+		// Keep the server from bringing it back while it catches up.
+		c.cache.Tombstone(filePath)
+		c.cache.Tombstone(actualPath)
+	}
+	return err
 }
 
+// invalidateTree drops cached metadata for the trees at paths and the
+// listings of their parents.
+func (c *WorkspaceFilesClient) invalidateTree(reason metacache.Reason, paths ...string) {
+	for _, p := range paths {
+		c.cache.InvalidatePrefix(reason, p)
+		c.cache.InvalidateDir(reason, path.Dir(p))
+		c.invalidateExactNotebookInfo(p)
+	}
+}
+
+// Mkdir creates dirPath and any missing parents; see MkdirAll.
 func (c *WorkspaceFilesClient) Mkdir(ctx context.Context, dirPath string) error {
-	c.cache.Invalidate(dirPath)
+	return c.MkdirAll(ctx, dirPath)
+}
 
-	return c.workspaceClient.Mkdirs(ctx, workspace.Mkdirs{
+// MkdirAll creates dirPath and its missing parents with a single mkdirs
+// call, so a deep tree costs one round-trip instead of one per level.
+// Ancestors the cache knew to be missing are invalidated along with
+// dirPath, so they stat as directories right away.
+func (c *WorkspaceFilesClient) MkdirAll(ctx context.Context, dirPath string) error {
+	if err := pathutil.ValidateNewPath(dirPath); err != nil {
+		return err
+	}
+	missing := c.cachedMissingAncestors(dirPath)
+	c.cache.Invalidate(metacache.ReasonCreate, dirPath)
+
+	if err := c.workspaceClient.Mkdirs(ctx, workspace.Mkdirs{
 		Path: dirPath,
-	})
+	}); err != nil {
+		return withRequestID("mkdirs "+dirPath, err)
+	}
+	for _, p := range missing {
+		c.cache.Invalidate(metacache.ReasonCreate, p)
+	}
+	return nil
+}
+
+// cachedMissingAncestors returns the ancestors of dirPath, nearest first,
+// that the metadata cache records as absent. It stops at the first
+// ancestor not known to be absent.
+func (c *WorkspaceFilesClient) cachedMissingAncestors(dirPath string) []string {
+	var missing []string
+	for p := path.Dir(dirPath); p != "/" && p != "."; p = path.Dir(p) {
+		info, found := c.cache.Get(p)
+		if !found {
+			info, found = c.cache.LookupDirEntry(p)
+		}
+		if !found || info != nil {
+			break
+		}
+		missing = append(missing, p)
+	}
+	return missing
 }
 
 type notebookRenameTarget struct {
@@ -1176,16 +1556,82 @@ func (c *WorkspaceFilesClient) renameExactPath(ctx context.Context, actualSource
 		"destination_path": actualDest,
 	}
 
-	if err := c.apiClient.Do(ctx, http.MethodPost, urlPath, nil, nil, reqBody, nil); err != nil {
+	err := c.do(ctx, http.MethodPost, urlPath, reqBody, nil)
+	if isAlreadyExistsError(err) {
+		// The workspace API refuses to replace an existing object, unlike
+		// POSIX rename. Remove the destination and retry once.
+		if err = c.removeRenameDestination(ctx, actualSource, actualDest); err == nil {
+			err = c.do(ctx, http.MethodPost, urlPath, reqBody, nil)
+		}
+	}
+	if err != nil {
 		return err
 	}
 
-	c.cache.Invalidate(actualSource)
-	c.cache.Invalidate(actualDest)
+	c.cache.Invalidate(metacache.ReasonRename, actualSource)
+	c.cache.Invalidate(metacache.ReasonRename, actualDest)
+	return nil
+}
+
+func isAlreadyExistsError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiError *apierr.APIError
+	if errors.As(err, &apiError) && (apiError.ErrorCode == "RESOURCE_ALREADY_EXISTS" || apiError.ErrorCode == "ALREADY_EXISTS") {
+		return true
+	}
+	return errors.Is(err, fs.ErrExist) ||
+		errors.Is(err, apierr.ErrAlreadyExists) ||
+		errors.Is(err, apierr.ErrResourceAlreadyExists)
+}
+
+// removeRenameDestination deletes the object a rename would replace, with
+// POSIX rules: a file replaces a file and a directory replaces an empty
+// directory. The replacement is not atomic; if the retried rename fails the
+// destination is already gone.
+func (c *WorkspaceFilesClient) removeRenameDestination(ctx context.Context, actualSource string, actualDest string) error {
+	destInfo, err := c.statFreshInternal(ctx, actualDest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sourceInfo, err := c.statFreshInternal(ctx, actualSource)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case destInfo.IsDir() && !sourceInfo.IsDir():
+		return fmt.Errorf("rename %s over directory %s: %w", actualSource, actualDest, syscall.EISDIR)
+	case !destInfo.IsDir() && sourceInfo.IsDir():
+		return fmt.Errorf("rename directory %s over %s: %w", actualSource, actualDest, syscall.ENOTDIR)
+	case destInfo.IsDir():
+		c.cache.Invalidate(metacache.ReasonRename, actualDest)
+		entries, err := c.ReadDir(ctx, actualDest)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("rename %s over %s: %w", actualSource, actualDest, syscall.ENOTEMPTY)
+		}
+	}
+
+	logging.Debugf("Rename: replacing existing destination %s", actualDest)
+	if err := c.workspaceClient.Delete(ctx, workspace.Delete{Path: actualDest}); err != nil {
+		return withRequestID("delete "+actualDest, err)
+	}
+	c.cache.Invalidate(metacache.ReasonRename, actualDest)
 	return nil
 }
 
 func (c *WorkspaceFilesClient) renameNotebook(ctx context.Context, sourceInfo WSFileInfo, destinationPath string) error {
+	if !c.notebookAliases.SuffixNames() {
+		// The destination is the new workspace name itself.
+		return c.renameExactPath(ctx, sourceInfo.Path, destinationPath)
+	}
 	target, err := resolveNotebookRenameTarget(destinationPath, sourceInfo.Language)
 	if err != nil {
 		return err
@@ -1210,7 +1656,7 @@ func (c *WorkspaceFilesClient) renameNotebook(ctx context.Context, sourceInfo WS
 	}
 
 	if target.path == sourceInfo.Path {
-		c.cache.Invalidate(sourceInfo.Path)
+		c.cache.Invalidate(metacache.ReasonRename, sourceInfo.Path)
 		return nil
 	}
 
@@ -1218,15 +1664,18 @@ func (c *WorkspaceFilesClient) renameNotebook(ctx context.Context, sourceInfo WS
 		Path:      sourceInfo.Path,
 		Recursive: false,
 	}); err != nil {
-		return err
+		return withRequestID("delete "+sourceInfo.Path, err)
 	}
 
-	c.cache.Invalidate(sourceInfo.Path)
-	c.cache.Invalidate(target.path)
+	c.cache.Invalidate(metacache.ReasonRename, sourceInfo.Path)
+	c.cache.Invalidate(metacache.ReasonRename, target.path)
 	return nil
 }
 
 func (c *WorkspaceFilesClient) Rename(ctx context.Context, source_path string, destination_path string) error {
+	if err := pathutil.ValidateNewPath(destination_path); err != nil {
+		return err
+	}
 	info, err := c.Stat(ctx, source_path)
 	if err != nil {
 		return err
@@ -1236,15 +1685,124 @@ func (c *WorkspaceFilesClient) Rename(ctx context.Context, source_path string, d
 	if !ok {
 		return fmt.Errorf("unexpected file info type for %s", source_path)
 	}
-	c.cache.Invalidate(source_path)
-	c.cache.Invalidate(destination_path)
-	c.cache.Invalidate(wsInfo.Path)
+	c.cache.Invalidate(metacache.ReasonRename, source_path)
+	c.cache.Invalidate(metacache.ReasonRename, destination_path)
+	c.cache.Invalidate(metacache.ReasonRename, wsInfo.Path)
+	if wsInfo.IsNotebook() && pathutil.IsEditorBackupPath(source_path, destination_path) {
+		// The notebook moves to the backup name, which it is shown under as
+		// is, so the rename back over source_path finds it.
+		return c.renameExactPath(ctx, wsInfo.Path, destination_path)
+	}
+	if !wsInfo.IsDir() {
+		if target, ok := c.notebookAtSourcePath(ctx, destination_path); ok && target.Path != wsInfo.Path {
+			return c.replaceNotebookContent(ctx, source_path, wsInfo, target, destination_path)
+		}
+		if backup, targetPath, ok := c.backedUpNotebook(ctx, destination_path); ok && backup.Path != wsInfo.Path {
+			return c.restoreBackedUpNotebook(ctx, source_path, wsInfo, backup, targetPath, destination_path)
+		}
+	}
 	if wsInfo.IsNotebook() {
 		return c.renameNotebook(ctx, wsInfo, destination_path)
 	}
 	return c.renameExactPath(ctx, wsInfo.Path, destination_path)
 }
 
+// notebookAtSourcePath returns the existing notebook shown at a source-style
+// visible path such as "foo.py", or at its workspace path when notebooks
+// are shown without suffixes.
+func (c *WorkspaceFilesClient) notebookAtSourcePath(ctx context.Context, visiblePath string) (WSFileInfo, bool) {
+	if c.notebookAliases.SuffixNames() && !pathutil.HasNotebookSourceSuffix(visiblePath) {
+		return WSFileInfo{}, false
+	}
+	info, err := c.Stat(ctx, visiblePath)
+	if err != nil {
+		return WSFileInfo{}, false
+	}
+	wsInfo, ok := toWSFileInfo(info)
+	if !ok || !wsInfo.IsNotebook() {
+		return WSFileInfo{}, false
+	}
+	return wsInfo, true
+}
+
+// replaceNotebookContent handles an editor's atomic save, which renames a
+// freshly written temp file over the visible notebook path. Moving the temp
+// object would replace the notebook with a regular file and lose its
+// ObjectId, so the temp content is imported into the existing notebook and
+// the temp object is deleted instead.
+func (c *WorkspaceFilesClient) replaceNotebookContent(ctx context.Context, sourcePath string, sourceInfo WSFileInfo, target WSFileInfo, destinationPath string) error {
+	data, err := c.ReadAll(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	if sourceInfo.IsNotebook() && sourceInfo.Language != target.Language {
+		data = convertNotebookSourceLanguage(data, target.Language)
+	}
+	if err := c.writeNotebookSource(ctx, target.Path, target.Language, data); err != nil {
+		return err
+	}
+	c.invalidateExactNotebookInfo(destinationPath)
+	c.cache.Invalidate(metacache.ReasonRename, destinationPath)
+	c.cache.Invalidate(metacache.ReasonRename, target.Path)
+
+	if err := c.workspaceClient.Delete(ctx, workspace.Delete{Path: sourceInfo.Path}); err != nil {
+		return withRequestID("delete "+sourceInfo.Path, err)
+	}
+	c.CacheInvalidate(sourcePath)
+	c.cache.Invalidate(metacache.ReasonRename, sourceInfo.Path)
+	return nil
+}
+
+// backedUpNotebook returns the notebook at an editor backup path of
+// visiblePath, such as "foo.py~" for "foo.py", and the workspace path it
+// had at visiblePath. Editors that save by renaming the original away
+// (JetBrains safe write, Vim/Emacs backups) rename the new content over
+// visiblePath next.
+func (c *WorkspaceFilesClient) backedUpNotebook(ctx context.Context, visiblePath string) (WSFileInfo, string, bool) {
+	for _, backupPath := range pathutil.EditorBackupPaths(visiblePath) {
+		info, err := c.Stat(ctx, backupPath)
+		if err != nil {
+			continue
+		}
+		backup, ok := toWSFileInfo(info)
+		if !ok || !backup.IsNotebook() || backup.Path != backupPath {
+			continue
+		}
+		if !c.notebookAliases.SuffixNames() {
+			return backup, visiblePath, true
+		}
+		target, err := resolveNotebookRenameTarget(visiblePath, backup.Language)
+		if err == nil && target.language == backup.Language {
+			return backup, target.path, true
+		}
+	}
+	return WSFileInfo{}, "", false
+}
+
+// restoreBackedUpNotebook finishes a save that renamed a notebook to an
+// editor backup name: the notebook moves back to targetPath and the new
+// content at sourcePath is imported into it, so it keeps its ObjectId. The
+// old content is left at the backup path as a regular file, as the editor
+// expects.
+func (c *WorkspaceFilesClient) restoreBackedUpNotebook(ctx context.Context, sourcePath string, sourceInfo WSFileInfo, backup WSFileInfo, targetPath string, destinationPath string) error {
+	previous, err := c.exportNotebookSource(ctx, backup.Path)
+	if err != nil {
+		return err
+	}
+	if err := c.renameExactPath(ctx, backup.Path, targetPath); err != nil {
+		return err
+	}
+	c.invalidateExactNotebookInfo(backup.Path)
+	if err := c.writeRegularFile(ctx, backup.Path, previous); err != nil {
+		return err
+	}
+	c.cache.Invalidate(metacache.ReasonRename, backup.Path)
+
+	target := backup
+	target.Path = targetPath
+	return c.replaceNotebookContent(ctx, sourcePath, sourceInfo, target, destinationPath)
+}
+
 // Helpers
 
 func (c *WorkspaceFilesClient) CacheSet(filePath string, info fs.FileInfo) {
@@ -1255,7 +1813,7 @@ func (c *WorkspaceFilesClient) CacheSet(filePath string, info fs.FileInfo) {
 }
 
 func (c *WorkspaceFilesClient) CacheInvalidate(filePath string) {
-	c.cache.Invalidate(filePath)
+	c.cache.Invalidate(metacache.ReasonOther, filePath)
 	c.invalidateExactNotebookInfo(filePath)
 }
 
@@ -1263,6 +1821,19 @@ func (c *WorkspaceFilesClient) MetadataTTL() time.Duration {
 	return c.cache.PositiveTTL()
 }
 
+// CacheStats returns the metadata cache's hit, miss and eviction counters
+// and its current size.
+func (c *WorkspaceFilesClient) CacheStats() metacache.Stats {
+	return c.cache.Stats()
+}
+
+// Close drops the metadata and signed URL caches. Later calls still work,
+// uncached.
+func (c *WorkspaceFilesClient) Close() error {
+	c.signedURLs.Close()
+	return c.cache.Close()
+}
+
 func (c *WorkspaceFilesClient) Exists(ctx context.Context, path string) (bool, error) {
 	_, err := c.Stat(ctx, path)
 	if err != nil {
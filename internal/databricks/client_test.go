@@ -1,6 +1,7 @@
 package databricks
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -8,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -18,7 +20,10 @@ import (
 	"github.com/databricks/databricks-sdk-go/apierr"
 	"github.com/databricks/databricks-sdk-go/service/workspace"
 
+	"wsfs/internal/logging"
 	"wsfs/internal/metacache"
+	"wsfs/internal/metrics"
+	"wsfs/internal/pathutil"
 )
 
 // TestStatCaching verifies that Stat caches results correctly
@@ -121,6 +126,182 @@ func TestStatNotFoundNormalizesDatabricksMissing(t *testing.T) {
 	}
 }
 
+// TestStaleWhileRevalidateServesExpiredMetadata verifies that expired
+// metadata is answered at once while a background request refreshes it,
+// and that a failed refresh keeps the stale answer.
+func TestStaleWhileRevalidateServesExpiredMetadata(t *testing.T) {
+	var mu sync.Mutex
+	var statCalls, listCalls int
+	var failStats bool
+	release := make(chan struct{})
+	mockAPI := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case strings.Contains(path, "object-info"):
+				statCalls++
+				if statCalls == 2 {
+					mu.Unlock()
+					<-release
+					mu.Lock()
+				}
+				if failStats {
+					return errors.New("connection reset")
+				}
+				response.(*objectInfoResponse).WsfsObjectInfo = wsfsObjectInfo{ObjectInfo: workspace.ObjectInfo{
+					Path:       "/test.txt",
+					ObjectType: workspace.ObjectTypeFile,
+					Size:       int64(statCalls),
+				}}
+			case strings.Contains(path, "list-files"):
+				listCalls++
+				response.(*listFilesResponse).Objects = []wsfsObjectInfo{{ObjectInfo: workspace.ObjectInfo{
+					Path:       fmt.Sprintf("/dir/file%d", listCalls),
+					ObjectType: workspace.ObjectTypeFile,
+				}}}
+			default:
+				return fmt.Errorf("unexpected path: %s", path)
+			}
+			return nil
+		},
+	}
+	client := NewWorkspaceFilesClientWithDepsAndConfig(&MockWorkspaceClient{}, mockAPI, nil, CacheConfig{MetadataTTL: 100 * time.Millisecond, StaleWhileRevalidate: time.Hour})
+	statSize := func() int64 {
+		t.Helper()
+		info, err := client.Stat(context.Background(), "/test.txt")
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		return info.Size()
+	}
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !done(); time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+
+	if size := statSize(); size != 1 {
+		t.Fatalf("first Stat size = %d, want 1", size)
+	}
+	if _, err := client.ReadDir(context.Background(), "/dir"); err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	// The refresh blocks until released; the stale answer must not wait.
+	if size := statSize(); size != 1 {
+		t.Fatalf("stale Stat size = %d, want 1", size)
+	}
+	close(release)
+	waitFor("the refreshed stat", func() bool { return statSize() == 2 })
+
+	entries, err := client.ReadDir(context.Background(), "/dir")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "file1" {
+		t.Fatalf("stale ReadDir = %v, %v", entries, err)
+	}
+	waitFor("the refreshed listing", func() bool {
+		entries, err := client.ReadDir(context.Background(), "/dir")
+		return err == nil && entries[0].Name() == "file2"
+	})
+
+	mu.Lock()
+	failStats = true
+	mu.Unlock()
+	time.Sleep(150 * time.Millisecond)
+	if size := statSize(); size != 2 {
+		t.Fatalf("stale Stat size = %d, want 2", size)
+	}
+	waitFor("the failed refresh", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return statCalls == 3
+	})
+	if size := statSize(); size != 2 {
+		t.Fatalf("Stat after a failed refresh = %d, want the stale size 2", size)
+	}
+}
+
+// TestValidateListingsRenewsUnchangedDirectories verifies that an expired
+// listing is reused after a stat finds its directory unmodified, and listed
+// again once the directory's modification time moves.
+func TestValidateListingsRenewsUnchangedDirectories(t *testing.T) {
+	var statCalls, listCalls int
+	dirModifiedAt := int64(1000)
+	mockAPI := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			switch {
+			case strings.Contains(path, "object-info"):
+				statCalls++
+				response.(*objectInfoResponse).WsfsObjectInfo = wsfsObjectInfo{ObjectInfo: workspace.ObjectInfo{
+					Path:       "/dir",
+					ObjectType: workspace.ObjectTypeDirectory,
+					ObjectId:   7,
+					ModifiedAt: dirModifiedAt,
+				}}
+			case strings.Contains(path, "list-files"):
+				listCalls++
+				response.(*listFilesResponse).Objects = []wsfsObjectInfo{{ObjectInfo: workspace.ObjectInfo{
+					Path:       fmt.Sprintf("/dir/file%d", listCalls),
+					ObjectType: workspace.ObjectTypeFile,
+				}}}
+			default:
+				return fmt.Errorf("unexpected path: %s", path)
+			}
+			return nil
+		},
+	}
+	client := NewWorkspaceFilesClientWithDepsAndConfig(&MockWorkspaceClient{}, mockAPI, nil, CacheConfig{MetadataTTL: 50 * time.Millisecond, ValidateListings: true})
+	ctx := context.Background()
+	readDir := func() string {
+		t.Helper()
+		entries, err := client.ReadDir(ctx, "/dir")
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("ReadDir = %v, %v", entries, err)
+		}
+		return entries[0].Name()
+	}
+
+	if _, err := client.Stat(ctx, "/dir"); err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if name := readDir(); name != "file1" {
+		t.Fatalf("first listing = %s", name)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if name := readDir(); name != "file1" || listCalls != 1 || statCalls != 2 {
+		t.Fatalf("listing of an unmodified directory = %s after %d listings and %d stats, want file1 from one stat", name, listCalls, statCalls)
+	}
+	if got := client.CacheStats().Revalidations; got != 1 {
+		t.Fatalf("Revalidations = %d, want 1", got)
+	}
+
+	dirModifiedAt++
+	time.Sleep(60 * time.Millisecond)
+	if name := readDir(); name != "file2" || listCalls != 2 {
+		t.Fatalf("listing of a modified directory = %s after %d listings, want a new listing", name, listCalls)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if name := readDir(); name != "file2" || listCalls != 2 {
+		t.Fatalf("listing = %s after %d listings, want the renewed second listing", name, listCalls)
+	}
+
+	// Without the option an expired listing is listed again.
+	client.SetCacheConfig(CacheConfig{MetadataTTL: 50 * time.Millisecond})
+	readDir()
+	time.Sleep(60 * time.Millisecond)
+	if name := readDir(); name != "file4" || listCalls != 4 {
+		t.Fatalf("listing without validation = %s after %d listings", name, listCalls)
+	}
+}
+
 // TestReadAllViaSignedURL verifies that ReadAll uses signed URL for large files (>= 5MB)
 func TestReadAllViaSignedURL(t *testing.T) {
 	// Create a large file (>= 5MB threshold)
@@ -181,6 +362,87 @@ func TestReadAllViaSignedURL(t *testing.T) {
 	}
 }
 
+// TestSignedURLsExpireApartFromAttributes verifies that listed attributes
+// outlive their signed URLs, and that a read with an expired URL fetches a
+// new one instead of reusing it.
+func TestSignedURLsExpireApartFromAttributes(t *testing.T) {
+	testContent := []byte("large enough for a signed URL")
+	var mu sync.Mutex
+	var gets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gets = append(gets, r.URL.Path)
+		mu.Unlock()
+		w.Write(testContent)
+	}))
+	defer server.Close()
+
+	modifiedAt := time.Now().UnixMilli()
+	object := func(url string) wsfsObjectInfo {
+		return wsfsObjectInfo{
+			ObjectInfo: workspace.ObjectInfo{
+				Path:       "/dir/big.bin",
+				ObjectType: workspace.ObjectTypeFile,
+				Size:       int64(len(testContent)),
+				ModifiedAt: modifiedAt,
+			},
+			SignedURL: &struct {
+				URL     string            `json:"url"`
+				Headers map[string]string `json:"headers,omitempty"`
+			}{URL: url},
+		}
+	}
+	var statCalls int
+	mockAPI := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			switch {
+			case strings.Contains(path, "list-files"):
+				response.(*listFilesResponse).Objects = []wsfsObjectInfo{object(server.URL + "/listed")}
+			case strings.Contains(path, "object-info"):
+				statCalls++
+				response.(*objectInfoResponse).WsfsObjectInfo = object(server.URL + "/fresh")
+			default:
+				return fmt.Errorf("unexpected path: %s", path)
+			}
+			return nil
+		},
+	}
+
+	for _, tt := range []struct {
+		signedURLTTL time.Duration
+		wantGet      string
+		wantStats    int
+	}{
+		{signedURLTTL: time.Hour, wantGet: "/listed", wantStats: 0},
+		{signedURLTTL: time.Nanosecond, wantGet: "/fresh", wantStats: 1},
+	} {
+		statCalls, gets = 0, nil
+		client := NewWorkspaceFilesClientWithDepsAndConfig(&MockWorkspaceClient{}, mockAPI, nil, CacheConfig{MetadataTTL: time.Hour, SignedURLTTL: tt.signedURLTTL})
+		client.SetTransferConfig(TransferConfig{SignedURLThreshold: 1})
+
+		if _, err := client.ReadDir(context.Background(), "/dir"); err != nil {
+			t.Fatalf("ReadDir failed: %v", err)
+		}
+		info, err := client.Stat(context.Background(), "/dir/big.bin")
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if wsInfo := info.(WSFileInfo); wsInfo.SignedURL != "" || statCalls != 0 {
+			t.Fatalf("cached attributes carry signed URL %q after %d object-info calls", wsInfo.SignedURL, statCalls)
+		}
+
+		data, err := client.ReadAll(context.Background(), "/dir/big.bin")
+		if err != nil || !bytes.Equal(data, testContent) {
+			t.Fatalf("ReadAll = %q, %v", data, err)
+		}
+		if len(gets) != 1 || gets[0] != tt.wantGet || statCalls != tt.wantStats {
+			t.Fatalf("signed URL TTL %v: GETs %v after %d object-info calls, want %s after %d", tt.signedURLTTL, gets, statCalls, tt.wantGet, tt.wantStats)
+		}
+	}
+}
+
 // TestReadAllFallbackToExport verifies that ReadAll falls back to Export when signed URL fails for large files
 func TestReadAllFallbackToExport(t *testing.T) {
 	// Create a large file (>= 5MB threshold) to test fallback path
@@ -1245,6 +1507,104 @@ func TestCacheInvalidation(t *testing.T) {
 	}
 }
 
+func TestCloseDropsMetadataCache(t *testing.T) {
+	statCallCount := 0
+	mockAPI := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			statCallCount++
+			resp := response.(*objectInfoResponse)
+			resp.WsfsObjectInfo = wsfsObjectInfo{
+				ObjectInfo: workspace.ObjectInfo{
+					Path:       "/test.txt",
+					ObjectType: workspace.ObjectTypeFile,
+					ModifiedAt: time.Now().UnixMilli(),
+				},
+			}
+			return nil
+		},
+	}
+	client := NewWorkspaceFilesClientWithDeps(&MockWorkspaceClient{}, mockAPI, metacache.NewCache(10*time.Second))
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Stat(context.Background(), "/test.txt"); err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+	}
+	if stats := client.CacheStats(); statCallCount != 1 || stats.Hits == 0 || stats.Entries == 0 {
+		t.Fatalf("expected the second Stat to hit the cache: %d calls, %+v", statCallCount, stats)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := client.Stat(context.Background(), "/test.txt"); err != nil {
+		t.Fatalf("Stat after Close failed: %v", err)
+	}
+	if stats := client.CacheStats(); statCallCount != 2 || stats.Entries != 0 {
+		t.Fatalf("expected uncached Stat after Close: %d calls, %+v", statCallCount, stats)
+	}
+}
+
+func TestDeleteDuringReadDirDoesNotRecacheSubtree(t *testing.T) {
+	var client *WorkspaceFilesClient
+	deleted := false
+	mockWorkspace := &MockWorkspaceClient{
+		DeleteFunc: func(ctx context.Context, request workspace.Delete) error {
+			deleted = true
+			return nil
+		},
+	}
+	mockAPI := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			switch {
+			case strings.Contains(path, "object-info"):
+				if deleted {
+					return fs.ErrNotExist
+				}
+				resp := response.(*objectInfoResponse)
+				resp.WsfsObjectInfo = wsfsObjectInfo{ObjectInfo: workspace.ObjectInfo{
+					Path:       "/dir/sub",
+					ObjectType: workspace.ObjectTypeDirectory,
+				}}
+				return nil
+			case strings.Contains(path, "list-files"):
+				// The delete finishes while the listing is on its way back.
+				if err := client.Delete(ctx, "/dir/sub", true); err != nil {
+					t.Errorf("Delete failed: %v", err)
+				}
+				resp := response.(*listFilesResponse)
+				resp.Objects = []wsfsObjectInfo{{ObjectInfo: workspace.ObjectInfo{
+					Path:       "/dir/sub",
+					ObjectType: workspace.ObjectTypeDirectory,
+				}}}
+				return nil
+			}
+			return fmt.Errorf("unexpected path: %s", path)
+		},
+	}
+	client = NewWorkspaceFilesClientWithDeps(mockWorkspace, mockAPI, metacache.NewCache(10*time.Second))
+
+	if _, err := client.ReadDir(context.Background(), "/dir"); err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if !deleted {
+		t.Fatal("expected the delete to run")
+	}
+	if _, found := client.cache.GetDirEntries("/dir"); found {
+		t.Fatal("listing fetched before the delete was cached")
+	}
+	if info, found := client.cache.Get("/dir/sub"); info != nil || !found {
+		t.Fatalf("Get after delete = %v, %v; want the tombstone's nil, true", info, found)
+	}
+	if _, err := client.Stat(context.Background(), "/dir/sub"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat after delete = %v, want ErrNotExist", err)
+	}
+}
+
 func TestStatFreshBypassesStaleDirectAndDirCaches(t *testing.T) {
 	freshSize := int64(14)
 	freshModTime := time.Now().UnixMilli()
@@ -1599,10 +1959,10 @@ func TestDelete(t *testing.T) {
 		t.Error("Expected recursive to be false")
 	}
 
-	// Verify cache was invalidated
-	_, found = client.cache.Get("/test.txt")
-	if found {
-		t.Error("Expected cache entry to be invalidated after delete")
+	// Verify the cached entry gave way to a tombstone
+	info, found := client.cache.Get("/test.txt")
+	if info != nil || !found {
+		t.Errorf("Expected deleted path to be answered as missing, got %v, %v", info, found)
 	}
 }
 
@@ -1634,6 +1994,43 @@ func TestMkdir(t *testing.T) {
 	}
 }
 
+func TestMkdirAllCreatesDeepTreeInOneCall(t *testing.T) {
+	var calls []string
+	mockWorkspace := &MockWorkspaceClient{
+		MkdirsFunc: func(ctx context.Context, request workspace.Mkdirs) error {
+			calls = append(calls, request.Path)
+			return nil
+		},
+	}
+	cache := metacache.NewCache(10 * time.Second)
+	client := NewWorkspaceFilesClientWithDeps(mockWorkspace, &MockAPIClient{}, cache)
+
+	// /x exists; /x/a is absent according to the listing of /x and /x/a/b
+	// according to an earlier failed stat.
+	cache.Set("/x", NewTestFileInfo("/x", 0, true))
+	cache.SetDirEntries("/x", []fs.DirEntry{}, nil)
+	cache.Set("/x/a/b", nil)
+	cache.Set("/x/other", NewTestFileInfo("/x/other", 1, false))
+
+	if err := client.MkdirAll(context.Background(), "/x/a/b/c"); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if len(calls) != 1 || calls[0] != "/x/a/b/c" {
+		t.Fatalf("mkdirs calls = %v, want one call for the whole tree", calls)
+	}
+	for _, p := range []string{"/x/a", "/x/a/b"} {
+		if _, found := cache.Get(p); found {
+			t.Fatalf("%s is still cached as missing", p)
+		}
+		if _, found := cache.LookupDirEntry(p); found {
+			t.Fatalf("listing of %s's parent still hides it", p)
+		}
+	}
+	if _, found := cache.Get("/x/other"); !found {
+		t.Fatal("MkdirAll dropped metadata of an unrelated sibling")
+	}
+}
+
 // TestRename verifies that Rename invalidates cache for both source and destination
 func TestRename(t *testing.T) {
 	renameCalled := false
@@ -2550,6 +2947,57 @@ func TestWriteNewNotebookIgnoresDatabricksMissingAliasProbe(t *testing.T) {
 	}
 }
 
+func TestNotebookAliasesNoneTakesSuffixedPathsLiterally(t *testing.T) {
+	var imported []string
+	mockAPI := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			switch {
+			case strings.Contains(path, "object-info?path=%2Ftest%2Fnotebook.py"):
+				return fs.ErrNotExist
+			case strings.Contains(path, "object-info?path=%2Ftest%2Fnotebook"):
+				resp := response.(*objectInfoResponse)
+				resp.WsfsObjectInfo = wsfsObjectInfo{ObjectInfo: workspace.ObjectInfo{
+					Path:       "/test/notebook",
+					ObjectType: workspace.ObjectTypeNotebook,
+					Language:   workspace.LanguagePython,
+					ModifiedAt: time.Now().UnixMilli(),
+				}}
+				return nil
+			case strings.Contains(path, "object-info"):
+				return fs.ErrNotExist
+			case strings.Contains(path, "import-file"):
+				imported = append(imported, path)
+				return nil
+			}
+			return fmt.Errorf("unexpected path: %s", path)
+		},
+	}
+	mockWorkspace := &MockWorkspaceClient{
+		UploadFunc: func(ctx context.Context, path string, r io.Reader, opts ...workspace.UploadOption) error {
+			t.Fatalf("unexpected notebook upload to %s", path)
+			return nil
+		},
+	}
+	client := NewWorkspaceFilesClientWithDeps(mockWorkspace, mockAPI, nil)
+	client.SetNotebookAliases(pathutil.NotebookAliasesNone)
+	ctx := context.Background()
+
+	if _, err := client.Stat(ctx, "/test/notebook.py"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat of the source name = %v, want not exist", err)
+	}
+	if info, err := client.Stat(ctx, "/test/notebook"); err != nil || !info.(WSFileInfo).IsNotebook() {
+		t.Fatalf("Stat of the workspace name = %v, %v", info, err)
+	}
+	if err := client.Write(ctx, "/test/script.py", []byte("print(1)\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(imported) != 1 || !strings.Contains(imported[0], "test%2Fscript.py") {
+		t.Fatalf("imported %q, want a regular file at /test/script.py", imported)
+	}
+}
+
 // TestDeleteNotebook verifies that Delete resolves notebook aliases to the remote path
 func TestDeleteNotebook(t *testing.T) {
 	var deletedPath string
@@ -3168,3 +3616,129 @@ func TestTruncateBody(t *testing.T) {
 		})
 	}
 }
+
+func TestUploadProgressTracksAndThrottlesLogs(t *testing.T) {
+	var logs bytes.Buffer
+	origOutput := log.Writer()
+	log.SetOutput(&logs)
+	defer log.SetOutput(origOutput)
+	origLevel := logging.Level
+	logging.SetLevel(logging.LevelInfo)
+	defer logging.SetLevel(origLevel)
+
+	transfer := metrics.StartTransfer("/big.bin", 100)
+	defer transfer.Finish()
+	now := time.Unix(0, 0)
+	progress := uploadProgress(transfer, func() time.Time { return now })
+
+	progress(10)
+	if got := transfer.Status().Sent; got != 10 {
+		t.Fatalf("expected 10 bytes sent, got %d", got)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("expected no log before the interval, got %q", logs.String())
+	}
+
+	now = now.Add(uploadProgressLogInterval)
+	progress(50)
+	if !strings.Contains(logs.String(), "Uploading /big.bin: 50%") {
+		t.Fatalf("expected a progress log line, got %q", logs.String())
+	}
+}
+
+func TestWriteViaNewFilesReportsActiveTransfer(t *testing.T) {
+	content := make([]byte, sizeThresholdForSignedURL)
+	var during []metrics.TransferStatus
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		during = metrics.ActiveTransfers()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	mockAPI := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			switch {
+			case strings.Contains(path, "object-info"):
+				return fs.ErrNotExist
+			case strings.Contains(path, "new-files"):
+				resp := response.(*struct {
+					SignedURLs []struct {
+						URL     string            `json:"url"`
+						Headers map[string]string `json:"headers"`
+					} `json:"signed_urls"`
+				})
+				resp.SignedURLs = append(resp.SignedURLs, struct {
+					URL     string            `json:"url"`
+					Headers map[string]string `json:"headers"`
+				}{URL: server.URL})
+				return nil
+			default:
+				return fmt.Errorf("unexpected path: %s", path)
+			}
+		},
+	}
+
+	client := NewWorkspaceFilesClientWithDeps(&MockWorkspaceClient{}, mockAPI, metacache.NewCache(time.Second))
+	if err := client.Write(context.Background(), "/progress.bin", content); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	found := false
+	for _, status := range during {
+		if status.Path == "/progress.bin" {
+			found = true
+			if status.Sent != int64(len(content)) || status.Total != int64(len(content)) {
+				t.Fatalf("expected the whole body sent by the time the server read it, got %+v", status)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected an active transfer during the PUT, got %+v", during)
+	}
+	for _, status := range metrics.ActiveTransfers() {
+		if status.Path == "/progress.bin" {
+			t.Fatal("expected the transfer to finish after Write")
+		}
+	}
+}
+
+func TestReadDirReportsExactNotebookSizes(t *testing.T) {
+	ws, client, _ := newNotebookWorkspace(t)
+	ws.objects["/foo"].info.Size = 1
+
+	if _, err := client.ReadDir(context.Background(), "/"); err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	data, err := client.ReadAll(context.Background(), "/foo.py")
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	notebookSize := func() (int64, bool) {
+		t.Helper()
+		entries, err := client.ReadDir(context.Background(), "/")
+		if err != nil {
+			t.Fatalf("ReadDir: %v", err)
+		}
+		for _, entry := range entries {
+			if wsEntry := entry.(WSDirEntry); wsEntry.Path == "/foo" {
+				return wsEntry.Size(), wsEntry.NotebookSizeComputed
+			}
+		}
+		t.Fatal("notebook is not listed")
+		return 0, false
+	}
+	if size, exact := notebookSize(); size != int64(len(data)) || !exact {
+		t.Fatalf("listed size = %d (exact %v), want exported size %d", size, exact, len(data))
+	}
+
+	// A listing of another version keeps the workspace's size.
+	ws.put("/foo", workspace.ObjectTypeNotebook, workspace.LanguagePython, []byte("# Databricks notebook source\nprint(2)\n"))
+	ws.objects["/foo"].info.Size = 1
+	client.cache.InvalidateDir(metacache.ReasonOther, "/")
+	if size, exact := notebookSize(); size != 1 || exact {
+		t.Fatalf("listed size = %d (exact %v) after a change, want 1", size, exact)
+	}
+}
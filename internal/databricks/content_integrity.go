@@ -0,0 +1,144 @@
+package databricks
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/logging"
+)
+
+// ContentMismatchError reports a regular file whose downloaded bytes do not
+// match its size in the workspace on any read path. It unwraps to EIO, so
+// the kernel never sees altered content.
+type ContentMismatchError struct {
+	Path string
+	Size int64 // size reported by the workspace
+	Got  int64 // bytes the last read path returned
+}
+
+func (e *ContentMismatchError) Error() string {
+	return fmt.Sprintf("content of %s does not match its size: workspace reports %d bytes, read returned %d", e.Path, e.Size, e.Got)
+}
+
+func (e *ContentMismatchError) Unwrap() error {
+	return syscall.EIO
+}
+
+// readRegularFile downloads a regular file through the transfer policy's
+// path and checks the result against the size from Stat. SOURCE exports
+// can transform content, so on a mismatch the file is read again through
+// the byte-preserving paths.
+func (c *WorkspaceFilesClient) readRegularFile(ctx context.Context, actualPath string, info WSFileInfo) ([]byte, error) {
+	fileSize := info.Size()
+	signed := false
+	if c.transfers.choose(transferRead, fileSize) == transferSignedURL {
+		info, signed = c.signedURLFor(ctx, actualPath, info)
+		fileSize = info.Size()
+	}
+	if signed {
+		logging.Debugf("Read via signed URL (size %d) for path: %s", fileSize, actualPath)
+		start := time.Now()
+		data, err := c.readViaSignedURL(ctx, info.SignedURL, info.SignedURLHeaders)
+		c.transfers.observe(transferRead, transferSignedURL, fileSize, time.Since(start), err)
+		if err == nil && int64(len(data)) == fileSize {
+			return data, nil
+		}
+		if err == nil {
+			return c.rereadMismatched(ctx, actualPath, data)
+		}
+		logging.Debugf("Read via signed URL failed for path: %s, falling back to Export: %s", actualPath, sanitizeError(err))
+	} else {
+		logging.Debugf("Read via Export (size %d) for path: %s", fileSize, actualPath)
+	}
+
+	start := time.Now()
+	data, err := c.exportNotebookSource(ctx, actualPath)
+	c.transfers.observe(transferRead, transferWorkspaceAPI, fileSize, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) == fileSize {
+		return data, nil
+	}
+	return c.rereadMismatched(ctx, actualPath, data)
+}
+
+// rereadMismatched handles a read whose length differs from the size Stat
+// reported. A fresh Stat tells a file that changed meanwhile from content
+// the read path altered; the latter is read again through the signed URL
+// and a RAW export, and the first copy of the right size wins.
+func (c *WorkspaceFilesClient) rereadMismatched(ctx context.Context, actualPath string, data []byte) ([]byte, error) {
+	fresh, err := c.statFreshInternal(ctx, actualPath)
+	if err != nil {
+		return nil, err
+	}
+	info, ok := toWSFileInfo(fresh)
+	if !ok {
+		return nil, fmt.Errorf("unexpected file info type for %s", actualPath)
+	}
+	got := int64(len(data))
+	if got == info.Size() {
+		return data, nil
+	}
+	logging.Warnf("Read of %s returned %d bytes but the workspace reports %d; reading it again byte for byte", actualPath, got, info.Size())
+
+	if info.SignedURL != "" {
+		data, err := c.readViaSignedURL(ctx, info.SignedURL, info.SignedURLHeaders)
+		if err == nil && int64(len(data)) == info.Size() {
+			return data, nil
+		}
+		if err != nil {
+			logging.Debugf("Signed URL re-read of %s failed: %s", actualPath, sanitizeError(err))
+		} else {
+			got = int64(len(data))
+		}
+	}
+
+	data, err = c.export(ctx, actualPath, workspace.ExportFormatRaw)
+	if err == nil && int64(len(data)) == info.Size() {
+		return data, nil
+	}
+	if err != nil {
+		logging.Debugf("RAW export of %s failed: %s", actualPath, sanitizeError(err))
+	} else {
+		got = int64(len(data))
+	}
+	return nil, &ContentMismatchError{Path: actualPath, Size: info.Size(), Got: got}
+}
+
+// checkContentMD5 verifies a download against the MD5 that cloud storage
+// sends with it, as Content-MD5 (Azure, S3 when requested) or in
+// x-goog-hash (GCS). Responses without one are accepted.
+func checkContentMD5(header http.Header, data []byte) error {
+	want := header.Get("Content-MD5")
+	if want == "" {
+		for _, value := range header.Values("X-Goog-Hash") {
+			for _, part := range strings.Split(value, ",") {
+				if digest, ok := strings.CutPrefix(strings.TrimSpace(part), "md5="); ok {
+					want = digest
+				}
+			}
+		}
+	}
+	if want == "" {
+		return nil
+	}
+	expected, err := base64.StdEncoding.DecodeString(want)
+	if err != nil {
+		return nil
+	}
+	sum := md5.Sum(data)
+	if !bytes.Equal(sum[:], expected) {
+		return fmt.Errorf("signed URL download checksum mismatch: MD5 %s, got %s", want, base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	return nil
+}
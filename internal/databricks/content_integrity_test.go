@@ -0,0 +1,227 @@
+package databricks
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+)
+
+// binaryContent holds every byte value, invalid UTF-8 and mixed line
+// endings: what a text conversion would alter.
+func binaryContent() []byte {
+	data := []byte("line\r\nnext\rlast\n\xff\xfe\x00")
+	for i := 0; i < 256; i++ {
+		data = append(data, byte(i))
+	}
+	return data
+}
+
+// integrityFixture serves one regular file whose SOURCE export is altered
+// the way a text conversion would. The signed URL, when served, returns
+// signedContent.
+type integrityFixture struct {
+	content       []byte
+	sourceExport  []byte
+	signedContent []byte
+	statSizes     []int64 // sizes reported by successive object-info calls
+	exportFormats []workspace.ExportFormat
+	signedReads   int
+}
+
+func (f *integrityFixture) client(t *testing.T) *WorkspaceFilesClient {
+	t.Helper()
+	var signedURL string
+	if f.signedContent != nil {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			f.signedReads++
+			w.Write(f.signedContent)
+		}))
+		t.Cleanup(server.Close)
+		signedURL = server.URL
+	}
+	stats := 0
+	api := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			if !strings.Contains(path, "object-info") {
+				return fmt.Errorf("unexpected path: %s", path)
+			}
+			size := int64(len(f.content))
+			if stats < len(f.statSizes) {
+				size = f.statSizes[stats]
+			}
+			stats++
+			info := wsfsObjectInfo{ObjectInfo: workspace.ObjectInfo{Path: "/data.bin", ObjectType: workspace.ObjectTypeFile, Size: size}}
+			if signedURL != "" {
+				info.SignedURL = &struct {
+					URL     string            `json:"url"`
+					Headers map[string]string `json:"headers,omitempty"`
+				}{URL: signedURL}
+			}
+			response.(*objectInfoResponse).WsfsObjectInfo = info
+			return nil
+		},
+	}
+	wc := &MockWorkspaceClient{
+		ExportFunc: func(ctx context.Context, req workspace.ExportRequest) (*workspace.ExportResponse, error) {
+			f.exportFormats = append(f.exportFormats, req.Format)
+			content := f.content
+			if req.Format == workspace.ExportFormatSource {
+				content = f.sourceExport
+			}
+			return &workspace.ExportResponse{Content: base64.StdEncoding.EncodeToString(content)}, nil
+		},
+	}
+	return NewWorkspaceFilesClientWithDeps(wc, api, nil)
+}
+
+// utf8Sanitized mimics a SOURCE export that decoded the file as text.
+func utf8Sanitized(data []byte) []byte {
+	return bytes.ReplaceAll([]byte(strings.ToValidUTF8(string(data), "�")), []byte("\r\n"), []byte("\n"))
+}
+
+func TestBinaryFileRoundTrip(t *testing.T) {
+	ws := newFakeWorkspace()
+	client := ws.client()
+	ctx := context.Background()
+	content := binaryContent()
+
+	if err := client.Write(ctx, "/data.bin", content); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	data, err := client.ReadAll(ctx, "/data.bin")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("ReadAll = %q, %v; want the written bytes", data, err)
+	}
+}
+
+func TestReadAllRereadsAlteredSourceExportAsRaw(t *testing.T) {
+	content := binaryContent()
+	f := &integrityFixture{content: content, sourceExport: utf8Sanitized(content)}
+	client := f.client(t)
+
+	data, err := client.ReadAll(context.Background(), "/data.bin")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("ReadAll = %q, %v; want the original bytes", data, err)
+	}
+	want := []workspace.ExportFormat{workspace.ExportFormatSource, workspace.ExportFormatRaw}
+	if fmt.Sprint(f.exportFormats) != fmt.Sprint(want) {
+		t.Fatalf("export formats = %v, want %v", f.exportFormats, want)
+	}
+}
+
+func TestReadAllPrefersSignedURLAfterMismatch(t *testing.T) {
+	content := binaryContent()
+	f := &integrityFixture{content: content, sourceExport: utf8Sanitized(content), signedContent: content}
+	client := f.client(t)
+
+	data, err := client.ReadAll(context.Background(), "/data.bin")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("ReadAll = %q, %v; want the original bytes", data, err)
+	}
+	if f.signedReads != 1 || len(f.exportFormats) != 1 {
+		t.Fatalf("signed URL reads = %d, exports = %v; want the re-read through the signed URL", f.signedReads, f.exportFormats)
+	}
+}
+
+func TestReadAllAcceptsFileChangedSinceStat(t *testing.T) {
+	content := []byte("grown content\n")
+	f := &integrityFixture{content: content, sourceExport: content, statSizes: []int64{4}}
+	client := f.client(t)
+
+	data, err := client.ReadAll(context.Background(), "/data.bin")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("ReadAll = %q, %v", data, err)
+	}
+	if len(f.exportFormats) != 1 {
+		t.Fatalf("exports = %v, want no re-read when the fresh size matches", f.exportFormats)
+	}
+}
+
+func TestReadAllFailsWhenNoPathPreservesBytes(t *testing.T) {
+	content := binaryContent()
+	sanitized := utf8Sanitized(content)
+	f := &integrityFixture{content: sanitized, sourceExport: sanitized, statSizes: []int64{int64(len(content)), int64(len(content))}}
+	client := f.client(t)
+
+	_, err := client.ReadAll(context.Background(), "/data.bin")
+	var mismatch *ContentMismatchError
+	if !errors.As(err, &mismatch) || !errors.Is(err, syscall.EIO) {
+		t.Fatalf("ReadAll = %v, want a content mismatch", err)
+	}
+	if mismatch.Size != int64(len(content)) || mismatch.Got != int64(len(sanitized)) {
+		t.Fatalf("mismatch = %+v", mismatch)
+	}
+}
+
+func TestCheckContentMD5(t *testing.T) {
+	data := []byte("payload")
+	sum := md5.Sum(data)
+	digest := base64.StdEncoding.EncodeToString(sum[:])
+
+	for _, tt := range []struct {
+		name    string
+		header  http.Header
+		wantErr bool
+	}{
+		{name: "no checksum", header: http.Header{}},
+		{name: "content-md5", header: http.Header{"Content-Md5": {digest}}},
+		{name: "content-md5 mismatch", header: http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(make([]byte, 16))}}, wantErr: true},
+		{name: "x-goog-hash", header: http.Header{"X-Goog-Hash": {"crc32c=AAAAAA==,md5=" + digest}}},
+		{name: "x-goog-hash mismatch", header: http.Header{"X-Goog-Hash": {"crc32c=AAAAAA==", "md5=AAAAAAAAAAAAAAAAAAAAAA=="}}, wantErr: true},
+	} {
+		if err := checkContentMD5(tt.header, data); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkContentMD5 = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestReadAllFallsBackToExportOnSignedURLChecksumMismatch(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 6<<20)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(make([]byte, 16)))
+		w.Write(content)
+	}))
+	defer server.Close()
+	api := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			response.(*objectInfoResponse).WsfsObjectInfo = wsfsObjectInfo{
+				ObjectInfo: workspace.ObjectInfo{Path: "/big.bin", ObjectType: workspace.ObjectTypeFile, Size: int64(len(content))},
+				SignedURL: &struct {
+					URL     string            `json:"url"`
+					Headers map[string]string `json:"headers,omitempty"`
+				}{URL: server.URL},
+			}
+			return nil
+		},
+	}
+	exported := false
+	wc := &MockWorkspaceClient{
+		ExportFunc: func(ctx context.Context, req workspace.ExportRequest) (*workspace.ExportResponse, error) {
+			exported = true
+			return &workspace.ExportResponse{Content: base64.StdEncoding.EncodeToString(content)}, nil
+		},
+	}
+	client := NewWorkspaceFilesClientWithDeps(wc, api, nil)
+
+	data, err := client.ReadAll(context.Background(), "/big.bin")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !exported {
+		t.Fatal("expected a corrupted signed URL download to fall back to Export")
+	}
+}
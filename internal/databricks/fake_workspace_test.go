@@ -0,0 +1,184 @@
+package databricks
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/databricks/databricks-sdk-go/apierr"
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+)
+
+// fakeWorkspace is an in-memory workspace that serves the API calls the
+// client makes, so multi-step editor sequences can be replayed end to end.
+type fakeWorkspace struct {
+	mu      sync.Mutex
+	nextID  int64
+	clock   int64
+	objects map[string]*fakeObject
+}
+
+type fakeObject struct {
+	info    workspace.ObjectInfo
+	content []byte
+	format  workspace.ImportFormat // of the last notebook import
+}
+
+func newFakeWorkspace() *fakeWorkspace {
+	ws := &fakeWorkspace{objects: make(map[string]*fakeObject)}
+	ws.put("/", workspace.ObjectTypeDirectory, "", nil)
+	return ws
+}
+
+// put creates or replaces the object at p. Replacing keeps the ObjectId, as
+// an overwriting import does in a real workspace.
+func (ws *fakeWorkspace) put(p string, objectType workspace.ObjectType, language workspace.Language, content []byte) {
+	ws.clock++
+	obj, ok := ws.objects[p]
+	if !ok {
+		ws.nextID++
+		obj = &fakeObject{info: workspace.ObjectInfo{Path: p, ObjectId: ws.nextID}}
+		ws.objects[p] = obj
+	}
+	obj.info.ObjectType = objectType
+	obj.info.Language = language
+	obj.info.Size = int64(len(content))
+	obj.info.ModifiedAt = 1_700_000_000_000 + ws.clock
+	obj.content = append([]byte(nil), content...)
+}
+
+func (ws *fakeWorkspace) object(p string) (fakeObject, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	obj, ok := ws.objects[p]
+	if !ok {
+		return fakeObject{}, false
+	}
+	return *obj, true
+}
+
+func (ws *fakeWorkspace) paths() []string {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	var out []string
+	for p := range ws.objects {
+		if p != "/" {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (ws *fakeWorkspace) client() *WorkspaceFilesClient {
+	api := &MockAPIClient{DoFunc: ws.do}
+	wc := &MockWorkspaceClient{
+		ExportFunc: ws.export,
+		DeleteFunc: ws.delete,
+		UploadFunc: ws.upload,
+	}
+	return NewWorkspaceFilesClientWithDeps(wc, api, nil)
+}
+
+func (ws *fakeWorkspace) do(ctx context.Context, method, urlPath string,
+	headers map[string]string, queryParams map[string]any, request, response any,
+	visitors ...func(*http.Request) error) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(urlPath, "/api/2.0/workspace-files/object-info?path="):
+		p, _ := url.QueryUnescape(strings.TrimPrefix(urlPath, "/api/2.0/workspace-files/object-info?path="))
+		obj, ok := ws.objects[p]
+		if !ok {
+			return fs.ErrNotExist
+		}
+		response.(*objectInfoResponse).WsfsObjectInfo = wsfsObjectInfo{ObjectInfo: obj.info}
+		return nil
+	case strings.HasPrefix(urlPath, "/api/2.0/workspace-files/list-files?path="):
+		p, _ := url.QueryUnescape(strings.TrimPrefix(urlPath, "/api/2.0/workspace-files/list-files?path="))
+		resp := response.(*listFilesResponse)
+		for _, obj := range ws.objects {
+			if obj.info.Path != p && path.Dir(obj.info.Path) == p {
+				resp.Objects = append(resp.Objects, wsfsObjectInfo{ObjectInfo: obj.info})
+			}
+		}
+		return nil
+	case strings.HasPrefix(urlPath, "/api/2.0/workspace-files/import-file/"):
+		rest := strings.TrimPrefix(urlPath, "/api/2.0/workspace-files/import-file/")
+		escaped, _, _ := strings.Cut(rest, "?")
+		p, _ := url.PathUnescape(escaped)
+		ws.put("/"+p, workspace.ObjectTypeFile, "", request.([]byte))
+		return nil
+	case urlPath == "/api/2.0/workspace/rename":
+		body := request.(map[string]any)
+		src, dst := body["source_path"].(string), body["destination_path"].(string)
+		obj, ok := ws.objects[src]
+		if !ok {
+			return fs.ErrNotExist
+		}
+		if _, exists := ws.objects[dst]; exists {
+			return &apierr.APIError{StatusCode: http.StatusBadRequest, ErrorCode: "RESOURCE_ALREADY_EXISTS", Message: dst + " already exists"}
+		}
+		delete(ws.objects, src)
+		obj.info.Path = dst
+		ws.objects[dst] = obj
+		return nil
+	}
+	return fmt.Errorf("unexpected request %s %s", method, urlPath)
+}
+
+func (ws *fakeWorkspace) export(ctx context.Context, req workspace.ExportRequest) (*workspace.ExportResponse, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	obj, ok := ws.objects[req.Path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return &workspace.ExportResponse{Content: base64.StdEncoding.EncodeToString(obj.content)}, nil
+}
+
+func (ws *fakeWorkspace) delete(ctx context.Context, req workspace.Delete) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	obj, ok := ws.objects[req.Path]
+	if !ok {
+		return fs.ErrNotExist
+	}
+	if obj.info.ObjectType == workspace.ObjectTypeDirectory && !req.Recursive {
+		for p := range ws.objects {
+			if p != req.Path && path.Dir(p) == req.Path {
+				return &apierr.APIError{StatusCode: http.StatusBadRequest, ErrorCode: "DIRECTORY_NOT_EMPTY", Message: req.Path + " is not empty"}
+			}
+		}
+	}
+	delete(ws.objects, req.Path)
+	return nil
+}
+
+func (ws *fakeWorkspace) upload(ctx context.Context, p string, r io.Reader, opts ...workspace.UploadOption) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var req workspace.Import
+	for _, opt := range opts {
+		opt(&req)
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if _, exists := ws.objects[p]; exists && !req.Overwrite {
+		return fmt.Errorf("RESOURCE_ALREADY_EXISTS: %s", p)
+	}
+	ws.put(path.Clean(p), workspace.ObjectTypeNotebook, req.Language, data)
+	ws.objects[path.Clean(p)].format = req.Format
+	return nil
+}
@@ -0,0 +1,130 @@
+package databricks
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/faultinject"
+	"wsfs/internal/metacache"
+)
+
+// signedURLFaults returns a transport that fails every signed URL transfer.
+func signedURLFaults() (*faultinject.Injector, *faultinject.Transport) {
+	injector := faultinject.New(faultinject.Config{Rates: map[faultinject.Kind]float64{faultinject.SignedURL: 1}})
+	return injector, faultinject.NewTransport(nil, injector)
+}
+
+func TestReadAllFallsBackToExportOnInjectedSignedURLFailure(t *testing.T) {
+	content := make([]byte, sizeThresholdForSignedURL)
+	serverCalled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverCalled = true
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	mockAPI := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			if !strings.Contains(path, "object-info") {
+				return fmt.Errorf("unexpected path: %s", path)
+			}
+			resp := response.(*objectInfoResponse)
+			resp.WsfsObjectInfo = wsfsObjectInfo{
+				ObjectInfo: workspace.ObjectInfo{
+					Path:       "/big.bin",
+					ObjectType: workspace.ObjectTypeFile,
+					Size:       int64(len(content)),
+					ModifiedAt: time.Now().UnixMilli(),
+				},
+				SignedURL: &struct {
+					URL     string            `json:"url"`
+					Headers map[string]string `json:"headers,omitempty"`
+				}{URL: server.URL},
+			}
+			return nil
+		},
+	}
+	exportCalled := false
+	mockWorkspace := &MockWorkspaceClient{
+		ExportFunc: func(ctx context.Context, request workspace.ExportRequest) (*workspace.ExportResponse, error) {
+			exportCalled = true
+			return &workspace.ExportResponse{Content: base64.StdEncoding.EncodeToString(content)}, nil
+		},
+	}
+
+	client := NewWorkspaceFilesClientWithDeps(mockWorkspace, mockAPI, nil)
+	injector, transport := signedURLFaults()
+	client.signedURLTransport = transport
+
+	data, err := client.ReadAll(context.Background(), "/big.bin")
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if len(data) != len(content) {
+		t.Fatalf("expected %d bytes, got %d", len(content), len(data))
+	}
+	if serverCalled || !exportCalled {
+		t.Fatalf("expected injected failure before the server and an Export fallback (server=%v export=%v)", serverCalled, exportCalled)
+	}
+	if injector.Count(faultinject.SignedURL) != 1 {
+		t.Fatalf("expected one injected signed URL fault, got %d", injector.Count(faultinject.SignedURL))
+	}
+}
+
+func TestWriteFallsBackToImportFileOnInjectedSignedURLFailure(t *testing.T) {
+	content := make([]byte, sizeThresholdForSignedURL)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("signed URL PUT should have been failed by the injector")
+	}))
+	defer server.Close()
+
+	importFileCalled := false
+	mockAPI := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string,
+			headers map[string]string, queryParams map[string]any, request, response any,
+			visitors ...func(*http.Request) error) error {
+			switch {
+			case strings.Contains(path, "object-info"):
+				return fs.ErrNotExist
+			case strings.Contains(path, "new-files"):
+				resp := response.(*struct {
+					SignedURLs []struct {
+						URL     string            `json:"url"`
+						Headers map[string]string `json:"headers"`
+					} `json:"signed_urls"`
+				})
+				resp.SignedURLs = append(resp.SignedURLs, struct {
+					URL     string            `json:"url"`
+					Headers map[string]string `json:"headers"`
+				}{URL: server.URL})
+				return nil
+			case strings.Contains(path, "import-file"):
+				importFileCalled = true
+				return nil
+			default:
+				return fmt.Errorf("unexpected path: %s", path)
+			}
+		},
+	}
+
+	client := NewWorkspaceFilesClientWithDeps(&MockWorkspaceClient{}, mockAPI, metacache.NewCache(time.Second))
+	_, client.signedURLTransport = signedURLFaults()
+
+	if err := client.Write(context.Background(), "/big.bin", content); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if !importFileCalled {
+		t.Fatal("expected import-file fallback after injected signed URL failure")
+	}
+}
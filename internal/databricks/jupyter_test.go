@@ -0,0 +1,113 @@
+package databricks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+)
+
+// exportedJupyterNotebook is a notebook as Databricks exports it to .ipynb,
+// with its language, widgets and per-cell metadata.
+const exportedJupyterNotebook = `{
+ "cells": [
+  {
+   "cell_type": "code",
+   "execution_count": 0,
+   "metadata": {
+    "application/vnd.databricks.v1+cell": {
+     "cellMetadata": {"byteLimit": 2048000, "rowLimit": 10000},
+     "nuid": "5b7c1c4e-0000-4000-8000-000000000001",
+     "showTitle": true,
+     "title": "Load"
+    }
+   },
+   "outputs": [],
+   "source": ["dbutils.widgets.text(\"table\", \"events\")\n", "display(spark.table(dbutils.widgets.get(\"table\")))"]
+  }
+ ],
+ "metadata": {
+  "application/vnd.databricks.v1+notebook": {
+   "dashboards": [],
+   "language": "python",
+   "notebookMetadata": {"pythonIndentUnit": 4},
+   "notebookName": "report",
+   "widgets": {
+    "table": {
+     "currentValue": "events",
+     "nuid": "5b7c1c4e-0000-4000-8000-000000000002",
+     "widgetInfo": {"defaultValue": "events", "label": null, "name": "table", "options": {"validationRegex": null, "widgetType": "text"}, "widgetType": "text"}
+    }
+   }
+  },
+  "language_info": {"name": "python"}
+ },
+ "nbformat": 4,
+ "nbformat_minor": 0
+}
+`
+
+func databricksNotebookMetadata(t *testing.T, data []byte) map[string]any {
+	t.Helper()
+	var notebook struct {
+		Metadata map[string]map[string]any `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &notebook); err != nil {
+		t.Fatalf("stored content is not JSON: %v", err)
+	}
+	return notebook.Metadata["application/vnd.databricks.v1+notebook"]
+}
+
+func TestWriteJupyterIntoNotebookKeepsDatabricksMetadata(t *testing.T) {
+	ws, client, objectID := newNotebookWorkspace(t)
+
+	if err := client.Write(context.Background(), "/foo.py", []byte(exportedJupyterNotebook)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	obj, _ := ws.object("/foo")
+	if obj.info.ObjectType != workspace.ObjectTypeNotebook || obj.info.ObjectId != objectID {
+		t.Fatalf("notebook was replaced: %+v", obj.info)
+	}
+	if obj.format != workspace.ImportFormatJupyter {
+		t.Fatalf("imported as %s, want JUPYTER", obj.format)
+	}
+	if string(obj.content) != exportedJupyterNotebook {
+		t.Fatalf("imported content was rewritten:\n%s", obj.content)
+	}
+	metadata := databricksNotebookMetadata(t, obj.content)
+	if metadata["language"] != "python" || metadata["widgets"] == nil {
+		t.Fatalf("Databricks metadata lost: %v", metadata)
+	}
+}
+
+func TestWriteNotebookSourceStaysSource(t *testing.T) {
+	ws, client, _ := newNotebookWorkspace(t)
+
+	if err := client.Write(context.Background(), "/foo.py", []byte(savedNotebookAfter)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if obj, _ := ws.object("/foo"); obj.format != workspace.ImportFormatSource {
+		t.Fatalf("imported as %s, want SOURCE", obj.format)
+	}
+}
+
+func TestJupyterFileRoundTripsUnchanged(t *testing.T) {
+	ws := newFakeWorkspace()
+	client := ws.client()
+	ctx := context.Background()
+
+	if err := client.Write(ctx, "/report.ipynb", []byte(exportedJupyterNotebook)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if obj, _ := ws.object("/report.ipynb"); obj.info.ObjectType != workspace.ObjectTypeFile {
+		t.Fatalf("report.ipynb stored as %s, want a regular file", obj.info.ObjectType)
+	}
+	data, err := client.ReadAll(ctx, "/report.ipynb")
+	if err != nil || string(data) != exportedJupyterNotebook {
+		t.Fatalf("ReadAll = %q, %v; want the written notebook", data, err)
+	}
+	if metadata := databricksNotebookMetadata(t, data); metadata["widgets"] == nil {
+		t.Fatalf("Databricks metadata lost: %v", metadata)
+	}
+}
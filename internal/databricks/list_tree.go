@@ -0,0 +1,112 @@
+package databricks
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// listTreeWorkers bounds the concurrent listings of a tree walk.
+const listTreeWorkers = 8
+
+// TreeDir is a directory listed by WalkTree, with its entries as ReadDir
+// returned them.
+type TreeDir struct {
+	Path    string
+	Depth   int // 0 for the root of the walk
+	Entries []fs.DirEntry
+}
+
+// TreeOptions limits a WalkTree call.
+type TreeOptions struct {
+	// Depth is how many levels of directories are listed: 1 lists only the
+	// root. 0 is unlimited.
+	Depth int
+	// MaxDirs stops the walk after listing this many directories. 0 is
+	// unlimited.
+	MaxDirs int
+	// Skip, when set, reports directories the walk does not descend into.
+	Skip func(dir TreeDir, entry WSDirEntry) bool
+}
+
+// TreeListing is the result of a WalkTree call.
+type TreeListing struct {
+	Dirs      []TreeDir // breadth first, each level in listing order
+	Truncated bool      // stopped at TreeOptions.MaxDirs
+}
+
+// Entries returns the number of entries listed.
+func (l TreeListing) Entries() int {
+	entries := 0
+	for _, dir := range l.Dirs {
+		entries += len(dir.Entries)
+	}
+	return entries
+}
+
+// WalkTree lists root and the directories below it breadth first, one
+// ReadDir call per directory and up to listTreeWorkers at a time, so
+// prefetch, search, repo warm-ups and tree comparisons share one traversal.
+// Listings go through api, and so through its metadata cache. The first
+// failed listing ends the walk.
+func WalkTree(ctx context.Context, api WorkspaceFilesAPI, root string, opts TreeOptions) (TreeListing, error) {
+	var listing TreeListing
+	level := []string{root}
+	for depth := 0; len(level) > 0; depth++ {
+		if opts.MaxDirs > 0 && len(listing.Dirs)+len(level) > opts.MaxDirs {
+			level = level[:opts.MaxDirs-len(listing.Dirs)]
+			listing.Truncated = true
+		}
+		dirs := make([]TreeDir, len(level))
+		errs := make([]error, len(level))
+		var wg sync.WaitGroup
+		workers := make(chan struct{}, listTreeWorkers)
+		for i, dir := range level {
+			workers <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-workers }()
+				if errs[i] = ctx.Err(); errs[i] != nil {
+					return
+				}
+				dirs[i] = TreeDir{Path: dir, Depth: depth}
+				dirs[i].Entries, errs[i] = api.ReadDir(ctx, dir)
+			}()
+		}
+		wg.Wait()
+
+		var next []string
+		for i, dir := range dirs {
+			if errs[i] != nil {
+				return listing, fmt.Errorf("list %s: %w", level[i], errs[i])
+			}
+			listing.Dirs = append(listing.Dirs, dir)
+			if opts.Depth > 0 && depth+1 >= opts.Depth {
+				continue
+			}
+			for _, entry := range dir.Entries {
+				wsEntry, ok := entry.(WSDirEntry)
+				if !ok || !entry.IsDir() {
+					continue
+				}
+				if opts.Skip != nil && opts.Skip(dir, wsEntry) {
+					continue
+				}
+				next = append(next, wsEntry.Path)
+			}
+		}
+		if listing.Truncated {
+			break
+		}
+		level = next
+	}
+	return listing, nil
+}
+
+// ListTree lists the directory at dirPath and up to depth-1 levels of
+// directories below it, 0 being unlimited, through the metadata cache.
+func (c *WorkspaceFilesClient) ListTree(ctx context.Context, dirPath string, depth int) (TreeListing, error) {
+	return WalkTree(ctx, c, dirPath, TreeOptions{Depth: depth})
+}
@@ -0,0 +1,94 @@
+package databricks
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// treeAPI lists a tree of three levels: /root has two directories of two
+// directories each, and every directory holds one file.
+func treeAPI(t *testing.T) (*FakeWorkspaceAPI, *int) {
+	t.Helper()
+	var mu sync.Mutex
+	running, peak := 0, 0
+	api := &FakeWorkspaceAPI{
+		ReadDirFunc: func(ctx context.Context, dirPath string) ([]fs.DirEntry, error) {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			if path.Base(dirPath) == "broken" {
+				return nil, errors.New("boom")
+			}
+			entries := []fs.DirEntry{WSDirEntry{NewTestFileInfo(path.Join(dirPath, "f"), 1, false)}}
+			if depth := len(dirPath) - len("/root"); depth < 4 {
+				for _, name := range []string{"a", "b"} {
+					entries = append(entries, WSDirEntry{NewTestFileInfo(path.Join(dirPath, name), 0, true)})
+				}
+			}
+			return entries, nil
+		},
+	}
+	return api, &peak
+}
+
+func TestWalkTreeListsLevelsConcurrently(t *testing.T) {
+	api, peak := treeAPI(t)
+	listing, err := WalkTree(context.Background(), api, "/root", TreeOptions{})
+	if err != nil {
+		t.Fatalf("WalkTree: %v", err)
+	}
+	var dirs []string
+	for _, dir := range listing.Dirs {
+		dirs = append(dirs, dir.Path)
+	}
+	want := []string{"/root", "/root/a", "/root/b", "/root/a/a", "/root/a/b", "/root/b/a", "/root/b/b"}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Fatalf("listed %v, want %v", dirs, want)
+	}
+	if listing.Dirs[3].Depth != 2 || listing.Entries() != 13 || listing.Truncated {
+		t.Fatalf("unexpected listing %+v", listing)
+	}
+	if *peak < 2 || *peak > listTreeWorkers {
+		t.Fatalf("peak concurrency = %d, want 2..%d", *peak, listTreeWorkers)
+	}
+}
+
+func TestWalkTreeLimits(t *testing.T) {
+	api, _ := treeAPI(t)
+	ctx := context.Background()
+
+	listing, err := WalkTree(ctx, api, "/root", TreeOptions{Depth: 1})
+	if err != nil || len(listing.Dirs) != 1 {
+		t.Fatalf("depth 1 = %+v, %v; want only the root", listing, err)
+	}
+	listing, err = WalkTree(ctx, api, "/root", TreeOptions{MaxDirs: 4})
+	if err != nil || len(listing.Dirs) != 4 || !listing.Truncated {
+		t.Fatalf("max dirs 4 = %d dirs, truncated %v, %v", len(listing.Dirs), listing.Truncated, err)
+	}
+	listing, err = WalkTree(ctx, api, "/root", TreeOptions{Skip: func(dir TreeDir, entry WSDirEntry) bool {
+		return entry.Name() == "b"
+	}})
+	if err != nil || len(listing.Dirs) != 3 {
+		t.Fatalf("skipping b = %d dirs, %v; want 3", len(listing.Dirs), err)
+	}
+
+	if _, err := WalkTree(ctx, api, "/root/broken", TreeOptions{}); err == nil {
+		t.Fatal("failed listing did not end the walk")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := WalkTree(cancelled, api, "/root", TreeOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled walk = %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package databricks
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+)
+
+// newShadowedNotebookWorkspace returns a workspace whose Python notebook
+// /foo is shown as /foo.ipynb because a regular file holds /foo.py.
+func newShadowedNotebookWorkspace(t *testing.T) (*fakeWorkspace, *WorkspaceFilesClient) {
+	t.Helper()
+	ws, client, _ := newNotebookWorkspace(t)
+	ws.put("/foo.py", workspace.ObjectTypeFile, "", []byte("print('file')\n"))
+	return ws, client
+}
+
+// readToCache reads p so that its metadata, with the exact notebook size,
+// is cached under p.
+func readToCache(t *testing.T, client *WorkspaceFilesClient, p string) {
+	t.Helper()
+	if _, err := client.ReadAll(context.Background(), p); err != nil {
+		t.Fatalf("ReadAll(%s): %v", p, err)
+	}
+	if _, err := client.ReadDir(context.Background(), "/"); err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+}
+
+func assertNotExist(t *testing.T, client *WorkspaceFilesClient, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		if info, err := client.Stat(context.Background(), p); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("Stat(%s) = %+v, %v; want ErrNotExist", p, info, err)
+		}
+	}
+}
+
+func TestInvalidateRemoteNotebookPathDropsVisibleAliases(t *testing.T) {
+	for _, visiblePath := range []string{"/foo.py", "/foo.ipynb"} {
+		t.Run(visiblePath, func(t *testing.T) {
+			ws, client, _ := newNotebookWorkspace(t)
+			if visiblePath == "/foo.ipynb" {
+				ws, client = newShadowedNotebookWorkspace(t)
+			}
+			ctx := context.Background()
+			readToCache(t, client, visiblePath)
+
+			// Another client replaces the notebook; only the remote path
+			// is reported as changed.
+			ws.mu.Lock()
+			ws.put("/foo", workspace.ObjectTypeNotebook, workspace.LanguagePython, []byte(savedNotebookAfter+"# more\n"))
+			ws.mu.Unlock()
+			client.CacheInvalidate("/foo")
+			info, err := client.Stat(ctx, visiblePath)
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if info.Size() == int64(len(savedNotebookBefore)) {
+				t.Fatalf("Stat(%s) kept the size from before the change", visiblePath)
+			}
+
+			// Another client deletes it.
+			if err := ws.delete(ctx, workspace.Delete{Path: "/foo"}); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			client.CacheInvalidate("/foo")
+			assertNotExist(t, client, visiblePath)
+		})
+	}
+}
+
+func TestNotebookDeleteInvalidatesEveryAlias(t *testing.T) {
+	_, client, _ := newNotebookWorkspace(t)
+	readToCache(t, client, "/foo.py")
+	if err := client.Delete(context.Background(), "/foo.py", false); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	assertNotExist(t, client, "/foo", "/foo.py", "/foo.ipynb")
+
+	ws, client := newShadowedNotebookWorkspace(t)
+	readToCache(t, client, "/foo.ipynb")
+	if err := client.Delete(context.Background(), "/foo.ipynb", false); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	assertNotExist(t, client, "/foo", "/foo.ipynb")
+	if _, ok := ws.object("/foo.py"); !ok {
+		t.Fatal("deleting the notebook removed the file at /foo.py")
+	}
+}
+
+func TestNotebookRenameInvalidatesEveryAlias(t *testing.T) {
+	ws, client := newShadowedNotebookWorkspace(t)
+	ctx := context.Background()
+	readToCache(t, client, "/foo.ipynb")
+	assertNotExist(t, client, "/bar.py", "/bar.ipynb")
+
+	if err := client.Rename(ctx, "/foo.ipynb", "/bar.py"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, ok := ws.object("/bar"); !ok {
+		t.Fatalf("notebook was not renamed: %v", ws.paths())
+	}
+	assertNotExist(t, client, "/foo", "/foo.ipynb", "/bar.ipynb")
+	for _, p := range []string{"/bar", "/bar.py"} {
+		if _, err := client.Stat(ctx, p); err != nil {
+			t.Fatalf("Stat(%s) after rename: %v", p, err)
+		}
+	}
+	if info, err := client.Stat(ctx, "/foo.py"); err != nil || info.IsDir() || info.Size() != int64(len("print('file')\n")) {
+		t.Fatalf("Stat(/foo.py) = %+v, %v; want the regular file", info, err)
+	}
+}
+
+func TestNotebookWriteInvalidatesEveryAlias(t *testing.T) {
+	_, client := newShadowedNotebookWorkspace(t)
+	ctx := context.Background()
+	readToCache(t, client, "/foo.ipynb")
+
+	content := []byte(savedNotebookAfter + "# longer\n")
+	if err := client.Write(ctx, "/foo.ipynb", content); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	data, err := client.ReadAll(ctx, "/foo.ipynb")
+	if err != nil || string(data) != string(content) {
+		t.Fatalf("ReadAll after write = %q, %v", data, err)
+	}
+	info, err := client.Stat(ctx, "/foo.ipynb")
+	if err != nil || info.Size() != int64(len(content)) {
+		t.Fatalf("Stat after write = %+v, %v; want size %d", info, err, len(content))
+	}
+
+	assertNotExist(t, client, "/new.sql", "/new")
+	if err := client.Write(ctx, "/new.sql", []byte("-- Databricks notebook source\nSELECT 1\n")); err != nil {
+		t.Fatalf("Write new notebook: %v", err)
+	}
+	for _, p := range []string{"/new", "/new.sql"} {
+		if _, err := client.Stat(ctx, p); err != nil {
+			t.Fatalf("Stat(%s) after create: %v", p, err)
+		}
+	}
+}
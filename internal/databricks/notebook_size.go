@@ -0,0 +1,76 @@
+package databricks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/databricks/databricks-sdk-go/apierr"
+
+	"wsfs/internal/logging"
+)
+
+// NotebookTooLargeError reports a notebook upload refused for its size,
+// either by the workspace or locally by TransferConfig.MaxNotebookSize. It
+// unwraps to EFBIG.
+type NotebookTooLargeError struct {
+	Path  string
+	Size  int64
+	Limit int64 // zero when the workspace did not say
+	Err   error // the workspace's error; nil for the local check
+}
+
+func (e *NotebookTooLargeError) Error() string {
+	limit := "the workspace notebook size limit"
+	if e.Limit > 0 {
+		limit = fmt.Sprintf("the notebook size limit of %d bytes", e.Limit)
+	}
+	msg := fmt.Sprintf("notebook %s is %d bytes, over %s; split it into smaller notebooks or move code into workspace files the notebook imports", e.Path, e.Size, limit)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *NotebookTooLargeError) Unwrap() error {
+	return syscall.EFBIG
+}
+
+// isNotebookSizeError reports whether err is the workspace refusing a
+// notebook import because of its size. Without the check such uploads end
+// as a bare EIO.
+func isNotebookSizeError(err error) bool {
+	var apiError *apierr.APIError
+	if !errors.As(err, &apiError) {
+		return false
+	}
+	if apiError.ErrorCode == "MAX_NOTEBOOK_SIZE_EXCEEDED" || apiError.StatusCode == http.StatusRequestEntityTooLarge {
+		return true
+	}
+	message := strings.ToLower(apiError.Message)
+	return strings.Contains(message, "exceed") && strings.Contains(message, "size")
+}
+
+// checkNotebookSize refuses a notebook upload above the configured
+// MaxNotebookSize before it is sent.
+func (c *WorkspaceFilesClient) checkNotebookSize(actualPath string, size int64) error {
+	if c.maxNotebookSize <= 0 || size <= c.maxNotebookSize {
+		return nil
+	}
+	err := &NotebookTooLargeError{Path: actualPath, Size: size, Limit: c.maxNotebookSize}
+	logging.Warnf("Not uploading %v", err)
+	return err
+}
+
+// notebookSizeError turns the workspace's size refusal of a notebook upload
+// into a NotebookTooLargeError and leaves other errors alone.
+func notebookSizeError(actualPath string, size int64, err error) error {
+	if err == nil || !isNotebookSizeError(err) {
+		return err
+	}
+	tooLarge := &NotebookTooLargeError{Path: actualPath, Size: size, Err: err}
+	logging.Warnf("Workspace refused %v", tooLarge)
+	return tooLarge
+}
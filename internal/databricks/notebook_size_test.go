@@ -0,0 +1,76 @@
+package databricks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/apierr"
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+)
+
+func TestIsNotebookSizeError(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"error code", &apierr.APIError{StatusCode: http.StatusBadRequest, ErrorCode: "MAX_NOTEBOOK_SIZE_EXCEEDED", Message: "too big"}, true},
+		{"status 413", &apierr.APIError{StatusCode: http.StatusRequestEntityTooLarge}, true},
+		{"message", &apierr.APIError{StatusCode: http.StatusBadRequest, ErrorCode: "INVALID_PARAMETER_VALUE", Message: "File size imported is (12000000 bytes), exceeded max size (10485760 bytes)"}, true},
+		{"other api error", &apierr.APIError{StatusCode: http.StatusBadRequest, ErrorCode: "INVALID_PARAMETER_VALUE", Message: "bad language"}, false},
+		{"not an api error", errors.New("size exceeded"), false},
+	} {
+		if got := isNotebookSizeError(tt.err); got != tt.want {
+			t.Errorf("%s: isNotebookSizeError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteNotebookOverSizeLimitReturnsEFBIG(t *testing.T) {
+	ws, client, _ := newNotebookWorkspace(t)
+	ws.put("/foo.py", workspace.ObjectTypeFile, "", nil)
+	refusal := &apierr.APIError{StatusCode: http.StatusBadRequest, ErrorCode: "MAX_NOTEBOOK_SIZE_EXCEEDED", Message: "exceeded max size"}
+	client.workspaceClient.(*MockWorkspaceClient).UploadFunc = func(ctx context.Context, p string, r io.Reader, opts ...workspace.UploadOption) error {
+		return refusal
+	}
+
+	for _, p := range []string{"/foo.ipynb", "/new.py"} {
+		err := client.Write(context.Background(), p, []byte(savedNotebookAfter))
+		var tooLarge *NotebookTooLargeError
+		if !errors.As(err, &tooLarge) || !errors.Is(err, syscall.EFBIG) {
+			t.Fatalf("Write(%s) = %v, want EFBIG", p, err)
+		}
+		if tooLarge.Err != refusal || !strings.Contains(err.Error(), "split it into smaller notebooks") {
+			t.Fatalf("Write(%s) error lacks the cause or guidance: %v", p, err)
+		}
+	}
+}
+
+func TestWriteNotebookPreCheck(t *testing.T) {
+	ws, client, _ := newNotebookWorkspace(t)
+	ws.put("/foo.py", workspace.ObjectTypeFile, "", nil)
+	client.SetTransferConfig(TransferConfig{MaxNotebookSize: int64(len(savedNotebookAfter))})
+	ctx := context.Background()
+
+	err := client.Write(ctx, "/foo.ipynb", []byte(savedNotebookAfter+"# one more line\n"))
+	var tooLarge *NotebookTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != int64(len(savedNotebookAfter)) || !errors.Is(err, syscall.EFBIG) {
+		t.Fatalf("Write over the limit = %v, want a local EFBIG", err)
+	}
+	if obj, _ := ws.object("/foo"); string(obj.content) != savedNotebookBefore {
+		t.Fatalf("notebook was uploaded despite the pre-check: %q", obj.content)
+	}
+
+	if err := client.Write(ctx, "/foo.ipynb", []byte(savedNotebookAfter)); err != nil {
+		t.Fatalf("Write at the limit: %v", err)
+	}
+	// Regular files are not notebooks and are not limited.
+	if err := client.Write(ctx, "/foo.py", []byte(savedNotebookAfter+"# one more line\n")); err != nil {
+		t.Fatalf("Write of a regular file: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package databricks
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+)
+
+func TestRenameReplacesExistingFile(t *testing.T) {
+	ws := newFakeWorkspace()
+	ws.put("/a.txt", workspace.ObjectTypeFile, "", []byte("new"))
+	ws.put("/b.txt", workspace.ObjectTypeFile, "", []byte("old"))
+	source, _ := ws.object("/a.txt")
+	client := ws.client()
+
+	if err := client.Rename(context.Background(), "/a.txt", "/b.txt"); err != nil {
+		t.Fatalf("Rename over existing file: %v", err)
+	}
+	obj, ok := ws.object("/b.txt")
+	if !ok || string(obj.content) != "new" || obj.info.ObjectId != source.info.ObjectId {
+		t.Fatalf("destination = %+v %q, want the moved source", obj.info, obj.content)
+	}
+	if got := ws.paths(); strings.Join(got, ",") != "/b.txt" {
+		t.Fatalf("workspace objects = %v", got)
+	}
+	data, err := client.ReadAll(context.Background(), "/b.txt")
+	if err != nil || string(data) != "new" {
+		t.Fatalf("ReadAll after rename = %q, %v", data, err)
+	}
+}
+
+func TestRenameReplacesEmptyDirectory(t *testing.T) {
+	ws := newFakeWorkspace()
+	ws.put("/src", workspace.ObjectTypeDirectory, "", nil)
+	ws.put("/src/file.txt", workspace.ObjectTypeFile, "", []byte("x"))
+	ws.put("/dst", workspace.ObjectTypeDirectory, "", nil)
+	client := ws.client()
+
+	// Prime the listing cache; the emptiness check must not trust it.
+	if _, err := client.ReadDir(context.Background(), "/dst"); err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if err := client.Rename(context.Background(), "/src", "/dst"); err != nil {
+		t.Fatalf("Rename over empty directory: %v", err)
+	}
+	if obj, ok := ws.object("/dst"); !ok || obj.info.ObjectType != workspace.ObjectTypeDirectory {
+		t.Fatalf("expected /dst to be the moved directory, got %+v", obj.info)
+	}
+}
+
+func TestRenameOverExistingRefusesPOSIXViolations(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		dest      string
+		wantErrno syscall.Errno
+	}{
+		{name: "file over directory", source: "/file.txt", dest: "/empty", wantErrno: syscall.EISDIR},
+		{name: "directory over file", source: "/empty", dest: "/file.txt", wantErrno: syscall.ENOTDIR},
+		{name: "directory over non-empty directory", source: "/empty", dest: "/full", wantErrno: syscall.ENOTEMPTY},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newFakeWorkspace()
+			ws.put("/file.txt", workspace.ObjectTypeFile, "", []byte("x"))
+			ws.put("/empty", workspace.ObjectTypeDirectory, "", nil)
+			ws.put("/full", workspace.ObjectTypeDirectory, "", nil)
+			ws.put("/full/child.txt", workspace.ObjectTypeFile, "", []byte("y"))
+			before := ws.paths()
+
+			err := ws.client().Rename(context.Background(), tt.source, tt.dest)
+			if !errors.Is(err, tt.wantErrno) {
+				t.Fatalf("Rename error = %v, want %v", err, tt.wantErrno)
+			}
+			if got := ws.paths(); strings.Join(got, ",") != strings.Join(before, ",") {
+				t.Fatalf("workspace changed to %v, want %v", got, before)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package databricks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// repoWarmMaxDirs stops a warm-up of a huge repo early. The rest of the
+// tree is listed on demand as usual.
+const repoWarmMaxDirs = 5000
+
+// RepoInfo describes the Databricks Repo checked out at a workspace path.
+type RepoInfo struct {
+	ID           int64  `json:"id"`
+	Path         string `json:"path"`
+	Branch       string `json:"branch"`
+	HeadCommitID string `json:"head_commit_id"`
+}
+
+type listReposResponse struct {
+	Repos         []RepoInfo `json:"repos"`
+	NextPageToken string     `json:"next_page_token"`
+}
+
+// RepoWarmResult summarizes a WarmRepo call.
+type RepoWarmResult struct {
+	Repo      RepoInfo
+	Dirs      int  // directories listed
+	Entries   int  // objects whose metadata is now cached
+	Truncated bool // stopped at repoWarmMaxDirs
+	Skipped   bool // the checked-out commit was warmed within the metadata TTL
+}
+
+// RepoWarmer is an optional extension for backends that can prime their
+// metadata cache for a whole Databricks Repo, so an IDE opening the repo is
+// answered from the cache instead of one stat per file.
+type RepoWarmer interface {
+	WarmRepo(ctx context.Context, repoPath string) (RepoWarmResult, error)
+}
+
+var _ RepoWarmer = (*WorkspaceFilesClient)(nil)
+
+// repoWarm records the commit a repo was last warmed at.
+type repoWarm struct {
+	commit string
+	at     time.Time
+}
+
+// Repo returns the Repo checked out at repoPath.
+func (c *WorkspaceFilesClient) Repo(ctx context.Context, repoPath string) (RepoInfo, error) {
+	pageToken := ""
+	for {
+		urlPath := fmt.Sprintf("/api/2.0/repos?path_prefix=%s", url.QueryEscape(repoPath))
+		if pageToken != "" {
+			urlPath += "&next_page_token=" + url.QueryEscape(pageToken)
+		}
+		var resp listReposResponse
+		if err := c.do(ctx, http.MethodGet, urlPath, nil, &resp); err != nil {
+			return RepoInfo{}, normalizeNotExistError(err)
+		}
+		for _, repo := range resp.Repos {
+			if repo.Path == repoPath {
+				return repo, nil
+			}
+		}
+		if resp.NextPageToken == "" {
+			return RepoInfo{}, fmt.Errorf("no repo at %s: %w", repoPath, os.ErrNotExist)
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// WarmRepo lists every directory of the Repo at repoPath into the metadata
+// cache. The Repos API reports the checked-out commit but not the files of
+// the repo, so the tree is still listed one directory per call, but never
+// one file per call. A repo already warmed at the same commit within the
+// metadata TTL is skipped.
+func (c *WorkspaceFilesClient) WarmRepo(ctx context.Context, repoPath string) (RepoWarmResult, error) {
+	value, err := c.flights.Do("warmrepo:"+repoPath, func() (any, error) {
+		repo, err := c.Repo(ctx, repoPath)
+		if err != nil {
+			return RepoWarmResult{}, err
+		}
+		result := RepoWarmResult{Repo: repo}
+
+		c.reposMu.Lock()
+		last, ok := c.warmedRepos[repoPath]
+		c.reposMu.Unlock()
+		if ok && last.commit == repo.HeadCommitID && time.Since(last.at) < c.MetadataTTL() {
+			result.Skipped = true
+			return result, nil
+		}
+
+		if err := c.warmTree(ctx, repoPath, &result); err != nil {
+			return result, err
+		}
+		c.reposMu.Lock()
+		if c.warmedRepos == nil {
+			c.warmedRepos = make(map[string]repoWarm)
+		}
+		c.warmedRepos[repoPath] = repoWarm{commit: repo.HeadCommitID, at: time.Now()}
+		c.reposMu.Unlock()
+		return result, nil
+	})
+	result, _ := value.(RepoWarmResult)
+	return result, err
+}
+
+// warmTree lists root and the directories below it breadth first, up to
+// repoWarmMaxDirs directories.
+func (c *WorkspaceFilesClient) warmTree(ctx context.Context, root string, result *RepoWarmResult) error {
+	listing, err := WalkTree(ctx, c, root, TreeOptions{MaxDirs: repoWarmMaxDirs})
+	result.Dirs = len(listing.Dirs)
+	result.Entries = listing.Entries()
+	result.Truncated = listing.Truncated
+	return err
+}
@@ -0,0 +1,134 @@
+package databricks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/metacache"
+)
+
+// repoAPI serves one repo at /Repos/me/proj and counts the listings.
+type repoAPI struct {
+	mu     sync.Mutex
+	commit string
+	lists  map[string]int
+	tree   map[string][]workspace.ObjectInfo
+}
+
+func newRepoAPI() *repoAPI {
+	file := func(p string) workspace.ObjectInfo {
+		return workspace.ObjectInfo{Path: p, ObjectType: workspace.ObjectTypeFile, Size: 1}
+	}
+	dir := func(p string) workspace.ObjectInfo {
+		return workspace.ObjectInfo{Path: p, ObjectType: workspace.ObjectTypeDirectory}
+	}
+	return &repoAPI{
+		commit: "abc123",
+		lists:  make(map[string]int),
+		tree: map[string][]workspace.ObjectInfo{
+			"/Repos/me/proj":         {file("/Repos/me/proj/README.md"), dir("/Repos/me/proj/src")},
+			"/Repos/me/proj/src":     {file("/Repos/me/proj/src/main.py"), dir("/Repos/me/proj/src/pkg")},
+			"/Repos/me/proj/src/pkg": {file("/Repos/me/proj/src/pkg/util.py")},
+		},
+	}
+}
+
+func (a *repoAPI) Do(ctx context.Context, method, path string,
+	headers map[string]string, queryParams map[string]any, request, response any,
+	visitors ...func(*http.Request) error) error {
+	u, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch u.Path {
+	case "/api/2.0/repos":
+		resp := response.(*listReposResponse)
+		if strings.HasPrefix("/Repos/me/proj", u.Query().Get("path_prefix")) {
+			resp.Repos = []RepoInfo{{ID: 7, Path: "/Repos/me/proj", Branch: "main", HeadCommitID: a.commit}}
+		}
+		return nil
+	case "/api/2.0/workspace-files/list-files":
+		dirPath := u.Query().Get("path")
+		a.lists[dirPath]++
+		resp := response.(*listFilesResponse)
+		for _, info := range a.tree[dirPath] {
+			resp.Objects = append(resp.Objects, wsfsObjectInfo{ObjectInfo: info})
+		}
+		return nil
+	}
+	return fmt.Errorf("unexpected request %s", path)
+}
+
+func (a *repoAPI) listCalls() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	total := 0
+	for _, n := range a.lists {
+		total += n
+	}
+	return total
+}
+
+func TestWarmRepoCachesWholeTree(t *testing.T) {
+	api := newRepoAPI()
+	client := NewWorkspaceFilesClientWithDeps(&MockWorkspaceClient{}, api, metacache.NewCache(time.Minute))
+	ctx := context.Background()
+
+	result, err := client.WarmRepo(ctx, "/Repos/me/proj")
+	if err != nil {
+		t.Fatalf("WarmRepo: %v", err)
+	}
+	if result.Repo.HeadCommitID != "abc123" || result.Dirs != 3 || result.Entries != 5 || result.Skipped || result.Truncated {
+		t.Fatalf("result = %+v", result)
+	}
+	if api.listCalls() != 3 {
+		t.Fatalf("list calls = %d, want one per directory", api.listCalls())
+	}
+
+	// Stats of any file in the repo are answered from the cache.
+	info, err := client.Stat(ctx, "/Repos/me/proj/src/pkg/util.py")
+	if err != nil || info.Size() != 1 {
+		t.Fatalf("Stat = %v, %v", info, err)
+	}
+	if _, err := client.Stat(ctx, "/Repos/me/proj/src/missing.py"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat of a missing file = %v, want ErrNotExist from the cached listing", err)
+	}
+
+	// The same commit is not warmed again within the TTL.
+	result, err = client.WarmRepo(ctx, "/Repos/me/proj")
+	if err != nil || !result.Skipped {
+		t.Fatalf("second WarmRepo = %+v, %v, want it skipped", result, err)
+	}
+
+	// A new commit warms again; listings still cached are reused.
+	client.CacheInvalidate("/Repos/me/proj/src/pkg")
+	api.mu.Lock()
+	api.commit = "def456"
+	api.mu.Unlock()
+	result, err = client.WarmRepo(ctx, "/Repos/me/proj")
+	if err != nil || result.Skipped || result.Repo.HeadCommitID != "def456" {
+		t.Fatalf("WarmRepo after a checkout = %+v, %v", result, err)
+	}
+	if api.listCalls() != 5 {
+		t.Fatalf("list calls = %d, want the two invalidated directories listed again", api.listCalls())
+	}
+}
+
+func TestWarmRepoUnknownPath(t *testing.T) {
+	client := NewWorkspaceFilesClientWithDeps(&MockWorkspaceClient{}, newRepoAPI(), nil)
+	if _, err := client.WarmRepo(context.Background(), "/Repos/me/other"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("WarmRepo of a path without a repo = %v, want ErrNotExist", err)
+	}
+}
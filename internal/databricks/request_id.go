@@ -0,0 +1,94 @@
+package databricks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/databricks/databricks-sdk-go/apierr"
+
+	"wsfs/internal/logging"
+)
+
+// requestIDHeaders are the response headers that name a request, in order
+// of preference: Databricks first, then the cloud storage behind signed
+// URLs (S3, Azure Blob Storage, GCS).
+var requestIDHeaders = []string{"X-Request-Id", "X-Amz-Request-Id", "X-Ms-Request-Id", "X-Guploader-Uploadid"}
+
+// RequestError is a failed request together with the ID the server gave
+// it. Databricks support asks for the ID when a call fails.
+type RequestError struct {
+	Op        string // "METHOD /path" of the failed call
+	RequestID string
+	Err       error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%v (request ID %s)", e.Err, e.RequestID)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// RequestID returns the ID of the failed request behind err, or "" if the
+// server did not name it.
+func RequestID(err error) string {
+	var requestErr *RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.RequestID
+	}
+	var apiError *apierr.APIError
+	if !errors.As(err, &apiError) {
+		return ""
+	}
+	if info := apiError.ErrorDetails().RequestInfo; info != nil && info.RequestID != "" {
+		return info.RequestID
+	}
+	if apiError.ResponseWrapper != nil {
+		return responseRequestID(apiError.ResponseWrapper.Response)
+	}
+	return ""
+}
+
+func responseRequestID(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	for _, header := range requestIDHeaders {
+		if id := resp.Header.Get(header); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// withRequestID attaches the request ID of a failed call to err and logs
+// it. Missing and already existing objects are answers the callers handle
+// rather than failures, and errors without an ID are returned unchanged.
+func withRequestID(op string, err error) error {
+	if err == nil || apierr.IsMissing(err) || isAlreadyExistsError(err) {
+		return err
+	}
+	var requestErr *RequestError
+	if errors.As(err, &requestErr) {
+		return err
+	}
+	return requestFailed(op, RequestID(err), err)
+}
+
+// requestFailed wraps err of the call op in a RequestError if id is known.
+func requestFailed(op string, id string, err error) error {
+	if id == "" {
+		return err
+	}
+	logging.Warnf("%s failed (request ID %s): %s", op, id, sanitizeError(err))
+	return &RequestError{Op: op, RequestID: id, Err: err}
+}
+
+// do calls the workspace REST API and attaches the request ID to failures.
+func (c *WorkspaceFilesClient) do(ctx context.Context, method, urlPath string, request, response any) error {
+	err := c.apiClient.Do(ctx, method, urlPath, nil, nil, request, response)
+	return withRequestID(method+" "+sanitizeURL(urlPath), err)
+}
@@ -0,0 +1,84 @@
+package databricks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/apierr"
+	"github.com/databricks/databricks-sdk-go/common"
+)
+
+func apiErrorWithRequestID(status int, id string) *apierr.APIError {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	resp.Header.Set("X-Request-Id", id)
+	return &apierr.APIError{StatusCode: status, Message: "backend unavailable", ResponseWrapper: &common.ResponseWrapper{Response: resp}}
+}
+
+func TestAPIFailuresCarryRequestID(t *testing.T) {
+	apiErr := apiErrorWithRequestID(http.StatusServiceUnavailable, "req-123")
+	mockAPI := &MockAPIClient{
+		DoFunc: func(ctx context.Context, method, path string, headers map[string]string, queryParams map[string]any, request, response any, visitors ...func(*http.Request) error) error {
+			return apiErr
+		},
+	}
+	client := NewWorkspaceFilesClientWithDeps(&MockWorkspaceClient{}, mockAPI, nil)
+
+	_, err := client.Stat(context.Background(), "/a.txt")
+	if RequestID(err) != "req-123" {
+		t.Fatalf("RequestID(%v) = %q", err, RequestID(err))
+	}
+	if !strings.Contains(err.Error(), "(request ID req-123)") {
+		t.Fatalf("error does not name the request: %v", err)
+	}
+	var requestErr *RequestError
+	if !errors.As(err, &requestErr) || !strings.HasPrefix(requestErr.Op, "GET /api/2.0/workspace-files/object-info") || strings.Contains(requestErr.Op, "?") {
+		t.Fatalf("unexpected request error: %#v", requestErr)
+	}
+	if !errors.Is(err, apiErr) {
+		t.Fatal("expected the SDK error to stay in the chain")
+	}
+}
+
+func TestMissingObjectsAreNotRequestFailures(t *testing.T) {
+	apiErr := apiErrorWithRequestID(http.StatusNotFound, "req-404")
+	apiErr.ErrorCode = "RESOURCE_DOES_NOT_EXIST"
+	if err := withRequestID("GET /x", apiErr); err != error(apiErr) {
+		t.Fatalf("expected missing object error unchanged, got %v", err)
+	}
+	if err := withRequestID("GET /x", errors.New("dial tcp: refused")); RequestID(err) != "" {
+		t.Fatalf("expected no request ID without a response, got %q", RequestID(err))
+	}
+}
+
+func TestRequestIDFromErrorDetails(t *testing.T) {
+	body := `{"error_code":"INTERNAL_ERROR","message":"boom","details":[{"@type":"type.googleapis.com/google.rpc.RequestInfo","request_id":"req-details","serving_data":""}]}`
+	err := apierr.GetAPIError(context.Background(), common.ResponseWrapper{
+		Response:   &http.Response{StatusCode: http.StatusInternalServerError, Header: http.Header{}, Request: httptest.NewRequest(http.MethodGet, "/api/2.0/x", nil)},
+		ReadCloser: io.NopCloser(strings.NewReader(body)),
+	})
+	if got := RequestID(err); got != "req-details" {
+		t.Fatalf("RequestID = %q, want the one from the error details", got)
+	}
+}
+
+func TestSignedURLFailureCarriesStorageRequestID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amz-Request-Id", "s3-req")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	client := NewWorkspaceFilesClientWithDeps(&MockWorkspaceClient{}, &MockAPIClient{}, nil)
+
+	_, err := client.readViaSignedURL(context.Background(), server.URL+"/file?X-Amz-Signature=secret", nil)
+	if RequestID(err) != "s3-req" {
+		t.Fatalf("RequestID(%v) = %q", err, RequestID(err))
+	}
+	if strings.Contains(err.(*RequestError).Op, "secret") {
+		t.Fatalf("signed URL query leaked into %q", err.(*RequestError).Op)
+	}
+}
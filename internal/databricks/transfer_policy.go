@@ -0,0 +1,143 @@
+package databricks
+
+import (
+	"sync"
+	"time"
+)
+
+// TransferConfig controls whether file contents move through the workspace
+// API (export/import-file) or through signed URLs to cloud storage.
+type TransferConfig struct {
+	// SignedURLThreshold is the file size from which signed URLs are used.
+	// Zero keeps the 5 MiB default. Files of workspaceAPIMaxSize and up
+	// always use signed URLs first.
+	SignedURLThreshold int64
+	// Adaptive picks the path per request from the throughput observed on
+	// each path, because some networks and proxies make signed URL storage
+	// slower than the workspace API. SignedURLThreshold decides until both
+	// paths have been measured.
+	Adaptive bool
+	// MaxNotebookSize refuses notebook uploads larger than this many bytes
+	// with EFBIG before they are sent. Zero sends them and leaves the
+	// limit to the workspace.
+	MaxNotebookSize int64
+}
+
+const (
+	// workspaceAPIMaxSize is the export/import size limit of the workspace
+	// API, so larger transfers always start with a signed URL.
+	workspaceAPIMaxSize = 10 << 20
+	// adaptiveMinSize is the smallest transfer the adaptive policy considers.
+	// Below it a single workspace API round trip always wins.
+	adaptiveMinSize = 1 << 20
+	// adaptiveMinSamples is how many measurements a path needs before its
+	// throughput is trusted.
+	adaptiveMinSamples = 3
+	// adaptiveProbeEvery sends every n-th eligible transfer down the other
+	// path so its estimate stays current.
+	adaptiveProbeEvery = 16
+	// adaptiveWeight is the EWMA weight of the newest measurement.
+	adaptiveWeight = 0.3
+)
+
+type transferDirection int
+
+const (
+	transferRead transferDirection = iota
+	transferWrite
+)
+
+type transferPath int
+
+const (
+	transferWorkspaceAPI transferPath = iota
+	transferSignedURL
+)
+
+func (p transferPath) String() string {
+	if p == transferSignedURL {
+		return "signed URL"
+	}
+	return "workspace API"
+}
+
+// throughputEstimate is an exponentially weighted moving average of the
+// bytes per second observed on one path.
+type throughputEstimate struct {
+	bytesPerSec float64
+	samples     int
+}
+
+func (e *throughputEstimate) add(bytesPerSec float64) {
+	if e.samples == 0 {
+		e.bytesPerSec = bytesPerSec
+	} else {
+		e.bytesPerSec = adaptiveWeight*bytesPerSec + (1-adaptiveWeight)*e.bytesPerSec
+	}
+	e.samples++
+}
+
+// transferPolicy decides between the workspace API and signed URLs.
+type transferPolicy struct {
+	threshold int64
+	adaptive  bool
+
+	mu        sync.Mutex
+	estimates [2][2]throughputEstimate // [direction][path]
+	decisions [2]uint64                // eligible adaptive decisions per direction
+}
+
+func newTransferPolicy(cfg TransferConfig) *transferPolicy {
+	threshold := cfg.SignedURLThreshold
+	if threshold <= 0 {
+		threshold = sizeThresholdForSignedURL
+	}
+	return &transferPolicy{threshold: threshold, adaptive: cfg.Adaptive}
+}
+
+// choose returns the path for a transfer of size bytes.
+func (p *transferPolicy) choose(dir transferDirection, size int64) transferPath {
+	if size >= workspaceAPIMaxSize {
+		return transferSignedURL
+	}
+	static := transferWorkspaceAPI
+	if size >= p.threshold {
+		static = transferSignedURL
+	}
+	if !p.adaptive || size < adaptiveMinSize {
+		return static
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.decisions[dir]++
+	api := p.estimates[dir][transferWorkspaceAPI]
+	signed := p.estimates[dir][transferSignedURL]
+
+	best := static
+	if api.samples >= adaptiveMinSamples && signed.samples >= adaptiveMinSamples {
+		best = transferWorkspaceAPI
+		if signed.bytesPerSec > api.bytesPerSec {
+			best = transferSignedURL
+		}
+	}
+	if p.decisions[dir]%adaptiveProbeEvery == 0 {
+		return 1 - best
+	}
+	return best
+}
+
+// observe records a finished transfer. Failures count as zero throughput so
+// a path that keeps failing loses preference.
+func (p *transferPolicy) observe(dir transferDirection, path transferPath, size int64, elapsed time.Duration, err error) {
+	if !p.adaptive || size < adaptiveMinSize {
+		return
+	}
+	bytesPerSec := 0.0
+	if err == nil && elapsed > 0 {
+		bytesPerSec = float64(size) / elapsed.Seconds()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.estimates[dir][path].add(bytesPerSec)
+}
@@ -0,0 +1,86 @@
+package databricks
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransferPolicyStaticThreshold(t *testing.T) {
+	p := newTransferPolicy(TransferConfig{})
+	if got := p.choose(transferWrite, sizeThresholdForSignedURL-1); got != transferWorkspaceAPI {
+		t.Fatalf("expected workspace API below default threshold, got %s", got)
+	}
+	if got := p.choose(transferWrite, sizeThresholdForSignedURL); got != transferSignedURL {
+		t.Fatalf("expected signed URL at default threshold, got %s", got)
+	}
+
+	p = newTransferPolicy(TransferConfig{SignedURLThreshold: 64 << 20})
+	if got := p.choose(transferRead, 8<<20); got != transferWorkspaceAPI {
+		t.Fatalf("expected workspace API below configured threshold, got %s", got)
+	}
+	if got := p.choose(transferRead, workspaceAPIMaxSize); got != transferSignedURL {
+		t.Fatalf("expected signed URL at the workspace API size limit, got %s", got)
+	}
+}
+
+// measure feeds n transfers of size bytes at the given throughput.
+func measure(p *transferPolicy, dir transferDirection, path transferPath, n int, size int64, bytesPerSec float64) {
+	for i := 0; i < n; i++ {
+		p.observe(dir, path, size, time.Duration(float64(size)/bytesPerSec*float64(time.Second)), nil)
+	}
+}
+
+func TestTransferPolicyAdaptivePrefersFasterPath(t *testing.T) {
+	const size = 8 << 20
+	p := newTransferPolicy(TransferConfig{Adaptive: true})
+
+	// Until both paths are measured the threshold decides.
+	if got := p.choose(transferWrite, size); got != transferSignedURL {
+		t.Fatalf("expected threshold decision before measurements, got %s", got)
+	}
+
+	measure(p, transferWrite, transferSignedURL, adaptiveMinSamples, size, 1<<20)
+	measure(p, transferWrite, transferWorkspaceAPI, adaptiveMinSamples, size, 20<<20)
+
+	apiChoices := 0
+	for i := 0; i < adaptiveProbeEvery*2; i++ {
+		if p.choose(transferWrite, size) == transferWorkspaceAPI {
+			apiChoices++
+		}
+	}
+	if want := adaptiveProbeEvery*2 - 2; apiChoices != want {
+		t.Fatalf("expected the faster workspace API except for %d probes, got %d of %d", 2, apiChoices, adaptiveProbeEvery*2)
+	}
+
+	// Reads are measured separately and still follow the threshold.
+	if got := p.choose(transferRead, size); got != transferSignedURL {
+		t.Fatalf("expected read decisions to be independent, got %s", got)
+	}
+	// Small transfers never use the adaptive estimate.
+	if got := p.choose(transferWrite, adaptiveMinSize-1); got != transferWorkspaceAPI {
+		t.Fatalf("expected workspace API for small transfers, got %s", got)
+	}
+}
+
+func TestTransferPolicyFailuresLosePreference(t *testing.T) {
+	const size = 8 << 20
+	p := newTransferPolicy(TransferConfig{Adaptive: true})
+	measure(p, transferRead, transferWorkspaceAPI, adaptiveMinSamples, size, 5<<20)
+	for i := 0; i < adaptiveMinSamples; i++ {
+		p.observe(transferRead, transferSignedURL, size, time.Millisecond, errors.New("403"))
+	}
+	if got := p.choose(transferRead, size); got != transferWorkspaceAPI {
+		t.Fatalf("expected failing signed URLs to lose preference, got %s", got)
+	}
+}
+
+func TestTransferPolicyStaticIgnoresObservations(t *testing.T) {
+	const size = 8 << 20
+	p := newTransferPolicy(TransferConfig{})
+	measure(p, transferWrite, transferSignedURL, 10, size, 1)
+	measure(p, transferWrite, transferWorkspaceAPI, 10, size, 1<<30)
+	if got := p.choose(transferWrite, size); got != transferSignedURL {
+		t.Fatalf("expected static policy to ignore measurements, got %s", got)
+	}
+}
@@ -0,0 +1,97 @@
+package databricks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// TransportConfig configures the HTTP transport shared by the Databricks SDK
+// and the direct signed URL transfers.
+type TransportConfig struct {
+	// CABundle is a PEM file of extra trusted CAs, e.g. a corporate proxy
+	// root. It is added to the system pool.
+	CABundle string
+	// InsecureSkipVerify disables TLS certificate verification. It exists
+	// for debugging broken proxies and must never be used in production.
+	InsecureSkipVerify bool
+	// MaxIdleConnsPerHost is how many idle keep-alive connections are kept
+	// per host. Zero uses defaultMaxIdleConnsPerHost.
+	MaxIdleConnsPerHost int
+	// DisableHTTP2 keeps every connection on HTTP/1.1, for proxies that
+	// mishandle HTTP/2.
+	DisableHTTP2 bool
+}
+
+// defaultMaxIdleConnsPerHost keeps enough warm connections to the signed URL
+// storage host for parallel reads and uploads. http.DefaultTransport keeps
+// only 2, so bursts paid a new TLS handshake per request.
+const defaultMaxIdleConnsPerHost = 16
+
+// NewHTTPTransport returns a pooled transport that honors HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY and applies cfg's TLS and connection settings.
+// Share one transport per process so keep-alive connections are reused.
+func NewHTTPTransport(cfg TransportConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	if transport.MaxIdleConnsPerHost <= 0 {
+		transport.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if transport.MaxIdleConns < transport.MaxIdleConnsPerHost {
+		transport.MaxIdleConns = transport.MaxIdleConnsPerHost
+	}
+	if cfg.DisableHTTP2 {
+		// A non-nil, empty TLSNextProto is the documented way to turn off
+		// HTTP/2 on a transport.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	} else {
+		transport.ForceAttemptHTTP2 = true
+	}
+	if cfg.CABundle == "" && !cfg.InsecureSkipVerify {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CABundle != "" {
+		pool, err := loadCABundle(cfg.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	tlsConfig.InsecureSkipVerify = cfg.InsecureSkipVerify
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// loadCABundle returns the system roots plus the certificates in path.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("no PEM certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// defaultSignedURLTransport is shared by clients without a transport
+// override, so all of them draw from one connection pool.
+var defaultSignedURLTransport = sync.OnceValue(func() http.RoundTripper {
+	transport, err := NewHTTPTransport(TransportConfig{})
+	if err != nil {
+		// Only a CA bundle can fail, and the default config has none.
+		return http.DefaultTransport
+	}
+	return transport
+})
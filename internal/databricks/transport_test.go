@@ -0,0 +1,206 @@
+package databricks
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestNewHTTPTransportHonorsProxyEnvironment(t *testing.T) {
+	transport, err := NewHTTPTransport(TransportConfig{})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport failed: %v", err)
+	}
+	// http.ProxyFromEnvironment caches the environment on first use, so check
+	// the wiring rather than a particular HTTPS_PROXY value.
+	if transport.Proxy == nil {
+		t.Fatal("expected proxy settings from HTTP_PROXY, HTTPS_PROXY and NO_PROXY")
+	}
+	if transport == http.DefaultTransport {
+		t.Fatal("expected a copy of the default transport")
+	}
+}
+
+func TestNewHTTPTransportTrustsCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// Without the bundle the test server's self-signed certificate is rejected.
+	plain, err := NewHTTPTransport(TransportConfig{})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport failed: %v", err)
+	}
+	if _, err := (&http.Client{Transport: plain}).Get(server.URL); err == nil {
+		t.Fatal("expected certificate error without CA bundle")
+	}
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, certPEM, 0o600); err != nil {
+		t.Fatalf("write bundle: %v", err)
+	}
+	transport, err := NewHTTPTransport(TransportConfig{CABundle: bundle})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport failed: %v", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with CA bundle failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func TestNewHTTPTransportInsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	transport, err := NewHTTPTransport(TransportConfig{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport failed: %v", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("insecure request failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewHTTPTransportRejectsInvalidCABundle(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewHTTPTransport(TransportConfig{CABundle: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Fatal("expected error for missing bundle")
+	}
+
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("write bundle: %v", err)
+	}
+	if _, err := NewHTTPTransport(TransportConfig{CABundle: garbage}); err == nil {
+		t.Fatal("expected error for bundle without certificates")
+	}
+}
+
+func TestSignedURLClientUsesWorkspaceTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	transport, err := NewHTTPTransport(TransportConfig{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport failed: %v", err)
+	}
+	client := &WorkspaceFilesClient{signedURLTransport: transport}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.signedURLClient().Do(req)
+	if err != nil {
+		t.Fatalf("signed URL request failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewHTTPTransportPoolingSettings(t *testing.T) {
+	transport, err := NewHTTPTransport(TransportConfig{})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport failed: %v", err)
+	}
+	if transport.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost {
+		t.Fatalf("MaxIdleConnsPerHost = %d, want %d", transport.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost)
+	}
+	if !transport.ForceAttemptHTTP2 {
+		t.Fatal("expected HTTP/2 to be attempted by default")
+	}
+
+	transport, err = NewHTTPTransport(TransportConfig{MaxIdleConnsPerHost: 256, DisableHTTP2: true})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport failed: %v", err)
+	}
+	if transport.MaxIdleConnsPerHost != 256 || transport.MaxIdleConns < 256 {
+		t.Fatalf("unexpected pool sizes: per host %d, total %d", transport.MaxIdleConnsPerHost, transport.MaxIdleConns)
+	}
+	if transport.ForceAttemptHTTP2 || transport.TLSNextProto == nil || len(transport.TLSNextProto) != 0 {
+		t.Fatal("expected HTTP/2 to be disabled")
+	}
+}
+
+func TestNewHTTPTransportNegotiatesHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for _, tc := range []struct {
+		disable bool
+		want    string
+	}{
+		{disable: false, want: "HTTP/2.0"},
+		{disable: true, want: "HTTP/1.1"},
+	} {
+		transport, err := NewHTTPTransport(TransportConfig{InsecureSkipVerify: true, DisableHTTP2: tc.disable})
+		if err != nil {
+			t.Fatalf("NewHTTPTransport failed: %v", err)
+		}
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tc.want {
+			t.Fatalf("DisableHTTP2=%v: server saw %s, want %s", tc.disable, body, tc.want)
+		}
+	}
+}
+
+func TestSignedURLReadsReuseConnections(t *testing.T) {
+	var mu sync.Mutex
+	newConns := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("payload"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			newConns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := NewWorkspaceFilesClientWithDeps(&MockWorkspaceClient{}, &MockAPIClient{}, nil)
+	if client.signedURLClient() != client.signedURLClient() {
+		t.Fatal("expected one signed URL HTTP client per workspace client")
+	}
+	for i := 0; i < 5; i++ {
+		data, err := client.readViaSignedURL(context.Background(), server.URL, nil)
+		if err != nil {
+			t.Fatalf("read %d failed: %v", i, err)
+		}
+		if string(data) != "payload" {
+			t.Fatalf("read %d returned %q", i, data)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if newConns != 1 {
+		t.Fatalf("expected 1 connection for sequential reads, got %d", newConns)
+	}
+}
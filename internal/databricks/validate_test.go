@@ -0,0 +1,57 @@
+package databricks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+)
+
+// countingWorkspace counts API requests so tests can assert that none were
+// made.
+func countingWorkspace(ws *fakeWorkspace, calls *int) *WorkspaceFilesClient {
+	client := ws.client()
+	api := client.apiClient.(*MockAPIClient)
+	do := api.DoFunc
+	api.DoFunc = func(ctx context.Context, method, urlPath string,
+		headers map[string]string, queryParams map[string]any, request, response any,
+		visitors ...func(*http.Request) error) error {
+		*calls++
+		return do(ctx, method, urlPath, headers, queryParams, request, response, visitors...)
+	}
+	return client
+}
+
+func TestInvalidNamesFailBeforeAPICalls(t *testing.T) {
+	ws := newFakeWorkspace()
+	ws.put("/a.txt", workspace.ObjectTypeFile, "", []byte("x"))
+	var calls int
+	client := countingWorkspace(ws, &calls)
+	ctx := context.Background()
+	long := "/" + strings.Repeat("n", 300)
+
+	checks := []struct {
+		op   string
+		err  error
+		want syscall.Errno
+	}{
+		{"Write", client.Write(ctx, long, []byte("x")), syscall.ENAMETOOLONG},
+		{"Mkdir", client.Mkdir(ctx, "/bad\ndir"), syscall.EINVAL},
+		{"Rename", client.Rename(ctx, "/a.txt", "/a\x00.txt"), syscall.EINVAL},
+	}
+	for _, c := range checks {
+		if !errors.Is(c.err, c.want) {
+			t.Fatalf("%s error = %v, want %v", c.op, c.err, c.want)
+		}
+	}
+	if calls != 0 {
+		t.Fatalf("expected no API calls, got %d", calls)
+	}
+	if got := ws.paths(); strings.Join(got, ",") != "/a.txt" {
+		t.Fatalf("workspace objects = %v", got)
+	}
+}
@@ -6,18 +6,80 @@ import (
 	"time"
 )
 
-// WorkspaceFilesAPI defines the minimal surface WSNode needs.
-// It allows swapping in test doubles without touching node logic.
+// WorkspaceFilesAPI is the storage backend contract WSNode depends on.
+// It allows swapping in test doubles and alternative backends (see
+// internal/backend) without touching node logic.
+//
+// Implementations must follow these rules:
+//   - Paths are absolute, slash-separated and already cleaned. Notebook
+//     source paths such as "/dir/nb.py" may be accepted as aliases of the
+//     underlying object; backends without notebooks treat them as files.
+//   - Stat, StatFresh return WSFileInfo and ReadDir returns WSDirEntry
+//     values, so nodes can read object IDs, types and modification times.
+//   - Missing objects are reported with errors wrapping fs.ErrNotExist,
+//     conflicts with fs.ErrExist and denials with fs.ErrPermission. A
+//     syscall.Errno anywhere in the chain is passed to the kernel as is.
+//   - Write creates or fully replaces the object. Mkdir creates parents as
+//     needed and succeeds if the directory exists.
+//   - CacheSet, CacheInvalidate and MetadataTTL describe the backend's own
+//     metadata cache; backends without one may ignore the calls and return
+//     a small positive TTL.
+//   - All methods are safe for concurrent use.
 type WorkspaceFilesAPI interface {
+	// Stat returns metadata for filePath, possibly from cache.
 	Stat(ctx context.Context, filePath string) (fs.FileInfo, error)
+	// StatFresh returns metadata for filePath bypassing any cache.
 	StatFresh(ctx context.Context, filePath string) (fs.FileInfo, error)
+	// ReadDir lists the direct children of dirPath.
 	ReadDir(ctx context.Context, dirPath string) ([]fs.DirEntry, error)
+	// ReadAll returns the full content of filePath.
 	ReadAll(ctx context.Context, filePath string) ([]byte, error)
+	// Write creates or replaces filepath with data.
 	Write(ctx context.Context, filepath string, data []byte) error
+	// Delete removes filePath, and its children when recursive is set.
 	Delete(ctx context.Context, filePath string, recursive bool) error
+	// Mkdir creates dirPath.
 	Mkdir(ctx context.Context, dirPath string) error
+	// Rename moves sourcePath to destinationPath, replacing a file there.
 	Rename(ctx context.Context, sourcePath string, destinationPath string) error
+	// CacheSet seeds the metadata cache after a local mutation.
 	CacheSet(path string, info fs.FileInfo)
+	// CacheInvalidate drops cached metadata for filePath.
 	CacheInvalidate(filePath string)
+	// MetadataTTL is how long nodes may reuse metadata without a recheck.
 	MetadataTTL() time.Duration
 }
+
+// Chunk is a byte range of a file to be rewritten in place.
+type Chunk struct {
+	Offset int64
+	Data   []byte
+}
+
+// ChunkWriter is an optional extension for backends that can patch a file by
+// rewriting individual byte ranges. The workspace import API has no multipart
+// or compose primitive, so WorkspaceFilesClient does not implement it and
+// flushes fall back to whole-file uploads. The local backend implements it.
+type ChunkWriter interface {
+	// WriteChunks rewrites the given ranges and truncates the file to size.
+	WriteChunks(ctx context.Context, filePath string, size int64, chunks []Chunk) error
+}
+
+// ChunkSupporter is implemented by ChunkWriters that pass calls on to other
+// backends, such as a router, and can patch only the paths whose backend is
+// a ChunkWriter.
+type ChunkSupporter interface {
+	SupportsChunks(filePath string) bool
+}
+
+// ChunkWriterFor returns api as a ChunkWriter when it can patch filePath.
+func ChunkWriterFor(api WorkspaceFilesAPI, filePath string) (ChunkWriter, bool) {
+	writer, ok := api.(ChunkWriter)
+	if !ok {
+		return nil, false
+	}
+	if supporter, ok := api.(ChunkSupporter); ok && !supporter.SupportsChunks(filePath) {
+		return nil, false
+	}
+	return writer, true
+}
@@ -0,0 +1,125 @@
+// Package events publishes local changes made through a mount, such as
+// creates, uploads, deletes and renames, to external tools like sync
+// daemons and build watchers so they do not have to poll the mount.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"wsfs/internal/logging"
+	"wsfs/internal/metrics"
+)
+
+// Op is the kind of change an Event reports.
+type Op string
+
+const (
+	OpCreate Op = "create" // a file or directory was created
+	OpWrite  Op = "write"  // new file content was uploaded
+	OpDelete Op = "delete" // a file or directory tree was deleted
+	OpRename Op = "rename" // a file or directory was moved from OldPath to Path
+)
+
+// Event is one local change. Paths are relative to the mount root and use
+// the names the mount shows, such as notebook source names.
+type Event struct {
+	Op      Op        `json:"op"`
+	Path    string    `json:"path"`
+	OldPath string    `json:"old_path,omitempty"`
+	Dir     bool      `json:"dir,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Sink delivers events to one listener. Send is only called from the bus's
+// delivery goroutine.
+type Sink interface {
+	Send(Event) error
+	Close() error
+}
+
+// queueSize bounds the events waiting for delivery. Publishing never blocks
+// a filesystem operation; events beyond the queue are dropped and counted.
+const queueSize = 1024
+
+// Bus fans events out to its sinks in the background, in publish order.
+// A nil *Bus discards events.
+type Bus struct {
+	sinks []Sink
+	queue chan Event
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewBus starts delivering published events to sinks.
+func NewBus(sinks ...Sink) *Bus {
+	b := &Bus{
+		sinks: sinks,
+		queue: make(chan Event, queueSize),
+		done:  make(chan struct{}),
+	}
+	go b.deliver()
+	return b
+}
+
+// Publish queues an event for delivery, stamping it with the current time
+// when it has none.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	select {
+	case b.queue <- e:
+		metrics.EventsPublished.Add(1)
+	default:
+		metrics.EventsDropped.Add(1)
+		logging.Debugf("Event queue full, dropped %s %s", e.Op, e.Path)
+	}
+}
+
+func (b *Bus) deliver() {
+	defer close(b.done)
+	for e := range b.queue {
+		for _, sink := range b.sinks {
+			if err := sink.Send(e); err != nil {
+				metrics.EventsFailed.Add(1)
+				logging.Debugf("Failed to deliver %s %s: %v", e.Op, e.Path, err)
+			}
+		}
+	}
+}
+
+// Close delivers the events already queued and closes the sinks.
+func (b *Bus) Close() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+
+	<-b.done
+	var firstErr error
+	for _, sink := range b.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
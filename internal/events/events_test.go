@@ -0,0 +1,210 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"wsfs/internal/metrics"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+	closed bool
+	block  chan struct{} // when set, Send waits for it to be closed
+}
+
+func (s *recordingSink) Send(e Event) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *recordingSink) ops() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ops []string
+	for _, e := range s.events {
+		ops = append(ops, string(e.Op)+" "+e.Path)
+	}
+	return ops
+}
+
+func TestBusDeliversInOrderAndDrainsOnClose(t *testing.T) {
+	a, b := &recordingSink{}, &recordingSink{}
+	bus := NewBus(a, b)
+	bus.Publish(Event{Op: OpCreate, Path: "/a.txt"})
+	bus.Publish(Event{Op: OpWrite, Path: "/a.txt"})
+	bus.Publish(Event{Op: OpRename, Path: "/b.txt", OldPath: "/a.txt"})
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := []string{"create /a.txt", "write /a.txt", "rename /b.txt"}
+	for _, sink := range []*recordingSink{a, b} {
+		if got := sink.ops(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("delivered %v, want %v", got, want)
+		}
+		if !sink.closed {
+			t.Fatal("sink was not closed")
+		}
+		if sink.events[0].Time.IsZero() {
+			t.Fatal("event was not stamped with a time")
+		}
+	}
+
+	// Publishing after Close is ignored.
+	bus.Publish(Event{Op: OpDelete, Path: "/b.txt"})
+	if err := bus.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestNilBusDiscardsEvents(t *testing.T) {
+	var bus *Bus
+	bus.Publish(Event{Op: OpCreate, Path: "/x"})
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestBusDropsWhenQueueIsFull(t *testing.T) {
+	sink := &recordingSink{block: make(chan struct{})}
+	bus := NewBus(sink)
+	dropped := metrics.EventsDropped.Value()
+
+	// One event is held by the blocked sink, queueSize more fill the queue.
+	for i := 0; i < queueSize+10; i++ {
+		bus.Publish(Event{Op: OpWrite, Path: "/busy"})
+	}
+	if got := metrics.EventsDropped.Value() - dropped; got < 9 {
+		t.Fatalf("dropped %d events, want at least 9", got)
+	}
+	close(sink.block)
+	bus.Close()
+}
+
+func TestWebhookSinkPostsJSON(t *testing.T) {
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if e.Path == "/reject" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		received <- e
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(server.URL + "/hook")
+	if err != nil {
+		t.Fatalf("NewWebhookSink: %v", err)
+	}
+	defer sink.Close()
+	want := Event{Op: OpDelete, Path: "/src", Dir: true, Time: time.Unix(1700000000, 0).UTC()}
+	if err := sink.Send(want); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := <-received; !reflect.DeepEqual(got, want) {
+		t.Fatalf("received %+v, want %+v", got, want)
+	}
+	if err := sink.Send(Event{Op: OpWrite, Path: "/reject"}); err == nil {
+		t.Fatal("expected an error for a 500 response")
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	for _, ok := range []string{"http://127.0.0.1:8080/hook", "https://example.com/wsfs"} {
+		if err := CheckWebhookURL(ok); err != nil {
+			t.Fatalf("CheckWebhookURL(%q) = %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"localhost:8080", "ftp://example.com", "http://", "://x"} {
+		if err := CheckWebhookURL(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSocketSinkStreamsJSONLines(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "events.sock")
+	sink, err := ListenSocket(socketPath)
+	if err != nil {
+		t.Fatalf("ListenSocket: %v", err)
+	}
+	defer sink.Close()
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	// The reader is registered by the accept loop.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sink.mu.Lock()
+		n := len(sink.conns)
+		sink.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("reader was not accepted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := sink.Send(Event{Op: OpCreate, Path: "/new.py"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := sink.Send(Event{Op: OpRename, Path: "/b", OldPath: "/a"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	scanner := bufio.NewScanner(conn)
+	var got []Event
+	for len(got) < 2 && scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("decode %q: %v", scanner.Text(), err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 2 || got[0].Path != "/new.py" || got[1].OldPath != "/a" {
+		t.Fatalf("streamed %+v", got)
+	}
+
+	// Close disconnects readers.
+	sink.Close()
+	if scanner.Scan() {
+		t.Fatalf("unexpected line after Close: %q", scanner.Text())
+	}
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"wsfs/internal/logging"
+	"wsfs/internal/unixsock"
+)
+
+// socketWriteTimeout bounds a write to one reader. A reader that does not
+// keep up is disconnected instead of holding back the others.
+const socketWriteTimeout = time.Second
+
+// SocketSink streams events as JSON lines to every client connected to a
+// unix socket. Clients only read; events published while none is
+// connected are not kept.
+type SocketSink struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// ListenSocket creates the socket at socketPath, usable only by its owner,
+// and accepts readers in the background until Close.
+func ListenSocket(socketPath string) (*SocketSink, error) {
+	listener, err := unixsock.Listen(socketPath)
+	if err != nil {
+		return nil, err
+	}
+	s := &SocketSink{listener: listener, conns: make(map[net.Conn]struct{})}
+	go s.accept()
+	return s, nil
+}
+
+func (s *SocketSink) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logging.Warnf("Event socket stopped: %v", err)
+			}
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+	}
+}
+
+func (s *SocketSink) Send(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+		if _, err := conn.Write(line); err != nil {
+			logging.Debugf("Event socket reader disconnected: %v", err)
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return nil
+}
+
+// Close stops accepting readers, disconnects the current ones and removes
+// the socket.
+func (s *SocketSink) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	return err
+}
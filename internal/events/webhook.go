@@ -0,0 +1,62 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhookTimeout bounds one webhook request so a slow receiver only delays
+// later events, never filesystem operations.
+const webhookTimeout = 5 * time.Second
+
+// WebhookSink POSTs each event as a JSON object to a URL.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a sink posting to rawURL, which must be an http or
+// https URL.
+func NewWebhookSink(rawURL string) (*WebhookSink, error) {
+	if err := CheckWebhookURL(rawURL); err != nil {
+		return nil, err
+	}
+	return &WebhookSink{url: rawURL, client: &http.Client{Timeout: webhookTimeout}}, nil
+}
+
+// CheckWebhookURL reports whether rawURL can be used as a webhook.
+func CheckWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", rawURL)
+	}
+	return nil
+}
+
+func (s *WebhookSink) Send(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s answered %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !faultinject
+
+package faultinject
+
+// buildTagEnabled is false in regular builds, so only WSFS_FAULTS enables
+// injection.
+const buildTagEnabled = false
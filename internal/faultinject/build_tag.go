@@ -0,0 +1,6 @@
+//go:build faultinject
+
+package faultinject
+
+// buildTagEnabled turns on ChaosConfig when WSFS_FAULTS is unset.
+const buildTagEnabled = true
@@ -0,0 +1,264 @@
+// Package faultinject injects latency and failures into backend traffic so
+// tests and chaos runs can check that wsfs degrades gracefully.
+//
+// Injection is off unless WSFS_FAULTS is set, or the binary is built with the
+// faultinject build tag, which turns on a default chaos profile.
+package faultinject
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/apierr"
+
+	"wsfs/internal/metrics"
+)
+
+// EnvVar holds the fault specification, e.g.
+// "latency=50ms,429=0.1,500=0.05,partial=0.1,signed_url=0.2,seed=1".
+const EnvVar = "WSFS_FAULTS"
+
+// Kind identifies an injected fault.
+type Kind int
+
+const (
+	// TooManyRequests fails a call with HTTP 429.
+	TooManyRequests Kind = iota
+	// ServerError fails a call with HTTP 500.
+	ServerError
+	// PartialRead cuts a read short with io.ErrUnexpectedEOF.
+	PartialRead
+	// SignedURL fails a signed URL transfer with HTTP 403, as if the URL expired.
+	SignedURL
+	numKinds
+)
+
+var kinds = []Kind{TooManyRequests, ServerError, PartialRead, SignedURL}
+
+func (k Kind) String() string {
+	switch k {
+	case TooManyRequests:
+		return "429"
+	case ServerError:
+		return "500"
+	case PartialRead:
+		return "partial"
+	case SignedURL:
+		return "signed_url"
+	default:
+		return "unknown"
+	}
+}
+
+// Config sets the injected latency and the probability (0 to 1) of each fault.
+type Config struct {
+	Latency time.Duration
+	Rates   map[Kind]float64
+	Seed    int64
+}
+
+// ChaosConfig is the profile used by builds with the faultinject tag when
+// WSFS_FAULTS is unset.
+var ChaosConfig = Config{
+	Latency: 20 * time.Millisecond,
+	Rates: map[Kind]float64{
+		TooManyRequests: 0.05,
+		ServerError:     0.05,
+		PartialRead:     0.05,
+		SignedURL:       0.2,
+	},
+}
+
+// ParseConfig parses a comma-separated list of key=value pairs. Keys are
+// latency, seed and the fault kinds (429, 500, partial, signed_url).
+func ParseConfig(spec string) (Config, error) {
+	cfg := Config{Rates: make(map[Kind]float64)}
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Config{}, fmt.Errorf("expected key=value, got %q", field)
+		}
+		switch key {
+		case "latency":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return Config{}, fmt.Errorf("invalid latency %q", value)
+			}
+			cfg.Latency = d
+		case "seed":
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid seed %q", value)
+			}
+			cfg.Seed = seed
+		default:
+			kind, ok := parseKind(key)
+			if !ok {
+				return Config{}, fmt.Errorf("unknown fault %q", key)
+			}
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil || rate < 0 || rate > 1 {
+				return Config{}, fmt.Errorf("invalid rate %q for %s (want 0..1)", value, key)
+			}
+			cfg.Rates[kind] = rate
+		}
+	}
+	return cfg, nil
+}
+
+func parseKind(name string) (Kind, bool) {
+	for _, k := range kinds {
+		if k.String() == name {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+func (c Config) String() string {
+	parts := []string{"latency=" + c.Latency.String()}
+	for _, k := range kinds {
+		if c.Rates[k] > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%g", k, c.Rates[k]))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// FromEnv returns an injector configured from WSFS_FAULTS, the chaos profile
+// for faultinject builds, or nil when injection is off.
+func FromEnv() (*Injector, error) {
+	spec, ok := os.LookupEnv(EnvVar)
+	if !ok {
+		if !buildTagEnabled {
+			return nil, nil
+		}
+		return New(ChaosConfig), nil
+	}
+	cfg, err := ParseConfig(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", EnvVar, err)
+	}
+	return New(cfg), nil
+}
+
+// Injector decides which calls fail. It is safe for concurrent use.
+type Injector struct {
+	mu     sync.Mutex
+	cfg    Config
+	rng    *rand.Rand
+	counts [numKinds]atomic.Int64
+}
+
+// New returns an injector for cfg. The same seed yields the same decisions
+// for the same sequence of calls.
+func New(cfg Config) *Injector {
+	return &Injector{cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// Set replaces the configuration, e.g. to stop injecting faults mid-test.
+// The random sequence continues where it was.
+func (i *Injector) Set(cfg Config) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.cfg = cfg
+}
+
+// Config returns the current configuration.
+func (i *Injector) Config() Config {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.cfg
+}
+
+// Count returns how many faults of kind have been injected.
+func (i *Injector) Count(kind Kind) int64 {
+	return i.counts[kind].Load()
+}
+
+// Should reports whether a fault of kind fires now and counts it if so.
+func (i *Injector) Should(kind Kind) bool {
+	i.mu.Lock()
+	rate := i.cfg.Rates[kind]
+	fire := rate > 0 && i.rng.Float64() < rate
+	i.mu.Unlock()
+	if fire {
+		i.counts[kind].Add(1)
+		metrics.FaultsInjected.Add(1)
+	}
+	return fire
+}
+
+// Delay waits for the configured latency, returning early with the context
+// error if ctx is done.
+func (i *Injector) Delay(ctx context.Context) error {
+	latency := i.Config().Latency
+	if latency <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// CallError returns an injected 429 or 500 API error, or nil when the call
+// should go through.
+func (i *Injector) CallError() error {
+	status := i.callStatus()
+	if status == 0 {
+		return nil
+	}
+	return &apierr.APIError{
+		ErrorCode:  errorCode(status),
+		StatusCode: status,
+		Message:    "injected fault",
+	}
+}
+
+// callStatus returns the HTTP status of an injected 429 or 500, or 0.
+func (i *Injector) callStatus() int {
+	switch {
+	case i.Should(TooManyRequests):
+		return http.StatusTooManyRequests
+	case i.Should(ServerError):
+		return http.StatusInternalServerError
+	}
+	return 0
+}
+
+func errorCode(status int) string {
+	if status == http.StatusTooManyRequests {
+		return "TOO_MANY_REQUESTS"
+	}
+	return "INTERNAL_ERROR"
+}
+
+type signedURLKey struct{}
+
+// WithSignedURL marks ctx as carrying a signed URL transfer, which the
+// transport may fail with a SignedURL fault.
+func WithSignedURL(ctx context.Context) context.Context {
+	return context.WithValue(ctx, signedURLKey{}, true)
+}
+
+func isSignedURL(ctx context.Context) bool {
+	marked, _ := ctx.Value(signedURLKey{}).(bool)
+	return marked
+}
@@ -0,0 +1,181 @@
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/apierr"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig("latency=50ms, 429=0.1,500=0.05,partial=1,signed_url=0,seed=7")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if cfg.Latency != 50*time.Millisecond || cfg.Seed != 7 {
+		t.Fatalf("unexpected latency/seed: %+v", cfg)
+	}
+	want := map[Kind]float64{TooManyRequests: 0.1, ServerError: 0.05, PartialRead: 1, SignedURL: 0}
+	if !reflect.DeepEqual(cfg.Rates, want) {
+		t.Fatalf("unexpected rates: %v", cfg.Rates)
+	}
+	if got := cfg.String(); got != "latency=50ms,429=0.1,500=0.05,partial=1" {
+		t.Fatalf("unexpected String: %q", got)
+	}
+
+	for _, spec := range []string{"429", "404=0.1", "500=2", "partial=-1", "latency=fast", "seed=x"} {
+		if _, err := ParseConfig(spec); err == nil {
+			t.Fatalf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(EnvVar, "500=1")
+	injector, err := FromEnv()
+	if err != nil || injector == nil {
+		t.Fatalf("FromEnv: %v, %v", injector, err)
+	}
+	if injector.Config().Rates[ServerError] != 1 {
+		t.Fatalf("unexpected config: %+v", injector.Config())
+	}
+
+	t.Setenv(EnvVar, "bogus")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected invalid WSFS_FAULTS to fail")
+	}
+}
+
+func TestFromEnvUnset(t *testing.T) {
+	t.Setenv(EnvVar, "")
+	os.Unsetenv(EnvVar)
+	injector, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if !buildTagEnabled {
+		if injector != nil {
+			t.Fatalf("expected injection off without %s, got %+v", EnvVar, injector.Config())
+		}
+		return
+	}
+	if injector == nil || !reflect.DeepEqual(injector.Config(), ChaosConfig) {
+		t.Fatalf("expected the chaos profile in faultinject builds, got %v", injector)
+	}
+}
+
+func TestShouldIsDeterministicPerSeed(t *testing.T) {
+	cfg := Config{Rates: map[Kind]float64{ServerError: 0.5}, Seed: 42}
+	a, b := New(cfg), New(cfg)
+	for i := 0; i < 100; i++ {
+		if a.Should(ServerError) != b.Should(ServerError) {
+			t.Fatalf("decision %d differs for the same seed", i)
+		}
+	}
+	if a.Count(ServerError) == 0 || a.Count(ServerError) == 100 {
+		t.Fatalf("expected some but not all faults at rate 0.5, got %d", a.Count(ServerError))
+	}
+	if a.Count(TooManyRequests) != 0 || a.Should(TooManyRequests) {
+		t.Fatal("zero rate must never fire")
+	}
+}
+
+func TestCallErrorAndSet(t *testing.T) {
+	injector := New(Config{Rates: map[Kind]float64{TooManyRequests: 1}})
+	var apiErr *apierr.APIError
+	if err := injector.CallError(); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected injected 429, got %v", err)
+	}
+
+	injector.Set(Config{})
+	if err := injector.CallError(); err != nil {
+		t.Fatalf("expected no fault after Set, got %v", err)
+	}
+}
+
+func TestDelayHonorsContext(t *testing.T) {
+	injector := New(Config{Latency: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := injector.Delay(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func newTestServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func doGet(t *testing.T, ctx context.Context, transport http.RoundTripper, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return (&http.Client{Transport: transport}).Do(req)
+}
+
+func TestTransportInjectsStatusErrors(t *testing.T) {
+	server := newTestServer(t, "ok")
+	injector := New(Config{Rates: map[Kind]float64{ServerError: 1}})
+
+	resp, err := doGet(t, context.Background(), NewTransport(nil, injector), server.URL)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != `{"error_code":"INTERNAL_ERROR","message":"injected fault"}` {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestTransportSignedURLFaultsOnlyHitMarkedRequests(t *testing.T) {
+	server := newTestServer(t, "ok")
+	transport := NewTransport(nil, New(Config{Rates: map[Kind]float64{SignedURL: 1}}))
+
+	resp, err := doGet(t, context.Background(), transport, server.URL)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unmarked request should pass, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	resp, err = doGet(t, WithSignedURL(context.Background()), transport, server.URL)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for signed URL, got %d", resp.StatusCode)
+	}
+}
+
+func TestTransportPartialRead(t *testing.T) {
+	server := newTestServer(t, "0123456789")
+	transport := NewTransport(nil, New(Config{Rates: map[Kind]float64{PartialRead: 1}}))
+
+	resp, err := doGet(t, context.Background(), transport, server.URL)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if len(data) >= 10 {
+		t.Fatalf("expected a short read, got %q", data)
+	}
+}
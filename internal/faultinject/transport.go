@@ -0,0 +1,112 @@
+package faultinject
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// Transport is an http.RoundTripper that injects faults before and after
+// the real round trip. Install it as the Databricks SDK HTTPTransport so
+// injected 429s and 500s go through the SDK's own retry logic.
+type Transport struct {
+	Base     http.RoundTripper
+	Injector *Injector
+}
+
+// NewTransport wraps base, or http.DefaultTransport when base is nil.
+func NewTransport(base http.RoundTripper, injector *Injector) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base, Injector: injector}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.Injector.Delay(req.Context()); err != nil {
+		return nil, err
+	}
+
+	if isSignedURL(req.Context()) && t.Injector.Should(SignedURL) {
+		return injectedResponse(req, http.StatusForbidden, "AccessDenied", "injected signed URL failure"), nil
+	}
+	if status := t.Injector.callStatus(); status != 0 {
+		return injectedResponse(req, status, errorCode(status), "injected fault"), nil
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Method == http.MethodGet && resp.StatusCode == http.StatusOK && t.Injector.Should(PartialRead) {
+		resp.Body = newPartialBody(resp.Body, resp.ContentLength)
+	}
+	return resp, nil
+}
+
+// injectedResponse builds an error response shaped like a Databricks API error.
+func injectedResponse(req *http.Request, status int, code, message string) *http.Response {
+	body, _ := json.Marshal(map[string]string{"error_code": code, "message": message})
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	if status == http.StatusTooManyRequests {
+		header.Set("Retry-After", "1")
+	}
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// partialBody returns the first half of the body and then
+// io.ErrUnexpectedEOF, like a connection dropped mid-transfer. Without a
+// known length it cuts the first read in half instead.
+type partialBody struct {
+	body      io.ReadCloser
+	remaining int64 // bytes left before the cut, -1 if the length is unknown
+}
+
+func newPartialBody(body io.ReadCloser, contentLength int64) *partialBody {
+	remaining := int64(-1)
+	if contentLength >= 0 {
+		remaining = contentLength / 2
+	}
+	return &partialBody{body: body, remaining: remaining}
+}
+
+func (b *partialBody) Read(p []byte) (int, error) {
+	switch {
+	case b.remaining == 0:
+		return 0, io.ErrUnexpectedEOF
+	case b.remaining < 0:
+		p = p[:(len(p)+1)/2]
+		b.remaining = 0
+	case int64(len(p)) > b.remaining:
+		p = p[:b.remaining]
+	}
+
+	n, err := b.body.Read(p)
+	if b.remaining > 0 {
+		b.remaining -= int64(n)
+	}
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	if err == io.EOF || b.remaining == 0 {
+		b.remaining = 0
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
+
+func (b *partialBody) Close() error {
+	return b.body.Close()
+}
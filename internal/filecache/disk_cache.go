@@ -5,10 +5,14 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,7 +23,24 @@ type Entry struct {
 	Size       int64
 	ModTime    time.Time
 	AccessTime time.Time
-	Checksum   string // SHA256 hex string for integrity verification
+	FetchTime  time.Time // when the content was stored; see TTLAbsolute
+	Checksum   string    // SHA256 hex string for integrity verification
+	Export     bool      // content produced by an export, see SetExport
+	Pinned     bool      // exempt from LRU and TTL eviction, see Pin
+	Generation uint64    // numbers the file of each stored version; 0 before generations
+
+	// previous is the file of the version this entry replaced. It is kept
+	// until the entry is replaced again or removed, so a reader that got
+	// its path from Get still reads the version it started on.
+	previous string
+}
+
+// removeFiles removes the files of the entry. Best effort.
+func (e *Entry) removeFiles() {
+	os.Remove(e.LocalPath)
+	if e.previous != "" {
+		os.Remove(e.previous)
+	}
 }
 
 // CalculateChecksum computes SHA256 checksum of data and returns hex string.
@@ -49,10 +70,25 @@ type DiskCache struct {
 	cacheDir     string
 	maxSizeBytes int64
 	ttl          time.Duration
+	ttlPolicy    TTLPolicy
 	entries      map[string]*Entry // remotePath -> Entry
 	totalSize    int64
 	mu           sync.RWMutex
 	disabled     bool
+
+	// fileMu is held shared while a cache file is written and registered,
+	// and exclusively by Reconcile, so it never sees a new file before its
+	// entry.
+	fileMu sync.RWMutex
+
+	excludePatterns []string // lower-cased; see SetExcludePatterns
+	quotas          []Quota  // longest prefix first; see SetQuotas
+
+	pins        map[string]struct{}          // see Pin
+	pinRule     func(remotePath string) bool // see SetPinRule
+	pinMaxBytes int64
+
+	generation atomic.Uint64 // last generation handed out; see Entry.Generation
 }
 
 const (
@@ -60,6 +96,35 @@ const (
 	DefaultTTL                = 7 * 24 * time.Hour
 )
 
+// TTLPolicy selects what the TTL of an entry is counted from.
+type TTLPolicy int
+
+const (
+	// TTLIdle counts from the last hit, so entries in use never expire.
+	TTLIdle TTLPolicy = iota
+	// TTLAbsolute counts from when the content was stored, so every entry
+	// is fetched again after at most one TTL, however often it is read.
+	TTLAbsolute
+)
+
+// ParseTTLPolicy parses idle or absolute.
+func ParseTTLPolicy(value string) (TTLPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "idle", "":
+		return TTLIdle, nil
+	case "absolute":
+		return TTLAbsolute, nil
+	}
+	return TTLIdle, fmt.Errorf("%q (want idle or absolute)", value)
+}
+
+func (p TTLPolicy) String() string {
+	if p == TTLAbsolute {
+		return "absolute"
+	}
+	return "idle"
+}
+
 func resolveDefaultCacheDir(userCacheDir string, userCacheErr error, homeDir string, homeErr error) (string, error) {
 	if userCacheErr == nil && userCacheDir != "" {
 		return filepath.Join(userCacheDir, "wsfs"), nil
@@ -108,6 +173,8 @@ func NewDiskCache(cacheDir string, maxSizeBytes int64, ttl time.Duration) (*Disk
 		ttl:          ttl,
 		entries:      make(map[string]*Entry),
 		totalSize:    0,
+		pins:         make(map[string]struct{}),
+		pinMaxBytes:  DefaultPinMaxBytes,
 	}
 
 	// Load existing cache entries from disk
@@ -124,9 +191,18 @@ func NewDisabledCache() *DiskCache {
 	return &DiskCache{
 		disabled: true,
 		entries:  make(map[string]*Entry),
+		pins:     make(map[string]struct{}),
 	}
 }
 
+// SetTTLPolicy sets what the TTL is counted from, for the entries already
+// cached as well. The default is TTLIdle.
+func (c *DiskCache) SetTTLPolicy(policy TTLPolicy) {
+	c.mu.Lock()
+	c.ttlPolicy = policy
+	c.mu.Unlock()
+}
+
 // IsDisabled returns true if cache is disabled
 func (c *DiskCache) IsDisabled() bool {
 	return c.disabled
@@ -140,7 +216,7 @@ func (c *DiskCache) CacheDir() string {
 // Returns localPath, checksum, and true if cache hit; empty strings and false if cache miss
 // remoteModTime is used to validate cache freshness
 func (c *DiskCache) Get(remotePath string, remoteModTime time.Time) (localPath string, checksum string, found bool) {
-	if c.disabled {
+	if c.disabled || c.Excludes(remotePath) {
 		return "", "", false
 	}
 
@@ -152,14 +228,20 @@ func (c *DiskCache) Get(remotePath string, remoteModTime time.Time) (localPath s
 		return "", "", false
 	}
 
-	// Check TTL
-	if time.Since(entry.AccessTime) > c.ttl {
+	// Check TTL; pinned entries do not expire
+	c.mu.RLock()
+	expired := c.expired(entry, time.Now())
+	c.mu.RUnlock()
+	if expired {
 		c.Delete(remotePath)
 		return "", "", false
 	}
 
-	// Check if remote file was modified
-	if !remoteModTime.IsZero() && remoteModTime.After(entry.ModTime) {
+	// Check if remote file was modified. Modification times are version
+	// stamps from the server (in milliseconds), so any difference means
+	// another version; an ordering comparison would trust clocks that may be
+	// skewed.
+	if !remoteModTime.IsZero() && !sameVersion(remoteModTime, entry.ModTime) {
 		c.Delete(remotePath)
 		return "", "", false
 	}
@@ -170,7 +252,7 @@ func (c *DiskCache) Get(remotePath string, remoteModTime time.Time) (localPath s
 		return "", "", false
 	}
 
-	// Update access time
+	// Update access time. Under TTLIdle this also restarts the TTL.
 	c.mu.Lock()
 	entry.AccessTime = time.Now()
 	c.mu.Unlock()
@@ -182,22 +264,42 @@ func (c *DiskCache) Get(remotePath string, remoteModTime time.Time) (localPath s
 // data is the file content to cache
 // remoteModTime is the modification time from remote
 func (c *DiskCache) Set(remotePath string, data []byte, remoteModTime time.Time) (string, error) {
+	return c.set(remotePath, data, remoteModTime, false)
+}
+
+// SetExport stores content that is costly to produce again, such as the
+// exported source of a notebook, which the workspace renders on every
+// export. LRU eviction drops such entries only when no other entry is left
+// to evict. The TTL and version checks apply as for Set.
+func (c *DiskCache) SetExport(remotePath string, data []byte, remoteModTime time.Time) (string, error) {
+	return c.set(remotePath, data, remoteModTime, true)
+}
+
+func (c *DiskCache) set(remotePath string, data []byte, remoteModTime time.Time, export bool) (string, error) {
 	if c.disabled {
 		return "", fmt.Errorf("cache is disabled")
 	}
+	if c.Excludes(remotePath) {
+		return "", fmt.Errorf("%s: %w", remotePath, ErrExcluded)
+	}
+	c.fileMu.RLock()
+	defer c.fileMu.RUnlock()
 
 	size := int64(len(data))
 
 	// Check if we need to evict entries
-	if err := c.evictIfNeeded(size); err != nil {
+	if err := c.evictIfNeeded(remotePath, size); err != nil {
 		return "", fmt.Errorf("failed to evict entries: %w", err)
 	}
 
-	// Generate local path
-	localPath := c.generateLocalPath(remotePath)
-
-	// Write data to disk with restricted permissions (owner only)
-	if err := os.WriteFile(localPath, data, 0600); err != nil {
+	// Each version gets a file of its own, so a reader of the previous
+	// version never sees this one being written.
+	generation := c.generation.Add(1)
+	localPath := c.generateLocalPath(remotePath, generation)
+	if err := writeCacheFile(localPath, func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	}); err != nil {
 		return "", fmt.Errorf("failed to write cache file: %w", err)
 	}
 
@@ -212,25 +314,60 @@ func (c *DiskCache) Set(remotePath string, data []byte, remoteModTime time.Time)
 		Size:       size,
 		ModTime:    remoteModTime,
 		AccessTime: now,
+		FetchTime:  now,
 		Checksum:   checksum,
+		Export:     export,
+		Generation: generation,
 	}
 
 	c.mu.Lock()
-	// Remove old entry if exists
-	if oldEntry, exists := c.entries[remotePath]; exists {
-		c.totalSize -= oldEntry.Size
-		// Only remove file if it's different from the new path
-		if oldEntry.LocalPath != localPath {
-			os.Remove(oldEntry.LocalPath) // Best effort cleanup
-		}
-	}
-	c.entries[remotePath] = entry
-	c.totalSize += size
+	c.addEntryLocked(entry)
 	c.mu.Unlock()
 
 	return localPath, nil
 }
 
+// UpdateModTime re-stamps the entry for remotePath from one modification
+// time to another without touching its content. It is used when the server
+// reports the version of content that was cached before the server's
+// modification time was known, such as right after an upload. It reports
+// whether an entry stamped with from was found.
+func (c *DiskCache) UpdateModTime(remotePath string, from, to time.Time) bool {
+	if c.disabled {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[remotePath]
+	if !ok || !sameVersion(entry.ModTime, from) {
+		return false
+	}
+	entry.ModTime = to
+	return true
+}
+
+// CachedSize returns the size of the cached content of remotePath at
+// version remoteModTime. Unlike Get it does not touch the entry, so it can
+// answer stat calls without keeping entries alive.
+func (c *DiskCache) CachedSize(remotePath string, remoteModTime time.Time) (int64, bool) {
+	if c.disabled {
+		return 0, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[remotePath]
+	if !ok || !sameVersion(entry.ModTime, remoteModTime) {
+		return 0, false
+	}
+	return entry.Size, true
+}
+
+// sameVersion compares modification times at the millisecond precision the
+// workspace API reports.
+func sameVersion(a, b time.Time) bool {
+	return a.UnixMilli() == b.UnixMilli()
+}
+
 // Delete removes a file from the cache
 func (c *DiskCache) Delete(remotePath string) error {
 	if c.disabled {
@@ -246,7 +383,7 @@ func (c *DiskCache) Delete(remotePath string) error {
 	}
 
 	// Remove file
-	os.Remove(entry.LocalPath) // Best effort
+	entry.removeFiles()
 
 	// Remove entry
 	delete(c.entries, remotePath)
@@ -255,6 +392,104 @@ func (c *DiskCache) Delete(remotePath string) error {
 	return nil
 }
 
+// DeleteVersion removes the entry for remotePath if it still holds the
+// version stamped remoteModTime, and reports whether it did. A newer
+// version cached meanwhile is kept.
+func (c *DiskCache) DeleteVersion(remotePath string, remoteModTime time.Time) bool {
+	if c.disabled {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.entries[remotePath]
+	if !found || !sameVersion(entry.ModTime, remoteModTime) {
+		return false
+	}
+	entry.removeFiles()
+	delete(c.entries, remotePath)
+	c.totalSize -= entry.Size
+	return true
+}
+
+// DeleteFile removes the entry for remotePath if it is still stored in
+// localPath, and reports whether it did. A reader that finds its file
+// broken drops that generation only, not a newer one cached meanwhile.
+func (c *DiskCache) DeleteFile(remotePath, localPath string) bool {
+	if c.disabled {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.entries[remotePath]
+	if !found || entry.LocalPath != localPath {
+		return false
+	}
+	entry.removeFiles()
+	delete(c.entries, remotePath)
+	c.totalSize -= entry.Size
+	return true
+}
+
+// Rename moves the entries of oldPrefix and of the paths below it to the
+// same paths below newPrefix, after a rename in the workspace, and returns
+// how many it kept. Their files are renamed to the names of the new paths,
+// so the index still matches them after a restart. Entries replaced at the
+// new paths and entries the new paths exclude are removed.
+func (c *DiskCache) Rename(oldPrefix, newPrefix string) int {
+	if c.disabled || oldPrefix == newPrefix {
+		return 0
+	}
+	c.fileMu.RLock()
+	defer c.fileMu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var moved []*Entry
+	for remotePath, entry := range c.entries {
+		if remotePath == oldPrefix || strings.HasPrefix(remotePath, oldPrefix+"/") {
+			moved = append(moved, entry)
+			delete(c.entries, remotePath)
+			c.totalSize -= entry.Size
+		}
+	}
+	kept := 0
+	for _, entry := range moved {
+		newPath := newPrefix + strings.TrimPrefix(entry.RemotePath, oldPrefix)
+		if entry.previous != "" {
+			os.Remove(entry.previous) // Best effort cleanup
+			entry.previous = ""
+		}
+		if c.excludesLocked(newPath) {
+			entry.removeFiles()
+			continue
+		}
+		localPath := c.generateLocalPath(newPath, entry.Generation)
+		if err := os.MkdirAll(filepath.Dir(localPath), 0700); err != nil {
+			entry.removeFiles()
+			continue
+		}
+		if err := os.Rename(entry.LocalPath, localPath); err != nil {
+			entry.removeFiles()
+			continue
+		}
+		if old, ok := c.entries[newPath]; ok {
+			old.removeFiles()
+			c.totalSize -= old.Size
+		}
+		entry.RemotePath = newPath
+		entry.LocalPath = localPath
+		entry.Pinned = c.isPinnedLocked(newPath)
+		c.entries[newPath] = entry
+		c.totalSize += entry.Size
+		kept++
+	}
+	return kept
+}
+
 // Clear removes all cached files
 func (c *DiskCache) Clear() error {
 	if c.disabled {
@@ -266,7 +501,7 @@ func (c *DiskCache) Clear() error {
 
 	// Remove all files
 	for _, entry := range c.entries {
-		os.Remove(entry.LocalPath) // Best effort
+		entry.removeFiles()
 	}
 
 	// Clear entries
@@ -276,6 +511,29 @@ func (c *DiskCache) Clear() error {
 	return nil
 }
 
+// Sample returns copies of up to count entries chosen at random, for
+// audits that cannot afford to check every entry.
+func (c *DiskCache) Sample(count int) []Entry {
+	if c.disabled || count <= 0 {
+		return nil
+	}
+
+	c.mu.RLock()
+	entries := make([]Entry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, *entry)
+	}
+	c.mu.RUnlock()
+
+	rand.Shuffle(len(entries), func(i, j int) {
+		entries[i], entries[j] = entries[j], entries[i]
+	})
+	if len(entries) > count {
+		entries = entries[:count]
+	}
+	return entries
+}
+
 // GetStats returns cache statistics
 func (c *DiskCache) GetStats() (numEntries int, totalSize int64) {
 	if c.disabled {
@@ -289,28 +547,61 @@ func (c *DiskCache) GetStats() (numEntries int, totalSize int64) {
 }
 
 // evictIfNeeded evicts entries if necessary to make room for newSize bytes
-func (c *DiskCache) evictIfNeeded(newSize int64) error {
+// of remotePath, within its quota and within the overall limit
+func (c *DiskCache) evictIfNeeded(remotePath string, newSize int64) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	// First, evict expired entries
 	c.evictExpiredLocked()
 
-	// If still over capacity, evict by LRU
-	for c.totalSize+newSize > c.maxSizeBytes && len(c.entries) > 0 {
-		if err := c.evictLRULocked(); err != nil {
+	// Pinned content only has to fit in the pin budget, and evicts nothing.
+	if c.isPinnedLocked(remotePath) {
+		return c.admitPinnedLocked(remotePath, newSize)
+	}
+
+	// Then make room within the quota of the tree, if any. Content larger
+	// than the quota is refused without evicting the rest of the tree.
+	if q := c.quotaForLocked(remotePath); q != nil {
+		if newSize > q.MaxBytes {
+			return fmt.Errorf("cannot fit %d bytes in the quota for %s (max: %d)", newSize, q.Prefix, q.MaxBytes)
+		}
+		if err := c.evictQuotaLocked(q, newSize); err != nil {
 			return err
 		}
 	}
 
+	// If still over capacity, evict by LRU. Pinned bytes count against the
+	// pin budget, not against the limit.
+	pinned := c.pinnedBytesLocked()
+	for c.totalSize-pinned+newSize > c.maxSizeBytes {
+		if err := c.evictLRULocked(); err != nil {
+			break
+		}
+	}
+
 	// If still can't fit, return error
-	if c.totalSize+newSize > c.maxSizeBytes {
-		return fmt.Errorf("cache full: cannot fit %d bytes (current: %d, max: %d)", newSize, c.totalSize, c.maxSizeBytes)
+	if c.totalSize-pinned+newSize > c.maxSizeBytes {
+		return fmt.Errorf("cache full: cannot fit %d bytes (current: %d, max: %d)", newSize, c.totalSize-pinned, c.maxSizeBytes)
 	}
 
 	return nil
 }
 
+// expired reports whether entry has exceeded TTL, counted as the policy
+// says. Pinned entries never do.
+// Must be called with lock held
+func (c *DiskCache) expired(entry *Entry, now time.Time) bool {
+	if entry.Pinned {
+		return false
+	}
+	since := entry.AccessTime
+	if c.ttlPolicy == TTLAbsolute && !entry.FetchTime.IsZero() {
+		since = entry.FetchTime
+	}
+	return now.Sub(since) > c.ttl
+}
+
 // evictExpiredLocked removes entries that have exceeded TTL
 // Must be called with lock held
 func (c *DiskCache) evictExpiredLocked() {
@@ -318,95 +609,105 @@ func (c *DiskCache) evictExpiredLocked() {
 	var toDelete []string
 
 	for path, entry := range c.entries {
-		if now.Sub(entry.AccessTime) > c.ttl {
+		if c.expired(entry, now) {
 			toDelete = append(toDelete, path)
 		}
 	}
 
 	for _, path := range toDelete {
 		entry := c.entries[path]
-		os.Remove(entry.LocalPath) // Best effort
+		entry.removeFiles()
 		delete(c.entries, path)
 		c.totalSize -= entry.Size
 	}
 }
 
-// evictLRULocked removes the least recently used entry
+// evictLRULocked removes the least recently used entry that is not pinned,
+// preferring entries not stored with SetExport
 // Must be called with lock held
 func (c *DiskCache) evictLRULocked() error {
-	if len(c.entries) == 0 {
-		return fmt.Errorf("no entries to evict")
-	}
-
 	// Find LRU entry
 	var oldestPath string
-	var oldestTime time.Time
-	first := true
+	var oldest *Entry
 
 	for path, entry := range c.entries {
-		if first || entry.AccessTime.Before(oldestTime) {
+		if entry.Pinned {
+			continue
+		}
+		if oldest == nil || evictsBefore(entry, oldest) {
 			oldestPath = path
-			oldestTime = entry.AccessTime
-			first = false
+			oldest = entry
 		}
 	}
+	if oldest == nil {
+		return fmt.Errorf("no entries to evict")
+	}
 
 	// Remove oldest entry
 	entry := c.entries[oldestPath]
-	os.Remove(entry.LocalPath) // Best effort
+	entry.removeFiles()
 	delete(c.entries, oldestPath)
 	c.totalSize -= entry.Size
 
 	return nil
 }
 
+// evictsBefore reports whether a is evicted before b.
+func evictsBefore(a, b *Entry) bool {
+	if a.Export != b.Export {
+		return !a.Export
+	}
+	return a.AccessTime.Before(b.AccessTime)
+}
+
 // generateLocalPath generates a local file path for a remote path
-func (c *DiskCache) generateLocalPath(remotePath string) string {
+// The files are sharded into two levels of subdirectories named by the
+// first two bytes of the hash (ab/cd/abcd...), so no directory grows to
+// hundreds of thousands of entries. Each generation has its own file,
+// named by the hash and the generation (abcd....7); generation 0 is the
+// unversioned name of entries cached before generations.
+func (c *DiskCache) generateLocalPath(remotePath string, generation uint64) string {
 	// Use SHA256 hash to avoid path length issues and collisions
 	hash := sha256.Sum256([]byte(remotePath))
 	hashStr := hex.EncodeToString(hash[:])
-	return filepath.Join(c.cacheDir, hashStr)
-}
-
-// loadExistingEntries scans the cache directory and removes orphaned files
-// Since we can't recover remotePath from the SHA256 hash filename, we delete
-// all existing cache files on startup to ensure totalSize and entries map
-// stay consistent.
-func (c *DiskCache) loadExistingEntries() error {
-	entries, err := os.ReadDir(c.cacheDir)
-	if err != nil {
-		return err
+	name := hashStr
+	if generation > 0 {
+		name += "." + strconv.FormatUint(generation, 10)
 	}
+	return filepath.Join(c.cacheDir, hashStr[:2], hashStr[2:4], name)
+}
 
-	var cleanedCount int
-	var cleanedSize int64
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+// addEntryLocked registers entry, replacing the entry of its remote path.
+// The replaced file stays as entry.previous; the one before it goes.
+// Must be called with lock held
+func (c *DiskCache) addEntryLocked(entry *Entry) {
+	entry.Pinned = c.isPinnedLocked(entry.RemotePath)
+	if old, exists := c.entries[entry.RemotePath]; exists {
+		c.totalSize -= old.Size
+		if old.previous != "" && old.previous != entry.LocalPath {
+			os.Remove(old.previous) // Best effort cleanup
 		}
-
-		fullPath := filepath.Join(c.cacheDir, entry.Name())
-		info, err := entry.Info()
-		if err != nil {
-			os.Remove(fullPath)
-			cleanedCount++
-			continue
+		if old.LocalPath != entry.LocalPath {
+			entry.previous = old.LocalPath
 		}
-
-		// We can't recover remotePath from hash, so delete orphaned files
-		// This ensures totalSize and entries map stay consistent
-		cleanedSize += info.Size()
-		os.Remove(fullPath)
-		cleanedCount++
 	}
+	c.entries[entry.RemotePath] = entry
+	c.totalSize += entry.Size
+}
 
-	if cleanedCount > 0 {
-		fmt.Fprintf(os.Stderr, "Cache cleanup: removed %d orphaned files (%.2f MB)\n",
-			cleanedCount, float64(cleanedSize)/(1024*1024))
+// loadExistingEntries loads the index saved by an earlier process and
+// reconciles it with the cache directory. Files the index does not list,
+// such as those of a process that exited without saving it, are removed,
+// since their remote path cannot be recovered from the hashed name.
+func (c *DiskCache) loadExistingEntries() error {
+	if err := c.loadIndex(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring cache index: %v\n", err)
 	}
-
-	return nil
+	result, err := c.Reconcile()
+	if !result.Empty() {
+		fmt.Fprintf(os.Stderr, "Cache cleanup: %s\n", result)
+	}
+	return err
 }
 
 func copyFileToLocalCache(srcPath string, localPath string, checksumFn func(string) (string, error)) (string, error) {
@@ -416,20 +717,12 @@ func copyFileToLocalCache(srcPath string, localPath string, checksumFn func(stri
 	}
 	defer src.Close()
 
-	dst, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		return "", fmt.Errorf("failed to create cache file: %w", err)
-	}
-
-	if _, err := io.Copy(dst, src); err != nil {
-		_ = dst.Close()
-		_ = os.Remove(localPath)
+	if err := writeCacheFile(localPath, func(dst *os.File) error {
+		_, err := io.Copy(dst, src)
+		return err
+	}); err != nil {
 		return "", fmt.Errorf("failed to copy file: %w", err)
 	}
-	if err := dst.Close(); err != nil {
-		_ = os.Remove(localPath)
-		return "", fmt.Errorf("failed to close cache file: %w", err)
-	}
 
 	checksum, err := checksumFn(localPath)
 	if err != nil {
@@ -440,12 +733,48 @@ func copyFileToLocalCache(srcPath string, localPath string, checksumFn func(stri
 	return checksum, nil
 }
 
+// writeCacheFile creates localPath with the content write produces. The
+// content goes to a temporary file in the same shard first, which is
+// renamed into place once complete, so localPath never holds part of it.
+// Temporary files left behind by a crash are orphans to Reconcile.
+func writeCacheFile(localPath string, write func(f *os.File) error) error {
+	dir := filepath.Dir(localPath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache shard: %w", err)
+	}
+	// CreateTemp uses 0600, so other users cannot read the content.
+	f, err := os.CreateTemp(dir, filepath.Base(localPath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if err := write(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, localPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
 // CopyToCache copies a file from srcPath to cache for remotePath
 // This is useful when we already have the data in a temp file
 func (c *DiskCache) CopyToCache(remotePath string, srcPath string, remoteModTime time.Time) (string, error) {
 	if c.disabled {
 		return "", fmt.Errorf("cache is disabled")
 	}
+	if c.Excludes(remotePath) {
+		return "", fmt.Errorf("%s: %w", remotePath, ErrExcluded)
+	}
+	c.fileMu.RLock()
+	defer c.fileMu.RUnlock()
 
 	info, err := os.Stat(srcPath)
 	if err != nil {
@@ -454,12 +783,12 @@ func (c *DiskCache) CopyToCache(remotePath string, srcPath string, remoteModTime
 	size := info.Size()
 
 	// Check if we need to evict entries
-	if err := c.evictIfNeeded(size); err != nil {
+	if err := c.evictIfNeeded(remotePath, size); err != nil {
 		return "", fmt.Errorf("failed to evict entries: %w", err)
 	}
 
-	// Generate local path
-	localPath := c.generateLocalPath(remotePath)
+	generation := c.generation.Add(1)
+	localPath := c.generateLocalPath(remotePath, generation)
 	checksum, err := copyFileToLocalCache(srcPath, localPath, calculateFileChecksum)
 	if err != nil {
 		return "", err
@@ -473,20 +802,13 @@ func (c *DiskCache) CopyToCache(remotePath string, srcPath string, remoteModTime
 		Size:       size,
 		ModTime:    remoteModTime,
 		AccessTime: now,
+		FetchTime:  now,
 		Checksum:   checksum,
+		Generation: generation,
 	}
 
 	c.mu.Lock()
-	// Remove old entry if exists
-	if oldEntry, exists := c.entries[remotePath]; exists {
-		c.totalSize -= oldEntry.Size
-		// Only remove file if it's different from the new path
-		if oldEntry.LocalPath != localPath {
-			os.Remove(oldEntry.LocalPath) // Best effort cleanup
-		}
-	}
-	c.entries[remotePath] = entry
-	c.totalSize += size
+	c.addEntryLocked(entry)
 	c.mu.Unlock()
 
 	return localPath, nil
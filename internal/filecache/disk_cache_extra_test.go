@@ -16,7 +16,7 @@ func TestEvictIfNeededCacheFull(t *testing.T) {
 		entries:      make(map[string]*Entry),
 	}
 
-	if err := cache.evictIfNeeded(10); err == nil {
+	if err := cache.evictIfNeeded("/file.txt", 10); err == nil {
 		t.Fatal("expected cache full error")
 	}
 }
@@ -193,8 +193,8 @@ func TestDiskCacheCopyToCacheOverwriteUpdatesChecksumAndStats(t *testing.T) {
 	if err != nil {
 		t.Fatalf("CopyToCache overwrite failed: %v", err)
 	}
-	if localPath1 != localPath2 {
-		t.Fatalf("expected stable local path, got %q and %q", localPath1, localPath2)
+	if localPath1 == localPath2 {
+		t.Fatalf("expected a new local path for the new version, got %q twice", localPath1)
 	}
 
 	cachedPath, checksum, found := cache.Get("/copy.txt", modTime)
@@ -1,8 +1,10 @@
 package filecache
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -348,6 +350,49 @@ func TestDiskCacheLRUEviction(t *testing.T) {
 	}
 }
 
+func TestDiskCacheEvictsExportsLast(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 30, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	modTime := time.Now()
+	data := []byte("0123456789")
+
+	// The export is the least recently used entry.
+	if _, err := cache.SetExport("/notebook.py", data, modTime); err != nil {
+		t.Fatalf("SetExport failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	for _, p := range []string{"/a.txt", "/b.txt", "/c.txt"} {
+		if _, err := cache.Set(p, data, modTime); err != nil {
+			t.Fatalf("Set %s failed: %v", p, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, _, found := cache.Get("/notebook.py", modTime); !found {
+		t.Error("export was evicted before downloaded files")
+	}
+	if _, _, found := cache.Get("/a.txt", modTime); found {
+		t.Error("expected the oldest downloaded file to be evicted")
+	}
+
+	// With only exports left, the least recently used one goes.
+	exports, err := NewDiskCache(t.TempDir(), 20, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	for _, p := range []string{"/x.py", "/y.py", "/z.py"} {
+		if _, err := exports.SetExport(p, data, modTime); err != nil {
+			t.Fatalf("SetExport %s failed: %v", p, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, _, found := exports.Get("/x.py", modTime); found {
+		t.Error("expected the oldest export to be evicted")
+	}
+}
+
 func TestDiskCacheOverwrite(t *testing.T) {
 	tmpDir := t.TempDir()
 	cache, err := NewDiskCache(tmpDir, 1024*1024, 1*time.Hour)
@@ -372,9 +417,13 @@ func TestDiskCacheOverwrite(t *testing.T) {
 		t.Fatalf("Set failed: %v", err)
 	}
 
-	// Paths should be the same
-	if localPath1 != localPath2 {
-		t.Errorf("Expected same local path, got %s and %s", localPath1, localPath2)
+	// The new version gets a file of its own; the old one is left to
+	// readers that still hold its path.
+	if localPath1 == localPath2 {
+		t.Errorf("Expected a new local path, got %s twice", localPath1)
+	}
+	if content, err := os.ReadFile(localPath1); err != nil || string(content) != string(originalData) {
+		t.Errorf("Expected old path to keep %q, got %q (%v)", originalData, content, err)
 	}
 
 	// Content should be updated
@@ -742,3 +791,281 @@ func BenchmarkDiskCacheGet(b *testing.B) {
 		}
 	}
 }
+
+func TestDiskCacheGetComparesVersionsNotClocks(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	modTime := time.Now()
+	if _, err := cache.Set("/a.txt", []byte("a"), modTime); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// Same version at the API's millisecond precision.
+	if _, _, found := cache.Get("/a.txt", modTime.Truncate(time.Millisecond)); !found {
+		t.Fatal("expected a hit for the same millisecond")
+	}
+	// A version stamped by a server clock that runs behind ours.
+	if _, _, found := cache.Get("/a.txt", modTime.Add(-time.Hour)); found {
+		t.Fatal("expected a miss for an older, different version")
+	}
+}
+
+func TestDiskCacheUpdateModTime(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	local := time.Now()
+	server := local.Add(-10 * time.Minute)
+	if _, err := cache.Set("/a.txt", []byte("a"), local); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if cache.UpdateModTime("/a.txt", server, local) {
+		t.Fatal("expected no update when the entry has another stamp")
+	}
+	if !cache.UpdateModTime("/a.txt", local, server) {
+		t.Fatal("expected the entry to be restamped")
+	}
+	if _, _, found := cache.Get("/a.txt", server); !found {
+		t.Fatal("expected a hit with the new stamp")
+	}
+	if cache.UpdateModTime("/missing.txt", local, server) {
+		t.Fatal("expected no update for a missing entry")
+	}
+}
+
+func TestDiskCacheCachedSize(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	modTime := time.UnixMilli(1000)
+	if _, err := cache.Set("/a.txt", []byte("hello"), modTime); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if size, ok := cache.CachedSize("/a.txt", modTime); !ok || size != 5 {
+		t.Fatalf("CachedSize = %d, %v, want 5, true", size, ok)
+	}
+	if _, ok := cache.CachedSize("/a.txt", modTime.Add(time.Second)); ok {
+		t.Fatal("expected no size for another version")
+	}
+	if _, ok := cache.CachedSize("/missing.txt", modTime); ok {
+		t.Fatal("expected no size for a missing entry")
+	}
+	if _, ok := NewDisabledCache().CachedSize("/a.txt", modTime); ok {
+		t.Fatal("expected no size from a disabled cache")
+	}
+}
+
+func TestDiskCacheSampleAndDeleteVersion(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	modTime := time.UnixMilli(1000)
+	for _, p := range []string{"/a.txt", "/b.txt", "/c.txt"} {
+		if _, err := cache.Set(p, []byte("abc"), modTime); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	if got := cache.Sample(2); len(got) != 2 || got[0].RemotePath == got[1].RemotePath {
+		t.Fatalf("Sample(2) = %+v, want 2 distinct entries", got)
+	}
+	if got := cache.Sample(10); len(got) != 3 {
+		t.Fatalf("Sample(10) returned %d entries, want all 3", len(got))
+	}
+
+	if cache.DeleteVersion("/a.txt", modTime.Add(time.Second)) {
+		t.Fatal("expected no delete for another version")
+	}
+	if !cache.DeleteVersion("/a.txt", modTime) {
+		t.Fatal("expected the entry to be deleted")
+	}
+	if entries, size := cache.GetStats(); entries != 2 || size != 6 {
+		t.Fatalf("GetStats = %d, %d after DeleteVersion", entries, size)
+	}
+}
+
+func TestDiskCacheTTLPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy    TTLPolicy
+		wantFound bool
+	}{
+		{policy: TTLIdle, wantFound: true},
+		{policy: TTLAbsolute, wantFound: false},
+	} {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			cache, err := NewDiskCache(t.TempDir(), 1024, 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("NewDiskCache failed: %v", err)
+			}
+			cache.SetTTLPolicy(tt.policy)
+			modTime := time.Now()
+			if _, err := cache.Set("/hot.txt", []byte("hot"), modTime); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			// Hits keep an idle entry alive; an absolute TTL runs out anyway.
+			for i := 0; i < 4; i++ {
+				time.Sleep(20 * time.Millisecond)
+				cache.Get("/hot.txt", modTime)
+			}
+			if _, _, found := cache.Get("/hot.txt", modTime); found != tt.wantFound {
+				t.Fatalf("found = %v after 80ms of hits, want %v", found, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestParseTTLPolicy(t *testing.T) {
+	for value, want := range map[string]TTLPolicy{"": TTLIdle, "idle": TTLIdle, "Absolute": TTLAbsolute} {
+		if got, err := ParseTTLPolicy(value); err != nil || got != want {
+			t.Errorf("ParseTTLPolicy(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	if _, err := ParseTTLPolicy("sliding"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestDiskCacheConcurrentSetAndRead(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	modTime := time.Now()
+	versions := [][]byte{
+		bytes.Repeat([]byte("a"), 64*1024),
+		bytes.Repeat([]byte("b"), 32*1024),
+	}
+	if _, err := cache.Set("/hot.bin", versions[0], modTime); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := cache.Set("/hot.bin", versions[i%2], modTime); err != nil {
+				t.Errorf("Set failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		localPath, checksum, found := cache.Get("/hot.bin", modTime)
+		if !found {
+			continue
+		}
+		data, err := os.ReadFile(localPath)
+		if os.IsNotExist(err) {
+			// Superseded twice since Get; the reader fetches again.
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if CalculateChecksum(data) != checksum {
+			t.Fatalf("read %d bytes from %s that do not match its entry", len(data), localPath)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestDiskCacheDeleteFile(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	modTime := time.Now()
+	oldPath, err := cache.Set("/file.txt", []byte("old"), modTime)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	newPath, err := cache.Set("/file.txt", []byte("new"), modTime)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if cache.DeleteFile("/file.txt", oldPath) {
+		t.Fatal("expected DeleteFile of a replaced generation to keep the entry")
+	}
+	if got, _, found := cache.Get("/file.txt", modTime); !found || got != newPath {
+		t.Fatalf("Get = %s, %v; want %s", got, found, newPath)
+	}
+	if !cache.DeleteFile("/file.txt", newPath) {
+		t.Fatal("expected DeleteFile of the current generation to remove the entry")
+	}
+	for _, p := range []string{oldPath, newPath} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("expected %s removed, got %v", p, err)
+		}
+	}
+}
+
+func TestDiskCacheRename(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	modTime := time.Now()
+	for remotePath, content := range map[string]string{
+		"/src/a.txt":     "a",
+		"/src/sub/b.txt": "b",
+		"/srcfile.txt":   "not below /src",
+		"/dst/a.txt":     "replaced",
+	} {
+		if _, err := cache.Set(remotePath, []byte(content), modTime); err != nil {
+			t.Fatalf("Set %s failed: %v", remotePath, err)
+		}
+	}
+	oldLocal, _, _ := cache.Get("/src/a.txt", modTime)
+
+	if kept := cache.Rename("/src", "/dst"); kept != 2 {
+		t.Fatalf("Rename kept %d entries, want 2", kept)
+	}
+	if _, _, found := cache.Get("/src/a.txt", modTime); found {
+		t.Fatal("entry still cached at the old path")
+	}
+	if _, err := os.Stat(oldLocal); !os.IsNotExist(err) {
+		t.Fatalf("file still at the old name: %v", err)
+	}
+	for remotePath, want := range map[string]string{"/dst/a.txt": "a", "/dst/sub/b.txt": "b", "/srcfile.txt": "not below /src"} {
+		localPath, _, found := cache.Get(remotePath, modTime)
+		if !found {
+			t.Fatalf("%s not cached after rename", remotePath)
+		}
+		data, err := os.ReadFile(localPath)
+		if err != nil || string(data) != want {
+			t.Fatalf("%s = %q, %v; want %q", remotePath, data, err, want)
+		}
+	}
+	if entries, size := cache.GetStats(); entries != 3 || size != int64(len("a")+len("b")+len("not below /src")) {
+		t.Fatalf("stats = %d entries, %d bytes after rename", entries, size)
+	}
+
+	// The index matches the renamed files, so they survive a restart.
+	if err := cache.SaveIndex(); err != nil {
+		t.Fatalf("SaveIndex failed: %v", err)
+	}
+	reopened, err := NewDiskCache(cache.cacheDir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	if _, _, found := reopened.Get("/dst/sub/b.txt", modTime); !found {
+		t.Fatal("renamed entry lost after restart")
+	}
+}
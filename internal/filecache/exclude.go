@@ -0,0 +1,104 @@
+package filecache
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// DefaultExcludePatterns names files that usually hold secrets. Their
+// content is kept in memory only, never in the disk cache.
+var DefaultExcludePatterns = []string{
+	"*.pem",
+	"*.key",
+	"*.p12",
+	"*.pfx",
+	"id_rsa*",
+	"id_ecdsa*",
+	"id_ed25519*",
+	"credentials*",
+	".env",
+	".env.*",
+	".netrc",
+}
+
+// ErrExcluded is returned by Set and CopyToCache for paths matching an
+// exclude pattern.
+var ErrExcluded = errors.New("path is excluded from the disk cache")
+
+// ParseExcludePatterns splits a comma-separated pattern list and checks
+// each pattern. Empty items are ignored.
+func ParseExcludePatterns(value string) ([]string, error) {
+	var patterns []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if err := validateExcludePattern(item); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, item)
+	}
+	return patterns, nil
+}
+
+func validateExcludePattern(pattern string) error {
+	if strings.Contains(pattern, "/") {
+		return fmt.Errorf("pattern %q must match a file name, not a path", pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// SetExcludePatterns sets the glob patterns, in path.Match syntax, of file
+// names that must not be written to the disk cache. Matching is done on the
+// base name and ignores case. Entries already cached under a matching name
+// are removed.
+func (c *DiskCache) SetExcludePatterns(patterns []string) error {
+	lowered := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if err := validateExcludePattern(pattern); err != nil {
+			return err
+		}
+		lowered = append(lowered, strings.ToLower(pattern))
+	}
+
+	c.mu.Lock()
+	c.excludePatterns = lowered
+	c.mu.Unlock()
+
+	for _, remotePath := range c.GetCachedPaths() {
+		if c.Excludes(remotePath) {
+			c.Delete(remotePath)
+		}
+	}
+	return nil
+}
+
+// Excludes reports whether remotePath must not be written to the disk
+// cache.
+func (c *DiskCache) Excludes(remotePath string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.excludesLocked(remotePath)
+}
+
+// excludesLocked is Excludes for callers holding the lock.
+// Must be called with lock held
+func (c *DiskCache) excludesLocked(remotePath string) bool {
+	if len(c.excludePatterns) == 0 {
+		return false
+	}
+
+	name := strings.ToLower(path.Base(remotePath))
+	for _, pattern := range c.excludePatterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package filecache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseExcludePatterns(t *testing.T) {
+	patterns, err := ParseExcludePatterns(" *.pem, ,credentials*,")
+	if err != nil {
+		t.Fatalf("ParseExcludePatterns: %v", err)
+	}
+	if len(patterns) != 2 || patterns[0] != "*.pem" || patterns[1] != "credentials*" {
+		t.Fatalf("patterns = %q", patterns)
+	}
+
+	if patterns, err := ParseExcludePatterns(""); err != nil || len(patterns) != 0 {
+		t.Fatalf("empty value = %q, %v; want no patterns", patterns, err)
+	}
+
+	for _, bad := range []string{"[a-", "secrets/*.txt"} {
+		if _, err := ParseExcludePatterns(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestDefaultExcludePatternsAreValid(t *testing.T) {
+	cache := NewDisabledCache()
+	if err := cache.SetExcludePatterns(DefaultExcludePatterns); err != nil {
+		t.Fatalf("SetExcludePatterns(defaults): %v", err)
+	}
+	for _, p := range []string{"/a/server.pem", "/a/TLS.KEY", "/home/.aws/credentials", "/repo/.env", "/repo/.env.local", "/ssh/id_ed25519"} {
+		if !cache.Excludes(p) {
+			t.Fatalf("expected %s to be excluded by default", p)
+		}
+	}
+	for _, p := range []string{"/a/main.py", "/a/keys.md", "/repo/.envrc", "/pem/notes.txt"} {
+		if cache.Excludes(p) {
+			t.Fatalf("did not expect %s to be excluded by default", p)
+		}
+	}
+}
+
+func TestDiskCacheExcludedPaths(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache: %v", err)
+	}
+	modTime := time.Now()
+	if _, err := cache.Set("/certs/server.pem", []byte("secret"), modTime); err != nil {
+		t.Fatalf("Set before exclusion: %v", err)
+	}
+
+	// Entries already cached under an excluded name are dropped.
+	if err := cache.SetExcludePatterns([]string{"*.pem"}); err != nil {
+		t.Fatalf("SetExcludePatterns: %v", err)
+	}
+	if entries, _ := cache.GetStats(); entries != 0 {
+		t.Fatalf("entries = %d after exclusion, want 0", entries)
+	}
+
+	if _, err := cache.Set("/certs/server.pem", []byte("secret"), modTime); !errors.Is(err, ErrExcluded) {
+		t.Fatalf("Set excluded = %v, want ErrExcluded", err)
+	}
+	if _, _, found := cache.Get("/certs/server.pem", modTime); found {
+		t.Fatal("Get returned an excluded path")
+	}
+	if _, err := cache.Set("/certs/README.md", []byte("docs"), modTime); err != nil {
+		t.Fatalf("Set of a regular file: %v", err)
+	}
+
+	if err := cache.SetExcludePatterns(nil); err != nil {
+		t.Fatalf("SetExcludePatterns(nil): %v", err)
+	}
+	if _, err := cache.Set("/certs/server.pem", []byte("secret"), modTime); err != nil {
+		t.Fatalf("Set after clearing patterns: %v", err)
+	}
+}
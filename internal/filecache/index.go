@@ -0,0 +1,300 @@
+package filecache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// indexFileName is the file in the cache directory that lists the cached
+// entries, so they outlive the process. Cache files are named by a hash of
+// their remote path, which cannot be recovered from the name alone.
+const indexFileName = "index.json"
+
+// indexEntry is the saved form of an Entry. The file is stored relative to
+// the cache directory, so the directory can move.
+type indexEntry struct {
+	RemotePath string    `json:"remote_path"`
+	File       string    `json:"file"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	AccessTime time.Time `json:"access_time"`
+	FetchTime  time.Time `json:"fetch_time"`
+	Checksum   string    `json:"checksum"`
+	Export     bool      `json:"export,omitempty"`
+}
+
+type indexFile struct {
+	Entries []indexEntry `json:"entries"`
+	Pins    []string     `json:"pins,omitempty"` // paths passed to Pin
+}
+
+// ReconcileResult reports what Reconcile removed.
+type ReconcileResult struct {
+	OrphanFiles    int   // cache files no entry refers to
+	DroppedEntries int   // entries whose file was missing or had another size
+	ReclaimedBytes int64 // size of the files removed
+}
+
+// Empty reports whether the reconciliation removed nothing.
+func (r ReconcileResult) Empty() bool {
+	return r.OrphanFiles == 0 && r.DroppedEntries == 0
+}
+
+func (r ReconcileResult) String() string {
+	return fmt.Sprintf("removed %d orphaned files and %d entries without a valid file (%.2f MB)",
+		r.OrphanFiles, r.DroppedEntries, float64(r.ReclaimedBytes)/(1024*1024))
+}
+
+func (c *DiskCache) indexPath() string {
+	return filepath.Join(c.cacheDir, indexFileName)
+}
+
+// relPath returns localPath relative to the cache directory, in the form
+// the index saves.
+func (c *DiskCache) relPath(localPath string) string {
+	rel, err := filepath.Rel(c.cacheDir, localPath)
+	if err != nil {
+		return localPath
+	}
+	return filepath.ToSlash(rel)
+}
+
+// loadIndex adds the entries saved by an earlier process. Entries that do
+// not name the file their remote path hashes to are skipped, and their
+// files are removed as orphans by the next Reconcile. Files of the flat
+// layout, which kept every file in the cache directory itself, are moved
+// to their shard.
+func (c *DiskCache) loadIndex() error {
+	data, err := os.ReadFile(c.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse %s: %w", c.indexPath(), err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range file.Pins {
+		c.pins[p] = struct{}{}
+	}
+	for _, saved := range file.Entries {
+		if saved.RemotePath == "" || saved.Size < 0 {
+			continue
+		}
+		generation, ok := c.savedGeneration(saved)
+		if !ok {
+			continue
+		}
+		localPath := c.generateLocalPath(saved.RemotePath, generation)
+		if saved.File == filepath.Base(localPath) {
+			if err := migrateFlatFile(filepath.Join(c.cacheDir, saved.File), localPath); err != nil {
+				continue
+			}
+		}
+		if generation > c.generation.Load() {
+			c.generation.Store(generation)
+		}
+		if old, ok := c.entries[saved.RemotePath]; ok {
+			c.totalSize -= old.Size
+		}
+		c.entries[saved.RemotePath] = &Entry{
+			RemotePath: saved.RemotePath,
+			LocalPath:  localPath,
+			Size:       saved.Size,
+			ModTime:    saved.ModTime,
+			AccessTime: saved.AccessTime,
+			FetchTime:  saved.FetchTime,
+			Checksum:   saved.Checksum,
+			Export:     saved.Export,
+			Pinned:     c.isPinnedLocked(saved.RemotePath),
+			Generation: generation,
+		}
+		c.totalSize += saved.Size
+	}
+	return nil
+}
+
+// SaveIndex writes the current entries and pins to the index file, so the
+// next process keeps them. An empty cache removes the file.
+func (c *DiskCache) SaveIndex() error {
+	if c.disabled {
+		return nil
+	}
+	file := indexFile{Pins: c.PinnedPaths()}
+	c.mu.RLock()
+	file.Entries = make([]indexEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		file.Entries = append(file.Entries, indexEntry{
+			RemotePath: entry.RemotePath,
+			File:       c.relPath(entry.LocalPath),
+			Size:       entry.Size,
+			ModTime:    entry.ModTime,
+			AccessTime: entry.AccessTime,
+			FetchTime:  entry.FetchTime,
+			Checksum:   entry.Checksum,
+			Export:     entry.Export,
+		})
+	}
+	c.mu.RUnlock()
+
+	if len(file.Entries) == 0 && len(file.Pins) == 0 {
+		if err := os.Remove(c.indexPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	tmp := c.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.indexPath()); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// savedGeneration returns the generation of the file a saved entry names,
+// and false when the name is not one its remote path hashes to. Names
+// without a generation, sharded or of the flat layout, are generation 0.
+func (c *DiskCache) savedGeneration(saved indexEntry) (uint64, bool) {
+	unversioned := c.generateLocalPath(saved.RemotePath, 0)
+	if saved.File == c.relPath(unversioned) || saved.File == filepath.Base(unversioned) {
+		return 0, true
+	}
+	suffix, ok := strings.CutPrefix(saved.File, c.relPath(unversioned)+".")
+	if !ok {
+		return 0, false
+	}
+	generation, err := strconv.ParseUint(suffix, 10, 64)
+	if err != nil || generation == 0 || strconv.FormatUint(generation, 10) != suffix {
+		return 0, false
+	}
+	return generation, true
+}
+
+// migrateFlatFile moves a cache file of the flat layout to its shard.
+func migrateFlatFile(flatPath, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0700); err != nil {
+		return err
+	}
+	return os.Rename(flatPath, localPath)
+}
+
+// Reconcile brings the entries and the files in the cache directory back
+// in line: it drops expired entries and entries whose file is missing or
+// has another size, removes files no entry refers to, such as temporary
+// files of interrupted writes, and saves the index.
+// It looks at the files in the cache directory and in its shards; other
+// subdirectories, such as the saved inode numbers, are left alone. Writes
+// to the cache wait while it runs.
+func (c *DiskCache) Reconcile() (ReconcileResult, error) {
+	var result ReconcileResult
+	if c.disabled {
+		return result, nil
+	}
+
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+
+	c.mu.Lock()
+	c.evictExpiredLocked()
+	referenced := make(map[string]struct{}, len(c.entries))
+	for remotePath, entry := range c.entries {
+		info, err := os.Stat(entry.LocalPath)
+		if err == nil && info.Mode().IsRegular() && info.Size() == entry.Size {
+			referenced[entry.LocalPath] = struct{}{}
+			if entry.previous != "" {
+				referenced[entry.previous] = struct{}{}
+			}
+			continue
+		}
+		if err == nil && info.Mode().IsRegular() {
+			result.ReclaimedBytes += info.Size()
+		}
+		entry.removeFiles()
+		delete(c.entries, remotePath)
+		c.totalSize -= entry.Size
+		result.DroppedEntries++
+	}
+	c.mu.Unlock()
+
+	files, err := c.cacheFiles()
+	if err != nil {
+		return result, err
+	}
+	for _, file := range files {
+		if _, ok := referenced[file]; ok {
+			continue
+		}
+		info, err := os.Lstat(file)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			continue
+		}
+		result.OrphanFiles++
+		result.ReclaimedBytes += info.Size()
+	}
+
+	return result, c.SaveIndex()
+}
+
+// cacheFiles lists the files in the cache directory and its shards, apart
+// from the index.
+func (c *DiskCache) cacheFiles() ([]string, error) {
+	var files []string
+	var walk func(dir string, depth int) error
+	walk = func(dir string, depth int) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			fullPath := filepath.Join(dir, name)
+			switch {
+			case !entry.IsDir():
+				if depth > 0 || name != indexFileName {
+					files = append(files, fullPath)
+				}
+			case depth < 2 && isShardName(name):
+				if err := walk(fullPath, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return files, walk(c.cacheDir, 0)
+}
+
+// isShardName reports whether name is a shard directory: one byte of a
+// hash in lower-case hex.
+func isShardName(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	for _, r := range name {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,245 @@
+package filecache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCacheIndexSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.UnixMilli(1_700_000_000_000)
+	cache, err := NewDiskCache(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	if _, err := cache.Set("/kept.txt", []byte("kept"), modTime); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := cache.SetExport("/notebook", []byte("# Databricks notebook source\n"), modTime); err != nil {
+		t.Fatalf("SetExport failed: %v", err)
+	}
+	if err := cache.SaveIndex(); err != nil {
+		t.Fatalf("SaveIndex failed: %v", err)
+	}
+	// Written after the save, so the next process cannot tell what it is.
+	unsaved, err := cache.Set("/unsaved.txt", []byte("unsaved"), modTime)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	reopened, err := NewDiskCache(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	localPath, checksum, found := reopened.Get("/kept.txt", modTime)
+	if !found || checksum != CalculateChecksum([]byte("kept")) {
+		t.Fatalf("saved entry lost: found=%v checksum=%q", found, checksum)
+	}
+	if data, err := os.ReadFile(localPath); err != nil || string(data) != "kept" {
+		t.Fatalf("cached content = %q, %v", data, err)
+	}
+	if _, _, found := reopened.Get("/notebook", modTime); !found {
+		t.Fatal("saved export lost")
+	}
+	if _, _, found := reopened.Get("/notebook", modTime.Add(time.Second)); found {
+		t.Fatal("expected another version to miss after a restart")
+	}
+	if _, err := os.Stat(unsaved); !os.IsNotExist(err) {
+		t.Fatalf("expected the unindexed file to be removed, got %v", err)
+	}
+	if entries, size := reopened.GetStats(); entries != 1 || size != 4 {
+		t.Fatalf("stats = %d entries, %d bytes; want 1, 4", entries, size)
+	}
+}
+
+func TestDiskCacheReconcile(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Now()
+	cache, err := NewDiskCache(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	kept, err := cache.Set("/kept.txt", []byte("kept"), modTime)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	missing, err := cache.Set("/missing.txt", []byte("missing"), modTime)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	truncated, err := cache.Set("/truncated.txt", []byte("truncated"), modTime)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := os.Remove(missing); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(truncated, []byte("trunc"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	orphan := filepath.Join(dir, "orphan")
+	if err := os.WriteFile(orphan, make([]byte, 100), 0600); err != nil {
+		t.Fatal(err)
+	}
+	subdir := filepath.Join(dir, "inodes")
+	if err := os.Mkdir(subdir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := cache.Reconcile()
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	want := ReconcileResult{OrphanFiles: 1, DroppedEntries: 2, ReclaimedBytes: 105}
+	if result != want {
+		t.Fatalf("Reconcile = %+v, want %+v", result, want)
+	}
+	for _, p := range []string{orphan, truncated} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", p, err)
+		}
+	}
+	for _, p := range []string{kept, subdir, filepath.Join(dir, indexFileName)} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("expected %s to be kept: %v", p, err)
+		}
+	}
+	if entries, size := cache.GetStats(); entries != 1 || size != 4 {
+		t.Fatalf("stats = %d entries, %d bytes; want 1, 4", entries, size)
+	}
+
+	if result, err := cache.Reconcile(); err != nil || !result.Empty() {
+		t.Fatalf("second Reconcile = %+v, %v; want nothing removed", result, err)
+	}
+}
+
+func TestDiskCacheShardsFiles(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	localPath, err := cache.Set("/sharded.txt", []byte("sharded"), time.Now())
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	name := filepath.Base(localPath)
+	if want := filepath.Join(dir, name[:2], name[2:4], name); localPath != want {
+		t.Fatalf("local path = %s, want %s", localPath, want)
+	}
+
+	orphan := filepath.Join(filepath.Dir(localPath), "orphan")
+	if err := os.WriteFile(orphan, []byte("orphan"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result, err := cache.Reconcile()
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if want := (ReconcileResult{OrphanFiles: 1, ReclaimedBytes: 6}); result != want {
+		t.Fatalf("Reconcile = %+v, want %+v", result, want)
+	}
+	if _, err := os.Stat(localPath); err != nil {
+		t.Fatalf("expected the cached file to be kept: %v", err)
+	}
+}
+
+func TestDiskCacheMigratesFlatLayout(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.UnixMilli(1_700_000_000_000)
+	cache, err := NewDiskCache(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	localPath, err := cache.Set("/flat.txt", []byte("flat"), modTime)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := cache.SaveIndex(); err != nil {
+		t.Fatalf("SaveIndex failed: %v", err)
+	}
+
+	// Rewrite the cache as the flat layout left it, with files named by
+	// the hash alone.
+	unversioned := cache.generateLocalPath("/flat.txt", 0)
+	name := filepath.Base(unversioned)
+	flatPath := filepath.Join(dir, name)
+	if err := os.Rename(localPath, flatPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, indexFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	file.Entries[0].File = name
+	if data, err = json.Marshal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, indexFileName), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewDiskCache(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	got, _, found := reopened.Get("/flat.txt", modTime)
+	if !found || got != unversioned {
+		t.Fatalf("Get = %s, %v; want %s", got, found, unversioned)
+	}
+	if data, err := os.ReadFile(unversioned); err != nil || string(data) != "flat" {
+		t.Fatalf("migrated content = %q, %v", data, err)
+	}
+	if _, err := os.Stat(flatPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the flat file to be moved, got %v", err)
+	}
+}
+
+func TestDiskCacheGenerationsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.UnixMilli(1_700_000_000_000)
+	cache, err := NewDiskCache(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	for _, content := range []string{"one", "two", "three"} {
+		if _, err := cache.Set("/gen.txt", []byte(content), modTime); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	localPath, _, _ := cache.Get("/gen.txt", modTime)
+	// A write interrupted between the temporary file and the rename.
+	leftover := localPath + ".tmp123"
+	if err := os.WriteFile(leftover, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.SaveIndex(); err != nil {
+		t.Fatalf("SaveIndex failed: %v", err)
+	}
+
+	reopened, err := NewDiskCache(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	got, _, found := reopened.Get("/gen.txt", modTime)
+	if !found || got != localPath {
+		t.Fatalf("Get = %s, %v; want %s", got, found, localPath)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Fatalf("expected the temporary file removed, got %v", err)
+	}
+	next, err := reopened.Set("/gen.txt", []byte("four"), modTime)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if want := reopened.generateLocalPath("/gen.txt", 4); next != want {
+		t.Fatalf("Set after restart = %s, want %s", next, want)
+	}
+}
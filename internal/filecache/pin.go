@@ -0,0 +1,163 @@
+package filecache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultPinMaxBytes is the default budget of pinned entries.
+const DefaultPinMaxBytes int64 = 1024 * 1024 * 1024
+
+// ErrPinBudget is returned when pinned content does not fit in the pin
+// budget.
+var ErrPinBudget = errors.New("pin budget exceeded")
+
+// SetPinBudget sets how many bytes pinned entries may hold. Pinned bytes
+// count against this budget instead of the overall size limit and the
+// quotas. Zero uses DefaultPinMaxBytes.
+func (c *DiskCache) SetPinBudget(maxBytes int64) error {
+	if maxBytes < 0 {
+		return fmt.Errorf("pin budget %d is negative", maxBytes)
+	}
+	if maxBytes == 0 {
+		maxBytes = DefaultPinMaxBytes
+	}
+	c.mu.Lock()
+	c.pinMaxBytes = maxBytes
+	c.mu.Unlock()
+	return nil
+}
+
+// SetPinRule pins, besides the paths passed to Pin, every path rule
+// returns true for, such as the files a .wsfsattributes pin directive
+// matches. Rule pins are not saved in the index; the rule is asked again
+// by the next process.
+func (c *DiskCache) SetPinRule(rule func(remotePath string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pinRule = rule
+	for remotePath, entry := range c.entries {
+		entry.Pinned = c.isPinnedLocked(remotePath)
+	}
+}
+
+// Pin exempts remotePath from LRU and TTL eviction, now and for the
+// versions cached later, until Unpin. It fails with ErrPinBudget when the
+// cached content of the path does not fit in the pin budget.
+func (c *DiskCache) Pin(remotePath string) error {
+	if c.disabled {
+		return fmt.Errorf("cache is disabled")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[remotePath]
+	if ok && !entry.Pinned {
+		if pinned := c.pinnedBytesLocked(); pinned+entry.Size > c.pinMaxBytes {
+			return fmt.Errorf("%s: %w (pinned: %d, max: %d)", remotePath, ErrPinBudget, pinned, c.pinMaxBytes)
+		}
+		entry.Pinned = true
+	}
+	c.pins[remotePath] = struct{}{}
+	return nil
+}
+
+// Unpin removes the pins of remotePath and of every path below it, and
+// returns the paths unpinned. Their entries stay cached and are evicted
+// like any other from then on.
+func (c *DiskCache) Unpin(remotePath string) []string {
+	if c.disabled {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var unpinned []string
+	for p := range c.pins {
+		if p == remotePath || remotePath == "/" || strings.HasPrefix(p, remotePath+"/") {
+			delete(c.pins, p)
+			unpinned = append(unpinned, p)
+			if entry, ok := c.entries[p]; ok {
+				entry.Pinned = c.isPinnedLocked(p)
+			}
+		}
+	}
+	sort.Strings(unpinned)
+	return unpinned
+}
+
+// IsPinned reports whether remotePath is pinned, by Pin or by the pin rule.
+func (c *DiskCache) IsPinned(remotePath string) bool {
+	if c.disabled {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isPinnedLocked(remotePath)
+}
+
+// PinnedPaths returns the paths passed to Pin, sorted.
+func (c *DiskCache) PinnedPaths() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	paths := make([]string, 0, len(c.pins))
+	for p := range c.pins {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// PinStats returns the number and bytes of the cached pinned entries, and
+// the pin budget.
+func (c *DiskCache) PinStats() (numEntries int, pinnedSize, maxBytes int64) {
+	if c.disabled {
+		return 0, 0, 0
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, entry := range c.entries {
+		if entry.Pinned {
+			numEntries++
+			pinnedSize += entry.Size
+		}
+	}
+	return numEntries, pinnedSize, c.pinMaxBytes
+}
+
+// isPinnedLocked reports whether entries of remotePath are pinned. It is
+// asked when an entry is added and when pins change; the answer is kept in
+// Entry.Pinned.
+// Must be called with lock held
+func (c *DiskCache) isPinnedLocked(remotePath string) bool {
+	if _, ok := c.pins[remotePath]; ok {
+		return true
+	}
+	return c.pinRule != nil && c.pinRule(remotePath)
+}
+
+// pinnedBytesLocked returns the bytes held by pinned entries.
+// Must be called with lock held
+func (c *DiskCache) pinnedBytesLocked() int64 {
+	var size int64
+	for _, entry := range c.entries {
+		if entry.Pinned {
+			size += entry.Size
+		}
+	}
+	return size
+}
+
+// admitPinnedLocked checks that newSize bytes of the pinned remotePath fit
+// in the pin budget, counting the entry they replace as gone.
+// Must be called with lock held
+func (c *DiskCache) admitPinnedLocked(remotePath string, newSize int64) error {
+	pinned := c.pinnedBytesLocked()
+	if old, ok := c.entries[remotePath]; ok && old.Pinned {
+		pinned -= old.Size
+	}
+	if pinned+newSize > c.pinMaxBytes {
+		return fmt.Errorf("%s: %w: cannot fit %d bytes (pinned: %d, max: %d)", remotePath, ErrPinBudget, newSize, pinned, c.pinMaxBytes)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package filecache
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiskCachePinnedEntriesSurviveEviction(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 10, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	if err := cache.SetPinBudget(8); err != nil {
+		t.Fatalf("SetPinBudget failed: %v", err)
+	}
+	modTime := time.Now()
+	if err := cache.Pin("/libs/big.so"); err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+	if _, err := cache.Set("/libs/big.so", []byte("12345678"), modTime); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	// Pinned bytes do not count against the size limit, so both fit.
+	for _, p := range []string{"/a.txt", "/b.txt"} {
+		if _, err := cache.Set(p, []byte("12345"), modTime); err != nil {
+			t.Fatalf("Set %s failed: %v", p, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := cache.Set("/c.txt", []byte("12345"), modTime); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, _, found := cache.Get("/a.txt", modTime); found {
+		t.Fatal("expected /a.txt to be evicted")
+	}
+	if _, _, found := cache.Get("/libs/big.so", modTime); !found {
+		t.Fatal("pinned entry was evicted")
+	}
+	if entries, size, max := cache.PinStats(); entries != 1 || size != 8 || max != 8 {
+		t.Fatalf("PinStats = %d, %d, %d", entries, size, max)
+	}
+
+	// A new version of a pinned path must fit in the pin budget.
+	if _, err := cache.Set("/libs/big.so", []byte("123456789"), modTime); !errors.Is(err, ErrPinBudget) {
+		t.Fatalf("expected ErrPinBudget, got %v", err)
+	}
+	// Pinning cached content over the budget fails and keeps it unpinned.
+	if err := cache.Pin("/b.txt"); !errors.Is(err, ErrPinBudget) {
+		t.Fatalf("expected ErrPinBudget, got %v", err)
+	}
+	if cache.IsPinned("/b.txt") {
+		t.Fatal("/b.txt pinned over the budget")
+	}
+}
+
+func TestDiskCachePinnedEntriesDoNotExpire(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024, time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	cache.SetPinRule(func(remotePath string) bool { return strings.HasSuffix(remotePath, ".whl") })
+	modTime := time.Now()
+	for _, p := range []string{"/dist/pkg.whl", "/notes.txt"} {
+		if _, err := cache.Set(p, []byte("data"), modTime); err != nil {
+			t.Fatalf("Set %s failed: %v", p, err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, _, found := cache.Get("/notes.txt", modTime); found {
+		t.Fatal("expected /notes.txt to expire")
+	}
+	if _, _, found := cache.Get("/dist/pkg.whl", modTime); !found {
+		t.Fatal("pinned entry expired")
+	}
+}
+
+func TestDiskCacheUnpinAndPinsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	for _, p := range []string{"/libs/a.so", "/libs/sub/b.so", "/other.so"} {
+		if err := cache.Pin(p); err != nil {
+			t.Fatalf("Pin %s failed: %v", p, err)
+		}
+	}
+	if _, err := cache.Set("/libs/a.so", []byte("a"), time.Now()); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := cache.SaveIndex(); err != nil {
+		t.Fatalf("SaveIndex failed: %v", err)
+	}
+
+	reopened, err := NewDiskCache(dir, 1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	if got, want := reopened.PinnedPaths(), []string{"/libs/a.so", "/libs/sub/b.so", "/other.so"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("PinnedPaths = %q, want %q", got, want)
+	}
+	if entries, _, _ := reopened.PinStats(); entries != 1 {
+		t.Fatalf("pinned entries = %d, want 1", entries)
+	}
+	if got, want := reopened.Unpin("/libs"), []string{"/libs/a.so", "/libs/sub/b.so"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unpin = %q, want %q", got, want)
+	}
+	if entries, _, _ := reopened.PinStats(); entries != 0 || !reopened.IsPinned("/other.so") {
+		t.Fatalf("pinned entries = %d after Unpin", entries)
+	}
+}
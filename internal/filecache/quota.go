@@ -0,0 +1,143 @@
+package filecache
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Quota caps the disk cache bytes held by the files below a workspace path,
+// so one data-heavy tree cannot evict everything else.
+type Quota struct {
+	Prefix   string `json:"prefix"`    // absolute workspace path; covers the path and its tree
+	MaxBytes int64  `json:"max_bytes"` // budget of the tree
+}
+
+// QuotaUsage is what the files below a quota prefix hold in the cache.
+type QuotaUsage struct {
+	Quota
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+func validateQuota(q Quota) error {
+	if !strings.HasPrefix(q.Prefix, "/") || path.Clean(q.Prefix) != q.Prefix {
+		return fmt.Errorf("quota prefix %q must be a clean absolute workspace path", q.Prefix)
+	}
+	if q.MaxBytes <= 0 {
+		return fmt.Errorf("quota for %s must be positive", q.Prefix)
+	}
+	return nil
+}
+
+// SetQuotas sets the per-tree budgets. A file counts against the quota with
+// the longest prefix covering it, and against the overall size limit as
+// well. Entries over a new budget are evicted, least recently used first.
+func (c *DiskCache) SetQuotas(quotas []Quota) error {
+	sorted := make([]Quota, 0, len(quotas))
+	seen := make(map[string]struct{}, len(quotas))
+	for _, q := range quotas {
+		if err := validateQuota(q); err != nil {
+			return err
+		}
+		if _, ok := seen[q.Prefix]; ok {
+			return fmt.Errorf("duplicate quota for %s", q.Prefix)
+		}
+		seen[q.Prefix] = struct{}{}
+		sorted = append(sorted, q)
+	}
+	// Longest prefix first, so the first match is the most specific one.
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i].Prefix) > len(sorted[j].Prefix) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quotas = sorted
+	for i := range c.quotas {
+		c.evictQuotaLocked(&c.quotas[i], 0)
+	}
+	return nil
+}
+
+// quotaForLocked returns the quota covering remotePath, or nil.
+// Must be called with lock held
+func (c *DiskCache) quotaForLocked(remotePath string) *Quota {
+	for i := range c.quotas {
+		q := &c.quotas[i]
+		if q.Prefix == "/" || remotePath == q.Prefix || strings.HasPrefix(remotePath, q.Prefix+"/") {
+			return q
+		}
+	}
+	return nil
+}
+
+// quotaUsageLocked returns the entries and bytes counted against q. Pinned
+// entries count against the pin budget instead.
+// Must be called with lock held
+func (c *DiskCache) quotaUsageLocked(q *Quota) (entries int, bytes int64) {
+	for remotePath, entry := range c.entries {
+		if !entry.Pinned && c.quotaForLocked(remotePath) == q {
+			entries++
+			bytes += entry.Size
+		}
+	}
+	return entries, bytes
+}
+
+// evictQuotaLocked evicts entries counted against q, least recently used
+// first, until newSize more bytes fit in its budget.
+// Must be called with lock held
+func (c *DiskCache) evictQuotaLocked(q *Quota, newSize int64) error {
+	_, used := c.quotaUsageLocked(q)
+	for used+newSize > q.MaxBytes {
+		var oldestPath string
+		var oldest *Entry
+		for remotePath, entry := range c.entries {
+			if entry.Pinned || c.quotaForLocked(remotePath) != q {
+				continue
+			}
+			if oldest == nil || evictsBefore(entry, oldest) {
+				oldestPath = remotePath
+				oldest = entry
+			}
+		}
+		if oldest == nil {
+			return fmt.Errorf("quota for %s exceeded: cannot fit %d bytes (max: %d)", q.Prefix, newSize, q.MaxBytes)
+		}
+		oldest.removeFiles()
+		delete(c.entries, oldestPath)
+		c.totalSize -= oldest.Size
+		used -= oldest.Size
+	}
+	return nil
+}
+
+// QuotaStats reports the usage of each quota, in the order of the
+// prefixes.
+func (c *DiskCache) QuotaStats() []QuotaUsage {
+	if c.disabled {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.quotas) == 0 {
+		return nil
+	}
+	usage := make([]QuotaUsage, len(c.quotas))
+	index := make(map[*Quota]int, len(c.quotas))
+	for i := range c.quotas {
+		usage[i].Quota = c.quotas[i]
+		index[&c.quotas[i]] = i
+	}
+	for remotePath, entry := range c.entries {
+		if entry.Pinned {
+			continue
+		}
+		if q := c.quotaForLocked(remotePath); q != nil {
+			usage[index[q]].Entries++
+			usage[index[q]].Bytes += entry.Size
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Prefix < usage[j].Prefix })
+	return usage
+}
@@ -0,0 +1,89 @@
+package filecache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiskCacheQuotaEvictsWithinTree(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	if err := cache.SetQuotas([]Quota{{Prefix: "/Users/me/big-data", MaxBytes: 10}}); err != nil {
+		t.Fatalf("SetQuotas failed: %v", err)
+	}
+	modTime := time.Now()
+	for _, p := range []string{"/Users/me/notes.txt", "/Users/me/big-data/a", "/Users/me/big-data/sub/b"} {
+		if _, err := cache.Set(p, []byte("12345"), modTime); err != nil {
+			t.Fatalf("Set %s failed: %v", p, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// A third file in the tree evicts the oldest one there, not the older
+	// file outside it.
+	if _, err := cache.Set("/Users/me/big-data/c", []byte("12345"), modTime); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	for p, want := range map[string]bool{
+		"/Users/me/notes.txt":      true,
+		"/Users/me/big-data/a":     false,
+		"/Users/me/big-data/sub/b": true,
+		"/Users/me/big-data/c":     true,
+	} {
+		if _, _, found := cache.Get(p, modTime); found != want {
+			t.Errorf("%s cached = %v, want %v", p, found, want)
+		}
+	}
+
+	// Content larger than the budget is refused and evicts nothing.
+	if _, err := cache.Set("/Users/me/big-data/huge", make([]byte, 11), modTime); err == nil || !strings.Contains(err.Error(), "quota") {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	want := []QuotaUsage{{Quota: Quota{Prefix: "/Users/me/big-data", MaxBytes: 10}, Entries: 2, Bytes: 10}}
+	if got := cache.QuotaStats(); len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("QuotaStats = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiskCacheQuotaLongestPrefixWins(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	modTime := time.Now()
+	for _, p := range []string{"/data/raw/a", "/data/b", "/database/c"} {
+		if _, err := cache.Set(p, []byte("1234"), modTime); err != nil {
+			t.Fatalf("Set %s failed: %v", p, err)
+		}
+	}
+	// Setting the quotas applies them to what is already cached.
+	if err := cache.SetQuotas([]Quota{{Prefix: "/data", MaxBytes: 100}, {Prefix: "/data/raw", MaxBytes: 1}}); err != nil {
+		t.Fatalf("SetQuotas failed: %v", err)
+	}
+	got := cache.QuotaStats()
+	if len(got) != 2 || got[0].Prefix != "/data" || got[0].Entries != 1 || got[1].Prefix != "/data/raw" || got[1].Entries != 0 {
+		t.Fatalf("QuotaStats = %+v", got)
+	}
+	if _, _, found := cache.Get("/database/c", modTime); !found {
+		t.Fatal("expected /database/c to be outside the /data quota")
+	}
+}
+
+func TestDiskCacheSetQuotasRejectsInvalid(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	for _, quotas := range [][]Quota{
+		{{Prefix: "relative", MaxBytes: 1}},
+		{{Prefix: "/data/", MaxBytes: 1}},
+		{{Prefix: "/data", MaxBytes: 0}},
+		{{Prefix: "/data", MaxBytes: 1}, {Prefix: "/data", MaxBytes: 2}},
+	} {
+		if err := cache.SetQuotas(quotas); err == nil {
+			t.Errorf("SetQuotas(%+v) succeeded, want an error", quotas)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package fuse
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/logging"
+)
+
+// accessList limits an --allow-other mount to the mount owner and the
+// listed users and groups. It is shared by every node of a mount.
+type accessList struct {
+	uids map[uint32]bool
+	gids map[uint32]bool
+	// groupsOf returns the supplementary groups of a process. FUSE only
+	// passes the caller's primary group.
+	groupsOf func(pid uint32) []uint32
+}
+
+// newAccessList returns nil when neither list is set, which allows every
+// caller.
+func newAccessList(uids, gids []uint32) *accessList {
+	if len(uids) == 0 && len(gids) == 0 {
+		return nil
+	}
+	a := &accessList{uids: make(map[uint32]bool), gids: make(map[uint32]bool), groupsOf: procGroups}
+	for _, uid := range uids {
+		a.uids[uid] = true
+	}
+	for _, gid := range gids {
+		a.gids[gid] = true
+	}
+	return a
+}
+
+// allows reports whether caller may use a mount owned by ownerUid.
+func (a *accessList) allows(caller *fuse.Caller, ownerUid uint32) bool {
+	if caller.Uid == ownerUid || a.uids[caller.Uid] || a.gids[caller.Gid] {
+		return true
+	}
+	if len(a.gids) == 0 {
+		return false
+	}
+	for _, gid := range a.groupsOf(caller.Pid) {
+		if a.gids[gid] {
+			return true
+		}
+	}
+	return false
+}
+
+// procGroups reads the supplementary groups of pid from /proc. A process
+// that is gone or unreadable has none.
+func procGroups(pid uint32) []uint32 {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rest, ok := strings.CutPrefix(scanner.Text(), "Groups:")
+		if !ok {
+			continue
+		}
+		var groups []uint32
+		for _, field := range strings.Fields(rest) {
+			if gid, err := strconv.ParseUint(field, 10, 32); err == nil {
+				groups = append(groups, uint32(gid))
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// checkCaller denies callers outside the access list with EACCES. The
+// kernel does not check permissions on an --allow-other mount, so every
+// operation that starts from a path or opens a file checks here.
+func (n *WSNode) checkCaller(ctx context.Context) syscall.Errno {
+	if n.access == nil {
+		return 0
+	}
+	caller, ok := fuse.FromContext(ctx)
+	if !ok {
+		logging.Warnf("Access: failed to get caller context for %s", n.Path())
+		return syscall.EACCES
+	}
+	if !n.access.allows(caller, n.cfg().OwnerUid) {
+		logging.Debugf("Access denied: UID %d GID %d is not allowed on %s", caller.Uid, caller.Gid, n.Path())
+		return syscall.EACCES
+	}
+	return 0
+}
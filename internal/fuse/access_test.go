@@ -0,0 +1,96 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/databricks"
+)
+
+func callerContext(uid, gid, pid uint32) context.Context {
+	return fuse.NewContext(context.Background(), &fuse.Caller{Owner: fuse.Owner{Uid: uid, Gid: gid}, Pid: pid})
+}
+
+func TestAccessListAllows(t *testing.T) {
+	a := newAccessList([]uint32{1001}, []uint32{2000})
+	a.groupsOf = func(pid uint32) []uint32 {
+		if pid == 7 {
+			return []uint32{100, 2000}
+		}
+		return []uint32{100}
+	}
+
+	tests := []struct {
+		name   string
+		caller fuse.Caller
+		want   bool
+	}{
+		{"owner", fuse.Caller{Owner: fuse.Owner{Uid: 1000, Gid: 100}}, true},
+		{"listed user", fuse.Caller{Owner: fuse.Owner{Uid: 1001, Gid: 100}}, true},
+		{"primary group", fuse.Caller{Owner: fuse.Owner{Uid: 1002, Gid: 2000}}, true},
+		{"supplementary group", fuse.Caller{Owner: fuse.Owner{Uid: 1003, Gid: 100}, Pid: 7}, true},
+		{"other user", fuse.Caller{Owner: fuse.Owner{Uid: 1004, Gid: 100}, Pid: 8}, false},
+	}
+	for _, tt := range tests {
+		if got := a.allows(&tt.caller, 1000); got != tt.want {
+			t.Errorf("%s: allows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if newAccessList(nil, nil) != nil {
+		t.Fatal("empty lists should allow every caller")
+	}
+}
+
+func TestAccessListDeniesOperations(t *testing.T) {
+	root, _ := newNameFixture(t, map[string]string{"a.txt": "a"}, &NodeConfig{OwnerUid: 1000, AllowedGids: []uint32{2000}})
+	root.access.groupsOf = func(uint32) []uint32 { return nil }
+
+	member := callerContext(1001, 2000, 1)
+	if _, errno := root.Lookup(member, "a.txt", &fuse.EntryOut{}); errno != 0 {
+		t.Fatalf("Lookup by a group member errno %d", errno)
+	}
+	if _, _, _, errno := root.Create(member, "b.txt", 0, 0644, &fuse.EntryOut{}); errno != 0 {
+		t.Fatalf("Create by a group member errno %d", errno)
+	}
+
+	other := callerContext(1002, 100, 1)
+	if _, errno := root.Lookup(other, "a.txt", &fuse.EntryOut{}); errno != syscall.EACCES {
+		t.Fatalf("Lookup by another user errno %d, want EACCES", errno)
+	}
+	if _, _, _, errno := root.Create(other, "c.txt", 0, 0644, &fuse.EntryOut{}); errno != syscall.EACCES {
+		t.Fatalf("Create by another user errno %d, want EACCES", errno)
+	}
+	if errno := root.Access(other, 0); errno != syscall.EACCES {
+		t.Fatalf("Access by another user errno %d, want EACCES", errno)
+	}
+
+	child := root.newChildNode(databricks.WSFileInfo{})
+	if child.access != root.access {
+		t.Fatal("child node does not share the access list")
+	}
+	if _, _, errno := child.Open(other, syscall.O_RDONLY); errno != syscall.EACCES {
+		t.Fatalf("Open by another user errno %d, want EACCES", errno)
+	}
+}
+
+func TestProcGroups(t *testing.T) {
+	want, err := os.Getgroups()
+	if err != nil {
+		t.Skipf("Getgroups: %v", err)
+	}
+	got := procGroups(uint32(os.Getpid()))
+	for _, gid := range want {
+		if !slices.Contains(got, uint32(gid)) {
+			t.Fatalf("procGroups = %v, missing %d", got, gid)
+		}
+	}
+	if groups := procGroups(0); groups != nil {
+		t.Fatalf("procGroups of a missing process = %v", groups)
+	}
+}
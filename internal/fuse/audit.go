@@ -0,0 +1,152 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	iofs "io/fs"
+	"time"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/filecache"
+	"wsfs/internal/logging"
+	"wsfs/internal/metrics"
+)
+
+// CacheAudit is the outcome of one AuditCache round.
+type CacheAudit struct {
+	Checked      int // entries compared with the workspace
+	Missing      int // file gone remotely
+	Stale        int // remote file has another version
+	SizeMismatch int // same version, different size
+	Healed       int // divergent entries invalidated
+	Errors       int // entries whose remote stat failed
+}
+
+// Divergent returns the number of entries that disagreed with the workspace.
+func (a CacheAudit) Divergent() int {
+	return a.Missing + a.Stale + a.SizeMismatch
+}
+
+// auditFinding is how a disk cache entry disagrees with the workspace.
+type auditFinding int
+
+const (
+	auditAgrees auditFinding = iota
+	auditMissing
+	auditStale
+	auditSizeMismatch
+)
+
+// AuditCache re-stats up to sample disk cache entries, chosen at random,
+// bypassing the metadata cache, and counts those that disagree with the
+// workspace. The fresh stats also refresh the metadata cache. With heal,
+// divergent entries are invalidated so the next read downloads the file
+// again. Entries of files with unflushed changes are skipped: their cached
+// content is local and ahead of the workspace.
+func (n *WSNode) AuditCache(ctx context.Context, sample int, heal bool) CacheAudit {
+	var audit CacheAudit
+	if n.diskCache == nil || n.diskCache.IsDisabled() {
+		return audit
+	}
+	dirty := make(map[string]bool)
+	if n.registry != nil {
+		for _, entry := range n.registry.Entries() {
+			dirty[entry.Path] = true
+		}
+	}
+
+	for _, entry := range n.diskCache.Sample(sample) {
+		if ctx.Err() != nil {
+			break
+		}
+		if dirty[entry.RemotePath] {
+			continue
+		}
+		kind, err := n.auditEntry(ctx, entry)
+		if err != nil {
+			if ctx.Err() == nil {
+				logging.Debugf("Cache audit: stat %s: %v", entry.RemotePath, err)
+				audit.Errors++
+			}
+			continue
+		}
+		audit.Checked++
+		metrics.CacheAuditChecked.Add(1)
+		switch kind {
+		case auditAgrees:
+			continue
+		case auditMissing:
+			audit.Missing++
+			metrics.CacheAuditMissing.Add(1)
+			logging.Warnf("Cache audit: %s is cached but no longer exists in the workspace", entry.RemotePath)
+		case auditStale:
+			audit.Stale++
+			metrics.CacheAuditStale.Add(1)
+			logging.Debugf("Cache audit: %s is cached at a version the workspace no longer has", entry.RemotePath)
+		case auditSizeMismatch:
+			audit.SizeMismatch++
+			metrics.CacheAuditSizeMismatch.Add(1)
+			logging.Warnf("Cache audit: %s is cached with %d bytes but the workspace has a different size for the same version", entry.RemotePath, entry.Size)
+		}
+		if heal && n.diskCache.DeleteVersion(entry.RemotePath, entry.ModTime) {
+			n.wfClient.CacheInvalidate(entry.RemotePath)
+			audit.Healed++
+			metrics.CacheAuditHealed.Add(1)
+		}
+	}
+	return audit
+}
+
+// auditEntry compares a disk cache entry with the file's fresh metadata and
+// returns how they disagree. Notebooks are cached as exported source, whose size the metadata
+// does not give, so only their version is compared.
+func (n *WSNode) auditEntry(ctx context.Context, entry filecache.Entry) (auditFinding, error) {
+	opCtx, cancel := context.WithTimeout(ctx, metadataOpTimeout)
+	defer cancel()
+	info, err := n.wfClient.StatFresh(opCtx, entry.RemotePath)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return auditMissing, nil
+	}
+	if err != nil {
+		return auditAgrees, err
+	}
+	if info.IsDir() {
+		return auditMissing, nil
+	}
+	if info.ModTime().UnixMilli() != entry.ModTime.UnixMilli() {
+		return auditStale, nil
+	}
+	if wsInfo, ok := info.(databricks.WSFileInfo); ok && wsInfo.IsNotebook() {
+		return auditAgrees, nil
+	}
+	if info.Size() != entry.Size {
+		return auditSizeMismatch, nil
+	}
+	return auditAgrees, nil
+}
+
+// WatchCache runs AuditCache every interval until ctx is done and logs a
+// summary of each round that found divergent entries.
+func (n *WSNode) WatchCache(ctx context.Context, interval time.Duration, sample int, heal bool) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		audit := n.AuditCache(ctx, sample, heal)
+		if ctx.Err() != nil {
+			return
+		}
+		if audit.Divergent() > 0 {
+			logging.Infof("Cache audit: %d of %d checked entries diverged (%d missing, %d stale, %d size mismatch), %d invalidated",
+				audit.Divergent(), audit.Checked, audit.Missing, audit.Stale, audit.SizeMismatch, audit.Healed)
+		}
+	}
+}
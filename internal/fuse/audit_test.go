@@ -0,0 +1,107 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/filecache"
+)
+
+func TestAuditCacheFindsAndHealsDivergentEntries(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Unix(1700000000, 0)
+	for name, content := range map[string]string{"same.txt": "same", "edited.txt": "new", "resized.txt": "longer"} {
+		full := filepath.Join(dir, name)
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := os.Chtimes(full, modTime, modTime); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+	local, err := backend.NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	cache, err := filecache.NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache: %v", err)
+	}
+	for path, version := range map[string]time.Time{
+		"/same.txt":    modTime,
+		"/edited.txt":  modTime.Add(-time.Hour),
+		"/resized.txt": modTime,
+		"/gone.txt":    modTime,
+	} {
+		content := "same"
+		if path == "/edited.txt" {
+			content = "old"
+		}
+		if _, err := cache.Set(path, []byte(content), version); err != nil {
+			t.Fatalf("Set %s: %v", path, err)
+		}
+	}
+	root, err := NewRootNode(local, cache, "/", NewDirtyNodeRegistry(), nil)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	ctx := context.Background()
+
+	audit := root.AuditCache(ctx, 10, false)
+	want := CacheAudit{Checked: 4, Missing: 1, Stale: 1, SizeMismatch: 1}
+	if audit != want {
+		t.Fatalf("audit = %+v, want %+v", audit, want)
+	}
+	if entries, _ := cache.GetStats(); entries != 4 {
+		t.Fatalf("report-only audit left %d entries, want 4", entries)
+	}
+
+	audit = root.AuditCache(ctx, 10, true)
+	if audit.Divergent() != 3 || audit.Healed != 3 {
+		t.Fatalf("healing audit = %+v", audit)
+	}
+	if paths := cache.GetCachedPaths(); len(paths) != 1 || paths[0] != "/same.txt" {
+		t.Fatalf("cached paths after healing = %v, want only /same.txt", paths)
+	}
+	if audit := root.AuditCache(ctx, 10, false); audit != (CacheAudit{Checked: 1}) {
+		t.Fatalf("audit after healing = %+v", audit)
+	}
+}
+
+func TestAuditCacheSamplesAndSkipsDirtyFiles(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{"a.txt": "a"}, nil)
+	cache, err := filecache.NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache: %v", err)
+	}
+	root.diskCache = cache
+	for i := 0; i < 5; i++ {
+		if _, err := cache.Set("/missing"+string(rune('0'+i)), []byte("x"), time.Now()); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	if audit := root.AuditCache(context.Background(), 2, false); audit.Checked != 2 || audit.Missing != 2 {
+		t.Fatalf("sampled audit = %+v, want 2 of the 5 entries checked", audit)
+	}
+
+	if err := cache.Clear(); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	created := createAndWrite(t, root, "new.txt", "draft")
+	if _, err := cache.Set(created.Path(), []byte("draft"), time.Now()); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if audit := root.AuditCache(context.Background(), 10, true); audit != (CacheAudit{}) {
+		t.Fatalf("audit of a dirty file = %+v, want it skipped", audit)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("new.txt uploaded by the audit: %v", err)
+	}
+}
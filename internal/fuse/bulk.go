@@ -0,0 +1,171 @@
+package fuse
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"wsfs/internal/logging"
+)
+
+const (
+	// bulkCreateThreshold creates within bulkCreateWindow switch the mount
+	// into bulk import mode, as when an archive is extracted into it.
+	bulkCreateThreshold = 16
+	bulkCreateWindow    = time.Second
+
+	// bulkMaxFileSize is the largest new file whose upload is handed to the
+	// bulk importer. Larger files are uploaded on close as usual.
+	bulkMaxFileSize = 1 << 20
+
+	// bulkProgressInterval is how often progress of a running bulk import
+	// is logged.
+	bulkProgressInterval = 5 * time.Second
+)
+
+// bulkImporter uploads small newly created files in the background while
+// many files are being created in a short time. Each file is uploaded once
+// it is closed, with at most workers uploads in flight. A file whose upload
+// fails stays dirty, so .wsfs/dirty lists it and the unmount flush retries
+// it. It is shared by every node of a mount.
+type bulkImporter struct {
+	workers chan struct{}
+	now     func() time.Time
+
+	mu            sync.Mutex
+	windowStart   time.Time
+	windowCreates int
+	activeUntil   time.Time
+	queued        int
+	uploaded      int
+	failed        int
+	lastProgress  time.Time
+	pending       sync.WaitGroup
+}
+
+func newBulkImporter(workers int) *bulkImporter {
+	return &bulkImporter{workers: make(chan struct{}, workers), now: time.Now}
+}
+
+// noteCreate records a created file and extends bulk mode while creates
+// keep arriving faster than bulkCreateThreshold per bulkCreateWindow.
+func (b *bulkImporter) noteCreate() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if now.Sub(b.windowStart) > bulkCreateWindow {
+		b.windowStart = now
+		b.windowCreates = 0
+	}
+	b.windowCreates++
+	if b.windowCreates >= bulkCreateThreshold {
+		if !b.activeLocked(now) {
+			logging.Infof("Bulk import: %d files created within %s, uploading new files in the background", b.windowCreates, bulkCreateWindow)
+		}
+		b.activeUntil = now.Add(bulkCreateWindow)
+	}
+}
+
+func (b *bulkImporter) activeLocked(now time.Time) bool {
+	return now.Before(b.activeUntil)
+}
+
+// accepts reports whether a closed new file of size bytes should be
+// uploaded in the background.
+func (b *bulkImporter) accepts(size int64) bool {
+	if size > bulkMaxFileSize {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.activeLocked(b.now())
+}
+
+// enqueue uploads node in the background. The caller holds node.mu and
+// has marked the node bulkPending.
+func (b *bulkImporter) enqueue(node *WSNode) {
+	b.mu.Lock()
+	if b.queued == b.uploaded+b.failed {
+		b.lastProgress = b.now()
+	}
+	b.queued++
+	b.mu.Unlock()
+
+	b.pending.Add(1)
+	go func() {
+		defer b.pending.Done()
+		b.workers <- struct{}{}
+		defer func() { <-b.workers }()
+		b.finish(node.bulkUpload())
+	}()
+}
+
+// finish counts a finished upload and logs progress.
+func (b *bulkImporter) finish(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ok {
+		b.uploaded++
+	} else {
+		b.failed++
+	}
+	done := b.uploaded + b.failed
+	if done == b.queued {
+		logging.Infof("Bulk import: uploaded %d file(s), %d failed", b.uploaded, b.failed)
+		b.queued, b.uploaded, b.failed = 0, 0, 0
+		return
+	}
+	if now := b.now(); now.Sub(b.lastProgress) >= bulkProgressInterval {
+		logging.Infof("Bulk import: uploaded %d of %d file(s), %d failed", b.uploaded, b.queued, b.failed)
+		b.lastProgress = now
+	}
+}
+
+// wait blocks until every queued upload has finished.
+func (b *bulkImporter) wait() {
+	b.pending.Wait()
+}
+
+// bulkUpload flushes a node queued by the bulk importer. A node that was
+// reopened in the meantime is left to its own Release, and one that was
+// already flushed, unlinked or renamed over is skipped.
+func (n *WSNode) bulkUpload() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.bulkPending = false
+	if n.openCount > 0 || !n.isDirtyLocked() {
+		return true
+	}
+	if errno := n.writeBackLocked(context.Background()); errno != 0 {
+		return false
+	}
+	if n.openCount == 0 && !n.isDirtyLocked() {
+		n.resetBufferLocked()
+	}
+	return true
+}
+
+// releaseToBulkLocked hands the upload of a just-closed new file to the bulk
+// importer and reports whether it did.
+func (n *WSNode) releaseToBulkLocked() bool {
+	if n.bulk == nil || !n.bulkEligible || n.buf.Data == nil {
+		return false
+	}
+	n.bulkEligible = false
+	if !n.bulk.accepts(int64(len(n.buf.Data))) {
+		return false
+	}
+	n.bulkPending = true
+	n.bulk.enqueue(n)
+	return true
+}
+
+// discardBulkUploadLocked drops a queued upload of a file that is being
+// unlinked, so the upload does not recreate it.
+func (n *WSNode) discardBulkUploadLocked() {
+	if !n.bulkPending {
+		return
+	}
+	n.bulkPending = false
+	n.resetBufferLocked()
+}
@@ -0,0 +1,250 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/databricks"
+)
+
+// importBackend is a local backend whose uploads of non-empty content can
+// be held back, failed and counted.
+type importBackend struct {
+	databricks.WorkspaceFilesAPI
+	gate     chan struct{} // uploads wait for it when set
+	fail     atomic.Bool
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (b *importBackend) Write(ctx context.Context, filePath string, data []byte) error {
+	if len(data) == 0 {
+		return b.WorkspaceFilesAPI.Write(ctx, filePath, data)
+	}
+	n := b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	for {
+		peak := b.peak.Load()
+		if n <= peak || b.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	if b.gate != nil {
+		<-b.gate
+	}
+	time.Sleep(time.Millisecond)
+	if b.fail.Load() {
+		return errors.New("upload refused")
+	}
+	return b.WorkspaceFilesAPI.Write(ctx, filePath, data)
+}
+
+func newImportRoot(t *testing.T, workers int) (*WSNode, *importBackend, string, *DirtyNodeRegistry) {
+	t.Helper()
+	dir := t.TempDir()
+	local, err := backend.NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	api := &importBackend{WorkspaceFilesAPI: local}
+	registry := NewDirtyNodeRegistry()
+	root, err := NewRootNode(api, nil, "/", registry, &NodeConfig{BulkImportWorkers: workers})
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	return root, api, dir, registry
+}
+
+// extract creates, writes and closes count files like tar would.
+func extract(t *testing.T, root *WSNode, prefix string, count int) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("%s%03d.txt", prefix, i)
+		child, _, _, errno := root.Create(ctx, name, 0, 0644, &fuse.EntryOut{})
+		if errno != 0 {
+			t.Fatalf("Create %s errno %d", name, errno)
+		}
+		// The FUSE bridge links created inodes into the tree.
+		root.AddChild(name, child, true)
+		node := child.Operations().(*WSNode)
+		if _, errno := node.Write(ctx, nil, []byte("content of "+name), 0); errno != 0 {
+			t.Fatalf("Write %s errno %d", name, errno)
+		}
+		if errno := node.Release(ctx, nil); errno != 0 {
+			t.Fatalf("Release %s errno %d", name, errno)
+		}
+	}
+}
+
+// startBurst extracts enough files to put root into bulk import mode and
+// waits for their uploads.
+func startBurst(t *testing.T, root *WSNode) {
+	t.Helper()
+	extract(t, root, "warm", bulkCreateThreshold)
+	root.bulk.wait()
+}
+
+func assertExtracted(t *testing.T, dir string, prefix string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("%s%03d.txt", prefix, i)
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != "content of "+name {
+			t.Fatalf("%s on disk = %q, %v", name, got, err)
+		}
+	}
+}
+
+func TestBulkImportUploadsConcurrently(t *testing.T) {
+	root, api, dir, registry := newImportRoot(t, 4)
+	startBurst(t, root)
+	api.gate = make(chan struct{})
+
+	const count = 3 * bulkCreateThreshold
+	extract(t, root, "file", count)
+	// Every file was closed without waiting for its upload.
+	if registry.Count() != count {
+		t.Fatalf("dirty files = %d, want the %d queued uploads", registry.Count(), count)
+	}
+	close(api.gate)
+	root.bulk.wait()
+
+	assertExtracted(t, dir, "file", count)
+	if registry.Count() != 0 {
+		t.Fatalf("dirty files after the import = %v", registry.Entries())
+	}
+	if peak := api.peak.Load(); peak != 4 {
+		t.Fatalf("peak concurrent uploads = %d, want 4", peak)
+	}
+}
+
+func TestBulkImportOffUploadsOnClose(t *testing.T) {
+	for _, workers := range []int{0, 4} {
+		root, api, dir, registry := newImportRoot(t, workers)
+		// Fewer creates than the threshold never start a bulk import.
+		count := bulkCreateThreshold - 1
+		if workers == 0 {
+			count = 2 * bulkCreateThreshold
+		}
+		extract(t, root, "file", count)
+		assertExtracted(t, dir, "file", count)
+		if registry.Count() != 0 || api.peak.Load() != 1 {
+			t.Fatalf("workers=%d: dirty=%d peak=%d, want synchronous uploads", workers, registry.Count(), api.peak.Load())
+		}
+	}
+}
+
+func TestBulkImportLargeFilesUploadOnClose(t *testing.T) {
+	root, _, dir, registry := newImportRoot(t, 4)
+	startBurst(t, root)
+
+	ctx := context.Background()
+	child, _, _, errno := root.Create(ctx, "big.bin", 0, 0644, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Create errno %d", errno)
+	}
+	node := child.Operations().(*WSNode)
+	if _, errno := node.Write(ctx, nil, make([]byte, bulkMaxFileSize+1), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "big.bin")); err != nil || info.Size() != bulkMaxFileSize+1 {
+		t.Fatalf("big.bin was not uploaded on close: %v", err)
+	}
+	root.bulk.wait()
+	if registry.Count() != 0 {
+		t.Fatalf("dirty files after the import = %v", registry.Entries())
+	}
+}
+
+func TestBulkImportFailedUploadStaysDirty(t *testing.T) {
+	root, api, dir, registry := newImportRoot(t, 4)
+	startBurst(t, root)
+	api.fail.Store(true)
+
+	const count = 8
+	extract(t, root, "file", count)
+	root.bulk.wait()
+
+	// Close succeeded, so the failures are kept for a retry and shown.
+	if registry.Count() != count {
+		t.Fatalf("dirty files = %d, want %d", registry.Count(), count)
+	}
+	if root.errors.count() != count {
+		t.Fatalf("files with a last error = %d, want %d", root.errors.count(), count)
+	}
+
+	api.fail.Store(false)
+	if _, errs := registry.FlushAll(context.Background()); len(errs) != 0 {
+		t.Fatalf("FlushAll: %v", errs)
+	}
+	assertExtracted(t, dir, "file", count)
+}
+
+func TestBulkImportUnlinkDropsQueuedUpload(t *testing.T) {
+	root, api, dir, registry := newImportRoot(t, 1)
+	startBurst(t, root)
+	api.gate = make(chan struct{})
+
+	const count = 3
+	extract(t, root, "file", count)
+
+	last := fmt.Sprintf("file%03d.txt", count-1)
+	if errno := root.Unlink(context.Background(), last); errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	close(api.gate)
+	root.bulk.wait()
+
+	if _, err := os.Stat(filepath.Join(dir, last)); !os.IsNotExist(err) {
+		t.Fatalf("queued upload recreated %s: %v", last, err)
+	}
+	if registry.Count() != 0 {
+		t.Fatalf("dirty files after the import = %v", registry.Entries())
+	}
+}
+
+func TestBulkImporterMode(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newBulkImporter(1)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < bulkCreateThreshold-1; i++ {
+		b.noteCreate()
+	}
+	if b.accepts(1) {
+		t.Fatal("bulk mode before the threshold")
+	}
+	b.noteCreate()
+	if !b.accepts(1) {
+		t.Fatal("no bulk mode at the threshold")
+	}
+	if b.accepts(bulkMaxFileSize + 1) {
+		t.Fatal("accepted a file above bulkMaxFileSize")
+	}
+
+	now = now.Add(bulkCreateWindow / 2)
+	b.noteCreate()
+	now = now.Add(bulkCreateWindow * 3 / 4)
+	if !b.accepts(1) {
+		t.Fatal("bulk mode ended while creates kept arriving")
+	}
+	now = now.Add(bulkCreateWindow)
+	if b.accepts(1) {
+		t.Fatal("bulk mode outlived the burst")
+	}
+}
@@ -0,0 +1,79 @@
+package fuse
+
+import (
+	"context"
+	"testing"
+)
+
+func newExcludingFixture(t *testing.T, patterns ...string) *manageFixture {
+	t.Helper()
+	f := newManageFixture(t)
+	if err := f.cache.SetExcludePatterns(patterns); err != nil {
+		t.Fatalf("SetExcludePatterns: %v", err)
+	}
+	return f
+}
+
+func TestExcludedFileReadStaysInMemory(t *testing.T) {
+	f := newExcludingFixture(t, "*.CSV")
+	ctx := context.Background()
+
+	node := f.lookup("src", "lib", "data.csv")
+	node.mu.Lock()
+	errno := node.ensureDataLocked(ctx)
+	data, cachedPath := string(node.buf.Data), node.buf.CachedPath
+	node.mu.Unlock()
+	if errno != 0 {
+		t.Fatalf("ensureDataLocked errno %d", errno)
+	}
+	if data != "a,b\n1,2\n" || cachedPath != "" {
+		t.Fatalf("buffer = %q, cached path %q; want content in memory only", data, cachedPath)
+	}
+	if entries, _ := f.cache.GetStats(); entries != 0 {
+		t.Fatalf("disk cache has %d entries, want 0", entries)
+	}
+
+	// Other files still use the disk cache.
+	other := f.lookup("src", "main.py")
+	other.mu.Lock()
+	errno = other.ensureDataLocked(ctx)
+	cachedPath = other.buf.CachedPath
+	other.mu.Unlock()
+	if errno != 0 || cachedPath == "" {
+		t.Fatalf("expected main.py in the disk cache, errno=%d path=%q", errno, cachedPath)
+	}
+}
+
+func TestExcludedFileFlushSkipsDiskCache(t *testing.T) {
+	f := newExcludingFixture(t, "*.csv")
+	node := f.lookup("src", "lib", "data.csv")
+	f.write(node, "x,y\n")
+
+	flushed, errs := f.root.FlushPaths(context.Background(), []string{"/src"})
+	if len(errs) != 0 || flushed != 1 {
+		t.Fatalf("FlushPaths = %d, %v; want 1 flush", flushed, errs)
+	}
+	if got := f.onDisk("src/lib/data.csv"); got != "x,y\n1,2\n" {
+		t.Fatalf("data.csv not flushed: %q", got)
+	}
+	if paths := f.cache.GetCachedPaths(); len(paths) != 0 {
+		t.Fatalf("disk cache holds %v after flush, want nothing", paths)
+	}
+}
+
+func TestPrefetchCountsExcludedFiles(t *testing.T) {
+	f := newExcludingFixture(t, "*.csv")
+
+	result, err := f.root.Prefetch(context.Background(), "/src")
+	if err != nil {
+		t.Fatalf("Prefetch: %v", err)
+	}
+	if result.Files != 2 || result.Excluded != 1 || result.Skipped != 0 {
+		t.Fatalf("Prefetch = %+v, want 2 files and 1 excluded", result)
+	}
+	for _, p := range f.cache.GetCachedPaths() {
+		if p == "/src/lib/data.csv" {
+			t.Fatalf("excluded file was prefetched into the disk cache")
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package fuse
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/filecache"
+)
+
+// skewedServer stores uploads and stamps them with a clock that is offset
+// from the local one, as a workspace whose clock disagrees with the host.
+type skewedServer struct {
+	skew       time.Duration
+	data       []byte
+	modifiedAt int64
+	reads      int
+}
+
+func (s *skewedServer) api() *databricks.FakeWorkspaceAPI {
+	return &databricks.FakeWorkspaceAPI{
+		StatFunc: func(ctx context.Context, filePath string) (fs.FileInfo, error) {
+			return databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+				ObjectType: workspace.ObjectTypeFile,
+				Path:       filePath,
+				Size:       int64(len(s.data)),
+				ModifiedAt: s.modifiedAt,
+				ObjectId:   7,
+			}}, nil
+		},
+		WriteFunc: func(ctx context.Context, filePath string, data []byte) error {
+			s.data = append([]byte(nil), data...)
+			s.modifiedAt = time.Now().Add(s.skew).UnixMilli()
+			return nil
+		},
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			s.reads++
+			return append([]byte(nil), s.data...), nil
+		},
+	}
+}
+
+func newSkewedNode(t *testing.T, server *skewedServer) (*WSNode, *filecache.DiskCache) {
+	t.Helper()
+	cache, err := filecache.NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache: %v", err)
+	}
+	server.data = []byte("v1")
+	server.modifiedAt = time.Now().Add(server.skew - time.Minute).UnixMilli()
+	info, _ := server.api().Stat(context.Background(), "/skew.txt")
+	node := &WSNode{
+		wfClient:  server.api(),
+		diskCache: cache,
+		fileInfo:  info.(databricks.WSFileInfo),
+		errors:    newErrorLog(),
+	}
+	return node, cache
+}
+
+func TestOwnUploadSurvivesClockSkew(t *testing.T) {
+	for _, skew := range []time.Duration{-time.Hour, time.Hour} {
+		server := &skewedServer{skew: skew}
+		node, cache := newSkewedNode(t, server)
+		ctx := context.Background()
+
+		node.mu.Lock()
+		if errno := node.ensureDataForMutationLocked(ctx); errno != 0 {
+			t.Fatalf("skew %s: load errno %d", skew, errno)
+		}
+		node.buf.Data = []byte("v2")
+		node.markModifiedLocked(time.Now())
+		node.markDirtyLocked(dirtyData)
+		if errno := node.flushLocked(ctx); errno != 0 {
+			t.Fatalf("skew %s: flush errno %d", skew, errno)
+		}
+
+		// The server's ModifiedAt for our upload differs from the local
+		// clock reading by the skew; that alone is not a remote change.
+		changed, errno := node.refreshMetadataLocked(ctx, true)
+		if errno != 0 || changed {
+			t.Fatalf("skew %s: refresh after own upload = changed %v, errno %d", skew, changed, errno)
+		}
+		if node.fileInfo.ModifiedAt != server.modifiedAt || node.modifiedAtIsLocal {
+			t.Fatalf("skew %s: server ModifiedAt not adopted", skew)
+		}
+		if node.buf.Data == nil {
+			t.Fatalf("skew %s: clean buffer was dropped", skew)
+		}
+		node.clearCachedFileLocked()
+		node.buf.Data = nil
+		if errno := node.ensureDataLocked(ctx); errno != 0 || node.buf.CachedPath == "" {
+			t.Fatalf("skew %s: expected a disk cache hit, errno %d", skew, errno)
+		}
+		node.mu.Unlock()
+		if server.reads != 1 {
+			t.Fatalf("skew %s: expected only the initial remote read, got %d", skew, server.reads)
+		}
+		if _, _, found := cache.Get("/skew.txt", node.fileInfo.ModTime()); !found {
+			t.Fatalf("skew %s: cache entry not restamped with the server version", skew)
+		}
+	}
+}
+
+func TestRemoteChangeWithOlderTimestampIsDetected(t *testing.T) {
+	server := &skewedServer{}
+	node, _ := newSkewedNode(t, server)
+	ctx := context.Background()
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if errno := node.ensureDataLocked(ctx); errno != 0 {
+		t.Fatalf("load errno %d", errno)
+	}
+
+	// Another client whose clock runs behind writes a new version with the
+	// same size: its ModifiedAt is older than the one we know.
+	server.data = []byte("v9")
+	server.modifiedAt -= time.Hour.Milliseconds()
+	changed, errno := node.refreshMetadataLocked(ctx, true)
+	if errno != 0 || !changed {
+		t.Fatalf("refresh = changed %v, errno %d; want a detected change", changed, errno)
+	}
+	if errno := node.ensureDataLocked(ctx); errno != 0 {
+		t.Fatalf("reload errno %d", errno)
+	}
+	if server.reads != 2 {
+		t.Fatalf("expected the new version to be fetched, got %d reads", server.reads)
+	}
+}
+
+func TestOwnUploadThenForeignSizeChangeIsDetected(t *testing.T) {
+	server := &skewedServer{skew: time.Hour}
+	node, _ := newSkewedNode(t, server)
+	ctx := context.Background()
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.buf.Data = []byte("v2")
+	node.markModifiedLocked(time.Now())
+	node.markDirtyLocked(dirtyData)
+	if errno := node.flushLocked(ctx); errno != 0 {
+		t.Fatalf("flush errno %d", errno)
+	}
+
+	server.data = []byte("rewritten elsewhere")
+	changed, errno := node.refreshMetadataLocked(ctx, true)
+	if errno != 0 || !changed {
+		t.Fatalf("refresh = changed %v, errno %d; want a detected change", changed, errno)
+	}
+}
+
+func TestFileCreatedHereKeepsContentWhenServerAssignsID(t *testing.T) {
+	server := &skewedServer{skew: time.Hour}
+	node, _ := newSkewedNode(t, server)
+	ctx := context.Background()
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	// A file created through the mount has no object ID before its first
+	// upload.
+	node.fileInfo.ObjectId = 0
+	node.buf.Data = []byte("new")
+	node.markModifiedLocked(time.Now())
+	node.markDirtyLocked(dirtyData | dirtyCreate)
+	if errno := node.flushLocked(ctx); errno != 0 {
+		t.Fatalf("flush errno %d", errno)
+	}
+
+	changed, errno := node.refreshMetadataLocked(ctx, true)
+	if errno != 0 || changed {
+		t.Fatalf("refresh after creating upload = changed %v, errno %d", changed, errno)
+	}
+	if node.fileInfo.ObjectId != 7 || node.buf.Data == nil {
+		t.Fatalf("object ID %d, buffer kept %v; want the server's ID and the buffer", node.fileInfo.ObjectId, node.buf.Data != nil)
+	}
+	if server.reads != 0 {
+		t.Fatalf("expected no download of the uploaded content, got %d reads", server.reads)
+	}
+}
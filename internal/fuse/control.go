@@ -0,0 +1,174 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/metrics"
+)
+
+// controlDirName is the virtual directory exposed at the mount root for
+// runtime introspection. It is not backed by the workspace, is hidden from
+// directory listings, and shadows a real workspace entry of the same name.
+const controlDirName = ".wsfs"
+
+// controlDir is the read-only directory behind /.wsfs.
+type controlDir struct {
+	fs.Inode
+	files    map[string]func() []byte
+	ownerUid uint32
+	ownerGid uint32
+}
+
+// controlFile is a read-only file whose content is generated on open.
+type controlFile struct {
+	fs.Inode
+	generate func() []byte
+	ownerUid uint32
+	ownerGid uint32
+}
+
+type controlHandle struct {
+	data []byte
+}
+
+var _ = (fs.NodeLookuper)((*controlDir)(nil))
+var _ = (fs.NodeReaddirer)((*controlDir)(nil))
+var _ = (fs.NodeGetattrer)((*controlDir)(nil))
+var _ = (fs.NodeGetattrer)((*controlFile)(nil))
+var _ = (fs.NodeOpener)((*controlFile)(nil))
+var _ = (fs.NodeReader)((*controlFile)(nil))
+
+// isControlName reports whether name is a virtual entry of the mount: the
+// control directory at the root, or an --objectinfo-files listing. Neither
+// can be created, removed or renamed.
+func (n *WSNode) isControlName(name string) bool {
+	return n.isRoot && name == controlDirName || n.isObjectInfoName(name)
+}
+
+// controlFiles lists the generated files available under /.wsfs.
+func (n *WSNode) controlFiles() map[string]func() []byte {
+	files := map[string]func() []byte{}
+	if n.errors != nil {
+		files["errors"] = n.errors.render
+	}
+	if n.registry != nil {
+		files["dirty"] = n.registry.render
+	}
+	files["transfers"] = renderTransfers
+	return files
+}
+
+// renderTransfers lists in-flight uploads, one
+// "path<TAB>percent<TAB>sent/total bytes<TAB>rate" line each, oldest first.
+func renderTransfers() []byte {
+	var b strings.Builder
+	for _, status := range metrics.ActiveTransfers() {
+		fmt.Fprintf(&b, "%s\t%.1f%%\t%d/%d bytes\t%.0f B/s\n",
+			status.Path, status.Percent(), status.Sent, status.Total, status.Rate())
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	return []byte(b.String())
+}
+
+func (n *WSNode) lookupControlDir(ctx context.Context, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	dir := &controlDir{files: n.controlFiles(), ownerUid: n.cfg().OwnerUid, ownerGid: n.cfg().OwnerGid}
+	dir.fillAttr(&out.Attr)
+	n.setEntryOutTimeouts(out)
+
+	if existing := n.GetChild(controlDirName); existing != nil {
+		return existing, 0
+	}
+	child := n.NewPersistentInode(ctx, dir, fs.StableAttr{Mode: syscall.S_IFDIR, Ino: hashStringToIno("wsfs-control:" + controlDirName)})
+	return child, 0
+}
+
+func (d *controlDir) fillAttr(out *fuse.Attr) {
+	out.Mode = syscall.S_IFDIR | 0555
+	out.Nlink = dirNlink
+	out.Uid = d.ownerUid
+	out.Gid = d.ownerGid
+	now := uint64(time.Now().Unix())
+	out.Mtime, out.Atime, out.Ctime = now, now, now
+}
+
+func (d *controlDir) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	d.fillAttr(&out.Attr)
+	return 0
+}
+
+func (d *controlDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	names := make([]string, 0, len(d.files))
+	for name := range d.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]fuse.DirEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: syscall.S_IFREG})
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+func (d *controlDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	generate, ok := d.files[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	file := &controlFile{generate: generate, ownerUid: d.ownerUid, ownerGid: d.ownerGid}
+	file.fillAttr(&out.Attr)
+	// Content changes on every read, so never let the kernel cache entries.
+	out.SetEntryTimeout(0)
+	out.SetAttrTimeout(0)
+
+	if existing := d.GetChild(name); existing != nil {
+		return existing, 0
+	}
+	return d.NewPersistentInode(ctx, file, fs.StableAttr{Mode: syscall.S_IFREG, Ino: hashStringToIno("wsfs-control:" + name)}), 0
+}
+
+func (f *controlFile) fillAttr(out *fuse.Attr) {
+	out.Mode = syscall.S_IFREG | 0444
+	out.Nlink = fileNlink
+	out.Size = uint64(len(f.generate()))
+	out.Uid = f.ownerUid
+	out.Gid = f.ownerGid
+	now := uint64(time.Now().Unix())
+	out.Mtime, out.Atime, out.Ctime = now, now, now
+}
+
+func (f *controlFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	f.fillAttr(&out.Attr)
+	out.SetTimeout(0)
+	return 0
+}
+
+func (f *controlFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC|syscall.O_APPEND) != 0 {
+		return nil, 0, syscall.EACCES
+	}
+	// Snapshot the content so sequential reads of one open see consistent data.
+	return &controlHandle{data: f.generate()}, fuse.FOPEN_DIRECT_IO, 0
+}
+
+func (f *controlFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	handle, ok := fh.(*controlHandle)
+	if !ok {
+		return nil, syscall.EBADF
+	}
+	if off >= int64(len(handle.data)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := min(off+int64(len(dest)), int64(len(handle.data)))
+	return fuse.ReadResultData(handle.data[off:end]), 0
+}
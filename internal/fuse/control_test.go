@@ -0,0 +1,85 @@
+package fuse
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/metrics"
+)
+
+func TestControlFileReadsSnapshotPerOpen(t *testing.T) {
+	content := "first\n"
+	file := &controlFile{generate: func() []byte { return []byte(content) }}
+	ctx := context.Background()
+
+	fh, flags, errno := file.Open(ctx, syscall.O_RDONLY)
+	if errno != 0 {
+		t.Fatalf("Open errno: %d", errno)
+	}
+	if flags&fuse.FOPEN_DIRECT_IO == 0 {
+		t.Fatal("expected FOPEN_DIRECT_IO")
+	}
+	content = "second\n"
+
+	result, errno := file.Read(ctx, fh, make([]byte, 3), 2)
+	if errno != 0 {
+		t.Fatalf("Read errno: %d", errno)
+	}
+	got, _ := result.Bytes(nil)
+	if string(got) != "rst" {
+		t.Fatalf("expected snapshot data, got %q", got)
+	}
+
+	result, _ = file.Read(ctx, fh, make([]byte, 16), 100)
+	if got, _ := result.Bytes(nil); len(got) != 0 {
+		t.Fatalf("expected EOF, got %q", got)
+	}
+}
+
+func TestControlFileRejectsWrites(t *testing.T) {
+	file := &controlFile{generate: func() []byte { return nil }}
+	if _, _, errno := file.Open(context.Background(), syscall.O_WRONLY); errno != syscall.EACCES {
+		t.Fatalf("expected EACCES, got %d", errno)
+	}
+}
+
+func TestRootControlNameIsReserved(t *testing.T) {
+	root := &WSNode{isRoot: true, errors: newErrorLog()}
+	child := &WSNode{}
+	if !root.isControlName(controlDirName) {
+		t.Fatal("expected root to reserve the control directory name")
+	}
+	if child.isControlName(controlDirName) {
+		t.Fatal("expected non-root directories to allow the name")
+	}
+	if errno := root.Unlink(context.Background(), controlDirName); errno != syscall.EPERM {
+		t.Fatalf("expected EPERM, got %d", errno)
+	}
+	if _, ok := root.controlFiles()["errors"]; !ok {
+		t.Fatal("expected errors control file")
+	}
+}
+
+func TestControlTransfersListsActiveUploads(t *testing.T) {
+	root := &WSNode{isRoot: true, errors: newErrorLog()}
+	render, ok := root.controlFiles()["transfers"]
+	if !ok {
+		t.Fatal("expected transfers control file")
+	}
+
+	transfer := metrics.StartTransfer("/Users/me/big.bin", 400)
+	transfer.SetSent(100)
+	got := string(render())
+	if !strings.Contains(got, "/Users/me/big.bin\t25.0%\t100/400 bytes\t") || !strings.HasSuffix(got, " B/s\n") {
+		t.Fatalf("unexpected transfers content %q", got)
+	}
+
+	transfer.Finish()
+	if strings.Contains(string(render()), "/Users/me/big.bin") {
+		t.Fatal("expected finished transfer to disappear")
+	}
+}
@@ -0,0 +1,51 @@
+package fuse
+
+import (
+	"crypto/sha256"
+
+	"wsfs/internal/databricks"
+)
+
+const (
+	// deltaChunkSize is the granularity used to detect changed regions.
+	deltaChunkSize = 4 * 1024 * 1024
+	// deltaMinFileSize is the smallest file for which chunk hashes are tracked.
+	// Smaller files are cheaper to upload whole.
+	deltaMinFileSize = 4 * deltaChunkSize
+)
+
+type chunkSum [sha256.Size]byte
+
+// chunkChecksums hashes data in deltaChunkSize pieces.
+func chunkChecksums(data []byte) []chunkSum {
+	sums := make([]chunkSum, 0, (len(data)+deltaChunkSize-1)/deltaChunkSize)
+	for off := 0; off < len(data); off += deltaChunkSize {
+		end := min(off+deltaChunkSize, len(data))
+		sums = append(sums, sha256.Sum256(data[off:end]))
+	}
+	return sums
+}
+
+// changedChunks returns the chunks of data that differ from the remote chunk
+// hashes. Chunks beyond the remote length are always included.
+func changedChunks(remote []chunkSum, data []byte) []databricks.Chunk {
+	var chunks []databricks.Chunk
+	for i, off := 0, 0; off < len(data); i, off = i+1, off+deltaChunkSize {
+		end := min(off+deltaChunkSize, len(data))
+		piece := data[off:end]
+		if i < len(remote) && sha256.Sum256(piece) == remote[i] {
+			continue
+		}
+		chunks = append(chunks, databricks.Chunk{Offset: int64(off), Data: piece})
+	}
+	return chunks
+}
+
+// chunkWriterLocked returns the backend's ChunkWriter when delta uploads
+// are possible for this node.
+func (n *WSNode) chunkWriterLocked() (databricks.ChunkWriter, bool) {
+	if n.fileInfo.IsNotebook() {
+		return nil, false
+	}
+	return databricks.ChunkWriterFor(n.wfClient, n.Path())
+}
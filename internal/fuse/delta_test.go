@@ -0,0 +1,239 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/databricks"
+	"wsfs/internal/metrics"
+)
+
+type chunkWriterAPI struct {
+	*databricks.FakeWorkspaceAPI
+	writeChunks func(ctx context.Context, filePath string, size int64, chunks []databricks.Chunk) error
+}
+
+func (a *chunkWriterAPI) WriteChunks(ctx context.Context, filePath string, size int64, chunks []databricks.Chunk) error {
+	return a.writeChunks(ctx, filePath, size, chunks)
+}
+
+func TestChangedChunksDetectsModifiedAndAppendedChunks(t *testing.T) {
+	original := bytes.Repeat([]byte("a"), 3*deltaChunkSize)
+	remote := chunkChecksums(original)
+	if len(remote) != 3 {
+		t.Fatalf("expected 3 chunk sums, got %d", len(remote))
+	}
+
+	modified := append(bytes.Clone(original), []byte("tail")...)
+	modified[deltaChunkSize+10] = 'b'
+
+	chunks := changedChunks(remote, modified)
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 changed chunks, got %d", len(chunks))
+	}
+	if chunks[0].Offset != deltaChunkSize || len(chunks[0].Data) != deltaChunkSize {
+		t.Fatalf("unexpected first chunk: offset=%d len=%d", chunks[0].Offset, len(chunks[0].Data))
+	}
+	if chunks[1].Offset != 3*deltaChunkSize || string(chunks[1].Data) != "tail" {
+		t.Fatalf("unexpected appended chunk: offset=%d data=%q", chunks[1].Offset, chunks[1].Data)
+	}
+}
+
+func TestChangedChunksUnchangedData(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), deltaChunkSize+1)
+	if chunks := changedChunks(chunkChecksums(data), data); len(chunks) != 0 {
+		t.Fatalf("expected no changed chunks, got %d", len(chunks))
+	}
+}
+
+func newDeltaTestNode(api databricks.WorkspaceFilesAPI, size int) *WSNode {
+	return &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeFile,
+			Path:       "/large.bin",
+			Size:       int64(size),
+		}},
+	}
+}
+
+func TestFlushUploadsOnlyChangedChunks(t *testing.T) {
+	original := bytes.Repeat([]byte("a"), deltaMinFileSize)
+	fullWrites := 0
+	var gotSize int64
+	var gotChunks []databricks.Chunk
+	api := &chunkWriterAPI{
+		FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{
+			ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+				return bytes.Clone(original), nil
+			},
+			WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+				fullWrites++
+				return nil
+			},
+		},
+		writeChunks: func(ctx context.Context, filePath string, size int64, chunks []databricks.Chunk) error {
+			gotSize = size
+			gotChunks = chunks
+			return nil
+		},
+	}
+	n := newDeltaTestNode(api, len(original))
+	ctx := context.Background()
+	savedBefore := metrics.UploadBytesSaved.Value()
+	deltaBefore := metrics.DeltaUploads.Value()
+
+	if _, errno := n.Write(ctx, nil, []byte("b"), int64(2*deltaChunkSize)); errno != 0 {
+		t.Fatalf("Write errno: %d", errno)
+	}
+	if errno := n.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("Fsync errno: %d", errno)
+	}
+
+	if fullWrites != 0 {
+		t.Fatalf("expected no full upload, got %d", fullWrites)
+	}
+	if gotSize != int64(len(original)) {
+		t.Fatalf("expected size %d, got %d", len(original), gotSize)
+	}
+	if len(gotChunks) != 1 || gotChunks[0].Offset != int64(2*deltaChunkSize) {
+		t.Fatalf("expected single chunk at %d, got %d chunks", 2*deltaChunkSize, len(gotChunks))
+	}
+	if got := metrics.DeltaUploads.Value() - deltaBefore; got != 1 {
+		t.Fatalf("expected one delta upload, got %d", got)
+	}
+	if got := metrics.UploadBytesSaved.Value() - savedBefore; got != int64(len(original)-deltaChunkSize) {
+		t.Fatalf("expected %d saved bytes, got %d", len(original)-deltaChunkSize, got)
+	}
+}
+
+func TestFlushFallsBackToFullUploadWhenDeltaFails(t *testing.T) {
+	original := bytes.Repeat([]byte("a"), deltaMinFileSize)
+	fullWrites := 0
+	api := &chunkWriterAPI{
+		FakeWorkspaceAPI: &databricks.FakeWorkspaceAPI{
+			ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+				return bytes.Clone(original), nil
+			},
+			WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+				fullWrites++
+				return nil
+			},
+		},
+		writeChunks: func(ctx context.Context, filePath string, size int64, chunks []databricks.Chunk) error {
+			return errors.New("compose not supported")
+		},
+	}
+	n := newDeltaTestNode(api, len(original))
+	ctx := context.Background()
+
+	if _, errno := n.Write(ctx, nil, []byte("b"), 0); errno != 0 {
+		t.Fatalf("Write errno: %d", errno)
+	}
+	if errno := n.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("Fsync errno: %d", errno)
+	}
+	if fullWrites != 1 {
+		t.Fatalf("expected fallback full upload, got %d", fullWrites)
+	}
+}
+
+func TestFlushWithoutChunkWriterUploadsWholeFile(t *testing.T) {
+	original := bytes.Repeat([]byte("a"), deltaMinFileSize)
+	var uploaded int
+	api := &databricks.FakeWorkspaceAPI{
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			return bytes.Clone(original), nil
+		},
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			uploaded = len(data)
+			return nil
+		},
+	}
+	n := newDeltaTestNode(api, len(original))
+	ctx := context.Background()
+
+	if _, errno := n.Write(ctx, nil, []byte("b"), 0); errno != 0 {
+		t.Fatalf("Write errno: %d", errno)
+	}
+	if n.buf.RemoteChunks != nil {
+		t.Fatal("expected no chunk hashes without a ChunkWriter backend")
+	}
+	if errno := n.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("Fsync errno: %d", errno)
+	}
+	if uploaded != len(original) {
+		t.Fatalf("expected full upload of %d bytes, got %d", len(original), uploaded)
+	}
+}
+
+func TestFlushPatchesLocalBackendFileInPlace(t *testing.T) {
+	original := bytes.Repeat([]byte("a"), deltaMinFileSize)
+	root, dir := newNameFixture(t, map[string]string{"large.bin": string(original)}, nil)
+	ctx := context.Background()
+
+	var out fuse.EntryOut
+	child, errno := root.Lookup(ctx, "large.bin", &out)
+	if errno != 0 {
+		t.Fatalf("Lookup errno %d", errno)
+	}
+	n := child.Operations().(*WSNode)
+	deltaBefore := metrics.DeltaUploads.Value()
+	fullBefore := metrics.FullUploads.Value()
+
+	if _, errno := n.Write(ctx, nil, []byte("b"), int64(deltaChunkSize)); errno != 0 {
+		t.Fatalf("Write errno: %d", errno)
+	}
+	if _, errno := n.Write(ctx, nil, []byte("tail"), int64(len(original))); errno != 0 {
+		t.Fatalf("Write errno: %d", errno)
+	}
+	if errno := n.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("Fsync errno: %d", errno)
+	}
+
+	if got := metrics.DeltaUploads.Value() - deltaBefore; got != 1 {
+		t.Fatalf("expected one delta upload, got %d", got)
+	}
+	if got := metrics.FullUploads.Value() - fullBefore; got != 0 {
+		t.Fatalf("expected no full upload, got %d", got)
+	}
+	want := bytes.Clone(original)
+	want[deltaChunkSize] = 'b'
+	want = append(want, "tail"...)
+	got, err := os.ReadFile(filepath.Join(dir, "large.bin"))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("patched file differs: %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestFlushDeltaSupportFollowsRoutes(t *testing.T) {
+	local, err := backend.NewLocalBackend(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	router := backend.NewRouter(&databricks.FakeWorkspaceAPI{}, backend.Route{Prefix: "/local", Backend: local})
+
+	remote := newDeltaTestNode(router, deltaMinFileSize)
+	remote.rememberRemoteContentLocked("sum", make([]byte, deltaMinFileSize))
+	if _, ok := remote.chunkWriterLocked(); ok || remote.buf.RemoteChunks != nil {
+		t.Fatal("expected no delta upload support for a path on a plain backend")
+	}
+
+	routed := newDeltaTestNode(router, deltaMinFileSize)
+	routed.fileInfo.Path = "/local/large.bin"
+	routed.rememberRemoteContentLocked("sum", make([]byte, deltaMinFileSize))
+	if _, ok := routed.chunkWriterLocked(); !ok || routed.buf.RemoteChunks == nil {
+		t.Fatal("expected delta upload support for a path on the local backend")
+	}
+}
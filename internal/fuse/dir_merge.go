@@ -0,0 +1,61 @@
+package fuse
+
+import (
+	"sort"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// virtualEntry is a name a directory serves without a workspace object
+// behind it, such as /.wsfs or .wsfs-objectinfo.json.
+type virtualEntry struct {
+	entry fuse.DirEntry
+	// listed entries show up in readdir. The others are opened by name only,
+	// so editors and indexers do not walk into them.
+	listed bool
+}
+
+// mergeDirEntries builds a directory listing from its three sources:
+// virtual entries, the workspace objects and the files created through the
+// mount that are not uploaded yet. A name appears at most once and, as in
+// Lookup, the first source that has it wins: a virtual entry shadows a
+// workspace object of the same name, listed or not, and a workspace object
+// hides the pending create it came from. The result is sorted by name, so
+// a listing does not depend on the order the workspace API returns.
+func mergeDirEntries(virtual []virtualEntry, remote, pending []fuse.DirEntry) []fuse.DirEntry {
+	merged := make([]fuse.DirEntry, 0, len(virtual)+len(remote)+len(pending))
+	seen := make(map[string]struct{}, cap(merged))
+	for _, v := range virtual {
+		if _, ok := seen[v.entry.Name]; ok {
+			continue
+		}
+		seen[v.entry.Name] = struct{}{}
+		if v.listed {
+			merged = append(merged, v.entry)
+		}
+	}
+	for _, entries := range [][]fuse.DirEntry{remote, pending} {
+		for _, e := range entries {
+			if _, ok := seen[e.Name]; ok {
+				continue
+			}
+			seen[e.Name] = struct{}{}
+			merged = append(merged, e)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Name < merged[j].Name })
+	return merged
+}
+
+// virtualEntries returns the virtual names this directory serves.
+func (n *WSNode) virtualEntries() []virtualEntry {
+	var virtual []virtualEntry
+	if n.isRoot {
+		virtual = append(virtual, virtualEntry{entry: fuse.DirEntry{Name: controlDirName, Mode: syscall.S_IFDIR}})
+	}
+	if n.cfg().ObjectInfoFiles {
+		virtual = append(virtual, virtualEntry{entry: fuse.DirEntry{Name: objectInfoFileName, Mode: syscall.S_IFREG}})
+	}
+	return virtual
+}
@@ -0,0 +1,50 @@
+package fuse
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestMergeDirEntries(t *testing.T) {
+	virtual := []virtualEntry{
+		{entry: fuse.DirEntry{Name: ".wsfs", Ino: 1}},
+		{entry: fuse.DirEntry{Name: "listed", Ino: 2}, listed: true},
+	}
+	remote := []fuse.DirEntry{
+		{Name: "c.txt", Ino: 10}, {Name: ".wsfs", Ino: 11}, {Name: "a.txt", Ino: 12},
+		{Name: "listed", Ino: 13}, {Name: "a.txt", Ino: 14},
+	}
+	pending := []fuse.DirEntry{{Name: "b.txt", Ino: 20}, {Name: "c.txt", Ino: 21}}
+
+	got := mergeDirEntries(virtual, remote, pending)
+	want := []fuse.DirEntry{
+		{Name: "a.txt", Ino: 12}, {Name: "b.txt", Ino: 20}, {Name: "c.txt", Ino: 10}, {Name: "listed", Ino: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged = %v, want %v", got, want)
+	}
+}
+
+func TestMergeDirEntriesIsDeterministic(t *testing.T) {
+	a := mergeDirEntries(nil, []fuse.DirEntry{{Name: "b"}, {Name: "a"}, {Name: "B"}}, nil)
+	b := mergeDirEntries(nil, []fuse.DirEntry{{Name: "B"}, {Name: "a"}, {Name: "b"}}, nil)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("order depends on input: %v vs %v", a, b)
+	}
+	if got, want := dirEntryNames(a), []string{"B", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("names = %q, want %q", got, want)
+	}
+}
+
+func TestReaddirDropsShadowedEntries(t *testing.T) {
+	files := map[string]string{
+		"b.txt": "b", "a.txt": "a", ".wsfs": "real", objectInfoFileName: "real",
+	}
+	root, _ := newNameFixture(t, files, &NodeConfig{ObjectInfoFiles: true})
+
+	if got, want := readdirNames(t, root), []string{"a.txt", "b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("listing = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package fuse
+
+import (
+	"context"
+	"sort"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// dirStream serves the listing of one open directory handle. The offsets
+// it hands out, which the kernel passes back to resume a partial readdir
+// and which telldir returns, are cookies that stand for entry names, not
+// positions. Seeking to a cookie resumes after its name, so the names
+// listed before and after stay in order even if entries were added or
+// removed meanwhile: no entry is listed twice and none that still exists
+// is skipped. Seeking to 0, as rewinddir does, lists the directory again.
+//
+// The workspace API returns a directory in one response, so the stream
+// keeps the whole listing; the cookies stay valid across relistings for
+// the lifetime of the handle.
+type dirStream struct {
+	list    func(context.Context) ([]fuse.DirEntry, syscall.Errno)
+	entries []fuse.DirEntry // sorted by name
+	next    int             // index of the next entry to return
+	served  bool            // whether entries were returned since the listing
+
+	cookies map[string]uint64 // name -> cookie
+	names   map[uint64]string // cookie -> name
+}
+
+func newDirStream(entries []fuse.DirEntry, list func(context.Context) ([]fuse.DirEntry, syscall.Errno)) *dirStream {
+	d := &dirStream{
+		list:    list,
+		cookies: make(map[string]uint64),
+		names:   make(map[uint64]string),
+	}
+	d.setEntries(entries)
+	return d
+}
+
+func (d *dirStream) setEntries(entries []fuse.DirEntry) {
+	d.entries = entries
+	sort.SliceStable(d.entries, func(i, j int) bool { return d.entries[i].Name < d.entries[j].Name })
+	d.next = 0
+	d.served = false
+}
+
+func (d *dirStream) HasNext() bool {
+	return d.next < len(d.entries)
+}
+
+func (d *dirStream) Next() (fuse.DirEntry, syscall.Errno) {
+	e := d.entries[d.next]
+	d.next++
+	d.served = true
+	e.Off = d.cookie(e.Name)
+	return e, 0
+}
+
+// cookie returns the cookie of name, assigning the next one on first use.
+// 0 is reserved for the start of the stream.
+func (d *dirStream) cookie(name string) uint64 {
+	if c, ok := d.cookies[name]; ok {
+		return c
+	}
+	c := uint64(len(d.cookies) + 1)
+	d.cookies[name] = c
+	d.names[c] = name
+	return c
+}
+
+func (d *dirStream) Seekdir(ctx context.Context, off uint64) syscall.Errno {
+	if off == 0 {
+		if !d.served {
+			d.next = 0
+			return 0
+		}
+		entries, errno := d.list(ctx)
+		if errno != 0 {
+			return errno
+		}
+		d.setEntries(entries)
+		return 0
+	}
+	name, ok := d.names[off]
+	if !ok {
+		return syscall.EINVAL
+	}
+	d.next = sort.Search(len(d.entries), func(i int) bool { return d.entries[i].Name > name })
+	return 0
+}
+
+func (d *dirStream) Close() {}
@@ -0,0 +1,146 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func dirEntries(names ...string) []fuse.DirEntry {
+	entries := make([]fuse.DirEntry, len(names))
+	for i, name := range names {
+		entries[i] = fuse.DirEntry{Name: name, Mode: syscall.S_IFREG}
+	}
+	return entries
+}
+
+// readRest returns the names left in d and the cookie of each.
+func readRest(t *testing.T, d fs.DirStream) ([]string, []uint64) {
+	t.Helper()
+	var names []string
+	var cookies []uint64
+	for d.HasNext() {
+		e, errno := d.Next()
+		if errno != 0 {
+			t.Fatalf("Next errno %d", errno)
+		}
+		names = append(names, e.Name)
+		cookies = append(cookies, e.Off)
+	}
+	return names, cookies
+}
+
+func TestDirStreamSeekResumesAfterNameAcrossRelisting(t *testing.T) {
+	listing := dirEntries("a", "b", "c", "d")
+	d := newDirStream(dirEntries("d", "b", "a", "c"), func(context.Context) ([]fuse.DirEntry, syscall.Errno) {
+		return listing, 0
+	})
+	ctx := context.Background()
+
+	names, cookies := readRest(t, d)
+	if !reflect.DeepEqual(names, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("names = %v, want them sorted", names)
+	}
+	afterB := cookies[1]
+
+	// A position would now point one entry earlier and list b again.
+	listing = dirEntries("0", "a", "b", "bb", "d")
+	if errno := d.Seekdir(ctx, 0); errno != 0 {
+		t.Fatalf("Seekdir(0) errno %d", errno)
+	}
+	if errno := d.Seekdir(ctx, afterB); errno != 0 {
+		t.Fatalf("Seekdir errno %d", errno)
+	}
+	names, cookies = readRest(t, d)
+	if !reflect.DeepEqual(names, []string{"bb", "d"}) {
+		t.Fatalf("names after seek = %v, want the entries after b", names)
+	}
+	if cookies[1] != afterB+2 {
+		t.Fatalf("cookie of d = %d, want the one handed out before (%d)", cookies[1], afterB+2)
+	}
+
+	// The cookie of a removed name still resumes at its place.
+	listing = dirEntries("0", "a", "d")
+	if errno := d.Seekdir(ctx, 0); errno != 0 {
+		t.Fatalf("Seekdir(0) errno %d", errno)
+	}
+	if errno := d.Seekdir(ctx, afterB); errno != 0 {
+		t.Fatalf("Seekdir errno %d", errno)
+	}
+	if names, _ := readRest(t, d); !reflect.DeepEqual(names, []string{"d"}) {
+		t.Fatalf("names after seek = %v, want d", names)
+	}
+
+	if errno := d.Seekdir(ctx, 1000); errno != syscall.EINVAL {
+		t.Fatalf("Seekdir to an unknown cookie errno %d, want EINVAL", errno)
+	}
+}
+
+func TestDirStreamRewindListsAgainOnlyAfterReading(t *testing.T) {
+	calls := 0
+	d := newDirStream(dirEntries("a"), func(context.Context) ([]fuse.DirEntry, syscall.Errno) {
+		calls++
+		return dirEntries("a", "b"), 0
+	})
+	ctx := context.Background()
+
+	if errno := d.Seekdir(ctx, 0); errno != 0 || calls != 0 {
+		t.Fatalf("Seekdir(0) of a fresh stream: errno %d, %d listings", errno, calls)
+	}
+	readRest(t, d)
+	if errno := d.Seekdir(ctx, 0); errno != 0 || calls != 1 {
+		t.Fatalf("rewind: errno %d, %d listings", errno, calls)
+	}
+	if names, _ := readRest(t, d); !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatalf("names after rewind = %v", names)
+	}
+}
+
+func TestOpendirHandleSeekdirWithConcurrentCreates(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c"}, nil)
+	ctx := context.Background()
+
+	fh, _, errno := root.OpendirHandle(ctx, 0)
+	if errno != 0 {
+		t.Fatalf("OpendirHandle errno %d", errno)
+	}
+	h := fh.(*dirStreamHandle)
+	var cookie uint64
+	for range 2 {
+		e, errno := h.Readdirent(ctx)
+		if errno != 0 || e == nil {
+			t.Fatalf("Readdirent = %v, errno %d", e, errno)
+		}
+		cookie = e.Off
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "0.txt"), nil, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if errno := h.Seekdir(ctx, 0); errno != 0 {
+		t.Fatalf("Seekdir(0) errno %d", errno)
+	}
+	if errno := h.Seekdir(ctx, cookie); errno != 0 {
+		t.Fatalf("Seekdir errno %d", errno)
+	}
+	var names []string
+	for {
+		e, errno := h.Readdirent(ctx)
+		if errno != 0 {
+			t.Fatalf("Readdirent errno %d", errno)
+		}
+		if e == nil {
+			break
+		}
+		names = append(names, e.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"c.txt"}) {
+		t.Fatalf("names after seek = %v, want c.txt only", names)
+	}
+}
@@ -1,12 +1,16 @@
 package fuse
 
 import (
+	"context"
 	"errors"
 	iofs "io/fs"
+	"net/http"
 	"strings"
 	"syscall"
 
 	"github.com/databricks/databricks-sdk-go/apierr"
+
+	"wsfs/internal/metrics"
 )
 
 type backendOp string
@@ -41,7 +45,54 @@ func isDeleteDirNotEmptyError(err error) bool {
 	return strings.Contains(message, "directory_not_empty") || strings.Contains(message, "is not empty")
 }
 
+// transientErrno maps errors that say nothing about the object itself. A
+// request the kernel interrupted (Ctrl-C) becomes EINTR. A call that ran
+// out of its deadline, timed out on the network or got a gateway timeout
+// becomes ETIMEDOUT, so slowness is not mistaken for a refusal. Node state
+// is left as it was before the call, so repeating the syscall retries the
+// backend request.
+func transientErrno(err error) (syscall.Errno, bool) {
+	var timeout interface{ Timeout() bool }
+	var apiError *apierr.APIError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return syscall.EINTR, true
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &timeout) && timeout.Timeout(),
+		errors.As(err, &apiError) && (apiError.StatusCode == http.StatusGatewayTimeout || apiError.StatusCode == http.StatusRequestTimeout):
+		return syscall.ETIMEDOUT, true
+	}
+	return 0, false
+}
+
+// errnoFromBackendError maps a failed backend call to the errno returned to
+// the kernel and counts it in the backend_* failure metrics.
 func errnoFromBackendError(op backendOp, err error) syscall.Errno {
+	errno := mapBackendError(op, err)
+	countBackendFailure(errno)
+	return errno
+}
+
+// countBackendFailure counts a failed backend call by what it means for
+// the user: a timeout, an interrupted call, a refusal, or an error.
+// Missing objects are normal lookups and not counted.
+func countBackendFailure(errno syscall.Errno) {
+	switch errno {
+	case 0, syscall.ENOENT:
+	case syscall.ETIMEDOUT:
+		metrics.BackendTimeouts.Add(1)
+	case syscall.EINTR:
+		metrics.BackendInterrupted.Add(1)
+	case syscall.EIO:
+		metrics.BackendErrors.Add(1)
+	default:
+		metrics.BackendRejections.Add(1)
+	}
+}
+
+// mapBackendError maps a failed backend call to an errno without counting
+// it, for callers that only inspect the error.
+func mapBackendError(op backendOp, err error) syscall.Errno {
 	if err == nil {
 		return 0
 	}
@@ -53,6 +104,9 @@ func errnoFromBackendError(op backendOp, err error) syscall.Errno {
 	if errors.As(err, &errno) {
 		return errno
 	}
+	if errno, ok := transientErrno(err); ok {
+		return errno
+	}
 
 	var apiError *apierr.APIError
 	if errors.As(err, &apiError) {
@@ -101,3 +155,12 @@ func errnoFromBackendError(op backendOp, err error) syscall.Errno {
 
 	return syscall.EIO
 }
+
+// failureVerb describes errno in a log line: "timed out" for a timeout,
+// "failed" otherwise.
+func failureVerb(errno syscall.Errno) string {
+	if errno == syscall.ETIMEDOUT {
+		return "timed out"
+	}
+	return "failed"
+}
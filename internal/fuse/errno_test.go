@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	iofs "io/fs"
+	"net/url"
 	"syscall"
 	"testing"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/databricks/databricks-sdk-go/service/workspace"
 
 	"wsfs/internal/databricks"
+	"wsfs/internal/metrics"
 )
 
 func testAPIError(statusCode int, errorCode string, message string) error {
@@ -78,12 +80,42 @@ func TestErrnoFromBackendError(t *testing.T) {
 			err:  testAPIError(400, "UNKNOWN", "RESOURCE_DOES_NOT_EXIST: The parent folder (/tmp) does not exist."),
 			want: syscall.ENOENT,
 		},
+		{
+			name: "notebook too large",
+			op:   backendOpWrite,
+			err:  &databricks.NotebookTooLargeError{Path: "/nb", Size: 11 << 20, Err: testAPIError(400, "MAX_NOTEBOOK_SIZE_EXCEEDED", "too big")},
+			want: syscall.EFBIG,
+		},
 		{
 			name: "fallback to eio",
 			op:   backendOpWrite,
 			err:  testAPIError(500, "UNKNOWN", "backend exploded"),
 			want: syscall.EIO,
 		},
+		{
+			name: "interrupted request",
+			op:   backendOpRead,
+			err:  fmt.Errorf("Get https://host/api: %w", context.Canceled),
+			want: syscall.EINTR,
+		},
+		{
+			name: "operation timeout",
+			op:   backendOpRead,
+			err:  fmt.Errorf("Get https://host/api: %w", context.DeadlineExceeded),
+			want: syscall.ETIMEDOUT,
+		},
+		{
+			name: "network timeout",
+			op:   backendOpWrite,
+			err:  &url.Error{Op: "Post", URL: "https://host/api", Err: timeoutError{}},
+			want: syscall.ETIMEDOUT,
+		},
+		{
+			name: "gateway timeout",
+			op:   backendOpLookup,
+			err:  testAPIError(504, "", "upstream request timeout"),
+			want: syscall.ETIMEDOUT,
+		},
 		{
 			name: "delete dir unrelated unknown stays eio",
 			op:   backendOpDeleteDir,
@@ -103,6 +135,97 @@ func TestErrnoFromBackendError(t *testing.T) {
 	}
 }
 
+func TestErrnoFromBackendErrorCountsFailures(t *testing.T) {
+	counters := []*metrics.Counter{metrics.BackendTimeouts, metrics.BackendInterrupted, metrics.BackendRejections, metrics.BackendErrors}
+	before := make([]int64, len(counters))
+	for i, c := range counters {
+		before[i] = c.Value()
+	}
+
+	errnoFromBackendError(backendOpRead, context.DeadlineExceeded)
+	errnoFromBackendError(backendOpRead, context.Canceled)
+	errnoFromBackendError(backendOpWrite, testAPIError(403, "PERMISSION_DENIED", "denied"))
+	errnoFromBackendError(backendOpWrite, testAPIError(500, "UNKNOWN", "boom"))
+	errnoFromBackendError(backendOpLookup, iofs.ErrNotExist)
+	mapBackendError(backendOpRead, context.DeadlineExceeded)
+
+	for i, c := range counters {
+		if got := c.Value() - before[i]; got != 1 {
+			t.Errorf("%s grew by %d, want 1", c.Name(), got)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func TestWSNodeReadRetriesAfterTimeout(t *testing.T) {
+	calls := 0
+	api := &databricks.FakeWorkspaceAPI{
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			calls++
+			if calls == 1 {
+				return nil, fmt.Errorf("read %s: %w", filePath, context.DeadlineExceeded)
+			}
+			return []byte("hello"), nil
+		},
+	}
+	node := &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeFile,
+			Path:       "/slow.txt",
+			Size:       5,
+		}},
+		errors: newErrorLog(),
+	}
+
+	dest := make([]byte, 16)
+	timeouts := metrics.BackendTimeouts.Value()
+	if _, errno := node.Read(context.Background(), nil, dest, 0); errno != syscall.ETIMEDOUT {
+		t.Fatalf("expected ETIMEDOUT on timeout, got %d", errno)
+	}
+	if got := metrics.BackendTimeouts.Value() - timeouts; got != 1 {
+		t.Fatalf("backend_timeouts grew by %d, want 1", got)
+	}
+	if node.buf.Data != nil || node.buf.CachedPath != "" || node.buf.FileSize != 0 {
+		t.Fatalf("timed-out read left partial state: %+v", node.buf)
+	}
+
+	result, errno := node.Read(context.Background(), nil, dest, 0)
+	if errno != 0 {
+		t.Fatalf("retry errno %d", errno)
+	}
+	if got, _ := result.Bytes(dest); string(got) != "hello" || calls != 2 {
+		t.Fatalf("retry read %q after %d calls", got, calls)
+	}
+}
+
+func TestWSNodeInterruptedReadReturnsEINTR(t *testing.T) {
+	api := &databricks.FakeWorkspaceAPI{
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	node := &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeFile,
+			Path:       "/slow.txt",
+		}},
+		errors: newErrorLog(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, errno := node.Read(ctx, nil, make([]byte, 16), 0); errno != syscall.EINTR {
+		t.Fatalf("expected EINTR, got %d", errno)
+	}
+}
+
 func TestWSNodeEnsureDataLockedMapsPermissionDenied(t *testing.T) {
 	api := &databricks.FakeWorkspaceAPI{
 		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
@@ -0,0 +1,99 @@
+package fuse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ExecMode selects the execute bits reported for regular files.
+type ExecMode int
+
+const (
+	// ExecNone reports no execute bits, even when the file mode has them,
+	// so nothing on the mount can be run.
+	ExecNone ExecMode = iota
+	// ExecAll adds an execute bit wherever a read bit is set.
+	ExecAll
+	// ExecByExtension marks scripts as executable: files with a script
+	// extension, and files without an extension whose content starts with
+	// "#!" when the content is in memory or in the disk cache.
+	ExecByExtension
+)
+
+// scriptExtensions are the extensions ExecByExtension treats as scripts.
+var scriptExtensions = map[string]bool{
+	".sh":      true,
+	".bash":    true,
+	".zsh":     true,
+	".ksh":     true,
+	".command": true,
+}
+
+// ParseExecMode parses none, all or by-extension.
+func ParseExecMode(value string) (ExecMode, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "none", "":
+		return ExecNone, nil
+	case "all":
+		return ExecAll, nil
+	case "by-extension":
+		return ExecByExtension, nil
+	}
+	return ExecNone, fmt.Errorf("%q (want none, all or by-extension)", value)
+}
+
+// execBitsLocked returns the execute bits to add to the permission bits
+// mode of a regular file: one for each read bit.
+func (n *WSNode) execBitsLocked(mode uint32) uint32 {
+	switch n.cfg().ExecMode {
+	case ExecAll:
+	case ExecByExtension:
+		if !n.isScriptLocked() {
+			return 0
+		}
+	default:
+		return 0
+	}
+	return (mode & 0444) >> 2
+}
+
+func (n *WSNode) isScriptLocked() bool {
+	if n.fileInfo.IsNotebook() {
+		return false
+	}
+	if ext := path.Ext(n.fileInfo.Name()); ext != "" {
+		return scriptExtensions[strings.ToLower(ext)]
+	}
+	return n.hasShebangLocked()
+}
+
+// hasShebangLocked reports whether the content starts with "#!". Content
+// that is neither in memory nor in the disk cache is not downloaded for
+// this, so such a file is not a script until it has been read once.
+func (n *WSNode) hasShebangLocked() bool {
+	shebang := []byte("#!")
+	if n.buf.Data != nil {
+		return bytes.HasPrefix(n.buf.Data, shebang)
+	}
+	cachedPath := n.buf.CachedPath
+	if cachedPath == "" && n.usesDiskCache(n.fileInfo.Path) {
+		cachedPath, _, _ = n.diskCache.Get(n.fileInfo.Path, n.fileInfo.ModTime())
+	}
+	if cachedPath == "" {
+		return false
+	}
+	f, err := os.Open(cachedPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(shebang))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false
+	}
+	return bytes.Equal(head, shebang)
+}
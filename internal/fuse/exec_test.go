@@ -0,0 +1,99 @@
+package fuse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/filecache"
+)
+
+func fileMode(t *testing.T, n *WSNode) uint32 {
+	t.Helper()
+	var out fuse.Attr
+	n.fillAttr(context.Background(), &out)
+	return out.Mode & 0777
+}
+
+func execTestNode(filePath string, objectType workspace.ObjectType, mode ExecMode) *WSNode {
+	return &WSNode{
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: objectType,
+			Path:       filePath,
+			ModifiedAt: 1000,
+		}},
+		config: &NodeConfig{ExecMode: mode},
+	}
+}
+
+func TestExecModeBits(t *testing.T) {
+	tests := []struct {
+		name string
+		node *WSNode
+		want uint32
+	}{
+		{"none", execTestNode("/run.sh", workspace.ObjectTypeFile, ExecNone), 0644},
+		{"all", execTestNode("/data.csv", workspace.ObjectTypeFile, ExecAll), 0755},
+		{"script extension", execTestNode("/run.SH", workspace.ObjectTypeFile, ExecByExtension), 0755},
+		{"other extension", execTestNode("/main.py", workspace.ObjectTypeFile, ExecByExtension), 0644},
+		{"notebook", execTestNode("/job", workspace.ObjectTypeNotebook, ExecByExtension), 0644},
+		{"no extension, content unknown", execTestNode("/deploy", workspace.ObjectTypeFile, ExecByExtension), 0644},
+	}
+	for _, tt := range tests {
+		if got := fileMode(t, tt.node); got != tt.want {
+			t.Errorf("%s: mode = %o, want %o", tt.name, got, tt.want)
+		}
+	}
+
+	// Execute bits follow the read bits of the configured mode.
+	n := execTestNode("/run.sh", workspace.ObjectTypeFile, ExecAll)
+	n.config.FileMode = 0640
+	if got := fileMode(t, n); got != 0750 {
+		t.Fatalf("mode with --file-mode=0640 = %o, want 750", got)
+	}
+	n = execTestNode("/run.sh", workspace.ObjectTypeFile, ExecNone)
+	n.config.FileMode = 0755
+	if got := fileMode(t, n); got != 0644 {
+		t.Fatalf("mode with --file-mode=0755 = %o, want the execute bits dropped", got)
+	}
+}
+
+func TestExecModeShebang(t *testing.T) {
+	n := execTestNode("/deploy", workspace.ObjectTypeFile, ExecByExtension)
+	n.buf.Data = []byte("#!/bin/sh\necho hi\n")
+	if got := fileMode(t, n); got != 0755 {
+		t.Fatalf("buffered script mode = %o, want 755", got)
+	}
+	n.buf.Data = []byte("plain text\n")
+	if got := fileMode(t, n); got != 0644 {
+		t.Fatalf("buffered text mode = %o, want 644", got)
+	}
+
+	cache, err := filecache.NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache: %v", err)
+	}
+	n = execTestNode("/deploy", workspace.ObjectTypeFile, ExecByExtension)
+	n.diskCache = cache
+	if _, err := cache.Set("/deploy", []byte("#!/usr/bin/env bash\n"), n.fileInfo.ModTime()); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got := fileMode(t, n); got != 0755 {
+		t.Fatalf("cached script mode = %o, want 755", got)
+	}
+}
+
+func TestParseExecMode(t *testing.T) {
+	for value, want := range map[string]ExecMode{"": ExecNone, "none": ExecNone, "ALL": ExecAll, "by-extension": ExecByExtension} {
+		if got, err := ParseExecMode(value); err != nil || got != want {
+			t.Errorf("ParseExecMode(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := ParseExecMode("shebang"); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+}
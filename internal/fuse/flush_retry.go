@@ -0,0 +1,150 @@
+package fuse
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"wsfs/internal/logging"
+	"wsfs/internal/metrics"
+	"wsfs/internal/retry"
+)
+
+// DefaultFlushRetryAttempts is how many background retries a failed flush
+// gets by default. With DefaultFlushRetryConfig's backoff they span about
+// six minutes, enough to ride out a network blip or a short outage.
+const DefaultFlushRetryAttempts = 8
+
+// FlushRetryConfig controls how the registry retries failed flushes of
+// dirty files in the background.
+type FlushRetryConfig struct {
+	// Attempts is how many retries a failed flush gets before wsfs gives
+	// up until the application flushes the file again. Zero turns
+	// retries off.
+	Attempts int
+	// Backoff spaces the attempts. Its MaxRetries is not used.
+	Backoff retry.Config
+}
+
+// DefaultFlushRetryConfig returns the default background retry settings.
+func DefaultFlushRetryConfig() FlushRetryConfig {
+	return FlushRetryConfig{
+		Attempts: DefaultFlushRetryAttempts,
+		Backoff: retry.Config{
+			InitialDelay:  2 * time.Second,
+			MaxDelay:      2 * time.Minute,
+			BackoffFactor: retry.DefaultBackoffFactor,
+			Jitter:        retry.DefaultJitter,
+		},
+	}
+}
+
+// flushRetry is the retry state of one dirty node whose flush failed.
+type flushRetry struct {
+	attempts int
+	timer    *time.Timer // pending attempt, nil while none is scheduled
+}
+
+// StartFlushRetries makes the registry retry failed flushes with backoff
+// until ctx is done. Without it a failed flush waits for the application
+// to flush the file again.
+func (r *DirtyNodeRegistry) StartFlushRetries(ctx context.Context, cfg FlushRetryConfig) {
+	r.mu.Lock()
+	r.retryCtx = ctx
+	r.retryConfig = cfg
+	r.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for node := range r.retries {
+			r.cancelRetryLocked(node)
+		}
+	}()
+}
+
+// retryableFlushErrno reports whether a flush that failed with errno may
+// succeed unchanged later. Refusals such as EACCES or EFBIG would fail
+// again.
+func retryableFlushErrno(errno syscall.Errno) bool {
+	switch errno {
+	case syscall.EIO, syscall.ETIMEDOUT, syscall.EAGAIN, syscall.EINTR:
+		return true
+	}
+	return false
+}
+
+// flushFailed schedules the next retry of node's failed flush, or gives up
+// once the attempts are used. It is called with node.mu held.
+func (r *DirtyNodeRegistry) flushFailed(node *WSNode, errno syscall.Errno) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ctx := r.retryCtx
+	if ctx == nil || ctx.Err() != nil || r.retryConfig.Attempts <= 0 {
+		return
+	}
+	if _, dirty := r.nodes[node]; !dirty {
+		return
+	}
+	if !retryableFlushErrno(errno) {
+		r.cancelRetryLocked(node)
+		return
+	}
+	state := r.retries[node]
+	if state == nil {
+		state = &flushRetry{}
+		r.retries[node] = state
+	}
+	if state.timer != nil {
+		return
+	}
+	if state.attempts >= r.retryConfig.Attempts {
+		logging.Warnf("Giving up retrying the upload of %s after %d attempts; it stays dirty until the next flush", node.Path(), state.attempts)
+		metrics.FlushRetriesExhausted.Add(1)
+		delete(r.retries, node)
+		return
+	}
+	delay := r.retryConfig.Backoff.CalculateDelay(state.attempts, 0)
+	state.attempts++
+	logging.Infof("Retrying the upload of %s in %s (attempt %d of %d)", node.Path(), delay.Round(time.Millisecond), state.attempts, r.retryConfig.Attempts)
+	state.timer = time.AfterFunc(delay, func() { r.retryFlush(ctx, node, state) })
+}
+
+// retryFlush runs one scheduled retry of node's flush. Another failure
+// schedules the next attempt through flushFailed.
+func (r *DirtyNodeRegistry) retryFlush(ctx context.Context, node *WSNode, state *flushRetry) {
+	r.mu.Lock()
+	if r.retries[node] != state {
+		// Cancelled since: the node was flushed or the mount stopped.
+		r.mu.Unlock()
+		return
+	}
+	state.timer = nil
+	r.mu.Unlock()
+
+	metrics.FlushRetries.Add(1)
+	flushed, err := flushRegistered(ctx, node, nil)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	if r.retries[node] == state {
+		delete(r.retries, node)
+	}
+	r.mu.Unlock()
+	if flushed {
+		logging.Infof("Uploaded %s after %d retries", node.Path(), state.attempts)
+	}
+}
+
+// cancelRetryLocked drops node's retry state and any pending attempt.
+func (r *DirtyNodeRegistry) cancelRetryLocked(node *WSNode) {
+	state, ok := r.retries[node]
+	if !ok {
+		return
+	}
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+	delete(r.retries, node)
+}
@@ -0,0 +1,148 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/metrics"
+	"wsfs/internal/retry"
+)
+
+func fastFlushRetries(attempts int) FlushRetryConfig {
+	return FlushRetryConfig{
+		Attempts: attempts,
+		Backoff:  retry.Config{InitialDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond, BackoffFactor: 2},
+	}
+}
+
+// newRetryTestNode returns a dirty node in registry whose uploads fail
+// with the errors of writeErr until it returns nil.
+func newRetryTestNode(registry *DirtyNodeRegistry, writes *atomic.Int32, writeErr func(n int32) error) *WSNode {
+	api := &databricks.FakeWorkspaceAPI{
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			return writeErr(writes.Add(1))
+		},
+	}
+	node := &WSNode{
+		wfClient: api,
+		registry: registry,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeFile,
+			Path:       "/retry.txt",
+		}},
+		buf: fileBuffer{Data: []byte("data"), Dirty: true},
+	}
+	registry.Register(node)
+	return node
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFailedFlushIsRetriedInBackground(t *testing.T) {
+	registry := NewDirtyNodeRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry.StartFlushRetries(ctx, fastFlushRetries(5))
+	retriesBefore := metrics.FlushRetries.Value()
+
+	var writes atomic.Int32
+	node := newRetryTestNode(registry, &writes, func(n int32) error {
+		if n < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	if _, err := flushRegistered(ctx, node, nil); err == nil {
+		t.Fatal("expected the first flush to fail")
+	}
+
+	waitFor(t, "the retried upload", func() bool { return registry.Count() == 0 })
+	if got := writes.Load(); got != 3 {
+		t.Fatalf("expected 3 uploads, got %d", got)
+	}
+	if got := metrics.FlushRetries.Value() - retriesBefore; got != 2 {
+		t.Fatalf("expected 2 retries counted, got %d", got)
+	}
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if node.lastError != nil {
+		t.Fatalf("expected the last error cleared, got %v", node.lastError)
+	}
+}
+
+func TestFlushRetriesGiveUpAfterBudget(t *testing.T) {
+	registry := NewDirtyNodeRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry.StartFlushRetries(ctx, fastFlushRetries(2))
+	exhaustedBefore := metrics.FlushRetriesExhausted.Value()
+
+	var writes atomic.Int32
+	node := newRetryTestNode(registry, &writes, func(int32) error { return errors.New("connection reset") })
+	flushRegistered(ctx, node, nil)
+
+	waitFor(t, "the retries to give up", func() bool { return metrics.FlushRetriesExhausted.Value() > exhaustedBefore })
+	if got := writes.Load(); got != 3 {
+		t.Fatalf("expected the first upload and 2 retries, got %d", got)
+	}
+	if registry.Count() != 1 {
+		t.Fatal("expected the file to stay dirty")
+	}
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	if len(registry.retries) != 0 {
+		t.Fatalf("expected no retry state left, got %d", len(registry.retries))
+	}
+}
+
+func TestFlushRetriesSkipPermanentFailures(t *testing.T) {
+	registry := NewDirtyNodeRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry.StartFlushRetries(ctx, fastFlushRetries(5))
+
+	var writes atomic.Int32
+	node := newRetryTestNode(registry, &writes, func(int32) error { return syscall.EACCES })
+	flushRegistered(ctx, node, nil)
+
+	time.Sleep(20 * time.Millisecond)
+	if got := writes.Load(); got != 1 {
+		t.Fatalf("expected no retry of a permission error, got %d uploads", got)
+	}
+}
+
+func TestFlushRetriesStopWithContext(t *testing.T) {
+	registry := NewDirtyNodeRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := fastFlushRetries(5)
+	cfg.Backoff.InitialDelay = time.Hour
+	cfg.Backoff.MaxDelay = time.Hour
+	registry.StartFlushRetries(ctx, cfg)
+
+	var writes atomic.Int32
+	node := newRetryTestNode(registry, &writes, func(int32) error { return errors.New("connection reset") })
+	flushRegistered(ctx, node, nil)
+	cancel()
+
+	waitFor(t, "the pending retry to be cancelled", func() bool {
+		registry.mu.RLock()
+		defer registry.mu.RUnlock()
+		return len(registry.retries) == 0
+	})
+}
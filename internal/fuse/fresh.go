@@ -0,0 +1,77 @@
+package fuse
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// ParseNoCachePatterns splits a comma-separated --no-cache-paths list and
+// checks each pattern. A pattern with a slash must be an absolute workspace
+// path pattern; any other pattern matches file names. Empty items are
+// ignored.
+func ParseNoCachePatterns(value string) ([]string, error) {
+	var patterns []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") && !strings.HasPrefix(item, "/") {
+			return nil, fmt.Errorf("pattern %q must be an absolute workspace path or a file name", item)
+		}
+		if _, err := path.Match(item, ""); err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", item, err)
+		}
+		patterns = append(patterns, path.Clean(item))
+	}
+	return patterns, nil
+}
+
+// alwaysFresh reports whether the object at p must be read fresh from the
+// workspace every time: it bypasses the metadata and disk caches, and the
+// kernel caches neither its attributes nor its content.
+func (n *WSNode) alwaysFresh(p string) bool {
+	return matchesPathPattern(n.cfg().NoCachePatterns, p)
+}
+
+// matchesPathPattern reports whether p matches one of the lower-cased
+// patterns, ignoring case. Patterns with a slash match p or one of its
+// parent directories, so a directory pattern covers its whole tree. Other
+// patterns match the base name.
+func matchesPathPattern(patterns []string, p string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	lowered := strings.ToLower(path.Clean("/" + p))
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(lowered)); ok {
+				return true
+			}
+			continue
+		}
+		for dir := lowered; ; dir = path.Dir(dir) {
+			if ok, _ := path.Match(pattern, dir); ok {
+				return true
+			}
+			if dir == "/" {
+				break
+			}
+		}
+	}
+	return false
+}
+
+// setChildEntryOutTimeouts sets the kernel cache timeouts of the entry of
+// a child at childPath. Always-fresh children are not cached.
+func (n *WSNode) setChildEntryOutTimeouts(out *fuse.EntryOut, childPath string) {
+	if n.alwaysFresh(childPath) {
+		out.SetEntryTimeout(0)
+		out.SetAttrTimeout(0)
+		return
+	}
+	n.setEntryOutTimeouts(out)
+}
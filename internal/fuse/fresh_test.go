@@ -0,0 +1,94 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestParseNoCachePatterns(t *testing.T) {
+	got, err := ParseNoCachePatterns(" status.json, /Shared/live/ ,,")
+	if err != nil {
+		t.Fatalf("ParseNoCachePatterns: %v", err)
+	}
+	if len(got) != 2 || got[0] != "status.json" || got[1] != "/Shared/live" {
+		t.Fatalf("patterns = %q", got)
+	}
+	for _, bad := range []string{"Shared/live", "["} {
+		if _, err := ParseNoCachePatterns(bad); err == nil {
+			t.Fatalf("ParseNoCachePatterns(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestMatchesPathPattern(t *testing.T) {
+	patterns := []string{"*.lock", "/shared/live"}
+	cases := map[string]bool{
+		"/Users/me/run.LOCK":        true,
+		"/Shared/live":              true,
+		"/Shared/live/status.json":  true,
+		"/Shared/lively/notes.txt":  false,
+		"/Users/me/notes.txt":       false,
+		"/Shared/archive/live.json": false,
+	}
+	for p, want := range cases {
+		if got := matchesPathPattern(patterns, p); got != want {
+			t.Errorf("matchesPathPattern(%q) = %v, want %v", p, got, want)
+		}
+	}
+	if matchesPathPattern(nil, "/Shared/live") {
+		t.Fatal("no patterns matched a path")
+	}
+}
+
+func TestNoCachePathsAreNeverCached(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{"status.json": "old", "notes.txt": "notes"}, &NodeConfig{
+		NoCachePatterns: []string{"STATUS.json"},
+		AttrTTL:         time.Minute,
+		EntryTTL:        time.Minute,
+	})
+	ctx := context.Background()
+
+	var out fuse.EntryOut
+	child, errno := root.Lookup(ctx, "status.json", &out)
+	if errno != 0 {
+		t.Fatalf("Lookup errno %d", errno)
+	}
+	if out.EntryTimeout() != 0 || out.AttrTimeout() != 0 {
+		t.Fatalf("always-fresh entry cached for %s / %s", out.EntryTimeout(), out.AttrTimeout())
+	}
+	fresh := child.Operations().(*WSNode)
+	if fresh.usesDiskCache(fresh.Path()) {
+		t.Fatal("always-fresh file uses the disk cache")
+	}
+	var open uint32
+	if _, open, errno = fresh.Open(ctx, uint32(os.O_RDONLY)); errno != 0 {
+		t.Fatalf("Open errno %d", errno)
+	}
+	if open&fuse.FOPEN_DIRECT_IO == 0 {
+		t.Fatalf("open flags = %#x, want direct I/O", open)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "status.json"), []byte("newer"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var attr fuse.AttrOut
+	if errno := fresh.Getattr(ctx, nil, &attr); errno != 0 {
+		t.Fatalf("Getattr errno %d", errno)
+	}
+	if attr.Size != uint64(len("newer")) || attr.Timeout() != 0 {
+		t.Fatalf("Getattr size %d timeout %s, want the fresh size uncached", attr.Size, attr.Timeout())
+	}
+
+	out = fuse.EntryOut{}
+	if _, errno := root.Lookup(ctx, "notes.txt", &out); errno != 0 {
+		t.Fatalf("Lookup errno %d", errno)
+	}
+	if out.EntryTimeout() != time.Minute {
+		t.Fatalf("regular entry timeout = %s", out.EntryTimeout())
+	}
+}
@@ -0,0 +1,62 @@
+package fuse
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// isHiddenName reports whether name matches one of the mount's hide
+// patterns. Hidden names are left out of listings, do not exist for lookups
+// and cannot be created, so tools that probe for or drop local clutter never
+// reach the workspace. Matching ignores case, like --disk-cache-exclude.
+func (n *WSNode) isHiddenName(name string) bool {
+	return matchesNamePattern(n.cfg().HidePatterns, name)
+}
+
+// matchesNamePattern reports whether name matches one of the lower-cased
+// patterns, ignoring case.
+func matchesNamePattern(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	lowered := strings.ToLower(name)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, lowered); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutHidden drops the entries whose name is hidden.
+func (n *WSNode) withoutHidden(entries []fuse.DirEntry) []fuse.DirEntry {
+	if len(n.cfg().HidePatterns) == 0 {
+		return entries
+	}
+	shown := entries[:0]
+	for _, e := range entries {
+		if !n.isHiddenName(e.Name) {
+			shown = append(shown, e)
+		}
+	}
+	return shown
+}
+
+// withoutUnlinked drops the entries of files unlinked while open, which
+// the workspace still lists until their last close.
+func (n *WSNode) withoutUnlinked(entries []fuse.DirEntry) []fuse.DirEntry {
+	names := n.unlinkedChildren.names()
+	if len(names) == 0 {
+		return entries
+	}
+	shown := entries[:0]
+	for _, e := range entries {
+		if !slices.Contains(names, e.Name) {
+			shown = append(shown, e)
+		}
+	}
+	return shown
+}
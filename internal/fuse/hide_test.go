@@ -0,0 +1,56 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestHiddenNamesAreNotListedFoundOrCreated(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{
+		"main.py":   "print()\n",
+		".DS_Store": "junk",
+		"._main.py": "junk",
+	}, &NodeConfig{HidePatterns: []string{".ds_store", "._*", "__pycache__"}})
+	if err := os.Mkdir(filepath.Join(dir, "__pycache__"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	ctx := context.Background()
+
+	if got := readdirNames(t, root); !reflect.DeepEqual(got, []string{"main.py"}) {
+		t.Fatalf("listing = %v, want the hidden names left out", got)
+	}
+	for _, name := range []string{".DS_Store", "._main.py", "__PYCACHE__"} {
+		if _, errno := root.Lookup(ctx, name, &fuse.EntryOut{}); errno != syscall.ENOENT {
+			t.Fatalf("Lookup %s errno %d, want ENOENT", name, errno)
+		}
+	}
+	if _, errno := root.Lookup(ctx, "main.py", &fuse.EntryOut{}); errno != 0 {
+		t.Fatalf("Lookup main.py errno %d", errno)
+	}
+
+	if _, _, _, errno := root.Create(ctx, "._new.py", 0, 0o644, &fuse.EntryOut{}); errno != syscall.EPERM {
+		t.Fatalf("Create of a hidden name errno %d, want EPERM", errno)
+	}
+	if _, errno := root.Mkdir(ctx, "__pycache__", 0o755, &fuse.EntryOut{}); errno != syscall.EPERM {
+		t.Fatalf("Mkdir of a hidden name errno %d, want EPERM", errno)
+	}
+	if errno := root.Rename(ctx, "main.py", root, ".DS_Store", 0); errno != syscall.EPERM {
+		t.Fatalf("Rename to a hidden name errno %d, want EPERM", errno)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "main.py")); err != nil {
+		t.Fatalf("main.py after the refused rename: %v", err)
+	}
+}
+
+func TestNoHidePatternsShowsEverything(t *testing.T) {
+	root, _ := newNameFixture(t, map[string]string{"main.py": "", ".DS_Store": ""}, nil)
+	if got := readdirNames(t, root); !reflect.DeepEqual(got, []string{".DS_Store", "main.py"}) {
+		t.Fatalf("listing = %v", got)
+	}
+}
@@ -0,0 +1,174 @@
+package fuse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/logging"
+)
+
+// InodeIndex numbers the inodes of a mount. An object's inode number is its
+// workspace object ID unless that number is taken, and an object without an
+// ID is numbered by a hash of its path. The exceptions, objects whose
+// number is not their ID, are saved to a file so they keep their numbers
+// across mounts: files created through the mount, which were numbered
+// before they had an ID, and objects moved aside by a collision.
+type InodeIndex struct {
+	path string // empty keeps the exceptions for this process only
+
+	mu       sync.Mutex
+	owners   map[uint64]string // inode number -> key of the object given it
+	remapped map[int64]uint64  // object ID -> inode number, where they differ
+	changed  bool
+}
+
+// inodeIndexFile is the saved form of an InodeIndex.
+type inodeIndexFile struct {
+	Remapped map[string]uint64 `json:"remapped"`
+}
+
+// OpenInodeIndex loads the exceptions saved at path. A missing file starts
+// an empty index.
+func OpenInodeIndex(path string) (*InodeIndex, error) {
+	idx := newInodeIndex(path)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return idx, err
+	}
+	var file inodeIndexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return idx, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for id, ino := range file.Remapped {
+		objectID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || objectID <= 0 || ino == 0 {
+			continue
+		}
+		idx.remapped[objectID] = ino
+		idx.owners[ino] = objectKey(objectID)
+	}
+	return idx, nil
+}
+
+func newInodeIndex(path string) *InodeIndex {
+	return &InodeIndex{path: path, owners: make(map[uint64]string), remapped: make(map[int64]uint64)}
+}
+
+func objectKey(id int64) string {
+	return fmt.Sprintf("object:%d", id)
+}
+
+// ino returns the inode number of info, moving it aside when its natural
+// number already belongs to another object.
+func (idx *InodeIndex) ino(info databricks.WSFileInfo) uint64 {
+	var key string
+	switch {
+	case info.ObjectId > 0:
+		key = objectKey(info.ObjectId)
+	case info.ResourceId != "":
+		key = "resource:" + info.ResourceId
+	case info.Path != "":
+		key = "path:" + info.Path
+	default:
+		return defaultIno
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if ino, ok := idx.remapped[info.ObjectId]; ok && info.ObjectId > 0 {
+		return ino
+	}
+	ino := stableIno(info)
+	for attempt := 1; ; attempt++ {
+		owner, taken := idx.owners[ino]
+		if !taken || owner == key {
+			break
+		}
+		next := hashStringToIno(fmt.Sprintf("%s#%d", key, attempt))
+		logging.Warnf("Inode number %d of %s is taken by %s; using %d", ino, key, owner, next)
+		ino = next
+	}
+	idx.owners[ino] = key
+	if info.ObjectId > 0 && ino != uint64(info.ObjectId) {
+		idx.remapped[info.ObjectId] = ino
+		idx.changed = true
+	}
+	return ino
+}
+
+// bind records that the object with ID id has inode number ino, for an
+// inode numbered before the object had an ID.
+func (idx *InodeIndex) bind(id int64, ino uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.owners[ino] = objectKey(id)
+	current, ok := idx.remapped[id]
+	if ok && current == ino || !ok && ino == uint64(id) {
+		return
+	}
+	if ino == uint64(id) {
+		delete(idx.remapped, id)
+	} else {
+		idx.remapped[id] = ino
+	}
+	idx.changed = true
+}
+
+// Save writes the exceptions to the index file if they changed.
+func (idx *InodeIndex) Save() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.path == "" || !idx.changed {
+		return nil
+	}
+	file := inodeIndexFile{Remapped: make(map[string]uint64, len(idx.remapped))}
+	for id, ino := range idx.remapped {
+		file.Remapped[strconv.FormatInt(id, 10)] = ino
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0700); err != nil {
+		return err
+	}
+	tmp := idx.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, idx.path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	idx.changed = false
+	return nil
+}
+
+// inoFor returns the inode number of a child object.
+func (n *WSNode) inoFor(info databricks.WSFileInfo) uint64 {
+	if n.cfg().Inodes == nil {
+		return stableIno(info)
+	}
+	return n.cfg().Inodes.ino(info)
+}
+
+// bindInoLocked records the object ID the node's metadata now carries, so
+// an inode numbered before the object had an ID keeps its number in later
+// mounts.
+func (n *WSNode) bindInoLocked() {
+	if n.cfg().Inodes == nil || n.isRoot || n.fileInfo.ObjectId <= 0 {
+		return
+	}
+	if ino := n.StableAttr().Ino; ino != 0 {
+		n.cfg().Inodes.bind(n.fileInfo.ObjectId, ino)
+	}
+}
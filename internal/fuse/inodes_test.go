@@ -0,0 +1,97 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/databricks"
+)
+
+func objectInfo(id int64, p string) databricks.WSFileInfo {
+	return databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{ObjectType: workspace.ObjectTypeFile, ObjectId: id, Path: p}}
+}
+
+func TestInodeIndexMovesCollisionsAsideAndKeepsThem(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "inodes", "index.json")
+	idx, err := OpenInodeIndex(indexPath)
+	if err != nil {
+		t.Fatalf("OpenInodeIndex: %v", err)
+	}
+
+	if got := idx.ino(objectInfo(42, "/a.txt")); got != 42 {
+		t.Fatalf("ino of object 42 = %d, want its ID", got)
+	}
+	// A file without an object ID whose path hash equals another object's ID.
+	const taken = 77
+	idx.owners[taken] = "path:/local.txt"
+	moved := idx.ino(objectInfo(taken, "/b.txt"))
+	if moved == taken || moved == 0 {
+		t.Fatalf("colliding object got inode %d, which is taken", moved)
+	}
+	if again := idx.ino(objectInfo(taken, "/renamed.txt")); again != moved {
+		t.Fatalf("renamed object got inode %d, want %d", again, moved)
+	}
+
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	reopened, err := OpenInodeIndex(indexPath)
+	if err != nil {
+		t.Fatalf("OpenInodeIndex: %v", err)
+	}
+	if got := reopened.ino(objectInfo(taken, "/b.txt")); got != moved {
+		t.Fatalf("inode after remount = %d, want %d", got, moved)
+	}
+	if got := reopened.ino(objectInfo(42, "/a.txt")); got != 42 {
+		t.Fatalf("ino of object 42 after remount = %d", got)
+	}
+}
+
+func TestInodeIndexKeepsInodeOfCreatedFile(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "index.json")
+	idx, _ := OpenInodeIndex(indexPath)
+	root, dir := newNameFixture(t, nil, &NodeConfig{Inodes: idx})
+	ctx := context.Background()
+
+	created, _, _, errno := root.Create(ctx, "new.txt", 0, 0o644, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Create errno %d", errno)
+	}
+	root.AddChild("new.txt", created, true)
+	node := created.Operations().(*WSNode)
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	node.mu.Lock()
+	_, errno = node.refreshMetadataLocked(ctx, true)
+	node.mu.Unlock()
+	if errno != 0 {
+		t.Fatalf("refresh errno %d", errno)
+	}
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := os.Rename(filepath.Join(dir, "new.txt"), filepath.Join(dir, "moved.txt")); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	// A later mount of the same tree.
+	idx, err := OpenInodeIndex(indexPath)
+	if err != nil {
+		t.Fatalf("OpenInodeIndex: %v", err)
+	}
+	again, _ := newNameFixture(t, nil, &NodeConfig{Inodes: idx})
+	again.wfClient = root.wfClient
+	child, errno := again.Lookup(ctx, "moved.txt", &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Lookup errno %d", errno)
+	}
+	if got, want := child.StableAttr().Ino, created.StableAttr().Ino; got != want {
+		t.Fatalf("inode after rename and remount = %d, want %d", got, want)
+	}
+}
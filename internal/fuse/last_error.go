@@ -0,0 +1,133 @@
+package fuse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"wsfs/internal/databricks"
+)
+
+// lastErrorXattr exposes the most recent failed backend operation of a node.
+const lastErrorXattr = "user.wsfs.last_error"
+
+// maxFailedRequests is how many request IDs of failed operations the control
+// directory keeps after the nodes recover.
+const maxFailedRequests = 20
+
+// nodeError describes the most recent failed backend operation on a node.
+type nodeError struct {
+	Op   backendOp
+	Err  string
+	Time time.Time
+	// RequestID names the failed request for Databricks support, if the
+	// server gave one.
+	RequestID string
+}
+
+func (e nodeError) String() string {
+	return fmt.Sprintf("%s %s: %s", e.Time.UTC().Format(time.RFC3339), e.Op, e.Err)
+}
+
+// failedRequest is a failed operation the server named with a request ID.
+type failedRequest struct {
+	path string
+	err  nodeError
+}
+
+// errorLog tracks the nodes of a mount that currently carry a last error so
+// the control directory can list them, and the request IDs of recent
+// failures. It is shared by every node of a mount.
+type errorLog struct {
+	nodes    map[*WSNode]struct{}
+	requests []failedRequest // oldest first, at most maxFailedRequests
+	mu       sync.Mutex
+}
+
+func newErrorLog() *errorLog {
+	return &errorLog{nodes: make(map[*WSNode]struct{})}
+}
+
+func (l *errorLog) add(node *WSNode) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nodes[node] = struct{}{}
+}
+
+// addRequest remembers a failure that carries a request ID.
+func (l *errorLog) addRequest(path string, err nodeError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.requests) == maxFailedRequests {
+		l.requests = append(l.requests[:0], l.requests[1:]...)
+	}
+	l.requests = append(l.requests, failedRequest{path: path, err: err})
+}
+
+func (l *errorLog) remove(node *WSNode) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.nodes, node)
+}
+
+func (l *errorLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.nodes)
+}
+
+// render lists one "path<TAB>error" line per node, sorted by path, then
+// one "request-id<TAB>ID<TAB>path<TAB>time op" line per recent failure with
+// a request ID, newest first.
+func (l *errorLog) render() []byte {
+	l.mu.Lock()
+	nodes := make([]*WSNode, 0, len(l.nodes))
+	for node := range l.nodes {
+		nodes = append(nodes, node)
+	}
+	requests := append([]failedRequest(nil), l.requests...)
+	l.mu.Unlock()
+
+	lines := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		node.mu.Lock()
+		if node.lastError != nil {
+			lines = append(lines, node.Path()+"\t"+node.lastError.String())
+		}
+		node.mu.Unlock()
+	}
+	sort.Strings(lines)
+	for i := len(requests) - 1; i >= 0; i-- {
+		r := requests[i]
+		lines = append(lines, fmt.Sprintf("request-id\t%s\t%s\t%s %s",
+			r.err.RequestID, r.path, r.err.Time.UTC().Format(time.RFC3339), r.err.Op))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// recordErrorLocked remembers err as the node's last error.
+func (n *WSNode) recordErrorLocked(op backendOp, err error) {
+	n.lastError = &nodeError{Op: op, Err: err.Error(), Time: time.Now(), RequestID: databricks.RequestID(err)}
+	if n.errors != nil {
+		n.errors.add(n)
+		if n.lastError.RequestID != "" {
+			n.errors.addRequest(n.Path(), *n.lastError)
+		}
+	}
+}
+
+// clearErrorLocked forgets the node's last error after a successful retry.
+func (n *WSNode) clearErrorLocked() {
+	if n.lastError == nil {
+		return
+	}
+	n.lastError = nil
+	if n.errors != nil {
+		n.errors.remove(n)
+	}
+}
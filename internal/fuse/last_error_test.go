@@ -0,0 +1,141 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/databricks"
+)
+
+func newLastErrorTestNode(api databricks.WorkspaceFilesAPI, log *errorLog) *WSNode {
+	return &WSNode{
+		wfClient: api,
+		errors:   log,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeFile,
+			Path:       "/dir/file.txt",
+		}},
+	}
+}
+
+func TestFlushFailureRecordsLastError(t *testing.T) {
+	failWrite := true
+	api := &databricks.FakeWorkspaceAPI{
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			if failWrite {
+				return errors.New("quota exceeded")
+			}
+			return nil
+		},
+	}
+	log := newErrorLog()
+	n := newLastErrorTestNode(api, log)
+	n.buf.Data = []byte{}
+	ctx := context.Background()
+
+	if _, errno := n.Write(ctx, nil, []byte("data"), 0); errno != 0 {
+		t.Fatalf("Write errno: %d", errno)
+	}
+	if errno := n.Fsync(ctx, nil, 0); errno == 0 {
+		t.Fatal("expected Fsync to fail")
+	}
+
+	dest := make([]byte, 256)
+	size, errno := n.Getxattr(ctx, lastErrorXattr, dest)
+	if errno != 0 {
+		t.Fatalf("Getxattr errno: %d", errno)
+	}
+	value := string(dest[:size])
+	if !strings.Contains(value, "write: quota exceeded") {
+		t.Fatalf("unexpected xattr value: %q", value)
+	}
+	if rendered := string(log.render()); !strings.HasPrefix(rendered, "/dir/file.txt\t") || !strings.Contains(rendered, "quota exceeded") {
+		t.Fatalf("unexpected control listing: %q", rendered)
+	}
+
+	failWrite = false
+	if errno := n.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("retry Fsync errno: %d", errno)
+	}
+	if _, errno := n.Getxattr(ctx, lastErrorXattr, dest); errno != syscall.ENODATA {
+		t.Fatalf("expected ENODATA after successful flush, got %d", errno)
+	}
+	if rendered := log.render(); len(rendered) != 0 {
+		t.Fatalf("expected empty control listing, got %q", rendered)
+	}
+}
+
+func TestReadFailureRecordsLastError(t *testing.T) {
+	api := &databricks.FakeWorkspaceAPI{
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			return nil, errors.New("signed url expired")
+		},
+	}
+	n := newLastErrorTestNode(api, newErrorLog())
+
+	if errno := n.ensureDataLocked(context.Background()); errno == 0 {
+		t.Fatal("expected read failure")
+	}
+	if n.lastError == nil || n.lastError.Op != backendOpRead {
+		t.Fatalf("expected read error recorded, got %+v", n.lastError)
+	}
+}
+
+func TestGetxattrSizeProbeAndUnknownAttr(t *testing.T) {
+	n := newLastErrorTestNode(&databricks.FakeWorkspaceAPI{}, nil)
+	ctx := context.Background()
+
+	if _, errno := n.Getxattr(ctx, lastErrorXattr, nil); errno != syscall.ENODATA {
+		t.Fatalf("expected ENODATA without error, got %d", errno)
+	}
+	if size, errno := n.Listxattr(ctx, nil); errno != 0 || size != 0 {
+		t.Fatalf("expected empty xattr list, got size=%d errno=%d", size, errno)
+	}
+
+	n.recordErrorLocked(backendOpWrite, errors.New("boom"))
+
+	size, errno := n.Getxattr(ctx, lastErrorXattr, nil)
+	if errno != syscall.ERANGE || int(size) != len(n.lastError.String()) {
+		t.Fatalf("expected ERANGE with size %d, got size=%d errno=%d", len(n.lastError.String()), size, errno)
+	}
+	if _, errno := n.Getxattr(ctx, "user.other", make([]byte, 64)); errno != syscall.ENODATA {
+		t.Fatalf("expected ENODATA for unknown attr, got %d", errno)
+	}
+
+	dest := make([]byte, 64)
+	size, errno = n.Listxattr(ctx, dest)
+	if errno != 0 || string(dest[:size]) != lastErrorXattr+"\x00" {
+		t.Fatalf("unexpected xattr list %q errno=%d", dest[:size], errno)
+	}
+}
+
+func TestErrorLogKeepsRequestIDsOfRecentFailures(t *testing.T) {
+	log := newErrorLog()
+	n := newLastErrorTestNode(&databricks.FakeWorkspaceAPI{}, log)
+
+	n.recordErrorLocked(backendOpWrite, errors.New("no request"))
+	for i := 0; i <= maxFailedRequests; i++ {
+		n.recordErrorLocked(backendOpWrite, &databricks.RequestError{Op: "POST /api", RequestID: fmt.Sprintf("req-%d", i), Err: errors.New("unavailable")})
+	}
+	if !strings.Contains(n.lastError.String(), "(request ID req-20)") || n.lastError.RequestID != "req-20" {
+		t.Fatalf("last error does not name the request: %+v", n.lastError)
+	}
+
+	n.clearErrorLocked()
+	lines := strings.Split(strings.TrimSuffix(string(log.render()), "\n"), "\n")
+	if len(lines) != maxFailedRequests {
+		t.Fatalf("expected %d request lines after recovery, got %q", maxFailedRequests, lines)
+	}
+	if !strings.HasPrefix(lines[0], "request-id\treq-20\t/dir/file.txt\t") || !strings.HasSuffix(lines[0], " write") {
+		t.Fatalf("expected newest failure first, got %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[len(lines)-1], "request-id\treq-1\t") {
+		t.Fatalf("expected oldest failure dropped, got %q", lines[len(lines)-1])
+	}
+}
@@ -0,0 +1,80 @@
+package fuse
+
+import (
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+
+	"wsfs/internal/events"
+	"wsfs/internal/logging"
+)
+
+// isLocalTempName reports whether name matches one of the mount's local
+// temp patterns: lock and probe files such as Office's ~$doc.docx or vim's
+// 4913 that only make sense while the creating program runs.
+func (n *WSNode) isLocalTempName(name string) bool {
+	return matchesNamePattern(n.cfg().LocalTempPatterns, name)
+}
+
+// discardLocalTemp forgets a closed local temp file. It was never uploaded,
+// so dropping the node from its directory removes it from the mount. The
+// caller must not hold n.mu.
+func (n *WSNode) discardLocalTemp() {
+	name, parent := n.Parent()
+	if parent == nil {
+		return
+	}
+	child := parent.GetChild(name)
+	if child == nil || child.Operations() != n {
+		return
+	}
+	parent.RmChild(name)
+	logging.Debugf("Dropped local temp file %s", n.Path())
+	if parentNode, ok := parent.Operations().(*WSNode); ok {
+		parentNode.publishChild(events.OpDelete, name, false)
+	}
+	notifyDeleteIfPossible(parent, name, child)
+}
+
+// renameLocalTemp renames a local temp file without the workspace. A local
+// temp file is dropped on its last close, so it is still open here. Under
+// another temp name it stays local; under a regular name it becomes an
+// ordinary new file, uploaded there when it is flushed or closed. handled
+// is false when childInode is not a local temp file.
+func (n *WSNode) renameLocalTemp(childInode *fs.Inode, name string, newParent *WSNode, newName, newPath string, destInode *fs.Inode) (errno syscall.Errno, handled bool) {
+	if childInode == nil {
+		return 0, false
+	}
+	node, ok := childInode.Operations().(*WSNode)
+	if !ok {
+		return 0, false
+	}
+	node.mu.Lock()
+	if !node.localTemp {
+		node.mu.Unlock()
+		return 0, false
+	}
+	if errno := ensureOverwriteRenameDestinationReady(destInode); errno != 0 {
+		node.mu.Unlock()
+		return errno, true
+	}
+	info := synthesizedCreatedFileInfo(newPath, nil, n.cfg().NotebookAliases)
+	node.createPath = newPath
+	node.fileInfo.Path = info.Path
+	node.fileInfo.ObjectType = info.ObjectType
+	node.fileInfo.Language = info.Language
+	node.fileInfo.NotebookSizeComputed = info.NotebookSizeComputed
+	if !newParent.isLocalTempName(newName) {
+		node.localTemp = false
+		if node.registry != nil && node.isDirtyLocked() {
+			node.registry.Register(node)
+		}
+	}
+	node.mu.Unlock()
+
+	invalidateOverwrittenRenameDestination(destInode, newPath)
+	if n.cfg().Events != nil {
+		n.cfg().Events.Publish(events.Event{Op: events.OpRename, Path: newParent.mountPath(newName), OldPath: n.mountPath(name)})
+	}
+	return 0, true
+}
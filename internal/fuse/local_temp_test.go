@@ -0,0 +1,120 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// createAndWrite creates name in root, links it into the tree like the FUSE
+// bridge does and writes content to it, leaving it open.
+func createAndWrite(t *testing.T, root *WSNode, name, content string) *WSNode {
+	t.Helper()
+	ctx := context.Background()
+	child, _, _, errno := root.Create(ctx, name, 0, 0o644, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Create %s errno %d", name, errno)
+	}
+	root.AddChild(name, child, true)
+	node := child.Operations().(*WSNode)
+	if _, errno := node.Write(ctx, nil, []byte(content), 0); errno != 0 {
+		t.Fatalf("Write %s errno %d", name, errno)
+	}
+	return node
+}
+
+func TestLocalTempFilesAreNeverUploaded(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{"doc.docx": "doc"}, &NodeConfig{LocalTempPatterns: []string{"~$*", "4913"}})
+	ctx := context.Background()
+
+	lock := createAndWrite(t, root, "~$DOC.docx", "owner")
+	if errno := lock.Flush(ctx, nil); errno != 0 {
+		t.Fatalf("Flush errno %d", errno)
+	}
+	if errno := lock.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("Fsync errno %d", errno)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "~$DOC.docx")); !os.IsNotExist(err) {
+		t.Fatalf("local temp file in the workspace after fsync: %v", err)
+	}
+	if root.registry.Count() != 0 {
+		t.Fatalf("registry holds %d dirty nodes, want the local temp file left out", root.registry.Count())
+	}
+	if got := readdirNames(t, root); !reflect.DeepEqual(got, []string{"doc.docx", "~$DOC.docx"}) {
+		t.Fatalf("listing while open = %v", got)
+	}
+	if got := lookupText(t, root, "~$DOC.docx"); got != "owner" {
+		t.Fatalf("local temp content = %q", got)
+	}
+
+	if errno := lock.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if root.GetChild("~$DOC.docx") != nil {
+		t.Fatalf("local temp file still linked after its last close")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "~$DOC.docx")); !os.IsNotExist(err) {
+		t.Fatalf("local temp file in the workspace after release: %v", err)
+	}
+	if got := readdirNames(t, root); !reflect.DeepEqual(got, []string{"doc.docx"}) {
+		t.Fatalf("listing after release = %v", got)
+	}
+
+	// A regular file is still uploaded on close.
+	regular := createAndWrite(t, root, "notes.txt", "kept")
+	if errno := regular.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "notes.txt")); err != nil || string(got) != "kept" {
+		t.Fatalf("notes.txt = %q, %v", got, err)
+	}
+}
+
+func TestLocalTempUnlinkedWhileOpen(t *testing.T) {
+	root, dir := newNameFixture(t, nil, &NodeConfig{LocalTempPatterns: []string{"4913"}})
+	ctx := context.Background()
+
+	probe := createAndWrite(t, root, "4913", "")
+	if errno := root.Unlink(ctx, "4913"); errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	root.RmChild("4913")
+	if errno := probe.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("workspace = %v, %v, want it empty", entries, err)
+	}
+}
+
+func TestLocalTempRenamedToRegularNameIsUploaded(t *testing.T) {
+	root, dir := newNameFixture(t, nil, &NodeConfig{LocalTempPatterns: []string{"*.tmp"}})
+	ctx := context.Background()
+
+	node := createAndWrite(t, root, "save.tmp", "draft")
+	if errno := root.Rename(ctx, "save.tmp", root, "other.tmp", 0); errno != 0 {
+		t.Fatalf("Rename to a temp name errno %d", errno)
+	}
+	root.MvChild("save.tmp", root.EmbeddedInode(), "other.tmp", true)
+	if errno := root.Rename(ctx, "other.tmp", root, "report.txt", 0); errno != 0 {
+		t.Fatalf("Rename to a regular name errno %d", errno)
+	}
+	root.MvChild("other.tmp", root.EmbeddedInode(), "report.txt", true)
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("workspace before close = %v, %v, want nothing uploaded", entries, err)
+	}
+
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "report.txt")); err != nil || string(got) != "draft" {
+		t.Fatalf("report.txt = %q, %v", got, err)
+	}
+	if root.GetChild("report.txt") == nil {
+		t.Fatalf("renamed file dropped from the tree on close")
+	}
+}
@@ -0,0 +1,272 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/filecache"
+	"wsfs/internal/logging"
+	"wsfs/internal/metrics"
+)
+
+// The methods in this file back the local control API. They are called on
+// the root node with mount-relative paths such as "/src/main.py".
+
+// PrefetchResult summarizes a Prefetch call.
+type PrefetchResult struct {
+	Files    int   `json:"files"`            // files downloaded into the disk cache
+	Cached   int   `json:"cached"`           // files that were already cached
+	Bytes    int64 `json:"bytes"`            // bytes downloaded
+	Skipped  int   `json:"skipped"`          // files that failed to download
+	Excluded int   `json:"excluded"`         // files matching the disk cache exclude patterns
+	Pinned   int   `json:"pinned,omitempty"` // files pinned, by Pin
+}
+
+// UnpinResult summarizes an Unpin call.
+type UnpinResult struct {
+	Unpinned []string `json:"unpinned"` // workspace paths no longer pinned
+}
+
+// MountStats is a point-in-time view of a mount.
+type MountStats struct {
+	DirtyFiles       int                      `json:"dirty_files"`
+	Dirty            []DirtyEntry             `json:"dirty,omitempty"` // oldest first
+	FilesWithErrors  int                      `json:"files_with_errors"`
+	DiskCacheEntries int                      `json:"disk_cache_entries"`
+	DiskCacheBytes   int64                    `json:"disk_cache_bytes"`
+	DiskCacheQuotas  []filecache.QuotaUsage   `json:"disk_cache_quotas,omitempty"`
+	PinnedEntries    int                      `json:"pinned_entries"`
+	PinnedBytes      int64                    `json:"pinned_bytes"`
+	PinBudgetBytes   int64                    `json:"pin_budget_bytes"`
+	Counters         map[string]int64         `json:"counters"`
+	Transfers        []metrics.TransferStatus `json:"transfers"`
+}
+
+// RemotePath maps a mount-relative path to its backend path. ".." cannot
+// climb above the mount root.
+func (n *WSNode) RemotePath(mountPath string) string {
+	return path.Join(n.Path(), path.Clean("/"+mountPath))
+}
+
+// FlushPaths uploads dirty files at or below the given mount-relative paths.
+// No paths flushes every dirty file.
+func (n *WSNode) FlushPaths(ctx context.Context, mountPaths []string) (int, []error) {
+	if n.registry == nil {
+		return 0, nil
+	}
+	if len(mountPaths) == 0 {
+		return n.registry.FlushAll(ctx)
+	}
+	prefixes := make([]string, 0, len(mountPaths))
+	for _, p := range mountPaths {
+		prefixes = append(prefixes, n.RemotePath(p))
+	}
+	return n.registry.flushMatching(ctx, func(nodePath string) bool {
+		for _, prefix := range prefixes {
+			if pathHasPrefix(nodePath, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// InvalidatePaths drops cached metadata and clean file contents at or below
+// the given mount-relative paths, so the next access goes to the backend.
+// Dirty files keep their buffers. It returns the number of loaded nodes that
+// were reset.
+func (n *WSNode) InvalidatePaths(mountPaths []string) int {
+	reset := 0
+	for _, p := range mountPaths {
+		remotePath := n.RemotePath(p)
+		n.wfClient.CacheInvalidate(remotePath)
+		if n.diskCache != nil && !n.diskCache.IsDisabled() {
+			var stale []string
+			for _, cached := range n.diskCache.GetCachedPaths() {
+				if pathHasPrefix(cached, remotePath) {
+					stale = append(stale, cached)
+				}
+			}
+			n.deleteDiskCacheEntries(stale...)
+		}
+		reset += invalidateLoadedSubtree(n.EmbeddedInode(), remotePath)
+	}
+	return reset
+}
+
+// invalidateLoadedSubtree resets the in-memory state of every loaded node
+// under remotePath.
+func invalidateLoadedSubtree(inode *fs.Inode, remotePath string) int {
+	reset := 0
+	for _, child := range inode.Children() {
+		node, ok := child.Operations().(*WSNode)
+		if !ok {
+			continue
+		}
+		node.mu.Lock()
+		nodePath := node.Path()
+		matched := pathHasPrefix(nodePath, remotePath)
+		if matched {
+			node.metadataCheckedAt = time.Time{}
+			if node.openCount == 0 {
+				node.clearCleanBufferLocked()
+			}
+			reset++
+		}
+		isDir := node.fileInfo.IsDir()
+		node.mu.Unlock()
+
+		if matched {
+			notifyContentIfPossible(child, nodePath)
+		}
+		if isDir && (matched || pathHasPrefix(remotePath, nodePath)) {
+			reset += invalidateLoadedSubtree(child, remotePath)
+		}
+	}
+	return reset
+}
+
+// Prefetch downloads every file below the mount-relative path into the disk
+// cache, skipping hidden names like a listing of the mount. Files that fail are logged and counted as skipped, and files the
+// cache excludes are counted but not downloaded.
+func (n *WSNode) Prefetch(ctx context.Context, mountPath string) (PrefetchResult, error) {
+	return n.prefetch(ctx, mountPath, false)
+}
+
+// Pin pins every file below the mount-relative path in the disk cache, so
+// LRU and TTL eviction leave it alone, and downloads the files not cached
+// yet like Prefetch. Files that do not fit in the pin budget are logged,
+// counted as skipped and left unpinned.
+func (n *WSNode) Pin(ctx context.Context, mountPath string) (PrefetchResult, error) {
+	return n.prefetch(ctx, mountPath, true)
+}
+
+// Unpin removes the pins at or below the mount-relative path. The files
+// stay cached and are evicted like any other from then on. Files pinned by
+// a .wsfsattributes pin directive stay pinned.
+func (n *WSNode) Unpin(mountPath string) (UnpinResult, error) {
+	if n.diskCache == nil || n.diskCache.IsDisabled() {
+		return UnpinResult{}, errors.New("disk cache is disabled")
+	}
+	unpinned := n.diskCache.Unpin(n.RemotePath(mountPath))
+	if unpinned == nil {
+		unpinned = []string{}
+	}
+	return UnpinResult{Unpinned: unpinned}, nil
+}
+
+func (n *WSNode) prefetch(ctx context.Context, mountPath string, pin bool) (PrefetchResult, error) {
+	var result PrefetchResult
+	if n.diskCache == nil || n.diskCache.IsDisabled() {
+		return result, errors.New("disk cache is disabled")
+	}
+
+	mountPath = path.Clean("/" + mountPath)
+	remotePath := n.RemotePath(mountPath)
+	info, err := n.wfClient.Stat(ctx, remotePath)
+	if err != nil {
+		return result, err
+	}
+	wsInfo, ok := info.(databricks.WSFileInfo)
+	if !ok {
+		return result, fmt.Errorf("unexpected file info type for %s", remotePath)
+	}
+	err = n.prefetchInfo(ctx, wsInfo, mountPath, pin, &result)
+	return result, err
+}
+
+func (n *WSNode) prefetchInfo(ctx context.Context, info databricks.WSFileInfo, mountPath string, pin bool, result *PrefetchResult) error {
+	if !info.IsDir() {
+		n.prefetchFile(ctx, info, pin, result)
+		return nil
+	}
+	entries, _, err := n.walkTree(ctx, info, mountPath, 0)
+	if err != nil {
+		return fmt.Errorf("prefetch %s: %w", info.Path, err)
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !entry.info.IsDir() {
+			n.prefetchFile(ctx, entry.info, pin, result)
+		}
+	}
+	return nil
+}
+
+func (n *WSNode) prefetchFile(ctx context.Context, info databricks.WSFileInfo, pin bool, result *PrefetchResult) {
+	if n.diskCache.Excludes(info.Path) {
+		result.Excluded++
+		return
+	}
+	if !pin {
+		n.cacheFile(ctx, info, result)
+		return
+	}
+	// Pinned before the download, so the content is admitted against the
+	// pin budget.
+	wasPinned := n.diskCache.IsPinned(info.Path)
+	if err := n.diskCache.Pin(info.Path); err != nil {
+		logging.Warnf("Pin %s failed: %v", info.Path, err)
+		result.Skipped++
+		return
+	}
+	if !n.cacheFile(ctx, info, result) {
+		if !wasPinned {
+			n.diskCache.Unpin(info.Path)
+		}
+		return
+	}
+	result.Pinned++
+}
+
+// cacheFile downloads info into the disk cache unless it is cached
+// already, and reports whether it is cached afterwards.
+func (n *WSNode) cacheFile(ctx context.Context, info databricks.WSFileInfo, result *PrefetchResult) bool {
+	if _, _, found := n.diskCache.Get(info.Path, info.ModTime()); found {
+		result.Cached++
+		return true
+	}
+	readCtx, cancel := context.WithTimeout(ctx, dataOpTimeout)
+	defer cancel()
+	data, err := n.wfClient.ReadAll(readCtx, info.Path)
+	if err == nil {
+		_, err = n.setDiskCache(info.Path, data, info.ModTime(), info.IsNotebook())
+	}
+	if err != nil {
+		logging.Warnf("Prefetch %s failed: %v", info.Path, err)
+		result.Skipped++
+		return false
+	}
+	result.Files++
+	result.Bytes += int64(len(data))
+	return true
+}
+
+// Stats returns the current state of the mount.
+func (n *WSNode) Stats() MountStats {
+	stats := MountStats{
+		Counters:  metrics.Snapshot(),
+		Transfers: metrics.ActiveTransfers(),
+	}
+	if n.registry != nil {
+		stats.DirtyFiles = n.registry.Count()
+		stats.Dirty = n.registry.Entries()
+	}
+	if n.errors != nil {
+		stats.FilesWithErrors = n.errors.count()
+	}
+	if n.diskCache != nil && !n.diskCache.IsDisabled() {
+		stats.DiskCacheEntries, stats.DiskCacheBytes = n.diskCache.GetStats()
+		stats.DiskCacheQuotas = n.diskCache.QuotaStats()
+		stats.PinnedEntries, stats.PinnedBytes, stats.PinBudgetBytes = n.diskCache.PinStats()
+	}
+	return stats
+}
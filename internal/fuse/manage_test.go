@@ -0,0 +1,287 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/filecache"
+)
+
+type manageFixture struct {
+	t        *testing.T
+	dir      string
+	root     *WSNode
+	cache    *filecache.DiskCache
+	registry *DirtyNodeRegistry
+}
+
+func newManageFixture(t *testing.T) *manageFixture {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"src/main.py":      "print('main')\n",
+		"src/lib/util.py":  "def util(): pass\n",
+		"docs/README.md":   "# docs\n",
+		"top-level.txt":    "top\n",
+		"src/lib/data.csv": "a,b\n1,2\n",
+	} {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	local, err := backend.NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	cache, err := filecache.NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache: %v", err)
+	}
+	registry := NewDirtyNodeRegistry()
+	root, err := NewRootNode(local, cache, "/", registry, nil)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	return &manageFixture{t: t, dir: dir, root: root, cache: cache, registry: registry}
+}
+
+// lookup walks names from the root and returns the node at the end.
+func (f *manageFixture) lookup(names ...string) *WSNode {
+	f.t.Helper()
+	node := f.root
+	for _, name := range names {
+		child, errno := node.Lookup(context.Background(), name, &fuse.EntryOut{})
+		if errno != 0 {
+			f.t.Fatalf("Lookup %s errno %d", name, errno)
+		}
+		// The kernel bridge links looked-up inodes; direct calls must do it.
+		node.AddChild(name, child, true)
+		node = child.Operations().(*WSNode)
+	}
+	return node
+}
+
+func (f *manageFixture) write(node *WSNode, content string) {
+	f.t.Helper()
+	ctx := context.Background()
+	if _, _, errno := node.Open(ctx, uint32(os.O_RDWR)); errno != 0 {
+		f.t.Fatalf("Open errno %d", errno)
+	}
+	if _, errno := node.Write(ctx, nil, []byte(content), 0); errno != 0 {
+		f.t.Fatalf("Write errno %d", errno)
+	}
+}
+
+func (f *manageFixture) onDisk(name string) string {
+	f.t.Helper()
+	data, err := os.ReadFile(filepath.Join(f.dir, filepath.FromSlash(name)))
+	if err != nil {
+		f.t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestRemotePathStaysUnderMountRoot(t *testing.T) {
+	root := &WSNode{}
+	root.fileInfo.Path = "/Users/me/project"
+	cases := map[string]string{
+		"":              "/Users/me/project",
+		"/":             "/Users/me/project",
+		"src/main.py":   "/Users/me/project/src/main.py",
+		"/src/main.py":  "/Users/me/project/src/main.py",
+		"/../../etc":    "/Users/me/project/etc",
+		"src/../a.txt/": "/Users/me/project/a.txt",
+	}
+	for input, want := range cases {
+		if got := root.RemotePath(input); got != want {
+			t.Fatalf("RemotePath(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestFlushPathsFlushesOnlyMatchingFiles(t *testing.T) {
+	f := newManageFixture(t)
+	mainNode := f.lookup("src", "main.py")
+	topNode := f.lookup("top-level.txt")
+	f.write(mainNode, "print('edited')\n")
+	f.write(topNode, "edited top\n")
+
+	flushed, errs := f.root.FlushPaths(context.Background(), []string{"/src"})
+	if len(errs) != 0 || flushed != 1 {
+		t.Fatalf("FlushPaths = %d, %v; want 1 flush", flushed, errs)
+	}
+	if got := f.onDisk("src/main.py"); got != "print('edited')\n" {
+		t.Fatalf("src/main.py not flushed: %q", got)
+	}
+	if got := f.onDisk("top-level.txt"); got != "top\n" {
+		t.Fatalf("top-level.txt flushed early: %q", got)
+	}
+
+	flushed, errs = f.root.FlushPaths(context.Background(), nil)
+	if len(errs) != 0 || flushed != 1 {
+		t.Fatalf("FlushPaths(all) = %d, %v; want 1 flush", flushed, errs)
+	}
+	if got := f.onDisk("top-level.txt"); got != "edited top\n" {
+		t.Fatalf("top-level.txt not flushed: %q", got)
+	}
+}
+
+func TestInvalidatePathsPicksUpRemoteChanges(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+	node := f.lookup("docs", "README.md")
+	dest := make([]byte, 64)
+	if _, errno := node.Read(ctx, nil, dest, 0); errno != 0 {
+		t.Fatalf("Read errno %d", errno)
+	}
+	if len(f.cache.GetCachedPaths()) != 1 {
+		t.Fatalf("expected the read to populate the disk cache")
+	}
+
+	// Same size and modification time, so only an invalidation reveals it.
+	full := filepath.Join(f.dir, "docs", "README.md")
+	info, _ := os.Stat(full)
+	if err := os.WriteFile(full, []byte("# DOCS\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Chtimes(full, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	if n := f.root.InvalidatePaths([]string{"/docs"}); n != 2 {
+		t.Fatalf("expected docs and README.md to be reset, got %d", n)
+	}
+	if paths := f.cache.GetCachedPaths(); len(paths) != 0 {
+		t.Fatalf("expected disk cache entries under /docs to be dropped, got %v", paths)
+	}
+	res, errno := node.Read(ctx, nil, dest, 0)
+	if errno != 0 {
+		t.Fatalf("Read errno %d", errno)
+	}
+	if got, _ := res.Bytes(dest); string(got) != "# DOCS\n" {
+		t.Fatalf("expected fresh content, got %q", got)
+	}
+}
+
+func TestInvalidatePathsKeepsDirtyBuffers(t *testing.T) {
+	f := newManageFixture(t)
+	node := f.lookup("top-level.txt")
+	f.write(node, "unsaved\n")
+
+	f.root.InvalidatePaths([]string{"/"})
+
+	node.mu.Lock()
+	dirty := node.isDirtyLocked()
+	data := string(node.buf.Data)
+	node.mu.Unlock()
+	if !dirty || data != "unsaved\n" {
+		t.Fatalf("dirty buffer lost: dirty=%v data=%q", dirty, data)
+	}
+}
+
+func TestPrefetchFillsDiskCache(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+
+	result, err := f.root.Prefetch(ctx, "/src")
+	if err != nil {
+		t.Fatalf("Prefetch: %v", err)
+	}
+	want := PrefetchResult{Files: 3, Bytes: int64(len("print('main')\n") + len("def util(): pass\n") + len("a,b\n1,2\n"))}
+	if result != want {
+		t.Fatalf("Prefetch = %+v, want %+v", result, want)
+	}
+
+	result, err = f.root.Prefetch(ctx, "/src")
+	if err != nil || result.Cached != 3 || result.Files != 0 {
+		t.Fatalf("second Prefetch = %+v, %v; want 3 cached", result, err)
+	}
+
+	// A later open is served from the prefetched cache entry.
+	node := f.lookup("src", "lib", "util.py")
+	if _, _, errno := node.Open(ctx, uint32(os.O_RDONLY)); errno != 0 {
+		t.Fatalf("Open errno %d", errno)
+	}
+	node.mu.Lock()
+	errno := node.ensureDataLocked(ctx)
+	cachedPath := node.buf.CachedPath
+	node.mu.Unlock()
+	if errno != 0 || cachedPath == "" {
+		t.Fatalf("expected a disk cache hit, errno=%d path=%q", errno, cachedPath)
+	}
+
+	if _, err := f.root.Prefetch(ctx, "/missing"); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
+
+func TestPinKeepsFilesCached(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+
+	result, err := f.root.Pin(ctx, "/src/lib/util.py")
+	if err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+	if result.Pinned != 1 || result.Files != 1 {
+		t.Fatalf("Pin = %+v, want 1 file downloaded and pinned", result)
+	}
+	utilPath := f.root.RemotePath("/src/lib/util.py")
+	if !f.root.diskCache.IsPinned(utilPath) {
+		t.Fatal("util.py is not pinned")
+	}
+	if stats := f.root.Stats(); stats.PinnedEntries != 1 || stats.PinnedBytes != int64(len("def util(): pass\n")) {
+		t.Fatalf("pinned stats = %d entries, %d bytes", stats.PinnedEntries, stats.PinnedBytes)
+	}
+
+	unpinned, err := f.root.Unpin("/src")
+	if err != nil || len(unpinned.Unpinned) != 1 || unpinned.Unpinned[0] != utilPath {
+		t.Fatalf("Unpin = %+v, %v", unpinned, err)
+	}
+	if f.root.diskCache.IsPinned(utilPath) {
+		t.Fatal("util.py is still pinned")
+	}
+}
+
+func TestPrefetchRequiresDiskCache(t *testing.T) {
+	f := newManageFixture(t)
+	f.root.diskCache = filecache.NewDisabledCache()
+	if _, err := f.root.Prefetch(context.Background(), "/"); err == nil {
+		t.Fatal("expected error with the disk cache disabled")
+	}
+}
+
+func TestStatsReportsDirtyFilesAndCache(t *testing.T) {
+	f := newManageFixture(t)
+	if _, err := f.root.Prefetch(context.Background(), "/docs"); err != nil {
+		t.Fatalf("Prefetch: %v", err)
+	}
+	stats := f.root.Stats()
+	if stats.DirtyFiles != 0 {
+		t.Fatalf("DirtyFiles = %d, want 0", stats.DirtyFiles)
+	}
+	if stats.DiskCacheEntries != 1 || stats.DiskCacheBytes != int64(len("# docs\n")) {
+		t.Fatalf("unexpected disk cache stats: %d entries, %d bytes", stats.DiskCacheEntries, stats.DiskCacheBytes)
+	}
+
+	f.write(f.lookup("top-level.txt"), "dirty\n")
+	stats = f.root.Stats()
+	if stats.DirtyFiles != 1 {
+		t.Fatalf("DirtyFiles = %d, want 1", stats.DirtyFiles)
+	}
+	if _, ok := stats.Counters["upload_bytes"]; !ok {
+		t.Fatalf("expected metrics counters, got %v", stats.Counters)
+	}
+}
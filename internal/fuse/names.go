@@ -0,0 +1,171 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/logging"
+	"wsfs/internal/pathutil"
+)
+
+// Workspace paths are case-sensitive and compare bytes, but macOS and
+// Windows clients usually ignore case, and macOS sends decomposed (NFD)
+// Unicode while Databricks stores composed (NFC) names. wsfs warns about
+// siblings such clients cannot tell apart. With NodeConfig.CaseInsensitive
+// it presents a view where every name is unique ignoring case, and with
+// NodeConfig.NormalizeUnicode lookups match names in either form.
+
+// foldName returns the form two names share when a case-insensitive,
+// normalizing client such as macOS treats them as the same file.
+func foldName(name string) string {
+	return strings.ToLower(pathutil.NormalizeName(name))
+}
+
+// caseFoldView groups entries whose names differ only in case. In each group
+// the first name in byte order keeps its name and the others get a unique
+// name such as "foo (case 2).py". It returns the renamed entries, a map from
+// each new name to the real one, and the colliding groups.
+func caseFoldView(entries []fuse.DirEntry) ([]fuse.DirEntry, map[string]string, [][]string) {
+	groups := make(map[string][]string, len(entries))
+	taken := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		folded := foldName(e.Name)
+		groups[folded] = append(groups[folded], e.Name)
+		taken[folded] = struct{}{}
+	}
+
+	var conflicts [][]string
+	for _, names := range groups {
+		if len(names) > 1 {
+			sort.Strings(names)
+			conflicts = append(conflicts, names)
+		}
+	}
+	if len(conflicts) == 0 {
+		return entries, nil, nil
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i][0] < conflicts[j][0] })
+
+	renamed := make(map[string]string)
+	aliases := make(map[string]string)
+	for _, names := range conflicts {
+		for i, name := range names[1:] {
+			alias := caseAliasName(name, i+2, taken)
+			taken[foldName(alias)] = struct{}{}
+			renamed[name] = alias
+			aliases[alias] = name
+		}
+	}
+
+	view := make([]fuse.DirEntry, len(entries))
+	for i, e := range entries {
+		if alias, ok := renamed[e.Name]; ok {
+			e.Name = alias
+		}
+		view[i] = e
+	}
+	return view, aliases, conflicts
+}
+
+// caseAliasName returns "stem (case N).ext" for the first N >= start whose
+// name does not collide with any name in taken.
+func caseAliasName(name string, start int, taken map[string]struct{}) string {
+	ext := path.Ext(name)
+	if ext == name {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+	for n := start; ; n++ {
+		alias := fmt.Sprintf("%s (case %d)%s", stem, n, ext)
+		if _, exists := taken[foldName(alias)]; !exists {
+			return alias
+		}
+	}
+}
+
+// warnCaseConflicts logs each colliding group once per directory node.
+func (n *WSNode) warnCaseConflicts(conflicts [][]string) {
+	if len(conflicts) == 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.caseConflictsWarned == nil {
+		n.caseConflictsWarned = make(map[string]struct{})
+	}
+	for _, names := range conflicts {
+		key := strings.Join(names, "\x00")
+		if _, warned := n.caseConflictsWarned[key]; warned {
+			continue
+		}
+		n.caseConflictsWarned[key] = struct{}{}
+		if n.cfg().CaseInsensitive {
+			logging.Warnf("Names in %s differ only in case: %s; showing them under distinct names", n.Path(), strings.Join(names, ", "))
+		} else {
+			logging.Warnf("Names in %s differ only in case: %s; case-insensitive clients see only one of them (see --case-insensitive)", n.Path(), strings.Join(names, ", "))
+		}
+	}
+}
+
+// nameKey returns the form of name that lookups compare under the mount's
+// matching rules.
+func (n *WSNode) nameKey(name string) string {
+	if n.cfg().NormalizeUnicode {
+		name = pathutil.NormalizeName(name)
+	}
+	if n.cfg().CaseInsensitive {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// resolveChildName maps a name that has no exact entry to the real entry
+// name in this directory, using the case-insensitive view and Unicode
+// normalization as configured.
+func (n *WSNode) resolveChildName(ctx context.Context, name string) (string, bool) {
+	entries, err := n.wfClient.ReadDir(ctx, n.Path())
+	if err != nil {
+		logging.Debugf("Lookup: listing of %s for name matching failed: %v", n.Path(), err)
+		return "", false
+	}
+	view := visibleDirEntries(entries, n.cfg().NotebookAliases, n.inoFor)
+	var aliases map[string]string
+	if n.cfg().CaseInsensitive {
+		view, aliases, _ = caseFoldView(view)
+	}
+	key := n.nameKey(name)
+	for _, e := range view {
+		if n.nameKey(e.Name) != key {
+			continue
+		}
+		if real, ok := aliases[e.Name]; ok {
+			return real, true
+		}
+		return e.Name, true
+	}
+	return "", false
+}
+
+// statChild stats the child called name at childPath. When the mount
+// matches names tolerantly and no entry has that exact name, it retries with
+// the entry the name resolves to and returns that entry's path.
+func (n *WSNode) statChild(ctx context.Context, name string, childPath string) (string, iofs.FileInfo, error) {
+	info, err := n.wfClient.Stat(ctx, childPath)
+	if err == nil || !(n.cfg().CaseInsensitive || n.cfg().NormalizeUnicode) || mapBackendError(backendOpLookup, err) != syscall.ENOENT {
+		return childPath, info, err
+	}
+	realName, ok := n.resolveChildName(ctx, name)
+	if !ok {
+		return childPath, nil, err
+	}
+	resolved := path.Join(n.Path(), realName)
+	info, err = n.wfClient.Stat(ctx, resolved)
+	return resolved, info, err
+}
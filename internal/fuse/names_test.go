@@ -0,0 +1,227 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/filecache"
+)
+
+func dirEntryNames(entries []fuse.DirEntry) []string {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+	return names
+}
+
+func TestCaseFoldView(t *testing.T) {
+	entries := []fuse.DirEntry{
+		{Name: "foo.py"}, {Name: "Foo.py"}, {Name: "README"}, {Name: "FOO.PY"},
+		{Name: "Foo (case 2).py"}, {Name: ".env"}, {Name: ".ENV"}, {Name: "readme"},
+	}
+	view, aliases, conflicts := caseFoldView(entries)
+
+	// Byte order puts upper case first; "Foo (case 2).py" is a real name.
+	wantNames := []string{
+		"foo (case 4).py", "Foo (case 3).py", "README", "FOO.PY",
+		"Foo (case 2).py", ".env (case 2)", ".ENV", "readme (case 2)",
+	}
+	if got := dirEntryNames(view); !reflect.DeepEqual(got, wantNames) {
+		t.Fatalf("view = %q, want %q", got, wantNames)
+	}
+	wantAliases := map[string]string{
+		"Foo (case 3).py": "Foo.py",
+		"foo (case 4).py": "foo.py",
+		".env (case 2)":   ".env",
+		"readme (case 2)": "readme",
+	}
+	if !reflect.DeepEqual(aliases, wantAliases) {
+		t.Fatalf("aliases = %v, want %v", aliases, wantAliases)
+	}
+	wantConflicts := [][]string{{".ENV", ".env"}, {"FOO.PY", "Foo.py", "foo.py"}, {"README", "readme"}}
+	if !reflect.DeepEqual(conflicts, wantConflicts) {
+		t.Fatalf("conflicts = %v, want %v", conflicts, wantConflicts)
+	}
+	if got := dirEntryNames(entries); got[0] != "foo.py" {
+		t.Fatalf("input entries were modified: %q", got)
+	}
+}
+
+func TestCaseFoldViewWithoutConflicts(t *testing.T) {
+	entries := []fuse.DirEntry{{Name: "a.py"}, {Name: "b.py"}}
+	view, aliases, conflicts := caseFoldView(entries)
+	if !reflect.DeepEqual(view, entries) || len(aliases) != 0 || len(conflicts) != 0 {
+		t.Fatalf("unexpected result %v %v %v", view, aliases, conflicts)
+	}
+}
+
+func newNameFixture(t *testing.T, files map[string]string, config *NodeConfig) (*WSNode, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	local, err := backend.NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	root, err := NewRootNode(local, filecache.NewDisabledCache(), "/", NewDirtyNodeRegistry(), config)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	return root, dir
+}
+
+func newCaseFixture(t *testing.T, caseInsensitive bool) *WSNode {
+	t.Helper()
+	root, _ := newNameFixture(t, map[string]string{"Foo.py": "upper\n", "foo.py": "lower\n", "bar.txt": "bar\n"}, &NodeConfig{CaseInsensitive: caseInsensitive})
+	return root
+}
+
+func readdirNames(t *testing.T, node *WSNode) []string {
+	t.Helper()
+	stream, errno := node.Readdir(context.Background())
+	if errno != 0 {
+		t.Fatalf("Readdir errno %d", errno)
+	}
+	var names []string
+	for stream.HasNext() {
+		e, errno := stream.Next()
+		if errno != 0 {
+			t.Fatalf("Next errno %d", errno)
+		}
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func lookupText(t *testing.T, root *WSNode, name string) string {
+	t.Helper()
+	child, errno := root.Lookup(context.Background(), name, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Lookup %s errno %d", name, errno)
+	}
+	return readNodeText(t, child.Operations().(*WSNode))
+}
+
+func TestReaddirCaseSensitiveByDefault(t *testing.T) {
+	root := newCaseFixture(t, false)
+	if got, want := readdirNames(t, root), []string{"Foo.py", "bar.txt", "foo.py"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Readdir = %q, want %q", got, want)
+	}
+	if len(root.caseConflictsWarned) != 1 {
+		t.Fatalf("expected the collision to be recorded once, got %v", root.caseConflictsWarned)
+	}
+	readdirNames(t, root)
+	if len(root.caseConflictsWarned) != 1 {
+		t.Fatalf("expected no duplicate warning state, got %v", root.caseConflictsWarned)
+	}
+	if _, errno := root.Lookup(context.Background(), "FOO.py", &fuse.EntryOut{}); errno != syscall.ENOENT {
+		t.Fatalf("expected ENOENT for a case variant, got %d", errno)
+	}
+}
+
+func TestCaseInsensitiveView(t *testing.T) {
+	root := newCaseFixture(t, true)
+	if got, want := readdirNames(t, root), []string{"Foo.py", "bar.txt", "foo (case 2).py"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Readdir = %q, want %q", got, want)
+	}
+
+	for name, want := range map[string]string{
+		"Foo.py":          "upper\n",
+		"foo.py":          "lower\n",
+		"FOO.PY":          "upper\n",
+		"foo (case 2).py": "lower\n",
+		"BAR.TXT":         "bar\n",
+	} {
+		if got := lookupText(t, root, name); got != want {
+			t.Fatalf("Lookup %s read %q, want %q", name, got, want)
+		}
+	}
+	if _, errno := root.Lookup(context.Background(), "missing.txt", &fuse.EntryOut{}); errno != syscall.ENOENT {
+		t.Fatalf("expected ENOENT, got %d", errno)
+	}
+}
+
+func TestCaseInsensitiveUnlinkResolvesName(t *testing.T) {
+	root := newCaseFixture(t, true)
+	if errno := root.Unlink(context.Background(), "BAR.TXT"); errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	if got, want := readdirNames(t, root), []string{"Foo.py", "foo (case 2).py"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Readdir after unlink = %q, want %q", got, want)
+	}
+}
+
+const (
+	nfcName = "caf\u00e9.txt"
+	nfdName = "cafe\u0301.txt"
+)
+
+func TestNormalizeUnicodeCreatesNFCNames(t *testing.T) {
+	root, dir := newNameFixture(t, nil, &NodeConfig{NormalizeUnicode: true})
+	child, _, _, errno := root.Create(context.Background(), nfdName, uint32(os.O_RDWR), 0o644, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Create errno %d", errno)
+	}
+	if errno := child.Operations().(*WSNode).Release(context.Background(), nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if _, err := os.Stat(filepath.Join(dir, nfcName)); err != nil {
+		t.Fatalf("expected the NFC name in the backend: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, nfdName)); !os.IsNotExist(err) {
+		t.Fatalf("expected no NFD name in the backend, got %v", err)
+	}
+}
+
+func TestNormalizeUnicodeLookupMatchesEitherForm(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{nfdName: "stored decomposed\n"}, &NodeConfig{NormalizeUnicode: true})
+	for _, name := range []string{nfcName, nfdName} {
+		if got := lookupText(t, root, name); got != "stored decomposed\n" {
+			t.Fatalf("Lookup %q read %q", name, got)
+		}
+	}
+	if errno := root.Unlink(context.Background(), nfcName); errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	if _, err := os.Stat(filepath.Join(dir, nfdName)); !os.IsNotExist(err) {
+		t.Fatalf("expected the decomposed file to be deleted, got %v", err)
+	}
+}
+
+func TestNormalizeUnicodeOffKeepsExactNames(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{nfdName: "x\n"}, nil)
+	if _, errno := root.Lookup(context.Background(), nfcName, &fuse.EntryOut{}); errno != syscall.ENOENT {
+		t.Fatalf("expected ENOENT without normalization, got %d", errno)
+	}
+	child, _, _, errno := root.Create(context.Background(), nfdName+".new", uint32(os.O_RDWR), 0o644, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Create errno %d", errno)
+	}
+	if errno := child.Operations().(*WSNode).Release(context.Background(), nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if _, err := os.Stat(filepath.Join(dir, nfdName+".new")); err != nil {
+		t.Fatalf("expected the name to be kept as sent: %v", err)
+	}
+}
+
+func TestCaseFoldViewTreatsNormalizationFormsAsConflicts(t *testing.T) {
+	_, _, conflicts := caseFoldView([]fuse.DirEntry{{Name: nfcName}, {Name: nfdName}})
+	if len(conflicts) != 1 {
+		t.Fatalf("expected NFC and NFD spellings to collide, got %v", conflicts)
+	}
+}
@@ -3,11 +3,17 @@ package fuse
 import (
 	"context"
 	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/databricks/databricks-sdk-go/service/workspace"
+	"github.com/hanwen/go-fuse/v2/fuse"
 
 	"wsfs/internal/databricks"
 )
@@ -429,3 +435,124 @@ func TestDirtyNodeRegistryConcurrent(t *testing.T) {
 		t.Errorf("Expected 0 nodes after unregister, got %d", registry.Count())
 	}
 }
+
+// TestReadDuringFlush checks that an upload does not hold the node lock:
+// reads and writes go on while it runs, and the upload sends the content
+// the file had when it started.
+func TestReadDuringFlush(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var uploads []string
+	api := &databricks.FakeWorkspaceAPI{
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			started <- struct{}{}
+			<-release
+			mu.Lock()
+			uploads = append(uploads, string(data))
+			mu.Unlock()
+			return nil
+		},
+	}
+	registry := NewDirtyNodeRegistry()
+	n := &WSNode{
+		wfClient: api,
+		registry: registry,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeFile,
+			Path:       "/big.bin",
+		}},
+		buf: fileBuffer{Data: []byte{}},
+	}
+	ctx := context.Background()
+	if _, errno := n.Write(ctx, nil, []byte("hello world"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+
+	flushed := make(chan syscall.Errno, 1)
+	go func() { flushed <- n.Fsync(ctx, nil, 0) }()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dest := make([]byte, 16)
+		res, errno := n.Read(ctx, nil, dest, 0)
+		if errno != 0 {
+			t.Errorf("Read errno %d", errno)
+			return
+		}
+		if got, _ := res.Bytes(dest); string(got) != "hello world" {
+			t.Errorf("Read during flush = %q", got)
+		}
+		if _, errno := n.Write(ctx, nil, []byte("HELLO"), 0); errno != 0 {
+			t.Errorf("Write errno %d", errno)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("read blocked behind the upload")
+	}
+
+	close(release)
+	if errno := <-flushed; errno != 0 {
+		t.Fatalf("Fsync errno %d", errno)
+	}
+	// The write made during the upload is still pending.
+	if registry.Count() != 1 {
+		t.Fatalf("dirty files = %d, want the file written during the upload", registry.Count())
+	}
+	if errno := n.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("second Fsync errno %d", errno)
+	}
+	if registry.Count() != 0 {
+		t.Fatalf("file still dirty after the second flush")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"hello world", "HELLO world"}; !reflect.DeepEqual(uploads, want) {
+		t.Fatalf("uploads = %q, want %q", uploads, want)
+	}
+}
+
+// TestUnlinkWaitsForRunningFlush checks that a file unlinked while its
+// first upload runs is deleted after the upload instead of being recreated.
+func TestUnlinkWaitsForRunningFlush(t *testing.T) {
+	root, api, dir, registry := newImportRoot(t, 0)
+	api.gate = make(chan struct{})
+	ctx := context.Background()
+
+	child, _, _, errno := root.Create(ctx, "a.txt", 0, 0644, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Create errno %d", errno)
+	}
+	root.AddChild("a.txt", child, true)
+	node := child.Operations().(*WSNode)
+	if _, errno := node.Write(ctx, nil, []byte("data"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	released := make(chan syscall.Errno, 1)
+	go func() { released <- node.Release(ctx, nil) }()
+	for api.inFlight.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	unlinked := make(chan syscall.Errno, 1)
+	go func() { unlinked <- root.Unlink(ctx, "a.txt") }()
+	time.Sleep(20 * time.Millisecond)
+	close(api.gate)
+
+	if errno := <-released; errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if errno := <-unlinked; errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("a.txt survived the unlink: %v", err)
+	}
+	if registry.Count() != 0 {
+		t.Fatalf("dirty files = %v", registry.Entries())
+	}
+}
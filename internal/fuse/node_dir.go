@@ -1,9 +1,12 @@
 package fuse
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	iofs "io/fs"
 	"path"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
@@ -13,6 +16,7 @@ import (
 	"github.com/hanwen/go-fuse/v2/fuse"
 
 	"wsfs/internal/databricks"
+	"wsfs/internal/events"
 	"wsfs/internal/logging"
 	"wsfs/internal/pathutil"
 )
@@ -48,6 +52,16 @@ func validateChildPath(parentPath, childName string) (string, error) {
 	return cleanPath, nil
 }
 
+// childPath validates name and joins it to this directory. With Unicode
+// normalization enabled the name is converted to NFC first, so files
+// created from macOS get the same name Databricks and other clients use.
+func (n *WSNode) childPath(name string) (string, error) {
+	if n.cfg().NormalizeUnicode {
+		name = pathutil.NormalizeName(name)
+	}
+	return validateChildPath(n.Path(), name)
+}
+
 func notebookVisibleEntryName(info databricks.WSFileInfo, usedNames map[string]struct{}) (string, bool) {
 	preferred := pathutil.NotebookVisibleName(info.Name(), info.Language)
 	if _, exists := usedNames[preferred]; !exists {
@@ -65,8 +79,8 @@ func notebookVisibleEntryName(info databricks.WSFileInfo, usedNames map[string]s
 	return fallback, true
 }
 
-func renameTargetPath(sourceInfo databricks.WSFileInfo, visiblePath string) string {
-	if sourceInfo.IsNotebook() {
+func renameTargetPath(sourceInfo databricks.WSFileInfo, visiblePath string, aliases pathutil.NotebookAliases) string {
+	if sourceInfo.IsNotebook() && aliases.SuffixNames() {
 		if actualPath, _, ok := pathutil.NotebookRemotePathFromSourcePath(visiblePath); ok {
 			return actualPath
 		}
@@ -77,7 +91,27 @@ func renameTargetPath(sourceInfo databricks.WSFileInfo, visiblePath string) stri
 	return visiblePath
 }
 
-func flushRenameChildIfDirty(ctx context.Context, inode *fs.Inode) syscall.Errno {
+// lockRenameSourceFile locks the in-memory node of a regular file that is
+// about to be renamed. The caller keeps the lock from the pre-rename flush
+// until the node's path is retargeted, so a concurrent write or flush cannot
+// upload to the old path after the backend rename and resurrect it.
+func lockRenameSourceFile(inode *fs.Inode) *WSNode {
+	if inode == nil {
+		return nil
+	}
+
+	node, ok := inode.Operations().(*WSNode)
+	if !ok {
+		return nil
+	}
+
+	node.mu.Lock()
+	return node
+}
+
+// flushPendingCreate uploads a file created here that is not in the
+// workspace yet, so it can be renamed there.
+func flushPendingCreate(ctx context.Context, inode *fs.Inode) syscall.Errno {
 	if inode == nil {
 		return 0
 	}
@@ -90,10 +124,9 @@ func flushRenameChildIfDirty(ctx context.Context, inode *fs.Inode) syscall.Errno
 	node.mu.Lock()
 	defer node.mu.Unlock()
 
-	if !node.isDirtyLocked() {
+	if node.createPath == "" {
 		return 0
 	}
-
 	return node.flushLocked(ctx)
 }
 
@@ -138,16 +171,9 @@ func invalidateOverwrittenRenameDestination(inode *fs.Inode, path string) {
 	notifyContentIfPossible(inode, path)
 }
 
-func refreshRenamedNode(ctx context.Context, wfClient databricks.WorkspaceFilesAPI, inode *fs.Inode, visiblePath string, actualPath string) {
-	if inode == nil {
-		return
-	}
-
-	node, ok := inode.Operations().(*WSNode)
-	if !ok {
-		return
-	}
-
+// refreshRenamedNodeLocked reloads metadata for a renamed file node whose
+// lock is held by the caller.
+func refreshRenamedNodeLocked(ctx context.Context, wfClient databricks.WorkspaceFilesAPI, node *WSNode, visiblePath string, actualPath string) {
 	info, err := wfClient.StatFresh(ctx, visiblePath)
 	if err != nil {
 		info, err = wfClient.StatFresh(ctx, actualPath)
@@ -163,16 +189,28 @@ func refreshRenamedNode(ctx context.Context, wfClient databricks.WorkspaceFilesA
 		return
 	}
 
-	node.mu.Lock()
-	defer node.mu.Unlock()
-
 	node.fileInfo = wsInfo
+	node.modifiedAtIsLocal = false
 	node.metadataCheckedAt = time.Now()
 	node.resetBufferLocked()
 	node.buf.ReplaceOnFirstWrite = false
 }
 
-func synthesizedCreatedFileInfo(childPath string, initialContent []byte) databricks.WSFileInfo {
+// retargetNodePathLocked rewrites the node's path after its prefix was renamed.
+func retargetNodePathLocked(node *WSNode, oldPrefix, newPrefix string) {
+	if node.createPath != "" && pathHasPrefix(node.createPath, oldPrefix) {
+		node.createPath = newPrefix + strings.TrimPrefix(node.createPath, oldPrefix)
+	}
+	if !pathHasPrefix(node.fileInfo.Path, oldPrefix) {
+		return
+	}
+	oldPath := node.fileInfo.Path
+	rel := strings.TrimPrefix(oldPath, oldPrefix)
+	node.fileInfo.Path = newPrefix + rel
+	logging.Debugf("Updating internal path for in-memory node from '%s' to '%s'", oldPath, node.fileInfo.Path)
+}
+
+func synthesizedCreatedFileInfo(childPath string, initialContent []byte, aliases pathutil.NotebookAliases) databricks.WSFileInfo {
 	now := time.Now()
 	info := databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
 		Path:       childPath,
@@ -180,7 +218,7 @@ func synthesizedCreatedFileInfo(childPath string, initialContent []byte) databri
 		Size:       int64(len(initialContent)),
 		ModifiedAt: now.UnixMilli(),
 	}}
-	if actualPath, language, ok := pathutil.NotebookRemotePathFromSourcePath(childPath); ok {
+	if actualPath, language, ok := pathutil.NotebookRemotePathFromSourcePath(childPath); ok && aliases.SuffixNames() {
 		info.ObjectInfo.Path = actualPath
 		info.ObjectInfo.ObjectType = workspace.ObjectTypeNotebook
 		info.ObjectInfo.Language = language
@@ -189,6 +227,31 @@ func synthesizedCreatedFileInfo(childPath string, initialContent []byte) databri
 	return info
 }
 
+// newDirInfo returns the metadata of a directory Mkdir just created. With
+// optimistic mkdir it is built from the request, saving a round-trip per
+// level of `mkdir -p`.
+func (n *WSNode) newDirInfo(ctx context.Context, dirPath string) (databricks.WSFileInfo, syscall.Errno) {
+	if n.cfg().OptimisticMkdir {
+		return databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			Path:       dirPath,
+			ObjectType: workspace.ObjectTypeDirectory,
+			ModifiedAt: time.Now().UnixMilli(),
+		}}, 0
+	}
+
+	info, err := n.wfClient.Stat(ctx, dirPath)
+	if err != nil {
+		logging.Warnf("Error stating new directory %s: %v", dirPath, err)
+		return databricks.WSFileInfo{}, syscall.EIO
+	}
+	wsInfo, ok := info.(databricks.WSFileInfo)
+	if !ok {
+		logging.Debugf("Mkdir: unexpected file info type for %s", dirPath)
+		return databricks.WSFileInfo{}, syscall.EIO
+	}
+	return wsInfo, 0
+}
+
 func notifyContentIfPossible(inode *fs.Inode, path string) {
 	if inode == nil {
 		return
@@ -210,6 +273,15 @@ func (n *WSNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 		return nil, syscall.ENOTDIR
 	}
 
+	entries, errno := n.listEntries(ctx)
+	if errno != 0 {
+		return nil, errno
+	}
+	return newDirStream(entries, n.listEntries), 0
+}
+
+// listEntries lists the directory as Readdir shows it.
+func (n *WSNode) listEntries(ctx context.Context) ([]fuse.DirEntry, syscall.Errno) {
 	opCtx, cancel := context.WithTimeout(ctx, dirListTimeout)
 	defer cancel()
 	entries, err := n.wfClient.ReadDir(opCtx, n.Path())
@@ -218,21 +290,140 @@ func (n *WSNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 		return nil, errnoFromBackendError(backendOpReadDir, err)
 	}
 
-	fuseEntries := make([]fuse.DirEntry, 0, len(entries))
-	usedNames := make(map[string]struct{}, len(entries))
+	fuseEntries := n.withoutUnlinked(n.withoutHidden(mergeDirEntries(n.virtualEntries(), visibleDirEntries(entries, n.cfg().NotebookAliases, n.inoFor), n.pendingCreates())))
+	view, _, conflicts := caseFoldView(fuseEntries)
+	n.warnCaseConflicts(conflicts)
+	if n.cfg().CaseInsensitive {
+		fuseEntries = view
+	}
+	n.useChildInos(fuseEntries)
+	n.refreshLoadedChildren(opCtx)
 
-	for _, e := range entries {
+	return fuseEntries, 0
+}
+
+// refreshLoadedChildren rechecks, with one BatchStat, the loaded files of
+// this directory whose metadata TTL has expired. With readdirplus the
+// kernel looks up every listed name right after Readdir, and a child
+// refreshed here answers from its node instead of a stat of its own.
+func (n *WSNode) refreshLoadedChildren(ctx context.Context) {
+	var inodes []*fs.Inode
+	var nodes []*WSNode
+	var paths []string
+	for _, child := range n.Children() {
+		node, ok := child.Operations().(*WSNode)
+		if !ok {
+			continue
+		}
+		node.mu.Lock()
+		stale := !node.fileInfo.IsDir() && node.createPath == "" && !node.isDirtyLocked() &&
+			!node.metadataCheckedAt.IsZero() && !node.metadataFreshLocked()
+		childPath := node.Path()
+		node.mu.Unlock()
+		if stale {
+			inodes = append(inodes, child)
+			nodes = append(nodes, node)
+			paths = append(paths, childPath)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+
+	results := databricks.BatchStat(ctx, n.wfClient, paths)
+	for i, node := range nodes {
+		// Lookup reports errors, and removals, for the name itself.
+		wsInfo, ok := results[i].Info.(databricks.WSFileInfo)
+		if results[i].Err != nil || !ok {
+			continue
+		}
+		node.mu.Lock()
+		changed := false
+		// The node may have been written to, or renamed, meanwhile.
+		if !node.isDirtyLocked() && node.Path() == paths[i] {
+			changed = node.applyRemoteInfoLocked(wsInfo)
+		}
+		node.mu.Unlock()
+		if changed {
+			notifyContentIfPossible(inodes[i], paths[i])
+		}
+	}
+}
+
+// useChildInos gives entries that already have an inode its number, so
+// d_ino matches st_ino even when the inode was numbered before the object
+// existed remotely, e.g. for a file created through the mount.
+func (n *WSNode) useChildInos(entries []fuse.DirEntry) {
+	for i := range entries {
+		if child := n.GetChild(entries[i].Name); child != nil {
+			entries[i].Ino = child.StableAttr().Ino
+		}
+	}
+}
+
+// pendingCreates returns the files created in this directory whose remote
+// create has not happened yet, so a listing shows them right away.
+func (n *WSNode) pendingCreates() []fuse.DirEntry {
+	var pending []fuse.DirEntry
+	for name, child := range n.Children() {
+		node, ok := child.Operations().(*WSNode)
+		if !ok {
+			continue
+		}
+		node.mu.Lock()
+		created := node.createPath != ""
+		node.mu.Unlock()
+		if created {
+			pending = append(pending, fuse.DirEntry{Name: name, Mode: syscall.S_IFREG, Ino: child.StableAttr().Ino})
+		}
+	}
+	return pending
+}
+
+// visibleDirEntries returns the names a directory listing shows: regular
+// entries first, then notebooks under the names aliases gives them. Each
+// entry carries the inode number ino gives the object, as in Lookup.
+func visibleDirEntries(entries []iofs.DirEntry, aliases pathutil.NotebookAliases, ino func(databricks.WSFileInfo) uint64) []fuse.DirEntry {
+	visible := visibleEntries(entries, aliases)
+	fuseEntries := make([]fuse.DirEntry, 0, len(visible))
+	for _, v := range visible {
 		mode := uint32(syscall.S_IFREG)
-		if e.IsDir() {
+		if v.entry.IsDir() {
 			mode = uint32(syscall.S_IFDIR)
 		}
+		entry := fuse.DirEntry{Name: v.name, Mode: mode}
+		if info, err := v.entry.Info(); err == nil {
+			if wsInfo, ok := info.(databricks.WSFileInfo); ok {
+				entry.Ino = ino(wsInfo)
+			}
+		}
+		fuseEntries = append(fuseEntries, entry)
+	}
+	return fuseEntries
+}
+
+// visibleEntry is a backend directory entry under the name the mount shows.
+type visibleEntry struct {
+	name  string
+	entry iofs.DirEntry
+}
+
+// visibleEntries names the entries of a listing: regular entries by their
+// own names, notebooks by their source or fallback names, their workspace
+// names, or both, as aliases says. A notebook shown under both names is
+// listed twice.
+func visibleEntries(entries []iofs.DirEntry, aliases pathutil.NotebookAliases) []visibleEntry {
+	visible := make([]visibleEntry, 0, len(entries))
+	usedNames := make(map[string]struct{}, len(entries))
+
+	for _, e := range entries {
 		wsEntry, ok := e.(databricks.WSDirEntry)
 		if ok && wsEntry.IsNotebook() {
 			continue
 		}
 		name := e.Name()
 		usedNames[name] = struct{}{}
-		fuseEntries = append(fuseEntries, fuse.DirEntry{Name: name, Mode: mode})
+		visible = append(visible, visibleEntry{name: name, entry: e})
 	}
 
 	for _, e := range entries {
@@ -241,23 +432,39 @@ func (n *WSNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 			continue
 		}
 
-		name, visible := notebookVisibleEntryName(wsEntry.WSFileInfo, usedNames)
-		if !visible {
-			continue
+		if aliases.SuffixNames() {
+			if name, shown := notebookVisibleEntryName(wsEntry.WSFileInfo, usedNames); shown {
+				visible = append(visible, visibleEntry{name: name, entry: e})
+			}
+		}
+		if _, used := usedNames[e.Name()]; aliases.BareNames() && !used {
+			usedNames[e.Name()] = struct{}{}
+			visible = append(visible, visibleEntry{name: e.Name(), entry: e})
 		}
-		fuseEntries = append(fuseEntries, fuse.DirEntry{Name: name, Mode: uint32(syscall.S_IFREG)})
 	}
 
-	return fs.NewListDirStream(fuseEntries), 0
+	return visible
 }
 
 func (n *WSNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
 	logging.Debugf("Lookup called on path: %s/%s", n.Path(), name)
+	if errno := n.checkCaller(ctx); errno != 0 {
+		return nil, errno
+	}
 	if !n.fileInfo.IsDir() {
 		return nil, syscall.ENOTDIR
 	}
+	if n.isObjectInfoName(name) {
+		return n.lookupObjectInfoFile(ctx, out)
+	}
+	if n.isControlName(name) {
+		return n.lookupControlDir(ctx, out)
+	}
+	if n.isHiddenName(name) || n.unlinkedChildren.has(name) {
+		return nil, syscall.ENOENT
+	}
 
-	childPath, err := validateChildPath(n.Path(), name)
+	childPath, err := n.childPath(name)
 	if err != nil {
 		logging.Debugf("Lookup: invalid path: %v", err)
 		return nil, syscall.EINVAL
@@ -280,10 +487,10 @@ func (n *WSNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*
 				existingNode.fillAttr(ctx, &out.Attr)
 				if existingNode.buf.Data != nil {
 					out.Attr.Size = uint64(len(existingNode.buf.Data))
-					out.Attr.Blocks = (out.Attr.Size + blockFactor - 1) / blockFactor
+					out.Attr.Blocks = existingNode.blocksLocked(out.Attr.Size)
 				}
 				existingNode.mu.Unlock()
-				n.setEntryOutTimeouts(out)
+				n.setChildEntryOutTimeouts(out, childPath)
 				logging.Debugf("Lookup: returning existing cached node for %s", childPath)
 				return existingChild, 0
 			}
@@ -297,9 +504,12 @@ func (n *WSNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*
 	}
 	listCancel()
 
+	if n.alwaysFresh(childPath) {
+		n.wfClient.CacheInvalidate(childPath)
+	}
 	opCtx, cancel := context.WithTimeout(ctx, metadataOpTimeout)
 	defer cancel()
-	info, err := n.wfClient.Stat(opCtx, childPath)
+	childPath, info, err := n.statChild(opCtx, name, childPath)
 	if err != nil {
 		return nil, errnoFromBackendError(backendOpLookup, err)
 	}
@@ -309,6 +519,10 @@ func (n *WSNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*
 		logging.Debugf("Lookup: unexpected file info type for %s", childPath)
 		return nil, syscall.EIO
 	}
+	if wsInfo.IsNotebook() && wsInfo.Path == childPath && !n.cfg().NotebookAliases.BareNames() {
+		// The workspace name of a notebook is not one of its visible names.
+		return nil, syscall.ENOENT
+	}
 
 	childNode := n.newChildNode(wsInfo)
 	if errno := childNode.ensureNotebookExactSizeLocked(opCtx); errno != 0 {
@@ -316,9 +530,9 @@ func (n *WSNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*
 	}
 	childNode.fillAttr(ctx, &out.Attr)
 
-	n.setEntryOutTimeouts(out)
+	n.setChildEntryOutTimeouts(out, childPath)
 
-	child := n.NewPersistentInode(ctx, childNode, fs.StableAttr{Mode: uint32(out.Mode), Ino: stableIno(wsInfo)})
+	child := n.NewPersistentInode(ctx, childNode, fs.StableAttr{Mode: uint32(out.Mode), Ino: n.inoFor(wsInfo)})
 	return child, 0
 }
 
@@ -328,12 +542,16 @@ func (n *WSNode) Opendir(ctx context.Context) syscall.Errno {
 	if !n.fileInfo.IsDir() {
 		return syscall.ENOTDIR
 	}
+	n.maybeWarmRepo()
 
 	return 0
 }
 
 func (n *WSNode) OpendirHandle(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
 	logging.Debugf("OpendirHandle called on path: %s", n.Path())
+	if errno := n.checkCaller(ctx); errno != 0 {
+		return nil, 0, errno
+	}
 
 	if !n.fileInfo.IsDir() {
 		return nil, 0, syscall.ENOTDIR
@@ -350,38 +568,31 @@ func (n *WSNode) OpendirHandle(ctx context.Context, flags uint32) (fs.FileHandle
 
 func (n *WSNode) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
 	logging.Debugf("Create called in dir: %s, for file: %s", n.Path(), name)
+	if errno := n.checkCaller(ctx); errno != 0 {
+		return nil, nil, 0, errno
+	}
 
-	childPath, err := validateChildPath(n.Path(), name)
+	if n.isControlName(name) || n.isHiddenName(name) {
+		return nil, nil, 0, syscall.EPERM
+	}
+
+	childPath, err := n.childPath(name)
 	if err != nil {
 		logging.Debugf("Create: invalid path: %v", err)
 		return nil, nil, 0, syscall.EINVAL
 	}
+	if errno := n.deleteUnlinkedNow(ctx, name); errno != 0 {
+		return nil, nil, 0, errno
+	}
 
 	var initialContent []byte
-	if _, language, ok := pathutil.NotebookRemotePathFromSourcePath(name); ok {
+	if _, language, ok := pathutil.NotebookRemotePathFromSourcePath(name); ok && n.cfg().NotebookAliases.SuffixNames() {
 		initialContent = []byte(pathutil.NotebookSourceHeader(language) + "\n")
 	}
 
-	opCtx, cancel := context.WithTimeout(ctx, dataOpTimeout)
-	defer cancel()
-
-	err = n.wfClient.Write(opCtx, childPath, initialContent)
-	if err != nil {
-		logging.Warnf("Error creating file %s: %v", childPath, err)
-		return nil, nil, 0, errnoFromBackendError(backendOpCreate, err)
-	}
-
-	info, err := n.wfClient.StatFresh(opCtx, childPath)
-	wsInfo, ok := info.(databricks.WSFileInfo)
-	if err != nil {
-		logging.Warnf("Error stating new file %s: %v", childPath, err)
-		wsInfo = synthesizedCreatedFileInfo(childPath, initialContent)
-		ok = true
-	} else if !ok {
-		logging.Debugf("Create: unexpected file info type for %s", childPath)
-		wsInfo = synthesizedCreatedFileInfo(childPath, initialContent)
-		ok = true
-	}
+	// The remote create happens on the first flush, so Create does not wait
+	// for the workspace.
+	wsInfo := synthesizedCreatedFileInfo(childPath, initialContent, n.cfg().NotebookAliases)
 	childNode := n.newChildNode(wsInfo)
 	childNode.buf = fileBuffer{ReplaceOnFirstWrite: len(initialContent) > 0}
 	if len(initialContent) > 0 {
@@ -389,29 +600,73 @@ func (n *WSNode) Create(ctx context.Context, name string, flags uint32, mode uin
 	} else {
 		childNode.buf.Data = []byte{}
 	}
+	childNode.createPath = childPath
+	childNode.localTemp = n.isLocalTempName(name)
+	childNode.markModifiedLocked(time.Now())
+	childNode.markDirtyLocked(dirtyCreate)
 	childNode.allowPostCreateTimestamps = true
+	if n.bulk != nil && !childNode.localTemp {
+		n.bulk.noteCreate()
+		childNode.bulkEligible = true
+	}
 	childNode.incrementOpenLocked()
 	childNode.fillAttr(ctx, &out.Attr)
 
-	n.setEntryOutTimeouts(out)
+	n.setChildEntryOutTimeouts(out, childPath)
 
-	child := n.NewPersistentInode(ctx, childNode, fs.StableAttr{Mode: uint32(out.Mode), Ino: stableIno(wsInfo)})
-	return child, &wsFileHandle{}, fuse.FOPEN_KEEP_CACHE, 0
+	child := n.NewPersistentInode(ctx, childNode, fs.StableAttr{Mode: uint32(out.Mode), Ino: n.inoFor(wsInfo)})
+	n.publishChild(events.OpCreate, name, false)
+	return child, newFileHandle(flags), fuse.FOPEN_KEEP_CACHE, 0
 }
 
 func (n *WSNode) Unlink(ctx context.Context, name string) syscall.Errno {
 	logging.Debugf("Unlink called in dir: %s, for file: %s", n.Path(), name)
+	if errno := n.checkCaller(ctx); errno != 0 {
+		return errno
+	}
+
+	if n.isControlName(name) {
+		return syscall.EPERM
+	}
 
-	childPath, err := validateChildPath(n.Path(), name)
+	childPath, err := n.childPath(name)
 	if err != nil {
 		logging.Debugf("Unlink: invalid path: %v", err)
 		return syscall.EINVAL
 	}
 
+	// Hold a queued upload off until the file is gone, then drop it so it
+	// does not recreate the file. An upload already running is waited for.
+	var pending *WSNode
+	if child := n.GetChild(name); child != nil {
+		if node, ok := child.Operations().(*WSNode); ok {
+			pending = node
+			pending.mu.Lock()
+			defer pending.mu.Unlock()
+			pending.waitFlushLocked()
+		}
+	}
+	if pending != nil && pending.createPath != "" && pending.openCount > 0 {
+		// Created here, never uploaded and still open: keep the content
+		// for the open handles until they close.
+		n.deferDeleteLocked(pending, name, "")
+		n.notifyDeletedLater(name)
+		n.publishChild(events.OpDelete, name, false)
+		return 0
+	}
+	if pending != nil && pending.createPath != "" {
+		// Created here and never uploaded: there is nothing to delete.
+		pending.resetBufferLocked()
+		pending.createPath = ""
+		pending.localTemp = false
+		n.publishChild(events.OpDelete, name, false)
+		return 0
+	}
+
 	opCtx, cancel := context.WithTimeout(ctx, metadataOpTimeout)
 	defer cancel()
 
-	info, err := n.wfClient.Stat(opCtx, childPath)
+	childPath, info, err := n.statChild(opCtx, name, childPath)
 	if err != nil {
 		return errnoFromBackendError(backendOpDelete, err)
 	}
@@ -420,11 +675,25 @@ func (n *WSNode) Unlink(ctx context.Context, name string) syscall.Errno {
 		return syscall.EISDIR
 	}
 
+	if pending != nil && pending.openCount > 0 {
+		actualPath := childPath
+		if wsInfo, ok := info.(databricks.WSFileInfo); ok {
+			actualPath = wsInfo.Path
+		}
+		n.deferDeleteLocked(pending, name, actualPath)
+		n.notifyDeletedLater(name)
+		n.publishChild(events.OpDelete, name, false)
+		return 0
+	}
+
 	err = n.wfClient.Delete(opCtx, childPath, false)
 	if err != nil {
 		logging.Warnf("Error deleting file %s: %v", childPath, err)
 		return errnoFromBackendError(backendOpDelete, err)
 	}
+	if pending != nil {
+		pending.discardBulkUploadLocked()
+	}
 
 	actualPath := childPath
 	if wsInfo, ok := info.(databricks.WSFileInfo); ok {
@@ -435,14 +704,23 @@ func (n *WSNode) Unlink(ctx context.Context, name string) syscall.Errno {
 			logging.Debugf("Failed to delete from cache %s: %v", actualPath, err)
 		}
 	}
+	n.notifyDeletedLater(name)
+	n.publishChild(events.OpDelete, name, false)
 
 	return 0
 }
 
 func (n *WSNode) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
 	logging.Debugf("Mkdir called in dir: %s, for new dir: %s", n.Path(), name)
+	if errno := n.checkCaller(ctx); errno != 0 {
+		return nil, errno
+	}
+
+	if n.isControlName(name) || n.isHiddenName(name) {
+		return nil, syscall.EPERM
+	}
 
-	childPath, err := validateChildPath(n.Path(), name)
+	childPath, err := n.childPath(name)
 	if err != nil {
 		logging.Debugf("Mkdir: invalid path: %v", err)
 		return nil, syscall.EINVAL
@@ -450,6 +728,9 @@ func (n *WSNode) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.
 
 	opCtx, cancel := context.WithTimeout(ctx, metadataOpTimeout)
 	defer cancel()
+	if errno := n.deleteUnlinkedNow(opCtx, name); errno != 0 {
+		return nil, errno
+	}
 
 	err = n.wfClient.Mkdir(opCtx, childPath)
 	if err != nil {
@@ -457,29 +738,30 @@ func (n *WSNode) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.
 		return nil, errnoFromBackendError(backendOpMkdir, err)
 	}
 
-	info, err := n.wfClient.Stat(opCtx, childPath)
-	if err != nil {
-		logging.Warnf("Error stating new directory %s: %v", childPath, err)
-		return nil, syscall.EIO
-	}
-
-	wsInfo, ok := info.(databricks.WSFileInfo)
-	if !ok {
-		logging.Debugf("Mkdir: unexpected file info type for %s", childPath)
-		return nil, syscall.EIO
+	wsInfo, errno := n.newDirInfo(opCtx, childPath)
+	if errno != 0 {
+		return nil, errno
 	}
 	childNode := n.newChildNode(wsInfo)
 	childNode.fillAttr(ctx, &out.Attr)
-	n.setEntryOutTimeouts(out)
+	n.setChildEntryOutTimeouts(out, childPath)
 
-	child := n.NewPersistentInode(ctx, childNode, fs.StableAttr{Mode: uint32(out.Mode), Ino: stableIno(wsInfo)})
+	child := n.NewPersistentInode(ctx, childNode, fs.StableAttr{Mode: uint32(out.Mode), Ino: n.inoFor(wsInfo)})
+	n.publishChild(events.OpCreate, name, true)
 	return child, 0
 }
 
 func (n *WSNode) Rmdir(ctx context.Context, name string) syscall.Errno {
 	logging.Debugf("Rmdir called in dir: %s, for dir: %s", n.Path(), name)
+	if errno := n.checkCaller(ctx); errno != 0 {
+		return errno
+	}
 
-	childPath, err := validateChildPath(n.Path(), name)
+	if n.isControlName(name) {
+		return syscall.EPERM
+	}
+
+	childPath, err := n.childPath(name)
 	if err != nil {
 		logging.Debugf("Rmdir: invalid path: %v", err)
 		return syscall.EINVAL
@@ -488,7 +770,7 @@ func (n *WSNode) Rmdir(ctx context.Context, name string) syscall.Errno {
 	opCtx, cancel := context.WithTimeout(ctx, metadataOpTimeout)
 	defer cancel()
 
-	info, err := n.wfClient.Stat(opCtx, childPath)
+	childPath, info, err := n.statChild(opCtx, name, childPath)
 	if err != nil {
 		return errnoFromBackendError(backendOpDeleteDir, err)
 	}
@@ -501,31 +783,44 @@ func (n *WSNode) Rmdir(ctx context.Context, name string) syscall.Errno {
 		logging.Warnf("Error deleting directory %s: %v", childPath, err)
 		return errnoFromBackendError(backendOpDeleteDir, err)
 	}
+	n.notifyDeletedLater(name)
+	n.publishChild(events.OpDelete, name, true)
 
 	return 0
 }
 
 func (n *WSNode) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
 	logging.Debugf("Rename called from %s to %s", name, newName)
+	if errno := n.checkCaller(ctx); errno != 0 {
+		return errno
+	}
 
 	newParentNode, ok := newParent.EmbeddedInode().Operations().(*WSNode)
 	if !ok {
 		logging.Debugf("Rename: failed to get parent node for %s", newName)
 		return syscall.EIO
 	}
+	if n.isControlName(name) || newParentNode.isControlName(newName) || newParentNode.isHiddenName(newName) {
+		return syscall.EPERM
+	}
 
-	oldPath, err := validateChildPath(n.Path(), name)
+	oldPath, err := n.childPath(name)
 	if err != nil {
 		logging.Debugf("Rename: invalid old path: %v", err)
 		return syscall.EINVAL
 	}
 
-	newPath, err := validateChildPath(newParentNode.fileInfo.Path, newName)
+	newPath, err := newParentNode.childPath(newName)
 	if err != nil {
 		logging.Debugf("Rename: invalid new path: %v", err)
 		return syscall.EINVAL
 	}
 
+	if flags&fs.RENAME_EXCHANGE != 0 {
+		// The workspace API has no atomic swap.
+		return syscall.EINVAL
+	}
+
 	childInode := n.GetChild(name)
 	destChildInode := newParentNode.GetChild(newName)
 	if destChildInode == childInode {
@@ -534,7 +829,27 @@ func (n *WSNode) Rename(ctx context.Context, name string, newParent fs.InodeEmbe
 
 	opCtx, cancel := context.WithTimeout(ctx, metadataOpTimeout)
 	defer cancel()
-	info, err := n.wfClient.Stat(opCtx, oldPath)
+	if errno := newParentNode.deleteUnlinkedNow(opCtx, newName); errno != 0 {
+		return errno
+	}
+	if flags&renameNoReplace != 0 {
+		// The backend replaces an existing destination, so check first.
+		_, err := n.wfClient.Stat(opCtx, newPath)
+		if err == nil {
+			return syscall.EEXIST
+		}
+		if errno := errnoFromBackendError(backendOpRename, err); errno != syscall.ENOENT {
+			return errno
+		}
+	}
+	if errno, handled := n.renameLocalTemp(childInode, name, newParentNode, newName, newPath, destChildInode); handled {
+		return errno
+	}
+	if errno := flushPendingCreate(ctx, childInode); errno != 0 {
+		logging.Warnf("Error creating %s before rename to %s: %v", oldPath, newPath, errno)
+		return errno
+	}
+	oldPath, info, err := n.statChild(opCtx, name, oldPath)
 	if err != nil {
 		return errnoFromBackendError(backendOpRename, err)
 	}
@@ -545,14 +860,43 @@ func (n *WSNode) Rename(ctx context.Context, name string, newParent fs.InodeEmbe
 		return syscall.EIO
 	}
 
-	if childInode != nil && !wsInfo.IsDir() {
+	var fileNode *WSNode
+	var subtreeFiles []*WSNode
+	if !wsInfo.IsDir() {
+		fileNode = lockRenameSourceFile(childInode)
+	}
+	unlockFileNode := func() {
+		if fileNode != nil {
+			fileNode.mu.Unlock()
+			fileNode = nil
+		}
+	}
+	defer unlockFileNode()
+	unlockSubtreeFiles := func() {
+		for _, node := range subtreeFiles {
+			node.mu.Unlock()
+		}
+		subtreeFiles = nil
+	}
+	defer unlockSubtreeFiles()
+
+	if fileNode != nil && fileNode.isDirtyLocked() {
 		flushCtx, flushCancel := context.WithTimeout(ctx, dataOpTimeout)
 		defer flushCancel()
-		if errno := flushRenameChildIfDirty(flushCtx, childInode); errno != 0 {
+		if errno := fileNode.flushLocked(flushCtx); errno != 0 {
 			logging.Warnf("Error flushing dirty file before rename %s -> %s: %v", oldPath, newPath, errno)
 			return errno
 		}
 	}
+	if wsInfo.IsDir() {
+		flushCtx, flushCancel := context.WithTimeout(ctx, dataOpTimeout)
+		defer flushCancel()
+		var errno syscall.Errno
+		if subtreeFiles, errno = lockSubtreeFiles(flushCtx, childInode); errno != 0 {
+			logging.Warnf("Error flushing dirty files before rename %s -> %s: %v", oldPath, newPath, errno)
+			return errno
+		}
+	}
 	if errno := ensureOverwriteRenameDestinationReady(destChildInode); errno != 0 {
 		return errno
 	}
@@ -564,41 +908,144 @@ func (n *WSNode) Rename(ctx context.Context, name string, newParent fs.InodeEmbe
 	}
 
 	actualOldPath := wsInfo.Path
-	actualNewPath := renameTargetPath(wsInfo, newPath)
+	actualNewPath := renameTargetPath(wsInfo, newPath, n.cfg().NotebookAliases)
 	n.deleteDiskCacheEntries(actualOldPath, actualNewPath)
 	invalidateOverwrittenRenameDestination(destChildInode, newPath)
 
-	if childInode != nil {
-		if !wsInfo.IsDir() {
-			refreshRenamedNode(opCtx, n.wfClient, childInode, newPath, actualNewPath)
-			notifyContentIfPossible(childInode, newPath)
+	if fileNode != nil {
+		refreshRenamedNodeLocked(opCtx, n.wfClient, fileNode, newPath, actualNewPath)
+		retargetNodePathLocked(fileNode, actualOldPath, actualNewPath)
+		// An atomic save over a notebook leaves this node on the notebook.
+		n.deleteDiskCacheEntries(fileNode.Path())
+		// The node now stands for another notebook if the save was imported.
+		objectID := fileNode.fileInfo.ObjectId
+		savedNotebook := fileNode.fileInfo.IsNotebook() && objectID != wsInfo.ObjectId
+		// Release before notifying the kernel: invalidation may call back into Read.
+		unlockFileNode()
+		notifyContentIfPossible(childInode, newPath)
+		if wsInfo.IsNotebook() {
+			// The old directory may still resolve the notebook's aliases.
+			n.notifyDeletedLater(name)
+		}
+		if savedNotebook {
+			newParentNode.forgetRestoredBackups(newName, objectID)
+		}
+	} else if wsInfo.IsDir() {
+		n.renameDiskCacheEntries(actualOldPath, actualNewPath)
+		updateSubtreePaths(childInode, actualOldPath, actualNewPath, subtreeFiles)
+		for _, node := range subtreeFiles {
+			// The cache file was renamed with its entry; look it up again.
+			if node.buf.CachedPath != "" {
+				node.clearCachedFileLocked()
+			}
 		}
-		updateSubtreePaths(childInode, actualOldPath, actualNewPath)
+		unlockSubtreeFiles()
+	} else if childInode != nil {
+		updateSubtreePaths(childInode, actualOldPath, actualNewPath, nil)
+	}
+	if n.cfg().Events != nil {
+		n.cfg().Events.Publish(events.Event{Op: events.OpRename, Path: newParentNode.mountPath(newName), OldPath: n.mountPath(name), Dir: wsInfo.IsDir()})
 	}
 
 	return 0
 }
 
-func updateSubtreePaths(inode *fs.Inode, oldPrefix, newPrefix string) {
+// forgetRestoredBackups drops the editor backup names of name whose
+// notebook, objectID, a save over name moved back to it. The backend left
+// a regular file with the old content there, which needs a new lookup.
+func (n *WSNode) forgetRestoredBackups(name string, objectID int64) {
+	for _, backupName := range pathutil.EditorBackupPaths(name) {
+		child := n.GetChild(backupName)
+		if child == nil {
+			continue
+		}
+		node, ok := child.Operations().(*WSNode)
+		if !ok {
+			continue
+		}
+		node.mu.Lock()
+		restored := node.fileInfo.IsNotebook() && node.fileInfo.ObjectId == objectID
+		if restored {
+			node.metadataCheckedAt = time.Time{}
+		}
+		node.mu.Unlock()
+		if restored {
+			n.notifyDeletedLater(backupName)
+		}
+	}
+}
+
+// updateSubtreePaths retargets the loaded nodes below a renamed inode.
+// The nodes in locked are already locked by the caller.
+func updateSubtreePaths(inode *fs.Inode, oldPrefix, newPrefix string, locked []*WSNode) {
 	if inode == nil {
 		return
 	}
 
 	if node, ok := inode.Operations().(*WSNode); ok {
-		node.mu.Lock()
-		if pathHasPrefix(node.fileInfo.Path, oldPrefix) {
-			oldPath := node.fileInfo.Path
-			rel := strings.TrimPrefix(oldPath, oldPrefix)
-			node.fileInfo.Path = newPrefix + rel
-			logging.Debugf("Updating internal path for in-memory node from '%s' to '%s'", oldPath, node.fileInfo.Path)
+		if slices.Contains(locked, node) {
+			retargetNodePathLocked(node, oldPrefix, newPrefix)
+		} else {
+			node.mu.Lock()
+			retargetNodePathLocked(node, oldPrefix, newPrefix)
+			node.mu.Unlock()
 		}
-		node.mu.Unlock()
 	}
 
 	children := inode.Children()
 	for _, child := range children {
-		updateSubtreePaths(child, oldPrefix, newPrefix)
+		updateSubtreePaths(child, oldPrefix, newPrefix, locked)
+	}
+}
+
+// lockSubtreeFiles locks the loaded files below a directory that is about
+// to be renamed and uploads their unsaved changes to the old path first,
+// as Rename does for a single file: the changes are in the workspace before
+// the tree moves, and no upload started later lands on the old path and
+// brings it back. The caller unlocks the nodes once their paths are
+// retargeted. On an upload error the nodes are unlocked and the rename
+// must not go ahead.
+func lockSubtreeFiles(ctx context.Context, inode *fs.Inode) ([]*WSNode, syscall.Errno) {
+	if inode == nil {
+		return nil, 0
+	}
+	type subtreeFile struct {
+		ino  uint64
+		node *WSNode
+	}
+	var files []subtreeFile
+	var walk func(inode *fs.Inode)
+	walk = func(inode *fs.Inode) {
+		for _, child := range inode.Children() {
+			node, ok := child.Operations().(*WSNode)
+			if !ok {
+				continue
+			}
+			if child.IsDir() {
+				walk(child)
+				continue
+			}
+			files = append(files, subtreeFile{ino: child.StableAttr().Ino, node: node})
+		}
+	}
+	walk(inode)
+	// Renames in different directories run concurrently and may cover the
+	// same files, so every caller locks them in inode number order.
+	slices.SortFunc(files, func(a, b subtreeFile) int { return cmp.Compare(a.ino, b.ino) })
+
+	locked := make([]*WSNode, 0, len(files))
+	for _, file := range files {
+		file.node.mu.Lock()
+		locked = append(locked, file.node)
+		// flushLocked also waits out an upload already running.
+		if errno := file.node.flushLocked(ctx); errno != 0 {
+			for _, node := range locked {
+				node.mu.Unlock()
+			}
+			return nil, errno
+		}
 	}
+	return locked, 0
 }
 
 func pathHasPrefix(path, prefix string) bool {
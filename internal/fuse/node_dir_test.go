@@ -3,8 +3,10 @@ package fuse
 import (
 	"context"
 	iofs "io/fs"
+	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"syscall"
 	"testing"
 	"time"
@@ -16,6 +18,7 @@ import (
 
 	"wsfs/internal/databricks"
 	"wsfs/internal/filecache"
+	"wsfs/internal/pathutil"
 )
 
 type dirFirstLookupAPI struct {
@@ -86,6 +89,7 @@ func newTestRootNode(t *testing.T, api databricks.WorkspaceFilesAPI) *WSNode {
 	t.Helper()
 	root := &WSNode{
 		wfClient: api,
+		config:   &NodeConfig{},
 		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
 			ObjectType: workspace.ObjectTypeDirectory,
 			Path:       "/",
@@ -284,9 +288,9 @@ func TestWSNodeLookupSuccess(t *testing.T) {
 		},
 	}
 	root := newTestRootNode(t, api)
-	root.ownerUid = 11
-	root.ownerGid = 22
-	root.restrictAccess = true
+	root.config.OwnerUid = 11
+	root.config.OwnerGid = 22
+	root.config.RestrictAccess = true
 
 	out := &fuse.EntryOut{}
 	inode, errno := root.Lookup(context.Background(), "file.txt", out)
@@ -297,8 +301,8 @@ func TestWSNodeLookupSuccess(t *testing.T) {
 	if !ok {
 		t.Fatal("expected WSNode child")
 	}
-	if child.ownerUid != root.ownerUid || child.ownerGid != root.ownerGid || child.restrictAccess != root.restrictAccess {
-		t.Fatal("child did not inherit access config")
+	if child.config != root.config {
+		t.Fatal("child does not share the mount config")
 	}
 }
 
@@ -425,6 +429,12 @@ func TestWSNodeCreateFile(t *testing.T) {
 	if flags != fuse.FOPEN_KEEP_CACHE {
 		t.Fatalf("unexpected flags: %d", flags)
 	}
+	if wrotePath != "" {
+		t.Fatalf("Create wrote %s before the first flush", wrotePath)
+	}
+	if errno := child.Operations().(*WSNode).Release(context.Background(), fh); errno != 0 {
+		t.Fatalf("Release failed: %d", errno)
+	}
 	if wrotePath != "/file.txt" {
 		t.Fatalf("unexpected write path: %s", wrotePath)
 	}
@@ -472,9 +482,11 @@ func TestWSNodeCreateFileFirstWriteSkipsRemoteRead(t *testing.T) {
 }
 
 func TestWSNodeCreateNotebook(t *testing.T) {
+	var wrotePath string
 	var wroteData []byte
 	api := &databricks.FakeWorkspaceAPI{
 		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			wrotePath = filepath
 			wroteData = append([]byte(nil), data...)
 			return nil
 		},
@@ -488,6 +500,13 @@ func TestWSNodeCreateNotebook(t *testing.T) {
 	if errno != 0 || child == nil {
 		t.Fatalf("Create failed: errno=%d child=%v", errno, child)
 	}
+	if errno := child.Operations().(*WSNode).Release(context.Background(), nil); errno != 0 {
+		t.Fatalf("Release failed: %d", errno)
+	}
+	// The source name tells the backend to create a notebook.
+	if wrotePath != "/note.py" {
+		t.Fatalf("unexpected write path: %s", wrotePath)
+	}
 	if string(wroteData) != "# Databricks notebook source\n" {
 		t.Fatalf("unexpected notebook content: %q", string(wroteData))
 	}
@@ -635,6 +654,52 @@ func TestWSNodeMkdir(t *testing.T) {
 	}
 }
 
+func TestWSNodeMkdirOptimisticSkipsStat(t *testing.T) {
+	var mkdirs []string
+	api := &databricks.FakeWorkspaceAPI{
+		MkdirFunc: func(ctx context.Context, dirPath string) error {
+			mkdirs = append(mkdirs, dirPath)
+			return nil
+		},
+		StatFunc: func(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+			t.Fatalf("unexpected Stat of %s", filePath)
+			return nil, nil
+		},
+	}
+	root := newTestRootNode(t, api)
+	root.config.OptimisticMkdir = true
+
+	dir := root
+	for _, name := range []string{"deep", "tree", "of", "dirs"} {
+		out := &fuse.EntryOut{}
+		inode, errno := dir.Mkdir(context.Background(), name, 0755, out)
+		if errno != 0 {
+			t.Fatalf("Mkdir %s errno %d", name, errno)
+		}
+		if out.Mode&syscall.S_IFDIR == 0 {
+			t.Fatalf("Mkdir %s returned mode %o, want a directory", name, out.Mode)
+		}
+		dir = inode.Operations().(*WSNode)
+	}
+	if dir.Path() != "/deep/tree/of/dirs" || !dir.fileInfo.IsDir() {
+		t.Fatalf("innermost node = %s (dir %v)", dir.Path(), dir.fileInfo.IsDir())
+	}
+	if len(mkdirs) != 4 {
+		t.Fatalf("mkdir calls = %v, want one per level", mkdirs)
+	}
+}
+
+func TestWSNodeMkdirOptimisticReportsMkdirErrors(t *testing.T) {
+	api := &databricks.FakeWorkspaceAPI{
+		MkdirFunc: func(ctx context.Context, dirPath string) error { return apierr.ErrPermissionDenied },
+	}
+	root := newTestRootNode(t, api)
+	root.config.OptimisticMkdir = true
+	if _, errno := root.Mkdir(context.Background(), "newdir", 0755, &fuse.EntryOut{}); errno != syscall.EACCES {
+		t.Fatalf("expected EACCES, got %d", errno)
+	}
+}
+
 func TestWSNodeMkdirInvalidName(t *testing.T) {
 	api := &databricks.FakeWorkspaceAPI{}
 	root := newTestRootNode(t, api)
@@ -869,8 +934,12 @@ func TestWSNodeCreateMapsMissingParentToENOENT(t *testing.T) {
 	}
 	root := newTestRootNode(t, api)
 	out := &fuse.EntryOut{}
-	_, _, _, errno := root.Create(context.Background(), "file.txt", 0, 0644, out)
-	if errno != syscall.ENOENT {
+	child, _, _, errno := root.Create(context.Background(), "file.txt", 0, 0644, out)
+	if errno != 0 {
+		t.Fatalf("Create failed: %d", errno)
+	}
+	// The remote create is deferred, so the error surfaces on close.
+	if errno := child.Operations().(*WSNode).Release(context.Background(), nil); errno != syscall.ENOENT {
 		t.Fatalf("expected ENOENT, got %d", errno)
 	}
 }
@@ -883,8 +952,12 @@ func TestWSNodeCreateMapsPermissionDeniedToEACCES(t *testing.T) {
 	}
 	root := newTestRootNode(t, api)
 	out := &fuse.EntryOut{}
-	_, _, _, errno := root.Create(context.Background(), "file.txt", 0, 0644, out)
-	if errno != syscall.EACCES {
+	child, _, _, errno := root.Create(context.Background(), "file.txt", 0, 0644, out)
+	if errno != 0 {
+		t.Fatalf("Create failed: %d", errno)
+	}
+	// The remote create is deferred, so the error surfaces on close.
+	if errno := child.Operations().(*WSNode).Release(context.Background(), nil); errno != syscall.EACCES {
 		t.Fatalf("expected EACCES, got %d", errno)
 	}
 }
@@ -961,6 +1034,42 @@ func TestWSNodeRenameConflictMapsToEEXIST(t *testing.T) {
 	}
 }
 
+func TestWSNodeRenameNoReplaceRefusesExistingDestination(t *testing.T) {
+	renameCalled := false
+	api := &databricks.FakeWorkspaceAPI{
+		StatFunc: func(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+			if path.Base(filePath) == "missing.txt" {
+				return nil, iofs.ErrNotExist
+			}
+			return databricks.NewTestFileInfo(filePath, 0, false), nil
+		},
+		RenameFunc: func(ctx context.Context, sourcePath string, destinationPath string) error {
+			renameCalled = true
+			return nil
+		},
+	}
+	root := newTestRootNode(t, api)
+	if errno := root.Rename(context.Background(), "file.txt", root, "new.txt", renameNoReplace); errno != syscall.EEXIST {
+		t.Fatalf("expected EEXIST, got %d", errno)
+	}
+	if renameCalled {
+		t.Fatal("expected no backend rename with RENAME_NOREPLACE over an existing file")
+	}
+	if errno := root.Rename(context.Background(), "file.txt", root, "missing.txt", renameNoReplace); errno != 0 {
+		t.Fatalf("expected RENAME_NOREPLACE to a free name to succeed, got %d", errno)
+	}
+	if !renameCalled {
+		t.Fatal("expected backend rename")
+	}
+}
+
+func TestWSNodeRenameExchangeRejected(t *testing.T) {
+	root := newTestRootNode(t, &databricks.FakeWorkspaceAPI{})
+	if errno := root.Rename(context.Background(), "a.txt", root, "b.txt", fs.RENAME_EXCHANGE); errno != syscall.EINVAL {
+		t.Fatalf("expected EINVAL, got %d", errno)
+	}
+}
+
 func TestWSNodeUnlinkDirectoryNameReject(t *testing.T) {
 	api := &databricks.FakeWorkspaceAPI{}
 	root := newTestRootNode(t, api)
@@ -976,21 +1085,25 @@ func TestRenameTargetPath(t *testing.T) {
 		Language:   workspace.LanguagePython,
 	}}
 
-	if got := renameTargetPath(notebookInfo, "/dir/renamed.sql"); got != "/dir/renamed" {
+	if got := renameTargetPath(notebookInfo, "/dir/renamed.sql", pathutil.NotebookAliasesSuffixOnly); got != "/dir/renamed" {
 		t.Fatalf("renameTargetPath(notebook, source suffix) = %q, want /dir/renamed", got)
 	}
-	if got := renameTargetPath(notebookInfo, "/dir/renamed.ipynb"); got != "/dir/renamed" {
+	if got := renameTargetPath(notebookInfo, "/dir/renamed.ipynb", pathutil.NotebookAliasesSuffixOnly); got != "/dir/renamed" {
 		t.Fatalf("renameTargetPath(notebook, fallback suffix) = %q, want /dir/renamed", got)
 	}
 
+	if got := renameTargetPath(notebookInfo, "/dir/renamed.py", pathutil.NotebookAliasesNone); got != "/dir/renamed.py" {
+		t.Fatalf("renameTargetPath(notebook, none) = %q, want /dir/renamed.py", got)
+	}
+
 	regularInfo := databricks.NewTestFileInfo("/dir/file.txt", 1, false)
-	if got := renameTargetPath(regularInfo, "/dir/renamed.txt"); got != "/dir/renamed.txt" {
+	if got := renameTargetPath(regularInfo, "/dir/renamed.txt", pathutil.NotebookAliasesSuffixOnly); got != "/dir/renamed.txt" {
 		t.Fatalf("renameTargetPath(regular) = %q, want /dir/renamed.txt", got)
 	}
 }
 
 func TestSynthesizedCreatedFileInfo(t *testing.T) {
-	regular := synthesizedCreatedFileInfo("/dir/file.txt", []byte("abc"))
+	regular := synthesizedCreatedFileInfo("/dir/file.txt", []byte("abc"), pathutil.NotebookAliasesSuffixOnly)
 	if regular.Path != "/dir/file.txt" {
 		t.Fatalf("regular synthesized path = %q, want /dir/file.txt", regular.Path)
 	}
@@ -1001,7 +1114,7 @@ func TestSynthesizedCreatedFileInfo(t *testing.T) {
 		t.Fatalf("regular synthesized size = %d, want 3", regular.Size())
 	}
 
-	notebook := synthesizedCreatedFileInfo("/dir/note.py", []byte("# Databricks notebook source\n"))
+	notebook := synthesizedCreatedFileInfo("/dir/note.py", []byte("# Databricks notebook source\n"), pathutil.NotebookAliasesSuffixOnly)
 	if notebook.Path != "/dir/note" {
 		t.Fatalf("notebook synthesized path = %q, want /dir/note", notebook.Path)
 	}
@@ -1014,6 +1127,11 @@ func TestSynthesizedCreatedFileInfo(t *testing.T) {
 	if !notebook.NotebookSizeComputed {
 		t.Fatal("expected notebook exact size to be marked computed")
 	}
+
+	literal := synthesizedCreatedFileInfo("/dir/note.py", nil, pathutil.NotebookAliasesNone)
+	if literal.Path != "/dir/note.py" || literal.ObjectType != workspace.ObjectTypeFile {
+		t.Fatalf("synthesized with aliases none = %s %q, want a FILE at /dir/note.py", literal.ObjectType, literal.Path)
+	}
 }
 
 func TestPathHasPrefix(t *testing.T) {
@@ -1038,3 +1156,211 @@ func TestPathHasPrefix(t *testing.T) {
 		})
 	}
 }
+
+// createLocal creates name under dir like the FUSE bridge: the returned
+// node is linked into the tree and open.
+func createLocal(t *testing.T, dir *WSNode, name string) *WSNode {
+	t.Helper()
+	child, _, _, errno := dir.Create(context.Background(), name, 0, 0644, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Create %s errno %d", name, errno)
+	}
+	dir.AddChild(name, child, true)
+	return child.Operations().(*WSNode)
+}
+
+func TestCreateDefersRemoteCreateToFlush(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{"existing.txt": "x"}, nil)
+	ctx := context.Background()
+
+	node := createLocal(t, root, "new.txt")
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("Create reached the backend before the first flush: %v", err)
+	}
+	if entries := root.registry.Entries(); len(entries) != 1 || entries[0].Path != "/new.txt" {
+		t.Fatalf("dirty entries = %v, want the new file", entries)
+	}
+	if got, want := readdirNames(t, root), []string{"existing.txt", "new.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Readdir = %q, want %q", got, want)
+	}
+	var out fuse.AttrOut
+	if errno := node.Getattr(ctx, nil, &out); errno != 0 || out.Size != 0 || out.Mode&syscall.S_IFREG == 0 {
+		t.Fatalf("Getattr = %+v, errno %d", out.Attr, errno)
+	}
+
+	if _, errno := node.Write(ctx, nil, []byte("hello"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "new.txt")); err != nil || string(got) != "hello" {
+		t.Fatalf("new.txt on disk = %q, %v", got, err)
+	}
+	if root.registry.Count() != 0 {
+		t.Fatalf("dirty entries after close = %v", root.registry.Entries())
+	}
+	if got, want := readdirNames(t, root), []string{"existing.txt", "new.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Readdir after close = %q, want %q", got, want)
+	}
+}
+
+func TestCreateEmptyFileIsCreatedOnClose(t *testing.T) {
+	root, dir := newNameFixture(t, nil, nil)
+	node := createLocal(t, root, "empty.txt")
+	if errno := node.Release(context.Background(), nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "empty.txt")); err != nil || info.Size() != 0 {
+		t.Fatalf("empty.txt on disk: %v", err)
+	}
+}
+
+func TestUnlinkOfUncreatedFileSkipsBackend(t *testing.T) {
+	root, dir := newNameFixture(t, nil, nil)
+	ctx := context.Background()
+
+	node := createLocal(t, root, "scratch.txt")
+	if _, errno := node.Write(ctx, nil, []byte("temp"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	if errno := root.Unlink(ctx, "scratch.txt"); errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	root.RmChild("scratch.txt")
+	if root.registry.Count() != 0 {
+		t.Fatalf("unlinked file is still dirty: %v", root.registry.Entries())
+	}
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "scratch.txt")); !os.IsNotExist(err) {
+		t.Fatalf("unlinked file was uploaded: %v", err)
+	}
+}
+
+func TestRenameOfUncreatedFileCreatesItFirst(t *testing.T) {
+	root, dir := newNameFixture(t, nil, nil)
+	ctx := context.Background()
+
+	node := createLocal(t, root, "draft.txt")
+	if _, errno := node.Write(ctx, nil, []byte("draft"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	if errno := root.Rename(ctx, "draft.txt", root, "final.txt", 0); errno != 0 {
+		t.Fatalf("Rename errno %d", errno)
+	}
+	root.MvChild("draft.txt", root.EmbeddedInode(), "final.txt", true)
+	if got, err := os.ReadFile(filepath.Join(dir, "final.txt")); err != nil || string(got) != "draft" {
+		t.Fatalf("final.txt on disk = %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "draft.txt")); !os.IsNotExist(err) {
+		t.Fatalf("draft.txt left behind: %v", err)
+	}
+}
+
+func TestDirectoryRenameRetargetsUncreatedFile(t *testing.T) {
+	root, dir := newNameFixture(t, nil, nil)
+	ctx := context.Background()
+
+	sub, errno := root.Mkdir(ctx, "build", 0755, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Mkdir errno %d", errno)
+	}
+	root.AddChild("build", sub, true)
+	node := createLocal(t, sub.Operations().(*WSNode), "out.txt")
+	if _, errno := node.Write(ctx, nil, []byte("artifact"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+
+	if errno := root.Rename(ctx, "build", root, "dist", 0); errno != 0 {
+		t.Fatalf("Rename errno %d", errno)
+	}
+	root.MvChild("build", root.EmbeddedInode(), "dist", true)
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "dist", "out.txt")); err != nil || string(got) != "artifact" {
+		t.Fatalf("dist/out.txt on disk = %q, %v", got, err)
+	}
+}
+
+func TestReaddirInosMatchLookup(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{"a.txt": "a", "b.txt": "b"}, nil)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	ctx := context.Background()
+	created, _, _, errno := root.Create(ctx, "new.txt", 0, 0o644, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Create errno %d", errno)
+	}
+	root.AddChild("new.txt", created, true)
+	if errno := created.Operations().(*WSNode).Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+
+	stream, errno := root.Readdir(ctx)
+	if errno != 0 {
+		t.Fatalf("Readdir errno %d", errno)
+	}
+	inos := make(map[string]uint64)
+	for stream.HasNext() {
+		e, _ := stream.Next()
+		inos[e.Name] = e.Ino
+	}
+	if len(inos) != 4 {
+		t.Fatalf("listing = %v, want 4 entries", inos)
+	}
+	for name, ino := range inos {
+		child, errno := root.Lookup(ctx, name, &fuse.EntryOut{})
+		if errno != 0 {
+			t.Fatalf("Lookup %s errno %d", name, errno)
+		}
+		if ino == 0 || child.StableAttr().Ino != ino {
+			t.Errorf("%s: d_ino %d, st_ino %d", name, ino, child.StableAttr().Ino)
+		}
+	}
+}
+
+func TestReaddirRefreshesStaleLoadedChildren(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+	node := f.lookup("top-level.txt")
+	fresh := f.lookup("src", "main.py")
+	node.mu.Lock()
+	node.metadataCheckedAt = time.Now().Add(-time.Hour)
+	node.mu.Unlock()
+
+	changedAt := time.Now().Add(time.Minute)
+	for _, name := range []string{"top-level.txt", "src/main.py"} {
+		full := filepath.Join(f.dir, filepath.FromSlash(name))
+		if err := os.WriteFile(full, []byte("changed remotely\n"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := os.Chtimes(full, changedAt, changedAt); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	if _, errno := f.root.Readdir(ctx); errno != 0 {
+		t.Fatalf("Readdir errno %d", errno)
+	}
+	node.mu.Lock()
+	size, checkedFresh := node.fileInfo.Size(), node.metadataFreshLocked()
+	node.mu.Unlock()
+	if size != int64(len("changed remotely\n")) || !checkedFresh {
+		t.Fatalf("stale child after Readdir: size %d, fresh %v", size, checkedFresh)
+	}
+
+	// Children of other directories, and children still within the TTL,
+	// are left to their own checks.
+	if _, errno := f.root.Readdir(ctx); errno != 0 {
+		t.Fatalf("Readdir errno %d", errno)
+	}
+	fresh.mu.Lock()
+	defer fresh.mu.Unlock()
+	if fresh.fileInfo.Size() != int64(len("print('main')\n")) {
+		t.Fatalf("child of another directory refreshed to size %d", fresh.fileInfo.Size())
+	}
+}
@@ -0,0 +1,228 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/faultinject"
+)
+
+// faultFixture mounts a local directory through a fault-injecting backend.
+type faultFixture struct {
+	dir      string
+	injector *faultinject.Injector
+	registry *DirtyNodeRegistry
+	root     *WSNode
+}
+
+func newFaultFixture(t *testing.T, files map[string]string) *faultFixture {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	local, err := backend.NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	injector := faultinject.New(faultinject.Config{Seed: 1})
+	registry := NewDirtyNodeRegistry()
+	root, err := NewRootNode(backend.WithFaults(local, injector), nil, "/", registry, nil)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	return &faultFixture{dir: dir, injector: injector, registry: registry, root: root}
+}
+
+func (f *faultFixture) faults(rates map[faultinject.Kind]float64) {
+	f.injector.Set(faultinject.Config{Rates: rates})
+}
+
+func (f *faultFixture) lookup(t *testing.T, name string) *WSNode {
+	t.Helper()
+	child, errno := f.root.Lookup(context.Background(), name, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Lookup %s errno %d", name, errno)
+	}
+	return child.Operations().(*WSNode)
+}
+
+func (f *faultFixture) onDisk(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(f.dir, name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func readNode(n *WSNode, size int) (string, syscall.Errno) {
+	dest := make([]byte, size)
+	res, errno := n.Read(context.Background(), nil, dest, 0)
+	if errno != 0 {
+		return "", errno
+	}
+	data, _ := res.Bytes(dest)
+	return string(data), 0
+}
+
+func TestFaultsReadErrorIsEIOAndRecovers(t *testing.T) {
+	f := newFaultFixture(t, map[string]string{"a.txt": "hello"})
+	node := f.lookup(t, "a.txt")
+
+	f.faults(map[faultinject.Kind]float64{faultinject.ServerError: 1})
+	if _, errno := readNode(node, 16); errno != syscall.EIO {
+		t.Fatalf("expected EIO under injected 500s, got %d", errno)
+	}
+	if node.lastError == nil {
+		t.Fatal("expected the read failure to be recorded as the last error")
+	}
+
+	f.faults(nil)
+	got, errno := readNode(node, 16)
+	if errno != 0 || got != "hello" {
+		t.Fatalf("expected recovery after faults stop, got %q errno %d", got, errno)
+	}
+	if node.lastError != nil {
+		t.Fatalf("expected last error to clear after a successful read, got %v", node.lastError)
+	}
+}
+
+func TestFaultsPartialReadNeverServesTruncatedData(t *testing.T) {
+	f := newFaultFixture(t, map[string]string{"a.txt": "0123456789"})
+	node := f.lookup(t, "a.txt")
+
+	f.faults(map[faultinject.Kind]float64{faultinject.PartialRead: 1})
+	if got, errno := readNode(node, 16); errno != syscall.EIO {
+		t.Fatalf("expected EIO for a partial read, got %q errno %d", got, errno)
+	}
+
+	f.faults(nil)
+	if got, errno := readNode(node, 16); errno != 0 || got != "0123456789" {
+		t.Fatalf("expected the full content after recovery, got %q errno %d", got, errno)
+	}
+}
+
+func TestFaultsFailedFlushKeepsDirtyData(t *testing.T) {
+	f := newFaultFixture(t, map[string]string{"a.txt": "old"})
+	node := f.lookup(t, "a.txt")
+	ctx := context.Background()
+
+	if _, errno := node.Write(ctx, nil, []byte("new"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+
+	f.faults(map[faultinject.Kind]float64{faultinject.TooManyRequests: 1})
+	if errno := node.Fsync(ctx, nil, 0); errno != syscall.EIO {
+		t.Fatalf("expected EIO when uploads are throttled, got %d", errno)
+	}
+	if !f.registry.contains(node) {
+		t.Fatal("expected the node to stay dirty after a failed flush")
+	}
+	if got := f.onDisk(t, "a.txt"); got != "old" {
+		t.Fatalf("backend must be unchanged after a failed flush, got %q", got)
+	}
+	if got, errno := readNode(node, 16); errno != 0 || got != "new" {
+		t.Fatalf("expected buffered data to stay readable, got %q errno %d", got, errno)
+	}
+
+	f.faults(nil)
+	if errno := node.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("Fsync after recovery errno %d", errno)
+	}
+	if got := f.onDisk(t, "a.txt"); got != "new" {
+		t.Fatalf("expected retried flush to upload, got %q", got)
+	}
+	if f.registry.Count() != 0 {
+		t.Fatalf("expected clean registry, got %d", f.registry.Count())
+	}
+}
+
+// TestFaultsChaosRunConverges mixes reads, writes and fsyncs under random
+// faults. Every operation must either succeed or fail with EIO, and once the
+// faults stop a final flush must leave every file with its model content.
+func TestFaultsChaosRunConverges(t *testing.T) {
+	const numFiles = 3
+	files := make(map[string]string, numFiles)
+	for i := 0; i < numFiles; i++ {
+		files[fmt.Sprintf("f%d.txt", i)] = fmt.Sprintf("initial-%d", i)
+	}
+	f := newFaultFixture(t, files)
+
+	names := make([]string, 0, numFiles)
+	nodes := make(map[string]*WSNode, numFiles)
+	model := make(map[string][]byte, numFiles)
+	for i := 0; i < numFiles; i++ {
+		name := fmt.Sprintf("f%d.txt", i)
+		names = append(names, name)
+		nodes[name] = f.lookup(t, name)
+		model[name] = []byte(files[name])
+	}
+
+	f.faults(map[faultinject.Kind]float64{
+		faultinject.TooManyRequests: 0.2,
+		faultinject.ServerError:     0.2,
+		faultinject.PartialRead:     0.2,
+	})
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(propertySeed(t)))
+	ops := 300
+	if testing.Short() {
+		ops = 100
+	}
+	for i := 0; i < ops; i++ {
+		name := names[rng.Intn(len(names))]
+		node := nodes[name]
+		switch rng.Intn(3) {
+		case 0:
+			got, errno := readNode(node, 256)
+			if errno == 0 && got != string(model[name]) {
+				t.Fatalf("op %d: read %s = %q, model %q", i, name, got, model[name])
+			}
+			if errno != 0 && errno != syscall.EIO {
+				t.Fatalf("op %d: read %s errno %d", i, name, errno)
+			}
+		case 1:
+			off := rng.Intn(len(model[name]) + 1)
+			payload := []byte(fmt.Sprintf("<%d>", i))
+			_, errno := node.Write(ctx, nil, payload, int64(off))
+			if errno == 0 {
+				if end := off + len(payload); end > len(model[name]) {
+					model[name] = append(model[name], make([]byte, end-len(model[name]))...)
+				}
+				copy(model[name][off:], payload)
+			} else if errno != syscall.EIO {
+				t.Fatalf("op %d: write %s errno %d", i, name, errno)
+			}
+		case 2:
+			if errno := node.Fsync(ctx, nil, 0); errno != 0 && errno != syscall.EIO {
+				t.Fatalf("op %d: fsync %s errno %d", i, name, errno)
+			}
+		}
+	}
+	if f.injector.Count(faultinject.ServerError)+f.injector.Count(faultinject.TooManyRequests) == 0 {
+		t.Fatal("expected the chaos run to inject call errors")
+	}
+
+	f.faults(nil)
+	if _, errs := f.registry.FlushAll(ctx); len(errs) != 0 {
+		t.Fatalf("FlushAll errors after faults stopped: %v", errs)
+	}
+	for _, name := range names {
+		if got := f.onDisk(t, name); got != string(model[name]) {
+			t.Errorf("%s on disk %q, model %q", name, got, model[name])
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 
@@ -14,6 +16,8 @@ import (
 	"wsfs/internal/databricks"
 	"wsfs/internal/filecache"
 	"wsfs/internal/logging"
+	"wsfs/internal/metrics"
+	"wsfs/internal/pathutil"
 )
 
 func (n *WSNode) rememberNotebookExactSizeLocked(size int64) {
@@ -35,6 +39,15 @@ func (n *WSNode) ensureNotebookExactSizeLocked(ctx context.Context) syscall.Errn
 		return 0
 	}
 
+	// An export of this version in the disk cache has the size, so a stat
+	// neither exports the notebook nor opens the cached copy.
+	if n.usesDiskCache(n.Path()) {
+		if size, ok := n.diskCache.CachedSize(n.Path(), n.fileInfo.ModTime()); ok {
+			metrics.NotebookExportCacheHits.Add(1)
+			n.rememberNotebookExactSizeLocked(size)
+			return 0
+		}
+	}
 	return n.ensureDataLocked(ctx)
 }
 
@@ -62,7 +75,7 @@ func (n *WSNode) ensureDataLocked(ctx context.Context) syscall.Errno {
 	remoteModTime := n.fileInfo.ModTime()
 
 	// Try to get from cache first (only set CachedPath, don't load data)
-	if n.diskCache != nil && !n.diskCache.IsDisabled() {
+	if n.usesDiskCache(remotePath) {
 		cachedPath, checksum, found := n.diskCache.Get(remotePath, remoteModTime)
 		if found {
 			// Verify cache file exists
@@ -70,7 +83,11 @@ func (n *WSNode) ensureDataLocked(ctx context.Context) syscall.Errno {
 				n.buf.CachedPath = cachedPath
 				n.buf.CachedChecksum = checksum
 				n.buf.FileSize = info.Size()
+				if n.fileInfo.IsNotebook() {
+					metrics.NotebookExportCacheHits.Add(1)
+				}
 				n.rememberNotebookExactSizeLocked(info.Size())
+				n.rememberRemoteContentLocked(checksum, nil)
 				logging.Debugf("Cache path set for %s (on-demand read)", remotePath)
 				return 0
 			}
@@ -86,16 +103,26 @@ func (n *WSNode) ensureDataLocked(ctx context.Context) syscall.Errno {
 	defer cancel()
 	data, err := n.wfClient.ReadAll(readCtx, remotePath)
 	if err != nil {
-		logging.Debugf("Failed to read file %s: %v", remotePath, err)
-		return errnoFromBackendError(backendOpRead, err)
+		n.recordErrorLocked(backendOpRead, err)
+		errno := errnoFromBackendError(backendOpRead, err)
+		if errno == syscall.ETIMEDOUT {
+			logging.Warnf("Reading %s timed out: %v", remotePath, err)
+		} else {
+			logging.Debugf("Failed to read file %s: %v", remotePath, err)
+		}
+		return errno
 	}
+	n.clearErrorLocked()
+
+	checksum := filecache.CalculateChecksum(data)
 
 	// Store in cache and use cache path for on-demand reads
-	if n.diskCache != nil && !n.diskCache.IsDisabled() {
-		localPath, err := n.diskCache.Set(remotePath, data, remoteModTime)
+	if n.usesDiskCache(remotePath) {
+		localPath, err := n.setDiskCache(remotePath, data, remoteModTime, n.fileInfo.IsNotebook())
 		if err == nil {
 			n.buf.CachedPath = localPath
-			n.buf.CachedChecksum = filecache.CalculateChecksum(data)
+			n.buf.CachedChecksum = checksum
+			n.rememberRemoteContentLocked(checksum, data)
 			n.buf.FileSize = int64(len(data))
 			n.rememberNotebookExactSizeLocked(int64(len(data)))
 			logging.Debugf("Cached file %s (%d bytes), using on-demand read", remotePath, len(data))
@@ -105,17 +132,46 @@ func (n *WSNode) ensureDataLocked(ctx context.Context) syscall.Errno {
 		logging.Debugf("Failed to cache file %s: %v, using memory", remotePath, err)
 	}
 
-	// Fallback: keep data in memory (when cache is disabled or failed)
+	// Fallback: keep data in memory (when cache is disabled, excluded for
+	// this file, or failed)
 	n.buf.Data = data
 	n.buf.FileSize = int64(len(data))
+	n.rememberRemoteContentLocked(checksum, data)
 	n.rememberNotebookExactSizeLocked(int64(len(data)))
 	return 0
 }
 
+// setDiskCache stores content in the disk cache. A notebook's content is
+// its exported source, which is kept over downloaded files when the cache
+// is full, so previewing a notebook again does not export it again.
+func (n *WSNode) setDiskCache(remotePath string, data []byte, modTime time.Time, notebook bool) (string, error) {
+	if notebook {
+		return n.diskCache.SetExport(remotePath, data, modTime)
+	}
+	return n.diskCache.Set(remotePath, data, modTime)
+}
+
+// usesDiskCache reports whether the content of remotePath may be stored in
+// the disk cache. Files matching the cache's exclude patterns are only held
+// in memory, and always-fresh files are downloaded on every open.
+func (n *WSNode) usesDiskCache(remotePath string) bool {
+	return n.diskCache != nil && !n.diskCache.IsDisabled() && !n.diskCache.Excludes(remotePath) && !n.alwaysFresh(remotePath)
+}
+
+// invalidateCurrentCacheLocked drops the cache file the node reads. The
+// disk cache entry goes only if it still holds that file; a newer
+// generation cached meanwhile is kept for the retry.
 func (n *WSNode) invalidateCurrentCacheLocked() {
 	currentPath := n.Path()
+	cachedPath := n.buf.CachedPath
 	n.clearCachedFileLocked()
-	n.deleteDiskCacheEntries(currentPath)
+	if cachedPath == "" {
+		n.deleteDiskCacheEntries(currentPath)
+		return
+	}
+	if n.diskCache != nil && !n.diskCache.IsDisabled() {
+		n.diskCache.DeleteFile(currentPath, cachedPath)
+	}
 }
 
 func (n *WSNode) loadDataFromCacheLocked(ctx context.Context) syscall.Errno {
@@ -142,6 +198,9 @@ func (n *WSNode) loadDataFromCacheLocked(ctx context.Context) syscall.Errno {
 		n.buf.Data = data
 		n.buf.FileSize = int64(len(data))
 		n.rememberNotebookExactSizeLocked(int64(len(data)))
+		if n.buf.RemoteChunks == nil && n.buf.CachedChecksum != "" && n.buf.CachedChecksum == n.buf.RemoteChecksum {
+			n.rememberRemoteChunksLocked(data)
+		}
 		return 0
 	}
 
@@ -212,6 +271,21 @@ func (n *WSNode) truncateLocked(size uint64) {
 	n.markDirtyLocked(dirtyTruncate)
 }
 
+// growBuffer extends data with zeros to size bytes. It leaves spare
+// capacity like append, so a stream of small appending writes, as build
+// tools emit them, copies the buffer a logarithmic number of times rather
+// than once per write. A shared buffer is always copied.
+func growBuffer(data []byte, size int64, shared bool) []byte {
+	if shared {
+		data = slices.Clip(data)
+	}
+	old := len(data)
+	data = slices.Grow(data, int(size)-old)[:size]
+	// Spare capacity may hold bytes cut off by an earlier truncate.
+	clear(data[old:])
+	return data
+}
+
 func (n *WSNode) applyBufferedMetadataFallbackLocked(now time.Time) {
 	if n.buf.Data != nil {
 		n.fileInfo.ObjectInfo.Size = int64(len(n.buf.Data))
@@ -220,8 +294,23 @@ func (n *WSNode) applyBufferedMetadataFallbackLocked(now time.Time) {
 	n.metadataCheckedAt = now
 }
 
+// flushLocked uploads the dirty buffer while holding n.mu for the whole
+// transfer. Rename relies on this to keep the node still between its flush
+// and the remote rename; other callers use writeBackLocked.
 func (n *WSNode) flushLocked(ctx context.Context) syscall.Errno {
-	if !n.isDirtyLocked() || n.buf.Data == nil {
+	return n.flushBufferLocked(ctx, false)
+}
+
+// writeBackLocked uploads the dirty buffer like flushLocked but releases n.mu
+// during the transfer, so a large save does not block reads of the file.
+// Writes made meanwhile keep the node dirty for the next flush.
+func (n *WSNode) writeBackLocked(ctx context.Context) syscall.Errno {
+	return n.flushBufferLocked(ctx, true)
+}
+
+func (n *WSNode) flushBufferLocked(ctx context.Context, unlock bool) syscall.Errno {
+	n.waitFlushLocked()
+	if !n.isDirtyLocked() || n.buf.Data == nil || n.localTemp || n.unlinked != nil {
 		return 0
 	}
 
@@ -229,38 +318,126 @@ func (n *WSNode) flushLocked(ctx context.Context) syscall.Errno {
 	opCtx, cancel := context.WithTimeout(ctx, dataOpTimeout)
 	defer cancel()
 
+	n.applyTransformsLocked()
 	remotePath := n.Path()
-	bufferSize := int64(len(n.buf.Data))
-	err := n.wfClient.Write(opCtx, remotePath, n.buf.Data)
+	data := n.buf.Data
+	bufferSize := int64(len(data))
+	checksum := filecache.CalculateChecksum(data)
+	if n.buf.RemoteChecksum != "" && checksum == n.buf.RemoteChecksum {
+		// Editors frequently save identical content (format-on-save no-ops).
+		// Keep the remote object and its modification time untouched.
+		// The checksum is of the content last loaded or uploaded, and the
+		// remote is not stat'ed again: after our own upload RemoteModifiedAt
+		// is a local clock reading no server stamp matches, so a check would
+		// re-upload every repeated save. In exchange, saving the loaded
+		// content does not undo another client's change made since.
+		logging.Debugf("Flush skipped for %s: content unchanged (%s)", remotePath, truncateChecksum(checksum))
+		n.clearDirtyLocked()
+		n.fileInfo.ObjectInfo.Size = bufferSize
+		n.fileInfo.ObjectInfo.ModifiedAt = n.buf.RemoteModifiedAt
+		n.metadataCheckedAt = time.Now()
+		metrics.UploadBytesSaved.Add(bufferSize)
+		return 0
+	}
+
+	// A file created here is uploaded under the name it was created with,
+	// which tells the backend to create a notebook for a source extension.
+	uploadPath := remotePath
+	if n.createPath != "" {
+		uploadPath = n.createPath
+	}
+	writer, _ := n.chunkWriterLocked()
+	remoteChunks := n.buf.RemoteChunks
+	isNotebook := n.fileInfo.IsNotebook()
+	// Jupyter JSON is imported as a notebook rather than as its source, so
+	// the notebook exports other content afterwards.
+	jupyter := isNotebook && pathutil.IsJupyterNotebook(data)
+	// A new notebook is stat'ed after the upload to learn the object the
+	// workspace made of the source file. An existing one keeps its identity,
+	// so its local state is trusted like a regular file's until the next
+	// revalidation.
+	statNotebook := isNotebook && (!n.knownObjectLocked() || jupyter)
+
+	// The upload works on a snapshot of the buffer. Write copies the buffer
+	// before changing it in place while it is shared, and the generation
+	// tells whether the buffer still matches the snapshot afterwards.
+	gen := n.bufGen
+	n.buf.Shared = true
+	if unlock {
+		n.flushing = true
+		n.mu.Unlock()
+	}
+	err := n.upload(opCtx, uploadPath, data, writer, remoteChunks)
+	var freshInfo databricks.WSFileInfo
+	var freshErr error
+	if err == nil && statNotebook {
+		freshInfo, freshErr = n.statFresh(opCtx, remotePath)
+	}
+	if unlock {
+		n.mu.Lock()
+		n.flushing = false
+		if n.flushDone != nil {
+			n.flushDone.Broadcast()
+		}
+	}
+	n.buf.Shared = false
+
 	if err != nil {
-		logging.Warnf("Error writing back on Flush for %s: %v", remotePath, err)
-		return errnoFromBackendError(backendOpWrite, err)
+		n.recordErrorLocked(backendOpWrite, err)
+		errno := errnoFromBackendError(backendOpWrite, err)
+		logging.Warnf("Upload of %s on Flush %s: %v", uploadPath, failureVerb(errno), err)
+		if n.registry != nil {
+			n.registry.flushFailed(n, errno)
+		}
+		return errno
+	}
+	n.createPath = ""
+	n.clearErrorLocked()
+	n.publishWriteLocked()
+	if n.bufGen != gen || n.Path() != remotePath {
+		// The file changed during the upload. The workspace now holds the
+		// snapshot, and the newer content stays dirty for the next flush.
+		// After a rename of a parent the next flush uploads it again in full.
+		logging.Debugf("Flush of %s uploaded an older snapshot; later changes stay dirty", remotePath)
+		if n.isDirtyLocked() && n.Path() == remotePath {
+			n.rememberRemoteContentLocked(checksum, data)
+		}
+		return 0
 	}
 	n.clearDirtyLocked()
 
 	now := time.Now()
-	if n.fileInfo.IsNotebook() {
-		if info, err := n.wfClient.StatFresh(opCtx, remotePath); err != nil {
-			logging.Warnf("Error refreshing file info after Flush for %s: %v", remotePath, err)
-			n.applyBufferedMetadataFallbackLocked(now)
-		} else if wsInfo, ok := info.(databricks.WSFileInfo); !ok {
-			logging.Warnf("Unexpected file info type after Flush for %s", remotePath)
+	if statNotebook {
+		if freshErr != nil {
+			logging.Warnf("Error refreshing file info after Flush for %s: %v", remotePath, freshErr)
 			n.applyBufferedMetadataFallbackLocked(now)
 		} else {
-			n.fileInfo = wsInfo
+			n.fileInfo = freshInfo
+			n.modifiedAtIsLocal = false
 			n.metadataCheckedAt = now
+			n.bindInoLocked()
 		}
-		n.rememberNotebookExactSizeLocked(bufferSize)
 	} else {
 		n.applyBufferedMetadataFallbackLocked(now)
 		if n.wfClient != nil {
 			n.wfClient.CacheSet(remotePath, n.fileInfo)
 		}
 	}
+	if jupyter {
+		// Reads export the notebook's source again.
+		n.fileInfo.NotebookSizeComputed = false
+		n.clearCleanBufferLocked()
+		n.deleteDiskCacheEntries(remotePath)
+		return 0
+	}
+	if isNotebook {
+		n.rememberNotebookExactSizeLocked(bufferSize)
+	}
+	n.rememberRemoteContentLocked(checksum, data)
 
 	// Update cache with new content
-	if n.diskCache != nil && !n.diskCache.IsDisabled() && n.buf.Data != nil {
-		_, err := n.diskCache.Set(remotePath, n.buf.Data, n.fileInfo.ModTime())
+	if n.usesDiskCache(remotePath) {
+		_, err := n.setDiskCache(remotePath, data, n.fileInfo.ModTime(), isNotebook)
 		if err != nil {
 			logging.Debugf("Failed to update cache after flush for %s: %v", remotePath, err)
 		} else {
@@ -271,7 +448,66 @@ func (n *WSNode) flushLocked(ctx context.Context) syscall.Errno {
 	return 0
 }
 
+// waitFlushLocked waits until an upload running without n.mu has finished,
+// so the caller does not act on a buffer that is still being sent.
+func (n *WSNode) waitFlushLocked() {
+	for n.flushing {
+		if n.flushDone == nil {
+			n.flushDone = sync.NewCond(&n.mu)
+		}
+		n.flushDone.Wait()
+	}
+}
+
+// statFresh reads the metadata of a just uploaded notebook. It does not
+// touch node state and may run without n.mu.
+func (n *WSNode) statFresh(ctx context.Context, remotePath string) (databricks.WSFileInfo, error) {
+	info, err := n.wfClient.StatFresh(ctx, remotePath)
+	if err != nil {
+		return databricks.WSFileInfo{}, err
+	}
+	wsInfo, ok := info.(databricks.WSFileInfo)
+	if !ok {
+		return databricks.WSFileInfo{}, fmt.Errorf("unexpected file info type %T", info)
+	}
+	return wsInfo, nil
+}
+
+// upload sends data to the workspace. When writer is set and chunk hashes of
+// the remote content are known, only the changed chunks are sent; otherwise
+// the whole file is uploaded. It does not touch node state and may run
+// without n.mu.
+func (n *WSNode) upload(ctx context.Context, remotePath string, data []byte, writer databricks.ChunkWriter, remoteChunks []chunkSum) error {
+	size := int64(len(data))
+	if writer != nil && len(remoteChunks) > 0 && len(data) >= deltaMinFileSize {
+		chunks := changedChunks(remoteChunks, data)
+		var sent int64
+		for _, chunk := range chunks {
+			sent += int64(len(chunk.Data))
+		}
+		err := writer.WriteChunks(ctx, remotePath, size, chunks)
+		if err == nil {
+			logging.Debugf("Delta upload for %s: %d chunks, %d of %d bytes", remotePath, len(chunks), sent, size)
+			metrics.DeltaUploads.Add(1)
+			metrics.UploadBytes.Add(sent)
+			metrics.UploadBytesSaved.Add(size - sent)
+			return nil
+		}
+		logging.Debugf("Delta upload failed for %s, falling back to full upload: %v", remotePath, err)
+	}
+
+	if err := n.wfClient.Write(ctx, remotePath, data); err != nil {
+		return err
+	}
+	metrics.FullUploads.Add(1)
+	metrics.UploadBytes.Add(size)
+	return nil
+}
+
 func (n *WSNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if errno := n.checkCaller(ctx); errno != 0 {
+		return nil, 0, errno
+	}
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
@@ -305,9 +541,9 @@ func (n *WSNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32,
 	}
 
 	openFlags := uint32(0)
-	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC) != 0 {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC) != 0 && !n.pageCacheWritableLocked() {
 		openFlags |= fuse.FOPEN_DIRECT_IO
-	} else if metadataChanged {
+	} else if metadataChanged || n.alwaysFresh(n.Path()) {
 		openFlags |= fuse.FOPEN_DIRECT_IO
 	} else {
 		openFlags |= fuse.FOPEN_KEEP_CACHE
@@ -315,7 +551,16 @@ func (n *WSNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32,
 
 	n.incrementOpenLocked()
 
-	return &wsFileHandle{}, openFlags, 0
+	return newFileHandle(flags), openFlags, 0
+}
+
+// pageCacheWritableLocked reports whether a handle opened for writing may
+// use the kernel page cache. Without a writeback cache the kernel passes
+// every write on to wsfs and updates its cached pages with it, so they stay
+// in step with the buffer. Notebooks are left out: the workspace rewrites
+// their source on upload and their size is only known once exported.
+func (n *WSNode) pageCacheWritableLocked() bool {
+	return n.cfg().CacheWritableOpens && !n.fileInfo.IsNotebook()
 }
 
 func (n *WSNode) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
@@ -458,10 +703,12 @@ func (n *WSNode) Write(ctx context.Context, fh fs.FileHandle, data []byte, off i
 
 	end := off + int64(len(data))
 	if int64(len(n.buf.Data)) < end {
-		newData := make([]byte, end)
-		copy(newData, n.buf.Data)
-		n.buf.Data = newData
+		n.buf.Data = growBuffer(n.buf.Data, end, n.buf.Shared)
+	} else if n.buf.Shared {
+		// An upload is reading the buffer; write to a copy.
+		n.buf.Data = append([]byte(nil), n.buf.Data...)
 	}
+	n.buf.Shared = false
 	copy(n.buf.Data[off:], data)
 	n.buf.ReplaceOnFirstWrite = false
 
@@ -469,7 +716,21 @@ func (n *WSNode) Write(ctx context.Context, fh fs.FileHandle, data []byte, off i
 	n.markModifiedLocked(time.Now())
 	n.metadataCheckedAt = time.Now()
 	n.markDirtyLocked(dirtyData)
+	n.writtenSinceUpload += int64(len(data))
 
+	if isSyncHandle(fh) {
+		// O_SYNC and O_DSYNC ask for durable writes: upload before
+		// returning. A failed upload keeps the data dirty and buffered.
+		if errno := n.writeBackLocked(ctx); errno != 0 {
+			return 0, errno
+		}
+	} else if n.cfg().FlushThreshold > 0 && n.writtenSinceUpload >= n.cfg().FlushThreshold {
+		// Upload what is written so far. A failure is recorded and retried
+		// like any failed flush; the write itself is buffered either way.
+		logging.Debugf("Flush threshold reached for %s after %d bytes", n.Path(), n.writtenSinceUpload)
+		n.writtenSinceUpload = 0
+		n.writeBackLocked(ctx)
+	}
 	return uint32(len(data)), 0
 }
 
@@ -478,10 +739,12 @@ func (n *WSNode) Flush(ctx context.Context, fh fs.FileHandle) syscall.Errno {
 	defer n.mu.Unlock()
 
 	logging.Debugf("Flush called on path: %s", n.fileInfo.Path)
-	if n.openCount > 0 {
+	// The last Release uploads the file, unless this handle asked for
+	// synchronous writes.
+	if n.openCount > 0 && !isSyncHandle(fh) {
 		return 0
 	}
-	return n.flushLocked(ctx)
+	return n.writeBackLocked(ctx)
 }
 
 func (n *WSNode) Fsync(ctx context.Context, fh fs.FileHandle, flags uint32) syscall.Errno {
@@ -489,7 +752,7 @@ func (n *WSNode) Fsync(ctx context.Context, fh fs.FileHandle, flags uint32) sysc
 	defer n.mu.Unlock()
 
 	logging.Debugf("Fsync called on path: %s", n.fileInfo.Path)
-	return n.flushLocked(ctx)
+	return n.writeBackLocked(ctx)
 }
 
 func (n *WSNode) Release(ctx context.Context, fh fs.FileHandle) syscall.Errno {
@@ -503,13 +766,35 @@ func (n *WSNode) Release(ctx context.Context, fh fs.FileHandle) syscall.Errno {
 		return 0
 	}
 
+	if n.unlinked != nil {
+		return n.finishUnlinkLocked(ctx)
+	}
+
+	if n.localTemp {
+		n.resetBufferLocked()
+		n.createPath = ""
+		n.localTemp = false
+		n.mu.Unlock()
+		n.discardLocalTemp()
+		n.mu.Lock()
+		return 0
+	}
+
+	if n.transformPending && n.applyTransformsLocked() {
+		n.markDirtyLocked(dirtyData)
+	}
 	if !n.isDirtyLocked() {
+		n.bulkEligible = false
 		n.resetBufferLocked()
 		return 0
 	}
+	if n.releaseToBulkLocked() {
+		return 0
+	}
 
-	errno := n.flushLocked(ctx)
-	if errno == 0 {
+	errno := n.writeBackLocked(ctx)
+	// The file may have been reopened or written again during the upload.
+	if errno == 0 && n.openCount == 0 && !n.isDirtyLocked() {
 		n.resetBufferLocked()
 	}
 
@@ -1,10 +1,19 @@
 package fuse
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"syscall"
 	"testing"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/databricks"
 )
 
 func TestReadFromCacheFile(t *testing.T) {
@@ -39,3 +48,233 @@ func TestReadFromCacheFileMissing(t *testing.T) {
 		t.Fatalf("expected FileSize reset, got %d", n.buf.FileSize)
 	}
 }
+
+func TestFlushSkipsUploadWhenContentUnchanged(t *testing.T) {
+	writes := 0
+	api := &databricks.FakeWorkspaceAPI{
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			return []byte("same content"), nil
+		},
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			writes++
+			return nil
+		},
+	}
+	n := &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeFile,
+			Path:       "/same.txt",
+			Size:       12,
+			ModifiedAt: 1000,
+		}},
+	}
+	ctx := context.Background()
+
+	if _, errno := n.Write(ctx, nil, []byte("same content"), 0); errno != 0 {
+		t.Fatalf("Write errno: %d", errno)
+	}
+	if !n.isDirtyLocked() {
+		t.Fatal("expected node to be dirty after write")
+	}
+	if errno := n.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("Fsync errno: %d", errno)
+	}
+	if writes != 0 {
+		t.Fatalf("expected upload to be skipped, got %d writes", writes)
+	}
+	if n.isDirtyLocked() {
+		t.Fatal("expected dirty state cleared after skipped flush")
+	}
+	if n.fileInfo.ModifiedAt != 1000 {
+		t.Fatalf("expected remote ModifiedAt to be restored, got %d", n.fileInfo.ModifiedAt)
+	}
+}
+
+func TestFlushUploadsChangedContentAndRemembersChecksum(t *testing.T) {
+	var uploads []string
+	api := &databricks.FakeWorkspaceAPI{
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			return []byte("old"), nil
+		},
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			uploads = append(uploads, string(data))
+			return nil
+		},
+	}
+	n := &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeFile,
+			Path:       "/changed.txt",
+			Size:       3,
+		}},
+	}
+	ctx := context.Background()
+
+	if _, errno := n.Write(ctx, nil, []byte("new"), 0); errno != 0 {
+		t.Fatalf("Write errno: %d", errno)
+	}
+	if errno := n.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("Fsync errno: %d", errno)
+	}
+	if _, errno := n.Write(ctx, nil, []byte("new"), 0); errno != 0 {
+		t.Fatalf("second Write errno: %d", errno)
+	}
+	if errno := n.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("second Fsync errno: %d", errno)
+	}
+
+	if len(uploads) != 1 || uploads[0] != "new" {
+		t.Fatalf("expected exactly one upload of new content, got %q", uploads)
+	}
+}
+
+func TestSyncHandleWritesUploadBeforeReturning(t *testing.T) {
+	var uploads []string
+	failUpload := false
+	api := &databricks.FakeWorkspaceAPI{
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			return []byte{}, nil
+		},
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			if failUpload {
+				return errors.New("connection reset")
+			}
+			uploads = append(uploads, string(data))
+			return nil
+		},
+	}
+	n := &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeFile,
+			Path:       "/journal.log",
+		}},
+	}
+	ctx := context.Background()
+
+	buffered := newFileHandle(syscall.O_WRONLY)
+	if _, errno := n.Write(ctx, buffered, []byte("a"), 0); errno != 0 {
+		t.Fatalf("Write errno: %d", errno)
+	}
+	if len(uploads) != 0 || !n.isDirtyLocked() {
+		t.Fatalf("expected a normal handle to buffer, got uploads %q", uploads)
+	}
+
+	for _, flag := range []int{syscall.O_SYNC, syscall.O_DSYNC} {
+		synced := newFileHandle(uint32(syscall.O_WRONLY | flag))
+		if _, errno := n.Write(ctx, synced, []byte("b"), 1); errno != 0 {
+			t.Fatalf("Write errno: %d", errno)
+		}
+		if n.isDirtyLocked() || len(uploads) == 0 || uploads[len(uploads)-1] != "ab" {
+			t.Fatalf("expected flag %#x to upload before returning, got uploads %q", flag, uploads)
+		}
+		n.Write(ctx, buffered, []byte("c"), 2)
+		n.incrementOpenLocked()
+		if errno := n.Flush(ctx, synced); errno != 0 || uploads[len(uploads)-1] != "abc" {
+			t.Fatalf("expected a sync handle's flush to upload while open, got errno %d uploads %q", errno, uploads)
+		}
+		n.decrementOpenLocked()
+		n.truncateLocked(1)
+	}
+
+	failUpload = true
+	if _, errno := n.Write(ctx, newFileHandle(syscall.O_WRONLY|syscall.O_SYNC), []byte("d"), 1); errno == 0 {
+		t.Fatal("expected a failed upload to fail the write")
+	}
+	if !n.isDirtyLocked() || string(n.buf.Data) != "ad" {
+		t.Fatalf("expected the write to stay buffered, got %q dirty=%v", n.buf.Data, n.isDirtyLocked())
+	}
+}
+
+func TestWriteUploadsEachTimeFlushThresholdIsReached(t *testing.T) {
+	var uploads []string
+	api := &databricks.FakeWorkspaceAPI{
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			return []byte{}, nil
+		},
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			uploads = append(uploads, string(data))
+			return nil
+		},
+	}
+	n := &WSNode{
+		wfClient: api,
+		config:   &NodeConfig{FlushThreshold: 4},
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeFile,
+			Path:       "/big.bin",
+		}},
+	}
+	ctx := context.Background()
+
+	for i, chunk := range []string{"ab", "cd", "ef", "gh", "i"} {
+		if _, errno := n.Write(ctx, nil, []byte(chunk), int64(2*i)); errno != 0 {
+			t.Fatalf("Write errno: %d", errno)
+		}
+	}
+	if want := []string{"abcd", "abcdefgh"}; !reflect.DeepEqual(uploads, want) {
+		t.Fatalf("uploads = %q, want %q", uploads, want)
+	}
+	if !n.isDirtyLocked() || n.writtenSinceUpload != 1 {
+		t.Fatalf("expected the tail to stay buffered, dirty=%v written=%d", n.isDirtyLocked(), n.writtenSinceUpload)
+	}
+}
+
+func TestGrowBuffer(t *testing.T) {
+	data := growBuffer([]byte("abcdef"), 8, false)[:3]
+	data = growBuffer(data, 5, false)
+	if string(data) != "abc\x00\x00" {
+		t.Fatalf("grown buffer = %q, want bytes past a truncate zeroed", data)
+	}
+
+	// Small appends reuse spare capacity instead of copying every time.
+	var allocs int
+	buf := []byte{}
+	for i := 0; i < 4096; i++ {
+		before := cap(buf)
+		buf = growBuffer(buf, int64(len(buf)+1), false)
+		if cap(buf) != before {
+			allocs++
+		}
+	}
+	if allocs > 32 {
+		t.Fatalf("4096 one-byte appends reallocated %d times", allocs)
+	}
+
+	shared := make([]byte, 4, 16)
+	grown := growBuffer(shared, 6, true)
+	grown[0] = 'x'
+	if shared[0] != 0 {
+		t.Fatal("growing a shared buffer wrote to the shared array")
+	}
+}
+
+func TestWritableOpensUsePageCacheWhenEnabled(t *testing.T) {
+	newNode := func(objectType workspace.ObjectType, cacheWritable bool) *WSNode {
+		return &WSNode{
+			wfClient:          &databricks.FakeWorkspaceAPI{},
+			config:            &NodeConfig{CacheWritableOpens: cacheWritable},
+			fileInfo:          databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{ObjectType: objectType, Path: "/dir/file"}},
+			buf:               fileBuffer{Data: []byte("data")},
+			metadataCheckedAt: time.Now(),
+		}
+	}
+	cases := []struct {
+		name          string
+		objectType    workspace.ObjectType
+		cacheWritable bool
+		want          uint32
+	}{
+		{"default", workspace.ObjectTypeFile, false, fuse.FOPEN_DIRECT_IO},
+		{"enabled", workspace.ObjectTypeFile, true, fuse.FOPEN_KEEP_CACHE},
+		{"notebook", workspace.ObjectTypeNotebook, true, fuse.FOPEN_DIRECT_IO},
+	}
+	for _, tc := range cases {
+		n := newNode(tc.objectType, tc.cacheWritable)
+		if _, flags, errno := n.Open(context.Background(), syscall.O_RDWR); errno != 0 || flags != tc.want {
+			t.Fatalf("%s: Open flags = %#x, errno %d, want %#x", tc.name, flags, errno, tc.want)
+		}
+	}
+}
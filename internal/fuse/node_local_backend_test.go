@@ -0,0 +1,143 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/filecache"
+)
+
+// TestNodeStackOverLocalBackend exercises create, write, flush, lookup, read,
+// rename and unlink against a real directory instead of a mocked API.
+func TestNodeStackOverLocalBackend(t *testing.T) {
+	dir := t.TempDir()
+	local, err := backend.NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	registry := NewDirtyNodeRegistry()
+	root, err := NewRootNode(local, nil, "/", registry, nil)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	ctx := context.Background()
+
+	child, _, _, errno := root.Create(ctx, "notes.txt", 0, 0644, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Create errno %d", errno)
+	}
+	node := child.Operations().(*WSNode)
+	if _, errno := node.Write(ctx, nil, []byte("hello local"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "notes.txt")); err != nil || string(got) != "hello local" {
+		t.Fatalf("unexpected file on disk: %q, %v", got, err)
+	}
+	if count := registry.Count(); count != 0 {
+		t.Fatalf("expected clean registry after release, got %d", count)
+	}
+
+	if errno := root.Rename(ctx, "notes.txt", root, "renamed.txt", 0); errno != 0 {
+		t.Fatalf("Rename errno %d", errno)
+	}
+	root.MvChild("notes.txt", root.EmbeddedInode(), "renamed.txt", true)
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected old name to be gone, got %v", err)
+	}
+
+	// A fresh root sees the file through Lookup and reads it back.
+	fresh, err := NewRootNode(local, nil, "/", NewDirtyNodeRegistry(), nil)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	fs.NewNodeFS(fresh, &fs.Options{})
+	looked, errno := fresh.Lookup(ctx, "renamed.txt", &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Lookup errno %d", errno)
+	}
+	dest := make([]byte, 64)
+	res, errno := looked.Operations().(*WSNode).Read(ctx, nil, dest, 0)
+	if errno != 0 {
+		t.Fatalf("Read errno %d", errno)
+	}
+	data, _ := res.Bytes(dest)
+	if string(data) != "hello local" {
+		t.Fatalf("unexpected content %q", data)
+	}
+
+	if errno := fresh.Unlink(ctx, "renamed.txt"); errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	if _, errno := fresh.Lookup(ctx, "renamed.txt", &fuse.EntryOut{}); errno != syscall.ENOENT {
+		t.Fatalf("expected ENOENT after unlink, got %d", errno)
+	}
+}
+
+// TestNodeStackOverFederation mounts two local directories as the top-level
+// directories of one tree.
+func TestNodeStackOverFederation(t *testing.T) {
+	prodDir, devDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(prodDir, "a.txt"), []byte("prod"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var members []backend.Member
+	for name, dir := range map[string]string{"prod": prodDir, "dev": devDir} {
+		local, err := backend.NewLocalBackend(dir, 0)
+		if err != nil {
+			t.Fatalf("NewLocalBackend: %v", err)
+		}
+		members = append(members, backend.Member{Name: name, Backend: local})
+	}
+	federation, err := backend.NewFederation(members...)
+	if err != nil {
+		t.Fatalf("NewFederation: %v", err)
+	}
+	root, err := NewRootNode(federation, filecache.NewDisabledCache(), "/", NewDirtyNodeRegistry(), nil)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	ctx := context.Background()
+
+	if got := readdirNames(t, root); !reflect.DeepEqual(got, []string{"dev", "prod"}) {
+		t.Fatalf("root listing = %v", got)
+	}
+	lookupDir := func(name string) *WSNode {
+		child, errno := root.Lookup(ctx, name, &fuse.EntryOut{})
+		if errno != 0 {
+			t.Fatalf("Lookup %s errno %d", name, errno)
+		}
+		return child.Operations().(*WSNode)
+	}
+	prod, dev := lookupDir("prod"), lookupDir("dev")
+	if got := lookupText(t, prod, "a.txt"); got != "prod" {
+		t.Fatalf("prod/a.txt = %q", got)
+	}
+
+	node := createAndWrite(t, dev, "b.txt", "dev")
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if got, err := os.ReadFile(filepath.Join(devDir, "b.txt")); err != nil || string(got) != "dev" {
+		t.Fatalf("dev/b.txt on disk = %q, %v", got, err)
+	}
+
+	if _, errno := root.Mkdir(ctx, "qa", 0o755, &fuse.EntryOut{}); errno != syscall.EPERM {
+		t.Fatalf("Mkdir at the root errno %d, want EPERM", errno)
+	}
+	if errno := prod.Rename(ctx, "a.txt", dev, "a.txt", 0); errno != syscall.EXDEV {
+		t.Fatalf("Rename across workspaces errno %d, want EXDEV", errno)
+	}
+}
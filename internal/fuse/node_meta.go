@@ -53,7 +53,7 @@ func mergeNotebookExactSizeLocal(info, exact databricks.WSFileInfo) (databricks.
 }
 
 func (n *WSNode) metadataFreshLocked() bool {
-	if n.metadataCheckedAt.IsZero() {
+	if n.metadataCheckedAt.IsZero() || n.alwaysFresh(n.Path()) {
 		return false
 	}
 
@@ -78,6 +78,9 @@ func (n *WSNode) refreshMetadataLocked(ctx context.Context, bypassCache bool) (b
 		}
 		return false, 0
 	}
+	if n.alwaysFresh(n.Path()) {
+		bypassCache = true
+	}
 
 	if n.metadataCheckedAt.IsZero() {
 		if !bypassCache {
@@ -105,20 +108,82 @@ func (n *WSNode) refreshMetadataLocked(ctx context.Context, bypassCache bool) (b
 		logging.Debugf("refreshMetadata: unexpected file info type for %s", n.Path())
 		return false, syscall.EIO
 	}
+	return n.applyRemoteInfoLocked(wsInfo), 0
+}
+
+// applyRemoteInfoLocked adopts freshly fetched metadata of the node and
+// reports whether the remote object changed, in which case clean cached
+// content is dropped.
+func (n *WSNode) applyRemoteInfoLocked(wsInfo databricks.WSFileInfo) bool {
 	if merged, ok := mergeNotebookExactSizeLocal(wsInfo, n.fileInfo); ok {
 		wsInfo = merged
 	}
 
 	changed := fileInfoChanged(n.fileInfo, wsInfo)
+	if changed && n.modifiedAtIsLocal && n.isOwnVersionLocked(wsInfo) {
+		n.adoptServerModifiedAtLocked(wsInfo.ModifiedAt)
+		// Keep the exact size of a notebook this node wrote.
+		if merged, ok := mergeNotebookExactSizeLocal(wsInfo, n.fileInfo); ok {
+			wsInfo = merged
+		}
+		changed = false
+	}
 	if changed {
 		oldPath := n.fileInfo.Path
 		n.clearCleanBufferLocked()
 		n.deleteDiskCacheEntries(oldPath, wsInfo.Path)
+		if n.openCount > 0 && n.pageCacheWritableLocked() {
+			// Open handles may be reading and writing through pages of the
+			// old content. Invalidate them off this goroutine: the kernel
+			// can hold their locks while it waits for the running request.
+			go notifyContentIfPossible(n.EmbeddedInode(), wsInfo.Path)
+		}
 	}
 
 	n.fileInfo = wsInfo
+	n.modifiedAtIsLocal = false
 	n.metadataCheckedAt = time.Now()
-	return changed, 0
+	n.bindInoLocked()
+	return changed
+}
+
+// isOwnVersionLocked reports whether remote differs from the node only in
+// ModifiedAt while the node's ModifiedAt is a local clock reading. That is
+// the server's first report of content this node wrote, whose server-side
+// ModifiedAt was unknown. Comparing the two timestamps would only measure
+// clock skew between this host and the server.
+//
+// A file created here has no object ID until the server reports it, so the
+// IDs the server assigned count as the same object.
+func (n *WSNode) isOwnVersionLocked(remote databricks.WSFileInfo) bool {
+	local := n.fileInfo
+	local.ObjectInfo.ModifiedAt = remote.ModifiedAt
+	if !n.knownObjectLocked() {
+		local.ObjectInfo.ObjectId = remote.ObjectId
+		local.ObjectInfo.ResourceId = remote.ResourceId
+	}
+	return !fileInfoChanged(local, remote)
+}
+
+// knownObjectLocked reports whether the node knows the ID of its workspace
+// object, which it does unless it was created here and not reported by the
+// server since.
+func (n *WSNode) knownObjectLocked() bool {
+	return n.fileInfo.ObjectId != 0 || n.fileInfo.ResourceId != ""
+}
+
+// adoptServerModifiedAtLocked replaces a local ModifiedAt with the server's
+// version of the same content, keeping the buffer and the disk cache entry.
+func (n *WSNode) adoptServerModifiedAtLocked(modifiedAt int64) {
+	localModTime := n.fileInfo.ModTime()
+	if n.buf.RemoteModifiedAt == n.fileInfo.ModifiedAt {
+		n.buf.RemoteModifiedAt = modifiedAt
+	}
+	n.fileInfo.ObjectInfo.ModifiedAt = modifiedAt
+	if n.diskCache != nil && !n.diskCache.IsDisabled() {
+		n.diskCache.UpdateModTime(n.Path(), localModTime, n.fileInfo.ModTime())
+	}
+	logging.Debugf("Adopted server modification time for %s", n.Path())
 }
 
 func (n *WSNode) refreshMetadataIfNeededLocked(ctx context.Context) syscall.Errno {
@@ -131,17 +196,26 @@ func (n *WSNode) fillAttr(ctx context.Context, out *fuse.Attr) {
 
 	// Set the attributes for the file or directory
 	if wsInfo.IsDir() {
-		out.Mode = syscall.S_IFDIR | dirMode
+		mode := n.cfg().DirMode
+		if mode == 0 {
+			mode = defaultDirMode
+		}
+		out.Mode = syscall.S_IFDIR | mode
 		out.Nlink = dirNlink
 	} else {
-		out.Mode = syscall.S_IFREG | fileMode
+		mode := n.cfg().FileMode
+		if mode == 0 {
+			mode = defaultFileMode
+		}
+		// Execute bits come from the exec mode alone.
+		out.Mode = syscall.S_IFREG | mode&^0111 | n.execBitsLocked(mode)
 		out.Nlink = fileNlink
 	}
 
 	// Block size
 	out.Size = uint64(wsInfo.Size())
 	out.Blksize = blockSize
-	out.Blocks = (out.Size + blockFactor - 1) / blockFactor
+	out.Blocks = n.blocksLocked(out.Size)
 
 	// Timestamp
 	modTime := wsInfo.ModTime()
@@ -150,11 +224,14 @@ func (n *WSNode) fillAttr(ctx context.Context, out *fuse.Attr) {
 	out.Ctime = out.Mtime
 
 	// UID/GID are stable and reflect the mount owner, not the current caller.
-	out.Uid = n.ownerUid
-	out.Gid = n.ownerGid
+	out.Uid = n.cfg().OwnerUid
+	out.Gid = n.cfg().OwnerGid
 }
 
 func (n *WSNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if errno := n.checkCaller(ctx); errno != 0 {
+		return errno
+	}
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
@@ -173,7 +250,7 @@ func (n *WSNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOu
 	// This prevents race conditions where stat sees intermediate state
 	if n.isDirtyLocked() && n.buf.Data != nil {
 		out.Attr.Size = uint64(len(n.buf.Data))
-		out.Attr.Blocks = (out.Attr.Size + blockFactor - 1) / blockFactor
+		out.Attr.Blocks = n.blocksLocked(out.Attr.Size)
 	}
 
 	out.SetTimeout(n.attrTimeout())
@@ -181,31 +258,62 @@ func (n *WSNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOu
 	return 0
 }
 
+// blocksLocked returns st_blocks for a file of size bytes: the logical
+// size, or with cachedBlocks the bytes held locally.
+func (n *WSNode) blocksLocked(size uint64) uint64 {
+	if n.cfg().CachedBlocks && !n.fileInfo.IsDir() {
+		size = n.localBytesLocked()
+	}
+	return (size + blockFactor - 1) / blockFactor
+}
+
+// localBytesLocked returns how much of the content is held locally.
+func (n *WSNode) localBytesLocked() uint64 {
+	if n.buf.Data != nil {
+		return uint64(len(n.buf.Data))
+	}
+	if n.buf.CachedPath != "" {
+		return uint64(n.buf.FileSize)
+	}
+	if n.diskCache != nil {
+		if size, ok := n.diskCache.CachedSize(n.fileInfo.Path, n.fileInfo.ModTime()); ok {
+			return uint64(size)
+		}
+	}
+	return 0
+}
+
 func (n *WSNode) Access(ctx context.Context, mask uint32) syscall.Errno {
 	logging.Debugf("Access called on path: %s (mask: %d)", n.Path(), mask)
 
 	// Enforce UID-based access control when restrictAccess is enabled
-	if n.restrictAccess {
+	if n.cfg().RestrictAccess {
 		caller, ok := fuse.FromContext(ctx)
 		if !ok {
 			logging.Warnf("Access: failed to get caller context for %s", n.Path())
 			return syscall.EACCES
 		}
-		if caller.Uid != n.ownerUid {
-			logging.Debugf("Access denied: caller UID %d != owner UID %d for %s", caller.Uid, n.ownerUid, n.Path())
+		if caller.Uid != n.cfg().OwnerUid {
+			logging.Debugf("Access denied: caller UID %d != owner UID %d for %s", caller.Uid, n.cfg().OwnerUid, n.Path())
 			return syscall.EACCES
 		}
 	}
 
-	return 0
+	return n.checkCaller(ctx)
 }
 
 func (n *WSNode) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
 	logging.Debugf("Statfs called on path: %s", n.Path())
 
-	const blockSize = uint32(4096)
-	const totalBlocks = uint64(1 << 30)
-	const totalFiles = uint64(1 << 24)
+	totalBytes := n.cfg().StatfsTotalBytes
+	if totalBytes == 0 {
+		totalBytes = defaultStatfsTotalBytes
+	}
+	totalFiles := n.cfg().StatfsTotalFiles
+	if totalFiles == 0 {
+		totalFiles = defaultStatfsTotalFiles
+	}
+	totalBlocks := totalBytes / blockSize
 
 	out.Bsize = blockSize
 	out.Frsize = blockSize
@@ -220,6 +328,9 @@ func (n *WSNode) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno
 }
 
 func (n *WSNode) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if errno := n.checkCaller(ctx); errno != 0 {
+		return errno
+	}
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
@@ -259,7 +370,7 @@ func (n *WSNode) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttr
 	}
 
 	if !sizeChanged && (atimeRequested || mtimeRequested) {
-		if n.allowPostCreateTimestamps && n.openCount > 0 && !n.isDirtyLocked() && n.fileInfo.Size() == 0 {
+		if n.allowPostCreateTimestamps && n.openCount > 0 && n.unmodifiedSinceCreateLocked() && n.fileInfo.Size() == 0 {
 			n.fillAttr(ctx, &out.Attr)
 			return 0
 		}
@@ -277,7 +388,7 @@ func (n *WSNode) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttr
 		// Invalidate metadata cache to prevent stale reads.
 		n.wfClient.CacheInvalidate(n.Path())
 		if n.shouldFlushNowLocked() {
-			if errno := n.flushLocked(ctx); errno != 0 {
+			if errno := n.writeBackLocked(ctx); errno != 0 {
 				return errno
 			}
 		}
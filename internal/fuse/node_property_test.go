@@ -0,0 +1,294 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	iofs "io/fs"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/databricks"
+)
+
+// propertyBackend is an in-memory workspace used by the randomized
+// concurrency harness. Every mutation bumps a version used as ModifiedAt.
+type propertyBackend struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	version int64
+}
+
+func (b *propertyBackend) api() *databricks.FakeWorkspaceAPI {
+	stat := func(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		data, ok := b.files[filePath]
+		if !ok {
+			return nil, iofs.ErrNotExist
+		}
+		info := databricks.NewTestFileInfo(filePath, int64(len(data)), false)
+		info.ModifiedAt = b.version
+		return info, nil
+	}
+	return &databricks.FakeWorkspaceAPI{
+		StatFunc: stat,
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			data, ok := b.files[filePath]
+			if !ok {
+				return nil, iofs.ErrNotExist
+			}
+			return append([]byte(nil), data...), nil
+		},
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.files[filepath] = append([]byte(nil), data...)
+			b.version++
+			return nil
+		},
+		RenameFunc: func(ctx context.Context, sourcePath string, destinationPath string) error {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			data, ok := b.files[sourcePath]
+			if !ok {
+				return iofs.ErrNotExist
+			}
+			b.files[destinationPath] = data
+			delete(b.files, sourcePath)
+			b.version++
+			return nil
+		},
+	}
+}
+
+func (b *propertyBackend) content(path string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.files[path]
+	return data, ok
+}
+
+// propertyFile is the model of one file. mu serializes mutating operations on
+// the file so the model and the node observe the same order; reads, getattr and
+// fsync run without it to interleave with the mutations.
+type propertyFile struct {
+	mu       sync.Mutex
+	node     *WSNode
+	baseName string
+	renamed  bool
+	data     []byte
+}
+
+func (f *propertyFile) name() string {
+	if f.renamed {
+		return f.baseName + ".renamed"
+	}
+	return f.baseName
+}
+
+func (f *propertyFile) alternateName() string {
+	if f.renamed {
+		return f.baseName
+	}
+	return f.baseName + ".renamed"
+}
+
+func (r *DirtyNodeRegistry) contains(node *WSNode) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.nodes[node]
+	return ok
+}
+
+func propertySeed(t *testing.T) int64 {
+	t.Helper()
+	if value := os.Getenv("WSFS_PROPERTY_SEED"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			t.Fatalf("invalid WSFS_PROPERTY_SEED %q: %v", value, err)
+		}
+		return seed
+	}
+	return 20261016
+}
+
+// TestPropertyConcurrentNodeOperations runs randomized reads, writes,
+// truncates, renames and flushes across goroutines and nodes and checks:
+//   - the reported size always matches the model (size == len(buf)),
+//   - a node is registered as dirty exactly when it has unflushed changes,
+//   - after a final flush every file holds its model content under its
+//     current name and nothing is left at the other name (no lost writes,
+//     no resurrected paths).
+//
+// Set WSFS_PROPERTY_SEED to reproduce a failing run.
+func TestPropertyConcurrentNodeOperations(t *testing.T) {
+	seed := propertySeed(t)
+	t.Logf("seed %d (set WSFS_PROPERTY_SEED to reproduce)", seed)
+
+	const (
+		numFiles      = 4
+		numGoroutines = 8
+	)
+	opsPerGoroutine := 400
+	if testing.Short() {
+		opsPerGoroutine = 100
+	}
+
+	backend := &propertyBackend{files: make(map[string][]byte)}
+	api := backend.api()
+	registry := NewDirtyNodeRegistry()
+
+	root := &WSNode{
+		wfClient: api,
+		registry: registry,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeDirectory,
+			Path:       "/prop",
+		}},
+		isRoot: true,
+		errors: newErrorLog(),
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	ctx := context.Background()
+
+	files := make([]*propertyFile, numFiles)
+	for i := range files {
+		name := fmt.Sprintf("f%d.txt", i)
+		initial := []byte(fmt.Sprintf("initial-%d\n", i))
+		backend.files["/prop/"+name] = append([]byte(nil), initial...)
+
+		info := databricks.NewTestFileInfo("/prop/"+name, int64(len(initial)), false)
+		node := root.newChildNode(info)
+		// Keep a handle open so only explicit fsyncs and the final flush upload.
+		node.openCount = 1
+		inode := root.NewPersistentInode(ctx, node, fs.StableAttr{Mode: syscall.S_IFREG, Ino: stableIno(info)})
+		root.AddChild(name, inode, false)
+		files[i] = &propertyFile{node: node, baseName: name, data: initial}
+	}
+
+	// The kernel serializes renames within one directory.
+	var renameMu sync.Mutex
+
+	checkInvariants := func(f *propertyFile, op string) {
+		var out fuse.AttrOut
+		if errno := f.node.Getattr(ctx, nil, &out); errno != 0 {
+			t.Errorf("%s: Getattr %s errno %d", op, f.name(), errno)
+			return
+		}
+		if out.Size != uint64(len(f.data)) {
+			t.Errorf("%s: %s size %d, model %d", op, f.name(), out.Size, len(f.data))
+		}
+
+		f.node.mu.Lock()
+		dirty := f.node.isDirtyLocked()
+		registered := registry.contains(f.node)
+		path := f.node.Path()
+		f.node.mu.Unlock()
+		if dirty != registered {
+			t.Errorf("%s: %s dirty=%v but registered=%v", op, f.name(), dirty, registered)
+		}
+		if want := "/prop/" + f.name(); path != want {
+			t.Errorf("%s: node path %q, model %q", op, path, want)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(g)))
+			for i := 0; i < opsPerGoroutine; i++ {
+				f := files[rng.Intn(len(files))]
+				switch op := rng.Intn(100); {
+				case op < 25:
+					dest := make([]byte, 1+rng.Intn(32))
+					if _, errno := f.node.Read(ctx, nil, dest, int64(rng.Intn(64))); errno != 0 {
+						t.Errorf("Read errno %d", errno)
+					}
+				case op < 35:
+					var out fuse.AttrOut
+					if errno := f.node.Getattr(ctx, nil, &out); errno != 0 {
+						t.Errorf("Getattr errno %d", errno)
+					}
+				case op < 65:
+					f.mu.Lock()
+					off := rng.Intn(len(f.data) + 8)
+					payload := []byte(fmt.Sprintf("<g%d-%d>", g, i))
+					if _, errno := f.node.Write(ctx, nil, payload, int64(off)); errno != 0 {
+						t.Errorf("Write errno %d", errno)
+					} else {
+						if end := off + len(payload); end > len(f.data) {
+							f.data = append(f.data, make([]byte, end-len(f.data))...)
+						}
+						copy(f.data[off:], payload)
+					}
+					checkInvariants(f, "write")
+					f.mu.Unlock()
+				case op < 75:
+					f.mu.Lock()
+					size := rng.Intn(len(f.data) + 16)
+					in := &fuse.SetAttrIn{SetAttrInCommon: fuse.SetAttrInCommon{Valid: fuse.FATTR_SIZE, Size: uint64(size)}}
+					var out fuse.AttrOut
+					if errno := f.node.Setattr(ctx, nil, in, &out); errno != 0 {
+						t.Errorf("Setattr errno %d", errno)
+					} else if size <= len(f.data) {
+						f.data = f.data[:size]
+					} else {
+						f.data = append(f.data, make([]byte, size-len(f.data))...)
+					}
+					checkInvariants(f, "truncate")
+					f.mu.Unlock()
+				case op < 90:
+					if errno := f.node.Fsync(ctx, nil, 0); errno != 0 {
+						t.Errorf("Fsync errno %d", errno)
+					}
+				default:
+					renameMu.Lock()
+					f.mu.Lock()
+					if errno := root.Rename(ctx, f.name(), root, f.alternateName(), 0); errno != 0 {
+						t.Errorf("Rename %s errno %d", f.name(), errno)
+					} else {
+						// The FUSE bridge moves the inode after a successful rename.
+						root.MvChild(f.name(), root.EmbeddedInode(), f.alternateName(), true)
+						f.renamed = !f.renamed
+					}
+					checkInvariants(f, "rename")
+					f.mu.Unlock()
+					renameMu.Unlock()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if _, errs := registry.FlushAll(ctx); len(errs) != 0 {
+		t.Fatalf("FlushAll errors: %v", errs)
+	}
+	if count := registry.Count(); count != 0 {
+		t.Fatalf("expected empty dirty registry after FlushAll, got %d", count)
+	}
+	for _, f := range files {
+		got, ok := backend.content("/prop/" + f.name())
+		if !ok {
+			t.Errorf("%s missing from backend", f.name())
+			continue
+		}
+		if string(got) != string(f.data) {
+			t.Errorf("%s content mismatch:\n got %q\nwant %q", f.name(), got, f.data)
+		}
+		if stale, ok := backend.content("/prop/" + f.alternateName()); ok {
+			t.Errorf("%s resurrected with %q", f.alternateName(), stale)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package fuse
 import (
 	"context"
 	iofs "io/fs"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
@@ -969,3 +970,264 @@ func TestRenameRefreshFailureKeepsBufferedState(t *testing.T) {
 		t.Fatalf("expected metadataCheckedAt to remain unchanged, got %v", fileNode.metadataCheckedAt)
 	}
 }
+
+func TestRenameBlocksConcurrentFlushToOldPath(t *testing.T) {
+	const (
+		sourcePath = "/dir/file.txt"
+		destPath   = "/dir/renamed.txt"
+	)
+
+	var mu sync.Mutex
+	renamed := false
+	var writesAfterRename []string
+	remoteContents := map[string][]byte{sourcePath: []byte("remote\n")}
+	renameStarted := make(chan struct{})
+
+	api := &databricks.FakeWorkspaceAPI{
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if renamed {
+				writesAfterRename = append(writesAfterRename, filepath)
+			}
+			remoteContents[filepath] = append([]byte(nil), data...)
+			return nil
+		},
+		ReadAllFunc: func(ctx context.Context, filepath string) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			data, ok := remoteContents[filepath]
+			if !ok {
+				return nil, iofs.ErrNotExist
+			}
+			return append([]byte(nil), data...), nil
+		},
+		StatFunc: func(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			data, ok := remoteContents[filePath]
+			if !ok {
+				return nil, iofs.ErrNotExist
+			}
+			return databricks.NewTestFileInfo(filePath, int64(len(data)), false), nil
+		},
+		RenameFunc: func(ctx context.Context, sourcePathArg string, destinationPath string) error {
+			mu.Lock()
+			renamed = true
+			remoteContents[destinationPath] = remoteContents[sourcePathArg]
+			delete(remoteContents, sourcePathArg)
+			mu.Unlock()
+			// The backend has applied the rename; give the concurrent writer a
+			// chance to race the response before wsfs retargets the node.
+			close(renameStarted)
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+	}
+
+	root := &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeDirectory,
+			Path:       "/dir",
+		}},
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	ctx := context.Background()
+
+	fileNode := &WSNode{
+		wfClient:  api,
+		fileInfo:  databricks.NewTestFileInfo(sourcePath, 7, false),
+		buf:       fileBuffer{Data: []byte("dirty\n")},
+		openCount: 1,
+	}
+	fileNode.markDirtyLocked(dirtyData)
+	fileInode := root.NewPersistentInode(ctx, fileNode, fs.StableAttr{Mode: syscall.S_IFREG, Ino: stableIno(fileNode.fileInfo)})
+	root.AddChild("file.txt", fileInode, false)
+
+	writerDone := make(chan syscall.Errno, 1)
+	go func() {
+		<-renameStarted
+		if _, errno := fileNode.Write(ctx, nil, []byte("late"), 0); errno != 0 {
+			writerDone <- errno
+			return
+		}
+		writerDone <- fileNode.Fsync(ctx, nil, 0)
+	}()
+
+	if errno := root.Rename(ctx, "file.txt", root, "renamed.txt", 0); errno != 0 {
+		t.Fatalf("Rename failed with errno: %d", errno)
+	}
+	if errno := <-writerDone; errno != 0 {
+		t.Fatalf("concurrent write/flush failed with errno: %d", errno)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := remoteContents[sourcePath]; ok {
+		t.Fatalf("old path was resurrected with %q", remoteContents[sourcePath])
+	}
+	for _, path := range writesAfterRename {
+		if path != destPath {
+			t.Fatalf("expected post-rename flush to target %s, got %s", destPath, path)
+		}
+	}
+	if got := string(remoteContents[destPath]); got != "latey\n" {
+		t.Fatalf("unexpected destination content: %q", got)
+	}
+}
+
+func TestRenameThenWriteFlushesToNewPath(t *testing.T) {
+	const (
+		sourcePath = "/dir/file.txt"
+		destPath   = "/dir/renamed.txt"
+	)
+
+	var writePaths []string
+	remoteContents := map[string][]byte{sourcePath: []byte("remote\n")}
+	api := &databricks.FakeWorkspaceAPI{
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			writePaths = append(writePaths, filepath)
+			remoteContents[filepath] = append([]byte(nil), data...)
+			return nil
+		},
+		ReadAllFunc: func(ctx context.Context, filepath string) ([]byte, error) {
+			data, ok := remoteContents[filepath]
+			if !ok {
+				return nil, iofs.ErrNotExist
+			}
+			return append([]byte(nil), data...), nil
+		},
+		StatFunc: func(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+			data, ok := remoteContents[filePath]
+			if !ok {
+				return nil, iofs.ErrNotExist
+			}
+			return databricks.NewTestFileInfo(filePath, int64(len(data)), false), nil
+		},
+		RenameFunc: func(ctx context.Context, sourcePathArg string, destinationPath string) error {
+			remoteContents[destinationPath] = remoteContents[sourcePathArg]
+			delete(remoteContents, sourcePathArg)
+			return nil
+		},
+	}
+
+	root := &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeDirectory,
+			Path:       "/dir",
+		}},
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	ctx := context.Background()
+
+	fileNode := &WSNode{
+		wfClient:  api,
+		fileInfo:  databricks.NewTestFileInfo(sourcePath, 7, false),
+		buf:       fileBuffer{Data: []byte("first\n")},
+		openCount: 1,
+	}
+	fileNode.markDirtyLocked(dirtyData)
+	fileInode := root.NewPersistentInode(ctx, fileNode, fs.StableAttr{Mode: syscall.S_IFREG, Ino: stableIno(fileNode.fileInfo)})
+	root.AddChild("file.txt", fileInode, false)
+
+	if errno := root.Rename(ctx, "file.txt", root, "renamed.txt", 0); errno != 0 {
+		t.Fatalf("Rename failed with errno: %d", errno)
+	}
+	if _, errno := fileNode.Write(ctx, nil, []byte("second\n"), 0); errno != 0 {
+		t.Fatalf("Write failed with errno: %d", errno)
+	}
+	if errno := fileNode.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release failed with errno: %d", errno)
+	}
+
+	if len(writePaths) != 2 || writePaths[0] != sourcePath || writePaths[1] != destPath {
+		t.Fatalf("expected flush to old path then new path, got %v", writePaths)
+	}
+	if _, ok := remoteContents[sourcePath]; ok {
+		t.Fatal("old path was resurrected")
+	}
+	if got := string(remoteContents[destPath]); got != "second\n" {
+		t.Fatalf("unexpected destination content: %q", got)
+	}
+}
+
+func TestRenameNotebookToEditorBackupMovesNode(t *testing.T) {
+	const (
+		notebookPath = "/dir/foo"
+		backupPath   = "/dir/foo.py___jb_old___"
+		tempPath     = "/dir/foo.py___jb_tmp___"
+	)
+
+	notebookInfo := testNotebookInfo(notebookPath, workspace.LanguagePython)
+	notebookInfo.ObjectId = 7
+	tempInfo := databricks.NewTestFileInfo(tempPath, 10, false)
+	tempInfo.ObjectId = 9
+	objects := map[string]databricks.WSFileInfo{"/dir/foo.py": notebookInfo, notebookPath: notebookInfo, tempPath: tempInfo}
+	api := &databricks.FakeWorkspaceAPI{
+		StatFunc: func(ctx context.Context, filePath string) (iofs.FileInfo, error) {
+			if info, ok := objects[filePath]; ok {
+				return info, nil
+			}
+			return nil, iofs.ErrNotExist
+		},
+		RenameFunc: func(ctx context.Context, sourcePath string, destinationPath string) error {
+			switch {
+			case sourcePath == "/dir/foo.py" && destinationPath == backupPath:
+				// The notebook itself moves.
+				moved := notebookInfo
+				moved.Path = backupPath
+				objects = map[string]databricks.WSFileInfo{backupPath: moved, tempPath: tempInfo}
+			case sourcePath == tempPath && destinationPath == "/dir/foo.py":
+				// The notebook moves back and takes the temp content; the
+				// old content stays at the backup name as a regular file.
+				backup := databricks.NewTestFileInfo(backupPath, 10, false)
+				backup.ObjectId = 8
+				objects = map[string]databricks.WSFileInfo{"/dir/foo.py": notebookInfo, notebookPath: notebookInfo, backupPath: backup}
+			default:
+				t.Fatalf("unexpected rename: %s -> %s", sourcePath, destinationPath)
+			}
+			return nil
+		},
+	}
+
+	root := &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeDirectory,
+			Path:       "/dir",
+		}},
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+	ctx := context.Background()
+
+	notebookNode := &WSNode{wfClient: api, fileInfo: notebookInfo, metadataCheckedAt: time.Now()}
+	notebookInode := root.NewPersistentInode(ctx, notebookNode, fs.StableAttr{Mode: syscall.S_IFREG, Ino: stableIno(notebookInfo)})
+	root.AddChild("foo.py", notebookInode, false)
+	tempNode := &WSNode{wfClient: api, fileInfo: tempInfo, metadataCheckedAt: time.Now()}
+	tempInode := root.NewPersistentInode(ctx, tempNode, fs.StableAttr{Mode: syscall.S_IFREG, Ino: stableIno(tempInfo)})
+	root.AddChild("foo.py___jb_tmp___", tempInode, false)
+
+	renameAndMove(t, root, "foo.py", root, "foo.py___jb_old___")
+	notebookNode.mu.Lock()
+	gotPath := notebookNode.Path()
+	notebookNode.mu.Unlock()
+	if gotPath != backupPath {
+		t.Fatalf("notebook node path = %s, want it to follow the rename to %s", gotPath, backupPath)
+	}
+
+	renameAndMove(t, root, "foo.py___jb_tmp___", root, "foo.py")
+	tempNode.mu.Lock()
+	gotPath, gotID := tempNode.Path(), tempNode.fileInfo.ObjectId
+	tempNode.mu.Unlock()
+	if gotPath != notebookPath || gotID != 7 {
+		t.Fatalf("saved node = %s (ObjectId %d), want the notebook", gotPath, gotID)
+	}
+	notebookNode.mu.Lock()
+	checked := notebookNode.metadataCheckedAt
+	notebookNode.mu.Unlock()
+	if !checked.IsZero() {
+		t.Fatal("backup node still trusted as the notebook after the save restored it")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"hash/fnv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -12,8 +13,11 @@ import (
 	"github.com/hanwen/go-fuse/v2/fuse"
 
 	"wsfs/internal/databricks"
+	"wsfs/internal/events"
 	"wsfs/internal/filecache"
 	"wsfs/internal/logging"
+	"wsfs/internal/pathutil"
+	"wsfs/internal/transform"
 )
 
 // File system constants
@@ -21,9 +25,9 @@ const (
 	defaultAttrTTL  = 10 * time.Second
 	defaultEntryTTL = 10 * time.Second
 
-	// File permissions
-	dirMode  = 0755
-	fileMode = 0644
+	// Default permissions
+	defaultDirMode  = 0755
+	defaultFileMode = 0644
 
 	// Block size for file attributes
 	blockSize   = 4096
@@ -32,12 +36,20 @@ const (
 	// Statfs limits
 	maxNameLen = 255
 
+	// Statfs totals reported when the mount does not configure its own.
+	// Databricks exposes no workspace quota API, so these are placeholders.
+	defaultStatfsTotalBytes = uint64(1<<30) * blockSize
+	defaultStatfsTotalFiles = uint64(1 << 24)
+
 	// Default inode number when no ID is available
 	defaultIno = 1
 
 	// Nlink values
 	dirNlink  = 2
 	fileNlink = 1
+
+	// RENAME_NOREPLACE as sent by the kernel; go-fuse only exports RENAME_EXCHANGE.
+	renameNoReplace = 0x1
 )
 
 // Operation timeouts for API calls
@@ -63,17 +75,125 @@ type fileBuffer struct {
 	// ReplaceOnFirstWrite is used for notebook scaffolds created by Create().
 	// The first user write at offset 0 replaces the scaffold instead of overlaying it.
 	ReplaceOnFirstWrite bool
+	// RemoteChecksum is the SHA256 of the content last read from or written to the
+	// workspace, and RemoteModifiedAt the ModifiedAt that content belongs to.
+	// Flush skips the upload when the dirty buffer still matches it.
+	RemoteChecksum   string
+	RemoteModifiedAt int64
+	// RemoteChunks holds per-chunk hashes of that content for large files when
+	// the backend supports delta uploads.
+	RemoteChunks []chunkSum
+	// Shared is set while an upload reads Data without holding the node
+	// lock. Data must then be copied before it is changed in place.
+	Shared bool
+}
+
+// wsFileHandle is the handle of an open file.
+type wsFileHandle struct {
+	// sync is set for O_SYNC and O_DSYNC opens: every write through the
+	// handle is uploaded before it returns.
+	sync bool
+}
+
+func newFileHandle(flags uint32) *wsFileHandle {
+	return &wsFileHandle{sync: flags&(syscall.O_SYNC|syscall.O_DSYNC) != 0}
 }
 
-type wsFileHandle struct{}
+// isSyncHandle reports whether writes through fh must be durable on return.
+func isSyncHandle(fh fs.FileHandle) bool {
+	h, ok := fh.(*wsFileHandle)
+	return ok && h.sync
+}
 
-// NodeConfig holds configuration for access control.
+// NodeConfig holds the mount-wide settings of the nodes. NewRootNode keeps
+// a copy that every node of the mount shares, so changes to config after the
+// mount is built have no effect.
 type NodeConfig struct {
 	OwnerUid       uint32 // UID of the user who mounted the filesystem
 	OwnerGid       uint32 // GID of the user who mounted the filesystem
 	RestrictAccess bool   // Whether to enforce UID-based access control
 	AttrTTL        time.Duration
 	EntryTTL       time.Duration
+	// AllowedUids and AllowedGids limit an --allow-other mount to the owner,
+	// the listed users and members of the listed groups. Both empty allow
+	// every local user.
+	AllowedUids []uint32
+	AllowedGids []uint32
+	// StatfsTotalBytes and StatfsTotalFiles override the capacity reported by Statfs.
+	// Zero keeps the built-in defaults.
+	StatfsTotalBytes uint64
+	StatfsTotalFiles uint64
+	// FileMode and DirMode are the permission bits reported for files and
+	// directories. Zero keeps 0644 and 0755.
+	FileMode uint32
+	DirMode  uint32
+	// CachedBlocks makes st_blocks count the content held locally, in
+	// memory or in the disk cache, instead of the logical size, so du shows
+	// what a tree takes on this machine.
+	CachedBlocks bool
+	// Inodes numbers the inodes of the mount and keeps the numbers that
+	// differ from the object ID across mounts. Nil numbers them for this
+	// mount only.
+	Inodes *InodeIndex
+	// ExecMode selects which files report execute bits. The zero value
+	// reports none.
+	ExecMode ExecMode
+	// CaseInsensitive gives siblings that differ only in case distinct names
+	// and matches lookups regardless of case, for macOS and Windows clients.
+	CaseInsensitive bool
+	// NormalizeUnicode creates names in NFC and lets lookups match names
+	// regardless of Unicode normalization form.
+	NormalizeUnicode bool
+	// Events receives the changes made through the mount. Nil publishes
+	// nothing.
+	Events *events.Bus
+	// OptimisticMkdir builds the node of a new directory from the request
+	// instead of stating it after the mkdir call.
+	OptimisticMkdir bool
+	// WarmRepos lists the whole tree of a Databricks Repo into the metadata
+	// cache in the background when the repo directory is opened.
+	WarmRepos bool
+	// HidePatterns are glob patterns, in path.Match syntax, of names the
+	// mount hides: they are not listed, not found and cannot be created.
+	// Matching is done on the base name and ignores case.
+	HidePatterns []string
+	// LocalTempPatterns are glob patterns, in path.Match syntax, of the lock
+	// and probe files editors create next to a document. A file created
+	// under such a name stays in memory, is never uploaded and is dropped
+	// when its last handle closes. Matching is done on the base name and
+	// ignores case.
+	LocalTempPatterns []string
+	// BulkImportWorkers bounds the background uploads of small new files
+	// while many files are created at once, e.g. by tar or unzip. Zero
+	// uploads every file on close.
+	BulkImportWorkers int
+	// FlushThreshold uploads a file while it is being written each time
+	// this many bytes were written since its last upload, so a large write
+	// does not leave everything to the flush at close. Zero uploads only
+	// on flush.
+	FlushThreshold int64
+	// NoCachePatterns are glob patterns, in path.Match syntax, of objects
+	// that are read fresh from the workspace every time: they bypass the
+	// metadata and disk caches, and the kernel caches neither their
+	// attributes nor their content. Patterns with a slash match the
+	// workspace path or one of its parents; others match the base name.
+	// Matching ignores case.
+	NoCachePatterns []string
+	// CacheWritableOpens lets the kernel page cache serve files opened for
+	// writing, instead of sending every read of such a handle to wsfs.
+	// Writes still reach wsfs before they return, and wsfs invalidates the
+	// cached pages when it sees the file change remotely.
+	CacheWritableOpens bool
+	// ObjectInfoFiles adds a hidden, read-only .wsfs-objectinfo.json to
+	// every directory that lists the workspace ObjectInfo of its children.
+	ObjectInfoFiles bool
+	// NotebookAliases says under which names notebooks are listed and
+	// found. The backend must resolve names the same way.
+	NotebookAliases pathutil.NotebookAliases
+	// Transforms rewrite the content of matching files before it is
+	// uploaded, as configured by a .wsfsattributes file. Nil uploads
+	// content as written.
+	Transforms *transform.Set
 }
 
 type dirtyFlag uint8
@@ -81,26 +201,42 @@ type dirtyFlag uint8
 const (
 	dirtyData dirtyFlag = 1 << iota
 	dirtyTruncate
+	dirtyCreate // created here and not in the workspace yet
 )
 
 type WSNode struct {
 	fs.Inode
 	wfClient                  databricks.WorkspaceFilesAPI
 	diskCache                 *filecache.DiskCache
+	config                    *NodeConfig // shared by all nodes of the mount
 	fileInfo                  databricks.WSFileInfo
 	buf                       fileBuffer
 	mu                        sync.Mutex
 	registry                  *DirtyNodeRegistry
-	ownerUid                  uint32 // UID of the mount owner
-	ownerGid                  uint32 // GID of the mount owner
-	restrictAccess            bool   // Enforce access control when true
-	attrTTL                   time.Duration
-	entryTTL                  time.Duration
 	openCount                 int
 	dirtyFlags                dirtyFlag
 	pendingTruncate           bool
 	allowPostCreateTimestamps bool
 	metadataCheckedAt         time.Time
+	modifiedAtIsLocal         bool   // fileInfo.ModifiedAt is a local clock reading, not a server version
+	createPath                string // path of a file created here but not yet in the workspace
+	isRoot                    bool
+	localTemp                 bool                // created under a local temp name; never uploaded
+	repoWarmedAt              time.Time           // when a warm-up of this repo last started
+	caseConflictsWarned       map[string]struct{} // colliding groups already logged
+	lastError                 *nodeError
+	errors                    *errorLog     // shared by all nodes of the mount
+	access                    *accessList   // shared by all nodes of the mount; nil allows every caller
+	bulk                      *bulkImporter // shared by all nodes of the mount
+	bulkEligible              bool          // created here and not closed yet
+	bulkPending               bool          // upload queued by the bulk importer
+	bufGen                    uint64        // bumped whenever the buffer changes
+	transformPending          bool          // uploaded as written while open; transform at the last close
+	writtenSinceUpload        int64         // bytes written since the last upload started
+	flushing                  bool          // an upload runs without holding mu
+	flushDone                 *sync.Cond    // signalled when flushing ends
+	unlinked                  *unlinkedFile // unlinked while open; deleted at the last close
+	unlinkedChildren          unlinkedSet   // names of children unlinked while open
 }
 
 var _ = (fs.NodeGetattrer)((*WSNode)(nil))
@@ -123,23 +259,31 @@ var _ = (fs.NodeRenamer)((*WSNode)(nil))
 var _ = (fs.NodeAccesser)((*WSNode)(nil))
 var _ = (fs.NodeStatfser)((*WSNode)(nil))
 var _ = (fs.NodeOnForgetter)((*WSNode)(nil))
+var _ = (fs.NodeGetxattrer)((*WSNode)(nil))
+var _ = (fs.NodeListxattrer)((*WSNode)(nil))
 
 func (n *WSNode) Path() string {
 	return n.fileInfo.Path
 }
 
 func (n *WSNode) attrTimeout() time.Duration {
-	if n.attrTTL <= 0 {
+	if n.alwaysFresh(n.Path()) {
+		return 0
+	}
+	if n.cfg().AttrTTL <= 0 {
 		return defaultAttrTTL
 	}
-	return n.attrTTL
+	return n.cfg().AttrTTL
 }
 
 func (n *WSNode) entryTimeout() time.Duration {
-	if n.entryTTL <= 0 {
+	if n.alwaysFresh(n.Path()) {
+		return 0
+	}
+	if n.cfg().EntryTTL <= 0 {
 		return defaultEntryTTL
 	}
-	return n.entryTTL
+	return n.cfg().EntryTTL
 }
 
 func (n *WSNode) setEntryOutTimeouts(out *fuse.EntryOut) {
@@ -147,29 +291,52 @@ func (n *WSNode) setEntryOutTimeouts(out *fuse.EntryOut) {
 	out.SetAttrTimeout(n.attrTimeout())
 }
 
-func (n *WSNode) applyNodeConfig(config *NodeConfig) {
-	if config == nil {
-		return
+// noNodeConfig is read by nodes built without a mount, as in tests.
+var noNodeConfig = &NodeConfig{}
+
+// cfg returns the settings of the node's mount.
+func (n *WSNode) cfg() *NodeConfig {
+	if n.config == nil {
+		return noNodeConfig
+	}
+	return n.config
+}
+
+// newMountConfig returns the settings all nodes of a mount share: a copy of
+// config with the name patterns lower-cased and an inode index set.
+func newMountConfig(config *NodeConfig) *NodeConfig {
+	var c NodeConfig
+	if config != nil {
+		c = *config
+	}
+	c.HidePatterns = lowerPatterns(c.HidePatterns)
+	c.LocalTempPatterns = lowerPatterns(c.LocalTempPatterns)
+	c.NoCachePatterns = lowerPatterns(c.NoCachePatterns)
+	if c.Inodes == nil {
+		c.Inodes = newInodeIndex("")
 	}
-	n.ownerUid = config.OwnerUid
-	n.ownerGid = config.OwnerGid
-	n.restrictAccess = config.RestrictAccess
-	n.attrTTL = config.AttrTTL
-	n.entryTTL = config.EntryTTL
+	return &c
+}
+
+func lowerPatterns(patterns []string) []string {
+	var lower []string
+	for _, pattern := range patterns {
+		lower = append(lower, strings.ToLower(pattern))
+	}
+	return lower
 }
 
 func (n *WSNode) newChildNode(wsInfo databricks.WSFileInfo) *WSNode {
 	return &WSNode{
 		wfClient:          n.wfClient,
 		diskCache:         n.diskCache,
+		config:            n.config,
 		fileInfo:          wsInfo,
 		registry:          n.registry,
-		ownerUid:          n.ownerUid,
-		ownerGid:          n.ownerGid,
-		restrictAccess:    n.restrictAccess,
-		attrTTL:           n.attrTTL,
-		entryTTL:          n.entryTTL,
+		access:            n.access,
 		metadataCheckedAt: time.Now(),
+		errors:            n.errors,
+		bulk:              n.bulk,
 	}
 }
 
@@ -205,15 +372,17 @@ func truncateChecksum(checksum string) string {
 }
 
 func (n *WSNode) markDirtyLocked(flag dirtyFlag) {
+	n.bufGen++
 	n.dirtyFlags |= flag
 	n.buf.Dirty = true
-	if n.registry != nil {
+	if n.registry != nil && !n.localTemp && n.unlinked == nil {
 		n.registry.Register(n)
 	}
 }
 
 func (n *WSNode) clearDirtyLocked() {
 	n.dirtyFlags = 0
+	n.writtenSinceUpload = 0
 	n.buf.Dirty = false
 	n.pendingTruncate = false
 	if n.registry != nil {
@@ -225,6 +394,15 @@ func (n *WSNode) isDirtyLocked() bool {
 	return n.buf.Dirty || n.dirtyFlags != 0
 }
 
+// unmodifiedSinceCreateLocked reports whether nothing but the deferred
+// remote create of a new file is pending, or nothing at all.
+func (n *WSNode) unmodifiedSinceCreateLocked() bool {
+	if n.dirtyFlags == dirtyCreate {
+		return true
+	}
+	return !n.isDirtyLocked()
+}
+
 func (n *WSNode) shouldFlushNowLocked() bool {
 	return n.isDirtyLocked() && n.openCount == 0
 }
@@ -246,6 +424,7 @@ func (n *WSNode) decrementOpenLocked() {
 
 func (n *WSNode) markModifiedLocked(t time.Time) {
 	n.fileInfo.ObjectInfo.ModifiedAt = t.UnixMilli()
+	n.modifiedAtIsLocal = true
 }
 
 func (n *WSNode) clearCachedFileLocked() {
@@ -254,9 +433,33 @@ func (n *WSNode) clearCachedFileLocked() {
 	n.buf.FileSize = 0
 }
 
+func (n *WSNode) rememberRemoteContentLocked(checksum string, data []byte) {
+	n.buf.RemoteChecksum = checksum
+	n.buf.RemoteModifiedAt = n.fileInfo.ModifiedAt
+	n.rememberRemoteChunksLocked(data)
+}
+
+// rememberRemoteChunksLocked records chunk hashes of the remote content so
+// later flushes can send only changed chunks. data may be nil when the
+// content lives only in the disk cache.
+func (n *WSNode) rememberRemoteChunksLocked(data []byte) {
+	n.buf.RemoteChunks = nil
+	if _, ok := n.chunkWriterLocked(); ok && len(data) >= deltaMinFileSize {
+		n.buf.RemoteChunks = chunkChecksums(data)
+	}
+}
+
+func (n *WSNode) forgetRemoteContentLocked() {
+	n.buf.RemoteChecksum = ""
+	n.buf.RemoteModifiedAt = 0
+	n.buf.RemoteChunks = nil
+}
+
 func (n *WSNode) resetBufferLocked() {
+	n.bufGen++
 	n.buf.Data = nil
 	n.clearCachedFileLocked()
+	n.forgetRemoteContentLocked()
 	n.clearDirtyLocked()
 }
 
@@ -266,6 +469,7 @@ func (n *WSNode) clearCleanBufferLocked() {
 	}
 	n.buf.Data = nil
 	n.clearCachedFileLocked()
+	n.forgetRemoteContentLocked()
 }
 
 func (n *WSNode) deleteDiskCacheEntries(paths ...string) {
@@ -289,8 +493,9 @@ func (n *WSNode) deleteDiskCacheEntries(paths ...string) {
 }
 
 func NewRootNode(wfClient databricks.WorkspaceFilesAPI, diskCache *filecache.DiskCache, rootPath string, registry *DirtyNodeRegistry, config *NodeConfig) (*WSNode, error) {
-	info, err := wfClient.Stat(context.Background(), rootPath)
-
+	ctx, cancel := context.WithTimeout(context.Background(), metadataOpTimeout)
+	defer cancel()
+	info, err := wfClient.Stat(ctx, rootPath)
 	if err != nil {
 		return nil, err
 	}
@@ -303,15 +508,32 @@ func NewRootNode(wfClient databricks.WorkspaceFilesAPI, diskCache *filecache.Dis
 		return nil, syscall.ENOTDIR
 	}
 
+	mountConfig := newMountConfig(config)
 	node := &WSNode{
 		wfClient:          wfClient,
 		diskCache:         diskCache,
+		config:            mountConfig,
 		fileInfo:          wsInfo,
 		registry:          registry,
+		access:            newAccessList(mountConfig.AllowedUids, mountConfig.AllowedGids),
 		metadataCheckedAt: time.Now(),
+		isRoot:            true,
+		errors:            newErrorLog(),
+	}
+	if mountConfig.BulkImportWorkers > 0 {
+		node.bulk = newBulkImporter(mountConfig.BulkImportWorkers)
 	}
-
-	node.applyNodeConfig(config)
 
 	return node, nil
 }
+
+// renameDiskCacheEntries moves the disk cache entries below a renamed
+// directory to its new path, so the files stay cached under their new names.
+func (n *WSNode) renameDiskCacheEntries(oldPrefix, newPrefix string) {
+	if n.diskCache == nil || n.diskCache.IsDisabled() {
+		return
+	}
+	if kept := n.diskCache.Rename(oldPrefix, newPrefix); kept > 0 {
+		logging.Debugf("Moved %d cache entries from %s to %s", kept, oldPrefix, newPrefix)
+	}
+}
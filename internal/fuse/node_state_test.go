@@ -64,8 +64,8 @@ func TestNewRootNode(t *testing.T) {
 	if err != nil {
 		t.Fatalf("expected success, got %v", err)
 	}
-	if root.ownerUid != 99 || root.ownerGid != 199 || !root.restrictAccess {
-		t.Fatalf("unexpected node config: %+v", root)
+	if root.config.OwnerUid != 99 || root.config.OwnerGid != 199 || !root.config.RestrictAccess {
+		t.Fatalf("unexpected node config: %+v", root.config)
 	}
 }
 
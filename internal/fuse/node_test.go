@@ -4,6 +4,7 @@ import (
 	"context"
 	"io/fs"
 	"os"
+	"reflect"
 	"syscall"
 	"testing"
 	"time"
@@ -13,6 +14,7 @@ import (
 
 	"wsfs/internal/databricks"
 	"wsfs/internal/filecache"
+	"wsfs/internal/pathutil"
 )
 
 func TestWSNodeTruncateLockedShrinks(t *testing.T) {
@@ -392,8 +394,8 @@ func TestReleaseUsesLocalMetadataForImmediateLookupAndRead(t *testing.T) {
 	if statCalls != 0 {
 		t.Fatalf("expected stale Stat path to be unused, got %d calls", statCalls)
 	}
-	if statFreshCalls != 1 {
-		t.Fatalf("expected StatFresh to be used only for create, got %d calls", statFreshCalls)
+	if statFreshCalls != 0 {
+		t.Fatalf("expected no StatFresh for a new regular file, got %d calls", statFreshCalls)
 	}
 	if child.fileInfo.Size() != int64(len(writtenData)) {
 		t.Fatalf("expected child size %d after flush, got %d", len(writtenData), child.fileInfo.Size())
@@ -523,6 +525,70 @@ func TestRefreshMetadataLockedPreservesNotebookExactSize(t *testing.T) {
 	}
 }
 
+func TestNotebookExportIsReusedFromDiskCache(t *testing.T) {
+	cache, err := filecache.NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("cache init: %v", err)
+	}
+	source := []byte("# Databricks notebook source\nprint(1)\n")
+	readCalls := 0
+	api := &databricks.FakeWorkspaceAPI{
+		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
+			readCalls++
+			return source, nil
+		},
+	}
+	info := databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+		Path:       "/test/notebook",
+		ObjectType: workspace.ObjectTypeNotebook,
+		Language:   workspace.LanguagePython,
+		ModifiedAt: time.Now().UnixMilli(),
+	}}
+	newNode := func() *WSNode {
+		return &WSNode{wfClient: api, diskCache: cache, fileInfo: info}
+	}
+
+	first := newNode()
+	if _, errno := first.Read(context.Background(), nil, make([]byte, 8), 0); errno != 0 {
+		t.Fatalf("Read failed with errno: %d", errno)
+	}
+	if readCalls != 1 {
+		t.Fatalf("expected 1 export, got %d", readCalls)
+	}
+
+	// A later lookup knows the size without exporting or opening the copy.
+	second := newNode()
+	out := &fuse.AttrOut{}
+	if errno := second.Getattr(context.Background(), nil, out); errno != 0 {
+		t.Fatalf("Getattr failed with errno: %d", errno)
+	}
+	if out.Size != uint64(len(source)) || !second.fileInfo.NotebookSizeComputed {
+		t.Fatalf("size = %d (computed %v), want %d", out.Size, second.fileInfo.NotebookSizeComputed, len(source))
+	}
+	if second.buf.CachedPath != "" {
+		t.Fatal("expected stat to leave the cached export closed")
+	}
+	res, errno := second.Read(context.Background(), nil, make([]byte, 8), 0)
+	if errno != 0 {
+		t.Fatalf("Read failed with errno: %d", errno)
+	}
+	if got, _ := res.Bytes(nil); string(got) != string(source[:8]) {
+		t.Fatalf("read %q, want %q", got, source[:8])
+	}
+	if readCalls != 1 {
+		t.Fatalf("expected the export to be reused, got %d exports", readCalls)
+	}
+
+	// Another version is exported again.
+	info.ModifiedAt++
+	if _, errno := newNode().Read(context.Background(), nil, make([]byte, 8), 0); errno != 0 {
+		t.Fatalf("Read failed with errno: %d", errno)
+	}
+	if readCalls != 2 {
+		t.Fatalf("expected a new version to be exported, got %d exports", readCalls)
+	}
+}
+
 // TestOpenReleaseFlushesWhenLastHandleClosed verifies flush happens only on last close.
 func TestOpenReleaseFlushesWhenLastHandleClosed(t *testing.T) {
 	var writeCalls int
@@ -735,8 +801,8 @@ func TestWSNodeSetattr(t *testing.T) {
 	if out.Size != 5 {
 		t.Errorf("Expected size 5, got %d", out.Size)
 	}
-	if got := out.Mode & 0777; got != fileMode {
-		t.Errorf("expected synthetic mode %o, got %o", fileMode, got)
+	if got := out.Mode & 0777; got != defaultFileMode {
+		t.Errorf("expected synthetic mode %o, got %o", defaultFileMode, got)
 	}
 }
 
@@ -760,8 +826,78 @@ func TestWSNodeSetattrAcceptsModeOnlyAsNoOp(t *testing.T) {
 	if out.Size != 12 {
 		t.Fatalf("expected size 12, got %d", out.Size)
 	}
-	if got := out.Mode & 0777; got != fileMode {
-		t.Fatalf("expected synthetic mode %o, got %o", fileMode, got)
+	if got := out.Mode & 0777; got != defaultFileMode {
+		t.Fatalf("expected synthetic mode %o, got %o", defaultFileMode, got)
+	}
+}
+
+func TestWSNodeFillAttrConfiguredModes(t *testing.T) {
+	file := &WSNode{fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{ObjectType: workspace.ObjectTypeFile, Path: "/a.txt"}}}
+	dir := &WSNode{fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{ObjectType: workspace.ObjectTypeDirectory, Path: "/d"}}}
+	for _, n := range []*WSNode{file, dir} {
+		n.config = &NodeConfig{FileMode: 0600, DirMode: 0700}
+	}
+
+	var out fuse.Attr
+	file.fillAttr(context.Background(), &out)
+	if out.Mode != syscall.S_IFREG|0600 {
+		t.Fatalf("file mode = %o, want %o", out.Mode, syscall.S_IFREG|0600)
+	}
+	dir.fillAttr(context.Background(), &out)
+	if out.Mode != syscall.S_IFDIR|0700 {
+		t.Fatalf("dir mode = %o, want %o", out.Mode, syscall.S_IFDIR|0700)
+	}
+	if child := dir.newChildNode(file.fileInfo); child.cfg().FileMode != 0600 || child.cfg().DirMode != 0700 {
+		t.Fatalf("child modes = %o/%o, want 600/700", child.cfg().FileMode, child.cfg().DirMode)
+	}
+}
+
+func TestWSNodeFillAttrCachedBlocks(t *testing.T) {
+	cache, err := filecache.NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache: %v", err)
+	}
+	newNode := func(p string) *WSNode {
+		return &WSNode{
+			diskCache: cache,
+			config:    &NodeConfig{CachedBlocks: true},
+			fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+				ObjectType: workspace.ObjectTypeFile,
+				Path:       p,
+				Size:       4096,
+				ModifiedAt: 1000,
+			}},
+		}
+	}
+	blocks := func(n *WSNode) uint64 {
+		var out fuse.Attr
+		n.fillAttr(context.Background(), &out)
+		if out.Size != 4096 {
+			t.Fatalf("size = %d, want the logical size", out.Size)
+		}
+		return out.Blocks
+	}
+
+	if got := blocks(newNode("/remote.bin")); got != 0 {
+		t.Fatalf("blocks of a file with no local content = %d, want 0", got)
+	}
+	cached := newNode("/cached.bin")
+	if _, err := cache.Set("/cached.bin", make([]byte, 4096), cached.fileInfo.ModTime()); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got := blocks(cached); got != 8 {
+		t.Fatalf("blocks of a cached file = %d, want 8", got)
+	}
+	buffered := newNode("/buffered.bin")
+	buffered.buf.Data = make([]byte, 1024)
+	if got := blocks(buffered); got != 2 {
+		t.Fatalf("blocks of a buffered file = %d, want 2", got)
+	}
+
+	logical := newNode("/remote.bin")
+	logical.config.CachedBlocks = false
+	if got := blocks(logical); got != 8 {
+		t.Fatalf("logical blocks = %d, want 8", got)
 	}
 }
 
@@ -949,8 +1085,7 @@ func TestWSNodeGetattrDirectory(t *testing.T) {
 
 func TestWSNodeGetattrUsesMountOwnerIDs(t *testing.T) {
 	n := &WSNode{
-		ownerUid: 123,
-		ownerGid: 456,
+		config: &NodeConfig{OwnerUid: 123, OwnerGid: 456},
 		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
 			ObjectType: workspace.ObjectTypeFile,
 			Path:       "/owned.txt",
@@ -1013,7 +1148,7 @@ func TestWSNodeAccess(t *testing.T) {
 			ObjectType: workspace.ObjectTypeFile,
 			Path:       "/test.txt",
 		}},
-		restrictAccess: false, // No access control
+		config: &NodeConfig{RestrictAccess: false}, // No access control
 	}
 
 	// Test various access masks - all should succeed
@@ -1033,9 +1168,7 @@ func TestWSNodeAccessRestricted(t *testing.T) {
 			ObjectType: workspace.ObjectTypeFile,
 			Path:       "/test.txt",
 		}},
-		ownerUid:       1000,
-		ownerGid:       1001,
-		restrictAccess: true, // Access control enabled
+		config: &NodeConfig{OwnerUid: 1000, OwnerGid: 1001, RestrictAccess: true}, // Access control enabled
 	}
 
 	// Without FUSE context, access should be denied
@@ -1049,26 +1182,16 @@ func TestWSNodeAccessRestricted(t *testing.T) {
 // TestWSNodeAccessRestrictedInheritance tests that child nodes inherit access settings
 func TestWSNodeAccessRestrictedInheritance(t *testing.T) {
 	parent := &WSNode{
-		ownerUid:       1000,
-		ownerGid:       1001,
-		restrictAccess: true,
+		config: &NodeConfig{OwnerUid: 1000, OwnerGid: 1001, RestrictAccess: true},
 	}
 
-	// Simulate child node creation pattern
-	child := &WSNode{
-		ownerUid:       parent.ownerUid,
-		ownerGid:       parent.ownerGid,
-		restrictAccess: parent.restrictAccess,
-	}
+	child := parent.newChildNode(databricks.WSFileInfo{})
 
-	if child.ownerUid != parent.ownerUid {
-		t.Errorf("Child ownerUid %d != parent ownerUid %d", child.ownerUid, parent.ownerUid)
-	}
-	if child.ownerGid != parent.ownerGid {
-		t.Errorf("Child ownerGid %d != parent ownerGid %d", child.ownerGid, parent.ownerGid)
+	if child.config != parent.config {
+		t.Errorf("Child config %p != parent config %p", child.config, parent.config)
 	}
-	if child.restrictAccess != parent.restrictAccess {
-		t.Errorf("Child restrictAccess %v != parent restrictAccess %v", child.restrictAccess, parent.restrictAccess)
+	if errno := child.Access(context.Background(), 0); errno != syscall.EACCES {
+		t.Errorf("Access on the child of a restricted mount returned errno %d, want EACCES", errno)
 	}
 }
 
@@ -1725,6 +1848,94 @@ func TestFlushNotebookFallsBackToLocalExactSizeWhenStatFreshFails(t *testing.T)
 	}
 }
 
+func TestFlushExistingNotebookTrustsLocalState(t *testing.T) {
+	notebookContent := []byte("print('hello')\n")
+	statFreshCalls := 0
+
+	api := &databricks.FakeWorkspaceAPI{
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			return nil
+		},
+		StatFreshFunc: func(ctx context.Context, filePath string) (fs.FileInfo, error) {
+			statFreshCalls++
+			return nil, fs.ErrPermission
+		},
+	}
+
+	oldModifiedAt := time.Now().Add(-time.Hour).UnixMilli()
+	n := &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			Path:       "/test/notebook",
+			ObjectType: workspace.ObjectTypeNotebook,
+			Language:   workspace.LanguagePython,
+			ObjectId:   42,
+			Size:       1,
+			ModifiedAt: oldModifiedAt,
+		}},
+		buf: fileBuffer{Data: append([]byte(nil), notebookContent...), Dirty: true},
+	}
+
+	if errno := n.flushLocked(context.Background()); errno != 0 {
+		t.Fatalf("flushLocked failed: %d", errno)
+	}
+	if statFreshCalls != 0 {
+		t.Fatalf("expected no StatFresh for an existing notebook, got %d calls", statFreshCalls)
+	}
+	if n.fileInfo.Size() != int64(len(notebookContent)) || !n.fileInfo.NotebookSizeComputed {
+		t.Fatalf("expected exact size %d after flush, got %d", len(notebookContent), n.fileInfo.Size())
+	}
+	if n.fileInfo.ModifiedAt <= oldModifiedAt || !n.modifiedAtIsLocal {
+		t.Fatal("expected a local modification time until the next revalidation")
+	}
+}
+
+func TestFlushJupyterIntoNotebookRereadsSource(t *testing.T) {
+	jupyter := []byte(`{"cells": [], "metadata": {}, "nbformat": 4, "nbformat_minor": 0}`)
+	statFreshCalls := 0
+
+	api := &databricks.FakeWorkspaceAPI{
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			return nil
+		},
+		StatFreshFunc: func(ctx context.Context, filePath string) (fs.FileInfo, error) {
+			statFreshCalls++
+			return databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+				Path:       "/test/notebook",
+				ObjectType: workspace.ObjectTypeNotebook,
+				Language:   workspace.LanguageSql,
+				ObjectId:   42,
+				ModifiedAt: time.Now().UnixMilli(),
+			}}, nil
+		},
+	}
+
+	n := &WSNode{
+		wfClient: api,
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			Path:       "/test/notebook",
+			ObjectType: workspace.ObjectTypeNotebook,
+			Language:   workspace.LanguagePython,
+			ObjectId:   42,
+			ModifiedAt: time.Now().Add(-time.Hour).UnixMilli(),
+		}},
+		buf: fileBuffer{Data: append([]byte(nil), jupyter...), Dirty: true},
+	}
+
+	if errno := n.flushLocked(context.Background()); errno != 0 {
+		t.Fatalf("flushLocked failed: %d", errno)
+	}
+	if statFreshCalls != 1 {
+		t.Fatalf("expected one StatFresh after a Jupyter import, got %d", statFreshCalls)
+	}
+	if n.fileInfo.Language != workspace.LanguageSql || n.fileInfo.NotebookSizeComputed {
+		t.Fatalf("expected the imported notebook's metadata without an exact size, got %+v", n.fileInfo)
+	}
+	if n.buf.Data != nil || n.isDirtyLocked() {
+		t.Fatal("expected the clean buffer to be dropped so reads export the notebook")
+	}
+}
+
 func TestReadFallsBackToRemoteWhenCacheFileMissing(t *testing.T) {
 	api := &databricks.FakeWorkspaceAPI{
 		ReadAllFunc: func(ctx context.Context, filePath string) ([]byte, error) {
@@ -1999,6 +2210,97 @@ func TestReaddirFallsBackToIpynbOnCollision(t *testing.T) {
 	}
 }
 
+func TestReaddirNotebookAliases(t *testing.T) {
+	api := &databricks.FakeWorkspaceAPI{
+		ReadDirFunc: func(ctx context.Context, dirPath string) ([]fs.DirEntry, error) {
+			return []fs.DirEntry{
+				databricks.WSDirEntry{WSFileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+					Path:       "/test/notebook1",
+					ObjectType: workspace.ObjectTypeNotebook,
+					Language:   workspace.LanguagePython,
+				}}},
+				databricks.WSDirEntry{WSFileInfo: databricks.NewTestFileInfo("/test/file.txt", 1, false)},
+			}, nil
+		},
+	}
+	tests := []struct {
+		aliases pathutil.NotebookAliases
+		want    []string
+	}{
+		{pathutil.NotebookAliasesSuffixOnly, []string{"file.txt", "notebook1.py"}},
+		{pathutil.NotebookAliasesBoth, []string{"file.txt", "notebook1", "notebook1.py"}},
+		{pathutil.NotebookAliasesNone, []string{"file.txt", "notebook1"}},
+	}
+	for _, tt := range tests {
+		n := &WSNode{
+			wfClient: api,
+			fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+				ObjectType: workspace.ObjectTypeDirectory,
+				Path:       "/test",
+			}},
+			config: &NodeConfig{NotebookAliases: tt.aliases},
+		}
+		if got := readdirNames(t, n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: listing = %q, want %q", tt.aliases, got, tt.want)
+		}
+	}
+}
+
+func TestLookupNotebookWorkspaceName(t *testing.T) {
+	notebook := databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+		Path:       "/notebook1",
+		ObjectType: workspace.ObjectTypeNotebook,
+		Language:   workspace.LanguagePython,
+		ObjectId:   7,
+	}, NotebookSizeComputed: true}
+	api := &databricks.FakeWorkspaceAPI{
+		StatFunc: func(ctx context.Context, filePath string) (fs.FileInfo, error) {
+			// Like the workspace client, both names resolve to the notebook.
+			if filePath == "/notebook1" || filePath == "/notebook1.py" {
+				return notebook, nil
+			}
+			return nil, fs.ErrNotExist
+		},
+	}
+	ctx := context.Background()
+
+	root := newTestRootNode(t, api)
+	if _, errno := root.Lookup(ctx, "notebook1", &fuse.EntryOut{}); errno != syscall.ENOENT {
+		t.Fatalf("suffix-only: Lookup of the workspace name errno %d, want ENOENT", errno)
+	}
+	if _, errno := root.Lookup(ctx, "notebook1.py", &fuse.EntryOut{}); errno != 0 {
+		t.Fatalf("suffix-only: Lookup of the source name errno %d", errno)
+	}
+
+	root = newTestRootNode(t, api)
+	root.config.NotebookAliases = pathutil.NotebookAliasesBoth
+	bare, errno := root.Lookup(ctx, "notebook1", &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("both: Lookup of the workspace name errno %d", errno)
+	}
+	suffixed, errno := root.Lookup(ctx, "notebook1.py", &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("both: Lookup of the source name errno %d", errno)
+	}
+	if bare.StableAttr().Ino != suffixed.StableAttr().Ino {
+		t.Fatalf("both names have inodes %d and %d, want the same", bare.StableAttr().Ino, suffixed.StableAttr().Ino)
+	}
+}
+
+func TestCreateWithNotebookAliasesNoneMakesRegularFile(t *testing.T) {
+	root := newTestRootNode(t, &databricks.FakeWorkspaceAPI{})
+	root.config.NotebookAliases = pathutil.NotebookAliasesNone
+
+	child, _, _, errno := root.Create(context.Background(), "script.py", 0, 0o644, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Create errno %d", errno)
+	}
+	node := child.Operations().(*WSNode)
+	if node.fileInfo.IsNotebook() || node.Path() != "/script.py" || len(node.buf.Data) != 0 {
+		t.Fatalf("created %s at %q with %q, want an empty regular file at /script.py", node.fileInfo.ObjectType, node.Path(), node.buf.Data)
+	}
+}
+
 func TestValidateChildPath(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -2292,3 +2594,28 @@ func TestReadUsesWarmDiskCacheWithoutRemoteRead(t *testing.T) {
 		t.Fatalf("expected no Stat calls within metadata TTL, got %d", statCalls)
 	}
 }
+
+func TestWSNodeStatfsUsesConfiguredTotals(t *testing.T) {
+	root := &WSNode{
+		fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+			ObjectType: workspace.ObjectTypeDirectory,
+			Path:       "/",
+		}},
+	}
+	root.config = &NodeConfig{StatfsTotalBytes: 100 << 30, StatfsTotalFiles: 5000}
+	child := root.newChildNode(databricks.NewTestFileInfo("/child", 0, true))
+
+	out := &fuse.StatfsOut{}
+	if errno := child.Statfs(context.Background(), out); errno != 0 {
+		t.Fatalf("Statfs returned errno: %d", errno)
+	}
+	if got := out.Blocks * uint64(out.Bsize); got != 100<<30 {
+		t.Fatalf("expected 100GiB capacity, got %d bytes", got)
+	}
+	if out.Bfree != out.Blocks || out.Bavail != out.Blocks {
+		t.Fatalf("expected free blocks to equal total, got %+v", out)
+	}
+	if out.Files != 5000 || out.Ffree != 5000 {
+		t.Fatalf("expected 5000 inodes, got files=%d ffree=%d", out.Files, out.Ffree)
+	}
+}
@@ -0,0 +1,69 @@
+package fuse
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"syscall"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/logging"
+)
+
+// objectInfoFileName is the read-only file NodeConfig.ObjectInfoFiles adds
+// to every directory. Like the control directory it is hidden from
+// listings and shadows a workspace entry of the same name.
+const objectInfoFileName = ".wsfs-objectinfo.json"
+
+func (n *WSNode) isObjectInfoName(name string) bool {
+	return n.cfg().ObjectInfoFiles && name == objectInfoFileName
+}
+
+func (n *WSNode) lookupObjectInfoFile(ctx context.Context, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	file := &controlFile{generate: n.renderObjectInfo, ownerUid: n.cfg().OwnerUid, ownerGid: n.cfg().OwnerGid}
+	file.fillAttr(&out.Attr)
+	// The listing changes with the directory, so never let the kernel
+	// cache the entry.
+	out.SetEntryTimeout(0)
+	out.SetAttrTimeout(0)
+
+	if existing := n.GetChild(objectInfoFileName); existing != nil {
+		return existing, 0
+	}
+	return n.NewPersistentInode(ctx, file, fs.StableAttr{Mode: syscall.S_IFREG, Ino: hashStringToIno("wsfs-objectinfo:" + n.Path())}), 0
+}
+
+// renderObjectInfo returns the workspace ObjectInfo of every child of the
+// directory as an indented JSON array sorted by path, so scripts get IDs,
+// languages and timestamps of a whole directory in one read. Hidden names
+// are left out. A failed listing yields an empty file and a log line.
+func (n *WSNode) renderObjectInfo() []byte {
+	ctx, cancel := context.WithTimeout(context.Background(), dirListTimeout)
+	defer cancel()
+	entries, err := n.wfClient.ReadDir(ctx, n.Path())
+	if err != nil {
+		logging.Warnf("Listing %s for %s failed: %v", n.Path(), objectInfoFileName, err)
+		return nil
+	}
+
+	objects := make([]workspace.ObjectInfo, 0, len(entries))
+	for _, entry := range entries {
+		wsEntry, ok := entry.(databricks.WSDirEntry)
+		if !ok || n.isHiddenName(entry.Name()) {
+			continue
+		}
+		objects = append(objects, wsEntry.ObjectInfo)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Path < objects[j].Path })
+
+	data, err := json.MarshalIndent(objects, "", "  ")
+	if err != nil {
+		logging.Warnf("Encoding %s of %s failed: %v", objectInfoFileName, n.Path(), err)
+		return nil
+	}
+	return append(data, '\n')
+}
@@ -0,0 +1,58 @@
+package fuse
+
+import (
+	"context"
+	"encoding/json"
+	"syscall"
+	"testing"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestObjectInfoFileListsChildren(t *testing.T) {
+	root, _ := newNameFixture(t, map[string]string{"b.txt": "bb", "a.py": "a", ".DS_Store": "x"}, &NodeConfig{
+		ObjectInfoFiles: true,
+		HidePatterns:    []string{".DS_Store"},
+	})
+	ctx := context.Background()
+
+	var out fuse.EntryOut
+	inode, errno := root.Lookup(ctx, objectInfoFileName, &out)
+	if errno != 0 {
+		t.Fatalf("Lookup errno %d", errno)
+	}
+	if out.Mode != syscall.S_IFREG|0444 || out.EntryTimeout() != 0 {
+		t.Fatalf("entry mode %o, timeout %s", out.Mode, out.EntryTimeout())
+	}
+	file := inode.Operations().(*controlFile)
+	fh, _, errno := file.Open(ctx, 0)
+	if errno != 0 {
+		t.Fatalf("Open errno %d", errno)
+	}
+	var objects []workspace.ObjectInfo
+	if err := json.Unmarshal(fh.(*controlHandle).data, &objects); err != nil {
+		t.Fatalf("content is not JSON: %v", err)
+	}
+	if len(objects) != 2 || objects[0].Path != "/a.py" || objects[1].Path != "/b.txt" || objects[1].Size != 2 {
+		t.Fatalf("objects = %+v, want a.py and b.txt", objects)
+	}
+	if _, _, errno := file.Open(ctx, syscall.O_WRONLY); errno != syscall.EACCES {
+		t.Fatalf("write open errno %d, want EACCES", errno)
+	}
+	if _, _, _, errno := root.Create(ctx, objectInfoFileName, 0, 0o644, &fuse.EntryOut{}); errno != syscall.EPERM {
+		t.Fatalf("Create errno %d, want EPERM", errno)
+	}
+	for _, name := range readdirNames(t, root) {
+		if name == objectInfoFileName {
+			t.Fatal("object info file is listed")
+		}
+	}
+}
+
+func TestObjectInfoFileOffByDefault(t *testing.T) {
+	root, _ := newNameFixture(t, nil, nil)
+	if _, errno := root.Lookup(context.Background(), objectInfoFileName, &fuse.EntryOut{}); errno != syscall.ENOENT {
+		t.Fatalf("Lookup errno %d, want ENOENT", errno)
+	}
+}
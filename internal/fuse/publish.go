@@ -0,0 +1,29 @@
+package fuse
+
+import (
+	"path"
+
+	"wsfs/internal/events"
+)
+
+// mountPath returns the path of the child name below this directory node,
+// relative to the mount root, using the names the kernel looked up.
+func (n *WSNode) mountPath(name string) string {
+	return "/" + path.Join(n.EmbeddedInode().Path(nil), name)
+}
+
+// publishChild reports a change to the child name of this directory node.
+func (n *WSNode) publishChild(op events.Op, name string, isDir bool) {
+	if n.cfg().Events == nil {
+		return
+	}
+	n.cfg().Events.Publish(events.Event{Op: op, Path: n.mountPath(name), Dir: isDir})
+}
+
+// publishWriteLocked reports that this file's content was uploaded.
+func (n *WSNode) publishWriteLocked() {
+	if n.cfg().Events == nil {
+		return
+	}
+	n.cfg().Events.Publish(events.Event{Op: events.OpWrite, Path: n.mountPath("")})
+}
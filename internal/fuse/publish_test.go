@@ -0,0 +1,98 @@
+package fuse
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/events"
+)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (r *eventRecorder) Send(e events.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *eventRecorder) Close() error { return nil }
+
+// publishEvents attaches an event bus to the fixture. The returned function
+// closes the bus and returns the delivered events with times cleared.
+func (f *manageFixture) publishEvents() func() []events.Event {
+	recorder := &eventRecorder{}
+	bus := events.NewBus(recorder)
+	f.root.config.Events = bus
+	return func() []events.Event {
+		bus.Close()
+		for i := range recorder.events {
+			recorder.events[i].Time = time.Time{}
+		}
+		return recorder.events
+	}
+}
+
+func TestMutationsPublishEvents(t *testing.T) {
+	f := newManageFixture(t)
+	collect := f.publishEvents()
+	ctx := context.Background()
+
+	src := f.lookup("src")
+	if _, _, _, errno := src.Create(ctx, "new.txt", 0, 0o644, &fuse.EntryOut{}); errno != 0 {
+		t.Fatalf("Create errno %d", errno)
+	}
+	mainNode := f.lookup("src", "main.py")
+	f.write(mainNode, "print('edited')\n")
+	if _, errs := f.root.FlushPaths(ctx, []string{"/src/main.py"}); len(errs) != 0 {
+		t.Fatalf("FlushPaths: %v", errs)
+	}
+	if errno := src.Rename(ctx, "main.py", f.root, "app.py", 0); errno != 0 {
+		t.Fatalf("Rename errno %d", errno)
+	}
+	if _, errno := f.root.Mkdir(ctx, "build", 0o755, &fuse.EntryOut{}); errno != 0 {
+		t.Fatalf("Mkdir errno %d", errno)
+	}
+	if errno := f.root.Rmdir(ctx, "build"); errno != 0 {
+		t.Fatalf("Rmdir errno %d", errno)
+	}
+	if errno := f.root.Unlink(ctx, "top-level.txt"); errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	if _, err := f.root.RemoveAll(ctx, "/docs"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+
+	want := []events.Event{
+		{Op: events.OpCreate, Path: "/src/new.txt"},
+		{Op: events.OpWrite, Path: "/src/main.py"},
+		{Op: events.OpRename, Path: "/app.py", OldPath: "/src/main.py"},
+		{Op: events.OpCreate, Path: "/build", Dir: true},
+		{Op: events.OpDelete, Path: "/build", Dir: true},
+		{Op: events.OpDelete, Path: "/top-level.txt"},
+		{Op: events.OpDelete, Path: "/docs", Dir: true},
+	}
+	if got := collect(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestFailedMutationPublishesNothing(t *testing.T) {
+	f := newManageFixture(t)
+	collect := f.publishEvents()
+
+	if errno := f.root.Unlink(context.Background(), "missing.txt"); errno == 0 {
+		t.Fatal("expected Unlink of a missing file to fail")
+	}
+	if got := collect(); len(got) != 0 {
+		t.Fatalf("events = %+v, want none", got)
+	}
+}
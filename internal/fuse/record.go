@@ -0,0 +1,149 @@
+package fuse
+
+import (
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/record"
+)
+
+// RecordRequests wraps the raw file system of a mount to append every
+// request the kernel sends to a session trace, with the node it targets,
+// the name it carries, offsets and sizes, its timing and its status. It
+// covers the requests CountRequests counts. A nil rec returns raw itself.
+func RecordRequests(raw fuse.RawFileSystem, rec *record.Recorder) fuse.RawFileSystem {
+	if rec == nil {
+		return raw
+	}
+	return &recordingFS{RawFileSystem: raw, rec: rec}
+}
+
+type recordingFS struct {
+	fuse.RawFileSystem
+	rec *record.Recorder
+}
+
+func (r *recordingFS) begin(op string, node uint64, name string) *record.Call {
+	return r.rec.Begin(record.Entry{Kind: record.KindFuse, Op: op, Node: node, Path: name})
+}
+
+func (r *recordingFS) beginIO(op string, node uint64, offset uint64, size uint32) *record.Call {
+	return r.rec.Begin(record.Entry{Kind: record.KindFuse, Op: op, Node: node, Offset: int64(offset), Size: int64(size)})
+}
+
+func endRequest(call *record.Call, status fuse.Status) fuse.Status {
+	e := call.Entry()
+	if !status.Ok() {
+		e.Status = int32(status)
+		e.Error = status.String()
+	}
+	call.End(e)
+	return status
+}
+
+func (r *recordingFS) Lookup(cancel <-chan struct{}, header *fuse.InHeader, name string, out *fuse.EntryOut) fuse.Status {
+	call := r.begin("lookup", header.NodeId, name)
+	return endRequest(call, r.RawFileSystem.Lookup(cancel, header, name, out))
+}
+
+func (r *recordingFS) GetAttr(cancel <-chan struct{}, input *fuse.GetAttrIn, out *fuse.AttrOut) fuse.Status {
+	call := r.begin("getattr", input.NodeId, "")
+	return endRequest(call, r.RawFileSystem.GetAttr(cancel, input, out))
+}
+
+func (r *recordingFS) SetAttr(cancel <-chan struct{}, input *fuse.SetAttrIn, out *fuse.AttrOut) fuse.Status {
+	e := record.Entry{Kind: record.KindFuse, Op: "setattr", Node: input.NodeId}
+	if size, ok := input.GetSize(); ok {
+		e.Size = int64(size) // a truncate
+	}
+	call := r.rec.Begin(e)
+	return endRequest(call, r.RawFileSystem.SetAttr(cancel, input, out))
+}
+
+func (r *recordingFS) Mkdir(cancel <-chan struct{}, input *fuse.MkdirIn, name string, out *fuse.EntryOut) fuse.Status {
+	call := r.begin("mkdir", input.NodeId, name)
+	return endRequest(call, r.RawFileSystem.Mkdir(cancel, input, name, out))
+}
+
+func (r *recordingFS) Unlink(cancel <-chan struct{}, header *fuse.InHeader, name string) fuse.Status {
+	call := r.begin("unlink", header.NodeId, name)
+	return endRequest(call, r.RawFileSystem.Unlink(cancel, header, name))
+}
+
+func (r *recordingFS) Rmdir(cancel <-chan struct{}, header *fuse.InHeader, name string) fuse.Status {
+	call := r.begin("rmdir", header.NodeId, name)
+	return endRequest(call, r.RawFileSystem.Rmdir(cancel, header, name))
+}
+
+func (r *recordingFS) Rename(cancel <-chan struct{}, input *fuse.RenameIn, oldName string, newName string) fuse.Status {
+	call := r.rec.Begin(record.Entry{Kind: record.KindFuse, Op: "rename", Node: input.NodeId, Path: oldName, Target: newName})
+	return endRequest(call, r.RawFileSystem.Rename(cancel, input, oldName, newName))
+}
+
+func (r *recordingFS) Access(cancel <-chan struct{}, input *fuse.AccessIn) fuse.Status {
+	call := r.begin("access", input.NodeId, "")
+	return endRequest(call, r.RawFileSystem.Access(cancel, input))
+}
+
+func (r *recordingFS) GetXAttr(cancel <-chan struct{}, header *fuse.InHeader, attr string, dest []byte) (uint32, fuse.Status) {
+	call := r.begin("getxattr", header.NodeId, attr)
+	size, status := r.RawFileSystem.GetXAttr(cancel, header, attr, dest)
+	return size, endRequest(call, status)
+}
+
+func (r *recordingFS) Create(cancel <-chan struct{}, input *fuse.CreateIn, name string, out *fuse.CreateOut) fuse.Status {
+	call := r.begin("create", input.NodeId, name)
+	return endRequest(call, r.RawFileSystem.Create(cancel, input, name, out))
+}
+
+func (r *recordingFS) Open(cancel <-chan struct{}, input *fuse.OpenIn, out *fuse.OpenOut) fuse.Status {
+	call := r.begin("open", input.NodeId, "")
+	return endRequest(call, r.RawFileSystem.Open(cancel, input, out))
+}
+
+func (r *recordingFS) Read(cancel <-chan struct{}, input *fuse.ReadIn, buf []byte) (fuse.ReadResult, fuse.Status) {
+	call := r.beginIO("read", input.NodeId, input.Offset, input.Size)
+	result, status := r.RawFileSystem.Read(cancel, input, buf)
+	return result, endRequest(call, status)
+}
+
+func (r *recordingFS) Release(cancel <-chan struct{}, input *fuse.ReleaseIn) {
+	call := r.begin("release", input.NodeId, "")
+	r.RawFileSystem.Release(cancel, input)
+	endRequest(call, fuse.OK)
+}
+
+func (r *recordingFS) Write(cancel <-chan struct{}, input *fuse.WriteIn, data []byte) (uint32, fuse.Status) {
+	call := r.beginIO("write", input.NodeId, input.Offset, input.Size)
+	written, status := r.RawFileSystem.Write(cancel, input, data)
+	return written, endRequest(call, status)
+}
+
+func (r *recordingFS) Flush(cancel <-chan struct{}, input *fuse.FlushIn) fuse.Status {
+	call := r.begin("flush", input.NodeId, "")
+	return endRequest(call, r.RawFileSystem.Flush(cancel, input))
+}
+
+func (r *recordingFS) Fsync(cancel <-chan struct{}, input *fuse.FsyncIn) fuse.Status {
+	call := r.begin("fsync", input.NodeId, "")
+	return endRequest(call, r.RawFileSystem.Fsync(cancel, input))
+}
+
+func (r *recordingFS) OpenDir(cancel <-chan struct{}, input *fuse.OpenIn, out *fuse.OpenOut) fuse.Status {
+	call := r.begin("opendir", input.NodeId, "")
+	return endRequest(call, r.RawFileSystem.OpenDir(cancel, input, out))
+}
+
+func (r *recordingFS) ReadDir(cancel <-chan struct{}, input *fuse.ReadIn, out *fuse.DirEntryList) fuse.Status {
+	call := r.beginIO("readdir", input.NodeId, input.Offset, 0)
+	return endRequest(call, r.RawFileSystem.ReadDir(cancel, input, out))
+}
+
+func (r *recordingFS) ReadDirPlus(cancel <-chan struct{}, input *fuse.ReadIn, out *fuse.DirEntryList) fuse.Status {
+	call := r.beginIO("readdirplus", input.NodeId, input.Offset, 0)
+	return endRequest(call, r.RawFileSystem.ReadDirPlus(cancel, input, out))
+}
+
+func (r *recordingFS) StatFs(cancel <-chan struct{}, input *fuse.InHeader, out *fuse.StatfsOut) fuse.Status {
+	call := r.begin("statfs", input.NodeId, "")
+	return endRequest(call, r.RawFileSystem.StatFs(cancel, input, out))
+}
@@ -0,0 +1,42 @@
+package fuse
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/record"
+)
+
+func TestRecordRequests(t *testing.T) {
+	var trace bytes.Buffer
+	rec := record.New(&trace)
+	raw := RecordRequests(fuse.NewDefaultRawFileSystem(), rec)
+
+	raw.Lookup(nil, &fuse.InHeader{NodeId: 1}, "notes.txt", &fuse.EntryOut{})
+	in := &fuse.WriteIn{Offset: 4096, Size: 10}
+	in.NodeId = 5
+	raw.Write(nil, in, make([]byte, 10))
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := record.Read(&trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v, want 2", entries)
+	}
+	lookup, write := entries[0], entries[1]
+	if lookup.Kind != record.KindFuse || lookup.Op != "lookup" || lookup.Node != 1 || lookup.Path != "notes.txt" || lookup.Status != int32(fuse.ENOSYS) {
+		t.Fatalf("lookup = %+v", lookup)
+	}
+	if write.Op != "write" || write.Node != 5 || write.Offset != 4096 || write.Size != 10 {
+		t.Fatalf("write = %+v", write)
+	}
+	if RecordRequests(raw, nil) != raw {
+		t.Fatal("a nil recorder must return the file system itself")
+	}
+}
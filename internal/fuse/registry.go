@@ -3,80 +3,185 @@ package fuse
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"wsfs/internal/logging"
 )
 
-// DirtyNodeRegistry tracks WSNode instances with dirty buffers.
-// It is used during graceful shutdown to flush all dirty buffers
-// before unmounting the filesystem.
+// DirtyNodeRegistry tracks WSNode instances with dirty buffers and when
+// each became dirty. It is used during graceful shutdown to flush all dirty
+// buffers before unmounting the filesystem, and to show users what is not
+// uploaded yet. It also retries failed flushes in the background, see
+// StartFlushRetries.
 type DirtyNodeRegistry struct {
-	nodes map[*WSNode]struct{}
+	nodes map[*WSNode]time.Time
 	mu    sync.RWMutex
+
+	retryCtx    context.Context
+	retryConfig FlushRetryConfig
+	retries     map[*WSNode]*flushRetry
+}
+
+// DirtyEntry describes a file with unflushed changes.
+type DirtyEntry struct {
+	Path  string    `json:"path"`
+	Since time.Time `json:"since"` // when the buffer became dirty
+	Size  int64     `json:"size"`
+	// Error is the message of the file's last failed backend operation,
+	// usually its upload, if any.
+	Error string `json:"error,omitempty"`
 }
 
 // NewDirtyNodeRegistry creates a new registry.
 func NewDirtyNodeRegistry() *DirtyNodeRegistry {
 	return &DirtyNodeRegistry{
-		nodes: make(map[*WSNode]struct{}),
+		nodes:   make(map[*WSNode]time.Time),
+		retries: make(map[*WSNode]*flushRetry),
 	}
 }
 
 // Register adds a node to the registry.
-// This should be called when a node's buffer becomes dirty.
+// This should be called when a node's buffer becomes dirty. Registering a
+// node that is already dirty keeps its original time.
 func (r *DirtyNodeRegistry) Register(node *WSNode) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.nodes[node] = struct{}{}
+	if _, ok := r.nodes[node]; !ok {
+		r.nodes[node] = time.Now()
+	}
 }
 
 // Unregister removes a node from the registry.
-// This should be called after a node's buffer has been flushed.
+// This should be called after a node's buffer has been flushed. It also
+// cancels pending retries of the node's flush.
 func (r *DirtyNodeRegistry) Unregister(node *WSNode) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	delete(r.nodes, node)
+	r.cancelRetryLocked(node)
 }
 
+// flushWorkers bounds the uploads a flush of the registry runs at once.
+// Running them concurrently under the caller's deadline keeps one slow
+// upload from using up a shutdown budget the other files needed.
+const flushWorkers = 8
+
 // FlushAll flushes all dirty nodes.
-// Returns the number of nodes flushed and any errors encountered.
+// Returns the number of nodes flushed and any errors encountered. Each error
+// names a file that was not flushed, including files the context's deadline
+// left no time for.
 func (r *DirtyNodeRegistry) FlushAll(ctx context.Context) (int, []error) {
+	return r.flushMatching(ctx, nil)
+}
+
+// flushMatching flushes the dirty nodes whose path satisfies match, or all
+// dirty nodes when match is nil. Up to flushWorkers nodes are uploaded
+// concurrently, the oldest changes first.
+func (r *DirtyNodeRegistry) flushMatching(ctx context.Context, match func(path string) bool) (int, []error) {
 	r.mu.RLock()
 	// Copy nodes to avoid holding lock during flush
 	nodes := make([]*WSNode, 0, len(r.nodes))
-	for node := range r.nodes {
+	since := make(map[*WSNode]time.Time, len(r.nodes))
+	for node, t := range r.nodes {
 		nodes = append(nodes, node)
+		since[node] = t
 	}
 	r.mu.RUnlock()
+	sort.Slice(nodes, func(i, j int) bool { return since[nodes[i]].Before(since[nodes[j]]) })
+
+	results := make([]error, len(nodes))
+	var flushed atomic.Int32
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, flushWorkers)
+	for i, node := range nodes {
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+			ok, err := flushRegistered(ctx, node, match)
+			if ok {
+				flushed.Add(1)
+			}
+			results[i] = err
+		}()
+	}
+	wg.Wait()
 
 	var errors []error
-	flushed := 0
-
-	for _, node := range nodes {
-		// Check context cancellation
-		select {
-		case <-ctx.Done():
-			errors = append(errors, fmt.Errorf("context cancelled during flush"))
-			return flushed, errors
-		default:
+	for _, err := range results {
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
+	return int(flushed.Load()), errors
+}
+
+// flushRegistered flushes one node for flushMatching and reports whether it
+// uploaded the node. A node reached after ctx is done is reported as not
+// flushed without an upload attempt.
+func flushRegistered(ctx context.Context, node *WSNode, match func(path string) bool) (bool, error) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if match != nil && !match(node.Path()) {
+		return false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("flush %s: not started: %w", node.Path(), err)
+	}
+	if !node.isDirtyLocked() {
+		return false, nil
+	}
+	logging.Debugf("Flushing dirty buffer for: %s", node.Path())
+	if errno := node.writeBackLocked(ctx); errno != 0 {
+		if err := ctx.Err(); err != nil {
+			return false, fmt.Errorf("flush %s: %w", node.Path(), err)
 		}
+		return false, fmt.Errorf("flush %s: errno %d", node.Path(), errno)
+	}
+	return true, nil
+}
+
+// DirtySince returns when node became dirty, if it is registered.
+func (r *DirtyNodeRegistry) DirtySince(node *WSNode) (time.Time, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	since, ok := r.nodes[node]
+	return since, ok
+}
 
-		logging.Debugf("Flushing dirty buffer for: %s", node.Path())
+// Entries returns the dirty files, oldest first.
+func (r *DirtyNodeRegistry) Entries() []DirtyEntry {
+	r.mu.RLock()
+	snapshot := make(map[*WSNode]time.Time, len(r.nodes))
+	for node, since := range r.nodes {
+		snapshot[node] = since
+	}
+	r.mu.RUnlock()
 
+	entries := make([]DirtyEntry, 0, len(snapshot))
+	for node, since := range snapshot {
 		node.mu.Lock()
 		if node.isDirtyLocked() {
-			errno := node.flushLocked(ctx)
-			if errno != 0 {
-				errors = append(errors, fmt.Errorf("flush %s: errno %d", node.Path(), errno))
-			} else {
-				flushed++
+			entry := DirtyEntry{Path: node.Path(), Since: since, Size: node.bufferedSizeLocked()}
+			if node.lastError != nil {
+				entry.Error = node.lastError.Err
 			}
+			entries = append(entries, entry)
 		}
 		node.mu.Unlock()
 	}
-
-	return flushed, errors
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Since.Equal(entries[j].Since) {
+			return entries[i].Since.Before(entries[j].Since)
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
 }
 
 // Count returns the number of dirty nodes.
@@ -85,3 +190,18 @@ func (r *DirtyNodeRegistry) Count() int {
 	defer r.mu.RUnlock()
 	return len(r.nodes)
 }
+
+// render lists one "path<TAB>dirty since<TAB>age<TAB>size" line per
+// file with unflushed changes, oldest first.
+func (r *DirtyNodeRegistry) render() []byte {
+	var b strings.Builder
+	now := time.Now()
+	for _, entry := range r.Entries() {
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%d bytes\n",
+			entry.Path, entry.Since.UTC().Format(time.RFC3339), now.Sub(entry.Since).Round(time.Second), entry.Size)
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	return []byte(b.String())
+}
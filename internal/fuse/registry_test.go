@@ -3,7 +3,9 @@ package fuse
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/databricks/databricks-sdk-go/service/workspace"
 
@@ -136,3 +138,117 @@ func TestDirtyNodeRegistry_FlushAll_Errors(t *testing.T) {
 		t.Fatalf("Expected 1 error, got %d", len(errs))
 	}
 }
+
+func TestDirtyNodeRegistryEntriesOldestFirst(t *testing.T) {
+	registry := NewDirtyNodeRegistry()
+	older := &WSNode{dirtyFlags: dirtyData}
+	older.fileInfo.Path = "/b.txt"
+	older.buf.Data = []byte("abc")
+	newer := &WSNode{dirtyFlags: dirtyData}
+	newer.fileInfo.Path = "/a.txt"
+	clean := &WSNode{}
+	clean.fileInfo.Path = "/clean.txt"
+
+	registry.Register(older)
+	time.Sleep(2 * time.Millisecond)
+	registry.Register(newer)
+	registry.Register(clean)
+	since, ok := registry.DirtySince(older)
+	if !ok {
+		t.Fatal("expected a dirty time for a registered node")
+	}
+	registry.Register(older)
+	if again, _ := registry.DirtySince(older); !again.Equal(since) {
+		t.Fatalf("re-registering moved the dirty time from %v to %v", since, again)
+	}
+
+	entries := registry.Entries()
+	if len(entries) != 2 || entries[0].Path != "/b.txt" || entries[0].Size != 3 || entries[1].Path != "/a.txt" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	registry.Unregister(older)
+	if _, ok := registry.DirtySince(older); ok {
+		t.Fatal("expected no dirty time after Unregister")
+	}
+}
+
+func TestDirtyNodeRegistryFlushAllSlowUploadDoesNotStarveOthers(t *testing.T) {
+	registry := NewDirtyNodeRegistry()
+	api := &databricks.FakeWorkspaceAPI{
+		WriteFunc: func(ctx context.Context, filepath string, data []byte) error {
+			if filepath == "/slow.txt" {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		},
+	}
+	newDirty := func(path string) *WSNode {
+		node := &WSNode{
+			wfClient: api,
+			registry: registry,
+			fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+				ObjectType: workspace.ObjectTypeFile,
+				Path:       path,
+			}},
+			buf: fileBuffer{Data: []byte("data")},
+		}
+		node.markDirtyLocked(dirtyData)
+		return node
+	}
+	// The slow file is the oldest, so a sequential flush would start with it.
+	newDirty("/slow.txt")
+	time.Sleep(2 * time.Millisecond)
+	for _, path := range []string{"/a.txt", "/b.txt", "/c.txt"} {
+		newDirty(path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	flushed, errs := registry.FlushAll(ctx)
+	if flushed != 3 {
+		t.Fatalf("flushed = %d, want the 3 fast files", flushed)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "/slow.txt") || !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Fatalf("errors = %v, want the deadline for /slow.txt", errs)
+	}
+	if entries := registry.Entries(); len(entries) != 1 || entries[0].Path != "/slow.txt" {
+		t.Fatalf("still dirty = %v", entries)
+	}
+}
+
+func TestDirtyNodeRegistryFlushAllNamesFilesLeftAfterDeadline(t *testing.T) {
+	registry := NewDirtyNodeRegistry()
+	for _, path := range []string{"/a.txt", "/b.txt"} {
+		node := &WSNode{registry: registry}
+		node.fileInfo.Path = path
+		node.markDirtyLocked(dirtyData)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	flushed, errs := registry.FlushAll(ctx)
+	if flushed != 0 || len(errs) != 2 {
+		t.Fatalf("FlushAll = %d, %v", flushed, errs)
+	}
+	for i, path := range []string{"/a.txt", "/b.txt"} {
+		if !strings.Contains(errs[i].Error(), path) {
+			t.Fatalf("error %d = %v, want it to name %s", i, errs[i], path)
+		}
+	}
+}
+
+func TestDirtyNodeRegistryEntriesCarryLastError(t *testing.T) {
+	registry := NewDirtyNodeRegistry()
+	node := &WSNode{registry: registry}
+	node.fileInfo.Path = "/a.txt"
+	node.markDirtyLocked(dirtyData)
+	node.recordErrorLocked(backendOpWrite, errors.New("permission denied"))
+
+	entries := registry.Entries()
+	if len(entries) != 1 || entries[0].Error != "permission denied" {
+		t.Fatalf("entries = %+v, want the last upload error", entries)
+	}
+}
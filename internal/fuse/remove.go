@@ -0,0 +1,227 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/events"
+	"wsfs/internal/logging"
+	"wsfs/internal/pathutil"
+)
+
+// RemoveResult summarizes a RemoveAll call.
+type RemoveResult struct {
+	Deletes  int  `json:"deletes"`  // delete requests sent to the backend
+	Fallback bool `json:"fallback"` // the recursive delete failed and entries were deleted one by one
+}
+
+// RemoveAll deletes the file or directory tree at a mount-relative path.
+// `rm -r` makes the kernel send a lookup and a delete for every entry; this
+// sends one recursive delete instead. If that fails, the tree is deleted
+// entry by entry, children first. Loaded nodes under the path are detached
+// from the kernel's tree and lose their buffers, including unsaved changes,
+// as they would with `rm`.
+func (n *WSNode) RemoveAll(ctx context.Context, mountPath string) (RemoveResult, error) {
+	var result RemoveResult
+	clean := path.Clean("/" + mountPath)
+	if clean == "/" {
+		return result, fmt.Errorf("refusing to remove the mount root: %w", syscall.EPERM)
+	}
+	names := strings.Split(strings.TrimPrefix(clean, "/"), "/")
+	if n.isControlName(names[0]) {
+		return result, fmt.Errorf("%s is read-only: %w", clean, syscall.EPERM)
+	}
+
+	remotePath := n.RemotePath(clean)
+	info, err := n.wfClient.Stat(ctx, remotePath)
+	if err != nil {
+		return result, err
+	}
+	wsInfo, ok := info.(databricks.WSFileInfo)
+	if !ok {
+		return result, fmt.Errorf("unexpected file info type for %s", remotePath)
+	}
+
+	if wsInfo.IsDir() {
+		err = n.removeDirectory(ctx, wsInfo.Path, &result)
+	} else {
+		result.Deletes++
+		err = n.wfClient.Delete(ctx, wsInfo.Path, false)
+	}
+
+	// Even a partial fallback removed entries, so always drop local state.
+	n.forgetRemoved(names, remotePath, wsInfo.Path)
+	if err != nil {
+		return result, fmt.Errorf("remove %s: %w", clean, err)
+	}
+	if n.cfg().Events != nil {
+		n.cfg().Events.Publish(events.Event{Op: events.OpDelete, Path: clean, Dir: wsInfo.IsDir()})
+	}
+	logging.Infof("Removed %s with %d delete request(s)", remotePath, result.Deletes)
+	return result, nil
+}
+
+func (n *WSNode) removeDirectory(ctx context.Context, dirPath string, result *RemoveResult) error {
+	result.Deletes++
+	err := n.wfClient.Delete(ctx, dirPath, true)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	logging.Warnf("Recursive delete of %s failed, deleting entries one by one: %v", dirPath, err)
+	result.Fallback = true
+	return n.removeEntries(ctx, dirPath, result)
+}
+
+// removeEntries deletes the children of dirPath, depth first, and then
+// dirPath itself.
+func (n *WSNode) removeEntries(ctx context.Context, dirPath string, result *RemoveResult) error {
+	entries, err := n.wfClient.ReadDir(ctx, dirPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		wsInfo, ok := info.(databricks.WSFileInfo)
+		if !ok {
+			return fmt.Errorf("unexpected file info type in %s", dirPath)
+		}
+		if wsInfo.IsDir() {
+			err = n.removeEntries(ctx, wsInfo.Path, result)
+		} else {
+			result.Deletes++
+			err = n.wfClient.Delete(ctx, wsInfo.Path, false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	result.Deletes++
+	return n.wfClient.Delete(ctx, dirPath, false)
+}
+
+// forgetRemoved drops cached metadata and content under a removed path and
+// detaches its loaded inode, found by walking names from the root.
+func (n *WSNode) forgetRemoved(names []string, remotePaths ...string) {
+	for _, p := range remotePaths {
+		n.wfClient.CacheInvalidate(p)
+		n.wfClient.CacheInvalidate(path.Dir(p))
+		if n.diskCache != nil && !n.diskCache.IsDisabled() {
+			var stale []string
+			for _, cached := range n.diskCache.GetCachedPaths() {
+				if pathHasPrefix(cached, p) {
+					stale = append(stale, cached)
+				}
+			}
+			n.deleteDiskCacheEntries(stale...)
+		}
+	}
+
+	parent := n.EmbeddedInode()
+	for _, name := range names[:len(names)-1] {
+		if parent = parent.GetChild(name); parent == nil {
+			return
+		}
+	}
+	name := names[len(names)-1]
+	child := parent.GetChild(name)
+	if child == nil {
+		return
+	}
+	resetLoadedSubtree(child)
+	parent.RmChild(name)
+
+	if parentNode, ok := parent.Operations().(*WSNode); ok {
+		parentNode.mu.Lock()
+		parentNode.metadataCheckedAt = time.Time{}
+		parentNode.mu.Unlock()
+	}
+	notifyDeleted(parent, deletedNames(name), []*fs.Inode{child})
+}
+
+// resetLoadedSubtree discards the buffers of inode and its loaded
+// descendants so nothing under a removed tree is flushed back.
+func resetLoadedSubtree(inode *fs.Inode) {
+	if node, ok := inode.Operations().(*WSNode); ok {
+		node.mu.Lock()
+		node.waitFlushLocked()
+		node.resetBufferLocked()
+		node.metadataCheckedAt = time.Time{}
+		node.mu.Unlock()
+	}
+	for _, child := range inode.Children() {
+		resetLoadedSubtree(child)
+	}
+}
+
+// deletedNames returns name and the names of its notebook aliases, which
+// the kernel may have cached as entries of the same directory.
+func deletedNames(name string) []string {
+	aliases := pathutil.NotebookAliasPaths("/" + name)
+	names := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		names = append(names, path.Base(alias))
+	}
+	return names
+}
+
+// notifyDeleted tells the kernel that names are gone from parent, so their
+// cached entries stop resolving now rather than at the entry timeout. A
+// name whose inode is known, at the same index of children, is dropped
+// with NotifyDelete, which also reaches inotify watchers.
+func notifyDeleted(parent *fs.Inode, names []string, children []*fs.Inode) {
+	for i, name := range names {
+		var child *fs.Inode
+		if i < len(children) {
+			child = children[i]
+		}
+		notifyDeleteIfPossible(parent, name, child)
+	}
+}
+
+func notifyDeleteIfPossible(parent *fs.Inode, name string, child *fs.Inode) {
+	defer func() {
+		_ = recover()
+	}()
+
+	var errno syscall.Errno
+	if child != nil {
+		errno = parent.NotifyDelete(name, child)
+	} else {
+		errno = parent.NotifyEntry(name)
+	}
+	if errno != 0 && errno != syscall.ENOENT {
+		logging.Debugf("Failed to invalidate kernel entry %s: %v", name, errno)
+	}
+}
+
+// notifyDeletedLater is notifyDeleted for names removed by an Unlink or
+// Rmdir of n. The kernel keeps the directory locked until that call is
+// answered and takes the lock to apply a notification, so it is sent in the
+// background. The inodes are looked up now, before the call returns and the
+// child is detached.
+func (n *WSNode) notifyDeletedLater(name string) {
+	parent := n.EmbeddedInode()
+	names := deletedNames(name)
+	children := make([]*fs.Inode, len(names))
+	for i, alias := range names {
+		children[i] = parent.GetChild(alias)
+	}
+	go notifyDeleted(parent, names, children)
+}
@@ -0,0 +1,136 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+
+	"wsfs/internal/databricks"
+)
+
+// deleteRecorder records deletes and can refuse recursive ones, like a
+// workspace that rejects deleting a large tree in one call.
+type deleteRecorder struct {
+	databricks.WorkspaceFilesAPI
+	refuseRecursive bool
+	deletes         []string
+}
+
+func (d *deleteRecorder) Delete(ctx context.Context, filePath string, recursive bool) error {
+	if recursive && d.refuseRecursive {
+		return errors.New("recursive delete rejected")
+	}
+	d.deletes = append(d.deletes, filePath)
+	return d.WorkspaceFilesAPI.Delete(ctx, filePath, recursive)
+}
+
+func (f *manageFixture) recordDeletes(refuseRecursive bool) *deleteRecorder {
+	rec := &deleteRecorder{WorkspaceFilesAPI: f.root.wfClient, refuseRecursive: refuseRecursive}
+	f.root.wfClient = rec
+	return rec
+}
+
+func TestRemoveAllUsesOneRecursiveDelete(t *testing.T) {
+	f := newManageFixture(t)
+	rec := f.recordDeletes(false)
+	ctx := context.Background()
+	util := f.lookup("src", "lib", "util.py")
+	f.write(util, "unsaved\n")
+	if _, err := f.root.Prefetch(ctx, "/src"); err != nil {
+		t.Fatalf("Prefetch: %v", err)
+	}
+
+	result, err := f.root.RemoveAll(ctx, "/src")
+	if err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if result.Deletes != 1 || result.Fallback || len(rec.deletes) != 1 {
+		t.Fatalf("RemoveAll = %+v with deletes %v, want one recursive delete", result, rec.deletes)
+	}
+	if _, err := os.Stat(filepath.Join(f.dir, "src")); !os.IsNotExist(err) {
+		t.Fatalf("src still exists: %v", err)
+	}
+	if paths := f.cache.GetCachedPaths(); len(paths) != 0 {
+		t.Fatalf("disk cache entries left behind: %v", paths)
+	}
+	if f.root.GetChild("src") != nil {
+		t.Fatal("src inode still attached")
+	}
+
+	// The unsaved buffer is discarded, so a later flush cannot recreate it.
+	if n := f.registry.Count(); n != 0 {
+		t.Fatalf("expected no dirty files, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(f.dir, "src", "lib", "util.py")); !os.IsNotExist(err) {
+		t.Fatalf("removed file was recreated: %v", err)
+	}
+	if got := f.onDisk("top-level.txt"); got != "top\n" {
+		t.Fatalf("unrelated file changed: %q", got)
+	}
+}
+
+func TestRemoveAllFallsBackToPerEntryDeletes(t *testing.T) {
+	f := newManageFixture(t)
+	rec := f.recordDeletes(true)
+
+	result, err := f.root.RemoveAll(context.Background(), "src")
+	if err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	// main.py, lib/util.py, lib/data.csv, lib, src
+	if !result.Fallback || result.Deletes != 6 || len(rec.deletes) != 5 {
+		t.Fatalf("RemoveAll = %+v with deletes %v", result, rec.deletes)
+	}
+	if last := rec.deletes[len(rec.deletes)-1]; last != "/src" {
+		t.Fatalf("directory deleted before its children: %v", rec.deletes)
+	}
+	if _, err := os.Stat(filepath.Join(f.dir, "src")); !os.IsNotExist(err) {
+		t.Fatalf("src still exists: %v", err)
+	}
+}
+
+func TestRemoveAllSingleFile(t *testing.T) {
+	f := newManageFixture(t)
+	rec := f.recordDeletes(true)
+
+	result, err := f.root.RemoveAll(context.Background(), "/docs/README.md")
+	if err != nil || result.Deletes != 1 || result.Fallback {
+		t.Fatalf("RemoveAll = %+v, %v", result, err)
+	}
+	if len(rec.deletes) != 1 || rec.deletes[0] != "/docs/README.md" {
+		t.Fatalf("unexpected deletes %v", rec.deletes)
+	}
+}
+
+func TestRemoveAllRefusesRootControlDirAndMissingPaths(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+
+	for _, p := range []string{"", "/", "/src/..", "/.wsfs", "/.wsfs/errors"} {
+		if _, err := f.root.RemoveAll(ctx, p); !errors.Is(err, syscall.EPERM) {
+			t.Fatalf("RemoveAll(%q) = %v, want EPERM", p, err)
+		}
+	}
+	if _, err := f.root.RemoveAll(ctx, "/missing"); !os.IsNotExist(err) {
+		t.Fatalf("RemoveAll of a missing path = %v, want not-exist", err)
+	}
+	if got := f.onDisk("src/main.py"); got != "print('main')\n" {
+		t.Fatalf("refused removals changed the tree: %q", got)
+	}
+}
+
+func TestDeletedNamesCoverNotebookAliases(t *testing.T) {
+	names := deletedNames("nb.py")
+	for _, want := range []string{"nb.py", "nb", "nb.ipynb"} {
+		if !slices.Contains(names, want) {
+			t.Fatalf("deletedNames(nb.py) = %v, missing %s", names, want)
+		}
+	}
+	if names[0] != "nb.py" {
+		t.Fatalf("deletedNames(nb.py) = %v, want the name itself first", names)
+	}
+}
@@ -0,0 +1,217 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+
+	"wsfs/internal/backend"
+	"wsfs/internal/filecache"
+)
+
+func mkdirs(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", name, err)
+		}
+	}
+}
+
+func assertFileText(t *testing.T, dir, name, want string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil || string(data) != want {
+		t.Fatalf("%s = %q, %v; want %q", name, data, err, want)
+	}
+}
+
+func assertMissing(t *testing.T, dir, name string) {
+	t.Helper()
+	if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+		t.Fatalf("%s still in the workspace: %v", name, err)
+	}
+}
+
+// renameAndMove renames like the FUSE bridge does: the handler first, then
+// the inode tree.
+func renameAndMove(t *testing.T, parent *WSNode, name string, newParent *WSNode, newName string) {
+	t.Helper()
+	if errno := parent.Rename(context.Background(), name, newParent, newName, 0); errno != 0 {
+		t.Fatalf("Rename %s -> %s errno %d", name, newName, errno)
+	}
+	parent.MvChild(name, newParent.EmbeddedInode(), newName, true)
+}
+
+func TestRenameOpenDirtyFileIntoUnloadedDirectory(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{"a.txt": "old"}, nil)
+	mkdirs(t, dir, "dst/deeper")
+	ctx := context.Background()
+
+	node := openChild(t, root, "a.txt")
+	if _, errno := node.Write(ctx, nil, []byte("unsaved"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	// The destination has been looked up, but none of its children.
+	dst := lookupChild(t, lookupChild(t, root, "dst"), "deeper")
+	renameAndMove(t, root, "a.txt", dst, "b.txt")
+
+	assertFileText(t, dir, "dst/deeper/b.txt", "unsaved")
+	assertMissing(t, dir, "a.txt")
+	if node.Path() != "/dst/deeper/b.txt" {
+		t.Fatalf("node path = %s after rename", node.Path())
+	}
+	if n := root.registry.Count(); n != 0 {
+		t.Fatalf("registry holds %d dirty nodes after the rename saved them", n)
+	}
+
+	if _, errno := node.Write(ctx, nil, []byte("written after"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	entries := root.registry.Entries()
+	if len(entries) != 1 || entries[0].Path != "/dst/deeper/b.txt" {
+		t.Fatalf("dirty entries = %+v, want the new path", entries)
+	}
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	assertFileText(t, dir, "dst/deeper/b.txt", "written after")
+	assertMissing(t, dir, "a.txt")
+	if got := readNodeText(t, node); got != "written after" {
+		t.Fatalf("read %q after close", got)
+	}
+}
+
+func TestRenameDirectoryWithOpenDirtyFiles(t *testing.T) {
+	root, dir := newNameFixture(t, nil, nil)
+	mkdirs(t, dir, "src/sub", "other")
+	for name, content := range map[string]string{"src/top.txt": "top", "src/sub/deep.txt": "deep"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	ctx := context.Background()
+
+	src := lookupChild(t, root, "src")
+	top := openChild(t, src, "top.txt")
+	deep := openChild(t, lookupChild(t, src, "sub"), "deep.txt")
+	created := createAndWrite(t, src, "new.txt", "created")
+	for _, node := range []*WSNode{top, deep} {
+		if _, errno := node.Write(ctx, nil, []byte("dirty "+node.fileInfo.Name()), 0); errno != 0 {
+			t.Fatalf("Write errno %d", errno)
+		}
+	}
+	renameAndMove(t, root, "src", lookupChild(t, root, "other"), "moved")
+
+	assertMissing(t, dir, "src")
+	assertFileText(t, dir, "other/moved/top.txt", "dirty top.txt")
+	assertFileText(t, dir, "other/moved/sub/deep.txt", "dirty deep.txt")
+	assertFileText(t, dir, "other/moved/new.txt", "created")
+	for node, want := range map[*WSNode]string{top: "/other/moved/top.txt", deep: "/other/moved/sub/deep.txt", created: "/other/moved/new.txt"} {
+		if node.Path() != want {
+			t.Fatalf("node path = %s, want %s", node.Path(), want)
+		}
+	}
+	if n := root.registry.Count(); n != 0 {
+		t.Fatalf("registry holds %d dirty nodes after the rename saved them", n)
+	}
+
+	if _, errno := deep.Write(ctx, nil, []byte("written after the rename"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	entries := root.registry.Entries()
+	if len(entries) != 1 || entries[0].Path != "/other/moved/sub/deep.txt" {
+		t.Fatalf("dirty entries = %+v, want the new path", entries)
+	}
+	if errno := deep.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	assertFileText(t, dir, "other/moved/sub/deep.txt", "written after the rename")
+	assertMissing(t, dir, "src")
+}
+
+func TestRenameDirectoryMovesDiskCacheEntries(t *testing.T) {
+	dir := t.TempDir()
+	mkdirs(t, dir, "src")
+	if err := os.WriteFile(filepath.Join(dir, "src", "cached.txt"), []byte("cached"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	local, err := backend.NewLocalBackend(dir, 0)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	cache, err := filecache.NewDiskCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDiskCache: %v", err)
+	}
+	root, err := NewRootNode(local, cache, "/", NewDirtyNodeRegistry(), nil)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	fs.NewNodeFS(root, &fs.Options{})
+
+	src := lookupChild(t, root, "src")
+	node := openChild(t, src, "cached.txt")
+	if got := readNodeText(t, node); got != "cached" {
+		t.Fatalf("read %q", got)
+	}
+	oldLocal := node.buf.CachedPath
+	if oldLocal == "" {
+		t.Fatal("file not read through the disk cache")
+	}
+	renameAndMove(t, root, "src", root, "dst")
+
+	if paths := cache.GetCachedPaths(); len(paths) != 1 || paths[0] != "/dst/cached.txt" {
+		t.Fatalf("cached paths = %v, want the renamed file", paths)
+	}
+	if _, err := os.Stat(oldLocal); !os.IsNotExist(err) {
+		t.Fatalf("cache file still at the old name: %v", err)
+	}
+	if got := readNodeText(t, node); got != "cached" {
+		t.Fatalf("read %q after rename", got)
+	}
+	if node.buf.CachedPath == "" || node.buf.CachedPath == oldLocal {
+		t.Fatalf("node reads %q, want the renamed cache file", node.buf.CachedPath)
+	}
+}
+
+func TestLockSubtreeFilesLocksInInodeOrder(t *testing.T) {
+	root, dir := newNameFixture(t, nil, nil)
+	mkdirs(t, dir, "src/b", "src/a")
+	for _, name := range []string{"src/z.txt", "src/b/y.txt", "src/a/x.txt", "src/b/w.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	src := lookupChild(t, root, "src")
+	for _, name := range []string{"z.txt", "b/y.txt", "a/x.txt", "b/w.txt"} {
+		parent := src
+		if sub, file, ok := strings.Cut(name, "/"); ok {
+			parent, name = lookupChild(t, src, sub), file
+		}
+		lookupChild(t, parent, name)
+	}
+
+	locked, errno := lockSubtreeFiles(context.Background(), src.EmbeddedInode())
+	if errno != 0 {
+		t.Fatalf("lockSubtreeFiles errno %d", errno)
+	}
+	defer func() {
+		for _, node := range locked {
+			node.mu.Unlock()
+		}
+	}()
+	if len(locked) != 4 {
+		t.Fatalf("locked %d files, want 4", len(locked))
+	}
+	for i := 1; i < len(locked); i++ {
+		if prev, cur := locked[i-1].StableAttr().Ino, locked[i].StableAttr().Ino; prev >= cur {
+			t.Fatalf("files locked out of inode order: %d before %d", prev, cur)
+		}
+	}
+}
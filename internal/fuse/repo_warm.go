@@ -0,0 +1,56 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/logging"
+)
+
+// repoWarmTimeout bounds a background warm-up of a repo's metadata.
+const repoWarmTimeout = 2 * time.Minute
+
+// maybeWarmRepo starts a background warm-up of the metadata cache when a
+// Databricks Repo is opened as a directory, so the stats an IDE sends for
+// every file of the repo are answered from the cache. A repo is warmed at
+// most once per metadata TTL.
+func (n *WSNode) maybeWarmRepo() {
+	if !n.cfg().WarmRepos || n.fileInfo.ObjectType != workspace.ObjectTypeRepo {
+		return
+	}
+	warmer, ok := n.wfClient.(databricks.RepoWarmer)
+	if !ok {
+		return
+	}
+	n.mu.Lock()
+	now := time.Now()
+	if !n.repoWarmedAt.IsZero() && now.Sub(n.repoWarmedAt) < n.wfClient.MetadataTTL() {
+		n.mu.Unlock()
+		return
+	}
+	n.repoWarmedAt = now
+	repoPath := n.Path()
+	n.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), repoWarmTimeout)
+		defer cancel()
+		result, err := warmer.WarmRepo(ctx, repoPath)
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+			logging.Debugf("Repo warm-up of %s skipped: %v", repoPath, err)
+		case err != nil:
+			logging.Warnf("Repo warm-up of %s failed: %v", repoPath, err)
+		case result.Skipped:
+			logging.Debugf("Repo warm-up of %s skipped: commit %s already warmed", repoPath, result.Repo.HeadCommitID)
+		case result.Truncated:
+			logging.Infof("Repo warm-up of %s at %s stopped after %d directories, %d entries cached", repoPath, result.Repo.HeadCommitID, result.Dirs, result.Entries)
+		default:
+			logging.Infof("Repo warm-up of %s at %s: %d directories, %d entries cached", repoPath, result.Repo.HeadCommitID, result.Dirs, result.Entries)
+		}
+	}()
+}
@@ -0,0 +1,65 @@
+package fuse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/service/workspace"
+
+	"wsfs/internal/databricks"
+)
+
+// warmingAPI records WarmRepo calls.
+type warmingAPI struct {
+	databricks.FakeWorkspaceAPI
+	warmed chan string
+}
+
+func (a *warmingAPI) WarmRepo(ctx context.Context, repoPath string) (databricks.RepoWarmResult, error) {
+	a.warmed <- repoPath
+	return databricks.RepoWarmResult{Dirs: 1}, nil
+}
+
+func (a *warmingAPI) MetadataTTL() time.Duration { return time.Minute }
+
+func TestOpendirWarmsRepoOncePerTTL(t *testing.T) {
+	api := &warmingAPI{warmed: make(chan string, 4)}
+	newDir := func(objectType workspace.ObjectType, warm bool) *WSNode {
+		return &WSNode{
+			wfClient: api,
+			config:   &NodeConfig{WarmRepos: warm},
+			fileInfo: databricks.WSFileInfo{ObjectInfo: workspace.ObjectInfo{
+				ObjectType: objectType,
+				Path:       "/Repos/me/proj",
+			}},
+		}
+	}
+	ctx := context.Background()
+
+	repo := newDir(workspace.ObjectTypeRepo, true)
+	for i := 0; i < 3; i++ {
+		if errno := repo.Opendir(ctx); errno != 0 {
+			t.Fatalf("Opendir errno %d", errno)
+		}
+	}
+	select {
+	case got := <-api.warmed:
+		if got != "/Repos/me/proj" {
+			t.Fatalf("warmed %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("opening the repo did not warm it")
+	}
+
+	for _, node := range []*WSNode{newDir(workspace.ObjectTypeRepo, false), newDir(workspace.ObjectTypeDirectory, true)} {
+		if errno := node.Opendir(ctx); errno != 0 {
+			t.Fatalf("Opendir errno %d", errno)
+		}
+	}
+	select {
+	case got := <-api.warmed:
+		t.Fatalf("unexpected warm-up of %s", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
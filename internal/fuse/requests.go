@@ -0,0 +1,168 @@
+package fuse
+
+import (
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/metrics"
+)
+
+// DefaultMaxBackground is go-fuse's limit on background requests, reads
+// ahead and writes the kernel queues without a waiting caller.
+const DefaultMaxBackground = 12
+
+// CongestionThreshold returns the number of background requests at which
+// the kernel starts holding new ones back. go-fuse sets it to three
+// quarters of maxBackground.
+func CongestionThreshold(maxBackground int) int {
+	if maxBackground <= 0 {
+		maxBackground = DefaultMaxBackground
+	}
+	return maxBackground * 3 / 4
+}
+
+// CountRequests wraps the raw file system of a mount to track how many
+// requests wsfs serves at once in the fuse_requests_* metrics. Requests
+// that arrive while more than congestionThreshold are in flight count as
+// congested: the mount is busy enough for the kernel to throttle it.
+// Requests that never reach the network, like Forget, are not tracked.
+func CountRequests(raw fuse.RawFileSystem, congestionThreshold int) fuse.RawFileSystem {
+	return &countingFS{RawFileSystem: raw, congestion: int64(congestionThreshold)}
+}
+
+type countingFS struct {
+	fuse.RawFileSystem
+	congestion int64
+}
+
+func (c *countingFS) begin() {
+	metrics.FuseRequests.Add(1)
+	inFlight := metrics.FuseRequestsInFlight.Add(1)
+	metrics.FuseRequestsInFlightPeak.RaiseTo(inFlight)
+	if c.congestion > 0 && inFlight > c.congestion {
+		metrics.FuseRequestsCongested.Add(1)
+	}
+}
+
+func (c *countingFS) end() {
+	metrics.FuseRequestsInFlight.Add(-1)
+}
+
+func (c *countingFS) Lookup(cancel <-chan struct{}, header *fuse.InHeader, name string, out *fuse.EntryOut) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Lookup(cancel, header, name, out)
+}
+
+func (c *countingFS) GetAttr(cancel <-chan struct{}, input *fuse.GetAttrIn, out *fuse.AttrOut) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.GetAttr(cancel, input, out)
+}
+
+func (c *countingFS) SetAttr(cancel <-chan struct{}, input *fuse.SetAttrIn, out *fuse.AttrOut) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.SetAttr(cancel, input, out)
+}
+
+func (c *countingFS) Mkdir(cancel <-chan struct{}, input *fuse.MkdirIn, name string, out *fuse.EntryOut) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Mkdir(cancel, input, name, out)
+}
+
+func (c *countingFS) Unlink(cancel <-chan struct{}, header *fuse.InHeader, name string) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Unlink(cancel, header, name)
+}
+
+func (c *countingFS) Rmdir(cancel <-chan struct{}, header *fuse.InHeader, name string) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Rmdir(cancel, header, name)
+}
+
+func (c *countingFS) Rename(cancel <-chan struct{}, input *fuse.RenameIn, oldName string, newName string) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Rename(cancel, input, oldName, newName)
+}
+
+func (c *countingFS) Access(cancel <-chan struct{}, input *fuse.AccessIn) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Access(cancel, input)
+}
+
+func (c *countingFS) GetXAttr(cancel <-chan struct{}, header *fuse.InHeader, attr string, dest []byte) (uint32, fuse.Status) {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.GetXAttr(cancel, header, attr, dest)
+}
+
+func (c *countingFS) Create(cancel <-chan struct{}, input *fuse.CreateIn, name string, out *fuse.CreateOut) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Create(cancel, input, name, out)
+}
+
+func (c *countingFS) Open(cancel <-chan struct{}, input *fuse.OpenIn, out *fuse.OpenOut) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Open(cancel, input, out)
+}
+
+func (c *countingFS) Read(cancel <-chan struct{}, input *fuse.ReadIn, buf []byte) (fuse.ReadResult, fuse.Status) {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Read(cancel, input, buf)
+}
+
+func (c *countingFS) Release(cancel <-chan struct{}, input *fuse.ReleaseIn) {
+	c.begin()
+	defer c.end()
+	c.RawFileSystem.Release(cancel, input)
+}
+
+func (c *countingFS) Write(cancel <-chan struct{}, input *fuse.WriteIn, data []byte) (uint32, fuse.Status) {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Write(cancel, input, data)
+}
+
+func (c *countingFS) Flush(cancel <-chan struct{}, input *fuse.FlushIn) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Flush(cancel, input)
+}
+
+func (c *countingFS) Fsync(cancel <-chan struct{}, input *fuse.FsyncIn) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.Fsync(cancel, input)
+}
+
+func (c *countingFS) OpenDir(cancel <-chan struct{}, input *fuse.OpenIn, out *fuse.OpenOut) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.OpenDir(cancel, input, out)
+}
+
+func (c *countingFS) ReadDir(cancel <-chan struct{}, input *fuse.ReadIn, out *fuse.DirEntryList) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.ReadDir(cancel, input, out)
+}
+
+func (c *countingFS) ReadDirPlus(cancel <-chan struct{}, input *fuse.ReadIn, out *fuse.DirEntryList) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.ReadDirPlus(cancel, input, out)
+}
+
+func (c *countingFS) StatFs(cancel <-chan struct{}, input *fuse.InHeader, out *fuse.StatfsOut) fuse.Status {
+	c.begin()
+	defer c.end()
+	return c.RawFileSystem.StatFs(cancel, input, out)
+}
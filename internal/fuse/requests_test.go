@@ -0,0 +1,68 @@
+package fuse
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/metrics"
+)
+
+// blockingLookupFS holds every Lookup until release is closed.
+type blockingLookupFS struct {
+	fuse.RawFileSystem
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingLookupFS) Lookup(cancel <-chan struct{}, header *fuse.InHeader, name string, out *fuse.EntryOut) fuse.Status {
+	b.started <- struct{}{}
+	<-b.release
+	return fuse.OK
+}
+
+func TestCountRequestsTracksInFlightAndCongestion(t *testing.T) {
+	inner := &blockingLookupFS{RawFileSystem: fuse.NewDefaultRawFileSystem(), started: make(chan struct{}), release: make(chan struct{})}
+	raw := CountRequests(inner, 2)
+	requests := metrics.FuseRequests.Value()
+	congested := metrics.FuseRequestsCongested.Value()
+	inFlight := metrics.FuseRequestsInFlight.Value()
+
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go func() {
+			raw.Lookup(nil, &fuse.InHeader{}, "name", &fuse.EntryOut{})
+			done <- struct{}{}
+		}()
+		<-inner.started
+	}
+	if got := metrics.FuseRequestsInFlight.Value() - inFlight; got != 3 {
+		t.Fatalf("in flight = %d, want 3", got)
+	}
+	if metrics.FuseRequestsInFlightPeak.Value() < inFlight+3 {
+		t.Fatalf("peak = %d, want at least %d", metrics.FuseRequestsInFlightPeak.Value(), inFlight+3)
+	}
+	close(inner.release)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+
+	if got := metrics.FuseRequestsInFlight.Value(); got != inFlight {
+		t.Fatalf("in flight after the requests = %d, want %d", got, inFlight)
+	}
+	if got := metrics.FuseRequests.Value() - requests; got != 3 {
+		t.Fatalf("requests = %d, want 3", got)
+	}
+	if got := metrics.FuseRequestsCongested.Value() - congested; got != 1 {
+		t.Fatalf("congested = %d, want the request past the threshold", got)
+	}
+}
+
+func TestCongestionThreshold(t *testing.T) {
+	if got := CongestionThreshold(0); got != 9 {
+		t.Fatalf("default threshold = %d, want 9", got)
+	}
+	if got := CongestionThreshold(64); got != 48 {
+		t.Fatalf("threshold = %d, want 48", got)
+	}
+}
@@ -0,0 +1,123 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"wsfs/internal/databricks"
+)
+
+// ResolvedObject describes the workspace object with a given ID and the
+// state the mount holds for it.
+type ResolvedObject struct {
+	ObjectID   int64  `json:"object_id"`
+	ObjectType string `json:"object_type"`
+	RemotePath string `json:"remote_path"` // workspace path
+	MountPath  string `json:"mount_path"`  // path below the mount point, as listed
+	Inode      uint64 `json:"inode,omitempty"`
+	Loaded     bool   `json:"loaded"` // the kernel has looked the path up
+	Dirty      bool   `json:"dirty"`
+	DiskCached bool   `json:"disk_cached"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// ResolveObjectID finds the object with the given workspace object ID below
+// the mount root. The workspace API has no lookup by ID, so the tree is
+// listed breadth first through the metadata cache until the ID is found.
+// Objects outside the mounted path are reported as not existing.
+func (n *WSNode) ResolveObjectID(ctx context.Context, objectID int64) (ResolvedObject, error) {
+	if n.fileInfo.ObjectId == objectID {
+		return n.resolvedObject(n.fileInfo, "/"), nil
+	}
+
+	type dir struct {
+		remotePath string
+		mountPath  string
+	}
+	queue := []dir{{remotePath: n.Path(), mountPath: "/"}}
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return ResolvedObject{}, err
+		}
+		current := queue[0]
+		queue = queue[1:]
+
+		listCtx, cancel := context.WithTimeout(ctx, dirListTimeout)
+		entries, err := n.wfClient.ReadDir(listCtx, current.remotePath)
+		cancel()
+		if err != nil {
+			return ResolvedObject{}, fmt.Errorf("list %s: %w", current.remotePath, err)
+		}
+		for _, v := range visibleEntries(entries, n.cfg().NotebookAliases) {
+			if current.mountPath == "/" && n.isControlName(v.name) {
+				continue
+			}
+			info, err := v.entry.Info()
+			if err != nil {
+				continue
+			}
+			wsInfo, ok := info.(databricks.WSFileInfo)
+			if !ok {
+				continue
+			}
+			mountPath := path.Join(current.mountPath, v.name)
+			if wsInfo.ObjectId == objectID {
+				return n.resolvedObject(wsInfo, mountPath), nil
+			}
+			if wsInfo.IsDir() {
+				queue = append(queue, dir{remotePath: wsInfo.Path, mountPath: mountPath})
+			}
+		}
+	}
+	return ResolvedObject{}, fmt.Errorf("object %d not found under %s: %w", objectID, n.Path(), os.ErrNotExist)
+}
+
+func (n *WSNode) resolvedObject(info databricks.WSFileInfo, mountPath string) ResolvedObject {
+	resolved := ResolvedObject{
+		ObjectID:   info.ObjectId,
+		ObjectType: string(info.ObjectType),
+		RemotePath: info.Path,
+		MountPath:  mountPath,
+	}
+
+	if n.diskCache != nil && !n.diskCache.IsDisabled() {
+		for _, cached := range n.diskCache.GetCachedPaths() {
+			if cached == info.Path {
+				resolved.DiskCached = true
+				break
+			}
+		}
+	}
+
+	node := n.loadedNode(mountPath)
+	if node == nil {
+		return resolved
+	}
+	resolved.Loaded = true
+	resolved.Inode = node.StableAttr().Ino
+	node.mu.Lock()
+	resolved.Dirty = node.isDirtyLocked()
+	if node.lastError != nil {
+		resolved.LastError = node.lastError.String()
+	}
+	node.mu.Unlock()
+	return resolved
+}
+
+// loadedNode returns the node the kernel has looked up at mountPath, or nil.
+func (n *WSNode) loadedNode(mountPath string) *WSNode {
+	inode := n.EmbeddedInode()
+	for _, name := range strings.Split(strings.Trim(mountPath, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if inode = inode.GetChild(name); inode == nil {
+			return nil
+		}
+	}
+	node, _ := inode.Operations().(*WSNode)
+	return node
+}
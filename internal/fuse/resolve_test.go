@@ -0,0 +1,84 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func (f *manageFixture) objectID(name string) int64 {
+	f.t.Helper()
+	info, err := os.Stat(filepath.Join(f.dir, filepath.FromSlash(name)))
+	if err != nil {
+		f.t.Fatalf("stat %s: %v", name, err)
+	}
+	return int64(info.Sys().(*syscall.Stat_t).Ino)
+}
+
+func TestResolveObjectIDFindsPathAndState(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+	id := f.objectID("src/lib/util.py")
+
+	resolved, err := f.root.ResolveObjectID(ctx, id)
+	if err != nil {
+		t.Fatalf("ResolveObjectID: %v", err)
+	}
+	want := ResolvedObject{ObjectID: id, ObjectType: "FILE", RemotePath: "/src/lib/util.py", MountPath: "/src/lib/util.py"}
+	if resolved != want {
+		t.Fatalf("ResolveObjectID = %+v, want %+v", resolved, want)
+	}
+
+	node := f.lookup("src", "lib", "util.py")
+	f.write(node, "def util(): return 1\n")
+	if _, err := f.root.Prefetch(ctx, "/docs"); err != nil {
+		t.Fatalf("Prefetch: %v", err)
+	}
+
+	resolved, err = f.root.ResolveObjectID(ctx, id)
+	if err != nil {
+		t.Fatalf("ResolveObjectID after write: %v", err)
+	}
+	if !resolved.Loaded || !resolved.Dirty || resolved.Inode != node.StableAttr().Ino {
+		t.Fatalf("unexpected state of a dirty loaded file: %+v", resolved)
+	}
+
+	resolved, err = f.root.ResolveObjectID(ctx, f.objectID("docs/README.md"))
+	if err != nil {
+		t.Fatalf("ResolveObjectID of a cached file: %v", err)
+	}
+	if resolved.MountPath != "/docs/README.md" || !resolved.DiskCached || resolved.Loaded {
+		t.Fatalf("unexpected state of a prefetched file: %+v", resolved)
+	}
+}
+
+func TestResolveObjectIDOfDirectoryAndRoot(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+
+	resolved, err := f.root.ResolveObjectID(ctx, f.objectID("src/lib"))
+	if err != nil || resolved.MountPath != "/src/lib" || resolved.ObjectType != "DIRECTORY" {
+		t.Fatalf("ResolveObjectID(dir) = %+v, %v", resolved, err)
+	}
+
+	resolved, err = f.root.ResolveObjectID(ctx, f.objectID(""))
+	if err != nil || resolved.MountPath != "/" || !resolved.Loaded {
+		t.Fatalf("ResolveObjectID(root) = %+v, %v", resolved, err)
+	}
+}
+
+func TestResolveObjectIDNotFound(t *testing.T) {
+	f := newManageFixture(t)
+	if _, err := f.root.ResolveObjectID(context.Background(), -1); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ResolveObjectID of an unknown ID = %v, want ErrNotExist", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.root.ResolveObjectID(ctx, -1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ResolveObjectID with a canceled context = %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// RevalidateRoot re-reads the mount root's attributes from the backend,
+// bypassing the metadata cache. It fails when the root can no longer be
+// read, for example because the token expired or access was revoked, or
+// when it is no longer a directory.
+func (n *WSNode) RevalidateRoot(ctx context.Context) error {
+	opCtx, cancel := context.WithTimeout(ctx, metadataOpTimeout)
+	defer cancel()
+
+	n.mu.Lock()
+	changed, errno := n.refreshMetadataLocked(opCtx, true)
+	isDir := n.fileInfo.IsDir()
+	n.mu.Unlock()
+
+	if errno != 0 {
+		return fmt.Errorf("stat mount root %s: %w", n.Path(), errno)
+	}
+	if !isDir {
+		return fmt.Errorf("mount root %s is no longer a directory: %w", n.Path(), syscall.ENOTDIR)
+	}
+	if changed {
+		notifyContentIfPossible(n.EmbeddedInode(), n.Path())
+	}
+	return nil
+}
+
+// WatchRoot revalidates the mount root every interval until ctx is done.
+// report is called when the root becomes unreachable and again with nil
+// when it recovers, not on every failed check.
+func (n *WSNode) WatchRoot(ctx context.Context, interval time.Duration, report func(error)) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := n.RevalidateRoot(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if (err == nil) != healthy {
+			healthy = err == nil
+			report(err)
+		}
+	}
+}
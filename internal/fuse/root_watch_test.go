@@ -0,0 +1,160 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/databricks/databricks-sdk-go/apierr"
+
+	"wsfs/internal/databricks"
+)
+
+// switchableRoot serves Stat for the mount root with a result tests can
+// change while a watcher is running.
+type switchableRoot struct {
+	mu    sync.Mutex
+	err   error
+	isDir bool
+	size  int64
+	stats int
+}
+
+func (s *switchableRoot) set(isDir bool, size int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.isDir, s.size, s.err = isDir, size, err
+}
+
+func (s *switchableRoot) api() *databricks.FakeWorkspaceAPI {
+	return &databricks.FakeWorkspaceAPI{
+		StatFunc: func(ctx context.Context, filePath string) (fs.FileInfo, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.stats++
+			if s.err != nil {
+				return nil, s.err
+			}
+			return databricks.NewTestFileInfo(filePath, s.size, s.isDir), nil
+		},
+	}
+}
+
+func TestNewRootNodeStatHasDeadline(t *testing.T) {
+	api := &databricks.FakeWorkspaceAPI{
+		StatFunc: func(ctx context.Context, filePath string) (fs.FileInfo, error) {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Fatal("expected the startup stat to have a deadline")
+			}
+			return databricks.NewTestFileInfo(filePath, 0, true), nil
+		},
+	}
+	if _, err := NewRootNode(api, nil, "/", NewDirtyNodeRegistry(), nil); err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+}
+
+func TestRevalidateRoot(t *testing.T) {
+	state := &switchableRoot{isDir: true}
+	root, err := NewRootNode(state.api(), nil, "/", NewDirtyNodeRegistry(), nil)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+	ctx := context.Background()
+
+	// Within the metadata TTL, but revalidation must still reach the backend.
+	state.set(true, 7, nil)
+	if err := root.RevalidateRoot(ctx); err != nil {
+		t.Fatalf("RevalidateRoot: %v", err)
+	}
+	if root.fileInfo.Size() != 7 {
+		t.Fatalf("root attributes not refreshed: size %d", root.fileInfo.Size())
+	}
+
+	state.set(true, 0, &apierr.APIError{StatusCode: 403, ErrorCode: "PERMISSION_DENIED", Message: "no access"})
+	if err := root.RevalidateRoot(ctx); !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("RevalidateRoot with revoked access = %v, want EACCES", err)
+	}
+
+	state.set(false, 0, nil)
+	if err := root.RevalidateRoot(ctx); !errors.Is(err, syscall.ENOTDIR) {
+		t.Fatalf("RevalidateRoot of a file = %v, want ENOTDIR", err)
+	}
+}
+
+func TestWatchRootReportsTransitionsOnce(t *testing.T) {
+	state := &switchableRoot{isDir: true}
+	root, err := NewRootNode(state.api(), nil, "/", NewDirtyNodeRegistry(), nil)
+	if err != nil {
+		t.Fatalf("NewRootNode: %v", err)
+	}
+
+	reports := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		root.WatchRoot(ctx, time.Millisecond, func(err error) { reports <- err })
+		close(done)
+	}()
+
+	waitStats := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			state.mu.Lock()
+			stats := state.stats
+			state.mu.Unlock()
+			if stats >= n {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("watcher made %d stats, want %d", stats, n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	state.set(true, 0, &apierr.APIError{StatusCode: 401, ErrorCode: "UNAUTHENTICATED", Message: "token expired"})
+	select {
+	case err := <-reports:
+		if !errors.Is(err, syscall.EACCES) {
+			t.Fatalf("first report = %v, want EACCES", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("failure was not reported")
+	}
+	state.mu.Lock()
+	seen := state.stats
+	state.mu.Unlock()
+	waitStats(seen + 3)
+	if len(reports) != 0 {
+		t.Fatalf("repeated failures were reported again: %v", <-reports)
+	}
+
+	state.set(true, 0, nil)
+	select {
+	case err := <-reports:
+		if err != nil {
+			t.Fatalf("recovery report = %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("recovery was not reported")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("WatchRoot did not stop")
+	}
+}
+
+func TestWatchRootDisabled(t *testing.T) {
+	root := &WSNode{}
+	// Returns immediately instead of blocking on a zero interval.
+	root.WatchRoot(context.Background(), 0, func(error) { t.Fatal("unexpected report") })
+}
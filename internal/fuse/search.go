@@ -0,0 +1,212 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sync"
+
+	"wsfs/internal/databricks"
+	"wsfs/internal/logging"
+)
+
+// searchWorkers bounds the files Search reads at once, and so the
+// concurrent downloads of cold files.
+const searchWorkers = 8
+
+// binaryProbeBytes is how much of a file is checked for a NUL byte, as grep
+// does, to skip binary content.
+const binaryProbeBytes = 8000
+
+// SearchMatch is a line that matched a Search pattern.
+type SearchMatch struct {
+	Path string `json:"path"` // path below the mount point, as listed
+	Line int    `json:"line"` // 1-based
+	Text string `json:"text"`
+}
+
+// SearchResult summarizes a Search call.
+type SearchResult struct {
+	Matches    []SearchMatch `json:"matches"`
+	Files      int           `json:"files"`      // files searched
+	Cached     int           `json:"cached"`     // files read from memory or the disk cache
+	Downloaded int           `json:"downloaded"` // files downloaded, and added to the disk cache
+	Binary     int           `json:"binary"`     // files skipped as binary
+	Skipped    int           `json:"skipped"`    // files that failed to read
+	Truncated  bool          `json:"truncated,omitempty"`
+}
+
+// searchFile is a file Search reads, with where its matches are reported.
+type searchFile struct {
+	info      databricks.WSFileInfo
+	mountPath string
+}
+
+// Search returns the lines matching pattern in the files at or below the
+// mount-relative path, in listing order, stopping after maxMatches matches
+// when maxMatches is positive. The tree is listed through the metadata
+// cache. Unsaved changes are searched from memory, warm files from the disk
+// cache, and cold files are downloaded up to searchWorkers at a time and
+// left in the disk cache for the next search or read.
+func (n *WSNode) Search(ctx context.Context, mountPath string, pattern *regexp.Regexp, maxMatches int) (SearchResult, error) {
+	var result SearchResult
+	mountPath = path.Clean("/" + mountPath)
+	remotePath := n.RemotePath(mountPath)
+	info, err := n.wfClient.Stat(ctx, remotePath)
+	if err != nil {
+		return result, err
+	}
+	wsInfo, ok := info.(databricks.WSFileInfo)
+	if !ok {
+		return result, fmt.Errorf("unexpected file info type for %s", remotePath)
+	}
+	files, err := n.searchFiles(ctx, wsInfo, mountPath)
+	if err != nil {
+		return result, err
+	}
+
+	matches := make([][]SearchMatch, len(files))
+	outcomes := make([]searchOutcome, len(files))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < searchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				matches[i], outcomes[i] = n.searchFile(ctx, files[i], pattern)
+			}
+		}()
+	}
+	for i := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	for i, outcome := range outcomes {
+		switch outcome {
+		case searchCached:
+			result.Cached++
+		case searchDownloaded:
+			result.Downloaded++
+		case searchBinary:
+			result.Binary++
+			continue
+		case searchFailed:
+			result.Skipped++
+			continue
+		}
+		result.Files++
+		for _, match := range matches[i] {
+			if maxMatches > 0 && len(result.Matches) == maxMatches {
+				result.Truncated = true
+				return result, nil
+			}
+			result.Matches = append(result.Matches, match)
+		}
+	}
+	return result, nil
+}
+
+// searchFiles lists the files at or below info, skipping hidden names and
+// the control directory like a listing of the mount.
+func (n *WSNode) searchFiles(ctx context.Context, info databricks.WSFileInfo, mountPath string) ([]searchFile, error) {
+	if !info.IsDir() {
+		return []searchFile{{info: info, mountPath: mountPath}}, nil
+	}
+	entries, _, err := n.walkTree(ctx, info, mountPath, 0)
+	if err != nil {
+		return nil, err
+	}
+	var files []searchFile
+	for _, entry := range entries {
+		if !entry.info.IsDir() {
+			files = append(files, searchFile{info: entry.info, mountPath: entry.mountPath})
+		}
+	}
+	return files, nil
+}
+
+type searchOutcome int
+
+const (
+	searchCached searchOutcome = iota
+	searchDownloaded
+	searchBinary
+	searchFailed
+)
+
+func (n *WSNode) searchFile(ctx context.Context, file searchFile, pattern *regexp.Regexp) ([]SearchMatch, searchOutcome) {
+	data, outcome, err := n.searchContent(ctx, file)
+	if err != nil {
+		if ctx.Err() == nil {
+			logging.Warnf("Search %s failed: %v", file.info.Path, err)
+		}
+		return nil, searchFailed
+	}
+	if bytes.IndexByte(data[:min(len(data), binaryProbeBytes)], 0) >= 0 {
+		return nil, searchBinary
+	}
+
+	var matches []SearchMatch
+	for line := 1; len(data) > 0; line++ {
+		text := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			text, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		text = bytes.TrimSuffix(text, []byte("\r"))
+		if pattern.Match(text) {
+			matches = append(matches, SearchMatch{Path: file.mountPath, Line: line, Text: string(text)})
+		}
+	}
+	return matches, outcome
+}
+
+// searchContent returns the content of a file the way a read through the
+// mount would see it.
+func (n *WSNode) searchContent(ctx context.Context, file searchFile) ([]byte, searchOutcome, error) {
+	if node := n.loadedNode(file.mountPath); node != nil {
+		node.mu.Lock()
+		var data []byte
+		if node.isDirtyLocked() && node.buf.Data != nil {
+			data = bytes.Clone(node.buf.Data)
+		}
+		node.mu.Unlock()
+		if data != nil {
+			return data, searchCached, nil
+		}
+	}
+
+	remotePath, modTime := file.info.Path, file.info.ModTime()
+	if n.usesDiskCache(remotePath) {
+		if cachedPath, _, found := n.diskCache.Get(remotePath, modTime); found {
+			if data, err := os.ReadFile(cachedPath); err == nil {
+				return data, searchCached, nil
+			}
+		}
+	}
+	readCtx, cancel := context.WithTimeout(ctx, dataOpTimeout)
+	defer cancel()
+	data, err := n.wfClient.ReadAll(readCtx, remotePath)
+	if err != nil {
+		return nil, searchFailed, err
+	}
+	if n.usesDiskCache(remotePath) {
+		if _, err := n.setDiskCache(remotePath, data, modTime, file.info.IsNotebook()); err != nil {
+			logging.Debugf("Failed to cache %s after search: %v", remotePath, err)
+		}
+	}
+	return data, searchDownloaded, nil
+}
@@ -0,0 +1,84 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestSearchListsMatchesAndWarmsTheCache(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+	if err := os.WriteFile(filepath.Join(f.dir, "src", "blob.bin"), []byte("def\x00binary"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	result, err := f.root.Search(ctx, "/", regexp.MustCompile(`def|print|top`), 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	want := []SearchMatch{
+		{Path: "/top-level.txt", Line: 1, Text: "top"},
+		{Path: "/src/main.py", Line: 1, Text: "print('main')"},
+		{Path: "/src/lib/util.py", Line: 1, Text: "def util(): pass"},
+	}
+	if !reflect.DeepEqual(result.Matches, want) {
+		t.Fatalf("matches = %+v, want %+v", result.Matches, want)
+	}
+	if result.Files != 5 || result.Downloaded != 5 || result.Cached != 0 || result.Binary != 1 || result.Truncated {
+		t.Fatalf("unexpected counts on a cold cache: %+v", result)
+	}
+	if _, _, found := f.cache.Get("/src/main.py", f.lookup("src", "main.py").fileInfo.ModTime()); !found {
+		t.Fatal("searched file was not added to the disk cache")
+	}
+
+	again, err := f.root.Search(ctx, "src", regexp.MustCompile(`(?i)PRINT`), 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if again.Cached != 3 || again.Downloaded != 0 || len(again.Matches) != 1 || again.Matches[0].Path != "/src/main.py" {
+		t.Fatalf("unexpected search of a warm subtree: %+v", again)
+	}
+}
+
+func TestSearchSeesUnsavedChanges(t *testing.T) {
+	f := newManageFixture(t)
+	node := f.lookup("src", "main.py")
+	f.write(node, "print('edited')\n")
+
+	result, err := f.root.Search(context.Background(), "/src/main.py", regexp.MustCompile(`edited`), 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if result.Files != 1 || len(result.Matches) != 1 || result.Matches[0].Text != "print('edited')" {
+		t.Fatalf("dirty file searched as %+v, want its buffer", result)
+	}
+}
+
+func TestSearchStopsAtMaxMatches(t *testing.T) {
+	f := newManageFixture(t)
+	result, err := f.root.Search(context.Background(), "/", regexp.MustCompile(`.`), 2)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(result.Matches) != 2 || !result.Truncated {
+		t.Fatalf("unexpected result with max 2 matches: %+v", result)
+	}
+}
+
+func TestSearchReportsMissingPathAndCancel(t *testing.T) {
+	f := newManageFixture(t)
+	if _, err := f.root.Search(context.Background(), "/missing", regexp.MustCompile(`x`), 0); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Search of a missing path = %v, want ErrNotExist", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.root.Search(ctx, "/", regexp.MustCompile(`x`), 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Search with a canceled context = %v", err)
+	}
+}
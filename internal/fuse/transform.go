@@ -0,0 +1,45 @@
+package fuse
+
+import (
+	"bytes"
+	"strings"
+
+	"wsfs/internal/logging"
+	"wsfs/internal/metrics"
+)
+
+// applyTransformsLocked runs the .wsfsattributes transforms of the file on
+// its buffer before an upload and reports whether the content changed. The
+// buffer is replaced with the result, so the mount serves what the
+// workspace holds, and the kernel drops its cached pages of the file.
+//
+// Writers address the content by offset, so the buffer is only rewritten
+// while no handle is open. An upload while the file is open sends the
+// content as written, and the file is transformed at its last close.
+func (n *WSNode) applyTransformsLocked() bool {
+	if n.cfg().Transforms == nil || n.buf.Data == nil || n.fileInfo.IsDir() {
+		return false
+	}
+	if n.openCount > 0 {
+		n.transformPending = true
+		return false
+	}
+	n.transformPending = false
+
+	mountPath := n.mountPath("")
+	data, applied, err := n.cfg().Transforms.Apply(mountPath, n.buf.Data)
+	if err != nil {
+		logging.Warnf("Transforming %s failed, uploading it as written: %v", mountPath, err)
+		metrics.TransformsFailed.Add(1)
+		return false
+	}
+	if bytes.Equal(data, n.buf.Data) {
+		return false
+	}
+	logging.Debugf("Transformed %s with %s: %d -> %d bytes", mountPath, strings.Join(applied, " "), len(n.buf.Data), len(data))
+	metrics.TransformsApplied.Add(1)
+	n.buf.Data = data
+	n.bufGen++
+	go notifyContentIfPossible(n.EmbeddedInode(), mountPath)
+	return true
+}
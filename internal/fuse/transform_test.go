@@ -0,0 +1,126 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"wsfs/internal/metrics"
+	"wsfs/internal/transform"
+)
+
+func newTransformFixture(t *testing.T) (*WSNode, string) {
+	t.Helper()
+	set, err := transform.Parse(strings.NewReader("*.sh eol=lf\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	root, dir := newNameFixture(t, map[string]string{"run.sh": "a\nb\n", "notes.txt": "a\nb\n"}, &NodeConfig{Transforms: set})
+	return root, dir
+}
+
+func lookupChild(t *testing.T, root *WSNode, name string) *WSNode {
+	t.Helper()
+	child, errno := root.Lookup(context.Background(), name, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Lookup %s errno %d", name, errno)
+	}
+	root.AddChild(name, child, true)
+	return child.Operations().(*WSNode)
+}
+
+func writeFile(t *testing.T, node *WSNode, content string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, _, errno := node.Open(ctx, syscall.O_RDWR); errno != 0 {
+		t.Fatalf("Open errno %d", errno)
+	}
+	if _, errno := node.Write(ctx, nil, []byte(content), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+}
+
+func readLocal(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestTransformsRewriteMatchingFilesOnUpload(t *testing.T) {
+	root, dir := newTransformFixture(t)
+	ctx := context.Background()
+
+	script := lookupChild(t, root, "run.sh")
+	writeFile(t, script, "x\r\ny\r\n")
+	if errno := script.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if got := readLocal(t, dir, "run.sh"); got != "x\ny\n" {
+		t.Fatalf("uploaded %q, want LF line endings", got)
+	}
+	if script.fileInfo.Size() != 4 {
+		t.Fatalf("size after upload = %d, want the transformed size 4", script.fileInfo.Size())
+	}
+
+	notes := lookupChild(t, root, "notes.txt")
+	writeFile(t, notes, "x\r\ny\r\n")
+	if errno := notes.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if got := readLocal(t, dir, "notes.txt"); got != "x\r\ny\r\n" {
+		t.Fatalf("unmatched file uploaded as %q", got)
+	}
+}
+
+func TestTransformsWaitForTheLastClose(t *testing.T) {
+	root, dir := newTransformFixture(t)
+	ctx := context.Background()
+
+	script := lookupChild(t, root, "run.sh")
+	writeFile(t, script, "p\r\nq\r\n")
+	if errno := script.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("Fsync errno %d", errno)
+	}
+	// The writer may still write at offsets into what it wrote.
+	if got := readLocal(t, dir, "run.sh"); got != "p\r\nq\r\n" {
+		t.Fatalf("fsync while open uploaded %q, want the content as written", got)
+	}
+	if errno := script.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if got := readLocal(t, dir, "run.sh"); got != "p\nq\n" {
+		t.Fatalf("after the last close the workspace has %q, want LF line endings", got)
+	}
+	if script.isDirtyLocked() {
+		t.Fatal("file still dirty after the last close")
+	}
+}
+
+func TestFailedTransformUploadsAsWritten(t *testing.T) {
+	set, err := transform.Parse(strings.NewReader("*.txt text\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	root, dir := newNameFixture(t, map[string]string{"notes.txt": "a\n"}, &NodeConfig{Transforms: set})
+	failed := metrics.TransformsFailed.Value()
+
+	notes := lookupChild(t, root, "notes.txt")
+	writeFile(t, notes, "caf\xe9\r\n")
+	if errno := notes.Release(context.Background(), nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if got := readLocal(t, dir, "notes.txt"); got != "caf\xe9\r\n" {
+		t.Fatalf("uploaded %q, want the content as written", got)
+	}
+	if metrics.TransformsFailed.Value() != failed+1 {
+		t.Fatal("failed transform not counted")
+	}
+}
@@ -0,0 +1,118 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"wsfs/internal/databricks"
+)
+
+// TreeEntry is an object listed by ListTree.
+type TreeEntry struct {
+	Path       string    `json:"path"`  // path below the mount point, as listed
+	Depth      int       `json:"depth"` // 1 for the children of the listed directory
+	IsDir      bool      `json:"is_dir"`
+	ObjectType string    `json:"object_type"`
+	ObjectID   int64     `json:"object_id,omitempty"`
+	Language   string    `json:"language,omitempty"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+}
+
+// TreeResult is the result of a ListTree call.
+type TreeResult struct {
+	Entries []TreeEntry `json:"entries"`
+	Dirs    int         `json:"dirs"` // directories listed
+}
+
+// treeEntry is an object found by walkTree, with where it is listed.
+type treeEntry struct {
+	info      databricks.WSFileInfo
+	mountPath string
+	depth     int
+}
+
+// ListTree lists the objects below the mount-relative directory breadth
+// first, down to depth levels (1 lists only its children, 0 is unlimited),
+// with the names and filters of a listing of the mount.
+func (n *WSNode) ListTree(ctx context.Context, mountPath string, depth int) (TreeResult, error) {
+	var result TreeResult
+	mountPath = path.Clean("/" + mountPath)
+	remotePath := n.RemotePath(mountPath)
+	info, err := n.wfClient.Stat(ctx, remotePath)
+	if err != nil {
+		return result, err
+	}
+	wsInfo, ok := info.(databricks.WSFileInfo)
+	if !ok {
+		return result, fmt.Errorf("unexpected file info type for %s", remotePath)
+	}
+	if !wsInfo.IsDir() {
+		return result, fmt.Errorf("%s is not a directory", mountPath)
+	}
+	entries, dirs, err := n.walkTree(ctx, wsInfo, mountPath, depth)
+	if err != nil {
+		return result, err
+	}
+	result.Dirs = dirs
+	result.Entries = make([]TreeEntry, 0, len(entries))
+	for _, entry := range entries {
+		result.Entries = append(result.Entries, TreeEntry{
+			Path:       entry.mountPath,
+			Depth:      entry.depth,
+			IsDir:      entry.info.IsDir(),
+			ObjectType: string(entry.info.ObjectType),
+			ObjectID:   entry.info.ObjectId,
+			Language:   string(entry.info.Language),
+			Size:       entry.info.Size(),
+			ModTime:    entry.info.ModTime(),
+		})
+	}
+	return result, nil
+}
+
+// walkTree lists the objects below the directory info, listed at
+// mountPath, through databricks.WalkTree. Hidden names and the control
+// directory are skipped like in a listing of the mount, and so is
+// everything below them. It also returns the number of directories listed.
+func (n *WSNode) walkTree(ctx context.Context, info databricks.WSFileInfo, mountPath string, depth int) ([]treeEntry, int, error) {
+	skip := func(dirPath, name string) bool {
+		return dirPath == info.Path && mountPath == "/" && n.isControlName(name) || n.isHiddenName(name)
+	}
+	listing, err := databricks.WalkTree(ctx, n.wfClient, info.Path, databricks.TreeOptions{
+		Depth: depth,
+		Skip: func(dir databricks.TreeDir, entry databricks.WSDirEntry) bool {
+			return skip(dir.Path, entry.Name())
+		},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	mountPaths := map[string]string{info.Path: mountPath}
+	var entries []treeEntry
+	for _, dir := range listing.Dirs {
+		dirMountPath := mountPaths[dir.Path]
+		for _, v := range visibleEntries(dir.Entries, n.cfg().NotebookAliases) {
+			if skip(dir.Path, v.name) {
+				continue
+			}
+			childInfo, err := v.entry.Info()
+			if err != nil {
+				continue
+			}
+			wsInfo, ok := childInfo.(databricks.WSFileInfo)
+			if !ok {
+				continue
+			}
+			childMountPath := path.Join(dirMountPath, v.name)
+			if wsInfo.IsDir() {
+				mountPaths[wsInfo.Path] = childMountPath
+			}
+			entries = append(entries, treeEntry{info: wsInfo, mountPath: childMountPath, depth: dir.Depth + 1})
+		}
+	}
+	return entries, len(listing.Dirs), nil
+}
@@ -0,0 +1,72 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func treePaths(result TreeResult) []string {
+	var paths []string
+	for _, entry := range result.Entries {
+		p := entry.Path
+		if entry.IsDir {
+			p += "/"
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+func TestListTreeListsBreadthFirst(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+
+	result, err := f.root.ListTree(ctx, "/", 0)
+	if err != nil {
+		t.Fatalf("ListTree: %v", err)
+	}
+	want := []string{"/docs/", "/src/", "/top-level.txt", "/docs/README.md", "/src/lib/", "/src/main.py", "/src/lib/data.csv", "/src/lib/util.py"}
+	if got := treePaths(result); !reflect.DeepEqual(got, want) || result.Dirs != 4 {
+		t.Fatalf("tree = %v (%d dirs), want %v", got, result.Dirs, want)
+	}
+	if entry := result.Entries[5]; entry.Depth != 2 || entry.Size != int64(len("print('main')\n")) || entry.ObjectType != "FILE" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	result, err = f.root.ListTree(ctx, "src", 1)
+	if err != nil {
+		t.Fatalf("ListTree depth 1: %v", err)
+	}
+	if got := treePaths(result); !reflect.DeepEqual(got, []string{"/src/lib/", "/src/main.py"}) || result.Dirs != 1 {
+		t.Fatalf("depth 1 tree = %v (%d dirs)", got, result.Dirs)
+	}
+}
+
+func TestListTreeSkipsHiddenNames(t *testing.T) {
+	f := newManageFixture(t)
+	f.root.config.HidePatterns = []string{"lib"}
+	if err := os.Mkdir(f.dir+"/"+controlDirName, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	result, err := f.root.ListTree(context.Background(), "/", 0)
+	if err != nil {
+		t.Fatalf("ListTree: %v", err)
+	}
+	want := []string{"/docs/", "/src/", "/top-level.txt", "/docs/README.md", "/src/main.py"}
+	if got := treePaths(result); !reflect.DeepEqual(got, want) || result.Dirs != 3 {
+		t.Fatalf("tree = %v (%d dirs), want %v", got, result.Dirs, want)
+	}
+}
+
+func TestListTreeReportsMissingPath(t *testing.T) {
+	f := newManageFixture(t)
+	if _, err := f.root.ListTree(context.Background(), "/missing", 0); !os.IsNotExist(err) {
+		t.Fatalf("ListTree of a missing path = %v, want not exist", err)
+	}
+	if _, err := f.root.ListTree(context.Background(), "/top-level.txt", 0); err == nil {
+		t.Fatal("ListTree of a file succeeded")
+	}
+}
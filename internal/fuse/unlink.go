@@ -0,0 +1,138 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sort"
+	"sync"
+	"syscall"
+
+	"wsfs/internal/logging"
+)
+
+// unlinkedFile records that a file was unlinked while open. Like on a
+// local filesystem its name is gone at once, but its content stays
+// readable and writable through the open handles; the remote delete waits
+// for the last close, so nothing is read back from a deleted object and no
+// flush creates the file again.
+type unlinkedFile struct {
+	parent     *WSNode
+	name       string
+	remotePath string // deleted at the last close; empty for a file never uploaded
+}
+
+// unlinkedSet holds the names of a directory whose files were unlinked
+// while open. Lookups and listings skip them until the files are closed.
+type unlinkedSet struct {
+	mu    sync.Mutex
+	nodes map[string]*WSNode
+}
+
+func (s *unlinkedSet) add(name string, node *WSNode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nodes == nil {
+		s.nodes = make(map[string]*WSNode)
+	}
+	s.nodes[name] = node
+}
+
+func (s *unlinkedSet) has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.nodes[name]
+	return ok
+}
+
+// remove drops name if it still belongs to node.
+func (s *unlinkedSet) remove(name string, node *WSNode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nodes[name] == node {
+		delete(s.nodes, name)
+	}
+}
+
+func (s *unlinkedSet) take(name string) *WSNode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node := s.nodes[name]
+	delete(s.nodes, name)
+	return node
+}
+
+func (s *unlinkedSet) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.nodes))
+	for name := range s.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// deferDeleteLocked unlinks the open file node from n under name. The
+// remote delete of remotePath runs at the last Release. node.mu must be
+// held.
+func (n *WSNode) deferDeleteLocked(node *WSNode, name, remotePath string) {
+	node.unlinked = &unlinkedFile{parent: n, name: name, remotePath: remotePath}
+	node.createPath = ""
+	node.bulkEligible = false
+	node.bulkPending = false
+	// The content stays in the buffer for the open handles, but is not
+	// uploaded anywhere any more.
+	node.clearDirtyLocked()
+	n.unlinkedChildren.add(name, node)
+	logging.Debugf("Unlink of open file %s deferred to its last close", remotePath)
+}
+
+// finishUnlinkLocked runs the delete deferred by Unlink, at the last
+// Release of n, and drops the buffer.
+func (n *WSNode) finishUnlinkLocked(ctx context.Context) syscall.Errno {
+	unlinked := n.unlinked
+	n.unlinked = nil
+	n.resetBufferLocked()
+	unlinked.parent.unlinkedChildren.remove(unlinked.name, n)
+	if unlinked.remotePath == "" {
+		return 0
+	}
+	return n.deleteUnlinkedLocked(ctx, unlinked.remotePath)
+}
+
+func (n *WSNode) deleteUnlinkedLocked(ctx context.Context, remotePath string) syscall.Errno {
+	opCtx, cancel := context.WithTimeout(ctx, metadataOpTimeout)
+	defer cancel()
+	if err := n.wfClient.Delete(opCtx, remotePath, false); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logging.Warnf("Deferred delete of %s failed: %v", remotePath, err)
+		n.recordErrorLocked(backendOpDelete, err)
+		return errnoFromBackendError(backendOpDelete, err)
+	}
+	n.deleteDiskCacheEntries(remotePath)
+	logging.Debugf("Deleted %s at its last close", remotePath)
+	return 0
+}
+
+// deleteUnlinkedNow runs the deferred delete of name before the name is
+// used again by a create, mkdir or rename, so the last close of the old
+// file does not delete the new one. The old file's content is loaded into
+// memory first, for the handles still open.
+func (n *WSNode) deleteUnlinkedNow(ctx context.Context, name string) syscall.Errno {
+	node := n.unlinkedChildren.take(name)
+	if node == nil {
+		return 0
+	}
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if node.unlinked == nil || node.unlinked.remotePath == "" {
+		return 0
+	}
+	remotePath := node.unlinked.remotePath
+	if errno := node.ensureDataForMutationLocked(ctx); errno != 0 {
+		logging.Warnf("Could not keep the content of unlinked %s for its open handles: %v", remotePath, errno)
+	}
+	node.clearCachedFileLocked()
+	node.unlinked.remotePath = ""
+	return node.deleteUnlinkedLocked(ctx, remotePath)
+}
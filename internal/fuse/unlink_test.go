@@ -0,0 +1,120 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func openChild(t *testing.T, root *WSNode, name string) *WSNode {
+	t.Helper()
+	ctx := context.Background()
+	child, errno := root.Lookup(ctx, name, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("Lookup %s errno %d", name, errno)
+	}
+	root.AddChild(name, child, true)
+	node := child.Operations().(*WSNode)
+	if _, _, errno := node.Open(ctx, syscall.O_RDWR); errno != 0 {
+		t.Fatalf("Open %s errno %d", name, errno)
+	}
+	return node
+}
+
+func TestUnlinkOfOpenFileDefersDelete(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{"open.txt": "original", "other.txt": "x"}, nil)
+	ctx := context.Background()
+
+	node := openChild(t, root, "open.txt")
+	if errno := root.Unlink(ctx, "open.txt"); errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	root.RmChild("open.txt")
+
+	if _, err := os.Stat(filepath.Join(dir, "open.txt")); err != nil {
+		t.Fatalf("open.txt deleted before its last close: %v", err)
+	}
+	if _, errno := root.Lookup(ctx, "open.txt", &fuse.EntryOut{}); errno != syscall.ENOENT {
+		t.Fatalf("Lookup after unlink errno %d, want ENOENT", errno)
+	}
+	if got := readdirNames(t, root); !reflect.DeepEqual(got, []string{"other.txt"}) {
+		t.Fatalf("listing after unlink = %v", got)
+	}
+
+	// The open handle still reads and writes the file, without uploading.
+	if got := readNodeText(t, node); got != "original" {
+		t.Fatalf("read after unlink = %q", got)
+	}
+	if _, errno := node.Write(ctx, nil, []byte("ORIG"), 0); errno != 0 {
+		t.Fatalf("Write errno %d", errno)
+	}
+	if errno := node.Fsync(ctx, nil, 0); errno != 0 {
+		t.Fatalf("Fsync errno %d", errno)
+	}
+	if got := readNodeText(t, node); got != "ORIGinal" {
+		t.Fatalf("read after write = %q", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "open.txt")); string(got) != "original" {
+		t.Fatalf("workspace content = %q, want it untouched", got)
+	}
+
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "open.txt")); !os.IsNotExist(err) {
+		t.Fatalf("open.txt survived its last close: %v", err)
+	}
+	if root.unlinkedChildren.has("open.txt") {
+		t.Fatal("name still hidden after the last close")
+	}
+}
+
+func TestCreateOverUnlinkedOpenFileKeepsNewFile(t *testing.T) {
+	root, dir := newNameFixture(t, map[string]string{"a.txt": "old"}, nil)
+	ctx := context.Background()
+
+	old := openChild(t, root, "a.txt")
+	if errno := root.Unlink(ctx, "a.txt"); errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	root.RmChild("a.txt")
+
+	created := createAndWrite(t, root, "a.txt", "new")
+	if got := readNodeText(t, old); got != "old" {
+		t.Fatalf("unlinked handle reads %q after the name was reused", got)
+	}
+	if errno := created.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release of the new file errno %d", errno)
+	}
+	if errno := old.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release of the unlinked file errno %d", errno)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(got) != "new" {
+		t.Fatalf("a.txt = %q, %v; want the new file", got, err)
+	}
+}
+
+func TestUnlinkOfOpenNewFileKeepsContentLocal(t *testing.T) {
+	root, dir := newNameFixture(t, nil, nil)
+	ctx := context.Background()
+
+	node := createAndWrite(t, root, "draft.txt", "draft")
+	if errno := root.Unlink(ctx, "draft.txt"); errno != 0 {
+		t.Fatalf("Unlink errno %d", errno)
+	}
+	root.RmChild("draft.txt")
+	if got := readNodeText(t, node); got != "draft" {
+		t.Fatalf("read after unlink = %q", got)
+	}
+	if errno := node.Release(ctx, nil); errno != 0 {
+		t.Fatalf("Release errno %d", errno)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("workspace = %v, %v, want it empty", entries, err)
+	}
+}
@@ -0,0 +1,136 @@
+package fuse
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"wsfs/internal/filecache"
+)
+
+// dirtyXattr is set on files with changes that are not uploaded yet. Its
+// value is the time the buffer became dirty.
+const dirtyXattr = "user.wsfs.dirty"
+
+// sha256Xattr is the SHA-256 of a file's content, as reads through the mount
+// return it, in hex. It is computed on request: from memory or the disk
+// cache when the content is local, otherwise by downloading the content into
+// the cache, where later reads find it. It is not listed, so tools that copy
+// every extended attribute do not download whole trees for it.
+const sha256Xattr = "user.wsfs.sha256"
+
+// xattrNames lists the extended attributes wsfs provides, in listing order.
+var xattrNames = []string{lastErrorXattr, dirtyXattr}
+
+// xattrLocked returns the value of a wsfs extended attribute, if it is set
+// on this node.
+func (n *WSNode) xattrLocked(attr string) (string, bool) {
+	switch attr {
+	case lastErrorXattr:
+		if n.lastError != nil {
+			return n.lastError.String(), true
+		}
+	case dirtyXattr:
+		if since, ok := n.dirtySinceLocked(); ok {
+			return since.UTC().Format(time.RFC3339), true
+		}
+	}
+	return "", false
+}
+
+// sha256Locked returns the value of sha256Xattr for a file.
+func (n *WSNode) sha256Locked(ctx context.Context) (string, syscall.Errno) {
+	if n.fileInfo.IsDir() {
+		return "", syscall.ENODATA
+	}
+	if _, errno := n.refreshMetadataLocked(ctx, false); errno != 0 {
+		return "", errno
+	}
+	if !n.isDirtyLocked() && n.buf.RemoteChecksum != "" && n.buf.RemoteModifiedAt == n.fileInfo.ModifiedAt {
+		return n.buf.RemoteChecksum, 0
+	}
+	if errno := n.ensureDataLocked(ctx); errno != 0 {
+		return "", errno
+	}
+	if n.buf.Data != nil {
+		return filecache.CalculateChecksum(n.buf.Data), 0
+	}
+	if n.buf.CachedChecksum != "" {
+		return n.buf.CachedChecksum, 0
+	}
+	f, err := os.Open(n.buf.CachedPath)
+	if err != nil {
+		return "", syscall.EIO
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", syscall.EIO
+	}
+	return hex.EncodeToString(h.Sum(nil)), 0
+}
+
+func (n *WSNode) dirtySinceLocked() (time.Time, bool) {
+	if !n.isDirtyLocked() || n.registry == nil {
+		return time.Time{}, false
+	}
+	return n.registry.DirtySince(n)
+}
+
+// bufferedSizeLocked is the size of the file including unflushed changes.
+func (n *WSNode) bufferedSizeLocked() int64 {
+	if n.buf.Data != nil {
+		return int64(len(n.buf.Data))
+	}
+	return n.fileInfo.Size()
+}
+
+func (n *WSNode) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	if attr == sha256Xattr {
+		if errno := n.checkCaller(ctx); errno != 0 {
+			return 0, errno
+		}
+	}
+	n.mu.Lock()
+	var value string
+	errno := syscall.Errno(0)
+	if attr == sha256Xattr {
+		value, errno = n.sha256Locked(ctx)
+	} else if v, ok := n.xattrLocked(attr); ok {
+		value = v
+	} else {
+		errno = syscall.ENODATA
+	}
+	n.mu.Unlock()
+	if errno != 0 {
+		return 0, errno
+	}
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+	return uint32(copy(dest, value)), 0
+}
+
+func (n *WSNode) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	var list strings.Builder
+	n.mu.Lock()
+	for _, name := range xattrNames {
+		if _, ok := n.xattrLocked(name); ok {
+			list.WriteString(name)
+			list.WriteByte(0)
+		}
+	}
+	n.mu.Unlock()
+	if list.Len() == 0 {
+		return 0, 0
+	}
+	if len(dest) < list.Len() {
+		return uint32(list.Len()), syscall.ERANGE
+	}
+	return uint32(copy(dest, list.String())), 0
+}
@@ -0,0 +1,129 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"wsfs/internal/filecache"
+)
+
+func TestDirtyXattrFollowsUnflushedChanges(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+	node := f.lookup("src", "main.py")
+
+	if _, errno := node.Getxattr(ctx, dirtyXattr, make([]byte, 64)); errno != syscall.ENODATA {
+		t.Fatalf("clean file: expected ENODATA, got %d", errno)
+	}
+
+	before := time.Now().Add(-time.Second)
+	f.write(node, "print('edited')\n")
+	dest := make([]byte, 64)
+	size, errno := node.Getxattr(ctx, dirtyXattr, dest)
+	if errno != 0 {
+		t.Fatalf("Getxattr errno %d", errno)
+	}
+	since, err := time.Parse(time.RFC3339, string(dest[:size]))
+	if err != nil || since.Before(before.Truncate(time.Second)) || since.After(time.Now()) {
+		t.Fatalf("dirty xattr = %q, %v", dest[:size], err)
+	}
+
+	// A second write keeps the time the buffer first became dirty.
+	f.write(node, "print('again')\n")
+	if again, _ := node.Getxattr(ctx, dirtyXattr, dest); string(dest[:again]) != since.UTC().Format(time.RFC3339) {
+		t.Fatalf("dirty time changed to %q", dest[:again])
+	}
+
+	node.mu.Lock()
+	node.recordErrorLocked(backendOpWrite, errors.New("boom"))
+	node.mu.Unlock()
+	size, errno = node.Listxattr(ctx, dest)
+	if errno != 0 || string(dest[:size]) != lastErrorXattr+"\x00"+dirtyXattr+"\x00" {
+		t.Fatalf("unexpected xattr list %q errno=%d", dest[:size], errno)
+	}
+	if size, errno := node.Listxattr(ctx, make([]byte, 4)); errno != syscall.ERANGE || int(size) != len(lastErrorXattr+dirtyXattr)+2 {
+		t.Fatalf("expected ERANGE with the list size, got size=%d errno=%d", size, errno)
+	}
+
+	if _, errs := f.root.FlushPaths(ctx, nil); len(errs) != 0 {
+		t.Fatalf("FlushPaths: %v", errs)
+	}
+	if _, errno := node.Getxattr(ctx, dirtyXattr, dest); errno != syscall.ENODATA {
+		t.Fatalf("flushed file: expected ENODATA, got %d", errno)
+	}
+}
+
+func TestSHA256XattrComputesContentChecksum(t *testing.T) {
+	f := newManageFixture(t)
+	ctx := context.Background()
+	node := f.lookup("src", "main.py")
+	getSHA := func() string {
+		t.Helper()
+		dest := make([]byte, 64)
+		size, errno := node.Getxattr(ctx, sha256Xattr, dest)
+		if errno != 0 {
+			t.Fatalf("Getxattr errno %d", errno)
+		}
+		return string(dest[:size])
+	}
+
+	if size, errno := node.Getxattr(ctx, sha256Xattr, nil); errno != syscall.ERANGE || size != 64 {
+		t.Fatalf("size probe = %d, errno %d; want 64 and ERANGE", size, errno)
+	}
+	if got, want := getSHA(), filecache.CalculateChecksum([]byte("print('main')\n")); got != want {
+		t.Fatalf("sha256 of a cold file = %q, want %q", got, want)
+	}
+	if _, _, found := f.cache.Get("/src/main.py", node.fileInfo.ModTime()); !found {
+		t.Fatal("content read for the checksum was not kept in the disk cache")
+	}
+
+	f.write(node, "print('edited')\n")
+	if got, want := getSHA(), filecache.CalculateChecksum([]byte("print('edited')\n")); got != want {
+		t.Fatalf("sha256 of a dirty file = %q, want the checksum of the buffer %q", got, want)
+	}
+
+	dest := make([]byte, 256)
+	size, errno := node.Listxattr(ctx, dest)
+	if errno != 0 || strings.Contains(string(dest[:size]), sha256Xattr) {
+		t.Fatalf("sha256 must not be listed: %q, errno %d", dest[:size], errno)
+	}
+	if _, errno := f.lookup("src").Getxattr(ctx, sha256Xattr, make([]byte, 64)); errno != syscall.ENODATA {
+		t.Fatalf("directory sha256 errno %d, want ENODATA", errno)
+	}
+}
+
+func TestControlDirtyListsUnflushedFiles(t *testing.T) {
+	f := newManageFixture(t)
+	render, ok := f.root.controlFiles()["dirty"]
+	if !ok {
+		t.Fatal("expected dirty control file")
+	}
+	if got := render(); len(got) != 0 {
+		t.Fatalf("expected no dirty files, got %q", got)
+	}
+
+	f.write(f.lookup("src", "main.py"), "print('edited')\n")
+	f.write(f.lookup("top-level.txt"), "x")
+
+	lines := strings.Split(strings.TrimSuffix(string(render()), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 dirty files, got %q", lines)
+	}
+	fields := strings.Split(lines[0], "\t")
+	if len(fields) != 4 || fields[0] != "/src/main.py" || fields[3] != "16 bytes" {
+		t.Fatalf("unexpected first line %q", lines[0])
+	}
+	if _, err := time.Parse(time.RFC3339, fields[1]); err != nil {
+		t.Fatalf("bad dirty time %q: %v", fields[1], err)
+	}
+	if _, err := time.ParseDuration(fields[2]); err != nil {
+		t.Fatalf("bad age %q: %v", fields[2], err)
+	}
+	if !strings.HasPrefix(lines[1], "/top-level.txt\t") || !strings.HasSuffix(lines[1], "\t4 bytes") {
+		t.Fatalf("unexpected second line %q", lines[1])
+	}
+}
@@ -1,8 +1,12 @@
 package logging
 
 import (
+	"fmt"
 	"log"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // LogLevel represents the logging verbosity level.
@@ -51,6 +55,107 @@ func ParseLevel(s string) LogLevel {
 	}
 }
 
+// ParseLevelSpec parses a --log-level value: a base level optionally
+// followed by per-module overrides, e.g. "warn,fuse=debug,databricks=info".
+// A spec of only overrides keeps the base level at info. Unlike ParseLevel,
+// unrecognized levels are errors.
+func ParseLevelSpec(spec string) (LogLevel, map[string]LogLevel, error) {
+	base := LevelInfo
+	modules := make(map[string]LogLevel)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		module, value, isOverride := strings.Cut(part, "=")
+		level, err := parseLevelStrict(value)
+		if !isOverride {
+			level, err = parseLevelStrict(module)
+		}
+		if err != nil {
+			return LevelInfo, nil, err
+		}
+		if !isOverride {
+			base = level
+			continue
+		}
+		module = strings.TrimSpace(module)
+		if module == "" {
+			return LevelInfo, nil, fmt.Errorf("missing module name in %q", part)
+		}
+		modules[module] = level
+	}
+	return base, modules, nil
+}
+
+func parseLevelStrict(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug", "info", "warn", "warning", "error":
+		return ParseLevel(strings.TrimSpace(s)), nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (want debug, info, warn, or error)", s)
+}
+
+// moduleLevels holds per-module overrides of Level, keyed by the last
+// element of the calling package's import path ("fuse", "databricks", ...).
+var moduleLevels atomic.Pointer[map[string]LogLevel]
+
+// SetModuleLevels replaces the per-module overrides. Modules without an
+// override use Level. A nil or empty map removes all overrides.
+func SetModuleLevels(levels map[string]LogLevel) {
+	if len(levels) == 0 {
+		moduleLevels.Store(nil)
+		return
+	}
+	copied := make(map[string]LogLevel, len(levels))
+	for module, level := range levels {
+		copied[module] = level
+	}
+	moduleLevels.Store(&copied)
+}
+
+// callerModules caches the module of each logging call site.
+var callerModules sync.Map // map[uintptr]string
+
+// enabled reports whether a message at level from the function that called
+// the exported logging function should be written. Call sites are only
+// resolved when overrides are set, so the common case stays cheap.
+func enabled(level LogLevel) bool {
+	if levels := moduleLevels.Load(); levels != nil {
+		if override, ok := (*levels)[callerModule()]; ok {
+			return override <= level
+		}
+	}
+	return Level <= level || (level == LevelDebug && DebugLogs)
+}
+
+// callerModule returns the module of the caller of Debugf, Infof or Warnf.
+func callerModule() string {
+	var pcs [1]uintptr
+	// Skip runtime.Callers, callerModule, enabled, and the logging function.
+	if runtime.Callers(4, pcs[:]) == 0 {
+		return ""
+	}
+	if module, ok := callerModules.Load(pcs[0]); ok {
+		return module.(string)
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	module := moduleOf(frame.Function)
+	callerModules.Store(pcs[0], module)
+	return module
+}
+
+// moduleOf maps a qualified function name such as
+// "wsfs/internal/fuse.(*WSNode).Lookup" to its module, "fuse".
+func moduleOf(function string) string {
+	pkg := function
+	slash := strings.LastIndex(pkg, "/")
+	if dot := strings.Index(pkg[slash+1:], "."); dot >= 0 {
+		pkg = pkg[:slash+1+dot]
+	}
+	return pkg[slash+1:]
+}
+
 // String returns the string representation of a LogLevel.
 func (l LogLevel) String() string {
 	switch l {
@@ -67,23 +172,25 @@ func (l LogLevel) String() string {
 	}
 }
 
-// Debugf logs a debug message if the current level is DEBUG.
+// Debugf logs a debug message if the caller's module level is DEBUG.
 func Debugf(format string, args ...any) {
-	if Level <= LevelDebug || DebugLogs {
+	if enabled(LevelDebug) {
 		log.Printf("[DEBUG] "+format, args...)
 	}
 }
 
-// Infof logs an informational message if the current level is INFO or below.
+// Infof logs an informational message if the caller's module level is INFO
+// or below.
 func Infof(format string, args ...any) {
-	if Level <= LevelInfo {
+	if enabled(LevelInfo) {
 		log.Printf("[INFO] "+format, args...)
 	}
 }
 
-// Warnf logs a warning message if the current level is WARN or below.
+// Warnf logs a warning message if the caller's module level is WARN or
+// below.
 func Warnf(format string, args ...any) {
-	if Level <= LevelWarn {
+	if enabled(LevelWarn) {
 		log.Printf("[WARN] "+format, args...)
 	}
 }
@@ -3,6 +3,7 @@ package logging
 import (
 	"bytes"
 	"log"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -173,3 +174,90 @@ func TestLoggingDebugEnabled(t *testing.T) {
 		t.Fatal("expected debug log when DebugLogs enabled")
 	}
 }
+
+func TestParseLevelSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		base    LogLevel
+		modules map[string]LogLevel
+	}{
+		{"", LevelInfo, map[string]LogLevel{}},
+		{"warn", LevelWarn, map[string]LogLevel{}},
+		{"fuse=debug", LevelInfo, map[string]LogLevel{"fuse": LevelDebug}},
+		{"warn,fuse=debug,databricks=info", LevelWarn, map[string]LogLevel{"fuse": LevelDebug, "databricks": LevelInfo}},
+		{" error , filecache = WARN ", LevelError, map[string]LogLevel{"filecache": LevelWarn}},
+	}
+	for _, tt := range tests {
+		base, modules, err := ParseLevelSpec(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseLevelSpec(%q): %v", tt.spec, err)
+		}
+		if base != tt.base || !reflect.DeepEqual(modules, tt.modules) {
+			t.Fatalf("ParseLevelSpec(%q) = %v %v, want %v %v", tt.spec, base, modules, tt.base, tt.modules)
+		}
+	}
+
+	for _, spec := range []string{"verbose", "fuse=loud", "=debug", "info,fuse"} {
+		if _, _, err := ParseLevelSpec(spec); err == nil {
+			t.Fatalf("ParseLevelSpec(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestModuleOf(t *testing.T) {
+	tests := map[string]string{
+		"wsfs/internal/fuse.(*WSNode).Lookup":      "fuse",
+		"wsfs/internal/databricks.NewClient.func1": "databricks",
+		"wsfs/internal/filecache.(*DiskCache).Get": "filecache",
+		"main.run": "main",
+		"github.com/hanwen/go-fuse/v2/fs.(*x).Read": "fs",
+	}
+	for function, want := range tests {
+		if got := moduleOf(function); got != want {
+			t.Fatalf("moduleOf(%q) = %q, want %q", function, got, want)
+		}
+	}
+}
+
+func TestModuleLevelsOverrideBaseLevel(t *testing.T) {
+	origLevel := Level
+	origDebugLogs := DebugLogs
+	origOutput := log.Writer()
+	origFlags := log.Flags()
+	t.Cleanup(func() {
+		Level = origLevel
+		DebugLogs = origDebugLogs
+		SetModuleLevels(nil)
+		log.SetOutput(origOutput)
+		log.SetFlags(origFlags)
+	})
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+
+	// This test runs in the logging package, so its module is "logging".
+	SetLevel(LevelError)
+	SetModuleLevels(map[string]LogLevel{"logging": LevelDebug})
+	Debugf("raised")
+	if !strings.Contains(buf.String(), "[DEBUG] raised") {
+		t.Fatalf("expected the module override to enable debug, got %q", buf.String())
+	}
+
+	buf.Reset()
+	SetLevel(LevelDebug)
+	SetModuleLevels(map[string]LogLevel{"logging": LevelWarn, "fuse": LevelDebug})
+	Debugf("lowered")
+	Infof("lowered")
+	Warnf("kept")
+	if got := buf.String(); got != "[WARN] kept\n" {
+		t.Fatalf("expected only the warning, got %q", got)
+	}
+
+	buf.Reset()
+	SetModuleLevels(map[string]LogLevel{"fuse": LevelError})
+	Debugf("base")
+	if !strings.Contains(buf.String(), "[DEBUG] base") {
+		t.Fatalf("expected modules without an override to use the base level, got %q", buf.String())
+	}
+}
@@ -1,16 +1,37 @@
 package metacache
 
 import (
+	"container/list"
 	"io/fs"
 	"path"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+
+	"wsfs/internal/metrics"
+	"wsfs/internal/pathutil"
 )
 
-// defaultMaxEntries is the default maximum number of direct path entries in the cache.
+// defaultMaxEntries is the default maximum number of entries, stat results
+// and directory listings together, in the cache.
 const defaultMaxEntries = 10000
 
+// defaultMaxBytes is the default bound on the approximate memory held by the
+// cache.
+const defaultMaxBytes = 64 << 20
+
+// maxFences bounds how many recent invalidations are remembered for the
+// conditional Set methods. Older fills are dropped conservatively.
+const maxFences = 256
+
+// Approximate memory per cached item beyond its strings: map slot, list
+// element, entry struct and the FileInfo behind the interface.
+const (
+	entryOverhead    = 200
+	dirChildOverhead = 150
+)
+
 type negativeCacheEntry struct {
 	fs.FileInfo
 }
@@ -20,6 +41,8 @@ var negativeEntry fs.FileInfo = &negativeCacheEntry{}
 type CacheEntry struct {
 	info       fs.FileInfo
 	expiration time.Time
+	size       int64
+	elem       *list.Element
 }
 
 type DirLookupEntry struct {
@@ -31,14 +54,76 @@ type dirCacheEntry struct {
 	entries    []fs.DirEntry
 	lookup     map[string]fs.FileInfo
 	expiration time.Time
+	// childExpiration ends the answers LookupDirEntry gives from the
+	// children's attributes. RenewDirEntries extends only expiration: the
+	// directory's version covers which names it holds, not their contents.
+	childExpiration time.Time
+	version         string // see SetVersionedDirEntriesIfUnchanged
+	size            int64
+	elem            *list.Element
+}
+
+// lruKey identifies an item in the recency list.
+type lruKey struct {
+	path string
+	dir  bool // a directory listing rather than a stat result
+}
+
+// fence records an invalidation so that fills fetched before it are not
+// stored after it.
+type fence struct {
+	generation uint64
+	prefixes   []string // subtrees whose entries and listings were dropped
+	dir        string   // directory whose listing and own entry were dropped
+}
+
+// Stats describes cache usage. Hits and misses count lookups through Get,
+// GetDirEntries and LookupDirEntry.
+type Stats struct {
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Evictions   int64 `json:"evictions"`   // entries dropped to stay within the limits
+	Expirations int64 `json:"expirations"` // entries dropped after their TTL
+	StaleHits   int64 `json:"stale_hits"`  // expired entries returned by GetStale and GetStaleDirEntries
+	Entries     int   `json:"entries"`
+	DirEntries  int   `json:"dir_entries"`
+	Bytes       int64 `json:"bytes"`      // approximate
+	Tombstones  int   `json:"tombstones"` // deleted paths still answered as missing; see Tombstone
+
+	NegativeHits  int64            `json:"negative_hits"` // hits answering a path is missing
+	Revalidations int64            `json:"revalidations"` // expired listings renewed by RenewDirEntries
+	Invalidations map[string]int64 `json:"invalidations"` // entries dropped by local changes, by Reason
 }
 
+// Cache holds stat results and directory listings for a TTL. It keeps at
+// most maxEntries items and about maxBytes of memory, evicting the least
+// recently used items first.
+//
+// With a stale window (see SetStaleWindow), expired items are kept that much
+// longer for GetStale and GetStaleDirEntries, while the other lookups
+// already miss them.
+//
+// Paths are stored in Unicode NFC, so callers may pass either form.
+// Invalidation also covers the notebook aliases of a path (see
+// pathutil.NotebookAliasPaths): a notebook is cached under its remote path
+// and its visible source or .ipynb path, and a caller holding one of them
+// cannot tell which others are cached.
 type Cache struct {
 	entries     map[string]*CacheEntry
 	dirEntries  map[string]*dirCacheEntry
+	lru         *list.List // of lruKey, most recently used first
+	bytes       int64
+	stats       Stats
+	dropped     [numReasons]int64 // see Stats.Invalidations
+	closed      bool
+	generation  uint64
+	fences      []fence              // oldest first
+	tombstones  map[string]time.Time // deleted path -> end of its tombstone
 	cacheTTL    time.Duration
 	negativeTTL time.Duration
+	staleWindow time.Duration
 	maxEntries  int
+	maxBytes    int64
 	mu          sync.Mutex
 }
 
@@ -56,6 +141,12 @@ func NewCacheWithMaxEntries(ttl time.Duration, maxEntries int) *Cache {
 }
 
 func NewCacheWithConfig(ttl time.Duration, negativeTTL time.Duration, maxEntries int) *Cache {
+	return NewCacheWithLimits(ttl, negativeTTL, maxEntries, defaultMaxBytes)
+}
+
+// NewCacheWithLimits creates a cache bounded by entry count and approximate
+// bytes. Non-positive limits use the defaults.
+func NewCacheWithLimits(ttl time.Duration, negativeTTL time.Duration, maxEntries int, maxBytes int64) *Cache {
 	if ttl <= 0 {
 		ttl = time.Second
 	}
@@ -65,12 +156,18 @@ func NewCacheWithConfig(ttl time.Duration, negativeTTL time.Duration, maxEntries
 	if maxEntries <= 0 {
 		maxEntries = defaultMaxEntries
 	}
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
 	return &Cache{
 		entries:     make(map[string]*CacheEntry),
 		dirEntries:  make(map[string]*dirCacheEntry),
+		tombstones:  make(map[string]time.Time),
+		lru:         list.New(),
 		cacheTTL:    ttl,
 		negativeTTL: negativeTTL,
 		maxEntries:  maxEntries,
+		maxBytes:    maxBytes,
 	}
 }
 
@@ -80,38 +177,116 @@ func (c *Cache) PositiveTTL() time.Duration {
 	return c.cacheTTL
 }
 
+// SetStaleWindow keeps items for window past their TTL, the hard cap on
+// how stale GetStale and GetStaleDirEntries answers may be. Zero, the
+// default, drops items when they expire.
+func (c *Cache) SetStaleWindow(window time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.staleWindow = max(window, 0)
+}
+
 func (c *Cache) Get(path string) (fs.FileInfo, bool) {
+	path = cacheKey(path)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	entry, found := c.entries[path]
-	if !found {
+	if c.tombstonedLocked(path) {
+		c.tombstoneHitLocked()
+		return nil, true
+	}
+	entry, found := c.liveEntryLocked(path)
+	if !found || time.Now().After(entry.expiration) {
+		c.missLocked()
 		return nil, false
 	}
 
-	if time.Now().After(entry.expiration) {
-		delete(c.entries, path)
+	c.hitLocked(entry.elem)
+	if entry.info == negativeEntry {
+		c.negativeHitLocked()
+		return nil, true
+	}
+
+	return entry.info, true
+}
+
+// GetStale is Get for an item that expired less than the stale window ago.
+// The caller is expected to refresh it.
+func (c *Cache) GetStale(path string) (fs.FileInfo, bool) {
+	path = cacheKey(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tombstonedLocked(path) {
+		c.tombstoneHitLocked()
+		return nil, true
+	}
+	entry, found := c.liveEntryLocked(path)
+	if !found {
+		c.missLocked()
 		return nil, false
 	}
 
+	c.staleHitLocked(entry.elem, entry.expiration)
 	if entry.info == negativeEntry {
+		c.negativeHitLocked()
 		return nil, true
 	}
-
 	return entry.info, true
 }
 
+// liveEntryLocked returns the entry of path unless it expired more than the
+// stale window ago, dropping it then.
+func (c *Cache) liveEntryLocked(path string) (*CacheEntry, bool) {
+	entry, found := c.entries[path]
+	if !found {
+		return nil, false
+	}
+	if time.Now().After(entry.expiration.Add(c.staleWindow)) {
+		c.removeEntryLocked(path)
+		c.expiredLocked()
+		return nil, false
+	}
+	return entry, true
+}
+
 func (c *Cache) Set(path string, info fs.FileInfo) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.setLocked(cacheKey(path), info)
+}
+
+// Generation returns a token for SetIfUnchanged and SetDirEntriesIfUnchanged.
+// Take it before fetching what will be stored.
+func (c *Cache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// SetIfUnchanged stores info like Set unless an invalidation covering path
+// happened after generation was taken, so a stat fetched before a delete or
+// rename cannot bring the old entry back.
+func (c *Cache) SetIfUnchanged(generation uint64, path string, info fs.FileInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path = cacheKey(path)
+	if c.invalidatedSinceLocked(generation, path) {
+		return
+	}
 	c.setLocked(path, info)
 }
 
 func (c *Cache) setLocked(path string, info fs.FileInfo) {
-	if _, exists := c.entries[path]; !exists && len(c.entries) >= c.maxEntries {
-		c.evictOldestLocked()
+	if c.closed {
+		return
+	}
+	if info != nil && c.tombstonedLocked(path) {
+		return
 	}
+	c.removeEntryLocked(path)
 
 	expiration := time.Now().Add(c.cacheTTL)
 	entryInfo := info
@@ -119,125 +294,582 @@ func (c *Cache) setLocked(path string, info fs.FileInfo) {
 		expiration = time.Now().Add(c.negativeTTL)
 		entryInfo = negativeEntry
 	}
-	c.entries[path] = &CacheEntry{info: entryInfo, expiration: expiration}
+	entry := &CacheEntry{info: entryInfo, expiration: expiration, size: entrySize(path, info)}
+	if entry.size > c.maxBytes {
+		return
+	}
+	entry.elem = c.lru.PushFront(lruKey{path: path})
+	c.entries[path] = entry
+	c.bytes += entry.size
+	c.evictLocked()
 }
 
 func (c *Cache) SetDirEntries(dirPath string, entries []fs.DirEntry, lookups []DirLookupEntry) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.setDirEntriesLocked(cacheKey(dirPath), "", entries, lookups)
+}
+
+// SetDirEntriesIfUnchanged stores a listing like SetDirEntries unless an
+// invalidation covering dirPath happened after generation was taken.
+func (c *Cache) SetDirEntriesIfUnchanged(generation uint64, dirPath string, entries []fs.DirEntry, lookups []DirLookupEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dirPath = cacheKey(dirPath)
+	if c.invalidatedSinceLocked(generation, dirPath) {
+		return
+	}
+	c.setDirEntriesLocked(dirPath, "", entries, lookups)
+}
+
+// SetVersionedDirEntriesIfUnchanged is SetDirEntriesIfUnchanged for a
+// listing taken at the given version of its directory, an opaque token
+// that changes whenever the directory's entries do. Take the version
+// before the listing. Once the listing expires it is kept, until an
+// invalidation or eviction drops it, for ExpiredDirVersion and
+// RenewDirEntries. An empty version stores an ordinary listing.
+func (c *Cache) SetVersionedDirEntriesIfUnchanged(generation uint64, dirPath, version string, entries []fs.DirEntry, lookups []DirLookupEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dirPath = cacheKey(dirPath)
+	if c.invalidatedSinceLocked(generation, dirPath) {
+		return
+	}
+	c.setDirEntriesLocked(dirPath, version, entries, lookups)
+}
+
+func (c *Cache) setDirEntriesLocked(dirPath, version string, entries []fs.DirEntry, lookups []DirLookupEntry) {
+	if c.closed {
+		return
+	}
+	c.removeDirLocked(dirPath)
+
+	expiration := time.Now().Add(c.cacheTTL)
 	entry := &dirCacheEntry{
-		entries:    cloneDirEntries(entries),
-		lookup:     make(map[string]fs.FileInfo, len(lookups)),
-		expiration: time.Now().Add(c.cacheTTL),
+		entries:         cloneDirEntries(entries),
+		lookup:          make(map[string]fs.FileInfo, len(lookups)),
+		expiration:      expiration,
+		childExpiration: expiration,
+		version:         version,
 	}
 	for _, lookup := range lookups {
 		if lookup.Name == "" {
 			continue
 		}
-		entry.lookup[lookup.Name] = lookup.Info
+		entry.lookup[cacheKey(lookup.Name)] = lookup.Info
+	}
+	entry.size = dirSize(dirPath, entries, lookups)
+	// A listing larger than the whole cache would only evict everything
+	// else and then itself.
+	if entry.size > c.maxBytes {
+		return
 	}
+	entry.elem = c.lru.PushFront(lruKey{path: dirPath, dir: true})
 	c.dirEntries[dirPath] = entry
+	c.bytes += entry.size
+	c.evictLocked()
 }
 
 func (c *Cache) GetDirEntries(dirPath string) ([]fs.DirEntry, bool) {
+	dirPath = cacheKey(dirPath)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	entry, found := c.dirEntries[dirPath]
+	entry, found := c.freshDirLocked(dirPath)
 	if !found {
+		c.missLocked()
 		return nil, false
 	}
-	if time.Now().After(entry.expiration) {
-		delete(c.dirEntries, dirPath)
+	c.hitLocked(entry.elem)
+	return cloneDirEntries(entry.entries), true
+}
+
+// GetStaleDirEntries is GetDirEntries for a listing that expired less than
+// the stale window ago. The caller is expected to refresh it.
+func (c *Cache) GetStaleDirEntries(dirPath string) ([]fs.DirEntry, bool) {
+	dirPath = cacheKey(dirPath)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.liveDirLocked(dirPath)
+	if !found {
+		c.missLocked()
+		return nil, false
+	}
+	c.staleHitLocked(entry.elem, entry.expiration)
+	return cloneDirEntries(entry.entries), true
+}
+
+// ExpiredDirVersion returns the version of the expired listing of dirPath
+// kept for RenewDirEntries, or "" when there is none.
+func (c *Cache) ExpiredDirVersion(dirPath string) string {
+	dirPath = cacheKey(dirPath)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.dirEntries[dirPath]
+	if !found || !time.Now().After(entry.expiration) {
+		return ""
+	}
+	return entry.version
+}
+
+// RenewDirEntries makes the expired listing of dirPath fresh for another
+// TTL and returns it, if it was taken at version and no invalidation
+// covering dirPath happened after generation was taken. The caller checks
+// the directory is still at version first; take generation before that.
+func (c *Cache) RenewDirEntries(generation uint64, dirPath, version string) ([]fs.DirEntry, bool) {
+	dirPath = cacheKey(dirPath)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.dirEntries[dirPath]
+	if !found || version == "" || entry.version != version || c.invalidatedSinceLocked(generation, dirPath) {
 		return nil, false
 	}
+	entry.expiration = time.Now().Add(c.cacheTTL)
+	c.lru.MoveToFront(entry.elem)
+	c.stats.Revalidations++
+	metrics.MetadataCacheRevalidations.Add(1)
 	return cloneDirEntries(entry.entries), true
 }
 
+// Peek returns what the cache knows about path, from its stat entry or its
+// parent's listing, however long ago that expired. It answers nothing for
+// a missing path and counts no lookup: an old answer is only good to
+// compare against a fresh one.
+func (c *Cache) Peek(filePath string) (fs.FileInfo, bool) {
+	filePath = cacheKey(filePath)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, found := c.entries[filePath]; found && entry.info != negativeEntry {
+		return entry.info, true
+	}
+	if entry, found := c.dirEntries[path.Dir(filePath)]; found {
+		if info, ok := entry.lookup[path.Base(filePath)]; ok && info != nil {
+			return info, true
+		}
+	}
+	return nil, false
+}
+
 // LookupDirEntry looks up a child by parent directory cache.
 // If the parent directory cache is fresh, found is true. A nil info with found=true means
 // the parent directory was cached and the child name was absent.
 func (c *Cache) LookupDirEntry(filePath string) (fs.FileInfo, bool) {
+	filePath = cacheKey(filePath)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	parent := path.Dir(filePath)
 	name := path.Base(filePath)
 
-	entry, found := c.dirEntries[parent]
-	if !found {
-		return nil, false
+	if c.tombstonedLocked(filePath) {
+		c.tombstoneHitLocked()
+		return nil, true
 	}
-	if time.Now().After(entry.expiration) {
-		delete(c.dirEntries, parent)
+	entry, found := c.freshDirLocked(parent)
+	if !found {
+		c.missLocked()
 		return nil, false
 	}
 
 	info, ok := entry.lookup[name]
+	if ok && time.Now().After(entry.childExpiration) {
+		// A renewed listing answers for names, not attributes.
+		c.missLocked()
+		return nil, false
+	}
+	c.hitLocked(entry.elem)
 	if !ok {
+		c.negativeHitLocked()
 		return nil, true
 	}
 	return info, true
 }
 
-func (c *Cache) Invalidate(filePath string) {
+// freshDirLocked returns the cached listing of dirPath unless it has
+// expired.
+func (c *Cache) freshDirLocked(dirPath string) (*dirCacheEntry, bool) {
+	entry, found := c.liveDirLocked(dirPath)
+	if !found || time.Now().After(entry.expiration) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// liveDirLocked returns the cached listing of dirPath unless it expired
+// more than the stale window ago, dropping it then.
+func (c *Cache) liveDirLocked(dirPath string) (*dirCacheEntry, bool) {
+	entry, found := c.dirEntries[dirPath]
+	if !found {
+		return nil, false
+	}
+	if time.Now().After(entry.expiration.Add(c.staleWindow)) {
+		if entry.version != "" {
+			// Kept for RenewDirEntries.
+			return nil, false
+		}
+		c.removeDirLocked(dirPath)
+		c.expiredLocked()
+		return nil, false
+	}
+	return entry, true
+}
+
+// Invalidate drops filePath and everything below it, its notebook aliases,
+// and the listing and entry of its parent directory, in one step. The
+// entries dropped are counted under reason.
+func (c *Cache) Invalidate(reason Reason, filePath string) {
+	filePath = cacheKey(filePath)
+	prefixes := pathutil.NotebookAliasPaths(filePath)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.invalidateLocked(filePath)
+	dropped := c.invalidatePrefixLocked(prefixes)
+	dropped += c.invalidateDirLocked(path.Dir(filePath))
+	c.countDroppedLocked(reason, dropped)
+	c.liftTombstonesLocked(prefixes)
+	c.addFenceLocked(fence{prefixes: prefixes, dir: path.Dir(filePath)})
 }
 
-func (c *Cache) invalidateLocked(filePath string) {
-	delete(c.entries, filePath)
-	delete(c.dirEntries, filePath)
+// InvalidatePrefix drops the stat entries and listings of prefix and of
+// every path below it, such as a deleted or renamed directory tree, and
+// those of its notebook aliases.
+func (c *Cache) InvalidatePrefix(reason Reason, prefix string) {
+	prefixes := pathutil.NotebookAliasPaths(cacheKey(prefix))
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	parent := path.Dir(filePath)
-	delete(c.entries, parent)
-	delete(c.dirEntries, parent)
+	c.countDroppedLocked(reason, c.invalidatePrefixLocked(prefixes))
+	c.liftTombstonesLocked(prefixes)
+	c.addFenceLocked(fence{prefixes: prefixes})
+}
+
+// InvalidateDir drops the listing of dirPath and its own stat entry, whose
+// size and modification time change with its children.
+func (c *Cache) InvalidateDir(reason Reason, dirPath string) {
+	dirPath = cacheKey(dirPath)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.countDroppedLocked(reason, c.invalidateDirLocked(dirPath))
+	c.addFenceLocked(fence{dir: dirPath})
+}
+
+// Tombstone records that filePath, the tree below it and its notebook
+// aliases were deleted. For the positive TTL, as long as a stat fetched
+// before the delete could have stayed cached, they answer as missing, and
+// stat results claiming they exist, such as those of a server still
+// catching up with the delete, are not stored. Invalidate and
+// InvalidatePrefix of the path, an ancestor of it or a path below it, as
+// done when it is created again, lift the tombstone.
+func (c *Cache) Tombstone(filePath string) {
+	prefixes := pathutil.NotebookAliasPaths(cacheKey(filePath))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	now := time.Now()
+	for p, until := range c.tombstones {
+		if now.After(until) {
+			delete(c.tombstones, p)
+		}
+	}
+	c.countDroppedLocked(ReasonDelete, c.invalidatePrefixLocked(prefixes))
+	until := now.Add(c.cacheTTL)
+	for _, p := range prefixes {
+		c.tombstones[p] = until
+	}
+}
+
+// Tombstoned reports whether filePath is under a live tombstone.
+func (c *Cache) Tombstoned(filePath string) bool {
+	filePath = cacheKey(filePath)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tombstonedLocked(filePath)
+}
+
+// tombstonedLocked reports whether filePath or one of its ancestors has a
+// live tombstone, dropping the expired ones it meets.
+func (c *Cache) tombstonedLocked(filePath string) bool {
+	if len(c.tombstones) == 0 {
+		return false
+	}
+	now := time.Now()
+	for p := filePath; ; p = path.Dir(p) {
+		if until, ok := c.tombstones[p]; ok {
+			if !now.After(until) {
+				return true
+			}
+			delete(c.tombstones, p)
+		}
+		if p == "/" || p == "." {
+			return false
+		}
+	}
+}
+
+// liftTombstonesLocked drops the tombstones of prefixes, of the paths below
+// them and of their ancestors: a path that exists again has parents too.
+func (c *Cache) liftTombstonesLocked(prefixes []string) {
+	for p := range c.tombstones {
+		if slices.Contains(prefixes, p) || underAnyPrefix(p, prefixes) {
+			delete(c.tombstones, p)
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(prefix, normalizedPrefix(p)) {
+				delete(c.tombstones, p)
+				break
+			}
+		}
+	}
+}
+
+// invalidatePrefixLocked drops the trees at prefixes and returns how many
+// items it dropped.
+func (c *Cache) invalidatePrefixLocked(prefixes []string) int64 {
+	var dropped int64
+	for _, prefix := range prefixes {
+		dropped += c.removeEntryLocked(prefix) + c.removeDirLocked(prefix)
+	}
 
-	prefix := normalizedPrefix(filePath)
 	for candidate := range c.entries {
-		if strings.HasPrefix(candidate, prefix) {
-			delete(c.entries, candidate)
+		if underAnyPrefix(candidate, prefixes) {
+			dropped += c.removeEntryLocked(candidate)
 		}
 	}
 	for candidate := range c.dirEntries {
-		if strings.HasPrefix(candidate, prefix) {
-			delete(c.dirEntries, candidate)
+		if underAnyPrefix(candidate, prefixes) {
+			dropped += c.removeDirLocked(candidate)
 		}
 	}
+	return dropped
 }
 
-func normalizedPrefix(filePath string) string {
-	if filePath == "/" {
-		return "/"
-	}
-	return strings.TrimSuffix(filePath, "/") + "/"
+func (c *Cache) invalidateDirLocked(dirPath string) int64 {
+	return c.removeEntryLocked(dirPath) + c.removeDirLocked(dirPath)
 }
 
-// evictOldestLocked removes the direct path entry with the earliest expiration time.
-// Must be called with lock held.
-func (c *Cache) evictOldestLocked() {
-	if len(c.entries) == 0 {
+func (c *Cache) countDroppedLocked(reason Reason, dropped int64) {
+	if dropped == 0 {
 		return
 	}
+	reason = reason.valid()
+	c.dropped[reason] += dropped
+	invalidationCounters[reason].Add(dropped)
+}
 
-	var oldestPath string
-	var oldestExp time.Time
-	first := true
+func (c *Cache) addFenceLocked(f fence) {
+	c.generation++
+	f.generation = c.generation
+	if len(c.fences) == maxFences {
+		c.fences = append(c.fences[:0], c.fences[1:]...)
+	}
+	c.fences = append(c.fences, f)
+}
 
-	for path, entry := range c.entries {
-		if first || entry.expiration.Before(oldestExp) {
-			oldestPath = path
-			oldestExp = entry.expiration
-			first = false
+// invalidatedSinceLocked reports whether an invalidation after generation
+// covered p. When the fences no longer reach back to generation it answers
+// true.
+func (c *Cache) invalidatedSinceLocked(generation uint64, p string) bool {
+	if generation >= c.generation {
+		return false
+	}
+	if len(c.fences) == 0 || c.fences[0].generation > generation+1 {
+		return true
+	}
+	for i := len(c.fences) - 1; i >= 0 && c.fences[i].generation > generation; i-- {
+		f := c.fences[i]
+		if slices.Contains(f.prefixes, p) || underAnyPrefix(p, f.prefixes) {
+			return true
+		}
+		if f.dir != "" && p == f.dir {
+			return true
 		}
 	}
+	return false
+}
+
+// Stats returns the usage counters and the current size of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if oldestPath != "" {
-		delete(c.entries, oldestPath)
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Tombstones = len(c.tombstones)
+	stats.DirEntries = len(c.dirEntries)
+	stats.Bytes = c.bytes
+	stats.Invalidations = make(map[string]int64, numReasons)
+	for reason, dropped := range c.dropped {
+		stats.Invalidations[Reason(reason).String()] = dropped
 	}
+	return stats
+}
+
+// Purge drops every entry. The usage counters are kept.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.purgeLocked()
+}
+
+func (c *Cache) purgeLocked() {
+	c.addFenceLocked(fence{prefixes: []string{"/"}})
+	c.entries = make(map[string]*CacheEntry)
+	c.dirEntries = make(map[string]*dirCacheEntry)
+	c.tombstones = make(map[string]time.Time)
+	c.lru.Init()
+	c.bytes = 0
+}
+
+// Close drops every entry and turns later Sets into no-ops, so a client
+// still running after unmount cannot grow the cache again.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.purgeLocked()
+	c.closed = true
+	return nil
+}
+
+func (c *Cache) hitLocked(elem *list.Element) {
+	c.lru.MoveToFront(elem)
+	c.stats.Hits++
+	metrics.MetadataCacheHits.Add(1)
+}
+
+// staleHitLocked counts a GetStale or GetStaleDirEntries answer, as a stale
+// hit when the item has expired.
+func (c *Cache) staleHitLocked(elem *list.Element, expiration time.Time) {
+	c.hitLocked(elem)
+	if time.Now().After(expiration) {
+		c.stats.StaleHits++
+		metrics.MetadataCacheStaleHits.Add(1)
+	}
+}
+
+// negativeHitLocked counts a hit answering a path is missing, on top of
+// the hit itself.
+func (c *Cache) negativeHitLocked() {
+	c.stats.NegativeHits++
+	metrics.MetadataCacheNegativeHits.Add(1)
+}
+
+func (c *Cache) tombstoneHitLocked() {
+	c.stats.Hits++
+	metrics.MetadataCacheHits.Add(1)
+	c.negativeHitLocked()
+}
+
+func (c *Cache) expiredLocked() {
+	c.stats.Expirations++
+	metrics.MetadataCacheExpirations.Add(1)
+}
+
+func (c *Cache) missLocked() {
+	c.stats.Misses++
+	metrics.MetadataCacheMisses.Add(1)
+}
+
+// removeEntryLocked drops the stat entry of filePath and returns 1 if
+// there was one.
+func (c *Cache) removeEntryLocked(filePath string) int64 {
+	entry, found := c.entries[filePath]
+	if !found {
+		return 0
+	}
+	c.lru.Remove(entry.elem)
+	c.bytes -= entry.size
+	delete(c.entries, filePath)
+	return 1
+}
+
+// removeDirLocked drops the listing of dirPath and returns 1 if there was
+// one.
+func (c *Cache) removeDirLocked(dirPath string) int64 {
+	entry, found := c.dirEntries[dirPath]
+	if !found {
+		return 0
+	}
+	c.lru.Remove(entry.elem)
+	c.bytes -= entry.size
+	delete(c.dirEntries, dirPath)
+	return 1
+}
+
+// evictLocked drops least recently used items until the cache is within
+// its limits. Must be called with lock held.
+func (c *Cache) evictLocked() {
+	for c.lru.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			return
+		}
+		key := oldest.Value.(lruKey)
+		if key.dir {
+			c.removeDirLocked(key.path)
+		} else {
+			c.removeEntryLocked(key.path)
+		}
+		c.stats.Evictions++
+		metrics.MetadataCacheEvictions.Add(1)
+	}
+}
+
+// entrySize approximates the memory of a stat entry: the key, and the name
+// and path copies a FileInfo usually holds.
+func entrySize(filePath string, info fs.FileInfo) int64 {
+	size := int64(entryOverhead + 2*len(filePath))
+	if info != nil {
+		size += int64(len(info.Name()))
+	}
+	return size
+}
+
+// dirSize approximates the memory of a listing and its lookup index.
+func dirSize(dirPath string, entries []fs.DirEntry, lookups []DirLookupEntry) int64 {
+	size := int64(entryOverhead + len(dirPath))
+	for _, entry := range entries {
+		size += int64(dirChildOverhead + len(dirPath) + 2*len(entry.Name()))
+	}
+	for _, lookup := range lookups {
+		size += int64(dirChildOverhead + len(lookup.Name))
+	}
+	return size
+}
+
+// cacheKey normalizes a path the way the cache stores it.
+func cacheKey(filePath string) string {
+	return pathutil.NormalizeName(filePath)
+}
+
+// underAnyPrefix reports whether filePath is strictly below one of prefixes.
+func underAnyPrefix(filePath string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(filePath, normalizedPrefix(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizedPrefix(filePath string) string {
+	if filePath == "/" {
+		return "/"
+	}
+	return strings.TrimSuffix(filePath, "/") + "/"
 }
 
 func cloneDirEntries(entries []fs.DirEntry) []fs.DirEntry {
@@ -1,8 +1,10 @@
 package metacache
 
 import (
+	"fmt"
 	"io/fs"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -138,7 +140,7 @@ func TestCacheInvalidate(t *testing.T) {
 	}
 
 	// Invalidate the file
-	c.Invalidate("/dir/test.txt")
+	c.Invalidate(ReasonOther, "/dir/test.txt")
 
 	// File should be gone
 	_, found = c.Get("/dir/test.txt")
@@ -167,7 +169,7 @@ func TestCacheInvalidateRoot(t *testing.T) {
 	}
 
 	// Invalidate
-	c.Invalidate("/test.txt")
+	c.Invalidate(ReasonOther, "/test.txt")
 
 	// Should be gone
 	_, found = c.Get("/test.txt")
@@ -423,7 +425,7 @@ func TestCacheInvalidateSubtree(t *testing.T) {
 	c.SetDirEntries("/dir/child", []fs.DirEntry{mockDirEntry{name: "file.txt", info: fileInfo}}, []DirLookupEntry{{Name: "file.txt", Info: fileInfo}})
 	c.SetDirEntries("/dir/child/grand", []fs.DirEntry{mockDirEntry{name: "file2.txt", info: fileInfo}}, []DirLookupEntry{{Name: "file2.txt", Info: fileInfo}})
 
-	c.Invalidate("/dir/child")
+	c.Invalidate(ReasonOther, "/dir/child")
 
 	for _, path := range []string{"/dir/child", "/dir/child/file.txt", "/dir/child/grand/file2.txt"} {
 		if _, found := c.Get(path); found {
@@ -453,7 +455,7 @@ func TestCacheInvalidateRootClearsAllEntries(t *testing.T) {
 	c.SetDirEntries("/", []fs.DirEntry{mockDirEntry{name: "root.txt", info: rootInfo}, mockDirEntry{name: "dir", info: dirInfo}}, []DirLookupEntry{{Name: "root.txt", Info: rootInfo}, {Name: "dir", Info: dirInfo}})
 	c.SetDirEntries("/dir", []fs.DirEntry{mockDirEntry{name: "child.txt", info: childInfo}}, []DirLookupEntry{{Name: "child.txt", Info: childInfo}})
 
-	c.Invalidate("/")
+	c.Invalidate(ReasonOther, "/")
 
 	for _, path := range []string{"/root.txt", "/dir", "/dir/child.txt"} {
 		if _, found := c.Get(path); found {
@@ -617,6 +619,478 @@ func BenchmarkCacheInvalidate(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		c.Set("/dir/test.txt", info)
-		c.Invalidate("/dir/test.txt")
+		c.Invalidate(ReasonOther, "/dir/test.txt")
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCacheWithMaxEntries(10*time.Second, 3)
+	for _, name := range []string{"a", "b", "c"} {
+		c.Set("/"+name, newMockFileInfo(name, 1, false))
+	}
+
+	// Reading /a makes /b the least recently used entry.
+	if _, found := c.Get("/a"); !found {
+		t.Fatal("expected /a to be cached")
+	}
+	c.Set("/d", newMockFileInfo("d", 1, false))
+
+	if _, found := c.Get("/b"); found {
+		t.Error("expected /b to be evicted")
+	}
+	for _, p := range []string{"/a", "/c", "/d"} {
+		if _, found := c.Get(p); !found {
+			t.Errorf("expected %s to stay cached", p)
+		}
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Entries != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCacheListingsCountTowardLimits(t *testing.T) {
+	c := NewCacheWithMaxEntries(10*time.Second, 2)
+	c.Set("/a", newMockFileInfo("a", 1, false))
+	c.SetDirEntries("/dir", nil, nil)
+	c.Set("/b", newMockFileInfo("b", 1, false))
+
+	if _, found := c.Get("/a"); found {
+		t.Error("expected /a to be evicted by the listing")
+	}
+	if _, found := c.GetDirEntries("/dir"); !found {
+		t.Error("expected the listing to stay cached")
+	}
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	info := newMockFileInfo("file", 1, false)
+	one := entrySize("/file_0000", info)
+	c := NewCacheWithLimits(10*time.Second, 10*time.Second, 1000, 4*one)
+
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("/file_%04d", i), info)
+	}
+	stats := c.Stats()
+	if stats.Bytes > 4*one || stats.Entries != 4 || stats.Evictions != 6 {
+		t.Fatalf("unexpected stats %+v (entry size %d)", stats, one)
+	}
+	if _, found := c.Get("/file_0009"); !found {
+		t.Error("expected the newest entry to stay cached")
+	}
+
+	c.Invalidate(ReasonOther, "/file_0009")
+	if got := c.Stats().Bytes; got != 3*one {
+		t.Errorf("bytes after invalidate = %d, want %d", got, 3*one)
+	}
+}
+
+func TestCacheSkipsListingLargerThanLimit(t *testing.T) {
+	c := NewCacheWithLimits(10*time.Second, 10*time.Second, 1000, 2000)
+	c.Set("/small", newMockFileInfo("small", 1, false))
+
+	var entries []fs.DirEntry
+	for i := 0; i < 100; i++ {
+		entries = append(entries, fs.FileInfoToDirEntry(newMockFileInfo(fmt.Sprintf("child_%03d", i), 1, false)))
+	}
+	c.SetDirEntries("/huge", entries, nil)
+
+	if _, found := c.GetDirEntries("/huge"); found {
+		t.Error("expected an oversized listing not to be cached")
+	}
+	if _, found := c.Get("/small"); !found {
+		t.Error("an oversized listing must not evict other entries")
+	}
+}
+
+func TestCacheStatsCountHitsMissesAndExpirations(t *testing.T) {
+	c := NewCacheWithTTLs(20*time.Millisecond, 20*time.Millisecond)
+	c.Set("/a", newMockFileInfo("a", 1, false))
+	c.SetDirEntries("/", nil, []DirLookupEntry{{Name: "a", Info: newMockFileInfo("a", 1, false)}})
+
+	c.Get("/a")
+	c.Get("/missing")
+	c.LookupDirEntry("/a")
+	time.Sleep(30 * time.Millisecond)
+	c.Get("/a")
+	c.GetDirEntries("/")
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 3 || stats.Expirations != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.Entries != 0 || stats.DirEntries != 0 || stats.Bytes != 0 {
+		t.Fatalf("expired entries still accounted: %+v", stats)
+	}
+}
+
+func TestCacheStatsCountNegativeHitsAndInvalidationsByReason(t *testing.T) {
+	c := NewCache(time.Minute)
+	c.Set("/gone", nil)
+	c.Set("/dir/a", newMockFileInfo("a", 1, false))
+	c.Set("/dir/b", newMockFileInfo("b", 1, false))
+	c.SetDirEntries("/dir", nil, []DirLookupEntry{{Name: "a", Info: newMockFileInfo("a", 1, false)}})
+
+	c.Get("/gone")
+	c.LookupDirEntry("/dir/missing")
+	c.Get("/dir/a")
+	if stats := c.Stats(); stats.Hits != 3 || stats.NegativeHits != 2 {
+		t.Fatalf("hits = %d, negative hits = %d, want 3 and 2", stats.Hits, stats.NegativeHits)
+	}
+
+	// The entry and the parent's listing.
+	c.Invalidate(ReasonWrite, "/dir/a")
+	// Nothing cached is left to drop.
+	c.Invalidate(ReasonRename, "/dir/a")
+	// The entry, and the tombstone then answers as missing.
+	c.Tombstone("/dir/b")
+	c.Get("/dir/b")
+	c.Invalidate(Reason(100), "/gone")
+
+	stats := c.Stats()
+	want := map[string]int64{"write": 2, "delete": 1, "rename": 0, "create": 0, "refresh": 0, "other": 1}
+	if !reflect.DeepEqual(stats.Invalidations, want) {
+		t.Fatalf("invalidations = %v, want %v", stats.Invalidations, want)
+	}
+	if stats.NegativeHits != 3 {
+		t.Fatalf("negative hits = %d, want the tombstone counted", stats.NegativeHits)
+	}
+}
+
+func TestCacheStaleWindowKeepsExpiredItemsForGetStale(t *testing.T) {
+	c := NewCacheWithTTLs(20*time.Millisecond, 20*time.Millisecond)
+	c.SetStaleWindow(60 * time.Millisecond)
+	c.Set("/a", newMockFileInfo("a", 1, false))
+	c.Set("/gone", nil)
+	c.SetDirEntries("/", []fs.DirEntry{fs.FileInfoToDirEntry(newMockFileInfo("a", 1, false))}, nil)
+	time.Sleep(30 * time.Millisecond)
+
+	if _, found := c.Get("/a"); found {
+		t.Fatal("Get returned an expired entry")
+	}
+	if _, found := c.GetDirEntries("/"); found {
+		t.Fatal("GetDirEntries returned an expired listing")
+	}
+	if info, found := c.GetStale("/a"); !found || info.Name() != "a" {
+		t.Fatalf("GetStale within the stale window = %v, %v", info, found)
+	}
+	if info, found := c.GetStale("/gone"); !found || info != nil {
+		t.Fatalf("GetStale of a negative entry = %v, %v", info, found)
+	}
+	if entries, found := c.GetStaleDirEntries("/"); !found || len(entries) != 1 {
+		t.Fatalf("GetStaleDirEntries within the stale window = %v, %v", entries, found)
+	}
+	if stats := c.Stats(); stats.StaleHits != 3 || stats.Expirations != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, found := c.GetStale("/a"); found {
+		t.Fatal("GetStale returned an entry past the stale window")
+	}
+	if _, found := c.GetStaleDirEntries("/"); found {
+		t.Fatal("GetStaleDirEntries returned a listing past the stale window")
+	}
+	if stats := c.Stats(); stats.Expirations != 2 || stats.Entries != 1 {
+		t.Fatalf("unexpected stats past the stale window %+v", stats)
+	}
+}
+
+func TestCacheRenewVersionedDirEntries(t *testing.T) {
+	c := NewCache(20 * time.Millisecond)
+	a := newMockFileInfo("a", 1, false)
+	c.SetVersionedDirEntriesIfUnchanged(c.Generation(), "/dir", "v1", []fs.DirEntry{fs.FileInfoToDirEntry(a)}, []DirLookupEntry{{Name: "a", Info: a}})
+	c.SetDirEntries("/plain", nil, nil)
+	if v := c.ExpiredDirVersion("/dir"); v != "" {
+		t.Fatalf("ExpiredDirVersion of a fresh listing = %q", v)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if _, found := c.GetDirEntries("/dir"); found {
+		t.Fatal("GetDirEntries returned an expired listing")
+	}
+	if _, found := c.GetDirEntries("/plain"); found {
+		t.Fatal("GetDirEntries returned an expired listing")
+	}
+	if v := c.ExpiredDirVersion("/dir"); v != "v1" {
+		t.Fatalf("ExpiredDirVersion = %q, want v1", v)
+	}
+	if v := c.ExpiredDirVersion("/plain"); v != "" {
+		t.Fatalf("ExpiredDirVersion of an unversioned listing = %q", v)
+	}
+
+	if _, ok := c.RenewDirEntries(c.Generation(), "/dir", "v2"); ok {
+		t.Fatal("renewed a listing at another version")
+	}
+	generation := c.Generation()
+	c.Invalidate(ReasonOther, "/other/file")
+	if entries, ok := c.RenewDirEntries(generation, "/dir", "v1"); !ok || len(entries) != 1 {
+		t.Fatalf("RenewDirEntries = %v, %v", entries, ok)
+	}
+	if entries, found := c.GetDirEntries("/dir"); !found || len(entries) != 1 {
+		t.Fatalf("GetDirEntries after renewal = %v, %v", entries, found)
+	}
+	if info, found := c.LookupDirEntry("/dir/missing"); !found || info != nil {
+		t.Fatalf("LookupDirEntry of a missing name = %v, %v; want a negative hit", info, found)
+	}
+	if _, found := c.LookupDirEntry("/dir/a"); found {
+		t.Fatal("LookupDirEntry answered a child's attributes from a renewed listing")
+	}
+	if got := c.Stats().Revalidations; got != 1 {
+		t.Fatalf("Revalidations = %d, want 1", got)
+	}
+
+	generation = c.Generation()
+	c.Invalidate(ReasonWrite, "/dir/b")
+	if _, ok := c.RenewDirEntries(generation, "/dir", "v1"); ok {
+		t.Fatal("renewed a listing invalidated meanwhile")
+	}
+	if v := c.ExpiredDirVersion("/dir"); v != "" {
+		t.Fatalf("ExpiredDirVersion after invalidation = %q", v)
+	}
+}
+
+func TestCachePeek(t *testing.T) {
+	c := NewCache(20 * time.Millisecond)
+	dir := newMockFileInfo("dir", 0, true)
+	c.SetDirEntries("/", nil, []DirLookupEntry{{Name: "dir", Info: dir}})
+	c.Set("/gone", nil)
+	time.Sleep(30 * time.Millisecond)
+
+	if info, found := c.Peek("/dir"); !found || info != dir {
+		t.Fatalf("Peek from an expired listing = %v, %v", info, found)
+	}
+	if _, found := c.Peek("/gone"); found {
+		t.Fatal("Peek answered a negative entry")
+	}
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Fatalf("Peek counted lookups: %+v", stats)
+	}
+}
+
+func TestCachePurgeAndClose(t *testing.T) {
+	c := NewCache(10 * time.Second)
+	c.Set("/a", newMockFileInfo("a", 1, false))
+	c.SetDirEntries("/", nil, nil)
+	c.Get("/a")
+
+	c.Purge()
+	stats := c.Stats()
+	if stats.Entries != 0 || stats.DirEntries != 0 || stats.Bytes != 0 || stats.Hits != 1 {
+		t.Fatalf("after Purge: %+v", stats)
+	}
+	c.Set("/a", newMockFileInfo("a", 1, false))
+	if _, found := c.Get("/a"); !found {
+		t.Fatal("expected Set to work after Purge")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	c.Set("/b", newMockFileInfo("b", 1, false))
+	c.SetDirEntries("/", nil, nil)
+	if _, found := c.Get("/a"); found {
+		t.Error("expected Close to drop entries")
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.DirEntries != 0 {
+		t.Errorf("expected Set after Close to be ignored, got %+v", stats)
+	}
+}
+
+func TestCacheInvalidatePrefix(t *testing.T) {
+	c := NewCache(10 * time.Second)
+	dirInfo := newMockFileInfo("dir", 0, true)
+	fileInfo := newMockFileInfo("file.txt", 1, false)
+
+	c.Set("/dir", dirInfo)
+	c.Set("/dir/file.txt", fileInfo)
+	c.Set("/dir/sub/file.txt", fileInfo)
+	c.Set("/dirty.txt", fileInfo)
+	c.SetDirEntries("/", []fs.DirEntry{mockDirEntry{name: "dir", info: dirInfo}}, []DirLookupEntry{{Name: "dir", Info: dirInfo}})
+	c.SetDirEntries("/dir/sub", nil, []DirLookupEntry{{Name: "file.txt", Info: fileInfo}})
+
+	c.InvalidatePrefix(ReasonOther, "/dir")
+
+	for _, path := range []string{"/dir", "/dir/file.txt", "/dir/sub/file.txt"} {
+		if _, found := c.Get(path); found {
+			t.Fatalf("expected %s to be invalidated", path)
+		}
+	}
+	if _, found := c.GetDirEntries("/dir/sub"); found {
+		t.Fatal("expected the descendant listing to be invalidated")
+	}
+	if _, found := c.Get("/dirty.txt"); !found {
+		t.Fatal("a sibling sharing the name prefix must stay cached")
+	}
+	if _, found := c.GetDirEntries("/"); !found {
+		t.Fatal("InvalidatePrefix must leave the parent listing")
+	}
+}
+
+func TestCacheInvalidateDir(t *testing.T) {
+	c := NewCache(10 * time.Second)
+	dirInfo := newMockFileInfo("dir", 0, true)
+	fileInfo := newMockFileInfo("file.txt", 1, false)
+
+	c.Set("/dir", dirInfo)
+	c.Set("/dir/file.txt", fileInfo)
+	c.SetDirEntries("/dir", nil, []DirLookupEntry{{Name: "file.txt", Info: fileInfo}})
+
+	c.InvalidateDir(ReasonOther, "/dir")
+
+	if _, found := c.GetDirEntries("/dir"); found {
+		t.Fatal("expected the listing to be invalidated")
+	}
+	if _, found := c.Get("/dir"); found {
+		t.Fatal("expected the directory's own entry to be invalidated")
+	}
+	if _, found := c.Get("/dir/file.txt"); !found {
+		t.Fatal("InvalidateDir must leave child entries")
+	}
+}
+
+func TestCacheSetIfUnchangedSkipsFillsOlderThanInvalidation(t *testing.T) {
+	c := NewCache(10 * time.Second)
+	fileInfo := newMockFileInfo("file.txt", 1, false)
+
+	generation := c.Generation()
+	c.Invalidate(ReasonOther, "/dir")
+	c.SetIfUnchanged(generation, "/dir/file.txt", fileInfo)
+	c.SetDirEntriesIfUnchanged(generation, "/dir", nil, []DirLookupEntry{{Name: "file.txt", Info: fileInfo}})
+	c.SetDirEntriesIfUnchanged(generation, "/", nil, nil)
+	if _, found := c.Get("/dir/file.txt"); found {
+		t.Fatal("a stat fetched before the invalidation was stored")
+	}
+	if _, found := c.GetDirEntries("/dir"); found {
+		t.Fatal("a listing fetched before the invalidation was stored")
+	}
+	if _, found := c.GetDirEntries("/"); found {
+		t.Fatal("a parent listing fetched before the invalidation was stored")
+	}
+
+	c.SetIfUnchanged(generation, "/other.txt", fileInfo)
+	if _, found := c.Get("/other.txt"); !found {
+		t.Fatal("an unrelated invalidation must not block the fill")
+	}
+	c.SetIfUnchanged(c.Generation(), "/dir/file.txt", fileInfo)
+	if _, found := c.Get("/dir/file.txt"); !found {
+		t.Fatal("a fill started after the invalidation must be stored")
+	}
+}
+
+func TestCacheSetIfUnchangedAfterFenceOverflow(t *testing.T) {
+	c := NewCache(10 * time.Second)
+	generation := c.Generation()
+	for i := 0; i <= maxFences; i++ {
+		c.Invalidate(ReasonOther, fmt.Sprintf("/other/%d", i))
+	}
+
+	c.SetIfUnchanged(generation, "/file.txt", newMockFileInfo("file.txt", 1, false))
+	if _, found := c.Get("/file.txt"); found {
+		t.Fatal("expected a fill older than every remembered invalidation to be dropped")
+	}
+	c.SetIfUnchanged(c.Generation(), "/file.txt", newMockFileInfo("file.txt", 1, false))
+	if _, found := c.Get("/file.txt"); !found {
+		t.Fatal("expected a fresh fill to be stored")
+	}
+}
+
+func TestCacheInvalidateCoversNotebookAliases(t *testing.T) {
+	c := NewCache(10 * time.Second)
+	info := newMockFileInfo("nb", 1, false)
+	aliases := []string{"/dir/nb", "/dir/nb.py", "/dir/nb.ipynb"}
+
+	for _, invalidated := range aliases {
+		for _, p := range append(aliases, "/dir/nbx", "/dir/nb.txt") {
+			c.Set(p, info)
+		}
+		c.Invalidate(ReasonOther, invalidated)
+		for _, p := range aliases {
+			if _, found := c.Get(p); found {
+				t.Fatalf("Invalidate(%s) left %s cached", invalidated, p)
+			}
+		}
+		for _, p := range []string{"/dir/nbx", "/dir/nb.txt"} {
+			if _, found := c.Get(p); !found {
+				t.Fatalf("Invalidate(%s) dropped unrelated %s", invalidated, p)
+			}
+		}
+	}
+
+	generation := c.Generation()
+	c.InvalidatePrefix(ReasonOther, "/dir/nb.py")
+	c.SetIfUnchanged(generation, "/dir/nb", info)
+	if _, found := c.Get("/dir/nb"); found {
+		t.Fatal("a stat of the remote path fetched before its visible alias was invalidated was stored")
+	}
+}
+
+func TestCacheNormalizesKeysToNFC(t *testing.T) {
+	c := NewCache(10 * time.Second)
+	decomposed := "/dir/café.py"
+	composed := "/dir/café.py"
+	info := newMockFileInfo("café.py", 1, false)
+
+	c.Set(decomposed, info)
+	if _, found := c.Get(composed); !found {
+		t.Fatal("expected an entry set under the NFD path to be found under NFC")
+	}
+	c.SetDirEntries("/dir", nil, []DirLookupEntry{{Name: "café.py", Info: info}})
+	if got, found := c.LookupDirEntry(decomposed); !found || got == nil {
+		t.Fatalf("LookupDirEntry(NFD) = %v, %v", got, found)
+	}
+	c.Invalidate(ReasonOther, composed)
+	if _, found := c.Get(decomposed); found {
+		t.Fatal("expected Invalidate under NFC to drop the entry")
+	}
+}
+
+func TestCacheTombstone(t *testing.T) {
+	c := NewCache(50 * time.Millisecond)
+	file := newMockFileInfo("nb", 1, false)
+	c.Set("/dir/nb", file)
+	c.SetDirEntries("/dir", nil, []DirLookupEntry{{Name: "nb.py", Info: file}, {Name: "other", Info: file}})
+
+	c.Tombstone("/dir/nb")
+	for _, p := range []string{"/dir/nb", "/dir/nb.py", "/dir/nb/child"} {
+		if info, found := c.Get(p); info != nil || !found {
+			t.Fatalf("Get(%s) = %v, %v; want nil, true", p, info, found)
+		}
+	}
+	if info, found := c.LookupDirEntry("/dir/nb.py"); info != nil || !found {
+		t.Fatalf("LookupDirEntry(/dir/nb.py) = %v, %v; want nil, true", info, found)
+	}
+	if info, _ := c.LookupDirEntry("/dir/other"); info == nil {
+		t.Fatal("tombstone hid a sibling")
+	}
+	if !c.Tombstoned("/dir/nb.ipynb") || c.Tombstoned("/dir/other") {
+		t.Fatal("Tombstoned does not match the deleted path and its aliases")
+	}
+	if got := c.Stats().Tombstones; got == 0 {
+		t.Fatal("expected tombstones in Stats")
+	}
+
+	// A server still catching up reports the file again.
+	c.Set("/dir/nb", file)
+	if info, _ := c.Get("/dir/nb"); info != nil {
+		t.Fatal("a stat under a tombstone was stored")
+	}
+
+	// Created again: the invalidation of the write lifts it.
+	c.Invalidate(ReasonOther, "/dir/nb")
+	c.Set("/dir/nb", file)
+	if info, _ := c.Get("/dir/nb"); info == nil {
+		t.Fatal("Invalidate did not lift the tombstone")
+	}
+
+	c.Tombstone("/dir/gone")
+	c.Invalidate(ReasonOther, "/dir/gone/new.txt")
+	if c.Tombstoned("/dir/gone") {
+		t.Fatal("creating a path below a tombstone did not lift it")
+	}
+
+	c.Tombstone("/dir/old")
+	time.Sleep(60 * time.Millisecond)
+	if c.Tombstoned("/dir/old") {
+		t.Fatal("tombstone outlived the TTL")
 	}
 }
@@ -0,0 +1,62 @@
+package metacache
+
+import "wsfs/internal/metrics"
+
+// Reason says why items are invalidated. The items each invalidation drops
+// are counted by reason, in Stats.Invalidations and in the
+// metadata_cache_invalidations_* metrics, so the TTLs can be weighed
+// against how often local changes drop the cache anyway.
+type Reason int
+
+const (
+	// ReasonWrite is an upload of file or notebook content.
+	ReasonWrite Reason = iota
+	// ReasonDelete is a delete, including the tombstone it leaves.
+	ReasonDelete
+	// ReasonRename is a rename, or a notebook replaced by one.
+	ReasonRename
+	// ReasonCreate is a new directory.
+	ReasonCreate
+	// ReasonRefresh is a stat that bypasses the cache and replaces what it
+	// held.
+	ReasonRefresh
+	// ReasonOther is any other caller, such as the mount dropping
+	// metadata it found stale.
+	ReasonOther
+
+	numReasons
+)
+
+var reasonNames = [numReasons]string{
+	ReasonWrite:   "write",
+	ReasonDelete:  "delete",
+	ReasonRename:  "rename",
+	ReasonCreate:  "create",
+	ReasonRefresh: "refresh",
+	ReasonOther:   "other",
+}
+
+var invalidationCounters = [numReasons]*metrics.Counter{
+	ReasonWrite:   metrics.MetadataCacheInvalidationsWrite,
+	ReasonDelete:  metrics.MetadataCacheInvalidationsDelete,
+	ReasonRename:  metrics.MetadataCacheInvalidationsRename,
+	ReasonCreate:  metrics.MetadataCacheInvalidationsCreate,
+	ReasonRefresh: metrics.MetadataCacheInvalidationsRefresh,
+	ReasonOther:   metrics.MetadataCacheInvalidationsOther,
+}
+
+// String returns the name the reason is counted under.
+func (r Reason) String() string {
+	if r < 0 || r >= numReasons {
+		return "other"
+	}
+	return reasonNames[r]
+}
+
+// valid maps unknown reasons to ReasonOther.
+func (r Reason) valid() Reason {
+	if r < 0 || r >= numReasons {
+		return ReasonOther
+	}
+	return r
+}
@@ -0,0 +1,237 @@
+// Package metrics holds process-wide counters for wsfs operations.
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing int64 counter safe for concurrent use.
+type Counter struct {
+	name  string
+	value atomic.Int64
+}
+
+// Add increments the counter by delta.
+func (c *Counter) Add(delta int64) {
+	c.value.Add(delta)
+}
+
+// Value returns the current counter value.
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+// Name returns the name the counter was registered with.
+func (c *Counter) Name() string {
+	return c.name
+}
+
+// Gauge is an int64 value that goes up and down, safe for concurrent use.
+type Gauge struct {
+	name  string
+	value atomic.Int64
+}
+
+// Add moves the gauge by delta and returns the new value.
+func (g *Gauge) Add(delta int64) int64 {
+	return g.value.Add(delta)
+}
+
+// RaiseTo sets the gauge to v if v is larger, for tracking peaks.
+func (g *Gauge) RaiseTo(v int64) {
+	for {
+		cur := g.value.Load()
+		if v <= cur || g.value.CompareAndSwap(cur, v) {
+			return
+		}
+	}
+}
+
+// Value returns the current gauge value.
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+// Name returns the name the gauge was registered with.
+func (g *Gauge) Name() string {
+	return g.name
+}
+
+// metric is a registered counter or gauge.
+type metric interface {
+	Name() string
+	Value() int64
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []metric
+)
+
+// NewCounter registers and returns a counter with the given name.
+func NewCounter(name string) *Counter {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	c := &Counter{name: name}
+	registry = append(registry, c)
+	return c
+}
+
+// NewGauge registers and returns a gauge with the given name.
+func NewGauge(name string) *Gauge {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	g := &Gauge{name: name}
+	registry = append(registry, g)
+	return g
+}
+
+// Snapshot returns the current value of every registered counter and gauge
+// keyed by name.
+func Snapshot() map[string]int64 {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	out := make(map[string]int64, len(registry))
+	for _, m := range registry {
+		out[m.Name()] = m.Value()
+	}
+	return out
+}
+
+// Names returns the registered counter and gauge names in sorted order.
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for _, m := range registry {
+		names = append(names, m.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Upload counters.
+var (
+	// UploadBytes counts bytes sent to the workspace by flushes.
+	UploadBytes = NewCounter("upload_bytes")
+	// UploadBytesSaved counts bytes a flush did not have to send because the
+	// content was unchanged or only changed chunks were uploaded.
+	UploadBytesSaved = NewCounter("upload_bytes_saved")
+	// FullUploads counts flushes that sent the whole file.
+	FullUploads = NewCounter("full_uploads")
+	// DeltaUploads counts flushes that sent only changed chunks.
+	DeltaUploads = NewCounter("delta_uploads")
+	// FlushRetries counts background retries of failed flushes.
+	FlushRetries = NewCounter("flush_retries")
+	// FlushRetriesExhausted counts failed flushes wsfs stopped retrying
+	// in the background.
+	FlushRetriesExhausted = NewCounter("flush_retries_exhausted")
+	// TransformsApplied counts uploads whose content a .wsfsattributes
+	// transform rewrote.
+	TransformsApplied = NewCounter("transforms_applied")
+	// TransformsFailed counts uploads sent as written because a transform
+	// failed, such as encoding=utf-8 on invalid UTF-8.
+	TransformsFailed = NewCounter("transforms_failed")
+)
+
+// Local change event counters, see internal/events.
+var (
+	// EventsPublished counts events queued for delivery.
+	EventsPublished = NewCounter("events_published")
+	// EventsDropped counts events dropped because the queue was full.
+	EventsDropped = NewCounter("events_dropped")
+	// EventsFailed counts failed deliveries to a webhook or socket.
+	EventsFailed = NewCounter("events_failed")
+)
+
+// FUSE request metrics, see fuse.CountRequests.
+var (
+	// FuseRequests counts the FUSE requests wsfs served.
+	FuseRequests = NewCounter("fuse_requests")
+	// FuseRequestsInFlight is how many FUSE requests wsfs is serving now.
+	FuseRequestsInFlight = NewGauge("fuse_requests_in_flight")
+	// FuseRequestsInFlightPeak is the most FUSE requests served at once.
+	FuseRequestsInFlightPeak = NewGauge("fuse_requests_in_flight_peak")
+	// FuseRequestsCongested counts requests that arrived while more were
+	// in flight than the kernel's congestion threshold, the point where
+	// it starts holding back background reads and writes.
+	FuseRequestsCongested = NewCounter("fuse_requests_congested")
+)
+
+// Backend failure metrics, counted as failed calls are mapped to errnos.
+var (
+	// BackendTimeouts counts calls that ran out of their deadline or timed
+	// out on the network, returned as ETIMEDOUT.
+	BackendTimeouts = NewCounter("backend_timeouts")
+	// BackendInterrupted counts calls cancelled by an interrupted syscall.
+	BackendInterrupted = NewCounter("backend_interrupted")
+	// BackendRejections counts calls the backend refused, such as EACCES,
+	// EINVAL or EFBIG.
+	BackendRejections = NewCounter("backend_rejections")
+	// BackendErrors counts other failures, returned as EIO.
+	BackendErrors = NewCounter("backend_errors")
+)
+
+// FaultsInjected counts faults injected by internal/faultinject.
+var FaultsInjected = NewCounter("faults_injected")
+
+// Metadata cache counters, see internal/metacache.
+var (
+	// MetadataCacheHits counts lookups answered from the metadata cache.
+	MetadataCacheHits = NewCounter("metadata_cache_hits")
+	// MetadataCacheMisses counts lookups the metadata cache could not answer.
+	MetadataCacheMisses = NewCounter("metadata_cache_misses")
+	// MetadataCacheEvictions counts entries evicted to keep the metadata
+	// cache within its entry and byte limits.
+	MetadataCacheEvictions = NewCounter("metadata_cache_evictions")
+	// MetadataCacheStaleHits counts lookups answered from expired metadata
+	// while a background refresh updates it.
+	MetadataCacheStaleHits = NewCounter("metadata_cache_stale_hits")
+	// MetadataCacheNegativeHits counts hits that answered a path is
+	// missing, from a negative entry, a tombstone or a cached listing
+	// without the name.
+	MetadataCacheNegativeHits = NewCounter("metadata_cache_negative_hits")
+	// MetadataCacheExpirations counts entries dropped after their TTL.
+	MetadataCacheExpirations = NewCounter("metadata_cache_expirations")
+	// MetadataCacheRevalidations counts expired listings served again
+	// because their directory's version had not changed.
+	MetadataCacheRevalidations = NewCounter("metadata_cache_revalidations")
+)
+
+// Metadata cache invalidation counters: the entries dropped by local
+// changes, by reason. See metacache.Reason.
+var (
+	MetadataCacheInvalidationsWrite   = NewCounter("metadata_cache_invalidations_write")
+	MetadataCacheInvalidationsDelete  = NewCounter("metadata_cache_invalidations_delete")
+	MetadataCacheInvalidationsRename  = NewCounter("metadata_cache_invalidations_rename")
+	MetadataCacheInvalidationsCreate  = NewCounter("metadata_cache_invalidations_create")
+	MetadataCacheInvalidationsRefresh = NewCounter("metadata_cache_invalidations_refresh")
+	MetadataCacheInvalidationsOther   = NewCounter("metadata_cache_invalidations_other")
+)
+
+// Notebook export counters.
+var (
+	// NotebookExports counts notebooks exported to read their source.
+	NotebookExports = NewCounter("notebook_exports")
+	// NotebookExportCacheHits counts notebook reads and size lookups
+	// answered from an export in the disk cache.
+	NotebookExportCacheHits = NewCounter("notebook_export_cache_hits")
+)
+
+// Cache audit counters, see (*fuse.WSNode).AuditCache.
+var (
+	// CacheAuditChecked counts disk cache entries compared with the workspace.
+	CacheAuditChecked = NewCounter("cache_audit_checked")
+	// CacheAuditMissing counts audited entries whose file is gone remotely.
+	CacheAuditMissing = NewCounter("cache_audit_missing")
+	// CacheAuditStale counts audited entries of a version the workspace no
+	// longer has.
+	CacheAuditStale = NewCounter("cache_audit_stale")
+	// CacheAuditSizeMismatch counts audited entries whose size differs from
+	// the remote file of the same version.
+	CacheAuditSizeMismatch = NewCounter("cache_audit_size_mismatch")
+	// CacheAuditHealed counts divergent entries the audit invalidated.
+	CacheAuditHealed = NewCounter("cache_audit_healed")
+)
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCounterAddConcurrent(t *testing.T) {
+	c := &Counter{name: "test"}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Add(2)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := c.Value(); got != 2000 {
+		t.Fatalf("expected 2000, got %d", got)
+	}
+}
+
+func TestSnapshotIncludesRegisteredCounters(t *testing.T) {
+	c := NewCounter("snapshot_test")
+	c.Add(7)
+
+	snap := Snapshot()
+	if snap["snapshot_test"] != 7 {
+		t.Fatalf("expected snapshot_test=7, got %d", snap["snapshot_test"])
+	}
+	if _, ok := snap[UploadBytes.Name()]; !ok {
+		t.Fatalf("expected %s in snapshot", UploadBytes.Name())
+	}
+
+	names := Names()
+	for i := 1; i < len(names); i++ {
+		if names[i-1] > names[i] {
+			t.Fatalf("expected sorted names, got %v", names)
+		}
+	}
+}
+
+func TestGaugeTracksPeak(t *testing.T) {
+	g := NewGauge("gauge_test")
+	peak := &Gauge{name: "gauge_test_peak"}
+	for _, delta := range []int64{1, 1, 1, -1, -1, 1} {
+		peak.RaiseTo(g.Add(delta))
+	}
+	if g.Value() != 2 || peak.Value() != 3 {
+		t.Fatalf("gauge = %d, peak = %d, want 2 and 3", g.Value(), peak.Value())
+	}
+	if Snapshot()["gauge_test"] != 2 {
+		t.Fatalf("expected gauge_test in snapshot, got %v", Snapshot())
+	}
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transfer tracks the progress of one in-flight upload.
+type Transfer struct {
+	path    string
+	total   int64
+	started time.Time
+	sent    atomic.Int64
+}
+
+// TransferStatus is a point-in-time view of a Transfer.
+type TransferStatus struct {
+	Path    string        `json:"path"`
+	Sent    int64         `json:"sent"`
+	Total   int64         `json:"total"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+}
+
+var (
+	transfersMu sync.Mutex
+	transfers   = make(map[*Transfer]struct{})
+)
+
+// StartTransfer registers an upload of total bytes to path. Call Finish when
+// the upload ends, successfully or not.
+func StartTransfer(path string, total int64) *Transfer {
+	t := &Transfer{path: path, total: total, started: time.Now()}
+	transfersMu.Lock()
+	transfers[t] = struct{}{}
+	transfersMu.Unlock()
+	return t
+}
+
+// SetSent records the bytes sent so far. A retry may move it backwards.
+func (t *Transfer) SetSent(sent int64) {
+	t.sent.Store(sent)
+}
+
+// Status returns the current progress of the transfer.
+func (t *Transfer) Status() TransferStatus {
+	return TransferStatus{
+		Path:    t.path,
+		Sent:    t.sent.Load(),
+		Total:   t.total,
+		Elapsed: time.Since(t.started),
+	}
+}
+
+// Finish removes the transfer from the active set.
+func (t *Transfer) Finish() {
+	transfersMu.Lock()
+	delete(transfers, t)
+	transfersMu.Unlock()
+}
+
+// ActiveTransfers returns the status of every unfinished transfer, oldest first.
+func ActiveTransfers() []TransferStatus {
+	transfersMu.Lock()
+	active := make([]*Transfer, 0, len(transfers))
+	for t := range transfers {
+		active = append(active, t)
+	}
+	transfersMu.Unlock()
+
+	sort.Slice(active, func(i, j int) bool {
+		if !active[i].started.Equal(active[j].started) {
+			return active[i].started.Before(active[j].started)
+		}
+		return active[i].path < active[j].path
+	})
+	out := make([]TransferStatus, 0, len(active))
+	for _, t := range active {
+		out = append(out, t.Status())
+	}
+	return out
+}
+
+// Percent returns how much of the transfer is done, from 0 to 100.
+func (s TransferStatus) Percent() float64 {
+	if s.Total <= 0 {
+		return 100
+	}
+	return float64(s.Sent) * 100 / float64(s.Total)
+}
+
+// Rate returns the average bytes per second since the transfer started.
+func (s TransferStatus) Rate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Sent) / s.Elapsed.Seconds()
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransferLifecycle(t *testing.T) {
+	tr := StartTransfer("/big.bin", 200)
+	tr.SetSent(50)
+
+	var found *TransferStatus
+	for _, status := range ActiveTransfers() {
+		if status.Path == "/big.bin" {
+			status := status
+			found = &status
+		}
+	}
+	if found == nil {
+		t.Fatal("expected transfer to be active")
+	}
+	if found.Sent != 50 || found.Total != 200 || found.Percent() != 25 {
+		t.Fatalf("unexpected status: %+v (%.1f%%)", *found, found.Percent())
+	}
+
+	tr.Finish()
+	for _, status := range ActiveTransfers() {
+		if status.Path == "/big.bin" {
+			t.Fatal("expected finished transfer to be removed")
+		}
+	}
+}
+
+func TestTransferStatusRateAndPercent(t *testing.T) {
+	status := TransferStatus{Sent: 10 << 20, Total: 40 << 20, Elapsed: 2 * time.Second}
+	if got := status.Rate(); got != 5<<20 {
+		t.Fatalf("expected 5 MiB/s, got %f", got)
+	}
+	if got := status.Percent(); got != 25 {
+		t.Fatalf("expected 25%%, got %f", got)
+	}
+	if got := (TransferStatus{}).Percent(); got != 100 {
+		t.Fatalf("expected empty transfer to be complete, got %f", got)
+	}
+	if got := (TransferStatus{Sent: 1}).Rate(); got != 0 {
+		t.Fatalf("expected zero rate without elapsed time, got %f", got)
+	}
+}
+
+func TestActiveTransfersOldestFirst(t *testing.T) {
+	first := StartTransfer("/z-first", 1)
+	defer first.Finish()
+	second := StartTransfer("/a-second", 1)
+	defer second.Finish()
+	second.started = first.started.Add(time.Second)
+
+	var order []string
+	for _, status := range ActiveTransfers() {
+		if status.Path == "/z-first" || status.Path == "/a-second" {
+			order = append(order, status.Path)
+		}
+	}
+	if len(order) != 2 || order[0] != "/z-first" {
+		t.Fatalf("expected oldest transfer first, got %v", order)
+	}
+}
@@ -2,15 +2,68 @@
 package pathutil
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
 	"strings"
 
 	"github.com/databricks/databricks-sdk-go/service/workspace"
+	"golang.org/x/text/unicode/norm"
 )
 
 // NotebookFallbackSuffix is used when a notebook has no known source suffix
 // or when its preferred source suffix collides with an exact workspace entry.
 const NotebookFallbackSuffix = ".ipynb"
 
+// NotebookAliases says under which names a mount shows notebooks.
+type NotebookAliases int
+
+const (
+	// NotebookAliasesSuffixOnly shows a notebook only under its source name,
+	// e.g. "foo.py", or its .ipynb fallback name.
+	NotebookAliasesSuffixOnly NotebookAliases = iota
+	// NotebookAliasesBoth also shows it under its workspace name, "foo".
+	NotebookAliasesBoth
+	// NotebookAliasesNone shows it only under its workspace name. Names with
+	// a source or .ipynb suffix are then taken literally, so "foo.py" is a
+	// regular file.
+	NotebookAliasesNone
+)
+
+// ParseNotebookAliases parses "suffix-only", "both" or "none".
+func ParseNotebookAliases(s string) (NotebookAliases, error) {
+	switch strings.ToLower(s) {
+	case "suffix-only":
+		return NotebookAliasesSuffixOnly, nil
+	case "both":
+		return NotebookAliasesBoth, nil
+	case "none":
+		return NotebookAliasesNone, nil
+	}
+	return 0, fmt.Errorf("%q (want suffix-only, both or none)", s)
+}
+
+func (a NotebookAliases) String() string {
+	switch a {
+	case NotebookAliasesBoth:
+		return "both"
+	case NotebookAliasesNone:
+		return "none"
+	}
+	return "suffix-only"
+}
+
+// SuffixNames reports whether notebooks are shown under suffixed names.
+func (a NotebookAliases) SuffixNames() bool {
+	return a != NotebookAliasesNone
+}
+
+// BareNames reports whether notebooks are shown under their workspace names.
+func (a NotebookAliases) BareNames() bool {
+	return a != NotebookAliasesSuffixOnly
+}
+
 var sourceSuffixes = []struct {
 	suffix   string
 	language workspace.Language
@@ -33,7 +86,12 @@ func NotebookSourceSuffix(language workspace.Language) string {
 }
 
 // NotebookVisibleName returns the preferred visible name for a notebook.
+// A notebook renamed to an editor backup name such as "foo.py~" is shown
+// under that name as is.
 func NotebookVisibleName(remoteName string, language workspace.Language) string {
+	if isNotebookBackupName(remoteName) {
+		return remoteName
+	}
 	if suffix := NotebookSourceSuffix(language); suffix != "" {
 		return remoteName + suffix
 	}
@@ -42,6 +100,9 @@ func NotebookVisibleName(remoteName string, language workspace.Language) string
 
 // NotebookVisiblePath returns the preferred visible path for a notebook.
 func NotebookVisiblePath(remotePath string, language workspace.Language) string {
+	if isNotebookBackupName(path.Base(remotePath)) {
+		return remotePath
+	}
 	if suffix := NotebookSourceSuffix(language); suffix != "" {
 		return remotePath + suffix
 	}
@@ -96,6 +157,85 @@ func HasNotebookFallbackSuffix(path string) bool {
 	return strings.HasSuffix(path, NotebookFallbackSuffix)
 }
 
+// NotebookAliasPaths returns p and the other paths that can name the same
+// notebook: the remote path behind a source or .ipynb visible path, and the
+// source and .ipynb visible paths of p and of that remote path. Callers
+// that drop cached state for p drop it for all of them, since which form a
+// caller used is not known.
+func NotebookAliasPaths(p string) []string {
+	aliases := []string{p}
+	addVisible := func(remotePath string) {
+		if remotePath == "/" || strings.HasSuffix(remotePath, "/") {
+			return
+		}
+		for _, candidate := range sourceSuffixes {
+			aliases = append(aliases, remotePath+candidate.suffix)
+		}
+		aliases = append(aliases, NotebookFallbackPath(remotePath))
+	}
+	addVisible(p)
+	if remotePath, _, ok := NotebookRemotePathFromSourcePath(p); ok {
+		aliases = append(aliases, remotePath)
+		addVisible(remotePath)
+	} else if remotePath, ok := NotebookRemotePathFromFallbackPath(p); ok {
+		aliases = append(aliases, remotePath)
+		addVisible(remotePath)
+	}
+
+	seen := make(map[string]struct{}, len(aliases))
+	unique := aliases[:0]
+	for _, alias := range aliases {
+		if _, ok := seen[alias]; ok {
+			continue
+		}
+		seen[alias] = struct{}{}
+		unique = append(unique, alias)
+	}
+	return unique
+}
+
+// editorBackupSuffixes are appended by editors that save by first renaming
+// the original out of the way: JetBrains "safe write" and Vim/Emacs backups.
+var editorBackupSuffixes = []string{"___jb_old___", "~"}
+
+// IsEditorBackupPath reports whether backupPath is originalPath plus an
+// editor backup suffix, e.g. "foo.py" and "foo.py___jb_old___".
+func IsEditorBackupPath(originalPath, backupPath string) bool {
+	for _, suffix := range editorBackupSuffixes {
+		if backupPath == originalPath+suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// EditorBackupPaths returns the editor backup paths of originalPath, the
+// paths IsEditorBackupPath accepts for it.
+func EditorBackupPaths(originalPath string) []string {
+	paths := make([]string, len(editorBackupSuffixes))
+	for i, suffix := range editorBackupSuffixes {
+		paths[i] = originalPath + suffix
+	}
+	return paths
+}
+
+// isNotebookBackupName reports whether name is a notebook's source or
+// .ipynb name plus an editor backup suffix, e.g. "foo.py~".
+func isNotebookBackupName(name string) bool {
+	for _, suffix := range editorBackupSuffixes {
+		if stem, ok := strings.CutSuffix(name, suffix); ok && (HasNotebookSourceSuffix(stem) || HasNotebookFallbackSuffix(stem)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeName returns name in Unicode NFC, the composed form Databricks
+// stores. macOS clients often send decomposed (NFD) names.
+func NormalizeName(name string) string {
+	return norm.NFC.String(name)
+}
+
 // NotebookSourceCommentPrefix returns the comment prefix Databricks uses for source notebooks.
 func NotebookSourceCommentPrefix(language workspace.Language) string {
 	switch language {
@@ -120,6 +260,24 @@ func NotebookCellDelimiter(language workspace.Language) string {
 	return NotebookSourceCommentPrefix(language) + " COMMAND ----------"
 }
 
+// IsJupyterNotebook reports whether data is a Jupyter notebook in JSON, such
+// as a notebook exported from Databricks as .ipynb: an object with a cells
+// array and an nbformat version.
+func IsJupyterNotebook(data []byte) bool {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\ufeff")), " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return false
+	}
+	var notebook struct {
+		Cells    []json.RawMessage `json:"cells"`
+		NBFormat *int              `json:"nbformat"`
+	}
+	if err := json.Unmarshal(trimmed, &notebook); err != nil {
+		return false
+	}
+	return notebook.Cells != nil && notebook.NBFormat != nil
+}
+
 // collectUniquePerLanguage builds a deduplicated list by applying fn to each language.
 func collectUniquePerLanguage(fn func(workspace.Language) string) []string {
 	result := make([]string, 0, len(sourceSuffixes))
@@ -1,6 +1,7 @@
 package pathutil
 
 import (
+	"slices"
 	"testing"
 
 	"github.com/databricks/databricks-sdk-go/service/workspace"
@@ -225,3 +226,97 @@ func TestNotebookVisibleRoundTrip(t *testing.T) {
 		t.Fatalf("unexpected fallback round trip path: %s", back)
 	}
 }
+
+func TestIsEditorBackupPath(t *testing.T) {
+	tests := []struct {
+		original string
+		backup   string
+		want     bool
+	}{
+		{original: "/Users/test/foo.py", backup: "/Users/test/foo.py___jb_old___", want: true},
+		{original: "/Users/test/foo.py", backup: "/Users/test/foo.py~", want: true},
+		{original: "/Users/test/foo.py", backup: "/Users/test/foo.py___jb_tmp___", want: false},
+		{original: "/Users/test/foo.py", backup: "/Users/test/other.py~", want: false},
+		{original: "/Users/test/foo.py", backup: "/Users/test/foo.py", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsEditorBackupPath(tt.original, tt.backup); got != tt.want {
+			t.Errorf("IsEditorBackupPath(%q, %q) = %v, want %v", tt.original, tt.backup, got, tt.want)
+		}
+	}
+}
+
+func TestNotebookVisibleNameKeepsEditorBackupNames(t *testing.T) {
+	if got := NotebookVisibleName("foo.py~", workspace.LanguagePython); got != "foo.py~" {
+		t.Fatalf("NotebookVisibleName(foo.py~) = %q", got)
+	}
+	if got := NotebookVisiblePath("/dir/foo.ipynb___jb_old___", workspace.LanguagePython); got != "/dir/foo.ipynb___jb_old___" {
+		t.Fatalf("NotebookVisiblePath(foo.ipynb___jb_old___) = %q", got)
+	}
+	if got := NotebookVisibleName("notes~", workspace.LanguagePython); got != "notes~.py" {
+		t.Fatalf("NotebookVisibleName(notes~) = %q, want the source suffix", got)
+	}
+	if got := EditorBackupPaths("/dir/foo.py"); len(got) != 2 || !IsEditorBackupPath("/dir/foo.py", got[0]) || !IsEditorBackupPath("/dir/foo.py", got[1]) {
+		t.Fatalf("EditorBackupPaths = %v", got)
+	}
+}
+
+func TestNotebookAliasPaths(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "/nb.py", want: []string{
+			"/nb.py", "/nb.py.scala", "/nb.py.sql", "/nb.py.py", "/nb.py.R", "/nb.py.ipynb",
+			"/nb", "/nb.scala", "/nb.sql", "/nb.R", "/nb.ipynb",
+		}},
+		{path: "/nb.ipynb", want: []string{
+			"/nb.ipynb", "/nb.ipynb.scala", "/nb.ipynb.sql", "/nb.ipynb.py", "/nb.ipynb.R", "/nb.ipynb.ipynb",
+			"/nb", "/nb.scala", "/nb.sql", "/nb.py", "/nb.R",
+		}},
+		{path: "/nb", want: []string{"/nb", "/nb.scala", "/nb.sql", "/nb.py", "/nb.R", "/nb.ipynb"}},
+		{path: "/", want: []string{"/"}},
+	}
+
+	for _, tt := range tests {
+		if got := NotebookAliasPaths(tt.path); !slices.Equal(got, tt.want) {
+			t.Errorf("NotebookAliasPaths(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	decomposed := "cafe\u0301.py"
+	composed := "caf\u00e9.py"
+	if got := NormalizeName(decomposed); got != composed {
+		t.Fatalf("NormalizeName(%q) = %q, want %q", decomposed, got, composed)
+	}
+	if got := NormalizeName(composed); got != composed {
+		t.Fatalf("NormalizeName changed an NFC name: %q", got)
+	}
+	if got := NormalizeName("plain.txt"); got != "plain.txt" {
+		t.Fatalf("NormalizeName changed an ASCII name: %q", got)
+	}
+}
+
+func TestIsJupyterNotebook(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"notebook", `{"cells": [{"cell_type": "code", "source": []}], "metadata": {}, "nbformat": 4, "nbformat_minor": 0}`, true},
+		{"empty cells", `{"cells": [], "nbformat": 4}`, true},
+		{"byte order mark", "\ufeff\n {\"cells\": [], \"nbformat\": 4}", true},
+		{"source", "# Databricks notebook source\nprint(1)\n", false},
+		{"json without cells", `{"nbformat": 4}`, false},
+		{"json without nbformat", `{"cells": []}`, false},
+		{"malformed", `{"cells": [`, false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		if got := IsJupyterNotebook([]byte(tt.data)); got != tt.want {
+			t.Errorf("%s: IsJupyterNotebook = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package pathutil
+
+import (
+	"fmt"
+	"path"
+	"syscall"
+	"unicode/utf8"
+)
+
+// Limits for names and paths created in the workspace. Names longer than
+// MaxNameBytes cannot be shown through FUSE anyway; MaxPathBytes matches
+// PATH_MAX.
+const (
+	MaxNameBytes = 255
+	MaxPathBytes = 4096
+)
+
+// forbiddenNameChars describes the characters the workspace API rejects in
+// object names, for error messages. Other control characters are reported
+// by code point.
+var forbiddenNameChars = map[rune]string{
+	0x00: "NUL",
+	'\t': "tab",
+	'\n': "newline",
+	'\r': "carriage return",
+	0x7f: "DEL",
+}
+
+// NameError explains why a path cannot be created in the workspace. It
+// unwraps to the errno reported to the kernel.
+type NameError struct {
+	Path   string
+	Reason string
+	Errno  syscall.Errno
+}
+
+func (e *NameError) Error() string {
+	return fmt.Sprintf("invalid workspace path %q: %s", e.Path, e.Reason)
+}
+
+func (e *NameError) Unwrap() error {
+	return e.Errno
+}
+
+// ValidateNewPath checks a path before an object is created or renamed to
+// it, so invalid names fail locally with ENAMETOOLONG or EINVAL instead of
+// a generic server error.
+func ValidateNewPath(p string) error {
+	if len(p) > MaxPathBytes {
+		return &NameError{Path: p, Reason: fmt.Sprintf("path is %d bytes, limit is %d", len(p), MaxPathBytes), Errno: syscall.ENAMETOOLONG}
+	}
+	name := path.Base(p)
+	if len(name) > MaxNameBytes {
+		return &NameError{Path: p, Reason: fmt.Sprintf("name is %d bytes, limit is %d", len(name), MaxNameBytes), Errno: syscall.ENAMETOOLONG}
+	}
+	if !utf8.ValidString(name) {
+		return &NameError{Path: p, Reason: "name is not valid UTF-8", Errno: syscall.EINVAL}
+	}
+	for _, r := range name {
+		if description, forbidden := forbiddenNameChar(r); forbidden {
+			return &NameError{Path: p, Reason: "name contains " + description, Errno: syscall.EINVAL}
+		}
+	}
+	return nil
+}
+
+func forbiddenNameChar(r rune) (string, bool) {
+	if description, ok := forbiddenNameChars[r]; ok {
+		return description, true
+	}
+	if r < 0x20 {
+		return fmt.Sprintf("control character U+%04X", r), true
+	}
+	return "", false
+}
@@ -0,0 +1,55 @@
+package pathutil
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestValidateNewPath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want error
+	}{
+		{name: "plain", path: "/Users/me/notes.txt"},
+		{name: "unicode", path: "/Users/me/メモ.txt"},
+		{name: "spaces", path: "/Users/me/my notes (1).txt"},
+		{name: "longest name", path: "/" + strings.Repeat("a", MaxNameBytes)},
+		{name: "name too long", path: "/" + strings.Repeat("a", MaxNameBytes+1), want: syscall.ENAMETOOLONG},
+		{name: "multibyte name too long", path: "/" + strings.Repeat("あ", 86), want: syscall.ENAMETOOLONG},
+		{name: "path too long", path: strings.Repeat("/dir", MaxPathBytes/4) + "/a", want: syscall.ENAMETOOLONG},
+		{name: "newline", path: "/a\nb", want: syscall.EINVAL},
+		{name: "tab", path: "/a\tb", want: syscall.EINVAL},
+		{name: "NUL", path: "/a\x00b", want: syscall.EINVAL},
+		{name: "control", path: "/a\x1bb", want: syscall.EINVAL},
+		{name: "DEL", path: "/a\x7fb", want: syscall.EINVAL},
+		{name: "invalid UTF-8", path: "/a\xffb", want: syscall.EINVAL},
+		{name: "only parent checked for characters", path: "/a\nb/c.txt"},
+	}
+
+	for _, tt := range tests {
+		err := ValidateNewPath(tt.path)
+		if tt.want == nil {
+			if err != nil {
+				t.Fatalf("%s: ValidateNewPath = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("%s: ValidateNewPath = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNameErrorMessage(t *testing.T) {
+	err := ValidateNewPath("/dir/bad\nname")
+	var nameErr *NameError
+	if !errors.As(err, &nameErr) {
+		t.Fatalf("expected *NameError, got %T", err)
+	}
+	if got := err.Error(); !strings.Contains(got, "newline") || !strings.Contains(got, `"/dir/bad\nname"`) {
+		t.Fatalf("unexpected message %q", got)
+	}
+}
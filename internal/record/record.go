@@ -0,0 +1,296 @@
+// Package record writes and reads session traces: every FUSE request and
+// backend call of a mount with its timing and outcome, one JSON object per
+// line, so a user can attach what led to a corruption or a hang to a bug
+// report and a maintainer can replay the backend calls against a local
+// store. File content and credentials never reach a trace: writes and
+// reads record the size and a digest of the data, and error messages are
+// redacted.
+package record
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of trace entries.
+const (
+	KindFuse = "fuse" // a request from the kernel
+	KindAPI  = "api"  // a call to the storage backend
+)
+
+// Error kinds, which replay compares instead of messages.
+const (
+	ErrorNotExist   = "not_exist"
+	ErrorExist      = "exist"
+	ErrorPermission = "permission"
+	ErrorOther      = "other"
+)
+
+// DirEntry is a listed child in a trace.
+type DirEntry struct {
+	Name string `json:"name"`
+	Dir  bool   `json:"dir,omitempty"`
+	Size int64  `json:"size,omitempty"`
+}
+
+// Entry is one line of a trace.
+type Entry struct {
+	Seq  int64  `json:"seq"`
+	At   int64  `json:"at_us"`  // start, in microseconds since the trace began
+	Dur  int64  `json:"dur_us"` // duration in microseconds
+	Kind string `json:"kind"`
+	Op   string `json:"op"`
+
+	Path      string     `json:"path,omitempty"`   // API path, or the name a FUSE request carries
+	Target    string     `json:"target,omitempty"` // rename destination
+	Node      uint64     `json:"node,omitempty"`   // FUSE node ID
+	Offset    int64      `json:"offset,omitempty"`
+	Recursive bool       `json:"recursive,omitempty"`
+	Size      int64      `json:"size,omitempty"`   // bytes read or written, or the size stated
+	Digest    string     `json:"sha256,omitempty"` // of the bytes read or written, shortened
+	Dir       bool       `json:"dir,omitempty"`    // a stat found a directory
+	Entries   []DirEntry `json:"entries,omitempty"`
+
+	Error     string `json:"error,omitempty"`
+	ErrorKind string `json:"error_kind,omitempty"`
+	Status    int32  `json:"status,omitempty"` // FUSE status, 0 for OK
+	// Unfinished marks a call still running when the trace was closed.
+	Unfinished bool `json:"unfinished,omitempty"`
+}
+
+// Recorder appends entries to a trace. It is safe for concurrent use; a nil
+// Recorder records nothing.
+type Recorder struct {
+	mu       sync.Mutex
+	w        io.Writer
+	c        io.Closer
+	start    time.Time
+	seq      int64
+	err      error
+	closed   bool
+	inFlight map[*Call]struct{}
+}
+
+// Call is a request or backend call in progress.
+type Call struct {
+	rec   *Recorder
+	start time.Time
+	entry Entry
+}
+
+// Create starts a trace in file, replacing it. The file is only readable by
+// its owner, as paths and file names land in it.
+func Create(file string) (*Recorder, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	rec := New(f)
+	rec.c = f
+	return rec, nil
+}
+
+// New starts a trace written to w.
+func New(w io.Writer) *Recorder {
+	return &Recorder{w: w, start: time.Now(), inFlight: make(map[*Call]struct{})}
+}
+
+// Begin starts a call described by e. Calls still in flight when the trace
+// is closed are recorded as unfinished, which is what a hang looks like.
+func (r *Recorder) Begin(e Entry) *Call {
+	if r == nil {
+		return nil
+	}
+	call := &Call{rec: r, start: time.Now(), entry: e}
+	r.mu.Lock()
+	if !r.closed {
+		r.inFlight[call] = struct{}{}
+	}
+	r.mu.Unlock()
+	return call
+}
+
+// End records the call with its outcome in e.
+func (c *Call) End(e Entry) {
+	if c == nil {
+		return
+	}
+	c.rec.mu.Lock()
+	defer c.rec.mu.Unlock()
+	delete(c.rec.inFlight, c)
+	c.rec.writeLocked(c.start, e)
+}
+
+// Entry returns the entry the call was begun with, to be completed for End.
+func (c *Call) Entry() Entry {
+	if c == nil {
+		return Entry{}
+	}
+	return c.entry
+}
+
+// writeLocked appends e, which started at start, stamping its sequence
+// number and timing. Each entry is written straight through, so a trace of
+// a mount that crashes ends with the last completed call. The first write
+// error stops the trace.
+func (r *Recorder) writeLocked(start time.Time, e Entry) {
+	if r.err != nil || r.closed {
+		return
+	}
+	r.seq++
+	e.Seq = r.seq
+	e.At = start.Sub(r.start).Microseconds()
+	e.Dur = time.Since(start).Microseconds()
+	line, err := json.Marshal(e)
+	if err != nil {
+		r.err = err
+		return
+	}
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		r.err = err
+	}
+}
+
+// Err returns the error that stopped the trace, if any.
+func (r *Recorder) Err() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close records the calls still in flight as unfinished, oldest first, and
+// closes the trace.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := make([]*Call, 0, len(r.inFlight))
+	for call := range r.inFlight {
+		calls = append(calls, call)
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].start.Before(calls[j].start) })
+	for _, call := range calls {
+		e := call.entry
+		e.Unfinished = true
+		r.writeLocked(call.start, e)
+	}
+	r.inFlight = nil
+	r.closed = true
+	if r.c == nil {
+		return r.err
+	}
+	if err := r.c.Close(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+// Digest returns the shortened SHA-256 of data that traces record instead
+// of content. It is enough to tell whether two calls moved the same bytes.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SetError records err, redacted, and its kind in e.
+func (e *Entry) SetError(err error) {
+	if err == nil {
+		return
+	}
+	e.Error = Redact(err.Error())
+	e.ErrorKind = ErrorKindOf(err)
+}
+
+// ErrorKindOf classifies err for replay.
+func ErrorKindOf(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrorNotExist
+	case errors.Is(err, fs.ErrExist):
+		return ErrorExist
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorPermission
+	default:
+		return ErrorOther
+	}
+}
+
+var redactions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Signed URLs carry their credentials in the query string.
+	{regexp.MustCompile(`(https?://[^\s?"']+)\?[^\s"']*`), "$1?REDACTED"},
+	{regexp.MustCompile(`(?i)(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 REDACTED"},
+	{regexp.MustCompile(`\bdapi[0-9a-f]{16,}(-\d+)?\b`), "REDACTED"},
+	{regexp.MustCompile(`(?i)((?:access_|refresh_|id_)?token|secret|password)(["']?\s*[:=]\s*["']?)[^\s"'&,]+`), "$1${2}REDACTED"},
+}
+
+// Redact removes credentials from an error message: query strings of URLs,
+// authorization headers, personal access tokens and token or secret
+// assignments.
+func Redact(msg string) string {
+	for _, r := range redactions {
+		msg = r.pattern.ReplaceAllString(msg, r.replacement)
+	}
+	return msg
+}
+
+// Load reads a trace file.
+func Load(file string) ([]Entry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return entries, nil
+}
+
+// Read parses a trace. A truncated last line, left by a mount that was
+// killed mid-write, is ignored.
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var pending error
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if pending != nil {
+			return nil, pending
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			pending = fmt.Errorf("line %d: %w", lineNo, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,280 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"wsfs/internal/databricks"
+)
+
+// Backend call names in a trace.
+const (
+	OpStat        = "stat"
+	OpStatFresh   = "stat_fresh"
+	OpReadDir     = "read_dir"
+	OpReadAll     = "read_all"
+	OpWrite       = "write"
+	OpWriteChunks = "write_chunks"
+	OpDelete      = "delete"
+	OpMkdir       = "mkdir"
+	OpRename      = "rename"
+	// OpWarmRepo is recorded for the trace reader; Replay skips it.
+	OpWarmRepo = "warm_repo"
+)
+
+// ReplayOptions tunes Replay.
+type ReplayOptions struct {
+	// Realtime waits until each call's recorded start before issuing it,
+	// to reproduce timing-dependent hangs. By default calls are issued
+	// back to back.
+	Realtime bool
+}
+
+// Divergence is a replayed call whose outcome differs from the trace.
+type Divergence struct {
+	Seq  int64  `json:"seq"`
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	Want string `json:"want"`
+	Got  string `json:"got"`
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("#%d %s %s: recorded %s, replayed %s", d.Seq, d.Op, d.Path, d.Want, d.Got)
+}
+
+// Report is the result of a Replay.
+type Report struct {
+	Seeded      int          `json:"seeded"`     // objects created before the replay
+	Calls       int          `json:"calls"`      // backend calls replayed
+	Unfinished  int          `json:"unfinished"` // of them, calls the trace never saw finish
+	Skipped     int          `json:"skipped"`    // entries of unknown backend calls
+	Divergences []Divergence `json:"divergences,omitempty"`
+}
+
+// Replay re-executes the backend calls of a trace, in order, against api,
+// normally a local backend on an empty directory. It first seeds api with
+// the objects the trace observed before touching them, with content of the
+// recorded sizes, then compares each replayed outcome with the recorded
+// one: the kind of error, the size and type of a stated object, the size
+// of a read and the length of a listing. Written content is synthetic, as
+// traces hold only its size.
+func Replay(ctx context.Context, api databricks.WorkspaceFilesAPI, entries []Entry, opts ReplayOptions) (Report, error) {
+	var report Report
+	seeded, err := seed(ctx, api, entries)
+	report.Seeded = seeded
+	if err != nil {
+		return report, fmt.Errorf("seed: %w", err)
+	}
+
+	start := time.Now()
+	for _, e := range entries {
+		if e.Kind != KindAPI {
+			continue
+		}
+		if opts.Realtime {
+			wait := time.Until(start.Add(time.Duration(e.At) * time.Microsecond))
+			if wait > 0 {
+				select {
+				case <-ctx.Done():
+					return report, ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		got, ok := replayCall(ctx, api, e)
+		if !ok {
+			report.Skipped++
+			continue
+		}
+		report.Calls++
+		if e.Unfinished {
+			report.Unfinished++
+			continue
+		}
+		if want, got := outcome(e), outcome(got); want != got {
+			report.Divergences = append(report.Divergences, Divergence{Seq: e.Seq, Op: e.Op, Path: e.Path, Want: want, Got: got})
+		}
+	}
+	return report, nil
+}
+
+// replayCall issues the call e recorded and returns its outcome as an
+// entry. It reports false for an unknown call.
+func replayCall(ctx context.Context, api databricks.WorkspaceFilesAPI, e Entry) (Entry, bool) {
+	got := Entry{Op: e.Op, Path: e.Path}
+	switch e.Op {
+	case OpStat, OpStatFresh:
+		stat := api.Stat
+		if e.Op == OpStatFresh {
+			stat = api.StatFresh
+		}
+		info, err := stat(ctx, e.Path)
+		got.SetError(err)
+		if err == nil {
+			got.SetInfo(info)
+		}
+	case OpReadDir:
+		entries, err := api.ReadDir(ctx, e.Path)
+		got.SetError(err)
+		got.Entries = DirEntries(entries)
+	case OpReadAll:
+		data, err := api.ReadAll(ctx, e.Path)
+		got.SetError(err)
+		got.Size = int64(len(data))
+	case OpWrite, OpWriteChunks:
+		// Chunked uploads are replayed as whole writes of the final size.
+		got.SetError(api.Write(ctx, e.Path, content(e.Size)))
+	case OpDelete:
+		got.SetError(api.Delete(ctx, e.Path, e.Recursive))
+	case OpMkdir:
+		got.SetError(api.Mkdir(ctx, e.Path))
+	case OpRename:
+		got.SetError(api.Rename(ctx, e.Path, e.Target))
+	default:
+		return got, false
+	}
+	return got, true
+}
+
+// outcome summarizes what Replay compares of a call.
+func outcome(e Entry) string {
+	if e.ErrorKind != "" {
+		return "error " + e.ErrorKind
+	}
+	switch e.Op {
+	case OpStat, OpStatFresh:
+		if e.Dir {
+			return "directory"
+		}
+		return fmt.Sprintf("file of %d bytes", e.Size)
+	case OpReadDir:
+		return fmt.Sprintf("%d entries", len(e.Entries))
+	case OpReadAll:
+		return fmt.Sprintf("%d bytes", e.Size)
+	}
+	return "ok"
+}
+
+// seedObject is the first state of a path the trace observed.
+type seedObject struct {
+	dir  bool
+	size int64
+}
+
+// seed creates in api every object the trace observed through a stat, a
+// listing or a read before any call changed it or a directory above it.
+// It returns the number of objects created.
+func seed(ctx context.Context, api databricks.WorkspaceFilesAPI, entries []Entry) (int, error) {
+	objects := make(map[string]seedObject)
+	touched := make(map[string]bool)
+	isTouched := func(p string) bool {
+		for ; ; p = path.Dir(p) {
+			if touched[p] {
+				return true
+			}
+			if p == "/" || p == "." {
+				return false
+			}
+		}
+	}
+	observe := func(p string, object seedObject) {
+		if _, ok := objects[p]; !ok && !isTouched(p) {
+			objects[p] = object
+		}
+	}
+
+	for _, e := range entries {
+		if e.Kind != KindAPI || e.Unfinished {
+			continue
+		}
+		switch e.Op {
+		case OpWrite, OpWriteChunks, OpDelete, OpMkdir:
+			touched[e.Path] = true
+		case OpRename:
+			touched[e.Path] = true
+			touched[e.Target] = true
+		}
+		if e.ErrorKind != "" {
+			continue
+		}
+		switch e.Op {
+		case OpStat, OpStatFresh, OpReadAll:
+			observe(e.Path, seedObject{dir: e.Dir, size: e.Size})
+		case OpReadDir:
+			observe(e.Path, seedObject{dir: true})
+			for _, child := range e.Entries {
+				observe(path.Join(e.Path, child.Name), seedObject{dir: child.Dir, size: child.Size})
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(objects))
+	for p, object := range objects {
+		if !object.dir || p != "/" {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for i, p := range paths {
+		object := objects[p]
+		if object.dir {
+			if err := api.Mkdir(ctx, p); err != nil {
+				return i, fmt.Errorf("mkdir %s: %w", p, err)
+			}
+			continue
+		}
+		if dir := path.Dir(p); dir != "/" {
+			if err := api.Mkdir(ctx, dir); err != nil {
+				return i, fmt.Errorf("mkdir %s: %w", dir, err)
+			}
+		}
+		if err := api.Write(ctx, p, content(object.size)); err != nil {
+			return i, fmt.Errorf("write %s: %w", p, err)
+		}
+	}
+	return len(paths), nil
+}
+
+// content returns synthetic file content of size bytes: text, so transforms
+// and notebook checks treat it like a source file.
+func content(size int64) []byte {
+	if size <= 0 {
+		return nil
+	}
+	line := []byte(strings.Repeat("x", 79) + "\n")
+	return bytes.Repeat(line, int(size)/len(line)+1)[:size]
+}
+
+// DirEntries converts a listing for a trace.
+func DirEntries(entries []fs.DirEntry) []DirEntry {
+	if entries == nil {
+		return nil
+	}
+	out := make([]DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		e := DirEntry{Name: entry.Name(), Dir: entry.IsDir()}
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			e.Size = info.Size()
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// SetInfo records the type and size of a stated object in e.
+func (e *Entry) SetInfo(info fs.FileInfo) {
+	e.Dir = info.IsDir()
+	if !e.Dir {
+		e.Size = info.Size()
+	}
+}
@@ -24,10 +24,29 @@ func NewHTTPClient(timeout time.Duration, config Config) *HTTPClient {
 	}
 }
 
+// NewHTTPClientWithTransport creates a retryable HTTP client that sends
+// requests through transport. A nil transport uses http.DefaultTransport.
+func NewHTTPClientWithTransport(timeout time.Duration, transport http.RoundTripper, config Config) *HTTPClient {
+	return &HTTPClient{
+		client: &http.Client{Timeout: timeout, Transport: transport},
+		config: config,
+	}
+}
+
+// ProgressFunc receives the number of request body bytes sent so far in the
+// current attempt. It restarts from zero when a request is retried.
+type ProgressFunc func(sent int64)
+
 // Do performs an HTTP request with retry logic for retryable status codes.
 // The request body must be replayable (will be reset on retry).
 // Returns the response and any error encountered.
 func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return c.DoWithProgress(req, nil)
+}
+
+// DoWithProgress is like Do and reports request body progress to progress
+// while the body is sent.
+func (c *HTTPClient) DoWithProgress(req *http.Request, progress ProgressFunc) (*http.Response, error) {
 	var lastErr error
 	var lastResp *http.Response
 
@@ -65,7 +84,12 @@ func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
 
 		// Reset request body for retry
 		if bodyBytes != nil {
-			req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+			var body io.Reader = bytes.NewReader(bodyBytes)
+			if progress != nil {
+				progress(0)
+				body = &progressReader{r: body, progress: progress}
+			}
+			req.Body = io.NopCloser(body)
 		}
 
 		resp, err := c.client.Do(req)
@@ -95,6 +119,22 @@ func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
 	return nil, fmt.Errorf("max retries exceeded: %w", lastErr)
 }
 
+// progressReader reports the running byte count after every read.
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	progress ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.sent += int64(n)
+		r.progress(r.sent)
+	}
+	return n, err
+}
+
 // parseRetryAfterFromResp extracts Retry-After header from response
 func parseRetryAfterFromResp(resp *http.Response) time.Duration {
 	if resp == nil {
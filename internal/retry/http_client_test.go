@@ -178,3 +178,55 @@ func TestParseRetryAfterFromResp(t *testing.T) {
 		t.Fatalf("expected 0, got %v", got)
 	}
 }
+
+func TestNewHTTPClientWithTransport(t *testing.T) {
+	transport := &http.Transport{}
+	client := NewHTTPClientWithTransport(time.Second, transport, Config{})
+	if client.client.Transport != transport {
+		t.Fatal("expected custom transport")
+	}
+}
+
+func TestHTTPClientDoWithProgressRestartsOnRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = io.ReadAll(r.Body)
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	body := strings.Repeat("x", 64*1024)
+	req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	var reports []int64
+	client := NewHTTPClient(2*time.Second, Config{MaxRetries: 1, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	resp, err := client.DoWithProgress(req, func(sent int64) {
+		reports = append(reports, sent)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	zeros := 0
+	for i, sent := range reports {
+		if sent == 0 {
+			zeros++
+		} else if i > 0 && reports[i-1] > sent {
+			t.Fatalf("progress went backwards within an attempt: %v", reports)
+		}
+	}
+	if zeros != 2 {
+		t.Fatalf("expected progress to restart for each attempt, got %v", reports)
+	}
+	if last := reports[len(reports)-1]; last != int64(len(body)) {
+		t.Fatalf("expected final progress %d, got %d", len(body), last)
+	}
+}
@@ -0,0 +1,181 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// newStripOutputs returns the strip-outputs transform, which drops the
+// outputs and execution counts of the code cells of a Jupyter notebook,
+// like nbstripout, so saved notebooks do not carry results into the
+// workspace. Content that is not a notebook is left alone. A notebook with
+// nothing to strip is returned as is; otherwise it is written back the way
+// Jupyter writes it: sorted keys, one-space indent and a final newline.
+func newStripOutputs(value string) (Func, error) {
+	if value != "" {
+		return nil, fmt.Errorf("takes no value")
+	}
+	return stripOutputs, nil
+}
+
+func stripOutputs(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var notebook map[string]any
+	if err := decoder.Decode(&notebook); err != nil {
+		return data, nil
+	}
+	cells, ok := notebook["cells"].([]any)
+	if !ok {
+		return data, nil
+	}
+
+	changed := false
+	for _, c := range cells {
+		cell, ok := c.(map[string]any)
+		if !ok || cell["cell_type"] != "code" {
+			continue
+		}
+		if outputs, ok := cell["outputs"].([]any); !ok || len(outputs) > 0 {
+			cell["outputs"] = []any{}
+			changed = true
+		}
+		if cell["execution_count"] != nil {
+			cell["execution_count"] = nil
+			changed = true
+		}
+	}
+	if !changed {
+		return data, nil
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", " ")
+	if err := encoder.Encode(notebook); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// newEOL returns the eol=lf and eol=crlf transforms, which convert the line
+// endings of text content. Binary content is left alone.
+func newEOL(value string) (Func, error) {
+	switch value {
+	case "lf":
+		return toLF, nil
+	case "crlf":
+		return toCRLF, nil
+	}
+	return nil, fmt.Errorf("want eol=lf or eol=crlf")
+}
+
+func toLF(data []byte) ([]byte, error) {
+	if isBinary(data) || !bytes.Contains(data, []byte("\r\n")) {
+		return data, nil
+	}
+	return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), nil
+}
+
+func toCRLF(data []byte) ([]byte, error) {
+	if isBinary(data) {
+		return data, nil
+	}
+	lf := bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	crlf := bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n"))
+	if bytes.Equal(crlf, data) {
+		return data, nil
+	}
+	return crlf, nil
+}
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// newEncoding returns the encoding=utf-8 transform, which stores text as
+// UTF-8 without a byte order mark: a UTF-8 BOM is dropped and UTF-16 with a
+// BOM, as Windows tools write it, is converted. Other content must already
+// be valid UTF-8, or the transform fails. Binary content is left alone.
+func newEncoding(value string) (Func, error) {
+	if value != "utf-8" {
+		return nil, fmt.Errorf("want encoding=utf-8")
+	}
+	return toUTF8, nil
+}
+
+func toUTF8(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		data = data[len(bomUTF8):]
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return decodeUTF16(data[len(bomUTF16LE):], binary.LittleEndian)
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return decodeUTF16(data[len(bomUTF16BE):], binary.BigEndian)
+	}
+	if isBinary(data) {
+		return data, nil
+	}
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("invalid UTF-8 at byte %d", invalidUTF8Offset(data))
+	}
+	return data, nil
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, errors.New("UTF-16 content has an odd number of bytes")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	out := make([]byte, 0, len(units))
+	for _, r := range utf16.Decode(units) {
+		if r == utf8.RuneError {
+			return nil, errors.New("invalid UTF-16")
+		}
+		out = utf8.AppendRune(out, r)
+	}
+	return out, nil
+}
+
+func invalidUTF8Offset(data []byte) int {
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return len(data)
+}
+
+// newText returns the text transform, for files edited from several
+// operating systems: encoding=utf-8 followed by eol=lf, or eol=crlf with
+// text=crlf. Mixed line endings come out uniform.
+func newText(value string) (Func, error) {
+	eol := toLF
+	switch value {
+	case "", "lf":
+	case "crlf":
+		eol = toCRLF
+	default:
+		return nil, fmt.Errorf("want text, text=lf or text=crlf")
+	}
+	return func(data []byte) ([]byte, error) {
+		data, err := toUTF8(data)
+		if err != nil {
+			return nil, err
+		}
+		return eol(data)
+	}, nil
+}
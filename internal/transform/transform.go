@@ -0,0 +1,206 @@
+// Package transform rewrites file content on its way to the workspace, per
+// path pattern, as configured in a .wsfsattributes file. Transforms are
+// registered by name, so new ones plug in without changes to the parser or
+// to the file system. The file also carries the pin directive, which keeps
+// matching files in the disk cache.
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Func rewrites the content of a file. It returns data itself when nothing
+// changes.
+type Func func(data []byte) ([]byte, error)
+
+// Factory builds a transform from the value of its attribute: "" for
+// "name", "lf" for "name=lf".
+type Factory func(value string) (Func, error)
+
+// PinAttribute marks matching files as pinned in the disk cache. It is a
+// directive, not a transform, and leaves the content alone.
+const PinAttribute = "pin"
+
+var registry = map[string]Factory{
+	"strip-outputs": newStripOutputs,
+	"eol":           newEOL,
+	"encoding":      newEncoding,
+	"text":          newText,
+}
+
+// Register adds a transform under name. It is meant to be called from init
+// functions and panics when the name is taken.
+func Register(name string, factory Factory) {
+	if _, ok := registry[name]; ok || name == PinAttribute {
+		panic("transform: " + name + " registered twice")
+	}
+	registry[name] = factory
+}
+
+// Names returns the registered transform names, sorted.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set is a parsed .wsfsattributes file.
+type Set struct {
+	rules []rule
+}
+
+type rule struct {
+	pattern string   // lower-cased
+	attrs   []string // the transforms, in step with funcs
+	funcs   []Func
+	pin     bool
+}
+
+// Load reads a .wsfsattributes file.
+func Load(file string) (*Set, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	set, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return set, nil
+}
+
+// Parse reads .wsfsattributes lines of the form
+//
+//	PATTERN ATTRIBUTE...
+//
+// like .gitattributes. A pattern with a slash is a path pattern relative to
+// the mount root and also covers everything below a matching directory;
+// any other pattern matches file names. Matching ignores case. Blank lines
+// and lines starting with # are skipped.
+func Parse(r io.Reader) (*Set, error) {
+	set := &Set{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("line %d: pattern %q has no attributes", lineNo, fields[0])
+		}
+		pattern := strings.ToLower(fields[0])
+		if strings.Contains(pattern, "/") {
+			pattern = path.Clean("/" + pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("line %d: pattern %q: %w", lineNo, fields[0], err)
+		}
+		rule := rule{pattern: pattern}
+		for _, attr := range fields[1:] {
+			if attr == PinAttribute {
+				rule.pin = true
+				continue
+			}
+			name, value, _ := strings.Cut(attr, "=")
+			factory, ok := registry[name]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown attribute %q (available: %s)", lineNo, name, strings.Join(append(Names(), PinAttribute), ", "))
+			}
+			fn, err := factory(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", lineNo, attr, err)
+			}
+			rule.attrs = append(rule.attrs, attr)
+			rule.funcs = append(rule.funcs, fn)
+		}
+		set.rules = append(set.rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Apply runs the transforms of every rule matching the mount-relative path
+// p on data, in file order, so a later rule has the last word. It returns
+// the result and the attributes applied.
+func (s *Set) Apply(p string, data []byte) ([]byte, []string, error) {
+	if s == nil {
+		return data, nil, nil
+	}
+	var applied []string
+	for _, rule := range s.rules {
+		if !matches(rule.pattern, p) {
+			continue
+		}
+		for i, fn := range rule.funcs {
+			out, err := fn(data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", rule.attrs[i], err)
+			}
+			data = out
+			applied = append(applied, rule.attrs[i])
+		}
+	}
+	return data, applied, nil
+}
+
+// HasPins reports whether any rule pins files.
+func (s *Set) HasPins() bool {
+	if s == nil {
+		return false
+	}
+	for _, rule := range s.rules {
+		if rule.pin {
+			return true
+		}
+	}
+	return false
+}
+
+// Pinned reports whether a rule with the pin directive matches the
+// mount-relative path p.
+func (s *Set) Pinned(p string) bool {
+	if s == nil {
+		return false
+	}
+	for _, rule := range s.rules {
+		if rule.pin && matches(rule.pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(pattern, p string) bool {
+	lowered := strings.ToLower(path.Clean("/" + p))
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(lowered))
+		return ok
+	}
+	for dir := lowered; ; dir = path.Dir(dir) {
+		if ok, _ := path.Match(pattern, dir); ok {
+			return true
+		}
+		if dir == "/" {
+			return false
+		}
+	}
+}
+
+// isBinary reports whether data looks binary, like git does: it has a NUL
+// byte in its first 8000 bytes.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
@@ -0,0 +1,272 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const notebookWithOutputs = `{"cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": ["# <Title> & more"]},
+  {"cell_type": "code", "execution_count": 3, "metadata": {}, "outputs": [{"output_type": "stream", "text": ["hi\n"]}], "source": ["print('hi')"]}
+ ],
+ "metadata": {"kernelspec": {"name": "python3"}},
+ "nbformat": 4, "nbformat_minor": 5}`
+
+func TestParseAndApply(t *testing.T) {
+	set, err := Parse(strings.NewReader(`
+# comment
+*.IPYNB      strip-outputs
+*.sh         eol=lf
+scripts/win  eol=crlf
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	out, applied, err := set.Apply("/src/run.sh", []byte("a\r\nb\r\n"))
+	if err != nil || string(out) != "a\nb\n" || !reflect.DeepEqual(applied, []string{"eol=lf"}) {
+		t.Fatalf("Apply to run.sh = %q %v %v", out, applied, err)
+	}
+	// Directory patterns cover the tree below, and a later rule wins.
+	out, applied, err = set.Apply("/Scripts/Win/setup.sh", []byte("a\r\nb\n"))
+	if err != nil || string(out) != "a\r\nb\r\n" || !reflect.DeepEqual(applied, []string{"eol=lf", "eol=crlf"}) {
+		t.Fatalf("Apply to setup.sh = %q %v %v", out, applied, err)
+	}
+	out, applied, err = set.Apply("/notes.txt", []byte("a\r\n"))
+	if err != nil || string(out) != "a\r\n" || applied != nil {
+		t.Fatalf("Apply to an unmatched path = %q %v %v", out, applied, err)
+	}
+	var nilSet *Set
+	if out, _, err := nilSet.Apply("/run.sh", []byte("a\r\n")); err != nil || string(out) != "a\r\n" {
+		t.Fatalf("nil set changed content: %q %v", out, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"*.py",
+		"*.py unknown",
+		"*.py eol=cr",
+		"*.py strip-outputs=yes",
+		"[ eol=lf",
+	} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Fatalf("Parse(%q) succeeded", input)
+		}
+	}
+}
+
+func TestPinDirective(t *testing.T) {
+	set, err := Parse(strings.NewReader(`
+libs/shared  pin
+*.whl        pin eol=lf
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !set.HasPins() {
+		t.Fatal("HasPins = false")
+	}
+	for p, want := range map[string]bool{
+		"/libs/shared/big.so": true,
+		"/dist/pkg.WHL":       true,
+		"/libs/other.so":      false,
+	} {
+		if got := set.Pinned(p); got != want {
+			t.Errorf("Pinned(%q) = %v, want %v", p, got, want)
+		}
+	}
+	// The directive is not a transform.
+	if _, applied, err := set.Apply("/dist/pkg.whl", []byte("a\r\n")); err != nil || !reflect.DeepEqual(applied, []string{"eol=lf"}) {
+		t.Fatalf("Apply = %v, %v", applied, err)
+	}
+	var nilSet *Set
+	if nilSet.HasPins() || nilSet.Pinned("/libs/shared/big.so") {
+		t.Fatal("nil set pins files")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".wsfsattributes")
+	if err := os.WriteFile(file, []byte("*.sh eol=lf\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Load(file); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, err := Load(file + ".missing"); !os.IsNotExist(err) {
+		t.Fatalf("Load of a missing file = %v", err)
+	}
+}
+
+func TestStripOutputs(t *testing.T) {
+	out, err := stripOutputs([]byte(notebookWithOutputs))
+	if err != nil {
+		t.Fatalf("stripOutputs: %v", err)
+	}
+	want := `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": [
+    "# <Title> & more"
+   ]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": null,
+   "metadata": {},
+   "outputs": [],
+   "source": [
+    "print('hi')"
+   ]
+  }
+ ],
+ "metadata": {
+  "kernelspec": {
+   "name": "python3"
+  }
+ },
+ "nbformat": 4,
+ "nbformat_minor": 5
+}
+`
+	if string(out) != want {
+		t.Fatalf("stripped notebook =\n%s\nwant\n%s", out, want)
+	}
+
+	again, err := stripOutputs(out)
+	if err != nil || &again[0] != &out[0] {
+		t.Fatal("a clean notebook was rewritten")
+	}
+	for _, input := range []string{"not json", `{"metadata": {}}`} {
+		if out, err := stripOutputs([]byte(input)); err != nil || string(out) != input {
+			t.Fatalf("stripOutputs(%q) = %q, %v; want it unchanged", input, out, err)
+		}
+	}
+}
+
+func TestStripOutputsKeepsDatabricksMetadata(t *testing.T) {
+	input := `{"cells": [{"cell_type": "code", "execution_count": 3, "outputs": [{"output_type": "stream", "text": ["42"]}],
+  "metadata": {"application/vnd.databricks.v1+cell": {"cellMetadata": {"byteLimit": 2048000, "rowLimit": 10000}, "nuid": "a1", "title": "Load"}},
+  "source": ["dbutils.widgets.text(\"table\", \"events\")"]}],
+ "metadata": {"application/vnd.databricks.v1+notebook": {"language": "python", "notebookName": "report", "dashboards": [],
+  "widgets": {"table": {"currentValue": "events", "widgetInfo": {"defaultValue": "events", "label": null, "widgetType": "text"}}}}},
+ "nbformat": 4, "nbformat_minor": 0}`
+	out, err := stripOutputs([]byte(input))
+	if err != nil {
+		t.Fatalf("stripOutputs: %v", err)
+	}
+
+	metadata := func(data []byte) (any, any) {
+		var notebook struct {
+			Cells []struct {
+				Metadata any `json:"metadata"`
+			} `json:"cells"`
+			Metadata any `json:"metadata"`
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&notebook); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return notebook.Metadata, notebook.Cells[0].Metadata
+	}
+	wantNotebook, wantCell := metadata([]byte(input))
+	gotNotebook, gotCell := metadata(out)
+	if !reflect.DeepEqual(gotNotebook, wantNotebook) || !reflect.DeepEqual(gotCell, wantCell) {
+		t.Fatalf("metadata changed:\n%s", out)
+	}
+	if !strings.Contains(string(out), `"byteLimit": 2048000`) {
+		t.Fatalf("numbers were rewritten:\n%s", out)
+	}
+}
+
+func TestEOLSkipsBinaryContent(t *testing.T) {
+	lf, _ := newEOL("lf")
+	binary := []byte("a\r\n\x00b\r\n")
+	if out, err := lf(binary); err != nil || string(out) != string(binary) {
+		t.Fatalf("eol=lf changed binary content: %q %v", out, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("upper", func(string) (Func, error) {
+		return func(data []byte) ([]byte, error) { return []byte(strings.ToUpper(string(data))), nil }, nil
+	})
+	t.Cleanup(func() { delete(registry, "upper") })
+
+	set, err := Parse(strings.NewReader("*.txt upper"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if out, _, _ := set.Apply("/a.txt", []byte("abc")); string(out) != "ABC" {
+		t.Fatalf("registered transform not applied: %q", out)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a name twice did not panic")
+		}
+	}()
+	Register("eol", newEOL)
+}
+
+func TestEncodingNormalizesToUTF8(t *testing.T) {
+	toUTF8, err := newEncoding("utf-8")
+	if err != nil {
+		t.Fatalf("newEncoding: %v", err)
+	}
+	for _, tc := range []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"utf-8 BOM", []byte("\xef\xbb\xbfcafé\r\n"), "café\r\n"},
+		{"utf-16le BOM", []byte("\xff\xfec\x00a\x00f\x00\xe9\x00\r\x00\n\x00"), "café\r\n"},
+		{"utf-16be BOM", []byte("\xfe\xff\x00c\x00a\x00f\x00\xe9\x00\r\x00\n"), "café\r\n"},
+		{"plain utf-8", []byte("café\n"), "café\n"},
+		{"binary", []byte("\x00\xff\xfe"), "\x00\xff\xfe"},
+	} {
+		out, err := toUTF8(tc.input)
+		if err != nil || string(out) != tc.want {
+			t.Fatalf("%s: encoding=utf-8 = %q, %v; want %q", tc.name, out, err, tc.want)
+		}
+	}
+
+	for _, input := range [][]byte{[]byte("caf\xe9\n"), []byte("\xff\xfec\x00a"), []byte("\xff\xfe\x00\xd8")} {
+		if _, err := toUTF8(input); err == nil {
+			t.Fatalf("encoding=utf-8 accepted %q", input)
+		}
+	}
+	if _, err := newEncoding("latin-1"); err == nil {
+		t.Fatal("encoding=latin-1 accepted")
+	}
+}
+
+func TestTextNormalizesMixedLineEndings(t *testing.T) {
+	set, err := Parse(strings.NewReader("*.py text\n*.bat text=crlf\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	mixed := []byte("\xef\xbb\xbf# Databricks notebook source\r\nprint(1)\n# COMMAND ----------\r\n")
+	out, _, err := set.Apply("/nb.py", mixed)
+	if err != nil || string(out) != "# Databricks notebook source\nprint(1)\n# COMMAND ----------\n" {
+		t.Fatalf("text = %q, %v", out, err)
+	}
+	out, _, err = set.Apply("/run.bat", []byte("a\nb\r\n"))
+	if err != nil || string(out) != "a\r\nb\r\n" {
+		t.Fatalf("text=crlf = %q, %v", out, err)
+	}
+	if _, _, err := set.Apply("/nb.py", []byte("caf\xe9")); err == nil {
+		t.Fatal("text accepted invalid UTF-8")
+	}
+	if _, err := Parse(strings.NewReader("*.py text=cr")); err == nil {
+		t.Fatal("text=cr accepted")
+	}
+}
@@ -0,0 +1,47 @@
+// Package unixsock creates the unix sockets wsfs serves on.
+package unixsock
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// Listen creates a socket at socketPath that only its owner can connect
+// to. A stale socket left behind by a crashed wsfs is replaced.
+func Listen(socketPath string) (net.Listener, error) {
+	if err := removeStale(socketPath); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socketPath, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// removeStale deletes a socket nobody listens on. It refuses to touch a
+// socket that still accepts connections or a path that is not a socket.
+func removeStale(socketPath string) error {
+	info, err := os.Lstat(socketPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", socketPath)
+	}
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", socketPath)
+	}
+	return os.Remove(socketPath)
+}
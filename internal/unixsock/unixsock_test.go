@@ -0,0 +1,57 @@
+package unixsock
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenCreatesOwnerOnlySocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	listener, err := Listen(socketPath)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("socket mode = %o, want 600", perm)
+	}
+	if _, err := Listen(socketPath); err == nil {
+		t.Fatal("expected a live socket to be refused")
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "wsfs.sock")
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := Listen(socketPath)
+	if err != nil {
+		t.Fatalf("Listen over stale socket: %v", err)
+	}
+	listener.Close()
+}
+
+func TestListenRefusesNonSocketPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "important.txt")
+	if err := os.WriteFile(path, []byte("keep me"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Listen(path); err == nil {
+		t.Fatal("expected a regular file to be refused")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "keep me" {
+		t.Fatalf("file was modified: %q", data)
+	}
+}